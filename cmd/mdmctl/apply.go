@@ -18,8 +18,8 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/pkcs12"
 
+	mdmcrypto "github.com/micromdm/micromdm/pkg/crypto"
 	"github.com/micromdm/micromdm/pkg/crypto/profileutil"
 	"github.com/micromdm/micromdm/platform/blueprint"
 	"github.com/micromdm/micromdm/platform/profile"
@@ -235,32 +235,34 @@ func (cmd *applyCommand) applyBlock(args []string) error {
 	return nil
 }
 
-func loadSigningKey(keyPass, keyPath, certPath string) (crypto.PrivateKey, *x509.Certificate, error) {
+// loadSigningKey returns the signing key and certificate, and the intermediates
+// which follow the certificate in a PEM file, or are the CA certificates of a p12 file.
+func loadSigningKey(keyPass, keyPath, certPath string) (crypto.PrivateKey, *x509.Certificate, []*x509.Certificate, error) {
 	certData, err := ioutil.ReadFile(certPath)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	isP12 := filepath.Ext(certPath) == ".p12"
 	if isP12 {
-		pkey, cert, err := pkcs12.Decode(certData, keyPass)
-		return pkey, cert, errors.Wrap(err, "decode p12 contents")
+		cert, pkey, intermediates, err := mdmcrypto.ReadPKCS12File(certPath, keyPass)
+		return pkey, cert, intermediates, errors.Wrap(err, "decode p12 contents")
 	}
 
 	keyData, err := ioutil.ReadFile(keyPath)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "read key from file")
+		return nil, nil, nil, errors.Wrap(err, "read key from file")
 	}
 
 	keyDataBlock, _ := pem.Decode(keyData)
 	if keyDataBlock == nil {
-		return nil, nil, errors.Errorf("invalid PEM data for private key %s", keyPath)
+		return nil, nil, nil, errors.Errorf("invalid PEM data for private key %s", keyPath)
 	}
 	var pemKeyData []byte
 	if x509.IsEncryptedPEMBlock(keyDataBlock) {
 		b, err := x509.DecryptPEMBlock(keyDataBlock, []byte(keyPass))
 		if err != nil {
-			return nil, nil, fmt.Errorf("decrypting DES private key %s", err)
+			return nil, nil, nil, fmt.Errorf("decrypting DES private key %s", err)
 		}
 		pemKeyData = b
 	} else {
@@ -269,20 +271,15 @@ func loadSigningKey(keyPass, keyPath, certPath string) (crypto.PrivateKey, *x509
 
 	priv, err := x509.ParsePKCS1PrivateKey(pemKeyData)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "parse private key")
+		return nil, nil, nil, errors.Wrap(err, "parse private key")
 	}
 
-	pub, _ := pem.Decode(certData)
-	if pub == nil {
-		return nil, nil, errors.Errorf("invalid PEM data for certificate %q", certPath)
-	}
-
-	cert, err := x509.ParseCertificate(pub.Bytes)
+	certs, err := mdmcrypto.ParsePEMCertificates(certData)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "parse PEM certificate data")
+		return nil, nil, nil, errors.Wrapf(err, "parse PEM certificate data %q", certPath)
 	}
 
-	return priv, cert, nil
+	return priv, certs[0], certs[1:], nil
 }
 
 func (cmd *applyCommand) applyProfile(args []string) error {
@@ -330,12 +327,16 @@ Examples
 		return err
 	}
 
+	if err := profile.ValidateProfile(profileBytes); err != nil {
+		return err
+	}
+
 	if *flSign {
-		priv, pub, err := loadSigningKey(*flKeyPass, *flKeyPath, *flCertPath)
+		priv, pub, intermediates, err := loadSigningKey(*flKeyPass, *flKeyPath, *flCertPath)
 		if err != nil {
 			return errors.Wrap(err, "loading signing certificate and private key")
 		}
-		signed, err := profileutil.Sign(priv, pub, profileBytes)
+		signed, err := profileutil.Sign(priv, pub, profileBytes, intermediates...)
 		if err != nil {
 			return errors.Wrap(err, "signing profile with the specified key")
 		}
@@ -35,6 +35,10 @@ func (cmd *applyCommand) applyApp(args []string) error {
 		flSignIdentity = flagset.String("sign-identity", "", "sign package before importing, requires specifying path to .p12 developer identity (optional)")
 		flIdentityPass = flagset.String("password", "", "password used for -sign-identity (optional)")
 		flUpload       = flagset.Bool("upload", false, "upload package and/or manifest to micromdm repository.")
+
+		flBundleID      = flagset.String("bundle-id", "", "bundle identifier to add to the manifest metadata (optional)")
+		flBundleVersion = flagset.String("bundle-version", "", "bundle version to add to the manifest metadata, requires -bundle-id")
+		flTitle         = flagset.String("title", "", "title to add to the manifest metadata, requires -bundle-id")
 	)
 	flagset.Usage = usageFor(flagset, "mdmctl apply app [flags]")
 	if err := flagset.Parse(args); err != nil {
@@ -106,6 +110,9 @@ Please rebuild the package and re-run the command.
 	defer f.Close()
 
 	opts := []appmanifest.Option{appmanifest.WithMD5Size(*flHashSize)}
+	if *flBundleID != "" {
+		opts = append(opts, appmanifest.WithMetadata(*flBundleID, *flBundleVersion, *flTitle))
+	}
 	manifest, err := appmanifest.Create(&appFile{f}, pkgurl, opts...)
 	if err != nil {
 		return errors.Wrap(err, "creating manifest")
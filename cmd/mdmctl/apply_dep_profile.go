@@ -116,11 +116,10 @@ func printDEPProfileTemplate(anchorCerts []*x509.Certificate) error {
 	var anchorCertStr string = "[]"
 
 	// convert certificates into base64 encoded strings
-	// json.Marshal does this for us for byte[] arrays
 	if len(anchorCerts) > 0 {
-		var certs [][]byte
+		var certs []string
 		for _, cert := range anchorCerts {
-			certs = append(certs, cert.Raw)
+			certs = append(certs, crypto.CertificateToBase64(cert))
 		}
 		jsonBytes, err := json.Marshal(certs)
 		if err != nil {
@@ -141,7 +141,7 @@ func (cmd *getCommand) getDevices(args []string) error {
 		flFilterSerialsSlice = strings.Split(*flFilterSerials, ",")
 	}
 
-	devices, err := cmd.devicesvc.ListDevices(ctx, device.ListDevicesOption{FilterSerial: flFilterSerialsSlice})
+	devices, _, err := cmd.devicesvc.ListDevices(ctx, device.ListDevicesOption{FilterSerial: flFilterSerialsSlice})
 	if err != nil {
 		return err
 	}
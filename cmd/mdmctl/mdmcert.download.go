@@ -208,7 +208,11 @@ func (cmd *mdmcertDownloadCommand) Run(args []string) error {
 		}
 		var pkiKey *rsa.PrivateKey
 		if *flPKeyPass != "" {
-			pkiKey, err = crypto.ReadEncryptedPEMRSAKeyFile(*flKeyPath, []byte(*flPKeyPass))
+			var cipherName string
+			pkiKey, cipherName, err = crypto.ReadEncryptedPEMRSAKeyFileInfo(*flKeyPath, []byte(*flPKeyPass))
+			if err == nil && crypto.IsDeprecatedKeyCipher(cipherName) {
+				fmt.Fprintf(os.Stderr, "warning: PKI private key %s is encrypted with deprecated cipher %s, consider re-encrypting it with AES\n", *flKeyPath, cipherName)
+			}
 		} else {
 			pkiKey, err = crypto.ReadPEMRSAKeyFile(*flKeyPath)
 		}
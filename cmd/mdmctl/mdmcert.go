@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"flag"
@@ -14,7 +13,6 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/pkcs12"
 
 	"github.com/micromdm/micromdm/pkg/crypto"
 	"github.com/micromdm/micromdm/pkg/crypto/mdmcertutil"
@@ -223,6 +221,10 @@ func (cmd *mdmcertCommand) runUpload(args []string) error {
 		return errors.Wrap(err, "load push certificate")
 	}
 
+	if err := validatePushCert(cert); err != nil {
+		return err
+	}
+
 	if err := cmd.configsvc.SavePushCertificate(context.Background(), cert, key); err != nil {
 		return errors.Wrap(err, "upload push certificate and key to server")
 	}
@@ -230,21 +232,26 @@ func (cmd *mdmcertCommand) runUpload(args []string) error {
 	return nil
 }
 
+// validatePushCert checks the PEM encoded push certificate before it is uploaded.
+func validatePushCert(pemCert []byte) error {
+	block, _ := pem.Decode(pemCert)
+	if block == nil {
+		return errors.New("invalid PEM data for push certificate")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return errors.Wrap(err, "parse push certificate")
+	}
+	return crypto.ValidatePushCertificate(certificate)
+}
+
 func loadPushCerts(certPath, keyPath, keyPass string) (cert, key []byte, err error) {
 	isP12 := filepath.Ext(certPath) == ".p12"
 	if isP12 {
-		pkcs12Data, err := ioutil.ReadFile(certPath)
+		certificate, pkey, _, err := crypto.ReadPKCS12File(certPath, keyPass)
 		if err != nil {
 			return nil, nil, errors.Wrapf(err, "read p12 path %s", certPath)
 		}
-		pkeyi, certificate, err := pkcs12.Decode(pkcs12Data, keyPass)
-		if err != nil {
-			return nil, nil, errors.Wrap(err, "decode pkcs12 file")
-		}
-		pkey, ok := pkeyi.(*rsa.PrivateKey)
-		if !ok {
-			return nil, nil, errors.New("private key not a valid rsa key")
-		}
 
 		pemKey := pem.EncodeToMemory(&pem.Block{
 			Type:  "RSA PRIVATE KEY",
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/pkg/apikey"
+	"github.com/micromdm/micromdm/pkg/jwtauth"
+	"github.com/micromdm/micromdm/pkg/scope"
+	"github.com/micromdm/micromdm/platform/audit"
+)
+
+// newAPIVerifier creates the verifier of API tokens signed with the key in
+// keyPath or by a key of the JWKS at jwksURL. It returns nil if neither is set.
+func newAPIVerifier(keyPath, jwksURL, issuer, audience string) (*jwtauth.Verifier, error) {
+	var keys jwtauth.KeySource
+	switch {
+	case keyPath != "" && jwksURL != "":
+		return nil, errors.New("cannot set both -api-jwt-key and -api-jwt-jwks-url")
+	case keyPath != "":
+		data, err := ioutil.ReadFile(keyPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "read API JWT key")
+		}
+		key, err := jwtauth.ParseKey(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse API JWT key %s", keyPath)
+		}
+		keys = key
+	case jwksURL != "":
+		if !strings.HasPrefix(jwksURL, "https://") {
+			return nil, errors.New("-api-jwt-jwks-url must begin with https://")
+		}
+		keys = jwtauth.NewJWKS(jwksURL, &http.Client{Timeout: 10 * time.Second})
+	default:
+		return nil, nil
+	}
+	var opts []jwtauth.Option
+	if issuer != "" {
+		opts = append(opts, jwtauth.WithIssuer(issuer))
+	}
+	if audience != "" {
+		opts = append(opts, jwtauth.WithAudience(audience))
+	}
+	return jwtauth.NewVerifier(keys, opts...), nil
+}
+
+// newAPIKeys returns the API keys of the keys file at path, and the static
+// API key, which is granted every scope.
+func newAPIKeys(apiKey, path string) (apikey.Keys, error) {
+	var keys apikey.Keys
+	if path != "" {
+		var err error
+		if keys, err = apikey.Load(path); err != nil {
+			return nil, err
+		}
+	}
+	if apiKey != "" {
+		keys = append(keys, apikey.Key{Name: "micromdm", Key: apiKey, Scopes: []string{scope.Admin}})
+		if err := keys.Validate(); err != nil {
+			return nil, errors.Wrap(err, "-api-key")
+		}
+	}
+	return keys, nil
+}
+
+// readOnlyPOST are the API routes which list or look up resources with a POST request.
+var readOnlyPOST = map[string]bool{
+	"/v1/devices":      true,
+	"/v1/profiles":     true,
+	"/v1/users":        true,
+	"/v1/blueprints":   true,
+	"/v1/apps":         true,
+	"/v1/dep/profiles": true,
+	"/v1/dep/devices":  true,
+}
+
+// apiMutating reports whether an API request changes the server, and is recorded in the audit log.
+func apiMutating(method, path string) bool {
+	return audit.MutatingMethod(method, path) && !(method == http.MethodPost && readOnlyPOST[path])
+}
+
+// apiAuthMiddleware authenticates API endpoints with an API key, a JWT, or both.
+func apiAuthMiddleware(keys apikey.Keys, verifier *jwtauth.Verifier) endpoint.Middleware {
+	var mw endpoint.Middleware
+	if len(keys) > 0 {
+		mw = apikey.EndpointMiddleware(keys)
+	}
+	if verifier != nil {
+		mw = jwtauth.EndpointMiddleware(verifier, mw)
+	}
+	return mw
+}
+
+// requireAPIAuth is apiAuthMiddleware for handlers which are not endpoints,
+// which also requires the principal to have scope s.
+func requireAPIAuth(h http.HandlerFunc, s string, keys apikey.Keys, verifier *jwtauth.Verifier) http.HandlerFunc {
+	h = scope.RequireHTTP(s, h)
+	var fallback http.HandlerFunc
+	if len(keys) > 0 {
+		fallback = apikey.RequireKey(keys, h)
+	}
+	if verifier == nil {
+		return fallback
+	}
+	return jwtauth.RequireToken(verifier, h, fallback)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"io"
@@ -9,18 +10,23 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/micromdm/micromdm/mdm"
 	"github.com/micromdm/micromdm/mdm/enroll"
 	"github.com/micromdm/micromdm/pkg/crypto"
+	"github.com/micromdm/micromdm/pkg/health"
 	httputil2 "github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 	"github.com/micromdm/micromdm/platform/apns"
 	"github.com/micromdm/micromdm/platform/appstore"
 	appsbuiltin "github.com/micromdm/micromdm/platform/appstore/builtin"
+	"github.com/micromdm/micromdm/platform/audit"
 	"github.com/micromdm/micromdm/platform/blueprint"
 	blueprintbuiltin "github.com/micromdm/micromdm/platform/blueprint/builtin"
 	"github.com/micromdm/micromdm/platform/challenge"
@@ -29,7 +35,9 @@ import (
 	depapi "github.com/micromdm/micromdm/platform/dep"
 	"github.com/micromdm/micromdm/platform/dep/sync"
 	"github.com/micromdm/micromdm/platform/device"
-	devicebuiltin "github.com/micromdm/micromdm/platform/device/builtin"
+	"github.com/micromdm/micromdm/platform/identity"
+	"github.com/micromdm/micromdm/platform/osupdate"
+	osupdatebuiltin "github.com/micromdm/micromdm/platform/osupdate/builtin"
 	"github.com/micromdm/micromdm/platform/profile"
 	block "github.com/micromdm/micromdm/platform/remove"
 	"github.com/micromdm/micromdm/platform/user"
@@ -37,16 +45,16 @@ import (
 	"github.com/micromdm/micromdm/server"
 
 	"github.com/boltdb/bolt"
-	"github.com/go-kit/kit/auth/basic"
 	"github.com/go-kit/kit/log"
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/handlers"
-	"github.com/groob/finalizer/logutil"
 	"github.com/micromdm/go4/env"
 	"github.com/micromdm/go4/httputil"
 	"github.com/micromdm/go4/version"
 	scep "github.com/micromdm/scep/v2/server"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/crypto/acme/autocert"
 )
 
@@ -106,6 +114,15 @@ func serve(args []string) error {
 		flConfigPath             = flagset.String("config-path", env.String("MICROMDM_CONFIG_PATH", "/var/db/micromdm"), "Path to configuration directory")
 		flServerURL              = flagset.String("server-url", env.String("MICROMDM_SERVER_URL", ""), "Public HTTPS url of your server")
 		flAPIKey                 = flagset.String("api-key", env.String("MICROMDM_API_KEY", ""), "API Token for mdmctl command")
+		flAPIKeysFile            = flagset.String("api-keys-file", env.String("MICROMDM_API_KEYS_FILE", ""), "Path to a JSON file of named API keys and the scopes they grant")
+		flAPIJWTKey              = flagset.String("api-jwt-key", env.String("MICROMDM_API_JWT_KEY", ""), "Path to a PEM public key, certificate or HMAC secret which verifies API bearer tokens")
+		flAPIJWTJWKSURL          = flagset.String("api-jwt-jwks-url", env.String("MICROMDM_API_JWT_JWKS_URL", ""), "HTTPS url of a JWKS which verifies API bearer tokens")
+		flAPIJWTIssuer           = flagset.String("api-jwt-issuer", env.String("MICROMDM_API_JWT_ISSUER", ""), "Required iss claim of API bearer tokens")
+		flAPIJWTAudience         = flagset.String("api-jwt-audience", env.String("MICROMDM_API_JWT_AUDIENCE", ""), "Required aud claim of API bearer tokens")
+		flAPNSHost               = flagset.String("apns-host", env.String("MICROMDM_APNS_HOST", ""), "APNs host to send pushes to: production, sandbox or an https URL. Defaults to the environment of the push certificate")
+		flAPNSMaxStreams         = flagset.Int("apns-max-concurrent-streams", env.Int("MICROMDM_APNS_MAX_CONCURRENT_STREAMS", 0), "Pushes in flight at once, multiplexed on the APNs connection. 0 opens more connections when the APNs limit is reached")
+		flAPNSIdleTimeout        = flagset.Int("apns-idle-timeout", env.Int("MICROMDM_APNS_IDLE_TIMEOUT", 3600), "Seconds an APNs connection is kept open without pushes")
+		flAPNSPingInterval       = flagset.Int("apns-ping-interval", env.Int("MICROMDM_APNS_PING_INTERVAL", 60), "Seconds an APNs connection may receive nothing before it is checked with a ping")
 		flTLS                    = flagset.Bool("tls", env.Bool("MICROMDM_TLS", true), "Use https")
 		flTLSCert                = flagset.String("tls-cert", env.String("MICROMDM_TLS_CERT", ""), "Path to TLS certificate")
 		flTLSKey                 = flagset.String("tls-key", env.String("MICROMDM_TLS_KEY", ""), "Path to TLS private key")
@@ -116,19 +133,36 @@ func serve(args []string) error {
 		flDepSim                 = flagset.String("depsim", env.String("MICROMDM_DEPSIM_URL", ""), "Use depsim URL")
 		flExamples               = flagset.Bool("examples", false, "Prints some example usage")
 		flCommandWebhookURL      = flagset.String("command-webhook-url", env.String("MICROMDM_WEBHOOK_URL", ""), "URL to send command responses")
+		flCommandWebhookSecret   = flagset.String("command-webhook-secret", env.String("MICROMDM_WEBHOOK_SECRET", ""), "Secret to sign webhook requests with, in the X-MicroMDM-Signature header")
+		flWebhookMaxRetries      = flagset.Int("command-webhook-max-retries", env.Int("MICROMDM_WEBHOOK_MAX_RETRIES", 3), "Number of times a failed webhook request is retried")
+		flShutdownTimeout        = flagset.Int("shutdown-timeout", env.Int("MICROMDM_SHUTDOWN_TIMEOUT", 30), "Seconds to wait for in-flight commands and pushes when shutting down")
+		flWebhookDeadLetter      = flagset.String("command-webhook-dead-letter", env.String("MICROMDM_WEBHOOK_DEAD_LETTER", ""), "Path of a file to write undelivered webhook events to")
 		flHomePage               = flagset.Bool("homepage", env.Bool("MICROMDM_HTTP_HOMEPAGE", true), "Hosts a simple built-in webpage at the / address")
 		flSCEPClientValidity     = flagset.Int("scep-client-validity", env.Int("MICROMDM_SCEP_CLIENT_VALIDITY", 365), "Sets the scep certificate validity in days")
 		flNoCmdHistory           = flagset.Bool("no-command-history", env.Bool("MICROMDM_NO_COMMAND_HISTORY", false), "disables saving of command history")
 		flUseDynChallenge        = flagset.Bool("use-dynamic-challenge", env.Bool("MICROMDM_USE_DYNAMIC_CHALLENGE", false), "require dynamic SCEP challenges")
 		flGenDynChalEnroll       = flagset.Bool("gen-dynamic-challenge", env.Bool("MICROMDM_GEN_DYNAMIC_CHALLENGE", false), "generate dynamic SCEP challenges in enrollment profile (built-in only)")
+		flDynChallengeTTL        = flagset.Int("dynamic-challenge-ttl", env.Int("MICROMDM_DYNAMIC_CHALLENGE_TTL", 0), "Minutes a dynamic SCEP challenge is valid for. 0 means challenges are valid until they are used")
+		flSCEPCAChain            = flagset.String("scep-ca-chain", env.String("MICROMDM_SCEP_CA_CHAIN", ""), "Path to a PEM file of intermediate certificates which GetCACert returns with the SCEP CA")
+		flEnrollSignCert         = flagset.String("enrollment-signing-cert", env.String("MICROMDM_ENROLLMENT_SIGNING_CERT", ""), "Path to a PEM certificate which signs the enrollment profile")
+		flEnrollSignKey          = flagset.String("enrollment-signing-key", env.String("MICROMDM_ENROLLMENT_SIGNING_KEY", ""), "Path to the PEM private key of -enrollment-signing-cert")
+		flEnrollSignPass         = flagset.String("enrollment-signing-key-password", env.String("MICROMDM_ENROLLMENT_SIGNING_KEY_PASSWORD", ""), "Password of an encrypted -enrollment-signing-key")
+		flEnrollSignChain        = flagset.String("enrollment-signing-chain", env.String("MICROMDM_ENROLLMENT_SIGNING_CHAIN", ""), "Path to a PEM file of intermediate certificates of -enrollment-signing-cert, which are embedded in the signed enrollment profile")
+		flEnrollVariables        = flagset.String("enrollment-profile-variables", env.String("MICROMDM_ENROLLMENT_PROFILE_VARIABLES", ""), "Path to a JSON file of variables substituted into the enrollment profile")
+		flIdentityRenewalDays    = flagset.Int("identity-renewal-days", env.Int("MICROMDM_IDENTITY_RENEWAL_DAYS", 0), "Days before a device identity certificate expires to queue its renewal. 0 disables renewal")
 		flValidateSCEPIssuer     = flagset.Bool("validate-scep-issuer", env.Bool("MICROMDM_VALIDATE_SCEP_ISSUER", false), "validate only the issuer of the SCEP certificate rather than the whole certificate")
 		flUDIDCertAuthWarnOnly   = flagset.Bool("udid-cert-auth-warn-only", env.Bool("MICROMDM_UDID_CERT_AUTH_WARN_ONLY", false), "warn only for udid cert mismatches")
 		flValidateSCEPExpiration = flagset.Bool("validate-scep-expiration", env.Bool("MICROMDM_VALIDATE_SCEP_EXPIRATION", false), "validate that the SCEP certificate is still valid")
 		flPrintArgs              = flagset.Bool("print-flags", false, "Print all flags and their values")
-		flQueue                  = flagset.String("queue", env.String("MICROMDM_QUEUE", "builtin"), "command queue type")
+		flQueue                  = flagset.String("queue", env.String("MICROMDM_QUEUE", "builtin"), "command queue type, builtin, inmem or pg")
+		flDeviceStore            = flagset.String("device-store", env.String("MICROMDM_DEVICE_STORE", "builtin"), "device store type, builtin, inmem or pg")
+		flDEPStore               = flagset.String("dep-store", env.String("MICROMDM_DEP_STORE", "builtin"), "DEP cursor and auto-assigner store type, builtin or pg")
+		flPostgresURL            = flagset.String("postgres", env.String("MICROMDM_POSTGRES_URL", ""), "PostgreSQL connection URL for the pg device, queue and DEP stores")
 		flDMURL                  = flagset.String("dm", env.String("DM", ""), "URL to send Declarative Management requests to")
 		flLogTime                = flagset.Bool("log-time", false, "Include timestamp in log messages")
 		flP7Skew                 = flagset.Int("device-signature-skew", env.Int("MICROMDM_DEVICE_SIGNATURE_SKEW", 0), "Sets the allowable clock skew (in seconds) when verifying device signatures")
+		flCheckinRateLimit       = flagset.Int("checkin-rate-limit", env.Int("MICROMDM_CHECKIN_RATE_LIMIT", 0), "Checkins per minute allowed for each device before responding with 429 Too Many Requests. 0 disables the limit")
+		flCheckinRateBurst       = flagset.Int("checkin-rate-burst", env.Int("MICROMDM_CHECKIN_RATE_BURST", 10), "Checkins a device may send at once before -checkin-rate-limit applies")
 	)
 	flagset.Usage = usageFor(flagset, "micromdm serve [flags]")
 	if err := flagset.Parse(args); err != nil {
@@ -155,6 +189,45 @@ func serve(args []string) error {
 	if !*flTLS && (*flTLSCert != "" || *flTLSKey != "") {
 		return errors.New("cannot set -tls=false and supply -tls-cert or -tls-key")
 	}
+	if *flIdentityRenewalDays > 0 && *flUseDynChallenge && !*flGenDynChalEnroll {
+		return errors.New("-identity-renewal-days requires -gen-dynamic-challenge when -use-dynamic-challenge is set")
+	}
+	apnsHost, err := apns.ParseHost(*flAPNSHost)
+	if err != nil {
+		return err
+	}
+	if (*flEnrollSignCert == "") != (*flEnrollSignKey == "") {
+		return errors.New("-enrollment-signing-cert and -enrollment-signing-key must be set together")
+	}
+	var enrollSigner *crypto.Identity
+	if *flEnrollSignCert != "" {
+		var password []byte
+		if *flEnrollSignPass != "" {
+			password = []byte(*flEnrollSignPass)
+		}
+		enrollSigner, err = crypto.LoadIdentity(*flEnrollSignCert, *flEnrollSignKey, password)
+		if err != nil {
+			return errors.Wrap(err, "loading enrollment profile signing identity")
+		}
+	}
+	var enrollSignerChain []*x509.Certificate
+	if *flEnrollSignChain != "" {
+		if enrollSigner == nil {
+			return errors.New("-enrollment-signing-chain requires -enrollment-signing-cert")
+		}
+		enrollSignerChain, err = crypto.ReadPEMCertificatesFile(*flEnrollSignChain)
+		if err != nil {
+			return errors.Wrap(err, "loading enrollment profile signing chain")
+		}
+	}
+	apiVerifier, err := newAPIVerifier(*flAPIJWTKey, *flAPIJWTJWKSURL, *flAPIJWTIssuer, *flAPIJWTAudience)
+	if err != nil {
+		return err
+	}
+	apiKeys, err := newAPIKeys(*flAPIKey, *flAPIKeysFile)
+	if err != nil {
+		return err
+	}
 
 	logger := log.NewLogfmtLogger(os.Stderr)
 	if *flLogTime {
@@ -173,18 +246,40 @@ func serve(args []string) error {
 		Depsim:                 *flDepSim,
 		TLSCertPath:            *flTLSCert,
 		CommandWebhookURL:      *flCommandWebhookURL,
+		CommandWebhookSecret:   *flCommandWebhookSecret,
 		NoCmdHistory:           *flNoCmdHistory,
 		UseDynSCEPChallenge:    *flUseDynChallenge,
 		GenDynSCEPChallenge:    *flGenDynChalEnroll,
+		SCEPChallengeTTL:       time.Duration(*flDynChallengeTTL) * time.Minute,
+		SCEPCAChainPath:        *flSCEPCAChain,
+		APNSHost:               apnsHost,
 		ValidateSCEPIssuer:     *flValidateSCEPIssuer,
 		UDIDCertAuthWarnOnly:   *flUDIDCertAuthWarnOnly,
 		ValidateSCEPExpiration: *flValidateSCEPExpiration,
 
 		WebhooksHTTPClient: &http.Client{Timeout: time.Second * 30},
+		WebhookMaxRetries:  *flWebhookMaxRetries,
+		WebhookDeadLetter:  *flWebhookDeadLetter,
+
+		EnrollProfileSigner:        enrollSigner,
+		EnrollProfileSignerChain:   enrollSignerChain,
+		EnrollProfileVariablesPath: *flEnrollVariables,
+
+		APNSTransport: apns.TransportOptions{
+			MaxConcurrentStreams: *flAPNSMaxStreams,
+			IdleTimeout:          time.Duration(*flAPNSIdleTimeout) * time.Second,
+			PingInterval:         time.Duration(*flAPNSPingInterval) * time.Second,
+		},
 
 		SCEPClientValidity: *flSCEPClientValidity,
 		Queue:              *flQueue,
+		DeviceStore:        *flDeviceStore,
+		DEPStore:           *flDEPStore,
+		PostgresURL:        *flPostgresURL,
 		DMURL:              *flDMURL,
+		Metrics:            prometheus.DefaultRegisterer,
+		CheckinRateLimit:   *flCheckinRateLimit,
+		CheckinRateBurst:   *flCheckinRateBurst,
 	}
 	if !sm.UseDynSCEPChallenge {
 		// TODO: we have a static SCEP challenge password here to prevent
@@ -211,12 +306,7 @@ func serve(args []string) error {
 		removeService = block.LoggingMiddleware(logger)(svc)
 	}
 
-	devDB, err := devicebuiltin.NewDB(sm.DB)
-	if err != nil {
-		stdlog.Fatal(err)
-	}
-
-	devWorker := device.NewWorker(devDB, sm.PubClient, logger)
+	devWorker := device.NewWorker(sm.DeviceDB, sm.PubClient, logger)
 	go devWorker.Run(context.Background())
 
 	userDB, err := userbuiltin.NewDB(sm.DB)
@@ -241,6 +331,24 @@ func serve(args []string) error {
 	)
 	go blueprintWorker.Run(context.Background())
 
+	osUpdateDB, err := osupdatebuiltin.NewDB(sm.DB)
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+	osUpdateWorker := osupdate.NewWorker(osUpdateDB, sm.CommandService, sm.PubClient, logger)
+	go osUpdateWorker.Run(context.Background())
+
+	if *flIdentityRenewalDays > 0 {
+		renewer := identity.NewRenewer(
+			sm.IdentityDB,
+			sm.CommandService,
+			sm.EnrollService,
+			time.Duration(*flIdentityRenewalDays)*24*time.Hour,
+			log.With(logger, "component", "identity"),
+		)
+		go renewer.Run(context.Background())
+	}
+
 	ctx := context.Background()
 	httpLogger := log.With(logger, "transport", "http")
 
@@ -254,11 +362,13 @@ func serve(args []string) error {
 
 	pkcs7Verifier := &crypto.PKCS7Verifier{MaxSkew: time.Duration(*flP7Skew) * time.Second}
 
-	enrollHandlers := enroll.MakeHTTPHandlers(ctx, enroll.MakeServerEndpoints(sm.EnrollService, sm.SCEPDepot), pkcs7Verifier, httptransport.ServerErrorLogger(httpLogger))
+	enrollHandlers := enroll.MakeHTTPHandlers(ctx, enroll.MakeServerEndpoints(sm.EnrollService, sm.SCEPDepot), pkcs7Verifier, httptransport.ServerErrorHandler(httputil2.ErrorHandler(httpLogger)))
 
 	r, options := httputil2.NewRouter(logger)
 
 	r.Handle("/version", version.Handler())
+	r.Handle("/healthz", health.Handler(sm.HealthChecks()...)).Methods("GET")
+	r.Handle("/readyz", health.Handler(sm.ReadinessChecks()...)).Methods("GET")
 	r.Handle("/mdm/enroll", enrollHandlers.EnrollHandler).Methods("GET", "POST")
 	r.Handle("/ota/enroll", enrollHandlers.OTAEnrollHandler)
 	r.Handle("/ota/phase23", enrollHandlers.OTAPhase2Phase3Handler).Methods("POST")
@@ -272,61 +382,83 @@ func serve(args []string) error {
 	mdmEndpoints := mdm.MakeServerEndpoints(sm.MDMService)
 	mdm.RegisterHTTPHandlers(r, mdmEndpoints, pkcs7Verifier, logger)
 
-	// API commands. Only handled if the user provides an api key.
-	if *flAPIKey != "" {
-		basicAuthEndpointMiddleware := basic.AuthMiddleware("micromdm", *flAPIKey, "micromdm")
+	// API commands. Only handled if the user provides an api key or a JWT key.
+	if len(apiKeys) > 0 || apiVerifier != nil {
+		apiAuthEndpointMiddleware := apiAuthMiddleware(apiKeys, apiVerifier)
+		auditEndpointMiddleware := audit.EndpointMiddleware(sm.AuditService, logger, apiMutating)
 
 		configsvc := config.New(sm.ConfigDB)
-		configEndpoints := config.MakeServerEndpoints(configsvc, basicAuthEndpointMiddleware)
+		configEndpoints := config.MakeServerEndpoints(configsvc, apiAuthEndpointMiddleware, auditEndpointMiddleware)
 		config.RegisterHTTPHandlers(r, configEndpoints, options...)
 
-		apnsEndpoints := apns.MakeServerEndpoints(sm.APNSPushService, basicAuthEndpointMiddleware)
+		apnsEndpoints := apns.MakeServerEndpoints(sm.APNSPushService, apiAuthEndpointMiddleware, auditEndpointMiddleware)
 		apns.RegisterHTTPHandlers(r, apnsEndpoints, options...)
 
-		devicesvc := device.New(devDB)
-		deviceEndpoints := device.MakeServerEndpoints(devicesvc, basicAuthEndpointMiddleware)
+		devicesvc := device.New(sm.DeviceDB)
+		deviceEndpoints := device.MakeServerEndpoints(devicesvc, apiAuthEndpointMiddleware, auditEndpointMiddleware)
 		device.RegisterHTTPHandlers(r, deviceEndpoints, options...)
 
 		profilesvc := profile.New(sm.ProfileDB)
-		profileEndpoints := profile.MakeServerEndpoints(profilesvc, basicAuthEndpointMiddleware)
+		profileEndpoints := profile.MakeServerEndpoints(profilesvc, apiAuthEndpointMiddleware, auditEndpointMiddleware)
 		profile.RegisterHTTPHandlers(r, profileEndpoints, options...)
 
 		blueprintsvc := blueprint.New(bpDB)
-		blueprintEndpoints := blueprint.MakeServerEndpoints(blueprintsvc, basicAuthEndpointMiddleware)
+		blueprintEndpoints := blueprint.MakeServerEndpoints(blueprintsvc, apiAuthEndpointMiddleware, auditEndpointMiddleware)
 		blueprint.RegisterHTTPHandlers(r, blueprintEndpoints, options...)
 
-		blockEndpoints := block.MakeServerEndpoints(removeService, basicAuthEndpointMiddleware)
+		blockEndpoints := block.MakeServerEndpoints(removeService, apiAuthEndpointMiddleware, auditEndpointMiddleware)
 		block.RegisterHTTPHandlers(r, blockEndpoints, options...)
 
 		usersvc := user.New(userDB)
-		userEndpoints := user.MakeServerEndpoints(usersvc, basicAuthEndpointMiddleware)
+		userEndpoints := user.MakeServerEndpoints(usersvc, apiAuthEndpointMiddleware, auditEndpointMiddleware)
 		user.RegisterHTTPHandlers(r, userEndpoints, options...)
 
-		appsvc := appstore.New(appDB)
-		appEndpoints := appstore.MakeServerEndpoints(appsvc, basicAuthEndpointMiddleware)
+		appsvc := appstore.New(appDB, appstore.WithRepoURL(sm.ServerPublicURL+"/repo/"))
+		appEndpoints := appstore.MakeServerEndpoints(appsvc, apiAuthEndpointMiddleware, auditEndpointMiddleware)
 		appstore.RegisterHTTPHandlers(r, appEndpoints, options...)
 
-		commandEndpoints := command.MakeServerEndpoints(sm.CommandService, basicAuthEndpointMiddleware)
+		commandEndpoints := command.MakeServerEndpoints(sm.CommandService, apiAuthEndpointMiddleware, auditEndpointMiddleware)
 		command.RegisterHTTPHandlers(r, commandEndpoints, options...)
 
+		osUpdateEndpoints := osupdate.MakeServerEndpoints(osupdate.New(osUpdateDB, sm.CommandService), apiAuthEndpointMiddleware, auditEndpointMiddleware)
+		osupdate.RegisterHTTPHandlers(r, osUpdateEndpoints, options...)
+
 		var dc depapi.DEPClient
 		if sm.DEPClient != nil {
 			dc = sm.DEPClient
 		}
-		depsvc := depapi.New(dc, sm.PubClient)
+		depOpts := []depapi.Option{depapi.WithDeviceStore(sm.DeviceDB)}
+		if sm.Depsim == "" {
+			tokens, err := sm.ConfigDB.DEPTokens()
+			if err != nil {
+				stdlog.Fatal(err)
+			}
+			for _, token := range tokens {
+				client, err := token.Client()
+				if err != nil {
+					stdlog.Fatal(err)
+				}
+				depOpts = append(depOpts, depapi.WithTokenClient(token.ConsumerKey, client))
+			}
+		}
+		depsvc := depapi.New(dc, sm.PubClient, depOpts...)
 		depsvc.Run()
-		depEndpoints := depapi.MakeServerEndpoints(depsvc, basicAuthEndpointMiddleware)
+		depEndpoints := depapi.MakeServerEndpoints(depsvc, apiAuthEndpointMiddleware, auditEndpointMiddleware)
 		depapi.RegisterHTTPHandlers(r, depEndpoints, options...)
 
-		depsyncEndpoints := sync.MakeServerEndpoints(sync.NewService(syncer, sm.SyncDB), basicAuthEndpointMiddleware)
+		depsyncEndpoints := sync.MakeServerEndpoints(sync.NewService(syncer, sm.SyncDB), apiAuthEndpointMiddleware, auditEndpointMiddleware)
 		sync.RegisterHTTPHandlers(r, depsyncEndpoints, options...)
 
 		if sm.SCEPChallengeDepot != nil {
-			challengeEndpoints := challenge.MakeServerEndpoints(challenge.NewService(sm.SCEPChallengeDepot), basicAuthEndpointMiddleware)
+			challengeEndpoints := challenge.MakeServerEndpoints(challenge.NewService(sm.SCEPChallengeDepot), apiAuthEndpointMiddleware, auditEndpointMiddleware)
 			challenge.RegisterHTTPHandlers(r, challengeEndpoints, options...)
 		}
 
-		r.HandleFunc("/boltbackup", httputil2.RequireBasicAuth(boltBackup(sm.DB), "micromdm", *flAPIKey, "micromdm"))
+		auditEndpoints := audit.MakeServerEndpoints(sm.AuditService, apiAuthEndpointMiddleware)
+		audit.RegisterHTTPHandlers(r, auditEndpoints, options...)
+
+		r.HandleFunc("/boltbackup", requireAPIAuth(boltBackup(sm.DB), scope.ServerAdmin, apiKeys, apiVerifier))
+		r.HandleFunc("/metrics", requireAPIAuth(promhttp.Handler().ServeHTTP, scope.ServerRead, apiKeys, apiVerifier)).Methods("GET")
 	} else {
 		mainLogger.Log("msg", "no api key specified")
 	}
@@ -347,7 +479,8 @@ func serve(args []string) error {
 	if *flHTTPProxyHeaders {
 		handler = handlers.ProxyHeaders(handler)
 	}
-	handler = logutil.NewHTTPLogger(httpLogger).Middleware(handler)
+	handler = httputil2.RequestLogger(httpLogger)(handler)
+	handler = httputil2.RequestIDMiddleware(handler)
 
 	srvURL, err := url.Parse(sm.ServerPublicURL)
 	if err != nil {
@@ -365,6 +498,16 @@ func serve(args []string) error {
 		*flTLS,
 	)
 	err = httputil.ListenAndServe(serveOpts...)
+
+	// ListenAndServe returns once the HTTP server was shut down. A second signal
+	// stops waiting for the in-flight commands and pushes.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(*flShutdownTimeout)*time.Second)
+	defer cancel()
+	if err := sm.Shutdown(ctx); err != nil {
+		logger.Log("msg", "shutting down micromdm", "err", err)
+	}
 	return errors.Wrap(err, "calling ListenAndServe")
 }
 
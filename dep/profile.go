@@ -31,6 +31,13 @@ type Profile struct {
 	ConfigurationWebURL   string   `json:"configuration_web_url,omitempty"`
 }
 
+// Results for each device in a ProfileResponse, or in the response for removing a profile.
+const (
+	ProfileResultSuccess       = "SUCCESS"
+	ProfileResultNotAccessible = "NOT_ACCESSIBLE"
+	ProfileResultFailed        = "FAILED"
+)
+
 type ProfileResponse struct {
 	ProfileUUID string            `json:"profile_uuid"`
 	Devices     map[string]string `json:"devices"`
@@ -8,6 +8,8 @@ import (
 	"github.com/go-kit/kit/endpoint"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/pkg/ctxlog"
 )
 
 func (svc *MDMService) Acknowledge(ctx context.Context, req AcknowledgeEvent) (payload []byte, err error) {
@@ -43,6 +45,7 @@ func decodeAcknowledgeRequest(ctx context.Context, r *http.Request) (interface{}
 	if err != nil {
 		return nil, errors.Wrap(err, "read MDM request")
 	}
+	ctxlog.With(ctx, "udid", res.UDID)
 
 	values := r.URL.Query()
 	params := make(map[string]string, len(values))
@@ -4,7 +4,9 @@ package appmanifest
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
 
 	"github.com/pkg/errors"
@@ -63,8 +65,25 @@ func WithMD5Size(md5Size int64) Option {
 	}
 }
 
+// WithMetadata adds the bundle identifier, version and title of the app to the
+// AppManifest. The metadata is required to install an app with the
+// InstallApplication command on iOS and tvOS.
+func WithMetadata(bundleIdentifier, bundleVersion, title string) Option {
+	return func(c *config) {
+		c.metadata = &Metadata{
+			BundleInfo: BundleInfo{
+				BundleIdentifier: bundleIdentifier,
+				BundleVersion:    bundleVersion,
+			},
+			Kind:  "software",
+			Title: title,
+		}
+	}
+}
+
 type config struct {
-	md5Size int64
+	md5Size  int64
+	metadata *Metadata
 }
 
 // Create an AppManifest and write it to an io.Writer.
@@ -82,25 +101,32 @@ func Create(file File, url string, opts ...Option) (*Manifest, error) {
 		c.md5Size = fSize
 	}
 
-	// create a list of md5s
-	md5s, err := calculateMD5s(file, c.md5Size)
+	// create a list of md5s and sha256s
+	md5s, sha256s, err := calculateHashes(file, c.md5Size)
 	if err != nil {
-		return nil, errors.Wrap(err, "calculate appmanifest md5s")
+		return nil, errors.Wrap(err, "calculate appmanifest hashes")
 	}
 
 	// create an asset
 	ast := Asset{
-		Kind:    "software-package",
-		MD5Size: c.md5Size,
-		MD5s:    md5s,
-		URL:     url,
+		Kind:       "software-package",
+		MD5Size:    c.md5Size,
+		MD5s:       md5s,
+		SHA256Size: c.md5Size,
+		SHA256s:    sha256s,
+		URL:        url,
+	}
+
+	if c.metadata != nil {
+		c.metadata.SizeInBytes = fSize
 	}
 
 	// make a manifest
 	m := Manifest{
 		ManifestItems: []Item{
 			{
-				Assets: []Asset{ast},
+				Assets:   []Asset{ast},
+				Metadata: c.metadata,
 			},
 		},
 	}
@@ -108,22 +134,54 @@ func Create(file File, url string, opts ...Option) (*Manifest, error) {
 	return &m, nil
 }
 
-// reads a file and returns a slice of hashes, one for each
+// Validate returns an error if the manifest is missing a field which is
+// required to install the app.
+func (m *Manifest) Validate() error {
+	if len(m.ManifestItems) == 0 {
+		return errors.New("manifest has no items")
+	}
+	for i, item := range m.ManifestItems {
+		if len(item.Assets) == 0 {
+			return errors.Errorf("manifest item %d has no assets", i)
+		}
+		for _, a := range item.Assets {
+			if a.URL == "" {
+				return errors.Errorf("manifest item %d has an asset without a url", i)
+			}
+			if len(a.MD5s) == 0 && len(a.SHA256s) == 0 {
+				return errors.Errorf("manifest asset %s has no hashes", a.URL)
+			}
+			if (len(a.MD5s) > 0 && a.MD5Size <= 0) || (len(a.SHA256s) > 0 && a.SHA256Size <= 0) {
+				return errors.Errorf("manifest asset %s has hashes without a size", a.URL)
+			}
+		}
+		if md := item.Metadata; md != nil && (md.BundleIdentifier == "" || md.BundleVersion == "") {
+			return errors.Errorf("manifest item %d metadata requires a bundle-identifier and bundle-version", i)
+		}
+	}
+	return nil
+}
+
+// reads a file and returns a slice of md5 and sha256 hashes, one for each
 // 10mb chunk
-func calculateMD5s(f io.Reader, s int64) ([]string, error) {
-	h := md5.New()
-	var md5s []string
+func calculateHashes(f io.Reader, s int64) (md5s, sha256s []string, err error) {
+	md5h, sha256h := md5.New(), sha256.New()
+	w := io.MultiWriter(md5h, sha256h)
+	sum := func(h hash.Hash) string {
+		defer h.Reset()
+		return fmt.Sprintf("%x", h.Sum(nil))
+	}
 	for {
-		n, err := io.CopyN(h, f, s)
+		n, err := io.CopyN(w, f, s)
 		if n > 0 {
-			md5s = append(md5s, fmt.Sprintf("%x", h.Sum(nil)))
-			h.Reset()
+			md5s = append(md5s, sum(md5h))
+			sha256s = append(sha256s, sum(sha256h))
 		}
 		if err != nil {
 			if err == io.EOF {
 				err = nil
 			}
-			return md5s, err
+			return md5s, sha256s, err
 		}
 	}
 }
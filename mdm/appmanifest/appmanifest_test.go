@@ -14,7 +14,7 @@ func TestCalucalteMD5s(t *testing.T) {
 	}
 	buf := make([]byte, DefaultMD5Size*3+1)
 	r := bytes.NewReader(buf)
-	md5s, err := calculateMD5s(r, DefaultMD5Size)
+	md5s, _, err := calculateHashes(r, DefaultMD5Size)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -39,7 +39,7 @@ func benchmarkSize(b *testing.B, size int) {
 	r := bytes.NewReader(buf)
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		calculateMD5s(r, DefaultMD5Size)
+		calculateHashes(r, DefaultMD5Size)
 	}
 }
 
@@ -54,3 +54,66 @@ func Benchmark100MB(b *testing.B) {
 func Benchmark1000MB(b *testing.B) {
 	benchmarkSize(b, DefaultMD5Size*100)
 }
+
+type testFile struct {
+	*bytes.Reader
+}
+
+func (f testFile) Size() int64 { return f.Reader.Size() }
+
+func TestCreateWithMetadata(t *testing.T) {
+	f := testFile{bytes.NewReader(make([]byte, 250))}
+	m, err := Create(f, "https://mdm.example.com/repo/app.pkg",
+		WithMD5Size(100),
+		WithMetadata("com.example.app", "1.0", "App"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	item := m.ManifestItems[0]
+	asset := item.Assets[0]
+	if len(asset.MD5s) != 3 || len(asset.SHA256s) != 3 {
+		t.Errorf("have %d md5s and %d sha256s, want 3 of each", len(asset.MD5s), len(asset.SHA256s))
+	}
+	if asset.MD5Size != 100 || asset.SHA256Size != 100 {
+		t.Errorf("have md5-size %d and sha256-size %d, want 100", asset.MD5Size, asset.SHA256Size)
+	}
+	md := item.Metadata
+	if md == nil {
+		t.Fatal("missing metadata")
+	}
+	if md.BundleIdentifier != "com.example.app" || md.BundleVersion != "1.0" || md.Title != "App" {
+		t.Errorf("unexpected metadata %+v", md)
+	}
+	if md.SizeInBytes != 250 {
+		t.Errorf("have sizeInBytes %d, want 250", md.SizeInBytes)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	asset := Asset{Kind: "software-package", MD5Size: 1, MD5s: []string{"md5"}, URL: "https://example.com/app.pkg"}
+	tests := []struct {
+		name    string
+		item    Item
+		wantErr bool
+	}{
+		{"valid", Item{Assets: []Asset{asset}}, false},
+		{"no assets", Item{}, true},
+		{"no url", Item{Assets: []Asset{{MD5Size: 1, MD5s: []string{"md5"}}}}, true},
+		{"no hashes", Item{Assets: []Asset{{URL: asset.URL}}}, true},
+		{"no hash size", Item{Assets: []Asset{{URL: asset.URL, SHA256s: []string{"sha"}}}}, true},
+		{"no bundle version", Item{Assets: []Asset{asset}, Metadata: &Metadata{BundleInfo: BundleInfo{BundleIdentifier: "com.example.app"}}}, true},
+	}
+	for _, tt := range tests {
+		m := Manifest{ManifestItems: []Item{tt.item}}
+		if err := m.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: have error %v, want error %t", tt.name, err, tt.wantErr)
+		}
+	}
+	if err := (&Manifest{}).Validate(); err == nil {
+		t.Error("expected error for manifest without items")
+	}
+}
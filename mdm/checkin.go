@@ -11,6 +11,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/groob/plist"
 	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/pkg/ctxlog"
 )
 
 // BootstrapToken holds MDM Bootstrap Token data
@@ -46,6 +48,11 @@ func (svc *MDMService) Checkin(ctx context.Context, event CheckinEvent) ([]byte,
 		if err := svc.queue.Clear(ctx, event); err != nil {
 			return nil, errors.Wrap(err, "clearing queue on enrollment attempt")
 		}
+	case CheckoutTopic:
+		// an unenrolled device never fetches its pending commands.
+		if err := svc.queue.Clear(ctx, event); err != nil {
+			return nil, errors.Wrap(err, "clearing queue on checkout")
+		}
 	case GetBootstrapTokenTopic:
 		udid := event.Command.UDID
 
@@ -139,6 +146,7 @@ func decodeCheckinRequest(ctx context.Context, r *http.Request) (interface{}, er
 	if err != nil {
 		return nil, errors.Wrap(err, "read MDM request")
 	}
+	ctxlog.With(ctx, "udid", cmd.UDID)
 
 	values := r.URL.Query()
 	params := make(map[string]string, len(values))
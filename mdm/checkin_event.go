@@ -132,7 +132,7 @@ func MarshalCheckinEvent(e *CheckinEvent) ([]byte, error) {
 			BootstrapToken:           e.Command.BootstrapToken,
 			SetAwaitingConfiguration: e.Command.SetAwaitingConfiguration,
 		}
-	case "DeclarativeManagament":
+	case "DeclarativeManagement":
 		command.DeclarativeManagement = &checkinproto.DeclarativeManagement{
 			Data:     e.Command.Data,
 			Endpoint: e.Command.Endpoint,
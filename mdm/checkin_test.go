@@ -4,7 +4,12 @@ import (
 	"bytes"
 	"context"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/micromdm/micromdm/pkg/ctxlog"
 )
 
 func Test_decodeCheckinRequest(t *testing.T) {
@@ -20,6 +25,19 @@ func Test_decodeCheckinRequest(t *testing.T) {
 	}
 }
 
+func Test_decodeCheckinRequestLogsUDID(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := ctxlog.NewContext(context.Background())
+	req := httptest.NewRequest("PUT", "/mdm/checkin", bytes.NewReader([]byte(sampleCheckinRequest)))
+	if _, err := decodeCheckinRequest(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	ctxlog.Logger(ctx, log.NewLogfmtLogger(&buf)).Log("msg", "checkin")
+	if have, want := strings.TrimSpace(buf.String()), "udid=BC5E2DA4-7FB6-5E70-9928-4981680DAFBF msg=checkin"; have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+}
+
 const sampleCheckinRequest = `<?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
 <plist version="1.0">
@@ -40,3 +58,49 @@ const sampleCheckinRequest = `<?xml version="1.0" encoding="UTF-8"?>
 	<string>BC5E2DA4-7FB6-5E70-9928-4981680DAFBF</string>
 </dict>
 </plist>`
+
+func TestMarshalDeclarativeManagementCheckin(t *testing.T) {
+	event := CheckinEvent{ID: "1", Command: CheckinCommand{MessageType: "DeclarativeManagement", UDID: "UDID-1"}}
+	event.Command.Endpoint = "tokens"
+	event.Command.Data = []byte(`{}`)
+	msg, err := MarshalCheckinEvent(&event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded CheckinEvent
+	if err := UnmarshalCheckinEvent(msg, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := decoded.Command.Endpoint, "tokens"; have != want {
+		t.Errorf("have Endpoint %q, want %q", have, want)
+	}
+	if have, want := string(decoded.Command.Data), "{}"; have != want {
+		t.Errorf("have Data %q, want %q", have, want)
+	}
+}
+
+type clearQueue struct {
+	Queue
+	cleared []string
+}
+
+func (q *clearQueue) Clear(_ context.Context, event CheckinEvent) error {
+	q.cleared = append(q.cleared, event.Command.UDID)
+	return nil
+}
+
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(context.Context, string, []byte) error { return nil }
+
+func TestCheckoutClearsQueue(t *testing.T) {
+	queue := &clearQueue{}
+	svc := NewService(nopPublisher{}, queue, nil, nil)
+	event := CheckinEvent{Command: CheckinCommand{MessageType: "CheckOut", UDID: "UDID"}}
+	if _, err := svc.Checkin(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.cleared) != 1 || queue.cleared[0] != "UDID" {
+		t.Errorf("have cleared queues %v, want the queue of UDID", queue.cleared)
+	}
+}
@@ -75,7 +75,14 @@ func MakeGetEnrollEndpoint(s Service) endpoint.Endpoint {
 			return mobileconfigResponse{mc, err}, nil
 		case depEnrollmentRequest:
 			fmt.Printf("got DEP enrollment request from %s\n", req.Serial)
-			mc, err := s.Enroll(ctx)
+			mc, err := s.EnrollDevice(ctx, Device{
+				UDID:         req.UDID,
+				SerialNumber: req.Serial,
+				Product:      req.Product,
+				OSVersion:    req.Version,
+				IMEI:         req.IMEI,
+				MEID:         req.MEID,
+			})
 			return mobileconfigResponse{mc, err}, nil
 		default:
 			return nil, errors.New("unknown enrollment type")
@@ -133,7 +140,15 @@ func MakeOTAPhase2Phase3Endpoint(s Service, scepDepot depot.Depot) endpoint.Endp
 			// TODO: the SCEP CA checking ought to be more robust
 			// see: https://github.com/micromdm/scep/issues/32
 
-			mc, err := s.Enroll(ctx)
+			ota := req.otaEnrollmentRequest
+			mc, err := s.EnrollDevice(ctx, Device{
+				UDID:         ota.UDID,
+				SerialNumber: ota.Serial,
+				Product:      ota.Product,
+				OSVersion:    ota.Version,
+				IMEI:         ota.IMEI,
+				MEID:         ota.MEID,
+			})
 			// profile, err := s.OTAPhase3(ctx)
 			return mobileconfigResponse{mc, err}, nil
 		}
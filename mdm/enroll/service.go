@@ -8,6 +8,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/micromdm/micromdm/pkg/crypto"
 	"github.com/micromdm/micromdm/platform/config"
 	"github.com/micromdm/micromdm/platform/profile"
 	"github.com/micromdm/micromdm/platform/pubsub"
@@ -37,12 +38,15 @@ const (
 
 type Service interface {
 	Enroll(ctx context.Context) (profile.Mobileconfig, error)
+	// EnrollDevice returns the enrollment profile with the template
+	// variables substituted for device.
+	EnrollDevice(ctx context.Context, device Device) (profile.Mobileconfig, error)
 	OTAEnroll(ctx context.Context) (profile.Mobileconfig, error)
 	OTAPhase2(ctx context.Context) (profile.Mobileconfig, error)
 	OTAPhase3(ctx context.Context) (profile.Mobileconfig, error)
 }
 
-func NewService(topic TopicProvider, sub pubsub.Subscriber, scepURL, scepChallenge, url, tlsCertPath, scepSubject string, profileDB profile.Store, challengeStore challenge.Store) (Service, error) {
+func NewService(topic TopicProvider, sub pubsub.Subscriber, scepURL, scepChallenge, url, tlsCertPath, scepSubject string, profileDB profile.Store, challengeStore challenge.Store, opts ...Option) (Service, error) {
 	var tlsCert []byte
 	var err error
 
@@ -83,6 +87,9 @@ func NewService(topic TopicProvider, sub pubsub.Subscriber, scepURL, scepChallen
 		Topic:              pushTopic,
 		topicProvier:       topic,
 	}
+	for _, opt := range opts {
+		opt(svc)
+	}
 
 	if err := updateTopic(svc, sub); err != nil {
 		return nil, errors.Wrap(err, "enroll: start topic update goroutine")
@@ -128,6 +135,9 @@ type service struct {
 	ProfileDB          profile.Store
 
 	topicProvier TopicProvider
+	signer       *crypto.Identity
+	signerChain  []*x509.Certificate
+	variables    VariableSource
 
 	mu    sync.RWMutex
 	Topic string // APNS Topic for MDM notifications
@@ -176,7 +186,15 @@ func (svc *service) findOrMakeMobileconfig(ctx context.Context, id string, f int
 }
 
 func (svc *service) Enroll(ctx context.Context) (profile.Mobileconfig, error) {
-	return svc.findOrMakeMobileconfig(ctx, EnrollmentProfileId, svc.MakeEnrollmentProfile)
+	return svc.EnrollDevice(ctx, Device{})
+}
+
+func (svc *service) EnrollDevice(ctx context.Context, device Device) (profile.Mobileconfig, error) {
+	mc, err := svc.findOrMakeMobileconfig(ctx, EnrollmentProfileId, svc.MakeEnrollmentProfile)
+	if err != nil {
+		return nil, err
+	}
+	return svc.renderProfile(ctx, mc, device)
 }
 
 func (svc *service) scepChallenge() (challenge string, err error) {
@@ -0,0 +1,197 @@
+package enroll
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/groob/plist"
+	"github.com/pkg/errors"
+	"go.mozilla.org/pkcs7"
+
+	"github.com/micromdm/micromdm/pkg/crypto"
+	"github.com/micromdm/micromdm/pkg/crypto/profileutil"
+	"github.com/micromdm/micromdm/platform/profile"
+)
+
+// Device describes the device requesting an enrollment profile. Fields the
+// device did not send, such as all of them for a manual enrollment, are empty.
+type Device struct {
+	UDID         string
+	SerialNumber string
+	Product      string
+	OSVersion    string
+	IMEI         string
+	MEID         string
+}
+
+// variables are the template variables of the device d.
+func (d Device) variables() map[string]string {
+	return map[string]string{
+		"UDID":         d.UDID,
+		"SerialNumber": d.SerialNumber,
+		"Product":      d.Product,
+		"OSVersion":    d.OSVersion,
+		"IMEI":         d.IMEI,
+		"MEID":         d.MEID,
+	}
+}
+
+// VariableSource provides the values of the enrollment profile template
+// variables which are not sent by the device, such as an enrollment token.
+type VariableSource interface {
+	TemplateVariables(ctx context.Context, device Device) (map[string]string, error)
+}
+
+// FileVariables are template variables read from a JSON file. Variables
+// apply to every device, and Devices, keyed by serial number or UDID, add to
+// or override them for a single device.
+type FileVariables struct {
+	Variables map[string]string            `json:"variables"`
+	Devices   map[string]map[string]string `json:"devices"`
+}
+
+// ReadVariablesFile reads the template variables in the JSON file at path.
+func ReadVariablesFile(path string) (*FileVariables, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read enrollment profile variables")
+	}
+	var v FileVariables
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, errors.Wrapf(err, "parse enrollment profile variables %s", path)
+	}
+	return &v, nil
+}
+
+func (v *FileVariables) TemplateVariables(ctx context.Context, device Device) (map[string]string, error) {
+	vars := make(map[string]string, len(v.Variables))
+	for k, val := range v.Variables {
+		vars[k] = val
+	}
+	for _, key := range []string{device.SerialNumber, device.UDID} {
+		if key == "" {
+			continue
+		}
+		for k, val := range v.Devices[key] {
+			vars[k] = val
+		}
+	}
+	return vars, nil
+}
+
+// Option configures the enrollment service.
+type Option func(*service)
+
+// WithProfileSigner signs the enrollment profiles served to devices with
+// signer, so that they are shown as verified. The intermediates of the signer
+// certificate are embedded in the signed profiles.
+func WithProfileSigner(signer *crypto.Identity, intermediates ...*x509.Certificate) Option {
+	return func(svc *service) {
+		svc.signer = signer
+		svc.signerChain = intermediates
+	}
+}
+
+// WithVariableSource sets the source of the template variables of the
+// enrollment profile which are not sent by the device.
+func WithVariableSource(source VariableSource) Option {
+	return func(svc *service) {
+		svc.variables = source
+	}
+}
+
+// templateVariable matches a ${Name} variable in an enrollment profile.
+var templateVariable = regexp.MustCompile(`\$\{([A-Za-z][A-Za-z0-9_]*)\}`)
+
+// renderProfile substitutes the template variables in mc with the values for
+// device, and signs the result if the service has a signer. A profile which
+// was signed before it was stored is unwrapped for the substitution, and must
+// be signed again, so it fails without a signer if it contains variables
+// which have a value.
+func (svc *service) renderProfile(ctx context.Context, mc profile.Mobileconfig, device Device) (profile.Mobileconfig, error) {
+	raw, signed, err := unwrapMobileconfig(mc)
+	if err != nil {
+		return nil, err
+	}
+	var rendered []byte
+	if templateVariable.Match(raw) {
+		vars := device.variables()
+		if svc.variables != nil {
+			extra, err := svc.variables.TemplateVariables(ctx, device)
+			if err != nil {
+				return nil, errors.Wrap(err, "get enrollment profile variables")
+			}
+			for k, v := range extra {
+				if _, ok := vars[k]; !ok {
+					vars[k] = v
+				}
+			}
+		}
+		if rendered, err = substituteVariables(raw, vars); err != nil {
+			return nil, err
+		}
+	}
+	if rendered == nil {
+		if signed || svc.signer == nil {
+			return mc, nil
+		}
+		return profileutil.SignProfile(raw, svc.signer, svc.signerChain...)
+	}
+	if signed && svc.signer == nil {
+		return nil, errors.New("enrollment profile template is signed and no profile signer is configured to sign it again after substitution")
+	}
+	if svc.signer == nil {
+		return rendered, nil
+	}
+	return profileutil.SignProfile(rendered, svc.signer, svc.signerChain...)
+}
+
+// substituteVariables replaces each ${Name} in the plist raw with the XML
+// escaped value of vars[Name], and checks that the result is still a plist.
+// Names which are not in vars, such as a literal ${HOME} in a script, are left
+// as they are. It returns nil if raw has no variables in vars.
+func substituteVariables(raw []byte, vars map[string]string) ([]byte, error) {
+	var escapeErr error
+	var substituted bool
+	rendered := templateVariable.ReplaceAllFunc(raw, func(match []byte) []byte {
+		name := string(templateVariable.FindSubmatch(match)[1])
+		value, ok := vars[name]
+		if !ok {
+			return match
+		}
+		substituted = true
+		var buf bytes.Buffer
+		if err := xml.EscapeText(&buf, []byte(value)); err != nil {
+			escapeErr = err
+		}
+		return buf.Bytes()
+	})
+	if escapeErr != nil {
+		return nil, errors.Wrap(escapeErr, "escape enrollment profile variable")
+	}
+	if !substituted {
+		return nil, nil
+	}
+	var check map[string]interface{}
+	if err := plist.Unmarshal(rendered, &check); err != nil {
+		return nil, errors.Wrap(err, "enrollment profile is not a plist after substituting variables")
+	}
+	return rendered, nil
+}
+
+// unwrapMobileconfig returns the plist of mc, and whether it was signed.
+func unwrapMobileconfig(mc profile.Mobileconfig) ([]byte, bool, error) {
+	if len(mc) > 5 && string(mc[0:5]) != "<?xml" {
+		p7, err := pkcs7.Parse(mc)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "enrollment profile is not XML nor PKCS7 parseable")
+		}
+		return p7.Content, true, nil
+	}
+	return mc, false, nil
+}
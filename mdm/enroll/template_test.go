@@ -0,0 +1,182 @@
+package enroll
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/groob/plist"
+	"go.mozilla.org/pkcs7"
+
+	"github.com/micromdm/micromdm/pkg/crypto"
+	"github.com/micromdm/micromdm/platform/profile"
+)
+
+type templateProfile struct {
+	PayloadDescription  string
+	PayloadIdentifier   string
+	PayloadOrganization string
+	PayloadContent      []struct {
+		CheckInURL          string
+		PayloadOrganization string
+	}
+}
+
+func TestEnrollDeviceSubstitutesVariables(t *testing.T) {
+	svc := templateService(t, WithVariableSource(&FileVariables{
+		Variables: map[string]string{"OrganizationName": "Acme & Sons", "EnrollmentToken": "default"},
+		Devices: map[string]map[string]string{
+			"C02ABC123": {"EnrollmentToken": "tok-123"},
+		},
+	}))
+	mc, err := svc.EnrollDevice(context.Background(), Device{SerialNumber: "C02ABC123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p templateProfile
+	if err := plist.Unmarshal(mc, &p); err != nil {
+		t.Fatalf("substituted profile is not a plist: %s", err)
+	}
+	if have, want := p.PayloadDescription, "Enrolls C02ABC123"; have != want {
+		t.Errorf("have PayloadDescription %q, want %q", have, want)
+	}
+	if have, want := p.PayloadOrganization, "Acme & Sons"; have != want {
+		t.Errorf("have PayloadOrganization %q, want %q", have, want)
+	}
+	if have, want := p.PayloadContent[0].CheckInURL, "https://mdm.example.com/mdm/checkin?token=tok-123"; have != want {
+		t.Errorf("have CheckInURL %q, want %q", have, want)
+	}
+	if id, err := mc.GetPayloadIdentifier(); err != nil || id != EnrollmentProfileId {
+		t.Errorf("have PayloadIdentifier %q, %v, want %s", id, err, EnrollmentProfileId)
+	}
+
+	// a device without its own variables gets the defaults.
+	mc, err = svc.EnrollDevice(context.Background(), Device{SerialNumber: "OTHER"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var defaults templateProfile
+	if err := plist.Unmarshal(mc, &defaults); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := defaults.PayloadContent[0].CheckInURL, "https://mdm.example.com/mdm/checkin?token=default"; have != want {
+		t.Errorf("have CheckInURL %q, want %q", have, want)
+	}
+}
+
+func TestEnrollDeviceSignsSubstitutedProfile(t *testing.T) {
+	key, cert, err := crypto.SimpleSelfSignedRSAKeypair("Profile Signer", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &crypto.Identity{Certificate: cert, PrivateKey: key}
+	svc := templateService(t, WithProfileSigner(signer))
+
+	mc, err := svc.EnrollDevice(context.Background(), Device{SerialNumber: "C02ABC123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(mc)
+	if err != nil {
+		t.Fatalf("enrollment profile is not signed: %s", err)
+	}
+	if err := p7.Verify(); err != nil {
+		t.Fatalf("verify signed enrollment profile: %s", err)
+	}
+	if !p7.GetOnlySigner().Equal(cert) {
+		t.Error("enrollment profile is not signed by the profile signer")
+	}
+	var p templateProfile
+	if err := plist.Unmarshal(p7.Content, &p); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := p.PayloadDescription, "Enrolls C02ABC123"; have != want {
+		t.Errorf("have signed PayloadDescription %q, want %q", have, want)
+	}
+
+	// a signed template is signed again after substitution.
+	svc.ProfileDB.(*templateStore).mobileconfig = mc
+	mc, err = svc.EnrollDevice(context.Background(), Device{SerialNumber: "C02XYZ789"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p7, err = pkcs7.Parse(mc); err != nil {
+		t.Fatal(err)
+	}
+	if err := p7.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	// without a signer, a signed template cannot be substituted.
+	svc.signer = nil
+	svc.ProfileDB.(*templateStore).mobileconfig, _ = ioutil.ReadFile("testdata/template.mobileconfig")
+	signed, err := crypto.SignPKCS7(svc.ProfileDB.(*templateStore).mobileconfig, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.ProfileDB.(*templateStore).mobileconfig = signed
+	if _, err := svc.EnrollDevice(context.Background(), Device{}); err == nil {
+		t.Error("expected error for a signed template without a profile signer")
+	}
+}
+
+func TestUnknownVariablesAreKept(t *testing.T) {
+	raw := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict><key>Script</key><string>${HOME}/${SerialNumber}</string></dict></plist>`)
+	rendered, err := substituteVariables(raw, Device{SerialNumber: "C02ABC123"}.variables())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p struct{ Script string }
+	if err := plist.Unmarshal(rendered, &p); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := p.Script, "${HOME}/C02ABC123"; have != want {
+		t.Errorf("have Script %q, want %q", have, want)
+	}
+
+	// a signed template with only unknown variables is served as it is without a signer.
+	key, cert, err := crypto.SimpleSelfSignedRSAKeypair("Profile Signer", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict><key>Script</key><string>${HOME}</string></dict></plist>`)
+	signed, err := crypto.SignPKCS7(unknown, &crypto.Identity{Certificate: cert, PrivateKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &service{ProfileDB: &templateStore{mobileconfig: signed}}
+	mc, err := svc.EnrollDevice(context.Background(), Device{SerialNumber: "C02ABC123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mc, signed) {
+		t.Error("signed template with only unknown variables was changed")
+	}
+}
+
+func templateService(t *testing.T, opts ...Option) *service {
+	t.Helper()
+	mc, err := ioutil.ReadFile("testdata/template.mobileconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &service{ProfileDB: &templateStore{mobileconfig: mc}}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
+}
+
+// templateStore stores the enrollment profile template.
+type templateStore struct {
+	profile.Store
+	mobileconfig profile.Mobileconfig
+}
+
+func (s *templateStore) ProfileById(ctx context.Context, id string) (*profile.Profile, error) {
+	return &profile.Profile{Identifier: id, Mobileconfig: s.mobileconfig}, nil
+}
@@ -51,6 +51,9 @@ func decodeEmptyRequest(_ context.Context, _ *http.Request) (interface{}, error)
 	return nil, nil
 }
 
+// maxEnrollRequestSize is the maximum size of a signed DEP enrollment request body.
+const maxEnrollRequestSize = 1 << 20
+
 type verifier struct {
 	*crypto.PKCS7Verifier
 }
@@ -60,15 +63,7 @@ func (v verifier) decodeMDMEnrollRequest(_ context.Context, r *http.Request) (in
 	case "GET":
 		return mdmEnrollRequest{}, nil
 	case "POST": // DEP request
-		data, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			return nil, err
-		}
-		p7, err := pkcs7.Parse(data)
-		if err != nil {
-			return nil, err
-		}
-		err = v.Verify(p7)
+		p7, err := crypto.ReadAndVerifyPKCS7(r.Body, maxEnrollRequestSize, *v.PKCS7Verifier)
 		if err != nil {
 			return nil, err
 		}
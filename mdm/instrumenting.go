@@ -0,0 +1,48 @@
+package mdm
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// InstrumentingMiddleware counts enrollments and command results.
+//
+// Every Authenticate checkin starts an enrollment, so enrollments are
+// counted by result, "success" or "failure", when Authenticate returns.
+// Command results are counted by the status a device reports, such as
+// Acknowledged or NotNow. Idle responses carry no command result and are not counted.
+func InstrumentingMiddleware(enrollments, commands metrics.Counter) Middleware {
+	return func(next Service) Service {
+		return &instrumentingMiddleware{
+			next:        next,
+			enrollments: enrollments,
+			commands:    commands,
+		}
+	}
+}
+
+type instrumentingMiddleware struct {
+	next        Service
+	enrollments metrics.Counter
+	commands    metrics.Counter
+}
+
+func (mw instrumentingMiddleware) Checkin(ctx context.Context, event CheckinEvent) (payload []byte, err error) {
+	payload, err = mw.next.Checkin(ctx, event)
+	if event.Command.MessageType == "Authenticate" {
+		result := "success"
+		if err != nil {
+			result = "failure"
+		}
+		mw.enrollments.With("result", result).Add(1)
+	}
+	return
+}
+
+func (mw instrumentingMiddleware) Acknowledge(ctx context.Context, event AcknowledgeEvent) (payload []byte, err error) {
+	if status := event.Response.Status; status != "Idle" && status != "" {
+		mw.commands.With("status", status).Add(1)
+	}
+	return mw.next.Acknowledge(ctx, event)
+}
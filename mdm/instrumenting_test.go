@@ -0,0 +1,59 @@
+package mdm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type stubService struct {
+	err error
+}
+
+func (s stubService) Checkin(ctx context.Context, event CheckinEvent) ([]byte, error) {
+	return nil, s.err
+}
+
+func (s stubService) Acknowledge(ctx context.Context, event AcknowledgeEvent) ([]byte, error) {
+	return nil, s.err
+}
+
+func TestInstrumentingMiddleware(t *testing.T) {
+	enrollments := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "micromdm_enrollments_total"}, []string{"result"})
+	commands := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "micromdm_commands_total"}, []string{"status"})
+	ctx := context.Background()
+
+	mw := InstrumentingMiddleware(kitprometheus.NewCounter(enrollments), kitprometheus.NewCounter(commands))
+	svc := mw(stubService{})
+	failing := mw(stubService{err: errors.New("unauthorized")})
+
+	authenticate := CheckinEvent{Command: CheckinCommand{MessageType: "Authenticate"}}
+	svc.Checkin(ctx, authenticate)
+	svc.Checkin(ctx, CheckinEvent{Command: CheckinCommand{MessageType: "TokenUpdate"}})
+	failing.Checkin(ctx, authenticate)
+
+	for _, status := range []string{"Idle", "Acknowledged", "Acknowledged", "Error", "NotNow"} {
+		svc.Acknowledge(ctx, AcknowledgeEvent{Response: Response{Status: status}})
+	}
+
+	for _, tt := range []struct {
+		vec   *prometheus.CounterVec
+		label string
+		want  float64
+	}{
+		{enrollments, "success", 1},
+		{enrollments, "failure", 1},
+		{commands, "Acknowledged", 2},
+		{commands, "Error", 1},
+		{commands, "NotNow", 1},
+		{commands, "Idle", 0},
+	} {
+		if have := testutil.ToFloat64(tt.vec.WithLabelValues(tt.label)); have != tt.want {
+			t.Errorf("have %v for %s, want %v", have, tt.label, tt.want)
+		}
+	}
+}
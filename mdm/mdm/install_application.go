@@ -0,0 +1,62 @@
+package mdm
+
+import (
+	"net/url"
+
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/mdm/appmanifest"
+)
+
+// NewInstallApplicationCommand creates an InstallApplication command which
+// installs the enterprise app described by the manifest plist at manifestURL.
+// The managementFlags are the InstallApplication ManagementFlags, for example
+// 1 to remove the app when the MDM profile is removed. Zero leaves them unset.
+func NewInstallApplicationCommand(manifestURL string, managementFlags int) (*Command, error) {
+	if err := validateManifestURL(manifestURL); err != nil {
+		return nil, err
+	}
+	cmd := &Command{
+		RequestType: "InstallApplication",
+		InstallApplication: &InstallApplication{
+			ManifestURL: &manifestURL,
+		},
+	}
+	if managementFlags != 0 {
+		cmd.InstallApplication.ManagementFlags = &managementFlags
+	}
+	return cmd, nil
+}
+
+// NewInstallEnterpriseApplicationCommand creates an InstallEnterpriseApplication
+// command, which is supported by macOS 10.13.6 and later. Unlike InstallApplication,
+// the manifest is embedded in the command, so it does not need to be hosted separately.
+// The pinningCerts are optional DER encoded certificates which the device uses to
+// validate the server hosting the package.
+func NewInstallEnterpriseApplicationCommand(manifest *appmanifest.Manifest, pinningCerts [][]byte) (*Command, error) {
+	if manifest == nil {
+		return nil, errors.New("InstallEnterpriseApplication requires a manifest")
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, errors.Wrap(err, "validate InstallEnterpriseApplication manifest")
+	}
+	cmd := &Command{
+		RequestType: "InstallEnterpriseApplication",
+		InstallEnterpriseApplication: &InstallEnterpriseApplication{
+			Manifest:                manifest,
+			ManifestURLPinningCerts: pinningCerts,
+		},
+	}
+	return cmd, nil
+}
+
+func validateManifestURL(manifestURL string) error {
+	u, err := url.Parse(manifestURL)
+	if err != nil {
+		return errors.Wrap(err, "parse InstallApplication manifest url")
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("InstallApplication manifest url must be an https url, got %q", manifestURL)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package mdm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/groob/plist"
+
+	"github.com/micromdm/micromdm/mdm/appmanifest"
+)
+
+type testFile struct {
+	*bytes.Reader
+}
+
+func (f testFile) Size() int64 { return f.Reader.Size() }
+
+func TestNewInstallApplicationCommand(t *testing.T) {
+	manifestURL := "https://mdm.example.com/repo/app.plist"
+	cmd, err := NewInstallApplicationCommand(manifestURL, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := marshalTestPayload(t, cmd)
+	if have, want := payload["RequestType"], "InstallApplication"; have != want {
+		t.Errorf("have RequestType %v, want %s", have, want)
+	}
+	if have, want := payload["ManifestURL"], manifestURL; have != want {
+		t.Errorf("have ManifestURL %v, want %s", have, want)
+	}
+	if have, want := payload["ManagementFlags"], uint64(1); have != want {
+		t.Errorf("have ManagementFlags %v, want %d", have, want)
+	}
+
+	for _, u := range []string{"", "http://mdm.example.com/app.plist", "https://", "app.plist"} {
+		if _, err := NewInstallApplicationCommand(u, 0); err == nil {
+			t.Errorf("expected error for manifest url %q", u)
+		}
+	}
+}
+
+func TestNewInstallEnterpriseApplicationCommand(t *testing.T) {
+	pkg := testFile{bytes.NewReader(bytes.Repeat([]byte("pkg"), 100))}
+	manifest, err := appmanifest.Create(pkg, "https://mdm.example.com/repo/app.pkg",
+		appmanifest.WithMD5Size(128),
+		appmanifest.WithMetadata("com.example.app", "1.0", "App"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := NewInstallEnterpriseApplicationCommand(manifest, [][]byte{[]byte("cert")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := marshalTestPayload(t, cmd)
+	if have, want := payload["RequestType"], "InstallEnterpriseApplication"; have != want {
+		t.Errorf("have RequestType %v, want %s", have, want)
+	}
+	if _, ok := payload["ManifestURLPinningCerts"]; !ok {
+		t.Error("missing ManifestURLPinningCerts")
+	}
+	m, ok := payload["Manifest"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("missing Manifest in %v", payload)
+	}
+	items, ok := m["items"].([]interface{})
+	if !ok || len(items) != 1 {
+		t.Fatalf("have manifest items %v, want one item", m["items"])
+	}
+	item := items[0].(map[string]interface{})
+	metadata := item["metadata"].(map[string]interface{})
+	for key, want := range map[string]interface{}{
+		"bundle-identifier": "com.example.app",
+		"bundle-version":    "1.0",
+		"kind":              "software",
+		"sizeInBytes":       uint64(300),
+	} {
+		if have := metadata[key]; have != want {
+			t.Errorf("metadata %s: have %v, want %v", key, have, want)
+		}
+	}
+	asset := item["assets"].([]interface{})[0].(map[string]interface{})
+	for _, key := range []string{"url", "md5-size", "md5s", "sha256-size", "sha256s"} {
+		if _, ok := asset[key]; !ok {
+			t.Errorf("asset is missing %s", key)
+		}
+	}
+
+	if _, err := NewInstallEnterpriseApplicationCommand(nil, nil); err == nil {
+		t.Error("expected error without a manifest")
+	}
+	if _, err := NewInstallEnterpriseApplicationCommand(&appmanifest.Manifest{}, nil); err == nil {
+		t.Error("expected error for an empty manifest")
+	}
+}
+
+// marshalTestPayload marshals cmd the way it is sent to a device
+// and decodes the Command dictionary.
+func marshalTestPayload(t *testing.T, cmd *Command) map[string]interface{} {
+	t.Helper()
+	payload, err := NewCommandPayload(&CommandRequest{Command: cmd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := plist.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		CommandUUID string
+		Command     map[string]interface{}
+	}
+	if err := plist.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.CommandUUID == "" {
+		t.Error("missing CommandUUID")
+	}
+	return decoded.Command
+}
@@ -0,0 +1,68 @@
+package mdm
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// pinLength is the number of digits in the PIN of a DeviceLock or EraseDevice command.
+// macOS requires a PIN to unlock the device; iOS ignores it.
+const pinLength = 6
+
+// NewPIN generates a random six digit PIN for a DeviceLock or EraseDevice command.
+func NewPIN() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", errors.Wrap(err, "generate PIN")
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// NewDeviceLockCommand creates a DeviceLock command. The message and
+// phoneNumber are shown on the lock screen and may be empty.
+func NewDeviceLockCommand(pin, message, phoneNumber string) (*Command, error) {
+	if err := validatePIN(pin); err != nil {
+		return nil, err
+	}
+	cmd := &Command{
+		RequestType: "DeviceLock",
+		DeviceLock: &DeviceLock{
+			PIN:         pin,
+			Message:     message,
+			PhoneNumber: phoneNumber,
+		},
+	}
+	return cmd, nil
+}
+
+// NewEraseDeviceCommand creates an EraseDevice command. The pin locks the
+// firmware of a Mac after it is erased and may be empty for iOS devices.
+func NewEraseDeviceCommand(pin string) (*Command, error) {
+	if pin != "" {
+		if err := validatePIN(pin); err != nil {
+			return nil, err
+		}
+	}
+	cmd := &Command{
+		RequestType: "EraseDevice",
+		EraseDevice: &EraseDevice{
+			PIN: pin,
+		},
+	}
+	return cmd, nil
+}
+
+func validatePIN(pin string) error {
+	if len(pin) != pinLength {
+		return errors.Errorf("PIN must be %d digits, got %d characters", pinLength, len(pin))
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return errors.New("PIN must only contain digits")
+		}
+	}
+	return nil
+}
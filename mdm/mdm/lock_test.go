@@ -0,0 +1,71 @@
+package mdm
+
+import "testing"
+
+func TestNewPIN(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		pin, err := NewPIN()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validatePIN(pin); err != nil {
+			t.Fatalf("generated invalid PIN %q: %s", pin, err)
+		}
+	}
+}
+
+func TestNewDeviceLockCommand(t *testing.T) {
+	cmd, err := NewDeviceLockCommand("012345", "Lost device", "555-0100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := marshalTestPayload(t, cmd)
+	for key, want := range map[string]string{
+		"RequestType": "DeviceLock",
+		"PIN":         "012345",
+		"Message":     "Lost device",
+		"PhoneNumber": "555-0100",
+	} {
+		if have := payload[key]; have != want {
+			t.Errorf("have %s %v, want %s", key, have, want)
+		}
+	}
+
+	cmd, err = NewDeviceLockCommand("012345", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload = marshalTestPayload(t, cmd)
+	for _, key := range []string{"Message", "PhoneNumber"} {
+		if _, ok := payload[key]; ok {
+			t.Errorf("payload contains empty %s", key)
+		}
+	}
+
+	for _, pin := range []string{"", "12345", "1234567", "12345a"} {
+		if _, err := NewDeviceLockCommand(pin, "", ""); err == nil {
+			t.Errorf("expected error for PIN %q", pin)
+		}
+	}
+}
+
+func TestNewEraseDeviceCommand(t *testing.T) {
+	cmd, err := NewEraseDeviceCommand("654321")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := marshalTestPayload(t, cmd)
+	if have, want := payload["RequestType"], "EraseDevice"; have != want {
+		t.Errorf("have RequestType %v, want %s", have, want)
+	}
+	if have, want := payload["PIN"], "654321"; have != want {
+		t.Errorf("have PIN %v, want %s", have, want)
+	}
+
+	if _, err := NewEraseDeviceCommand(""); err != nil {
+		t.Errorf("EraseDevice without a PIN: %s", err)
+	}
+	if _, err := NewEraseDeviceCommand("12"); err == nil {
+		t.Error("expected error for a short PIN")
+	}
+}
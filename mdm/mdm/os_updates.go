@@ -0,0 +1,66 @@
+package mdm
+
+import "github.com/pkg/errors"
+
+// The install actions of a ScheduleOSUpdate command.
+const (
+	// InstallActionDefault downloads the update and installs it, or
+	// notifies the user if the update requires it.
+	InstallActionDefault = "Default"
+	// InstallActionDownloadOnly downloads the update without installing it.
+	InstallActionDownloadOnly = "DownloadOnly"
+	// InstallActionNotifyOnly notifies the user of a downloaded update.
+	InstallActionNotifyOnly = "NotifyOnly"
+	// InstallActionInstallASAP installs a downloaded update, or downloads
+	// and installs it, and restarts the device if needed.
+	InstallActionInstallASAP = "InstallASAP"
+	// InstallActionInstallForceRestart installs the update and forces a restart.
+	InstallActionInstallForceRestart = "InstallForceRestart"
+	// InstallActionInstallLater downloads the update and lets the user
+	// schedule the install.
+	InstallActionInstallLater = "InstallLater"
+)
+
+var installActions = map[string]bool{
+	InstallActionDefault:             true,
+	InstallActionDownloadOnly:        true,
+	InstallActionNotifyOnly:          true,
+	InstallActionInstallASAP:         true,
+	InstallActionInstallForceRestart: true,
+	InstallActionInstallLater:        true,
+}
+
+// NewAvailableOSUpdatesCommand creates an AvailableOSUpdates command, which
+// asks a device for the OS updates it can install.
+func NewAvailableOSUpdatesCommand() *Command {
+	return &Command{RequestType: "AvailableOSUpdates"}
+}
+
+// NewScheduleOSUpdateCommand creates a ScheduleOSUpdate command for updates.
+// Each update needs a ProductKey or ProductVersion, and an empty InstallAction
+// is sent as InstallActionDefault.
+func NewScheduleOSUpdateCommand(updates []OSUpdate) (*Command, error) {
+	if len(updates) == 0 {
+		return nil, errors.New("ScheduleOSUpdate requires at least one update")
+	}
+	scheduled := make([]OSUpdate, 0, len(updates))
+	for _, u := range updates {
+		if u.ProductKey == "" && u.ProductVersion == "" {
+			return nil, errors.New("ScheduleOSUpdate update requires a product key or product version")
+		}
+		if u.InstallAction == "" {
+			u.InstallAction = InstallActionDefault
+		}
+		if !installActions[u.InstallAction] {
+			return nil, errors.Errorf("unknown ScheduleOSUpdate install action %q", u.InstallAction)
+		}
+		scheduled = append(scheduled, u)
+	}
+	cmd := &Command{
+		RequestType: "ScheduleOSUpdate",
+		ScheduleOSUpdate: &ScheduleOSUpdate{
+			Updates: scheduled,
+		},
+	}
+	return cmd, nil
+}
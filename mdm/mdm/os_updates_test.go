@@ -0,0 +1,41 @@
+package mdm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewScheduleOSUpdateCommand(t *testing.T) {
+	cmd, err := NewScheduleOSUpdateCommand([]OSUpdate{
+		{ProductKey: "012-40839", InstallAction: InstallActionInstallASAP},
+		{ProductKey: "012-44262", InstallAction: InstallActionDownloadOnly},
+		{ProductVersion: "12.5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := marshalTestPayload(t, cmd)
+	if have, want := payload["RequestType"], "ScheduleOSUpdate"; have != want {
+		t.Errorf("have RequestType %v, want %s", have, want)
+	}
+	want := []interface{}{
+		map[string]interface{}{"ProductKey": "012-40839", "InstallAction": "InstallASAP"},
+		map[string]interface{}{"ProductKey": "012-44262", "InstallAction": "DownloadOnly"},
+		map[string]interface{}{"ProductVersion": "12.5", "InstallAction": "Default"},
+	}
+	if have := payload["Updates"]; !reflect.DeepEqual(have, want) {
+		t.Errorf("have Updates %#v, want %#v", have, want)
+	}
+}
+
+func TestNewScheduleOSUpdateCommandInvalid(t *testing.T) {
+	for _, updates := range [][]OSUpdate{
+		nil,
+		{{InstallAction: InstallActionDefault}},
+		{{ProductKey: "012-40839", InstallAction: "InstallNever"}},
+	} {
+		if _, err := NewScheduleOSUpdateCommand(updates); err == nil {
+			t.Errorf("expected error for updates %+v", updates)
+		}
+	}
+}
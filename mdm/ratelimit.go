@@ -0,0 +1,55 @@
+package mdm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/micromdm/micromdm/pkg/ratelimit"
+)
+
+// RateLimitMiddleware rejects the checkins of a device which exceeds the rate
+// of limiter with 429 Too Many Requests and a Retry-After header.
+// Devices are limited by UDID, or by EnrollmentID for User Enrollments.
+func RateLimitMiddleware(limiter *ratelimit.Limiter) Middleware {
+	return func(next Service) Service {
+		return &rateLimitMiddleware{
+			next:    next,
+			limiter: limiter,
+		}
+	}
+}
+
+type rateLimitMiddleware struct {
+	next    Service
+	limiter *ratelimit.Limiter
+}
+
+func (mw *rateLimitMiddleware) Checkin(ctx context.Context, event CheckinEvent) ([]byte, error) {
+	id := event.Command.UDID
+	if event.Command.EnrollmentID != "" {
+		id = event.Command.EnrollmentID
+	}
+	if ok, retryAfter := mw.limiter.Allow(id); !ok {
+		return nil, &rateLimitError{udid: id, retryAfter: retryAfter}
+	}
+	return mw.next.Checkin(ctx, event)
+}
+
+func (mw *rateLimitMiddleware) Acknowledge(ctx context.Context, event AcknowledgeEvent) ([]byte, error) {
+	return mw.next.Acknowledge(ctx, event)
+}
+
+type rateLimitError struct {
+	udid       string
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("checkin rate limit exceeded for %s", e.udid)
+}
+
+// RetryAfter is the time until the device may check in again.
+func (e *rateLimitError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
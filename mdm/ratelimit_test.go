@@ -0,0 +1,44 @@
+package mdm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	"github.com/micromdm/micromdm/pkg/crypto"
+	"github.com/micromdm/micromdm/pkg/ratelimit"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	svc := RateLimitMiddleware(ratelimit.New(0.01, 2, 100))(stubService{})
+	r := mux.NewRouter()
+	RegisterHTTPHandlers(r, MakeServerEndpoints(svc), &crypto.PKCS7Verifier{}, log.NewNopLogger())
+
+	checkin := func(udid string) *httptest.ResponseRecorder {
+		body := strings.Replace(sampleCheckinRequest, "BC5E2DA4-7FB6-5E70-9928-4981680DAFBF", udid, 1)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/mdm/checkin", strings.NewReader(body)))
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if have, want := checkin("noisy").Code, http.StatusOK; have != want {
+			t.Fatalf("checkin %d: have status %d, want %d", i, have, want)
+		}
+	}
+	rec := checkin("noisy")
+	if have, want := rec.Code, http.StatusTooManyRequests; have != want {
+		t.Fatalf("have status %d, want %d", have, want)
+	}
+	if have, want := rec.Header().Get("Retry-After"), "100"; have != want {
+		t.Errorf("have Retry-After %q, want %q", have, want)
+	}
+
+	if have, want := checkin("quiet").Code, http.StatusOK; have != want {
+		t.Errorf("other device: have status %d, want %d", have, want)
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"io/ioutil"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
@@ -14,6 +17,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/groob/plist"
 	"github.com/micromdm/micromdm/pkg/crypto"
+	"github.com/micromdm/micromdm/pkg/httputil"
 	"github.com/pkg/errors"
 	"go.mozilla.org/pkcs7"
 )
@@ -33,7 +37,7 @@ func MakeServerEndpoints(s Service) Endpoints {
 func RegisterHTTPHandlers(r *mux.Router, e Endpoints, v *crypto.PKCS7Verifier, logger log.Logger) {
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorEncoder(encodeError),
-		httptransport.ServerErrorLogger(logger),
+		httptransport.ServerErrorHandler(httputil.ErrorHandler(logger)),
 		httptransport.ServerBefore(httptransport.PopulateRequestContext),
 		httptransport.ServerBefore((verifier{PKCS7Verifier: v}).populateDeviceCertificateFromSignRequestHeader),
 	}
@@ -125,13 +129,10 @@ func (v verifier) verifySignature(header string, body []byte) (*x509.Certificate
 		return nil, errors.Wrap(err, "CMS parse decoded MDM SignMessage signature")
 	}
 	p7.Content = body
-	if err := v.Verify(p7); err != nil {
+	cert, err := v.VerifyAndGetSigner(p7)
+	if err != nil {
 		return nil, errors.Wrap(err, "CMS verify MDM Signed Message")
 	}
-	cert := p7.GetOnlySigner()
-	if cert == nil {
-		return nil, errors.New("invalid or missing CMS signer")
-	}
 	return cert, nil
 }
 
@@ -179,5 +180,19 @@ func encodeError(ctx context.Context, err error, w http.ResponseWriter) {
 		return
 	}
 
+	type rateLimitErr interface {
+		error
+		RetryAfter() time.Duration
+	}
+	if e, ok := err.(rateLimitErr); ok {
+		seconds := int(math.Ceil(e.RetryAfter().Seconds()))
+		if seconds < 1 {
+			seconds = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
 	w.WriteHeader(http.StatusInternalServerError)
 }
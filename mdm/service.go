@@ -2,6 +2,8 @@ package mdm
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/micromdm/micromdm/platform/pubsub"
 )
@@ -40,6 +42,8 @@ type BootstrapTokenRetriever interface {
 type Command struct {
 	UUID    string `json:"uuid"`
 	Payload []byte `json:"payload"`
+	// QueuedAt is the time the command was added to the queue.
+	QueuedAt time.Time `json:"queued_at" db:"queued_at"`
 }
 
 // Queue is an MDM Command Queue.
@@ -47,8 +51,20 @@ type Queue interface {
 	Next(context.Context, Response) ([]byte, error)
 	Clear(context.Context, CheckinEvent) error
 	ViewQueue(context.Context, CheckinEvent) ([]*Command, error)
+	// DeleteCommand removes a command which was not sent yet, or which the
+	// device responded NotNow to, from the queue. It returns ErrCommandNotFound
+	// if there is no such command.
+	DeleteCommand(ctx context.Context, event CheckinEvent, uuid string) error
 }
 
+// ErrCommandNotFound is returned by Queue.DeleteCommand if the command is not queued.
+var ErrCommandNotFound error = commandNotFoundError{}
+
+type commandNotFoundError struct{}
+
+func (commandNotFoundError) Error() string   { return "command not found in queue" }
+func (commandNotFoundError) StatusCode() int { return http.StatusNotFound }
+
 type MDMService struct {
 	dev   BootstrapTokenRetriever
 	pub   pubsub.Publisher
@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE push_info ADD COLUMN IF NOT EXISTS token_updated_at TIMESTAMP DEFAULT '1970-01-01 00:00:00';
+ALTER TABLE push_info ADD COLUMN IF NOT EXISTS invalidated_at TIMESTAMP DEFAULT '1970-01-01 00:00:00';
+
+
+-- +goose Down
+ALTER TABLE push_info DROP COLUMN IF EXISTS token_updated_at;
+ALTER TABLE push_info DROP COLUMN IF EXISTS invalidated_at;
@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS dep_token TEXT DEFAULT '';
+
+
+-- +goose Down
+ALTER TABLE devices DROP COLUMN IF EXISTS dep_token;
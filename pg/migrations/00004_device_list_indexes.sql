@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS devices_serial_number_idx ON devices (serial_number);
+CREATE INDEX IF NOT EXISTS devices_udid_idx ON devices (udid);
+CREATE INDEX IF NOT EXISTS devices_enrolled_idx ON devices (enrolled);
+CREATE INDEX IF NOT EXISTS devices_last_seen_idx ON devices (last_seen);
+CREATE INDEX IF NOT EXISTS devices_os_version_idx ON devices (os_version);
+CREATE INDEX IF NOT EXISTS devices_model_idx ON devices (model);
+CREATE INDEX IF NOT EXISTS devices_model_name_idx ON devices (model_name);
+
+
+-- +goose Down
+DROP INDEX IF EXISTS devices_serial_number_idx;
+DROP INDEX IF EXISTS devices_udid_idx;
+DROP INDEX IF EXISTS devices_enrolled_idx;
+DROP INDEX IF EXISTS devices_last_seen_idx;
+DROP INDEX IF EXISTS devices_os_version_idx;
+DROP INDEX IF EXISTS devices_model_idx;
+DROP INDEX IF EXISTS devices_model_name_idx;
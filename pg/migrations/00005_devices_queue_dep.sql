@@ -0,0 +1,47 @@
+-- +goose Up
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS bootstrap_token BYTEA DEFAULT NULL;
+
+CREATE TABLE IF NOT EXISTS udid_cert_auth (
+    udid TEXT PRIMARY KEY,
+    cert_hash BYTEA NOT NULL
+);
+
+-- position orders the commands of a device. A command which is sent or
+-- refused with NotNow moves to the end of the queue with a new position.
+CREATE SEQUENCE IF NOT EXISTS command_queue_position_seq;
+
+CREATE TABLE IF NOT EXISTS command_queue (
+    udid TEXT NOT NULL,
+    command_uuid TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    position BIGINT NOT NULL DEFAULT nextval('command_queue_position_seq'),
+    created_at TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'utc'),
+    expires_at TIMESTAMP DEFAULT NULL,
+    completed_at TIMESTAMP DEFAULT NULL,
+    last_status TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (udid, command_uuid)
+);
+
+CREATE INDEX IF NOT EXISTS command_queue_udid_status_position_idx ON command_queue (udid, status, position);
+
+CREATE TABLE IF NOT EXISTS dep_cursors (
+    consumer_key TEXT PRIMARY KEY,
+    value TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT '1970-01-01 00:00:00'
+);
+
+CREATE TABLE IF NOT EXISTS dep_auto_assigners (
+    filter TEXT PRIMARY KEY,
+    profile_uuid TEXT NOT NULL
+);
+
+
+-- +goose Down
+ALTER TABLE devices DROP COLUMN IF EXISTS bootstrap_token;
+DROP TABLE IF EXISTS udid_cert_auth;
+DROP INDEX IF EXISTS command_queue_udid_status_position_idx;
+DROP TABLE IF EXISTS command_queue;
+DROP SEQUENCE IF EXISTS command_queue_position_seq;
+DROP TABLE IF EXISTS dep_cursors;
+DROP TABLE IF EXISTS dep_auto_assigners;
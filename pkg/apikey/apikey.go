@@ -0,0 +1,136 @@
+// Package apikey authenticates API requests with named API keys, each of which
+// is granted a set of scopes.
+//
+// Clients send a key with HTTP Basic authentication, using the name of the key
+// as the username and the key as the password.
+package apikey
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/auth/basic"
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/pkg/crypto"
+	"github.com/micromdm/micromdm/pkg/ctxlog"
+	"github.com/micromdm/micromdm/pkg/scope"
+)
+
+// Realm is the realm of the Basic authentication challenge.
+const Realm = "micromdm"
+
+// Key is an API key and the scopes it grants.
+type Key struct {
+	Name   string   `json:"name"`
+	Key    string   `json:"key"`
+	Scopes []string `json:"scopes"`
+}
+
+// Keys are the API keys which can authenticate requests.
+type Keys []Key
+
+// Load reads a JSON array of keys from path.
+func Load(path string) (Keys, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read API keys")
+	}
+	var keys Keys
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, errors.Wrapf(err, "decode API keys %s", path)
+	}
+	return keys, errors.Wrapf(keys.Validate(), "API keys %s", path)
+}
+
+// Validate checks that each key has a unique name, a key and valid scopes.
+func (keys Keys) Validate() error {
+	names := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		switch {
+		case k.Name == "" || strings.Contains(k.Name, ":"):
+			return errors.Errorf("invalid key name %q", k.Name)
+		case names[k.Name]:
+			return errors.Errorf("duplicate key name %q", k.Name)
+		case k.Key == "":
+			return errors.Errorf("key %q is empty", k.Name)
+		case len(k.Scopes) == 0:
+			return errors.Errorf("key %q has no scopes", k.Name)
+		}
+		for _, s := range k.Scopes {
+			if !scope.Valid(s) {
+				return errors.Errorf("key %q has unknown scope %q", k.Name, s)
+			}
+		}
+		names[k.Name] = true
+	}
+	return nil
+}
+
+// authenticate returns ctx with the principal of the key in the Authorization
+// header, or false if it is not a valid key.
+func (keys Keys) authenticate(ctx context.Context, authorization string) (context.Context, bool) {
+	name, key, ok := parseBasicAuth(authorization)
+	if !ok {
+		return ctx, false
+	}
+	for _, k := range keys {
+		if crypto.SecureCompare([]byte(name), []byte(k.Name)) && crypto.SecureCompare([]byte(key), []byte(k.Key)) {
+			ctxlog.With(ctx, "api_key", k.Name)
+			return scope.NewContext(ctx, &scope.Principal{Name: k.Name, Scopes: k.Scopes}), true
+		}
+	}
+	return ctx, false
+}
+
+func parseBasicAuth(authorization string) (name, key string, ok bool) {
+	const prefix = "Basic "
+	if len(authorization) < len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", "", false
+	}
+	c, err := base64.StdEncoding.DecodeString(authorization[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+	i := strings.IndexByte(string(c), ':')
+	if i < 0 {
+		return "", "", false
+	}
+	return string(c[:i]), string(c[i+1:]), true
+}
+
+// EndpointMiddleware authenticates requests with one of keys and adds the
+// principal of the key to the request context, for scope.Require to authorize.
+// It requires the request context to be populated with
+// httptransport.PopulateRequestContext.
+func EndpointMiddleware(keys Keys) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			authorization, _ := ctx.Value(httptransport.ContextKeyRequestAuthorization).(string)
+			ctx, ok := keys.authenticate(ctx, authorization)
+			if !ok {
+				return nil, basic.AuthError{Realm: Realm}
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// RequireKey is EndpointMiddleware for a handler which is not an endpoint.
+func RequireKey(keys Keys, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, ok := keys.authenticate(r.Context(), r.Header.Get("Authorization"))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+Realm+`"`)
+			http.Error(w, "Authorization Required", http.StatusUnauthorized)
+			return
+		}
+		h(w, r.WithContext(ctx))
+	}
+}
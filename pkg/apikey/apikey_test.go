@@ -0,0 +1,117 @@
+package apikey
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
+)
+
+var testKeys = Keys{
+	{Name: "micromdm", Key: "secret", Scopes: []string{scope.Admin}},
+	{Name: "helpdesk", Key: "helpdesk-secret", Scopes: []string{scope.DevicesRead, scope.CommandsWrite}},
+}
+
+// testServer serves a handler which requires scope.DevicesErase.
+func testServer() http.Handler {
+	ok := func(context.Context, interface{}) (interface{}, error) { return struct{}{}, nil }
+	return httptransport.NewServer(
+		EndpointMiddleware(testKeys)(scope.Require(scope.DevicesErase)(ok)),
+		func(context.Context, *http.Request) (interface{}, error) { return nil, nil },
+		httputil.EncodeJSONResponse,
+		httptransport.ServerErrorEncoder(httputil.ErrorEncoder),
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+}
+
+func TestEndpointMiddleware(t *testing.T) {
+	srv := testServer()
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		code     int
+	}{
+		{"admin key", "micromdm", "secret", http.StatusOK},
+		{"under-scoped key", "helpdesk", "helpdesk-secret", http.StatusForbidden},
+		{"wrong key", "helpdesk", "secret", http.StatusUnauthorized},
+		{"no credentials", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/devices/UDID-1/erase", nil)
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			if rec.Code != tt.code {
+				t.Errorf("have status %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRequireKey(t *testing.T) {
+	h := RequireKey(testKeys, scope.RequireHTTP(scope.ServerAdmin, func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range []struct {
+		user, password string
+		code           int
+	}{
+		{"micromdm", "secret", http.StatusOK},
+		{"helpdesk", "helpdesk-secret", http.StatusForbidden},
+		{"helpdesk", "wrong", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/boltbackup", nil)
+		req.SetBasicAuth(tt.user, tt.password)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%s: have status %d, want %d", tt.user, rec.Code, tt.code)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apikey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"valid", `[{"name": "helpdesk", "key": "k", "scopes": ["devices:read", "commands:write"]}]`, true},
+		{"unknown scope", `[{"name": "helpdesk", "key": "k", "scopes": ["devices:wipe"]}]`, false},
+		{"no scopes", `[{"name": "helpdesk", "key": "k"}]`, false},
+		{"empty key", `[{"name": "helpdesk", "scopes": ["admin"]}]`, false},
+		{"duplicate name", `[{"name": "a", "key": "k", "scopes": ["admin"]}, {"name": "a", "key": "j", "scopes": ["admin"]}]`, false},
+		{"invalid JSON", `{`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "keys.json")
+			if err := ioutil.WriteFile(path, []byte(tt.data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			keys, err := Load(path)
+			if tt.ok && (err != nil || len(keys) != 1) {
+				t.Errorf("have keys %v, error %v", keys, err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -7,12 +7,11 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"time"
 )
 
-/*
-These certificates are not currently used but they represent the chain
-of certificates to verify a device's certificate in DEP & OTA requests.
-
+// appleRootCAPEM is the Apple Root CA that APNs push certificates and the
+// DEP & OTA device certificate chain are issued from.
 const appleRootCAPEM = `-----BEGIN CERTIFICATE-----
 MIIEuzCCA6OgAwIBAgIBAjANBgkqhkiG9w0BAQUFADBiMQswCQYDVQQGEwJVUzET
 MBEGA1UEChMKQXBwbGUgSW5jLjEmMCQGA1UECxMdQXBwbGUgQ2VydGlmaWNhdGlv
@@ -43,6 +42,10 @@ UKqK1drk/NAJBzewdXUh
 -----END CERTIFICATE-----
 `
 
+/*
+This certificate is not currently used but it is part of the chain
+of certificates to verify a device's certificate in DEP & OTA requests.
+
 const appleiPhoneCertificateAuthorityPEM = `-----BEGIN CERTIFICATE-----
 MIID8zCCAtugAwIBAgIBFzANBgkqhkiG9w0BAQUFADBiMQswCQYDVQQGEwJVUzET
 MBEGA1UEChMKQXBwbGUgSW5jLjEmMCQGA1UECxMdQXBwbGUgQ2VydGlmaWNhdGlv
@@ -129,3 +132,23 @@ func VerifyFromAppleDeviceCA(c *x509.Certificate) error {
 
 	return nil
 }
+
+// VerifyApplePushChain verifies that cert, such as an uploaded APNs push
+// certificate, chains to the bundled Apple Root CA through intermediates.
+// Push certificates are issued by an Apple intermediate (e.g. "Apple
+// Application Integration 2 Certification Authority") which must be included
+// in intermediates if it is not bundled with the certificate.
+func VerifyApplePushChain(cert *x509.Certificate, intermediates []*x509.Certificate) error {
+	return verifyApplePushChain(cert, intermediates, time.Now())
+}
+
+func verifyApplePushChain(cert *x509.Certificate, intermediates []*x509.Certificate, at time.Time) error {
+	roots, err := ParsePEMCertificates([]byte(appleRootCAPEM))
+	if err != nil {
+		return err
+	}
+	if _, err := VerifyChain(cert, intermediates, roots, at); err != nil {
+		return fmt.Errorf("certificate is not issued by Apple: %w", err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"testing"
+	"time"
 )
 
 func TestCmpAppleDeviceCAPublicKey(t *testing.T) {
@@ -44,3 +45,27 @@ func TestVerifyFromAppleDeviceCA(t *testing.T) {
 		t.Error("expected error verifying non-apple-device-signed cert")
 	}
 }
+
+func TestVerifyApplePushChain(t *testing.T) {
+	// The Developer ID CA is issued directly by the Apple Root CA,
+	// so it stands in for an Apple-issued certificate.
+	appleIssued, err := ReadPEMCertificateFile("testdata/apple_developer_id_ca.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := verifyApplePushChain(appleIssued, nil, at); err != nil {
+		t.Errorf("Apple-issued certificate: %s", err)
+	}
+
+	selfSigned, err := ReadPEMCertificateFile("testdata/mock_push_cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyApplePushChain(selfSigned, []*x509.Certificate{appleIssued}, at); err == nil {
+		t.Error("expected error verifying self-signed push certificate")
+	}
+	if err := VerifyApplePushChain(selfSigned, nil); err == nil {
+		t.Error("expected error verifying self-signed push certificate")
+	}
+}
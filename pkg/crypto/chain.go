@@ -0,0 +1,46 @@
+package crypto
+
+import (
+	"crypto/x509"
+	"errors"
+	"time"
+)
+
+// VerifyChain verifies that leaf chains to one of roots at the given time,
+// optionally through intermediates. If at is zero the current time is used.
+// Any extended key usage is accepted.
+func VerifyChain(leaf *x509.Certificate, intermediates, roots []*x509.Certificate, at time.Time) ([][]*x509.Certificate, error) {
+	opts := x509.VerifyOptions{
+		Roots:         certPool(roots),
+		Intermediates: certPool(intermediates),
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	return leaf.Verify(opts)
+}
+
+func certPool(certs []*x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool
+}
+
+// ReadPEMCertificateChain reads the certificates from each of the PEM files in
+// paths, in order, and returns them concatenated. Each file may contain one or
+// more certificates. List the leaf first so the chain can be presented in TLS.
+func ReadPEMCertificateChain(paths ...string) ([]*x509.Certificate, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no certificate files given")
+	}
+	var chain []*x509.Certificate
+	for _, path := range paths {
+		certs, err := ReadPEMCertificatesFile(path)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, certs...)
+	}
+	return chain, nil
+}
@@ -0,0 +1,112 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issueCert signs template with parent and parentKey and returns the parsed certificate.
+func issueCert(t *testing.T, template, parent *x509.Certificate, pub *rsa.PublicKey, parentKey *rsa.PrivateKey) *x509.Certificate {
+	t.Helper()
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// caTemplate returns a certificate template for a CA that may issue intermediates.
+func caTemplate(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	template, err := simpleTemplate(cn, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign
+	return template
+}
+
+func TestVerifyChain(t *testing.T) {
+	rootKey := mustRSAKey(t)
+	rootTemplate := caTemplate(t, "root")
+	root := issueCert(t, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+
+	intermediateKey := mustRSAKey(t)
+	intermediate := issueCert(t, caTemplate(t, "intermediate"), root, &intermediateKey.PublicKey, rootKey)
+
+	leafKey := mustRSAKey(t)
+	template, err := simpleTemplate("leaf", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := issueCert(t, template, intermediate, &leafKey.PublicKey, intermediateKey)
+
+	roots := []*x509.Certificate{root}
+	chains, err := VerifyChain(leaf, []*x509.Certificate{intermediate}, roots, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(chains[0]), 3; have != want {
+		t.Errorf("have chain length %d, want %d", have, want)
+	}
+
+	if _, err := VerifyChain(leaf, nil, roots, time.Now()); err == nil {
+		t.Error("expected error verifying without intermediate")
+	}
+	if _, err := VerifyChain(leaf, []*x509.Certificate{intermediate}, roots, time.Now().Add(48*time.Hour)); err == nil {
+		t.Error("expected error verifying after expiry")
+	}
+}
+
+func TestReadPEMCertificateChain(t *testing.T) {
+	rootKey := mustRSAKey(t)
+	rootTemplate := caTemplate(t, "root")
+	root := issueCert(t, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+
+	intermediateKey := mustRSAKey(t)
+	intermediate := issueCert(t, caTemplate(t, "intermediate"), root, &intermediateKey.PublicKey, rootKey)
+
+	template, err := simpleTemplate("leaf", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := issueCert(t, template, intermediate, &mustRSAKey(t).PublicKey, intermediateKey)
+
+	dir := t.TempDir()
+	want := []*x509.Certificate{leaf, intermediate, root}
+	var paths []string
+	for i, cert := range want {
+		path := filepath.Join(dir, fmt.Sprintf("%d.pem", i))
+		if err := WritePEMCertificateFile(cert, path); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	chain, err := ReadPEMCertificateChain(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(chain), len(want); have != want {
+		t.Fatalf("have %d certificates, want %d", have, want)
+	}
+	for i := range want {
+		if !chain[i].Equal(want[i]) {
+			t.Errorf("certificate %d: have %s, want %s", i, chain[i].Subject.CommonName, want[i].Subject.CommonName)
+		}
+	}
+
+	if _, err := ReadPEMCertificateChain(paths[0], filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("expected error reading missing file")
+	}
+}
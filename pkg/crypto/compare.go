@@ -0,0 +1,16 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+)
+
+// SecureCompare reports whether the shared secrets a and b are equal in
+// constant time. Unlike subtle.ConstantTimeCompare it does not return early
+// when the lengths differ: both inputs are hashed first, so the comparison
+// time does not reveal the length of the expected secret.
+func SecureCompare(a, b []byte) bool {
+	ha := sha256.Sum256(a)
+	hb := sha256.Sum256(b)
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
@@ -0,0 +1,23 @@
+package crypto
+
+import "testing"
+
+func TestSecureCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"secret", "secret", true},
+		{"", "", true},
+		{"secret", "Secret", false},
+		// inputs of different lengths are compared as fixed size
+		// digests rather than rejected early based on their length.
+		{"secret", "secret-but-longer", false},
+		{"secret", "", false},
+	}
+	for _, tt := range tests {
+		if have := SecureCompare([]byte(tt.a), []byte(tt.b)); have != tt.want {
+			t.Errorf("SecureCompare(%q, %q): have %v, want %v", tt.a, tt.b, have, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"time"
+)
+
+const crlPEMBlockType = "X509 CRL"
+
+// CreateCRL returns a DER encoded certificate revocation list of revoked,
+// signed by ca and caKey and valid until nextUpdate. The CRL number is derived
+// from the current time so that successive lists are increasing.
+func CreateCRL(ca *x509.Certificate, caKey crypto.Signer, revoked []pkix.RevokedCertificate, nextUpdate time.Time) ([]byte, error) {
+	if err := MatchSigner(ca, caKey); err != nil {
+		return nil, err
+	}
+	timeNow := time.Now()
+	template := &x509.RevocationList{
+		RevokedCertificates: revoked,
+		Number:              big.NewInt(timeNow.UnixNano()),
+		ThisUpdate:          timeNow,
+		NextUpdate:          nextUpdate,
+	}
+	return x509.CreateRevocationList(rand.Reader, template, ca, caKey)
+}
+
+// WritePEMCRLFile writes the DER encoded certificate revocation list crl to path as a PEM block.
+func WritePEMCRLFile(crl []byte, path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return pem.Encode(
+		file,
+		&pem.Block{
+			Type:  crlPEMBlockType,
+			Bytes: crl,
+		})
+}
@@ -0,0 +1,67 @@
+package crypto
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreateCRL(t *testing.T) {
+	caKey, ca, err := SimpleSelfSignedCA("micromdm-ca", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := GenerateRandomCertificateSerialNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked := []pkix.RevokedCertificate{{
+		SerialNumber:   serial,
+		RevocationTime: time.Now().UTC().Truncate(time.Second),
+	}}
+
+	der, err := CreateCRL(ca, caKey, revoked, time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("CRL not signed by CA: %s", err)
+	}
+	if have, want := len(crl.RevokedCertificates), 1; have != want {
+		t.Fatalf("have %d revoked certificates, want %d", have, want)
+	}
+	if have, want := crl.RevokedCertificates[0].SerialNumber, serial; have.Cmp(want) != 0 {
+		t.Errorf("have revoked serial %s, want %s", have, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.crl")
+	if err := WritePEMCRLFile(der, path); err != nil {
+		t.Fatal(err)
+	}
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != crlPEMBlockType {
+		t.Fatalf("expected %s PEM block", crlPEMBlockType)
+	}
+}
+
+func TestCreateCRLMismatchedKey(t *testing.T) {
+	_, ca, err := SimpleSelfSignedCA("micromdm-ca", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateCRL(ca, mustRSAKey(t), nil, time.Now().Add(time.Hour)); err == nil {
+		t.Error("expected error creating CRL with mismatched CA key")
+	}
+}
@@ -0,0 +1,97 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/micromdm/scep/v2/cryptoutil/x509util"
+)
+
+const csrPEMBlockType = "CERTIFICATE REQUEST"
+
+// GenerateCSR returns a DER encoded certificate signing request for key
+// with the given subject and DNS subject alternative names.
+func GenerateCSR(key crypto.Signer, subject pkix.Name, dnsNames []string) ([]byte, error) {
+	return GenerateCSRWithChallenge(key, subject, dnsNames, "")
+}
+
+// GenerateCSRWithChallenge is like GenerateCSR but also sets the
+// challengePassword attribute used by SCEP, unless challenge is empty.
+func GenerateCSRWithChallenge(key crypto.Signer, subject pkix.Name, dnsNames []string, challenge string) ([]byte, error) {
+	template := &x509util.CertificateRequest{
+		CertificateRequest: x509.CertificateRequest{
+			Subject:  subject,
+			DNSNames: dnsNames,
+		},
+		ChallengePassword: challenge,
+	}
+	return x509util.CreateCertificateRequest(rand.Reader, template, key)
+}
+
+// WritePEMCSRFile writes the DER encoded certificate signing request csr to path as a PEM block.
+func WritePEMCSRFile(csr []byte, path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return pem.Encode(
+		file,
+		&pem.Block{
+			Type:  csrPEMBlockType,
+			Bytes: csr,
+		})
+}
+
+// SignCSR issues a client authentication certificate for csr, valid for the
+// given number of days and signed by ca and caKey. The CSR signature is checked
+// first and the issued certificate carries the subject and subject alternative
+// names of the request. Its AuthorityKeyId is set to the SubjectKeyId of ca.
+func SignCSR(csr *x509.CertificateRequest, ca *x509.Certificate, caKey crypto.Signer, days int) (*x509.Certificate, error) {
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("check CSR signature: %w", err)
+	}
+	if err := MatchSigner(ca, caKey); err != nil {
+		return nil, err
+	}
+
+	notBefore, notAfter, err := validityWindow(days)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := GenerateRandomCertificateSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	ski, err := subjectKeyID(csr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               csr.Subject,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              csr.DNSNames,
+		EmailAddresses:        csr.EmailAddresses,
+		IPAddresses:           csr.IPAddresses,
+		URIs:                  csr.URIs,
+		SubjectKeyId:          ski,
+		AuthorityKeyId:        ca.SubjectKeyId,
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, ca, csr.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(certBytes)
+}
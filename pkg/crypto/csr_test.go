@@ -0,0 +1,140 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/micromdm/scep/v2/cryptoutil/x509util"
+)
+
+func TestGenerateCSR(t *testing.T) {
+	key := mustRSAKey(t)
+	subject := pkix.Name{CommonName: "device", Organization: []string{"MicroMDM"}}
+	dnsNames := []string{"device.example.com", "alt.example.com"}
+
+	der, err := GenerateCSRWithChallenge(key, subject, dnsNames, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Errorf("CSR signature: %s", err)
+	}
+	if have, want := csr.Subject.CommonName, subject.CommonName; have != want {
+		t.Errorf("have CN %s, want %s", have, want)
+	}
+	if have, want := csr.Subject.Organization, subject.Organization; !reflect.DeepEqual(have, want) {
+		t.Errorf("have O %v, want %v", have, want)
+	}
+	if have, want := csr.DNSNames, dnsNames; !reflect.DeepEqual(have, want) {
+		t.Errorf("have SANs %v, want %v", have, want)
+	}
+	challenge, err := x509util.ParseChallengePassword(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := challenge, "secret"; have != want {
+		t.Errorf("have challenge %s, want %s", have, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "csr.pem")
+	if err := WritePEMCSRFile(der, path); err != nil {
+		t.Fatal(err)
+	}
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != csrPEMBlockType {
+		t.Fatal("invalid CSR PEM block")
+	}
+}
+
+func TestSignCSR(t *testing.T) {
+	caKey, ca, err := SimpleSelfSignedCA("micromdm-ca", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject := pkix.Name{CommonName: "device", Organization: []string{"MicroMDM"}}
+	der, err := GenerateCSR(mustRSAKey(t), subject, []string{"device.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := SignCSR(csr, ca, caKey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyChain(cert, nil, []*x509.Certificate{ca}, time.Now()); err != nil {
+		t.Errorf("issued certificate does not chain to CA: %s", err)
+	}
+	if have, want := cert.Subject.String(), csr.Subject.String(); have != want {
+		t.Errorf("have subject %s, want %s", have, want)
+	}
+	if have, want := cert.DNSNames, csr.DNSNames; !reflect.DeepEqual(have, want) {
+		t.Errorf("have DNS names %v, want %v", have, want)
+	}
+	if !bytes.Equal(cert.AuthorityKeyId, ca.SubjectKeyId) {
+		t.Errorf("AuthorityKeyId %x does not match CA SubjectKeyId %x", cert.AuthorityKeyId, ca.SubjectKeyId)
+	}
+	if have, want := cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have ExtKeyUsage %v, want %v", have, want)
+	}
+	if cert.SerialNumber.Cmp(ca.SerialNumber) == 0 {
+		t.Error("issued certificate reuses the CA serial number")
+	}
+}
+
+func TestSignCSRBadSignature(t *testing.T) {
+	caKey, ca, err := SimpleSelfSignedCA("micromdm-ca", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := GenerateCSR(mustRSAKey(t), pkix.Name{CommonName: "device"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr.Signature[0] ^= 0xff
+
+	if _, err := SignCSR(csr, ca, caKey, 1); err == nil {
+		t.Error("expected error signing CSR with invalid signature")
+	}
+}
+
+func TestSignCSRInvalidDays(t *testing.T) {
+	caKey, ca, err := SimpleSelfSignedCA("micromdm-ca", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := GenerateCSR(mustRSAKey(t), pkix.Name{CommonName: "device"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignCSR(csr, ca, caKey, 0); err == nil {
+		t.Error("expected error signing CSR for 0 days")
+	}
+}
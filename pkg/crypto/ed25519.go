@@ -0,0 +1,45 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+)
+
+// Ed25519 keys are only appropriate for internal identities such as TLS
+// between services. APNs requires an RSA push certificate.
+
+// SimpleSelfSignedEd25519Keypair is like SimpleSelfSignedRSAKeypair but generates an Ed25519 key.
+func SimpleSelfSignedEd25519Keypair(cn string, days int) (key ed25519.PrivateKey, cert *x509.Certificate, err error) {
+	template, err := simpleTemplate(cn, days)
+	if err != nil {
+		return key, cert, err
+	}
+	_, key, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return key, cert, err
+	}
+	// Ed25519 keys can't be used for key encipherment.
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	cert, err = selfSign(template, key)
+	return key, cert, err
+}
+
+// ReadPEMEd25519KeyFile reads a PKCS#8 encoded Ed25519 private key from a PEM file.
+func ReadPEMEd25519KeyFile(path string) (ed25519.PrivateKey, error) {
+	key, err := ReadPEMPrivateKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("expecting Ed25519 private key, but got %T", key)
+	}
+	return edKey, nil
+}
+
+// WritePEMEd25519KeyFile writes key to path as a PKCS#8 PEM block.
+func WritePEMEd25519KeyFile(key ed25519.PrivateKey, path string) error {
+	return WritePEMPrivateKeyFile(key, path)
+}
@@ -0,0 +1,50 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"path/filepath"
+	"testing"
+)
+
+func TestEd25519(t *testing.T) {
+	key, cert, err := SimpleSelfSignedEd25519Keypair("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := MatchSigner(cert, key); err != nil {
+		t.Errorf("certificate does not match key: %s", err)
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		t.Errorf("self-signature does not verify: %s", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := WritePEMEd25519KeyFile(key, path); err != nil {
+		t.Fatal(err)
+	}
+	have, err := ReadPEMEd25519KeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !have.Equal(key) {
+		t.Error("Ed25519 key does not match")
+	}
+	signer, err := ReadPEMPrivateKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := signer.(ed25519.PrivateKey); !ok {
+		t.Errorf("have %T, want ed25519.PrivateKey", signer)
+	}
+
+	if _, err := ReadPEMRSAKeyFile(path); err == nil {
+		t.Error("expected error reading Ed25519 key as RSA")
+	}
+	rsaPath := filepath.Join(t.TempDir(), "rsa.pem")
+	if err := WritePEMPrivateKeyFile(mustRSAKey(t), rsaPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPEMEd25519KeyFile(rsaPath); err == nil {
+		t.Error("expected error reading RSA key as Ed25519")
+	}
+}
@@ -0,0 +1,41 @@
+package crypto
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+// ExpiryChecker checks certificate expiry against a configurable clock.
+type ExpiryChecker struct {
+	// Now returns the current time. Defaults to time.Now if nil.
+	Now func() time.Time
+}
+
+func (c *ExpiryChecker) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+// ExpiresWithin reports whether cert expires within d of the current time.
+// Certificates that have already expired are reported as expiring.
+func (c *ExpiryChecker) ExpiresWithin(cert *x509.Certificate, d time.Duration) bool {
+	return !c.now().Add(d).Before(cert.NotAfter)
+}
+
+// DaysUntilExpiry returns the number of whole days until cert expires.
+// The result is negative if cert has already expired.
+func (c *ExpiryChecker) DaysUntilExpiry(cert *x509.Certificate) int {
+	return int(cert.NotAfter.Sub(c.now()) / (24 * time.Hour))
+}
+
+// ExpiresWithin reports whether cert expires within d of the current time.
+func ExpiresWithin(cert *x509.Certificate, d time.Duration) bool {
+	return (&ExpiryChecker{}).ExpiresWithin(cert, d)
+}
+
+// DaysUntilExpiry returns the number of whole days until cert expires.
+func DaysUntilExpiry(cert *x509.Certificate) int {
+	return (&ExpiryChecker{}).DaysUntilExpiry(cert)
+}
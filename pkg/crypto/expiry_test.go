@@ -0,0 +1,31 @@
+package crypto
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestExpiryChecker(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{NotAfter: now.Add(12*24*time.Hour + time.Hour)}
+	c := &ExpiryChecker{Now: func() time.Time { return now }}
+
+	if have, want := c.DaysUntilExpiry(cert), 12; have != want {
+		t.Errorf("have %d days until expiry, want %d", have, want)
+	}
+	if c.ExpiresWithin(cert, 12*24*time.Hour) {
+		t.Error("certificate should not expire within 12 days")
+	}
+	if !c.ExpiresWithin(cert, 13*24*time.Hour) {
+		t.Error("certificate should expire within 13 days")
+	}
+
+	expired := &ExpiryChecker{Now: func() time.Time { return now.Add(15 * 24 * time.Hour) }}
+	if have, want := expired.DaysUntilExpiry(cert), -2; have != want {
+		t.Errorf("have %d days until expiry, want %d", have, want)
+	}
+	if !expired.ExpiresWithin(cert, 0) {
+		t.Error("expired certificate should be reported as expiring")
+	}
+}
@@ -0,0 +1,48 @@
+package crypto
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// SHA256Fingerprint returns the SHA-256 fingerprint of the DER encoded cert
+// as colon-separated uppercase hex, matching `openssl x509 -fingerprint -sha256`.
+func SHA256Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return formatFingerprint(sum[:])
+}
+
+// SHA1Fingerprint returns the SHA-1 fingerprint of the DER encoded cert
+// as colon-separated uppercase hex. It is only meant for comparison with
+// legacy tooling; prefer SHA256Fingerprint.
+func SHA1Fingerprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	return formatFingerprint(sum[:])
+}
+
+// ParseFingerprint normalizes a user-supplied hex fingerprint, with or without
+// colons and in either case, to the format returned by SHA256Fingerprint.
+func ParseFingerprint(fingerprint string) (string, error) {
+	s := strings.TrimSpace(fingerprint)
+	s = strings.ReplaceAll(s, ":", "")
+	if s == "" {
+		return "", errors.New("empty fingerprint")
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return "", errors.New("fingerprint must be hex encoded: " + fingerprint)
+	}
+	return formatFingerprint(b), nil
+}
+
+func formatFingerprint(b []byte) string {
+	parts := make([]string, len(b))
+	for i := range b {
+		parts[i] = strings.ToUpper(hex.EncodeToString(b[i : i+1]))
+	}
+	return strings.Join(parts, ":")
+}
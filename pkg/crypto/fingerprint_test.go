@@ -0,0 +1,46 @@
+package crypto
+
+import (
+	"testing"
+)
+
+func TestFingerprints(t *testing.T) {
+	cert, err := ReadPEMCertificateFile("testdata/mock_push_cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// openssl x509 -in testdata/mock_push_cert.pem -noout -fingerprint -sha256
+	if have, want := SHA256Fingerprint(cert), "6C:D4:58:DB:78:82:C7:19:5C:AA:D6:AE:C8:01:0A:25:89:A4:3C:37:D9:90:6B:21:57:71:E4:FA:A3:BC:BE:8E"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+	// openssl x509 -in testdata/mock_push_cert.pem -noout -fingerprint -sha1
+	if have, want := SHA1Fingerprint(cert), "6E:85:53:78:08:BA:EB:1D:2E:AF:09:67:D2:8A:9E:6A:9B:A2:F2:C9"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	want := "6E:85:53:78:08:BA:EB:1D:2E:AF:09:67:D2:8A:9E:6A:9B:A2:F2:C9"
+	for _, in := range []string{
+		want,
+		"6e:85:53:78:08:ba:eb:1d:2e:af:09:67:d2:8a:9e:6a:9b:a2:f2:c9",
+		"6E85537808BAEB1D2EAF0967D28A9E6A9BA2F2C9",
+		" 6e85537808baeb1d2eaf0967d28a9e6a9ba2f2c9\n",
+	} {
+		have, err := ParseFingerprint(in)
+		if err != nil {
+			t.Errorf("%q: %s", in, err)
+			continue
+		}
+		if have != want {
+			t.Errorf("%q: have %s, want %s", in, have, want)
+		}
+	}
+
+	for _, in := range []string{"", "zz:zz", "6E:8"} {
+		if _, err := ParseFingerprint(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
@@ -1,16 +1,25 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"encoding/base64"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/big"
+	"net"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -19,43 +28,270 @@ import (
 )
 
 func GenerateRandomCertificateSerialNumber() (*big.Int, error) {
+	return generateSerialNumber(rand.Reader)
+}
+
+// generateSerialNumber returns a 128 bit serial number read from r.
+func generateSerialNumber(r io.Reader) (*big.Int, error) {
 	limit := new(big.Int).Lsh(big.NewInt(1), 128)
-	return rand.Int(rand.Reader, limit)
+	return rand.Int(r, limit)
 }
 
 func SimpleSelfSignedRSAKeypair(cn string, days int) (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
-	key, err = rsa.GenerateKey(rand.Reader, 2048)
+	return SimpleSelfSignedRSAKeypairWithSubject(pkix.Name{CommonName: cn}, days)
+}
+
+// SimpleSelfSignedRSAKeypairWithSubject is like SimpleSelfSignedRSAKeypair but
+// uses subject as the certificate subject, for PKI policies which require
+// fields such as Organization, OrganizationalUnit or Country.
+// The subject common name is used as the DNS subject alternative name.
+func SimpleSelfSignedRSAKeypairWithSubject(subject pkix.Name, days int) (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
+	return selfSignedRSAKeypair(rand.Reader, subject, CertificateOptions{Bits: 2048, DNSNames: []string{subject.CommonName}}, days)
+}
+
+// SimpleSelfSignedRSAKeypairRand is like SimpleSelfSignedRSAKeypair but reads
+// the certificate serial number and key generation randomness from r, so that a
+// seeded reader produces stable serial numbers in tests. Recent Go versions
+// deliberately add randomness to RSA key generation, so the key itself may
+// still differ between calls.
+//
+// Production callers must use crypto/rand.Reader (or SimpleSelfSignedRSAKeypair).
+func SimpleSelfSignedRSAKeypairRand(r io.Reader, cn string, days int) (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
+	return selfSignedRSAKeypair(r, pkix.Name{CommonName: cn}, CertificateOptions{Bits: 2048, DNSNames: []string{cn}}, days)
+}
+
+// SimpleSelfSignedRSAKeypairWithBits is like SimpleSelfSignedRSAKeypair but
+// generates an RSA key of the given size. Only 2048, 3072 and 4096 bit keys are allowed.
+func SimpleSelfSignedRSAKeypairWithBits(cn string, bits, days int) (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
+	return selfSignedRSAKeypair(rand.Reader, pkix.Name{CommonName: cn}, CertificateOptions{Bits: bits, DNSNames: []string{cn}}, days)
+}
+
+// SimpleSelfSignedRSAKeypairWithSANs is like SimpleSelfSignedRSAKeypair but sets
+// the DNS and IP subject alternative names of the certificate. The common name
+// is not added to the SANs unless it is included in dnsNames.
+func SimpleSelfSignedRSAKeypairWithSANs(cn string, dnsNames []string, ipAddresses []net.IP, days int) (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
+	return SimpleSelfSignedRSAKeypairWithOptions(cn, CertificateOptions{DNSNames: dnsNames, IPAddresses: ipAddresses}, days)
+}
+
+// CertificateOptions customizes the certificates generated by
+// SimpleSelfSignedRSAKeypairWithOptions. The zero value generates a 2048 bit key
+// and a server authentication certificate without subject alternative names.
+type CertificateOptions struct {
+	// Bits is the RSA key size. Only 2048, 3072 and 4096 are allowed. Defaults to 2048.
+	Bits int
+
+	// Subject alternative names. The common name is not added automatically.
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	URIs           []*url.URL
+
+	// ExtKeyUsage overrides the default of x509.ExtKeyUsageServerAuth, e.g. with
+	// x509.ExtKeyUsageEmailProtection for S/MIME user certificates.
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+// SimpleSelfSignedRSAKeypairWithOptions is like SimpleSelfSignedRSAKeypair but
+// generates the key and certificate according to opts.
+func SimpleSelfSignedRSAKeypairWithOptions(cn string, opts CertificateOptions, days int) (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
+	if opts.Bits == 0 {
+		opts.Bits = 2048
+	}
+	return selfSignedRSAKeypair(rand.Reader, pkix.Name{CommonName: cn}, opts, days)
+}
+
+func selfSignedRSAKeypair(r io.Reader, subject pkix.Name, opts CertificateOptions, days int) (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
+	switch opts.Bits {
+	case 2048, 3072, 4096:
+	default:
+		return key, cert, fmt.Errorf("unsupported RSA key size %d, must be one of 2048, 3072 or 4096", opts.Bits)
+	}
+
+	template, err := simpleTemplateRand(r, subject.CommonName, days)
 	if err != nil {
 		return key, cert, err
 	}
+	key, err = rsa.GenerateKey(r, opts.Bits)
+	if err != nil {
+		return key, cert, err
+	}
+	template.Subject = subject
+	template.DNSNames = opts.DNSNames
+	template.IPAddresses = opts.IPAddresses
+	template.EmailAddresses = opts.EmailAddresses
+	template.URIs = opts.URIs
+	if opts.ExtKeyUsage != nil {
+		template.ExtKeyUsage = opts.ExtKeyUsage
+	}
+	cert, err = selfSign(template, key)
+	return key, cert, err
+}
 
-	serialNumber, err := GenerateRandomCertificateSerialNumber()
+// SimpleSelfSignedECDSAKeypair is like SimpleSelfSignedRSAKeypair but generates
+// an ECDSA key on the given curve.
+func SimpleSelfSignedECDSAKeypair(cn string, curve elliptic.Curve, days int) (key *ecdsa.PrivateKey, cert *x509.Certificate, err error) {
+	template, err := simpleTemplate(cn, days)
 	if err != nil {
 		return key, cert, err
 	}
-	timeNow := time.Now()
+	key, err = ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return key, cert, err
+	}
+	template.SignatureAlgorithm, err = ecdsaSignatureAlgorithm(curve)
+	if err != nil {
+		return key, cert, err
+	}
+	cert, err = selfSign(template, key)
+	return key, cert, err
+}
+
+// SimpleSelfSignedCA generates an RSA key and a self-signed CA certificate
+// suitable for issuing leaf certificates, such as SCEP device identities.
+// The CA may not issue intermediate CAs.
+func SimpleSelfSignedCA(cn string, days int) (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
+	template, err := simpleTemplate(cn, days)
+	if err != nil {
+		return key, cert, err
+	}
+	key, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return key, cert, err
+	}
+	template.IsCA = true
+	template.MaxPathLen = 0
+	template.MaxPathLenZero = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = nil
+	template.DNSNames = nil
+	cert, err = selfSign(template, key)
+	return key, cert, err
+}
+
+func ecdsaSignatureAlgorithm(curve elliptic.Curve) (x509.SignatureAlgorithm, error) {
+	switch curve {
+	case elliptic.P256():
+		return x509.ECDSAWithSHA256, nil
+	case elliptic.P384():
+		return x509.ECDSAWithSHA384, nil
+	case elliptic.P521():
+		return x509.ECDSAWithSHA512, nil
+	default:
+		return x509.UnknownSignatureAlgorithm, errors.New("unsupported elliptic curve")
+	}
+}
+
+// simpleTemplate returns the leaf certificate template shared by the SimpleSelfSigned* functions.
+func simpleTemplate(cn string, days int) (*x509.Certificate, error) {
+	return simpleTemplateRand(rand.Reader, cn, days)
+}
+
+// simpleTemplateRand is like simpleTemplate but reads the serial number from r.
+func simpleTemplateRand(r io.Reader, cn string, days int) (*x509.Certificate, error) {
+	notBefore, notAfter, err := validityWindow(days)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := generateSerialNumber(r)
+	if err != nil {
+		return nil, err
+	}
 	template := x509.Certificate{
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
 			CommonName: cn,
 		},
-		NotBefore:             timeNow,
-		NotAfter:              timeNow.Add(time.Duration(days) * 24 * time.Hour),
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
 		DNSNames:              []string{cn},
 	}
-	certBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	return &template, nil
+}
+
+// certificateBackdate is how far NotBefore of generated certificates is set in
+// the past, to tolerate clock skew between this host and relying parties.
+const certificateBackdate = 5 * time.Minute
+
+// validityWindow returns the validity period of a certificate issued now for days.
+func validityWindow(days int) (notBefore, notAfter time.Time, err error) {
+	if days <= 0 {
+		return notBefore, notAfter, errors.New("certificate validity must be positive")
+	}
+	timeNow := time.Now()
+	return timeNow.Add(-certificateBackdate), timeNow.Add(time.Duration(days) * 24 * time.Hour), nil
+}
+
+// selfSign signs template with key. If template has no SubjectKeyId one is
+// derived from the public key, and the AuthorityKeyId is set to match.
+func selfSign(template *x509.Certificate, key crypto.Signer) (*x509.Certificate, error) {
+	if len(template.SubjectKeyId) == 0 {
+		ski, err := subjectKeyID(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		template.SubjectKeyId = ski
+	}
+	template.AuthorityKeyId = template.SubjectKeyId
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
 	if err != nil {
-		return key, cert, err
+		return nil, err
 	}
-	cert, err = x509.ParseCertificate(certBytes)
+	return x509.ParseCertificate(certBytes)
+}
+
+// RenewSelfSigned re-issues the self-signed cert with the same key, a new serial
+// number and a validity window of days starting now. The subject, subject
+// alternative names, usages and basic constraints are copied from cert, and the
+// SubjectKeyId is preserved so the public key identity stays stable.
+func RenewSelfSigned(cert *x509.Certificate, key crypto.Signer, days int) (*x509.Certificate, error) {
+	if err := MatchSigner(cert, key); err != nil {
+		return nil, err
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		return nil, fmt.Errorf("certificate is not self-signed: %w", err)
+	}
+
+	template, err := simpleTemplate(cert.Subject.CommonName, days)
 	if err != nil {
-		return key, cert, err
+		return nil, err
 	}
+	template.RawSubject = cert.RawSubject
+	template.Subject = cert.Subject
+	template.DNSNames = cert.DNSNames
+	template.EmailAddresses = cert.EmailAddresses
+	template.IPAddresses = cert.IPAddresses
+	template.URIs = cert.URIs
+	template.KeyUsage = cert.KeyUsage
+	template.ExtKeyUsage = cert.ExtKeyUsage
+	template.UnknownExtKeyUsage = cert.UnknownExtKeyUsage
+	template.BasicConstraintsValid = cert.BasicConstraintsValid
+	template.IsCA = cert.IsCA
+	template.MaxPathLen = cert.MaxPathLen
+	template.MaxPathLenZero = cert.MaxPathLenZero
+	template.SubjectKeyId = cert.SubjectKeyId
+	return selfSign(template, key)
+}
 
-	return key, cert, err
+// subjectKeyID returns the SHA-1 hash of the subjectPublicKey bit string of pub,
+// as described in RFC 5280, Section 4.2.1.2.
+func subjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(spki.PublicKey.Bytes)
+	return sum[:], nil
 }
 
 func ReadPEMCertificateFile(path string) (*x509.Certificate, error) {
@@ -63,70 +299,317 @@ func ReadPEMCertificateFile(path string) (*x509.Certificate, error) {
 	if err != nil {
 		return nil, err
 	}
+	return onlyCertificate(certs)
+}
+
+// ReadCertificateFile reads a single certificate from a PEM or DER encoded file.
+func ReadCertificateFile(path string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		return x509.ParseCertificate(data)
+	}
+	certs, err := ParsePEMCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s in %s", err, path)
+	}
+	return onlyCertificate(certs)
+}
+
+func onlyCertificate(certs []*x509.Certificate) (*x509.Certificate, error) {
 	if len(certs) != 1 {
 		return nil, errors.New("incorrect number of certificates")
 	}
 	return certs[0], nil
 }
 
+// CertificateToBase64 returns the standard base64 encoding of the certificate's
+// DER bytes, suitable for embedding in JSON.
+func CertificateToBase64(cert *x509.Certificate) string {
+	return base64.StdEncoding.EncodeToString(cert.Raw)
+}
+
+// CertificateFromBase64 parses a certificate from base64 encoded DER.
+// Whitespace, including line breaks, is ignored, and s may also be a PEM
+// "CERTIFICATE" block.
+func CertificateFromBase64(s string) (*x509.Certificate, error) {
+	if strings.HasPrefix(strings.TrimSpace(s), "-----BEGIN") {
+		certs, err := ParsePEMCertificates([]byte(s))
+		if err != nil {
+			return nil, err
+		}
+		return onlyCertificate(certs)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		return nil, fmt.Errorf("decoding base64 certificate: %w", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
 const (
-	rsaPrivateKeyPEMBlockType = "RSA PRIVATE KEY"
-	certificatePEMBlockType   = "CERTIFICATE"
+	rsaPrivateKeyPEMBlockType   = "RSA PRIVATE KEY"
+	pkcs8PrivateKeyPEMBlockType = "PRIVATE KEY"
+	certificatePEMBlockType     = "CERTIFICATE"
 )
 
+// ReadPEMCertificatesFile reads all certificates from a PEM file.
+// Non-certificate PEM blocks and any text surrounding them are skipped.
 func ReadPEMCertificatesFile(path string) ([]*x509.Certificate, error) {
 	pemData, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	certs, err := ParsePEMCertificates(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("%s in %s", err, path)
+	}
+	return certs, nil
+}
+
+// ParsePEMCertificates parses all certificates from PEM encoded pemData.
+// Non-certificate PEM blocks and any text surrounding them are skipped.
+func ParsePEMCertificates(pemData []byte) ([]*x509.Certificate, error) {
 	var asn1data []byte
 	rest := pemData
 	for {
 		var block *pem.Block
 		block, rest = pem.Decode(rest)
-		if block == nil || block.Type != certificatePEMBlockType {
-			return nil, errors.New("failed to decode PEM block containing certificate")
-		}
-		asn1data = append(asn1data, block.Bytes...)
-		if len(rest) == 0 {
+		if block == nil {
 			break
 		}
+		if block.Type == certificatePEMBlockType {
+			asn1data = append(asn1data, block.Bytes...)
+		}
+	}
+	if len(asn1data) == 0 {
+		return nil, fmt.Errorf("no PEM blocks of type %s found", certificatePEMBlockType)
 	}
 	return x509.ParseCertificates(asn1data)
 }
 
+var (
+	// ErrEncryptedKeyNeedsPassword is returned when reading an encrypted key without a password.
+	ErrEncryptedKeyNeedsPassword = errors.New("no supplied password for encrypted PEM")
+	// ErrUnexpectedPassword is returned when a password is supplied for an unencrypted key.
+	ErrUnexpectedPassword = errors.New("supplied PEM password, but not encrypted")
+)
+
 func ReadPEMRSAKeyFile(path string) (*rsa.PrivateKey, error) {
 	return ReadEncryptedPEMRSAKeyFile(path, nil)
 }
 
+// ReadEncryptedPEMRSAKeyFile reads an RSA private key from a PEM file.
+// See ParsePEMRSAKey.
 func ReadEncryptedPEMRSAKeyFile(path string, password []byte) (*rsa.PrivateKey, error) {
+	key, _, err := ReadEncryptedPEMRSAKeyFileInfo(path, password)
+	return key, err
+}
+
+// ReadEncryptedPEMRSAKeyFileInfo is like ReadEncryptedPEMRSAKeyFile but also
+// returns the name of the cipher the key was encrypted with, such as
+// "DES-EDE3-CBC" or "AES-256-CBC", or "" if the key is not encrypted.
+// Use IsDeprecatedKeyCipher to decide whether to ask for re-encryption.
+func ReadEncryptedPEMRSAKeyFileInfo(path string, password []byte) (key *rsa.PrivateKey, cipherName string, err error) {
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	signer, cipherName, err := parseEncryptedPEMPrivateKey(pemData, password)
+	if err != nil {
+		return nil, "", err
+	}
+	key, err = assertRSAKey(signer)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, cipherName, nil
+}
+
+// IsDeprecatedKeyCipher reports whether cipherName, as returned by
+// ReadEncryptedPEMRSAKeyFileInfo, is a weak DES based cipher.
+func IsDeprecatedKeyCipher(cipherName string) bool {
+	return cipherName == "DES-CBC" || cipherName == "DES-EDE3-CBC"
+}
+
+// ParsePEMRSAKey parses an RSA private key from PEM encoded pemData.
+// PKCS#1 ("RSA PRIVATE KEY"), PKCS#8 ("PRIVATE KEY") and encrypted
+// PKCS#8 ("ENCRYPTED PRIVATE KEY") blocks are supported. password must
+// be nil if the key is not encrypted.
+func ParsePEMRSAKey(pemData []byte, password []byte) (*rsa.PrivateKey, error) {
+	key, _, err := parseEncryptedPEMPrivateKey(pemData, password)
+	if err != nil {
+		return nil, err
+	}
+	return assertRSAKey(key)
+}
+
+// ReadPEMPrivateKeyFile reads a PKCS#1 or PKCS#8 private key from a PEM file.
+// Unlike ReadPEMRSAKeyFile, PKCS#8 keys of any supported type are returned.
+func ReadPEMPrivateKeyFile(path string) (crypto.Signer, error) {
+	return readEncryptedPEMPrivateKeyFile(path, nil)
+}
+
+// ReadPEMRSAKeyFileFunc is like ReadEncryptedPEMRSAKeyFile but only calls
+// getPassword if the key turns out to be encrypted. Errors returned by
+// getPassword are returned unchanged.
+func ReadPEMRSAKeyFileFunc(path string, getPassword func() ([]byte, error)) (*rsa.PrivateKey, error) {
 	pemData, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	key, _, err := decodePEMPrivateKey(pemData, getPassword)
+	if err != nil {
+		return nil, err
+	}
+	return assertRSAKey(key)
+}
 
-	pemBlock, _ := pem.Decode(pemData)
-	if pemBlock == nil {
-		return nil, errors.New("PEM decode failed")
+func assertRSAKey(key crypto.Signer) (*rsa.PrivateKey, error) {
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("expecting RSA private key, but got %T", key)
 	}
-	if pemBlock.Type != rsaPrivateKeyPEMBlockType {
-		return nil, fmt.Errorf("expecting PEM type of %s, but got %s", rsaPrivateKeyPEMBlockType, pemBlock.Type)
+	return rsaKey, nil
+}
+
+func readEncryptedPEMPrivateKeyFile(path string, password []byte) (crypto.Signer, error) {
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
+	key, _, err := parseEncryptedPEMPrivateKey(pemData, password)
+	return key, err
+}
 
-	if x509.IsEncryptedPEMBlock(pemBlock) {
-		if password == nil {
-			return nil, errors.New("no supplied password for encrypted PEM")
+func parseEncryptedPEMPrivateKey(pemData []byte, password []byte) (crypto.Signer, string, error) {
+	var getPassword func() ([]byte, error)
+	if password != nil {
+		getPassword = func() ([]byte, error) { return password, nil }
+	}
+	key, cipherName, err := decodePEMPrivateKey(pemData, getPassword)
+	if err != nil {
+		return nil, "", err
+	}
+	if cipherName == "" && password != nil {
+		return nil, "", ErrUnexpectedPassword
+	}
+	return key, cipherName, nil
+}
+
+// isPrivateKeyPEMBlockType reports whether PEM blocks of type t contain a private key.
+func isPrivateKeyPEMBlockType(t string) bool {
+	return t == rsaPrivateKeyPEMBlockType || t == pkcs8PrivateKeyPEMBlockType || t == encryptedPKCS8PrivateKeyPEMBlockType
+}
+
+// decodePEMPrivateKey decodes the first private key PEM block of pemData,
+// skipping any other blocks such as certificates.
+// getPassword is only called if the key is encrypted, in which case the name of
+// the cipher is returned as cipherName.
+func decodePEMPrivateKey(pemData []byte, getPassword func() ([]byte, error)) (key crypto.Signer, cipherName string, err error) {
+	pemBlock, err := findPEMPrivateKeyBlock(pemData)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch {
+	case pemBlock.Type == encryptedPKCS8PrivateKeyPEMBlockType:
+		password, err := passwordFrom(getPassword)
+		if err != nil {
+			return nil, "", err
+		}
+		derBytes, cipherName, err := decryptPKCS8(pemBlock.Bytes, password)
+		if err != nil {
+			return nil, "", err
+		}
+		key, err := parsePrivateKey(pkcs8PrivateKeyPEMBlockType, derBytes)
+		if err != nil {
+			// a wrong password can occasionally produce valid padding
+			return nil, "", x509.IncorrectPasswordError
+		}
+		return key, cipherName, nil
+	case x509.IsEncryptedPEMBlock(pemBlock):
+		password, err := passwordFrom(getPassword)
+		if err != nil {
+			return nil, "", err
 		}
 		derBytes, err := x509.DecryptPEMBlock(pemBlock, password)
 		if err != nil {
-			return nil, err
+			return nil, "", err
+		}
+		key, err := parsePrivateKey(pemBlock.Type, derBytes)
+		if err != nil {
+			return nil, "", err
+		}
+		// DEK-Info is "<cipher>,<hex IV>"
+		cipherName := strings.SplitN(pemBlock.Headers["DEK-Info"], ",", 2)[0]
+		return key, cipherName, nil
+	default:
+		key, err := parsePrivateKey(pemBlock.Type, pemBlock.Bytes)
+		return key, "", err
+	}
+}
+
+// findPEMPrivateKeyBlock returns the first private key PEM block of pemData.
+func findPEMPrivateKeyBlock(pemData []byte) (*pem.Block, error) {
+	var types []string
+	rest := pemData
+	for {
+		var pemBlock *pem.Block
+		pemBlock, rest = pem.Decode(rest)
+		if pemBlock == nil {
+			break
+		}
+		if isPrivateKeyPEMBlockType(pemBlock.Type) {
+			return pemBlock, nil
 		}
-		return x509.ParsePKCS1PrivateKey(derBytes)
-	} else if password != nil {
-		return nil, errors.New("supplied PEM password, but not encrypted")
+		types = append(types, pemBlock.Type)
+	}
+	if len(types) == 0 {
+		return nil, errors.New("PEM decode failed")
+	}
+	return nil, fmt.Errorf("expecting PEM type of %s, %s or %s, but got %s",
+		rsaPrivateKeyPEMBlockType, pkcs8PrivateKeyPEMBlockType, encryptedPKCS8PrivateKeyPEMBlockType, strings.Join(types, ", "))
+}
+
+// IsPEMKeyEncrypted reports whether the first private key in the PEM file at
+// path is encrypted, either as a legacy encrypted PEM block or as an encrypted
+// PKCS#8 key. The key itself is not decrypted or parsed.
+func IsPEMKeyEncrypted(path string) (bool, error) {
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	pemBlock, err := findPEMPrivateKeyBlock(pemData)
+	if err != nil {
+		return false, err
 	}
+	return pemBlock.Type == encryptedPKCS8PrivateKeyPEMBlockType || x509.IsEncryptedPEMBlock(pemBlock), nil
+}
 
-	return x509.ParsePKCS1PrivateKey(pemBlock.Bytes)
+func passwordFrom(getPassword func() ([]byte, error)) ([]byte, error) {
+	if getPassword == nil {
+		return nil, ErrEncryptedKeyNeedsPassword
+	}
+	return getPassword()
+}
+
+// parsePrivateKey parses DER key bytes according to the PEM block type they were stored in.
+func parsePrivateKey(blockType string, der []byte) (crypto.Signer, error) {
+	if blockType == rsaPrivateKeyPEMBlockType {
+		return x509.ParsePKCS1PrivateKey(der)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported PKCS#8 private key type %T", key)
+	}
+	return signer, nil
 }
 
 func WritePEMCertificateFile(cert *x509.Certificate, path string) error {
@@ -136,79 +619,441 @@ func WritePEMCertificateFile(cert *x509.Certificate, path string) error {
 	}
 	defer file.Close()
 
+	return WritePEMCertificate(file, cert)
+}
+
+// WritePEMCertificate writes cert to w as a PEM block.
+func WritePEMCertificate(w io.Writer, cert *x509.Certificate) error {
 	return pem.Encode(
-		file,
+		w,
 		&pem.Block{
 			Type:  certificatePEMBlockType,
 			Bytes: cert.Raw,
 		})
 }
 
+// WritePEMCertificateFileCRLF is like WritePEMCertificateFile but writes CRLF
+// line endings, for Windows tools that can't read LF-only PEM files.
+func WritePEMCertificateFileCRLF(cert *x509.Certificate, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return WritePEMCertificateCRLF(file, cert)
+}
+
+// WritePEMCertificateCRLF is like WritePEMCertificate but writes CRLF line endings.
+func WritePEMCertificateCRLF(w io.Writer, cert *x509.Certificate) error {
+	// pem.Encode only emits LF line endings.
+	pemData := pem.EncodeToMemory(&pem.Block{
+		Type:  certificatePEMBlockType,
+		Bytes: cert.Raw,
+	})
+	_, err := w.Write(bytes.ReplaceAll(pemData, []byte("\n"), []byte("\r\n")))
+	return err
+}
+
+// WritePEMCertificatesFile writes certs to path as consecutive PEM blocks, in order.
+func WritePEMCertificatesFile(certs []*x509.Certificate, path string) error {
+	if len(certs) == 0 {
+		return errors.New("no certificates to write")
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return WritePEMCertificates(file, certs)
+}
+
+// WritePEMCertificates writes certs to w as consecutive PEM blocks, in order.
+func WritePEMCertificates(w io.Writer, certs []*x509.Certificate) error {
+	if len(certs) == 0 {
+		return errors.New("no certificates to write")
+	}
+	for _, cert := range certs {
+		if err := WritePEMCertificate(w, cert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyFileMode is the permission of private key files written by this package.
+// Before it was introduced, key files were created with 0700.
+const keyFileMode os.FileMode = 0600
+
+// WritePEMRSAKeyFile writes key to path as a PKCS#1 PEM block.
+// The file is only readable and writable by its owner (0600).
 func WritePEMRSAKeyFile(key *rsa.PrivateKey, path string) error {
-	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0700)
+	return WritePEMRSAKeyFileMode(key, path, keyFileMode)
+}
+
+// WritePEMRSAKeyFileMode is like WritePEMRSAKeyFile but sets the permissions
+// of the file to mode, regardless of the umask or the mode of an existing file.
+func WritePEMRSAKeyFileMode(key *rsa.PrivateKey, path string, mode os.FileMode) error {
+	file, err := createKeyFile(path, mode)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
+	return WritePEMRSAKey(file, key)
+}
+
+// createKeyFile creates or truncates the file at path and sets its permissions to mode.
+func createKeyFile(path string, mode os.FileMode) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(mode); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// WritePEMRSAKey writes key to w as a PKCS#1 PEM block.
+func WritePEMRSAKey(w io.Writer, key *rsa.PrivateKey) error {
 	return pem.Encode(
-		file,
+		w,
 		&pem.Block{
 			Type:  rsaPrivateKeyPEMBlockType,
 			Bytes: x509.MarshalPKCS1PrivateKey(key),
 		})
 }
 
+// WritePEMPrivateKeyFile writes key to path as a PKCS#8 PEM block.
+// The file is only readable and writable by its owner (0600).
+func WritePEMPrivateKeyFile(key crypto.Signer, path string) error {
+	file, err := createKeyFile(path, keyFileMode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return WritePEMPrivateKey(file, key)
+}
+
+// WritePEMPrivateKey writes key to w as a PKCS#8 PEM block.
+func WritePEMPrivateKey(w io.Writer, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return pem.Encode(
+		w,
+		&pem.Block{
+			Type:  pkcs8PrivateKeyPEMBlockType,
+			Bytes: der,
+		})
+}
+
+// WriteEncryptedPEMRSAKeyFile writes key to path as a 3DES encrypted PKCS#1 PEM block.
+//
+// Deprecated: 3DES is weak and legacy PEM encryption is rejected by newer
+// OpenSSL versions. Use WriteEncryptedPKCS8KeyFile, or
+// WriteEncryptedPEMRSAKeyFileWithCipher with x509.PEMCipherAES256 if a
+// PKCS#1 key is required.
 func WriteEncryptedPEMRSAKeyFile(key *rsa.PrivateKey, password []byte, path string) error {
-	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0700)
+	return WriteEncryptedPEMRSAKeyFileWithCipher(key, password, path, x509.PEMCipher3DES)
+}
+
+// WriteEncryptedPEMRSAKeyFileWithCipher writes key to path as a PKCS#1 PEM
+// block encrypted with the given legacy PEM cipher.
+func WriteEncryptedPEMRSAKeyFileWithCipher(key *rsa.PrivateKey, password []byte, path string, cipher x509.PEMCipher) error {
+	if err := checkPEMCipher(cipher); err != nil {
+		return err
+	}
+	file, err := createKeyFile(path, keyFileMode)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
+	return WriteEncryptedPEMRSAKeyWithCipher(file, key, password, cipher)
+}
+
+// WriteEncryptedPEMRSAKey writes key to w as a 3DES encrypted PKCS#1 PEM block.
+//
+// Deprecated: 3DES is weak and legacy PEM encryption is rejected by newer
+// OpenSSL versions. Use WriteEncryptedPKCS8Key instead.
+func WriteEncryptedPEMRSAKey(w io.Writer, key *rsa.PrivateKey, password []byte) error {
+	return WriteEncryptedPEMRSAKeyWithCipher(w, key, password, x509.PEMCipher3DES)
+}
+
+// WriteEncryptedPEMRSAKeyWithCipher writes key to w as a PKCS#1 PEM block
+// encrypted with the given legacy PEM cipher.
+func WriteEncryptedPEMRSAKeyWithCipher(w io.Writer, key *rsa.PrivateKey, password []byte, cipher x509.PEMCipher) error {
+	if err := checkPEMCipher(cipher); err != nil {
+		return err
+	}
+
 	encPemBlock, err := x509.EncryptPEMBlock(
 		rand.Reader,
 		rsaPrivateKeyPEMBlockType,
 		x509.MarshalPKCS1PrivateKey(key),
 		password,
-		x509.PEMCipher3DES)
+		cipher)
 	if err != nil {
 		return err
 	}
 
-	return pem.Encode(file, encPemBlock)
+	return pem.Encode(w, encPemBlock)
+}
+
+func checkPEMCipher(cipher x509.PEMCipher) error {
+	switch cipher {
+	case x509.PEMCipherDES, x509.PEMCipher3DES, x509.PEMCipherAES128, x509.PEMCipherAES192, x509.PEMCipherAES256:
+		return nil
+	default:
+		return fmt.Errorf("unsupported PEM cipher %d", cipher)
+	}
 }
 
+var oidASN1UserID = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}
+
+// pushTopicPrefix is the prefix of all APNs MDM push topics,
+// e.g. com.apple.mgmt.External.18a16429-886b-41f1-9c30-2bd04ae4fc37.
+const pushTopicPrefix = "com.apple.mgmt"
+
 // TopicFromCert extracts the push certificate topic from the provided certificate.
+// It is equivalent to TopicFromCertStrict.
 func TopicFromCert(cert *x509.Certificate) (string, error) {
-	var oidASN1UserID = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}
+	return TopicFromCertStrict(cert)
+}
+
+// TopicFromCertStrict extracts the push certificate topic from the provided
+// certificate. The topic must start with "com.apple.mgmt", as all Apple-issued
+// MDM push topics (e.g. "com.apple.mgmt.External.<uuid>") do.
+//
+// Candidates are considered in the following order, and the first valid topic
+// is returned:
+//
+//  1. UserID attributes of the certificate subject, in order.
+//  2. Certificate extensions identified by the UserID OID, in order.
+func TopicFromCertStrict(cert *x509.Certificate) (string, error) {
+	uids := topicCandidates(cert)
+	for _, uid := range uids {
+		if strings.HasPrefix(uid, pushTopicPrefix) {
+			return uid, nil
+		}
+	}
+	if len(uids) > 0 {
+		return "", errors.New("invalid Push Topic (UserID OID) in certificate. Must start with '" + pushTopicPrefix + "', was: " + uids[0])
+	}
+
+	return "", errors.New("could not find Push Topic (UserID OID) in certificate")
+}
+
+// TopicFromCertLenient is like TopicFromCertStrict but returns the first
+// non-empty candidate verbatim, whether or not it looks like a push topic.
+func TopicFromCertLenient(cert *x509.Certificate) (string, error) {
+	for _, uid := range topicCandidates(cert) {
+		if uid != "" {
+			return uid, nil
+		}
+	}
+	return "", errors.New("could not find Push Topic (UserID OID) in certificate")
+}
+
+// topicCandidates returns the possible push topics of cert in precedence order.
+// See TopicFromCertStrict.
+func topicCandidates(cert *x509.Certificate) []string {
+	return append(userIDs(cert), extensionUserIDs(cert)...)
+}
+
+// userIDs returns the string values of all UserID attributes in the certificate subject.
+func userIDs(cert *x509.Certificate) []string {
+	var uids []string
 	for _, v := range cert.Subject.Names {
 		if v.Type.Equal(oidASN1UserID) {
-			uid, ok := v.Value.(string)
-			if ok && strings.HasPrefix(uid, "com.apple.mgmt") {
-				return uid, nil
-			}
-			return "", errors.New("invalid Push Topic (UserID OID) in certificate. Must start with 'com.apple.mgmt', was: " + uid)
+			uid, _ := v.Value.(string)
+			uids = append(uids, uid)
 		}
 	}
+	return uids
+}
 
-	return "", errors.New("could not find Push Topic (UserID OID) in certificate")
+// extensionUserIDs returns the string values of all certificate extensions
+// identified by the UserID OID. Values that are not a DER encoded ASN.1 string
+// are skipped.
+func extensionUserIDs(cert *x509.Certificate) []string {
+	var uids []string
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidASN1UserID) {
+			continue
+		}
+		var uid string
+		if rest, err := asn1.Unmarshal(ext.Value, &uid); err != nil || len(rest) > 0 {
+			continue
+		}
+		uids = append(uids, uid)
+	}
+	return uids
+}
+
+// VerifyTopic checks that the push topic of cert, as returned by TopicFromCert,
+// is expected. This catches uploads of an old or another account's push certificate.
+func VerifyTopic(cert *x509.Certificate, expected string) error {
+	topic, err := TopicFromCert(cert)
+	if err != nil {
+		return err
+	}
+	if topic != expected {
+		return fmt.Errorf("push certificate topic mismatch: expected %s, got %s", expected, topic)
+	}
+	return nil
+}
+
+// TopicFromPKCS7 extracts the push certificate topic from the signer of the provided PKCS7 object.
+func TopicFromPKCS7(p7 *pkcs7.PKCS7) (string, error) {
+	signer := p7.GetOnlySigner()
+	if signer == nil {
+		return "", errors.New("pkcs7 object must have exactly one signer")
+	}
+	return TopicFromCert(signer)
 }
 
 // PKCS7Verifier verifies PKCS7 objects with a configurable clock skew
 type PKCS7Verifier struct {
 	// MaxSkew is the maximum amount of clock skew permitted between the the server time and the pkcs7 signature validity
 	MaxSkew time.Duration
+
+	// Now returns the current time. Defaults to time.Now if nil.
+	Now func() time.Time
+
+	// Roots, if not nil, is the pool the signer certificate chain must be rooted in.
+	// If nil, the certificate chain is not verified.
+	Roots *x509.CertPool
+}
+
+func (v *PKCS7Verifier) now() time.Time {
+	if v.Now == nil {
+		return time.Now()
+	}
+	return v.Now()
 }
 
 // Verify checks the signatures of a PKCS7 object
 func (v *PKCS7Verifier) Verify(p7 *pkcs7.PKCS7) error {
+	_, err := v.VerifyAndGetSigner(p7)
+	return err
+}
+
+// VerifyAndGetSigner checks the signatures of a PKCS7 object like Verify and
+// returns the certificate of its only signer. A nil certificate is never
+// returned with a nil error.
+func (v *PKCS7Verifier) VerifyAndGetSigner(p7 *pkcs7.PKCS7) (*x509.Certificate, error) {
 	// verify with skew added to beginning of validity window
-	err := p7.VerifyWithChainAtTime(nil, time.Now().Add(v.MaxSkew))
+	err := p7.VerifyWithChainAtTime(v.Roots, v.now().Add(v.MaxSkew))
 	// if verification fails due to missing the validity window, try verifying with the skew added to the end of the validity window
-	// the pkcs7 lib doesn't return a concrete error, so check against the error string
-	if err != nil && strings.Contains(err.Error(), "is outside of certificate validity") {
-		return p7.VerifyWithChainAtTime(nil, time.Now().Add(-v.MaxSkew))
+	if isValidityError(err) {
+		if lateErr := p7.VerifyWithChainAtTime(v.Roots, v.now().Add(-v.MaxSkew)); lateErr != nil {
+			return nil, &SkewVerificationError{Early: err, Late: lateErr}
+		}
+		err = nil
 	}
-	return err
+	if err != nil {
+		return nil, err
+	}
+	signer := p7.GetOnlySigner()
+	if signer == nil {
+		return nil, errors.New("pkcs7 object must have exactly one signer")
+	}
+	return signer, nil
+}
+
+// VerifyWithExpectedCN is like Verify but additionally requires the common name
+// of the signer certificate to be expectedCN, such as the UDID a device claims.
+// If the signature is valid but the common name differs a *SignerMismatchError
+// is returned, so callers can tell an unexpected signer apart from a bad signature.
+func (v *PKCS7Verifier) VerifyWithExpectedCN(p7 *pkcs7.PKCS7, expectedCN string) error {
+	signer, err := v.VerifyAndGetSigner(p7)
+	if err != nil {
+		return err
+	}
+	if cn := signer.Subject.CommonName; cn != expectedCN {
+		return &SignerMismatchError{Expected: expectedCN, Actual: cn}
+	}
+	return nil
+}
+
+// SignerMismatchError is returned by VerifyWithExpectedCN when a valid
+// signature was made by a certificate with an unexpected common name.
+type SignerMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *SignerMismatchError) Error() string {
+	return fmt.Sprintf("pkcs7 signer common name %q does not match expected %q", e.Actual, e.Expected)
+}
+
+// ErrPayloadTooLarge is returned by ReadAndVerifyPKCS7 if the payload exceeds the maximum size.
+var ErrPayloadTooLarge = errors.New("pkcs7 payload too large")
+
+// ReadAndVerifyPKCS7 is like ParseAndVerifyPKCS7 but reads the DER encoded
+// PKCS7 object from r. At most maxSize bytes are read; larger payloads are
+// rejected with ErrPayloadTooLarge without reading them completely.
+func ReadAndVerifyPKCS7(r io.Reader, maxSize int64, v PKCS7Verifier) (*pkcs7.PKCS7, error) {
+	var buf bytes.Buffer
+	n, err := buf.ReadFrom(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > maxSize {
+		return nil, ErrPayloadTooLarge
+	}
+	return ParseAndVerifyPKCS7(buf.Bytes(), v)
+}
+
+// ParseAndVerifyPKCS7 parses the DER encoded PKCS7 object and verifies it with v.
+func ParseAndVerifyPKCS7(der []byte, v PKCS7Verifier) (*pkcs7.PKCS7, error) {
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Verify(p7); err != nil {
+		return nil, err
+	}
+	return p7, nil
+}
+
+// SkewVerificationError is returned by PKCS7Verifier when verification failed
+// both with the skew added to and subtracted from the current time.
+type SkewVerificationError struct {
+	// Early is the error verifying with MaxSkew added to the current time.
+	Early error
+	// Late is the error verifying with MaxSkew subtracted from the current time.
+	Late error
+}
+
+func (e *SkewVerificationError) Error() string {
+	return fmt.Sprintf("pkcs7 verification failed with +skew: %s; with -skew: %s", e.Early, e.Late)
+}
+
+// Unwrap returns the error of the last verification attempt.
+func (e *SkewVerificationError) Unwrap() error { return e.Late }
+
+// The pkcs7 lib doesn't return concrete errors for validity failures,
+// so these substrings of its error messages are checked instead.
+const (
+	// pkcs7SigningTimeValidityErr is returned if the signing time is outside of the signer validity.
+	pkcs7SigningTimeValidityErr = "is outside of certificate validity"
+	// pkcs7ChainValidityErr is returned if the chain is invalid at the verification time.
+	// It is only returned when verifying against Roots.
+	pkcs7ChainValidityErr = "certificate has expired or is not yet valid"
+)
+
+func isValidityError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, pkcs7SigningTimeValidityErr) || strings.Contains(msg, pkcs7ChainValidityErr)
 }
@@ -1,7 +1,30 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io"
+	mathrand "math/rand"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"go.mozilla.org/pkcs7"
 )
 
 func TestTopicFromValidCert(t *testing.T) {
@@ -16,6 +39,134 @@ func TestTopicFromValidCert(t *testing.T) {
 	}
 }
 
+func TestTopicFromCertPlacement(t *testing.T) {
+	const topic = "com.apple.mgmt.External.18a16429-886b-41f1-9c30-2bd04ae4fc37"
+	for _, path := range []string{
+		"testdata/mock_push_cert.pem",
+		"testdata/mock_push_cert_ext_topic.pem",
+	} {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			certificate, err := ReadPEMCertificateFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pushTopic, err := TopicFromCert(certificate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have, want := pushTopic, topic; have != want {
+				t.Errorf("have %s, want %s", have, want)
+			}
+		})
+	}
+}
+
+func TestTopicFromCertSubjectPrecedence(t *testing.T) {
+	value, err := asn1.MarshalWithParams("com.apple.mgmt.External.extension", "utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := simpleTemplate("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.Subject.ExtraNames = []pkix.AttributeTypeAndValue{
+		{Type: oidASN1UserID, Value: "com.apple.mgmt.External.subject"},
+	}
+	template.ExtraExtensions = []pkix.Extension{{Id: oidASN1UserID, Value: value}}
+	cert, err := selfSign(template, mustRSAKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topic, err := TopicFromCert(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := topic, "com.apple.mgmt.External.subject"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+}
+
+// certWithUIDs returns a self-signed certificate with a UserID subject attribute for each uid.
+func certWithUIDs(t *testing.T, uids ...string) *x509.Certificate {
+	t.Helper()
+	template, err := simpleTemplate("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uid := range uids {
+		template.Subject.ExtraNames = append(template.Subject.ExtraNames, pkix.AttributeTypeAndValue{
+			Type:  oidASN1UserID,
+			Value: uid,
+		})
+	}
+	cert, err := selfSign(template, mustRSAKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestTopicFromCertForms(t *testing.T) {
+	tests := []struct {
+		name        string
+		uids        []string
+		wantStrict  string
+		wantLenient string
+	}{
+		{"external", []string{"com.apple.mgmt.External.18a16429-886b-41f1-9c30-2bd04ae4fc37"},
+			"com.apple.mgmt.External.18a16429-886b-41f1-9c30-2bd04ae4fc37",
+			"com.apple.mgmt.External.18a16429-886b-41f1-9c30-2bd04ae4fc37"},
+		{"bare prefix", []string{"com.apple.mgmt"}, "com.apple.mgmt", "com.apple.mgmt"},
+		{"wrong prefix", []string{"com.example.topic"}, "", "com.example.topic"},
+		{"empty", []string{""}, "", ""},
+		{"none", nil, "", ""},
+		{"multiple", []string{"", "com.example.topic", "com.apple.mgmt.External.1", "com.apple.mgmt.External.2"},
+			"com.apple.mgmt.External.1", "com.example.topic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := certWithUIDs(t, tt.uids...)
+
+			topic, err := TopicFromCertStrict(cert)
+			if have, want := topic, tt.wantStrict; have != want {
+				t.Errorf("strict: have %q, want %q", have, want)
+			}
+			if have, want := err != nil, tt.wantStrict == ""; have != want {
+				t.Errorf("strict: have err %v, want err %v", err, want)
+			}
+
+			topic, err = TopicFromCertLenient(cert)
+			if have, want := topic, tt.wantLenient; have != want {
+				t.Errorf("lenient: have %q, want %q", have, want)
+			}
+			if have, want := err != nil, tt.wantLenient == ""; have != want {
+				t.Errorf("lenient: have err %v, want err %v", err, want)
+			}
+		})
+	}
+}
+
+func TestTopicFromPKCS7(t *testing.T) {
+	der, err := os.ReadFile("testdata/mock_push_cert.p7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushTopic, err := TopicFromPKCS7(p7)
+	if err != nil {
+		t.Fatalf("fail %s", err)
+	}
+
+	if have, want := pushTopic, "com.apple.mgmt.External.18a16429-886b-41f1-9c30-2bd04ae4fc37"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+}
+
 func TestTopicFromInvalidCert(t *testing.T) {
 	certFileNames := []string{"mock_push_cert_wrong_uid_prefix.pem", "mock_push_cert_wrong_uid_prefix.pem"}
 	for _, certFileName := range certFileNames {
@@ -27,3 +178,1203 @@ func TestTopicFromInvalidCert(t *testing.T) {
 		}
 	}
 }
+
+func writePKCS8KeyFile(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	pemData := pem.EncodeToMemory(&pem.Block{Type: pkcs8PrivateKeyPEMBlockType, Bytes: der})
+	if err := os.WriteFile(path, pemData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func mustRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestReadPEMRSAKeyFilePKCS8(t *testing.T) {
+	key := mustRSAKey(t)
+	path := writePKCS8KeyFile(t, key)
+
+	have, err := ReadPEMRSAKeyFile(path)
+	if err != nil {
+		t.Fatalf("reading PKCS#8 RSA key: %s", err)
+	}
+	if !have.Equal(key) {
+		t.Error("PKCS#8 RSA key does not match")
+	}
+
+	pkcs1Path := filepath.Join(t.TempDir(), "pkcs1.pem")
+	if err := WritePEMRSAKeyFile(key, pkcs1Path); err != nil {
+		t.Fatal(err)
+	}
+	have, err = ReadPEMRSAKeyFile(pkcs1Path)
+	if err != nil {
+		t.Fatalf("reading PKCS#1 RSA key: %s", err)
+	}
+	if !have.Equal(key) {
+		t.Error("PKCS#1 RSA key does not match")
+	}
+}
+
+func TestReadPEMRSAKeyFilePKCS8NotRSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writePKCS8KeyFile(t, key)
+
+	if _, err := ReadPEMRSAKeyFile(path); err == nil {
+		t.Error("expected error reading ECDSA key as RSA")
+	}
+
+	signer, err := ReadPEMPrivateKeyFile(path)
+	if err != nil {
+		t.Fatalf("reading PKCS#8 ECDSA key: %s", err)
+	}
+	if _, ok := signer.(*ecdsa.PrivateKey); !ok {
+		t.Errorf("have %T, want *ecdsa.PrivateKey", signer)
+	}
+}
+
+func TestSimpleSelfSignedECDSAKeypair(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		key, cert, err := SimpleSelfSignedECDSAKeypair("test", curve, 1)
+		if err != nil {
+			t.Fatalf("%s: %s", curve.Params().Name, err)
+		}
+		if key.Curve != curve {
+			t.Errorf("have curve %s, want %s", key.Curve.Params().Name, curve.Params().Name)
+		}
+		pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+		if !ok || !pub.Equal(key.Public()) {
+			t.Errorf("%s: certificate public key does not match", curve.Params().Name)
+		}
+		if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+			t.Errorf("%s: self-signature does not verify: %s", curve.Params().Name, err)
+		}
+	}
+}
+
+func TestSimpleSelfSignedRSAKeypairWithBits(t *testing.T) {
+	key, _, err := SimpleSelfSignedRSAKeypairWithBits("test", 3072, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := key.N.BitLen(), 3072; have != want {
+		t.Errorf("have %d bit key, want %d", have, want)
+	}
+
+	for _, bits := range []int{0, 1024, 2047, 8192} {
+		if _, _, err := SimpleSelfSignedRSAKeypairWithBits("test", bits, 1); err == nil {
+			t.Errorf("expected error for %d bit key", bits)
+		}
+	}
+}
+
+func benchmarkSimpleSelfSignedRSAKeypairWithBits(b *testing.B, bits int) {
+	for i := 0; i < b.N; i++ {
+		if _, _, err := SimpleSelfSignedRSAKeypairWithBits("bench", bits, 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSimpleSelfSignedRSAKeypair2048(b *testing.B) {
+	benchmarkSimpleSelfSignedRSAKeypairWithBits(b, 2048)
+}
+
+func BenchmarkSimpleSelfSignedRSAKeypair3072(b *testing.B) {
+	benchmarkSimpleSelfSignedRSAKeypairWithBits(b, 3072)
+}
+
+func BenchmarkSimpleSelfSignedRSAKeypair4096(b *testing.B) {
+	benchmarkSimpleSelfSignedRSAKeypairWithBits(b, 4096)
+}
+
+func TestReadPEMCertificatesFileMixed(t *testing.T) {
+	certs, err := ReadPEMCertificatesFile("testdata/mixed_bundle.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(certs), 2; have != want {
+		t.Fatalf("have %d certificates, want %d", have, want)
+	}
+
+	if _, err := ReadPEMCertificatesFile(writePKCS8KeyFile(t, mustRSAKey(t))); err == nil {
+		t.Error("expected error reading file without certificates")
+	}
+}
+
+func TestWriteEncryptedPKCS8KeyFile(t *testing.T) {
+	rsaKey := mustRSAKey(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := []byte("secret")
+
+	for _, key := range []crypto.Signer{rsaKey, ecKey} {
+		path := filepath.Join(t.TempDir(), "key.pem")
+		if err := WriteEncryptedPKCS8KeyFile(key, password, path); err != nil {
+			t.Fatal(err)
+		}
+
+		have, err := readEncryptedPEMPrivateKeyFile(path, password)
+		if err != nil {
+			t.Fatalf("decrypting %T: %s", key, err)
+		}
+		if !have.(interface{ Equal(crypto.PrivateKey) bool }).Equal(key) {
+			t.Errorf("decrypted %T does not match", key)
+		}
+
+		if _, err := readEncryptedPEMPrivateKeyFile(path, []byte("wrong")); err == nil {
+			t.Errorf("expected error decrypting %T with wrong password", key)
+		}
+		if _, err := readEncryptedPEMPrivateKeyFile(path, nil); err == nil {
+			t.Errorf("expected error decrypting %T without password", key)
+		}
+	}
+}
+
+func TestDecryptPKCS8IterationCount(t *testing.T) {
+	for _, count := range []int{-1, 0, maxPBKDF2Iterations + 1} {
+		kdfParams, err := asn1.Marshal(pbkdf2Params{Salt: make([]byte, 16), IterationCount: count})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ivParams, err := asn1.Marshal(make([]byte, aes.BlockSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		params, err := asn1.Marshal(pbes2Params{
+			KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+			EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := asn1.Marshal(encryptedPrivateKeyInfo{
+			Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+			EncryptedData: make([]byte, aes.BlockSize),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := decryptPKCS8(der, []byte("secret")); err == nil || !strings.Contains(err.Error(), "iteration count") {
+			t.Errorf("iteration count %d: have err %v, want invalid iteration count", count, err)
+		}
+	}
+}
+
+// signedPKCS7 returns a parsed PKCS7 object signed by a self-signed
+// certificate valid from notBefore to notAfter.
+func signedPKCS7(t *testing.T, notBefore, notAfter time.Time) (*pkcs7.PKCS7, *x509.Certificate) {
+	t.Helper()
+	der, cert := signedPKCS7DER(t, notBefore, notAfter)
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p7, cert
+}
+
+// signedPKCS7DER is like signedPKCS7 but returns the DER encoded PKCS7 object.
+func signedPKCS7DER(t *testing.T, notBefore, notAfter time.Time) ([]byte, *x509.Certificate) {
+	t.Helper()
+	key := mustRSAKey(t)
+	template, err := simpleTemplate("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.NotBefore, template.NotAfter = notBefore, notAfter
+	cert, err := selfSign(template, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd, err := pkcs7.NewSignedData([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.AddSigner(cert, key, pkcs7.SignerInfoConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	der, err := sd.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der, cert
+}
+
+func TestPKCS7VerifierNow(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		notBefore time.Time
+		wantCalls int
+		wantErr   bool
+	}{
+		{"valid", now.Add(-time.Hour), 1, false},
+		{"signed before validity", now.Add(time.Hour), 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p7, _ := signedPKCS7(t, tt.notBefore, now.Add(24*time.Hour))
+			var calls int
+			v := &PKCS7Verifier{MaxSkew: time.Minute, Now: func() time.Time {
+				calls++
+				return now
+			}}
+			err := v.Verify(p7)
+			if have, want := err != nil, tt.wantErr; have != want {
+				t.Errorf("have err %v, want err %v", err, want)
+			}
+			if have, want := calls, tt.wantCalls; have != want {
+				t.Errorf("have %d calls to Now, want %d", have, want)
+			}
+		})
+	}
+}
+
+func TestPKCS7VerifierRoots(t *testing.T) {
+	now := time.Now()
+	p7, cert := signedPKCS7(t, now.Add(-time.Hour), now.Add(time.Hour))
+	_, otherCert, err := SimpleSelfSignedRSAKeypair("other", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(otherCert)
+	if err := (&PKCS7Verifier{Roots: otherRoots}).Verify(p7); err == nil {
+		t.Error("expected error verifying against unrelated roots")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	if err := (&PKCS7Verifier{Roots: roots}).Verify(p7); err != nil {
+		t.Errorf("verifying against signer root: %s", err)
+	}
+}
+
+func TestPKCS7VerifierVerifyAndGetSigner(t *testing.T) {
+	now := time.Now()
+	p7, cert := signedPKCS7(t, now.Add(-time.Hour), now.Add(time.Hour))
+
+	signer, err := (&PKCS7Verifier{}).VerifyAndGetSigner(p7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signer.Equal(cert) {
+		t.Error("signer certificate mismatch")
+	}
+}
+
+// TestPKCS7ValidityErrors fails if the pkcs7 lib changes the wording of the
+// validity errors the PKCS7Verifier skew retry relies on.
+func TestPKCS7ValidityErrors(t *testing.T) {
+	now := time.Now()
+
+	p7, _ := signedPKCS7(t, now.Add(time.Hour), now.Add(2*time.Hour))
+	err := p7.VerifyWithChainAtTime(nil, now)
+	if err == nil || !strings.Contains(err.Error(), pkcs7SigningTimeValidityErr) {
+		t.Errorf("signing time error %q does not contain %q", err, pkcs7SigningTimeValidityErr)
+	}
+
+	p7, cert := signedPKCS7(t, now.Add(-time.Hour), now.Add(time.Hour))
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	err = p7.VerifyWithChainAtTime(roots, now.Add(2*time.Hour))
+	if err == nil || !strings.Contains(err.Error(), pkcs7ChainValidityErr) {
+		t.Errorf("chain error %q does not contain %q", err, pkcs7ChainValidityErr)
+	}
+}
+
+func TestPKCS7VerifierSkew(t *testing.T) {
+	now := time.Now()
+	p7, cert := signedPKCS7(t, now.Add(-time.Hour), now.Add(time.Hour))
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		wantErr bool
+	}{
+		{"within validity", now, false},
+		{"early within skew", now.Add(-time.Hour - 5*time.Minute), false},
+		{"late within skew", now.Add(time.Hour + 5*time.Minute), false},
+		{"early outside skew", now.Add(-time.Hour - 20*time.Minute), true},
+		{"late outside skew", now.Add(time.Hour + 20*time.Minute), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &PKCS7Verifier{
+				MaxSkew: 10 * time.Minute,
+				Roots:   roots,
+				Now:     func() time.Time { return tt.at },
+			}
+			err := v.Verify(p7)
+			if have, want := err != nil, tt.wantErr; have != want {
+				t.Fatalf("have err %v, want err %v", err, want)
+			}
+			if err == nil {
+				return
+			}
+			var skewErr *SkewVerificationError
+			if !errors.As(err, &skewErr) || skewErr.Early == nil || skewErr.Late == nil {
+				t.Errorf("have %v, want both skew attempts reported", err)
+			}
+		})
+	}
+}
+
+func TestWritePEMCertificatesFile(t *testing.T) {
+	_, leaf, err := SimpleSelfSignedRSAKeypair("leaf", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, intermediate, err := SimpleSelfSignedRSAKeypair("intermediate", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := []*x509.Certificate{intermediate, leaf}
+
+	path := filepath.Join(t.TempDir(), "chain.pem")
+	if err := WritePEMCertificatesFile(chain, path); err != nil {
+		t.Fatal(err)
+	}
+	certs, err := ReadPEMCertificatesFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(certs), len(chain); have != want {
+		t.Fatalf("have %d certificates, want %d", have, want)
+	}
+	for i := range chain {
+		if !certs[i].Equal(chain[i]) {
+			t.Errorf("certificate %d does not match", i)
+		}
+	}
+
+	if err := WritePEMCertificatesFile(nil, path); err == nil {
+		t.Error("expected error writing empty chain")
+	}
+}
+
+func TestWritePEMToWriter(t *testing.T) {
+	key, cert, err := SimpleSelfSignedRSAKeypair("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	tests := []struct {
+		name      string
+		writeFile func(path string) error
+		write     func(w io.Writer) error
+	}{
+		{
+			"certificate",
+			func(path string) error { return WritePEMCertificateFile(cert, path) },
+			func(w io.Writer) error { return WritePEMCertificate(w, cert) },
+		},
+		{
+			"certificates",
+			func(path string) error { return WritePEMCertificatesFile([]*x509.Certificate{cert, cert}, path) },
+			func(w io.Writer) error { return WritePEMCertificates(w, []*x509.Certificate{cert, cert}) },
+		},
+		{
+			"rsa key",
+			func(path string) error { return WritePEMRSAKeyFile(key, path) },
+			func(w io.Writer) error { return WritePEMRSAKey(w, key) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := tt.writeFile(path); err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := tt.write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Error("writer output does not match file output")
+			}
+		})
+	}
+}
+
+func TestReadPEMRSAKeyFileFunc(t *testing.T) {
+	key := mustRSAKey(t)
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "plain.pem")
+	if err := WritePEMRSAKeyFile(key, plainPath); err != nil {
+		t.Fatal(err)
+	}
+	encPath := filepath.Join(dir, "enc.pem")
+	if err := WriteEncryptedPKCS8KeyFile(key, []byte("secret"), encPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	getPassword := func() ([]byte, error) {
+		calls++
+		return []byte("secret"), nil
+	}
+
+	if _, err := ReadPEMRSAKeyFileFunc(plainPath, getPassword); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Errorf("password callback called %d times for unencrypted key", calls)
+	}
+
+	have, err := ReadPEMRSAKeyFileFunc(encPath, getPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("password callback called %d times for encrypted key, want 1", calls)
+	}
+	if !have.Equal(key) {
+		t.Error("decrypted key does not match")
+	}
+
+	errVault := errors.New("vault unavailable")
+	_, err = ReadPEMRSAKeyFileFunc(encPath, func() ([]byte, error) { return nil, errVault })
+	if err != errVault {
+		t.Errorf("have err %v, want %v", err, errVault)
+	}
+}
+
+func TestSimpleSelfSignedCA(t *testing.T) {
+	caKey, caCert, err := SimpleSelfSignedCA("test CA", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caCert.IsCA || caCert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		t.Fatal("certificate is not CA-capable")
+	}
+
+	childKey := mustRSAKey(t)
+	template, err := simpleTemplate("child", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &childKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	if _, err := child.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("child certificate does not chain to CA: %s", err)
+	}
+}
+
+func TestRenewSelfSigned(t *testing.T) {
+	key, cert, err := SimpleSelfSignedCA("test CA", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renewed, err := RenewSelfSigned(cert, key, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !renewed.NotAfter.After(cert.NotAfter) {
+		t.Errorf("renewed NotAfter %s is not after %s", renewed.NotAfter, cert.NotAfter)
+	}
+	if !key.PublicKey.Equal(renewed.PublicKey) {
+		t.Error("renewed certificate has a different public key")
+	}
+	if !bytes.Equal(renewed.SubjectKeyId, cert.SubjectKeyId) {
+		t.Errorf("have SubjectKeyId %x, want %x", renewed.SubjectKeyId, cert.SubjectKeyId)
+	}
+	if renewed.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+		t.Error("renewed certificate reuses the serial number")
+	}
+	if !bytes.Equal(renewed.RawSubject, cert.RawSubject) || !renewed.IsCA || renewed.KeyUsage != cert.KeyUsage {
+		t.Error("renewed certificate does not preserve subject and usages")
+	}
+	if err := renewed.CheckSignatureFrom(renewed); err != nil {
+		t.Errorf("renewed certificate is not self-signed: %s", err)
+	}
+
+	if _, err := RenewSelfSigned(cert, mustRSAKey(t), 30); err == nil {
+		t.Error("expected error renewing with a different key")
+	}
+}
+
+func TestReadCertificateFile(t *testing.T) {
+	pemCert, err := ReadCertificateFile("testdata/mock_push_cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	derCert, err := ReadCertificateFile("testdata/mock_push_cert.cer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pemCert.Equal(derCert) {
+		t.Error("PEM and DER certificates do not match")
+	}
+}
+
+func TestSimpleSelfSignedRSAKeypairWithSANs(t *testing.T) {
+	dnsNames := []string{"mdm.internal", "mdm.example.com"}
+	ipAddresses := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("::1")}
+	_, cert, err := SimpleSelfSignedRSAKeypairWithSANs("mdm.example.com", dnsNames, ipAddresses, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range []string{"mdm.internal", "mdm.example.com", "10.0.0.1", "::1"} {
+		if err := cert.VerifyHostname(h); err != nil {
+			t.Errorf("%s: %s", h, err)
+		}
+	}
+	if err := cert.VerifyHostname("other.example.com"); err == nil {
+		t.Error("expected error verifying unlisted hostname")
+	}
+}
+
+func TestWriteEncryptedPEMRSAKeyFileWithCipher(t *testing.T) {
+	key := mustRSAKey(t)
+	password := []byte("secret")
+	dir := t.TempDir()
+
+	ciphers := []x509.PEMCipher{
+		x509.PEMCipherDES,
+		x509.PEMCipher3DES,
+		x509.PEMCipherAES128,
+		x509.PEMCipherAES192,
+		x509.PEMCipherAES256,
+	}
+	for _, cipher := range ciphers {
+		path := filepath.Join(dir, "key.pem")
+		if err := WriteEncryptedPEMRSAKeyFileWithCipher(key, password, path, cipher); err != nil {
+			t.Fatalf("cipher %d: %s", cipher, err)
+		}
+		have, err := ReadEncryptedPEMRSAKeyFile(path, password)
+		if err != nil {
+			t.Fatalf("cipher %d: %s", cipher, err)
+		}
+		if !have.Equal(key) {
+			t.Errorf("cipher %d: decrypted key does not match", cipher)
+		}
+	}
+
+	if err := WriteEncryptedPEMRSAKeyFileWithCipher(key, password, filepath.Join(dir, "bad.pem"), x509.PEMCipher(0)); err == nil {
+		t.Error("expected error for unsupported cipher")
+	}
+}
+
+func TestParseAndVerifyPKCS7(t *testing.T) {
+	now := time.Now()
+	der, _ := signedPKCS7DER(t, now.Add(-time.Hour), now.Add(time.Hour))
+
+	p7, err := ParseAndVerifyPKCS7(der, PKCS7Verifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := string(p7.Content), "hello"; have != want {
+		t.Errorf("have content %q, want %q", have, want)
+	}
+
+	i := bytes.Index(der, []byte("hello"))
+	if i < 0 {
+		t.Fatal("content not found in PKCS7 object")
+	}
+	tampered := append([]byte{}, der...)
+	copy(tampered[i:], "HELLO")
+	if _, err := ParseAndVerifyPKCS7(tampered, PKCS7Verifier{}); err == nil {
+		t.Error("expected error verifying tampered payload")
+	}
+}
+
+func TestReadEncryptedPEMRSAKeyFilePasswordErrors(t *testing.T) {
+	key := mustRSAKey(t)
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "plain.pem")
+	if err := WritePEMRSAKeyFile(key, plainPath); err != nil {
+		t.Fatal(err)
+	}
+	legacyPath := filepath.Join(dir, "legacy.pem")
+	if err := WriteEncryptedPEMRSAKeyFileWithCipher(key, []byte("secret"), legacyPath, x509.PEMCipherAES256); err != nil {
+		t.Fatal(err)
+	}
+	pkcs8Path := filepath.Join(dir, "pkcs8.pem")
+	if err := WriteEncryptedPKCS8KeyFile(key, []byte("secret"), pkcs8Path); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{legacyPath, pkcs8Path} {
+		if _, err := ReadPEMRSAKeyFile(path); !errors.Is(err, ErrEncryptedKeyNeedsPassword) {
+			t.Errorf("%s: have err %v, want %v", filepath.Base(path), err, ErrEncryptedKeyNeedsPassword)
+		}
+	}
+	if _, err := ReadEncryptedPEMRSAKeyFile(plainPath, []byte("secret")); !errors.Is(err, ErrUnexpectedPassword) {
+		t.Errorf("have err %v, want %v", err, ErrUnexpectedPassword)
+	}
+}
+
+func TestReadPEMRSAKeyFileBundle(t *testing.T) {
+	key, err := ReadPEMRSAKeyFile("testdata/identity_bundle.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ReadPEMCertificateFile("testdata/identity_bundle.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := MatchKeyPair(cert, key); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := ReadPEMRSAKeyFile("testdata/identity_cert.pem"); err == nil {
+		t.Error("expected error reading file without private key")
+	}
+}
+
+func TestParsePEMMatchesFileReaders(t *testing.T) {
+	pemData, err := os.ReadFile("testdata/identity_bundle.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileCerts, err := ReadPEMCertificatesFile("testdata/identity_bundle.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := ParsePEMCertificates(pemData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(certs), len(fileCerts); have != want {
+		t.Fatalf("have %d certificates, want %d", have, want)
+	}
+	for i := range certs {
+		if !certs[i].Equal(fileCerts[i]) {
+			t.Errorf("certificate %d does not match file reader", i)
+		}
+	}
+
+	fileKey, err := ReadPEMRSAKeyFile("testdata/identity_bundle.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParsePEMRSAKey(pemData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(fileKey) {
+		t.Error("key does not match file reader")
+	}
+}
+
+func TestParsePEMRSAKeyEncrypted(t *testing.T) {
+	key := mustRSAKey(t)
+	password := []byte("secret")
+	var buf bytes.Buffer
+	if err := WriteEncryptedPKCS8Key(&buf, key, password); err != nil {
+		t.Fatal(err)
+	}
+
+	have, err := ParsePEMRSAKey(buf.Bytes(), password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !have.Equal(key) {
+		t.Error("decrypted key does not match")
+	}
+	if _, err := ParsePEMRSAKey(buf.Bytes(), nil); !errors.Is(err, ErrEncryptedKeyNeedsPassword) {
+		t.Errorf("have error %v, want %v", err, ErrEncryptedKeyNeedsPassword)
+	}
+}
+
+func TestSelfSignKeyIdentifiers(t *testing.T) {
+	key := mustRSAKey(t)
+	var skis [][]byte
+	for i := 0; i < 2; i++ {
+		template, err := simpleTemplate("test", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := selfSign(template, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cert.SubjectKeyId) == 0 {
+			t.Fatal("certificate has no SubjectKeyId")
+		}
+		if !bytes.Equal(cert.AuthorityKeyId, cert.SubjectKeyId) {
+			t.Error("self-signed AuthorityKeyId does not match SubjectKeyId")
+		}
+		skis = append(skis, cert.SubjectKeyId)
+	}
+	if !bytes.Equal(skis[0], skis[1]) {
+		t.Error("SubjectKeyId is not deterministic for a fixed key")
+	}
+
+	caKey, ca, err := SimpleSelfSignedCA("ca", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := simpleTemplate("child", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(child.AuthorityKeyId, ca.SubjectKeyId) {
+		t.Error("child AuthorityKeyId does not reference CA SubjectKeyId")
+	}
+}
+
+func TestIsPEMKeyEncrypted(t *testing.T) {
+	key := mustRSAKey(t)
+	password := []byte("secret")
+	dir := t.TempDir()
+
+	plainPath := filepath.Join(dir, "plain.pem")
+	if err := WritePEMRSAKeyFile(key, plainPath); err != nil {
+		t.Fatal(err)
+	}
+	desPath := filepath.Join(dir, "des.pem")
+	if err := WriteEncryptedPEMRSAKeyFile(key, password, desPath); err != nil {
+		t.Fatal(err)
+	}
+	pkcs8Path := filepath.Join(dir, "pkcs8.pem")
+	if err := WriteEncryptedPKCS8KeyFile(key, password, pkcs8Path); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"unencrypted PKCS#1", plainPath, false},
+		{"unencrypted PKCS#8", writePKCS8KeyFile(t, key), false},
+		{"3DES", desPath, true},
+		{"encrypted PKCS#8", pkcs8Path, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			have, err := IsPEMKeyEncrypted(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != tt.want {
+				t.Errorf("have %v, want %v", have, tt.want)
+			}
+		})
+	}
+
+	if _, err := IsPEMKeyEncrypted("testdata/identity_cert.pem"); err == nil {
+		t.Error("expected error for file without private key")
+	}
+}
+
+func TestSimpleSelfSignedValidity(t *testing.T) {
+	for _, days := range []int{0, -1} {
+		if _, _, err := SimpleSelfSignedRSAKeypair("test", days); err == nil {
+			t.Errorf("expected error generating certificate valid for %d days", days)
+		}
+	}
+
+	before := time.Now()
+	_, cert, err := SimpleSelfSignedRSAKeypair("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// certificate times are truncated to the second
+	if !cert.NotBefore.Before(before.Add(-certificateBackdate + time.Second)) {
+		t.Errorf("NotBefore %s is not backdated by %s", cert.NotBefore, certificateBackdate)
+	}
+	if !cert.NotAfter.After(before.Add(23 * time.Hour)) {
+		t.Errorf("NotAfter %s is not about a day from now", cert.NotAfter)
+	}
+}
+
+func TestSimpleSelfSignedRSAKeypairWithOptions(t *testing.T) {
+	uri, err := url.Parse("https://mdm.example.com/users/jappleseed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := CertificateOptions{
+		EmailAddresses: []string{"jappleseed@example.com"},
+		URIs:           []*url.URL{uri},
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	_, cert, err := SimpleSelfSignedRSAKeypairWithOptions("Johnny Appleseed", opts, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err = x509.ParseCertificate(cert.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cert.EmailAddresses, opts.EmailAddresses; !reflect.DeepEqual(have, want) {
+		t.Errorf("have email SANs %v, want %v", have, want)
+	}
+	if have, want := len(cert.URIs), 1; have != want {
+		t.Fatalf("have %d URI SANs, want %d", have, want)
+	}
+	if have, want := cert.URIs[0].String(), uri.String(); have != want {
+		t.Errorf("have URI SAN %s, want %s", have, want)
+	}
+	if len(cert.DNSNames) != 0 {
+		t.Errorf("unexpected DNS SANs %v", cert.DNSNames)
+	}
+	if have, want := cert.ExtKeyUsage, opts.ExtKeyUsage; !reflect.DeepEqual(have, want) {
+		t.Errorf("have ExtKeyUsage %v, want %v", have, want)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}); err != nil {
+		t.Errorf("certificate is not valid for email protection: %s", err)
+	}
+}
+
+func TestReadEncryptedPEMRSAKeyFileInfo(t *testing.T) {
+	key := mustRSAKey(t)
+	password := []byte("secret")
+	dir := t.TempDir()
+
+	plainPath := filepath.Join(dir, "plain.pem")
+	if err := WritePEMRSAKeyFile(key, plainPath); err != nil {
+		t.Fatal(err)
+	}
+	desPath := filepath.Join(dir, "des.pem")
+	if err := WriteEncryptedPEMRSAKeyFile(key, password, desPath); err != nil {
+		t.Fatal(err)
+	}
+	aesPath := filepath.Join(dir, "aes.pem")
+	if err := WriteEncryptedPEMRSAKeyFileWithCipher(key, password, aesPath, x509.PEMCipherAES128); err != nil {
+		t.Fatal(err)
+	}
+	pkcs8Path := filepath.Join(dir, "pkcs8.pem")
+	if err := WriteEncryptedPKCS8KeyFile(key, password, pkcs8Path); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		password       []byte
+		wantCipher     string
+		wantDeprecated bool
+	}{
+		{"unencrypted", plainPath, nil, "", false},
+		{"3DES", desPath, password, "DES-EDE3-CBC", true},
+		{"AES PEM", aesPath, password, "AES-128-CBC", false},
+		{"encrypted PKCS#8", pkcs8Path, password, "AES-256-CBC", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			have, cipherName, err := ReadEncryptedPEMRSAKeyFileInfo(tt.path, tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !have.Equal(key) {
+				t.Error("key does not match")
+			}
+			if cipherName != tt.wantCipher {
+				t.Errorf("have cipher %q, want %q", cipherName, tt.wantCipher)
+			}
+			if have, want := IsDeprecatedKeyCipher(cipherName), tt.wantDeprecated; have != want {
+				t.Errorf("have deprecated %v, want %v", have, want)
+			}
+		})
+	}
+}
+
+func TestSimpleSelfSignedRSAKeypairRand(t *testing.T) {
+	_, first, err := SimpleSelfSignedRSAKeypairRand(mathrand.New(mathrand.NewSource(1)), "test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := SimpleSelfSignedRSAKeypairRand(mathrand.New(mathrand.NewSource(1)), "test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.SerialNumber.Cmp(second.SerialNumber) != 0 {
+		t.Errorf("serial numbers %s and %s differ for the same seed", first.SerialNumber, second.SerialNumber)
+	}
+
+	_, other, err := SimpleSelfSignedRSAKeypairRand(mathrand.New(mathrand.NewSource(2)), "test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.SerialNumber.Cmp(other.SerialNumber) == 0 {
+		t.Error("serial numbers match for different seeds")
+	}
+}
+
+func TestVerifyWithExpectedCN(t *testing.T) {
+	now := time.Now()
+	p7, _ := signedPKCS7(t, now.Add(-time.Hour), now.Add(time.Hour))
+	v := &PKCS7Verifier{}
+
+	if err := v.VerifyWithExpectedCN(p7, "test"); err != nil {
+		t.Errorf("expected signer: %s", err)
+	}
+
+	err := v.VerifyWithExpectedCN(p7, "other")
+	var mismatch *SignerMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("have error %v, want *SignerMismatchError", err)
+	}
+	if mismatch.Expected != "other" || mismatch.Actual != "test" {
+		t.Errorf("have %+v", mismatch)
+	}
+
+	p7.Content = []byte("tampered")
+	err = v.VerifyWithExpectedCN(p7, "test")
+	if err == nil || errors.As(err, &mismatch) {
+		t.Errorf("have error %v, want signature error", err)
+	}
+}
+
+func TestWritePEMCertificateFileCRLF(t *testing.T) {
+	cert, err := ReadPEMCertificateFile("testdata/mock_push_cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	if err := WritePEMCertificateFileCRLF(cert, path); err != nil {
+		t.Fatal(err)
+	}
+
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(pemData, []byte("-----END CERTIFICATE-----\r\n")) {
+		t.Error("PEM data does not end with CRLF")
+	}
+	if have, want := bytes.Count(pemData, []byte("\n")), bytes.Count(pemData, []byte("\r\n")); have != want {
+		t.Errorf("have %d LF line endings, want all %d to be CRLF", have, want)
+	}
+
+	have, err := ReadPEMCertificateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !have.Equal(cert) {
+		t.Error("certificate did not round-trip")
+	}
+}
+
+func TestVerifyTopic(t *testing.T) {
+	cert, err := ReadPEMCertificateFile("testdata/mock_push_cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const topic = "com.apple.mgmt.External.18a16429-886b-41f1-9c30-2bd04ae4fc37"
+	if err := VerifyTopic(cert, topic); err != nil {
+		t.Errorf("matching topic: %s", err)
+	}
+
+	const other = "com.apple.mgmt.External.00000000-0000-0000-0000-000000000000"
+	err = VerifyTopic(cert, other)
+	if err == nil {
+		t.Fatal("expected error for mismatched topic")
+	}
+	if !strings.Contains(err.Error(), topic) || !strings.Contains(err.Error(), other) {
+		t.Errorf("error %q does not list both topics", err)
+	}
+
+	noUID, err := ReadPEMCertificateFile("testdata/mock_push_cert_no_uid.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyTopic(noUID, topic); err == nil {
+		t.Error("expected error for certificate without topic")
+	}
+}
+
+func TestWritePEMRSAKeyFileMode(t *testing.T) {
+	key := mustRSAKey(t)
+	dir := t.TempDir()
+
+	defaultPath := filepath.Join(dir, "default.pem")
+	if err := WritePEMRSAKeyFile(key, defaultPath); err != nil {
+		t.Fatal(err)
+	}
+	modePath := filepath.Join(dir, "mode.pem")
+	if err := WritePEMRSAKeyFileMode(key, modePath, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]os.FileMode{defaultPath: 0600, modePath: 0640} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := info.Mode().Perm(); have != want {
+			t.Errorf("%s: have mode %o, want %o", filepath.Base(path), have, want)
+		}
+	}
+
+	if err := WritePEMRSAKeyFileMode(key, modePath, 0400); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(modePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := info.Mode().Perm(), os.FileMode(0400); have != want {
+		t.Errorf("existing file: have mode %o, want %o", have, want)
+	}
+	if _, err := ReadPEMRSAKeyFile(modePath); err != nil {
+		t.Error(err)
+	}
+}
+
+// countingReader is an endless reader of zeros that counts the bytes read.
+type countingReader struct{ n int64 }
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	r.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestReadAndVerifyPKCS7(t *testing.T) {
+	now := time.Now()
+	der, _ := signedPKCS7DER(t, now.Add(-time.Hour), now.Add(time.Hour))
+
+	p7, err := ReadAndVerifyPKCS7(bytes.NewReader(der), int64(len(der)), PKCS7Verifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := string(p7.Content), "hello"; have != want {
+		t.Errorf("have content %q, want %q", have, want)
+	}
+
+	if _, err := ReadAndVerifyPKCS7(bytes.NewReader(der), int64(len(der)-1), PKCS7Verifier{}); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("have error %v, want %v", err, ErrPayloadTooLarge)
+	}
+
+	const maxSize = 1 << 10
+	r := &countingReader{}
+	if _, err := ReadAndVerifyPKCS7(r, maxSize, PKCS7Verifier{}); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("have error %v, want %v", err, ErrPayloadTooLarge)
+	}
+	if r.n > maxSize+1 {
+		t.Errorf("read %d bytes, want at most %d", r.n, maxSize+1)
+	}
+}
+
+func TestCertificateBase64(t *testing.T) {
+	cert, err := ReadPEMCertificateFile("testdata/mock_push_cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := CertificateToBase64(cert)
+
+	pemData, err := os.ReadFile("testdata/mock_push_cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wrapped strings.Builder
+	for s := encoded; len(s) > 0; {
+		n := 64
+		if len(s) < n {
+			n = len(s)
+		}
+		wrapped.WriteString(s[:n] + "\n")
+		s = s[n:]
+	}
+
+	for name, s := range map[string]string{
+		"plain":      encoded,
+		"whitespace": "  \n" + wrapped.String() + "\t\n",
+		"pem":        string(pemData),
+	} {
+		t.Run(name, func(t *testing.T) {
+			decoded, err := CertificateFromBase64(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded.Raw, cert.Raw) {
+				t.Error("decoded certificate DER does not match")
+			}
+		})
+	}
+
+	if _, err := CertificateFromBase64("not base64!"); err == nil {
+		t.Error("expected error for invalid base64")
+	}
+}
+
+func TestSimpleSelfSignedRSAKeypairWithSubject(t *testing.T) {
+	subject := pkix.Name{
+		CommonName:         "mdm.example.com",
+		Organization:       []string{"Acme Inc."},
+		OrganizationalUnit: []string{"IT"},
+		Country:            []string{"US"},
+	}
+	_, cert, err := SimpleSelfSignedRSAKeypairWithSubject(subject, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err = x509.ParseCertificate(cert.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cert.Subject.CommonName, subject.CommonName; have != want {
+		t.Errorf("have CN %s, want %s", have, want)
+	}
+	if have, want := cert.Subject.Organization, subject.Organization; !reflect.DeepEqual(have, want) {
+		t.Errorf("have O %v, want %v", have, want)
+	}
+	if have, want := cert.Subject.OrganizationalUnit, subject.OrganizationalUnit; !reflect.DeepEqual(have, want) {
+		t.Errorf("have OU %v, want %v", have, want)
+	}
+	if have, want := cert.Subject.Country, subject.Country; !reflect.DeepEqual(have, want) {
+		t.Errorf("have C %v, want %v", have, want)
+	}
+	if have, want := cert.DNSNames, []string{subject.CommonName}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have DNS SANs %v, want %v", have, want)
+	}
+}
@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Identity bundles a certificate with its private key.
+type Identity struct {
+	Certificate *x509.Certificate
+	PrivateKey  crypto.Signer
+}
+
+// LoadIdentity reads an Identity from a PEM certificate file and an optionally
+// encrypted PEM private key file. An error is returned if the key does not
+// belong to the certificate.
+func LoadIdentity(certPath, keyPath string, password []byte) (*Identity, error) {
+	cert, err := ReadPEMCertificateFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := readEncryptedPEMPrivateKeyFile(keyPath, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := MatchSigner(cert, key); err != nil {
+		return nil, fmt.Errorf("identity certificate does not match private key: %w", err)
+	}
+	return &Identity{Certificate: cert, PrivateKey: key}, nil
+}
+
+// TLSCertificate returns the identity as a tls.Certificate.
+func (id *Identity) TLSCertificate() tls.Certificate {
+	return tls.Certificate{
+		Certificate: [][]byte{id.Certificate.Raw},
+		PrivateKey:  id.PrivateKey,
+		Leaf:        id.Certificate,
+	}
+}
+
+// PublicOnly returns a copy of the identity without the private key,
+// suitable for logging or exporting diagnostic information.
+func (id *Identity) PublicOnly() *Identity {
+	return &Identity{Certificate: id.Certificate}
+}
+
+// String describes the identity certificate by subject, serial number, expiry
+// and push topic, if any. It never includes key material, and has a value
+// receiver so that Identity values are printed safely too.
+func (id Identity) String() string {
+	if id.Certificate == nil {
+		return "Identity{}"
+	}
+	fields := []string{
+		"subject=" + id.Certificate.Subject.String(),
+		"serial=" + id.Certificate.SerialNumber.String(),
+		"expires=" + id.Certificate.NotAfter.UTC().Format(time.RFC3339),
+	}
+	if topic, err := TopicFromCert(id.Certificate); err == nil {
+		fields = append(fields, "topic="+topic)
+	}
+	return "Identity{" + strings.Join(fields, " ") + "}"
+}
+
+// GoString is like String, so that the %#v verb does not print the private key either.
+func (id Identity) GoString() string {
+	return id.String()
+}
@@ -0,0 +1,73 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLoadIdentity(t *testing.T) {
+	id, err := LoadIdentity("testdata/identity_cert.pem", "testdata/identity_key.pem", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := id.Certificate.Subject.CommonName, "micromdm-test-identity"; have != want {
+		t.Errorf("have CN %s, want %s", have, want)
+	}
+
+	tlsCert := id.TLSCertificate()
+	if len(tlsCert.Certificate) != 1 || !bytes.Equal(tlsCert.Certificate[0], id.Certificate.Raw) {
+		t.Error("TLS certificate does not contain identity certificate")
+	}
+	if tlsCert.PrivateKey != id.PrivateKey {
+		t.Error("TLS certificate does not contain identity private key")
+	}
+
+	if _, err := LoadIdentity("testdata/mock_push_cert.pem", "testdata/identity_key.pem", nil); err == nil {
+		t.Error("expected error loading mismatched identity")
+	}
+}
+
+func TestIdentityString(t *testing.T) {
+	id, err := LoadIdentity("testdata/identity_cert.pem", "testdata/identity_key.pem", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := assertRSAKey(id.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WritePEMRSAKey(&buf, key); err != nil {
+		t.Fatal(err)
+	}
+	secrets := []string{
+		key.D.String(),
+		fmt.Sprintf("%x", key.D.Bytes()),
+		buf.String()[32:96], // inside the base64 body
+	}
+
+	for _, s := range []string{id.String(), fmt.Sprint(id), fmt.Sprint(*id), fmt.Sprintf("%+v", *id), fmt.Sprintf("%#v", *id)} {
+		if !strings.Contains(s, "micromdm-test-identity") {
+			t.Errorf("%q does not contain the certificate CN", s)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(s, secret) {
+				t.Errorf("%q contains private key material", s)
+			}
+		}
+	}
+
+	public := id.PublicOnly()
+	if public.PrivateKey != nil {
+		t.Error("PublicOnly identity has a private key")
+	}
+	if public.Certificate != id.Certificate {
+		t.Error("PublicOnly identity does not have the certificate")
+	}
+	if id.PrivateKey == nil {
+		t.Error("PublicOnly modified the original identity")
+	}
+}
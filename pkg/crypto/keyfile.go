@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package crypto
+
+import (
+	"fmt"
+	"os"
+)
+
+// CheckKeyFilePermissions returns an error if the private key file at path is
+// readable, writable or executable by its group or by others. Use it to refuse
+// loading a key which has been left exposed on disk.
+// On Windows, where Unix permissions do not apply, it always returns nil.
+func CheckKeyFilePermissions(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("private key file %s has insecure permissions %#o, must not be accessible by group or others", path, perm)
+	}
+	return nil
+}
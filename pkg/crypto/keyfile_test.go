@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package crypto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckKeyFilePermissions(t *testing.T) {
+	for _, tt := range []struct {
+		mode    os.FileMode
+		wantErr bool
+	}{
+		{0600, false},
+		{0400, false},
+		{0640, true},
+		{0644, true},
+		{0604, true},
+	} {
+		path := filepath.Join(t.TempDir(), "key.pem")
+		if err := os.WriteFile(path, []byte("key"), tt.mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, tt.mode); err != nil {
+			t.Fatal(err)
+		}
+		err := CheckKeyFilePermissions(path)
+		if have, want := err != nil, tt.wantErr; have != want {
+			t.Errorf("mode %#o: have error %v, want error %t", tt.mode, err, want)
+		}
+	}
+
+	if err := CheckKeyFilePermissions(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
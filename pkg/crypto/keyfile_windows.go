@@ -0,0 +1,6 @@
+package crypto
+
+// CheckKeyFilePermissions is a no-op on Windows, where Unix permissions do not apply.
+func CheckKeyFilePermissions(path string) error {
+	return nil
+}
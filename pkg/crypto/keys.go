@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// MatchKeyPair returns an error if the public key of cert does not belong to key.
+func MatchKeyPair(cert *x509.Certificate, key *rsa.PrivateKey) error {
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("certificate public key is %T, but private key is RSA", cert.PublicKey)
+	}
+	if pub.N.Cmp(key.N) != 0 {
+		return errors.New("certificate public key modulus does not match private key")
+	}
+	if pub.E != key.E {
+		return errors.New("certificate public key exponent does not match private key")
+	}
+	return nil
+}
+
+// MatchSigner is like MatchKeyPair but supports any crypto.Signer
+// with a comparable public key, such as RSA, ECDSA and Ed25519 keys.
+func MatchSigner(cert *x509.Certificate, key crypto.Signer) error {
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		return MatchKeyPair(cert, rsaKey)
+	}
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return fmt.Errorf("unsupported private key type %T", key)
+	}
+	if !pub.Equal(cert.PublicKey) {
+		return fmt.Errorf("certificate public key does not match %T private key", key)
+	}
+	return nil
+}
+
+// KeyInfo summarizes the key strength of a certificate.
+type KeyInfo struct {
+	// Algorithm is the public key algorithm, one of "RSA", "ECDSA" or "Ed25519".
+	Algorithm string `json:"algorithm"`
+	// Bits is the RSA modulus size or the elliptic curve size.
+	Bits int `json:"bits"`
+	// SignatureAlgorithm is the algorithm the certificate was signed with, e.g. "SHA256-RSA".
+	SignatureAlgorithm string `json:"signature_algorithm"`
+}
+
+// CertificateKeyInfo returns the KeyInfo of cert. RSA, ECDSA and Ed25519
+// public keys are supported.
+func CertificateKeyInfo(cert *x509.Certificate) (KeyInfo, error) {
+	info := KeyInfo{
+		Algorithm:          cert.PublicKeyAlgorithm.String(),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+	}
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		info.Bits = pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.Bits = pub.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		info.Bits = 256
+	default:
+		return KeyInfo{}, fmt.Errorf("unsupported public key type %T", cert.PublicKey)
+	}
+	return info, nil
+}
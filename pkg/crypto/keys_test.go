@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+)
+
+func TestMatchKeyPair(t *testing.T) {
+	key, cert, err := SimpleSelfSignedRSAKeypair("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := MatchKeyPair(cert, key); err != nil {
+		t.Errorf("matching key pair: %s", err)
+	}
+	if err := MatchKeyPair(cert, mustRSAKey(t)); err == nil {
+		t.Error("expected error for mismatched key pair")
+	}
+
+	ecKey, ecCert, err := SimpleSelfSignedECDSAKeypair("test", elliptic.P256(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := MatchKeyPair(ecCert, key); err == nil {
+		t.Error("expected error for ECDSA certificate and RSA key")
+	}
+	if err := MatchSigner(ecCert, ecKey); err != nil {
+		t.Errorf("matching ECDSA key pair: %s", err)
+	}
+	if err := MatchSigner(cert, key); err != nil {
+		t.Errorf("matching RSA signer: %s", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := MatchSigner(ecCert, otherKey); err == nil {
+		t.Error("expected error for mismatched ECDSA key pair")
+	}
+}
+
+func TestCertificateKeyInfo(t *testing.T) {
+	push, err := ReadPEMCertificateFile("testdata/mock_push_cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rsa4096, err := SimpleSelfSignedRSAKeypairWithBits("test", 4096, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p384, err := SimpleSelfSignedECDSAKeypair("test", elliptic.P384(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed, err := SimpleSelfSignedEd25519Keypair("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want KeyInfo
+	}{
+		{"RSA fixture", push, KeyInfo{"RSA", 2048, "SHA256-RSA"}},
+		{"RSA 4096", rsa4096, KeyInfo{"RSA", 4096, "SHA256-RSA"}},
+		{"ECDSA P-384", p384, KeyInfo{"ECDSA", 384, "ECDSA-SHA384"}},
+		{"Ed25519", ed, KeyInfo{"Ed25519", 256, "Ed25519"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			have, err := CertificateKeyInfo(tt.cert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != tt.want {
+				t.Errorf("have %+v, want %+v", have, tt.want)
+			}
+		})
+	}
+}
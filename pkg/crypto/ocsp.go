@@ -0,0 +1,57 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// maxOCSPResponseSize limits how much of an OCSP responder reply is read.
+const maxOCSPResponseSize = 1 << 20
+
+// CheckOCSP asks the OCSP responder at ocspURL for the status of cert, which
+// must have been issued by issuer. The response signature is validated against
+// issuer. If client is nil, http.DefaultClient is used.
+//
+// A nil error only means a valid response was received; callers must check the
+// Status of the response (ocsp.Good, ocsp.Revoked or ocsp.Unknown).
+func CheckOCSP(cert, issuer *x509.Certificate, ocspURL string, client *http.Client) (*ocsp.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create OCSP request: %w", err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, ocspURL, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/ocsp-request")
+	httpReq.Header.Set("Accept", "application/ocsp-response")
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send OCSP request: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP responder returned HTTP status %d", httpResp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, maxOCSPResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("read OCSP response: %w", err)
+	}
+
+	resp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("parse OCSP response: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,90 @@
+package crypto
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspServer returns a test OCSP responder that replies with the recorded response at path.
+func ocspServer(t *testing.T, path string) *httptest.Server {
+	t.Helper()
+	resp, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/ocsp-request" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if _, err := ocsp.ParseRequest(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheckOCSP(t *testing.T) {
+	issuer, err := ReadPEMCertificateFile("testdata/ocsp_ca.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		certPath   string
+		respPath   string
+		wantStatus int
+		wantErr    bool
+	}{
+		{"good", "testdata/ocsp_good.pem", "testdata/ocsp_good.der", ocsp.Good, false},
+		{"revoked", "testdata/ocsp_revoked.pem", "testdata/ocsp_revoked.der", ocsp.Revoked, false},
+		{"response for another certificate", "testdata/ocsp_good.pem", "testdata/ocsp_revoked.der", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := ReadPEMCertificateFile(tt.certPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := ocspServer(t, tt.respPath)
+
+			resp, err := CheckOCSP(cert, issuer, srv.URL, srv.Client())
+			if have, want := err != nil, tt.wantErr; have != want {
+				t.Fatalf("have error %v, want error %v", err, want)
+			}
+			if tt.wantErr {
+				return
+			}
+			if have, want := resp.Status, tt.wantStatus; have != want {
+				t.Errorf("have status %d, want %d", have, want)
+			}
+		})
+	}
+}
+
+func TestCheckOCSPWrongIssuer(t *testing.T) {
+	cert, err := ReadPEMCertificateFile("testdata/ocsp_good.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := SimpleSelfSignedCA("other-ca", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := ocspServer(t, "testdata/ocsp_good.der")
+
+	if _, err := CheckOCSP(cert, other, srv.URL, srv.Client()); err == nil {
+		t.Error("expected error validating OCSP response against the wrong issuer")
+	}
+}
@@ -0,0 +1,75 @@
+package crypto
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ReadPKCS12File reads an RSA identity from a PKCS#12 (.p12) file, such as
+// an APNs certificate exported from Keychain. It returns the certificate
+// matching the private key, the key and any other (CA) certificates in the file.
+func ReadPKCS12File(path string, password string) (*x509.Certificate, *rsa.PrivateKey, []*x509.Certificate, error) {
+	pfxData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return decodePKCS12(pfxData, password)
+}
+
+func decodePKCS12(pfxData []byte, password string) (*x509.Certificate, *rsa.PrivateKey, []*x509.Certificate, error) {
+	privateKey, first, rest, err := pkcs12.DecodeChain(pfxData, password)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("decode pkcs12: %w", err)
+	}
+	key, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, nil, errors.New("pkcs12 private key is not a valid RSA key")
+	}
+
+	// The leaf is not guaranteed to be the first certificate bag.
+	var (
+		leaf    *x509.Certificate
+		caCerts []*x509.Certificate
+	)
+	for _, cert := range append([]*x509.Certificate{first}, rest...) {
+		if leaf == nil && MatchKeyPair(cert, key) == nil {
+			leaf = cert
+			continue
+		}
+		caCerts = append(caCerts, cert)
+	}
+	if leaf == nil {
+		return nil, nil, nil, errors.New("pkcs12 contains no certificate matching the private key")
+	}
+	return leaf, key, caCerts, nil
+}
+
+// WritePKCS12File writes cert, key and caCerts to path as a password protected
+// PKCS#12 file. Keys and certificates are encrypted with PBES2 (PBKDF2-HMAC-SHA256
+// and AES-256-CBC), which is readable by OpenSSL 1.1.1+ and current macOS Keychain.
+// Use WriteLegacyPKCS12File for older software.
+func WritePKCS12File(cert *x509.Certificate, key *rsa.PrivateKey, caCerts []*x509.Certificate, password, path string) error {
+	return writePKCS12File(pkcs12.Modern2023, cert, key, caCerts, password, path)
+}
+
+// WriteLegacyPKCS12File is like WritePKCS12File but uses the legacy
+// SHA1/3DES encoding, which is weak but understood by almost all software.
+func WriteLegacyPKCS12File(cert *x509.Certificate, key *rsa.PrivateKey, caCerts []*x509.Certificate, password, path string) error {
+	return writePKCS12File(pkcs12.LegacyDES, cert, key, caCerts, password, path)
+}
+
+func writePKCS12File(enc *pkcs12.Encoder, cert *x509.Certificate, key *rsa.PrivateKey, caCerts []*x509.Certificate, password, path string) error {
+	if err := MatchKeyPair(cert, key); err != nil {
+		return err
+	}
+	pfxData, err := enc.Encode(key, cert, caCerts, password)
+	if err != nil {
+		return fmt.Errorf("encode pkcs12: %w", err)
+	}
+	return ioutil.WriteFile(path, pfxData, 0600)
+}
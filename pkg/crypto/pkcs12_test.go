@@ -0,0 +1,83 @@
+package crypto
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadPKCS12File(t *testing.T) {
+	cert, key, caCerts, err := ReadPKCS12File("testdata/identity.p12", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cert.Subject.CommonName, "micromdm-test-identity"; have != want {
+		t.Errorf("have CN %s, want %s", have, want)
+	}
+	if err := MatchKeyPair(cert, key); err != nil {
+		t.Error(err)
+	}
+	if have, want := len(caCerts), 1; have != want {
+		t.Errorf("have %d CA certificates, want %d", have, want)
+	}
+
+	if _, _, _, err := ReadPKCS12File("testdata/identity.p12", "wrong"); err == nil {
+		t.Error("expected error reading pkcs12 with wrong password")
+	}
+}
+
+func TestWritePKCS12File(t *testing.T) {
+	cert, key, caCerts, err := ReadPKCS12File("testdata/identity.p12", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		write func(*x509.Certificate, *rsa.PrivateKey, []*x509.Certificate, string, string) error
+	}{
+		{"modern", WritePKCS12File},
+		{"legacy", WriteLegacyPKCS12File},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "identity.p12")
+			if err := tt.write(cert, key, caCerts, "backup", path); err != nil {
+				t.Fatal(err)
+			}
+
+			gotCert, gotKey, gotCACerts, err := ReadPKCS12File(path, "backup")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !gotCert.Equal(cert) {
+				t.Error("certificate did not round-trip")
+			}
+			if !gotKey.Equal(key) {
+				t.Error("private key did not round-trip")
+			}
+			if have, want := len(gotCACerts), len(caCerts); have != want {
+				t.Fatalf("have %d CA certificates, want %d", have, want)
+			}
+			if !gotCACerts[0].Equal(caCerts[0]) {
+				t.Error("CA certificate did not round-trip")
+			}
+
+			if _, _, _, err := ReadPKCS12File(path, "secret"); err == nil {
+				t.Error("expected error reading pkcs12 with wrong password")
+			}
+		})
+	}
+}
+
+func TestWritePKCS12FileMismatchedKey(t *testing.T) {
+	cert, _, _, err := ReadPKCS12File("testdata/identity.p12", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "identity.p12")
+	if err := WritePKCS12File(cert, mustRSAKey(t), nil, "backup", path); err == nil {
+		t.Error("expected error writing pkcs12 with mismatched key")
+	}
+}
@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// DegeneratePKCS7 returns the DER encoding of a "degenerate" PKCS7 SignedData
+// object which carries only certs and has no content or signers, such as the
+// CA chain returned to an enrolling SCEP client.
+func DegeneratePKCS7(certs ...*x509.Certificate) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates for degenerate pkcs7")
+	}
+	var der []byte
+	for _, cert := range certs {
+		der = append(der, cert.Raw...)
+	}
+	return pkcs7.DegenerateCertificate(der)
+}
+
+// EncryptPKCS7 returns the DER encoding of a PKCS7 EnvelopedData object which
+// encrypts data to each of the recipients, e.g. a profile destined for a
+// device encrypted to its identity certificate. The content encryption
+// algorithm is set by the pkcs7.ContentEncryptionAlgorithm package variable.
+func EncryptPKCS7(data []byte, recipients []*x509.Certificate) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients for encrypted pkcs7")
+	}
+	return pkcs7.Encrypt(data, recipients)
+}
+
+// DecryptPKCS7 decrypts the DER encoded PKCS7 EnvelopedData object enc using
+// the recipient cert and its private key.
+func DecryptPKCS7(enc []byte, cert *x509.Certificate, key crypto.Signer) ([]byte, error) {
+	p7, err := pkcs7.Parse(enc)
+	if err != nil {
+		return nil, err
+	}
+	return p7.Decrypt(cert, key)
+}
+
+// SignPKCS7 returns the DER encoding of a PKCS7 SignedData object which
+// signs and embeds data with the signer identity, e.g. a signed profile.
+// The intermediates are included so that devices can build the signer's chain.
+func SignPKCS7(data []byte, signer *Identity, intermediates ...*x509.Certificate) ([]byte, error) {
+	if signer == nil || signer.Certificate == nil || signer.PrivateKey == nil {
+		return nil, errors.New("pkcs7 signer requires a certificate and private key")
+	}
+	sd, err := pkcs7.NewSignedData(data)
+	if err != nil {
+		return nil, err
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := sd.AddSignerChain(signer.Certificate, signer.PrivateKey, intermediates, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, err
+	}
+	return sd.Finish()
+}
@@ -0,0 +1,116 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/x509"
+	"testing"
+
+	"go.mozilla.org/pkcs7"
+)
+
+func TestDegeneratePKCS7(t *testing.T) {
+	_, ca, err := SimpleSelfSignedCA("ca", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, leaf, err := SimpleSelfSignedRSAKeypair("leaf", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := DegeneratePKCS7(ca, leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p7.Content) != 0 {
+		t.Errorf("unexpected content %x", p7.Content)
+	}
+	if len(p7.Signers) != 0 {
+		t.Errorf("have %d signers, want none", len(p7.Signers))
+	}
+	if have, want := len(p7.Certificates), 2; have != want {
+		t.Fatalf("have %d certificates, want %d", have, want)
+	}
+	for i, cert := range []*x509.Certificate{ca, leaf} {
+		if !bytes.Equal(p7.Certificates[i].Raw, cert.Raw) {
+			t.Errorf("certificate %d does not match", i)
+		}
+	}
+
+	if _, err := DegeneratePKCS7(); err == nil {
+		t.Error("expected error without certificates")
+	}
+}
+
+func TestEncryptPKCS7(t *testing.T) {
+	key, cert, err := SimpleSelfSignedRSAKeypair("device", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("<plist>profile</plist>")
+
+	enc, err := EncryptPKCS7(data, []*x509.Certificate{cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(enc, data) {
+		t.Error("encrypted pkcs7 contains the plaintext")
+	}
+
+	decrypted, err := DecryptPKCS7(enc, cert, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Errorf("have %q, want %q", decrypted, data)
+	}
+
+	wrongKey := mustRSAKey(t)
+	if _, err := DecryptPKCS7(enc, cert, wrongKey); err == nil {
+		t.Error("expected error decrypting with the wrong key")
+	}
+
+	if _, err := EncryptPKCS7(data, nil); err == nil {
+		t.Error("expected error without recipients")
+	}
+}
+
+func TestSignPKCS7(t *testing.T) {
+	caKey := mustRSAKey(t)
+	caTmpl := caTemplate(t, "ca")
+	ca := issueCert(t, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+
+	key := mustRSAKey(t)
+	template, err := simpleTemplate("signer", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := issueCert(t, template, ca, &key.PublicKey, caKey)
+	data := []byte("<plist>profile</plist>")
+
+	signed, err := SignPKCS7(data, &Identity{Certificate: cert, PrivateKey: key}, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p7.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p7.Content, data) {
+		t.Errorf("have content %q, want %q", p7.Content, data)
+	}
+	if have, want := len(p7.Certificates), 2; have != want {
+		t.Errorf("have %d certificates, want the signer and intermediate", have)
+	}
+
+	if _, err := SignPKCS7(data, nil); err == nil {
+		t.Error("expected error without a signer")
+	}
+}
@@ -0,0 +1,246 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const encryptedPKCS8PrivateKeyPEMBlockType = "ENCRYPTED PRIVATE KEY"
+
+// pbkdf2Iterations is the PBKDF2 iteration count used when encrypting keys.
+const pbkdf2Iterations = 100000
+
+// maxPBKDF2Iterations limits the PBKDF2 iteration count of the keys which are
+// decrypted, so that a crafted key file can not hang the process.
+const maxPBKDF2Iterations = 10000000
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is the ASN.1 structure of an encrypted PKCS#8 key (RFC 5208).
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params is the ASN.1 structure of the PBES2 parameters (RFC 8018).
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params is the ASN.1 structure of the PBKDF2 parameters (RFC 8018).
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// WriteEncryptedPKCS8KeyFile writes key to path as a PKCS#8 "ENCRYPTED PRIVATE KEY"
+// PEM block, encrypted with PBES2 using PBKDF2-HMAC-SHA256 and AES-256-CBC.
+// The file is only readable and writable by its owner (0600).
+func WriteEncryptedPKCS8KeyFile(key crypto.Signer, password []byte, path string) error {
+	file, err := createKeyFile(path, keyFileMode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return WriteEncryptedPKCS8Key(file, key, password)
+}
+
+// WriteEncryptedPKCS8Key writes key to w as an encrypted PKCS#8 PEM block.
+// See WriteEncryptedPKCS8KeyFile.
+func WriteEncryptedPKCS8Key(w io.Writer, key crypto.Signer, password []byte) error {
+	block, err := encryptPKCS8PEMBlock(key, password)
+	if err != nil {
+		return err
+	}
+	return pem.Encode(w, block)
+}
+
+func encryptPKCS8PEMBlock(key crypto.Signer, password []byte) (*pem.Block, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	encKey := pbkdf2.Key(password, salt, pbkdf2Iterations, 32, sha256.New)
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := pkcs7Pad(der, aes.BlockSize)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pbkdf2Iterations,
+		PRF: pkix.AlgorithmIdentifier{
+			Algorithm:  oidHMACWithSHA256,
+			Parameters: asn1.NullRawValue,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBKDF2,
+			Parameters: asn1.RawValue{FullBytes: kdfParams},
+		},
+		EncryptionScheme: pkix.AlgorithmIdentifier{
+			Algorithm:  oidAES256CBC,
+			Parameters: asn1.RawValue{FullBytes: ivParams},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	info, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBES2,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		EncryptedData: encrypted,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pem.Block{Type: encryptedPKCS8PrivateKeyPEMBlockType, Bytes: info}, nil
+}
+
+// decryptPKCS8 decrypts the DER contents of an "ENCRYPTED PRIVATE KEY" PEM block
+// and returns the DER of the unencrypted PKCS#8 key and the name of the cipher
+// used. Only PBES2 with PBKDF2 and AES-CBC is supported.
+func decryptPKCS8(der, password []byte) ([]byte, string, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, "", fmt.Errorf("parsing encrypted PKCS#8 key: %w", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, "", fmt.Errorf("unsupported PKCS#8 encryption algorithm %s", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, "", fmt.Errorf("parsing PBES2 parameters: %w", err)
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, "", fmt.Errorf("unsupported PBES2 key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, "", fmt.Errorf("parsing PBKDF2 parameters: %w", err)
+	}
+	if n := kdfParams.IterationCount; n < 1 || n > maxPBKDF2Iterations {
+		return nil, "", fmt.Errorf("invalid PBKDF2 iteration count %d, must be between 1 and %d", n, maxPBKDF2Iterations)
+	}
+	var prf func() hash.Hash
+	switch alg := kdfParams.PRF.Algorithm; {
+	case len(alg) == 0 || alg.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case alg.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, "", fmt.Errorf("unsupported PBKDF2 PRF %s", alg)
+	}
+
+	var keyLen int
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen = 16
+	case alg.Equal(oidAES192CBC):
+		keyLen = 24
+	case alg.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, "", fmt.Errorf("unsupported PBES2 encryption scheme %s", alg)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, "", fmt.Errorf("parsing PBES2 IV: %w", err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, "", errors.New("invalid PBES2 IV length")
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, "", errors.New("invalid encrypted PKCS#8 data length")
+	}
+
+	encKey := pbkdf2.Key(password, kdfParams.Salt, kdfParams.IterationCount, keyLen, prf)
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, "", err
+	}
+	decrypted := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.EncryptedData)
+
+	decrypted, err = pkcs7Unpad(decrypted, aes.BlockSize)
+	if err != nil {
+		return nil, "", x509.IncorrectPasswordError
+	}
+	return decrypted, fmt.Sprintf("AES-%d-CBC", keyLen*8), nil
+}
+
+func pkcs7Pad(b []byte, blockSize int) []byte {
+	n := blockSize - len(b)%blockSize
+	padded := make([]byte, len(b), len(b)+n)
+	copy(padded, b)
+	for i := 0; i < n; i++ {
+		padded = append(padded, byte(n))
+	}
+	return padded
+}
+
+func pkcs7Unpad(b []byte, blockSize int) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, errors.New("invalid padding")
+	}
+	n := int(b[len(b)-1])
+	if n == 0 || n > blockSize || n > len(b) {
+		return nil, errors.New("invalid padding")
+	}
+	for _, c := range b[len(b)-n:] {
+		if int(c) != n {
+			return nil, errors.New("invalid padding")
+		}
+	}
+	return b[:len(b)-n], nil
+}
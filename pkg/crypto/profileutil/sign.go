@@ -5,21 +5,38 @@ import (
 	"crypto"
 	"crypto/x509"
 
+	"github.com/groob/plist"
 	"github.com/pkg/errors"
 	"go.mozilla.org/pkcs7"
+
+	mdmcrypto "github.com/micromdm/micromdm/pkg/crypto"
 )
 
 // Sign takes an unsigned payload and signs it with the provided private key and certificate.
-func Sign(key crypto.PrivateKey, cert *x509.Certificate, mobileconfig []byte) ([]byte, error) {
+// The intermediates are embedded so that devices can build the chain of cert.
+func Sign(key crypto.PrivateKey, cert *x509.Certificate, mobileconfig []byte, intermediates ...*x509.Certificate) ([]byte, error) {
 	sd, err := pkcs7.NewSignedData(mobileconfig)
 	if err != nil {
 		return nil, errors.Wrap(err, "create signed data for mobileconfig")
 	}
 
-	if err := sd.AddSigner(cert, key, pkcs7.SignerInfoConfig{}); err != nil {
+	if err := sd.AddSignerChain(cert, key, intermediates, pkcs7.SignerInfoConfig{}); err != nil {
 		return nil, errors.Wrap(err, "add crypto signer to mobileconfig signed data")
 	}
 
 	signedMobileconfig, err := sd.Finish()
 	return signedMobileconfig, errors.Wrap(err, "complete mobileconfig signing")
 }
+
+// SignProfile signs the mobileconfig plist raw with the signer identity, so that
+// the profile is shown as verified on devices. The signed profile embeds raw
+// and the intermediates of the signer certificate, and its signature can be
+// verified with the signer certificate.
+func SignProfile(raw []byte, signer *mdmcrypto.Identity, intermediates ...*x509.Certificate) ([]byte, error) {
+	var profile map[string]interface{}
+	if err := plist.Unmarshal(raw, &profile); err != nil {
+		return nil, errors.Wrap(err, "mobileconfig is not a plist, it may already be signed")
+	}
+	signed, err := mdmcrypto.SignPKCS7(raw, signer, intermediates...)
+	return signed, errors.Wrap(err, "sign mobileconfig")
+}
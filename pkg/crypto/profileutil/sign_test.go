@@ -0,0 +1,124 @@
+package profileutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+
+	mdmcrypto "github.com/micromdm/micromdm/pkg/crypto"
+)
+
+const testMobileconfig = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadIdentifier</key>
+	<string>com.example.profile</string>
+	<key>PayloadType</key>
+	<string>Configuration</string>
+	<key>PayloadUUID</key>
+	<string>6E1A0D59-4D6E-4C6A-9C94-2B1F6B1D6E10</string>
+	<key>PayloadVersion</key>
+	<integer>1</integer>
+</dict>
+</plist>`
+
+func TestSignProfile(t *testing.T) {
+	key, cert, err := mdmcrypto.SimpleSelfSignedRSAKeypair("profile signer", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &mdmcrypto.Identity{Certificate: cert, PrivateKey: key}
+
+	signed, err := SignProfile([]byte(testMobileconfig), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p7.Verify(); err != nil {
+		t.Fatalf("verify signed profile: %s", err)
+	}
+	if !bytes.Equal(p7.Content, []byte(testMobileconfig)) {
+		t.Error("signed profile content does not match the mobileconfig")
+	}
+	if signerCert := p7.GetOnlySigner(); signerCert == nil || !bytes.Equal(signerCert.Raw, cert.Raw) {
+		t.Error("signed profile is not signed by the signer certificate")
+	}
+
+	if _, err := SignProfile(signed, signer); err == nil {
+		t.Error("expected error signing a signed profile")
+	}
+	if _, err := SignProfile([]byte(testMobileconfig), &mdmcrypto.Identity{Certificate: cert}); err == nil {
+		t.Error("expected error for a signer without a private key")
+	}
+}
+
+func TestSignProfileWithIntermediates(t *testing.T) {
+	rootKey, root := issueCert(t, "root", nil, nil, true)
+	intermediateKey, intermediate := issueCert(t, "intermediate", root, rootKey, true)
+	key, cert := issueCert(t, "profile signer", intermediate, intermediateKey, false)
+	signer := &mdmcrypto.Identity{Certificate: cert, PrivateKey: key}
+
+	signed, err := SignProfile([]byte(testMobileconfig), signer, intermediate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(root)
+	if err := p7.VerifyWithChain(pool); err != nil {
+		t.Fatalf("verify signed profile with root: %s", err)
+	}
+	var embedded bool
+	for _, c := range p7.Certificates {
+		if bytes.Equal(c.Raw, intermediate.Raw) {
+			embedded = true
+		}
+	}
+	if !embedded {
+		t.Error("intermediate certificate is not embedded in the signed profile")
+	}
+}
+
+func issueCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *rsa.PrivateKey, isCA bool) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
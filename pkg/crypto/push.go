@@ -0,0 +1,86 @@
+package crypto
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// minPushKeyBits is the minimum RSA key size accepted for push certificates.
+const minPushKeyBits = 2048
+
+// PushCertificateError lists all problems found by ValidatePushCertificate.
+type PushCertificateError struct {
+	Problems []error
+}
+
+func (e *PushCertificateError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, err := range e.Problems {
+		msgs[i] = err.Error()
+	}
+	return "invalid push certificate: " + strings.Join(msgs, "; ")
+}
+
+// ValidatePushCertificate checks that cert is usable as an APNs MDM push
+// certificate. It must have a push topic, an RSA key of at least 2048 bits,
+// client auth extended key usage and must not have expired.
+// All problems found are returned in a *PushCertificateError.
+func ValidatePushCertificate(cert *x509.Certificate) error {
+	return (&ExpiryChecker{}).ValidatePushCertificate(cert)
+}
+
+// ValidatePushCertificate is like the package level ValidatePushCertificate
+// but checks expiry against the ExpiryChecker clock.
+func (c *ExpiryChecker) ValidatePushCertificate(cert *x509.Certificate) error {
+	var problems []error
+	if _, err := TopicFromCert(cert); err != nil {
+		problems = append(problems, err)
+	}
+
+	if pub, ok := cert.PublicKey.(*rsa.PublicKey); !ok {
+		problems = append(problems, fmt.Errorf("public key must be RSA, was %T", cert.PublicKey))
+	} else if bits := pub.N.BitLen(); bits < minPushKeyBits {
+		problems = append(problems, fmt.Errorf("RSA key must be at least %d bits, was %d", minPushKeyBits, bits))
+	}
+
+	if !c.now().Before(cert.NotAfter) {
+		problems = append(problems, fmt.Errorf("certificate expired on %s", cert.NotAfter.Format("2006-01-02")))
+	}
+
+	var clientAuth bool
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageClientAuth {
+			clientAuth = true
+		}
+	}
+	if !clientAuth {
+		problems = append(problems, fmt.Errorf("extended key usage must include client auth"))
+	}
+
+	if len(problems) > 0 {
+		return &PushCertificateError{Problems: problems}
+	}
+	return nil
+}
+
+// PushTLSConfig returns a TLS client configuration for connecting to the APNs
+// HTTP/2 gateway with the push identity. The identity certificate must carry a
+// push topic. ServerName is left empty so that it is taken from the URL of the
+// gateway (production or sandbox) being dialed.
+func PushTLSConfig(identity Identity) (*tls.Config, error) {
+	if identity.Certificate == nil || identity.PrivateKey == nil {
+		return nil, errors.New("push identity must have a certificate and private key")
+	}
+	if _, err := TopicFromCert(identity.Certificate); err != nil {
+		return nil, fmt.Errorf("identity is not an APNs push certificate: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{identity.TLSCertificate()},
+		NextProtos:   []string{"h2"},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package crypto
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidatePushCertificate(t *testing.T) {
+	template, err := simpleTemplate("APSP:test", 365)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.Subject.ExtraNames = []pkix.AttributeTypeAndValue{{
+		Type:  oidASN1UserID,
+		Value: "com.apple.mgmt.External.18a16429-886b-41f1-9c30-2bd04ae4fc37",
+	}}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	cert, err := selfSign(template, mustRSAKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidatePushCertificate(cert); err != nil {
+		t.Errorf("valid push certificate: %s", err)
+	}
+
+	expired := &ExpiryChecker{Now: func() time.Time { return cert.NotAfter.Add(time.Hour) }}
+	err = expired.ValidatePushCertificate(cert)
+	var pushErr *PushCertificateError
+	if !errors.As(err, &pushErr) || len(pushErr.Problems) != 1 {
+		t.Errorf("have %v, want expiry problem", err)
+	}
+
+	// a plain self-signed cert has neither a topic nor client auth usage.
+	_, other, err := SimpleSelfSignedRSAKeypair("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ValidatePushCertificate(other)
+	if !errors.As(err, &pushErr) || len(pushErr.Problems) != 2 {
+		t.Errorf("have %v, want topic and usage problems", err)
+	}
+}
+
+func TestPushTLSConfig(t *testing.T) {
+	key := mustRSAKey(t)
+	template, err := simpleTemplate("APSP:test", 365)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.Subject.ExtraNames = []pkix.AttributeTypeAndValue{{
+		Type:  oidASN1UserID,
+		Value: "com.apple.mgmt.External.18a16429-886b-41f1-9c30-2bd04ae4fc37",
+	}}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	cert, err := selfSign(template, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := PushTLSConfig(Identity{Certificate: cert, PrivateKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cfg.NextProtos, []string{"h2"}; len(have) != 1 || have[0] != want[0] {
+		t.Errorf("have NextProtos %v, want %v", have, want)
+	}
+	if have, want := len(cfg.Certificates), 1; have != want {
+		t.Fatalf("have %d certificates, want %d", have, want)
+	}
+	leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TopicFromCert(leaf); err != nil {
+		t.Errorf("config leaf has no push topic: %s", err)
+	}
+
+	otherKey, other, err := SimpleSelfSignedRSAKeypair("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PushTLSConfig(Identity{Certificate: other, PrivateKey: otherKey}); err == nil {
+		t.Error("expected error building push TLS config from a non-push certificate")
+	}
+}
@@ -1,3 +1,8 @@
 #!/usr/bin/env bash
 
 openssl req -newkey rsa:2048 -nodes -keyout key.pem -x509 -days 18262 -out certificate.pem -subj "/UID=com.apple.mgmt.External.18a16429-886b-41f1-9c30-2bd04ae4fc37/CN=APSP:17a16429-886b-41f1-8c90-3bd02ae9fc57/C=US"
+
+printf "push" | openssl cms -sign -signer certificate.pem -inkey key.pem -outform DER -nodetach -out mock_push_cert.p7
+
+# Same topic carried in a certificate extension rather than the subject UID.
+openssl req -newkey rsa:2048 -nodes -keyout key_ext_topic.pem -x509 -days 18262 -out mock_push_cert_ext_topic.pem -subj "/CN=APSP:17a16429-886b-41f1-8c90-3bd02ae9fc57/C=US" -addext "0.9.2342.19200300.100.1.1=ASN1:UTF8String:com.apple.mgmt.External.18a16429-886b-41f1-9c30-2bd04ae4fc37"
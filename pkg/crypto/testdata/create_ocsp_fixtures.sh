@@ -0,0 +1,24 @@
+#!/usr/bin/env bash
+
+# Recorded OCSP responses for a "good" and a "revoked" certificate issued by ocsp_ca.pem.
+
+set -e
+
+openssl req -newkey rsa:2048 -nodes -keyout ca.key -x509 -days 18262 -out ocsp_ca.pem -subj "/CN=micromdm-test-ocsp-ca"
+openssl req -newkey rsa:2048 -nodes -keyout good.key -out good.csr -subj "/CN=device-good"
+openssl req -newkey rsa:2048 -nodes -keyout revoked.key -out revoked.csr -subj "/CN=device-revoked"
+openssl x509 -req -in good.csr -CA ocsp_ca.pem -CAkey ca.key -set_serial 0x1000 -days 18262 -out ocsp_good.pem
+openssl x509 -req -in revoked.csr -CA ocsp_ca.pem -CAkey ca.key -set_serial 0x1001 -days 18262 -out ocsp_revoked.pem
+
+touch index.txt
+printf '[ca]\ndefault_ca=d\n[d]\ndatabase=index.txt\ndefault_md=sha256\n' > ca.cnf
+openssl ca -config ca.cnf -valid ocsp_good.pem -keyfile ca.key -cert ocsp_ca.pem
+openssl ca -config ca.cnf -valid ocsp_revoked.pem -keyfile ca.key -cert ocsp_ca.pem
+openssl ca -config ca.cnf -revoke ocsp_revoked.pem -keyfile ca.key -cert ocsp_ca.pem
+
+for n in good revoked; do
+	openssl ocsp -index index.txt -rsigner ocsp_ca.pem -rkey ca.key -CA ocsp_ca.pem -issuer ocsp_ca.pem \
+		-cert ocsp_$n.pem -no_nonce -ndays 18262 -respout ocsp_$n.der
+done
+
+rm ca.key good.key good.csr revoked.key revoked.csr ca.cnf index.txt*
@@ -0,0 +1,34 @@
+package crypto
+
+import (
+	"crypto/tls"
+	"errors"
+)
+
+// LoadTLSCertificate loads a tls.Certificate from a PEM certificate file and
+// an optionally encrypted PEM RSA key file. The certificate file may contain
+// a chain, in which case the leaf must come first and the remaining
+// certificates are presented as intermediates during the handshake.
+func LoadTLSCertificate(certPath, keyPath string, password []byte) (tls.Certificate, error) {
+	certs, err := ReadPEMCertificatesFile(certPath)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	key, err := ReadEncryptedPEMRSAKeyFile(keyPath, password)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf := certs[0]
+	if err := MatchKeyPair(leaf, key); err != nil {
+		return tls.Certificate{}, errors.New("TLS certificate does not match private key: " + err.Error())
+	}
+
+	cert := tls.Certificate{
+		PrivateKey: key,
+		Leaf:       leaf,
+	}
+	for _, c := range certs {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return cert, nil
+}
@@ -0,0 +1,56 @@
+package crypto
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTLSCertificate(t *testing.T) {
+	key, cert, err := SimpleSelfSignedRSAKeypair("localhost", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	if err := WritePEMCertificateFile(cert, certPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteEncryptedPKCS8KeyFile(key, []byte("secret"), keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	tlsCert, err := LoadTLSCertificate(certPath, keyPath, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	server := tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{tlsCert}})
+	errc := make(chan error, 1)
+	go func() { errc <- server.Handshake() }()
+
+	client := tls.Client(clientConn, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err := client.Handshake(); err != nil {
+		t.Fatalf("client handshake: %s", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("server handshake: %s", err)
+	}
+
+	otherKeyPath := filepath.Join(dir, "other.pem")
+	if err := WritePEMRSAKeyFile(mustRSAKey(t), otherKeyPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTLSCertificate(certPath, otherKeyPath, nil); err == nil {
+		t.Error("expected error loading mismatched key pair")
+	}
+}
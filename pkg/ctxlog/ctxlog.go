@@ -0,0 +1,54 @@
+// Package ctxlog adds key/value pairs to a context, so that every log line
+// written for a request includes them, such as the request ID and device UDID.
+package ctxlog
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+)
+
+type contextKey struct{}
+
+type fields struct {
+	mu      sync.Mutex
+	keyvals []interface{}
+}
+
+// NewContext returns a context which key/value pairs can be added to with With.
+// Pairs added to the returned context, or to any context derived from it,
+// are included by every Logger created from it, even if they were added further
+// down the call chain. This lets an HTTP access log include the device UDID
+// decoded by a handler.
+func NewContext(ctx context.Context, keyvals ...interface{}) context.Context {
+	f := &fields{keyvals: keyvals}
+	return context.WithValue(ctx, contextKey{}, f)
+}
+
+// With adds the key/value pairs to the context created with NewContext.
+// It does nothing if ctx was not created with NewContext.
+func With(ctx context.Context, keyvals ...interface{}) {
+	f, ok := ctx.Value(contextKey{}).(*fields)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	f.keyvals = append(f.keyvals, keyvals...)
+	f.mu.Unlock()
+}
+
+// Logger returns logger with the key/value pairs added to ctx.
+func Logger(ctx context.Context, logger log.Logger) log.Logger {
+	f, ok := ctx.Value(contextKey{}).(*fields)
+	if !ok {
+		return logger
+	}
+	f.mu.Lock()
+	keyvals := append([]interface{}(nil), f.keyvals...)
+	f.mu.Unlock()
+	if len(keyvals) == 0 {
+		return logger
+	}
+	return log.With(logger, keyvals...)
+}
@@ -0,0 +1,38 @@
+package ctxlog
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLogfmtLogger(&buf)
+
+	ctx := NewContext(context.Background(), "request_id", "1")
+	child, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// pairs added to a derived context are seen by loggers of the parent.
+	With(child, "udid", "UDID")
+
+	Logger(ctx, logger).Log("msg", "done")
+	if have, want := strings.TrimSpace(buf.String()), "request_id=1 udid=UDID msg=done"; have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+}
+
+func TestLoggerWithoutContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLogfmtLogger(&buf)
+
+	ctx := context.Background()
+	With(ctx, "udid", "UDID")
+	Logger(ctx, logger).Log("msg", "done")
+	if have, want := strings.TrimSpace(buf.String()), "msg=done"; have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+}
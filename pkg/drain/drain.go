@@ -0,0 +1,159 @@
+// Package drain tracks in-flight work so that it can finish before the server shuts down.
+package drain
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrDraining is returned by Start once a Group is closed to new work.
+// It is sent to API clients as 503 Service Unavailable.
+var ErrDraining error = drainingError{}
+
+type drainingError struct{}
+
+func (drainingError) Error() string   { return "server is shutting down, not accepting new work" }
+func (drainingError) StatusCode() int { return http.StatusServiceUnavailable }
+
+// Group counts in-flight work. The zero value is an empty Group which accepts work.
+type Group struct {
+	mu      sync.Mutex
+	n       int
+	started uint64
+	closed  bool
+	idle    chan struct{}
+}
+
+// Start records the start of a unit of work, which must be followed by a call to Done.
+// It returns ErrDraining if the Group was closed.
+func (g *Group) Start() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return ErrDraining
+	}
+	g.n++
+	g.started++
+	return nil
+}
+
+// Add records the start of a unit of work which was already accepted, such as
+// an event being processed, so it is counted even if the Group was closed.
+// It must be followed by a call to Done.
+func (g *Group) Add() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n++
+	g.started++
+}
+
+// Done records the end of a unit of work.
+func (g *Group) Done() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n--
+	if g.n == 0 && g.idle != nil {
+		close(g.idle)
+		g.idle = nil
+	}
+}
+
+// Close stops the Group from accepting new work. The work in progress is not affected.
+func (g *Group) Close() {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+}
+
+// Wait blocks until there is no work in progress, or ctx is done.
+func (g *Group) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	if g.n == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+	if g.idle == nil {
+		g.idle = make(chan struct{})
+	}
+	idle := g.idle
+	g.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "waiting for %d in-flight tasks", g.InFlight())
+	}
+}
+
+// Drain closes the Group and waits for the work in progress to finish.
+func (g *Group) Drain(ctx context.Context) error {
+	g.Close()
+	return g.Wait(ctx)
+}
+
+// InFlight returns the amount of work in progress.
+func (g *Group) InFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.n
+}
+
+func (g *Group) state() (int, uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.n, g.started
+}
+
+// SettleInterval is how long Settle waits for work to be handed from one
+// Group to the next before it considers the Groups idle.
+const SettleInterval = 10 * time.Millisecond
+
+// Settle waits until all of the groups are idle at the same time, for work which is
+// passed along by the groups, such as a published event which is processed by a subscriber.
+// Settle returns once no group started any work for SettleInterval after all of them
+// were idle, or returns an error when ctx is done.
+func Settle(ctx context.Context, groups ...*Group) error {
+	for {
+		for _, g := range groups {
+			if err := g.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		before := startedCount(groups)
+
+		timer := time.NewTimer(SettleInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrap(ctx.Err(), "waiting for in-flight tasks")
+		case <-timer.C:
+		}
+
+		if idle(groups) && startedCount(groups) == before {
+			return nil
+		}
+	}
+}
+
+func startedCount(groups []*Group) uint64 {
+	var total uint64
+	for _, g := range groups {
+		_, started := g.state()
+		total += started
+	}
+	return total
+}
+
+func idle(groups []*Group) bool {
+	for _, g := range groups {
+		if n, _ := g.state(); n != 0 {
+			return false
+		}
+	}
+	return true
+}
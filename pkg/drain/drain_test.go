@@ -0,0 +1,92 @@
+package drain
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGroupDrain(t *testing.T) {
+	var g Group
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- g.Drain(context.Background()) }()
+
+	// wait for Drain to close the group.
+	for {
+		if err := g.Start(); err == ErrDraining {
+			break
+		} else if err == nil {
+			g.Done()
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("Drain returned with work in progress: %v", err)
+	default:
+	}
+
+	// Add counts work which was already accepted, even after Close.
+	g.Add()
+	g.Done()
+	g.Done()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if have := g.InFlight(); have != 0 {
+		t.Errorf("have %d in flight, want 0", have)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	var g Group
+	g.Add()
+	defer g.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := g.Wait(ctx); err == nil {
+		t.Error("expected Wait to time out")
+	}
+}
+
+func TestErrDrainingStatusCode(t *testing.T) {
+	sc, ok := ErrDraining.(interface{ StatusCode() int })
+	if !ok {
+		t.Fatal("ErrDraining does not have a StatusCode")
+	}
+	if have, want := sc.StatusCode(), 503; have != want {
+		t.Errorf("have status %d, want %d", have, want)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	var publisher, subscriber Group
+	handled := make(chan struct{})
+
+	// the work is handed from publisher to subscriber after publisher is idle.
+	publisher.Add()
+	go func() {
+		publisher.Done()
+		subscriber.Add()
+		time.Sleep(5 * SettleInterval)
+		close(handled)
+		subscriber.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Settle(ctx, &publisher, &subscriber); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-handled:
+	default:
+		t.Error("Settle returned before the subscriber was done")
+	}
+}
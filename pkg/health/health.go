@@ -0,0 +1,57 @@
+// Package health serves health and readiness checks for load balancers and orchestrators.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// DefaultTimeout is how long the checks of a Handler may take in total.
+const DefaultTimeout = 5 * time.Second
+
+// Check is a named check which returns an error describing why it failed.
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Response is the body of a health check response. Checks maps the name of
+// each check to "ok" or the reason it failed.
+type Response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Status values of a Response.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Handler runs every check on each request, and responds with 200 OK if they
+// all pass or 503 Service Unavailable if any fails.
+func Handler(checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), DefaultTimeout)
+		defer cancel()
+
+		resp := Response{Status: StatusOK, Checks: make(map[string]string, len(checks))}
+		for _, c := range checks {
+			if err := c.Check(ctx); err != nil {
+				resp.Status = StatusUnavailable
+				resp.Checks[c.Name] = err.Error()
+				continue
+			}
+			resp.Checks[c.Name] = StatusOK
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if resp.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	pass := Check{Name: "pass", Check: func(context.Context) error { return nil }}
+	fail := Check{Name: "fail", Check: func(context.Context) error { return errors.New("datastore is closed") }}
+
+	tests := []struct {
+		name   string
+		checks []Check
+		code   int
+		want   Response
+	}{
+		{"all pass", []Check{pass}, http.StatusOK, Response{StatusOK, map[string]string{"pass": StatusOK}}},
+		{"one fails", []Check{pass, fail}, http.StatusServiceUnavailable,
+			Response{StatusUnavailable, map[string]string{"pass": StatusOK, "fail": "datastore is closed"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Handler(tt.checks...).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+			if rec.Code != tt.code {
+				t.Errorf("have status %d, want %d", rec.Code, tt.code)
+			}
+			var resp Response
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.want.Status || len(resp.Checks) != len(tt.want.Checks) {
+				t.Fatalf("have %+v, want %+v", resp, tt.want)
+			}
+			for name, status := range tt.want.Checks {
+				if resp.Checks[name] != status {
+					t.Errorf("have check %s %q, want %q", name, resp.Checks[name], status)
+				}
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package httputil
 
 import (
 	"context"
-	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,20 +11,38 @@ import (
 	"strings"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
+
+	"github.com/micromdm/micromdm/pkg/crypto"
+	"github.com/micromdm/micromdm/pkg/ctxlog"
 )
 
 func NewRouter(logger log.Logger) (*mux.Router, []httptransport.ServerOption) {
 	r := mux.NewRouter()
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorEncoder(ErrorEncoder),
-		httptransport.ServerErrorLogger(logger),
+		httptransport.ServerErrorHandler(ErrorHandler(logger)),
 		httptransport.ServerBefore(httptransport.PopulateRequestContext),
 	}
 	return r, options
 }
 
+// ErrorHandler logs the errors of a request with the key/value pairs of its
+// context, such as the request ID.
+func ErrorHandler(logger log.Logger) transport.ErrorHandler {
+	return errorHandler{logger: logger}
+}
+
+type errorHandler struct {
+	logger log.Logger
+}
+
+func (h errorHandler) Handle(ctx context.Context, err error) {
+	_ = ctxlog.Logger(ctx, h.logger).Log("err", err)
+}
+
 func EncodeJSONResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if f, ok := response.(failer); ok && f.Failed() != nil {
 		ErrorEncoder(ctx, f.Failed(), w)
@@ -134,7 +151,7 @@ func DecodeJSONResponse(r *http.Response, into interface{}) error {
 func RequireBasicAuth(h http.HandlerFunc, username, password, realm string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		u, p, ok := r.BasicAuth()
-		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(username)) != 1 || subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+		if !ok || !crypto.SecureCompare([]byte(u), []byte(username)) || !crypto.SecureCompare([]byte(p), []byte(password)) {
 			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
 			w.WriteHeader(401)
 			w.Write([]byte("Authorization Required\n"))
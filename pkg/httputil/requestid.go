@@ -0,0 +1,69 @@
+package httputil
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/groob/finalizer"
+	"github.com/groob/finalizer/logutil"
+
+	"github.com/micromdm/micromdm/pkg/ctxlog"
+)
+
+// RequestIDHeader is the header which holds the ID of a request.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestIDMiddleware assigns every request an ID, which is returned in the
+// X-Request-ID response header and logged as request_id by loggers created with
+// ctxlog.Logger. A valid X-Request-ID request header, such as one set by a proxy,
+// is used as the ID instead of a new one.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = ctxlog.NewContext(ctx, "request_id", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the ID assigned to a request by RequestIDMiddleware.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether id is short and only has characters
+// which are safe to write to logs and headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestLogger logs every completed request with logger, including
+// the key/value pairs added to the request context with ctxlog.
+// It must be wrapped by RequestIDMiddleware to log the request ID.
+func RequestLogger(logger log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return finalizer.Middleware(func(ctx context.Context, code int, r *http.Request) {
+			logutil.NewHTTPLogger(ctxlog.Logger(r.Context(), logger)).LoggingFinalizer(ctx, code, r)
+		}, next)
+	}
+}
@@ -0,0 +1,105 @@
+package httputil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/micromdm/micromdm/pkg/ctxlog"
+)
+
+func TestRequestIDLogs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewJSONLogger(&buf)
+	handler := RequestIDMiddleware(RequestLogger(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxlog.With(r.Context(), "udid", "UDID")
+		ctxlog.Logger(r.Context(), logger).Log("msg", "checkin")
+		ctxlog.Logger(r.Context(), logger).Log("msg", "next command")
+	})))
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		buf.Reset()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("PUT", "/mdm/checkin", nil))
+		id := rec.Header().Get(RequestIDHeader)
+		if id == "" {
+			t.Fatalf("missing %s response header", RequestIDHeader)
+		}
+		ids = append(ids, id)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if have, want := len(lines), 3; have != want {
+			t.Fatalf("have %d log lines, want %d:\n%s", have, want, buf.String())
+		}
+		for _, line := range lines {
+			var keyvals map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &keyvals); err != nil {
+				t.Fatal(err)
+			}
+			if have := keyvals["request_id"]; have != id {
+				t.Errorf("have request_id %v, want %s in %s", have, id, line)
+			}
+			if have, want := keyvals["udid"], "UDID"; have != want {
+				t.Errorf("have udid %v, want %s in %s", have, want, line)
+			}
+		}
+	}
+	if ids[0] == ids[1] {
+		t.Errorf("requests share the request ID %s", ids[0])
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	var have string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		have = RequestIDFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		header string
+		keep   bool
+	}{
+		{"proxy-assigned.ID_1", true},
+		{"", false},
+		{"has spaces", false},
+		{"new\nline", false},
+		{strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, tt.header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if have != rec.Header().Get(RequestIDHeader) {
+			t.Errorf("%q: context ID %q does not match the response header %q", tt.header, have, rec.Header().Get(RequestIDHeader))
+		}
+		if (have == tt.header) != tt.keep {
+			t.Errorf("%q: have request ID %q, want kept %v", tt.header, have, tt.keep)
+		}
+		if have == "" {
+			t.Errorf("%q: missing request ID", tt.header)
+		}
+	}
+}
+
+func TestErrorHandlerLogsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLogfmtLogger(&buf)
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ErrorHandler(logger).Handle(r.Context(), errors.New("decode request"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	want := "request_id=" + rec.Header().Get(RequestIDHeader) + " err=\"decode request\""
+	if have := strings.TrimSpace(buf.String()); have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+}
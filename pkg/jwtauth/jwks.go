@@ -0,0 +1,201 @@
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// jwksRefresh is how long fetched keys are used before the JWKS is fetched again.
+	jwksRefresh = time.Hour
+	// jwksMinRefresh limits how often an unknown key ID fetches the JWKS again.
+	jwksMinRefresh = time.Minute
+)
+
+// JWKS is a KeySource which fetches the RSA and P-256 keys of a JSON Web Key Set.
+// The keys are fetched on first use, every hour, and when a token has an
+// unknown key ID, at most once a minute. The known keys are used while the
+// JWKS is fetched again.
+type JWKS struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetched   time.Time
+	attempted time.Time
+	inflight  *jwksFetch
+}
+
+// jwksFetch is a fetch of the JWKS which is in progress. done is closed once
+// it finished with err.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewJWKS creates a JWKS for the key set at url. A nil client uses http.DefaultClient.
+func NewJWKS(url string, client *http.Client) *JWKS {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &JWKS{url: url, client: client, now: time.Now}
+}
+
+// Key returns the key with the key ID kid.
+func (j *JWKS) Key(kid string) (crypto.PublicKey, error) {
+	now := j.now()
+	j.mu.RLock()
+	key, ok := j.keys[kid]
+	stale := now.Sub(j.fetched) >= jwksRefresh
+	j.mu.RUnlock()
+	if ok {
+		if stale {
+			// the known key is used while the JWKS is fetched again, and while
+			// the JWKS endpoint is unavailable.
+			j.refresh(now)
+		}
+		return key, nil
+	}
+
+	f := j.refresh(now)
+	if f == nil {
+		return nil, errors.Errorf("unknown token key ID %q", kid)
+	}
+	<-f.done
+	if f.err != nil {
+		return nil, f.err
+	}
+	j.mu.RLock()
+	key, ok = j.keys[kid]
+	j.mu.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unknown token key ID %q", kid)
+	}
+	return key, nil
+}
+
+// refresh returns the fetch in progress, or starts a new one unless the last
+// one was started less than jwksMinRefresh ago, in which case it returns nil.
+func (j *JWKS) refresh(now time.Time) *jwksFetch {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.inflight != nil {
+		return j.inflight
+	}
+	if !j.attempted.IsZero() && now.Sub(j.attempted) < jwksMinRefresh {
+		return nil
+	}
+	f := &jwksFetch{done: make(chan struct{})}
+	j.inflight = f
+	j.attempted = now
+	go func() {
+		keys, err := j.fetch()
+		j.mu.Lock()
+		if err == nil {
+			j.keys = keys
+			j.fetched = now
+		}
+		j.inflight = nil
+		j.mu.Unlock()
+		f.err = err
+		close(f.done)
+	}()
+	return f
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (j *JWKS) fetch() (map[string]crypto.PublicKey, error) {
+	resp, err := j.client.Get(j.url)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch JWKS")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("fetch JWKS: unexpected status %s", resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, errors.Wrap(err, "decode JWKS")
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// skip keys of other types, which can not verify supported tokens.
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, errors.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("EC key is not on the P-256 curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, errors.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode JWK parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,129 @@
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	keys := []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X), "y": b64(ecKey.Y)},
+		{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": "AAAA"},
+	}
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	jwks := NewJWKS(srv.URL, srv.Client())
+	jwks.now = func() time.Time { return now }
+	v := NewVerifier(jwks)
+
+	if _, err := v.Verify(sign(t, "RS256", "rsa-1", rsaKey, claims("full", time.Hour))); err != nil {
+		t.Errorf("RS256 token: %s", err)
+	}
+	if _, err := v.Verify(sign(t, "ES256", "ec-1", ecKey, claims("full", time.Hour))); err != nil {
+		t.Errorf("ES256 token: %s", err)
+	}
+	if _, err := v.Verify(sign(t, "RS256", "enc-1", rsaKey, claims("full", time.Hour))); err == nil {
+		t.Error("expected error for an encryption key")
+	}
+	if have, want := atomic.LoadInt32(&fetches), int32(1); have != want {
+		t.Errorf("have %d fetches, want %d", have, want)
+	}
+
+	// unknown key IDs fetch the JWKS again once it is a minute old.
+	if _, err := v.Verify(sign(t, "RS256", "rsa-2", rsaKey, claims("full", time.Hour))); err == nil {
+		t.Error("expected error for an unknown key ID")
+	}
+	if have, want := atomic.LoadInt32(&fetches), int32(1); have != want {
+		t.Errorf("have %d fetches, want %d", have, want)
+	}
+	keys[0]["kid"] = "rsa-2"
+	now = now.Add(2 * time.Minute)
+	if _, err := v.Verify(sign(t, "RS256", "rsa-2", rsaKey, claims("full", time.Hour))); err != nil {
+		t.Errorf("rotated key: %s", err)
+	}
+	if have, want := atomic.LoadInt32(&fetches), int32(2); have != want {
+		t.Errorf("have %d fetches, want %d", have, want)
+	}
+}
+
+func TestJWKSRefreshUsesKnownKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	keys := []map[string]string{
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X), "y": b64(ecKey.Y)},
+	}
+	var fetches int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	now := time.Now()
+	jwks := NewJWKS(srv.URL, srv.Client())
+	jwks.now = func() time.Time { return now }
+	if _, err := jwks.Key("ec-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stale key is returned while the refresh is blocked.
+	now = now.Add(2 * time.Hour)
+	known := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := jwks.Key("ec-1")
+			known <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-known:
+			if err != nil {
+				t.Error(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a known key during a refresh")
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&fetches) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if have, want := atomic.LoadInt32(&fetches), int32(2); have != want {
+		t.Errorf("have %d fetches, want %d", have, want)
+	}
+}
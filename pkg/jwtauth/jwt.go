@@ -0,0 +1,284 @@
+// Package jwtauth authenticates API requests with signed JSON Web Tokens.
+//
+// Tokens are signed with HS256, RS256 or ES256 and carry their permissions in
+// the space separated "scope" claim. The read scope allows read-only requests,
+// and the full scope allows every request.
+package jwtauth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/pkg/scope"
+)
+
+// Scopes of the scope claim which predate the scopes of the scope package.
+// ScopeFull grants scope.Admin and ScopeRead grants scope.Read.
+const (
+	ScopeRead = "read"
+	ScopeFull = "full"
+)
+
+// minHMACSecret is the shortest HS256 secret accepted, as required by RFC 7518.
+const minHMACSecret = 32
+
+// leeway is the allowed clock skew when checking the time claims of a token.
+const leeway = time.Minute
+
+// Claims are the registered claims of a token, and its scopes.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Scope     string   `json:"scope"`
+}
+
+// Scopes returns the API scopes granted by the scope claim.
+func (c *Claims) Scopes() []string {
+	var scopes []string
+	for _, s := range strings.Fields(c.Scope) {
+		switch s {
+		case ScopeFull:
+			scopes = append(scopes, scope.Admin)
+		case ScopeRead:
+			scopes = append(scopes, scope.Read...)
+		default:
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// audience is the aud claim, which is either a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*a = audience{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// KeySource returns the key which verifies the signature of a token with the
+// key ID kid. The key is a []byte HMAC secret, an *rsa.PublicKey or an *ecdsa.PublicKey.
+type KeySource interface {
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+// StaticKey is a KeySource with a single key, which is used for every key ID.
+type StaticKey struct {
+	key crypto.PublicKey
+}
+
+// Key returns the key.
+func (k StaticKey) Key(string) (crypto.PublicKey, error) { return k.key, nil }
+
+// ParseKey creates a StaticKey from a PEM encoded public key or certificate, or
+// else uses data as an HMAC secret of at least 32 bytes.
+func ParseKey(data []byte) (StaticKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		secret := bytes.TrimSpace(data)
+		if len(secret) < minHMACSecret {
+			return StaticKey{}, errors.Errorf("HMAC secret must be at least %d bytes", minHMACSecret)
+		}
+		return StaticKey{key: secret}, nil
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return StaticKey{}, errors.Wrap(err, "parse certificate")
+		}
+		return StaticKey{key: cert.PublicKey}, nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return StaticKey{}, errors.Wrap(err, "parse public key")
+		}
+		return StaticKey{key: key}, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return StaticKey{}, errors.Wrap(err, "parse RSA public key")
+		}
+		return StaticKey{key: key}, nil
+	default:
+		return StaticKey{}, errors.Errorf("unsupported PEM block %q, want a public key or certificate", block.Type)
+	}
+}
+
+// Verifier checks the signature and claims of tokens.
+type Verifier struct {
+	keys     KeySource
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+type Option func(*Verifier)
+
+// WithIssuer rejects tokens whose iss claim is not issuer.
+func WithIssuer(issuer string) Option {
+	return func(v *Verifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithAudience rejects tokens whose aud claim does not contain aud.
+func WithAudience(aud string) Option {
+	return func(v *Verifier) {
+		v.audience = aud
+	}
+}
+
+func NewVerifier(keys KeySource, opts ...Option) *Verifier {
+	v := &Verifier{keys: keys, now: time.Now}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature of a compact serialized token and validates its
+// claims. Tokens must have an exp claim.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, errors.Wrap(err, "decode token header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "decode token signature")
+	}
+	key, err := v.keys.Key(h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(h.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.Wrap(err, "decode token claims")
+	}
+	if err := v.validate(&claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func (v *Verifier) validate(c *Claims) error {
+	now := v.now()
+	if c.ExpiresAt == 0 {
+		return errors.New("token has no expiration")
+	}
+	if now.After(time.Unix(c.ExpiresAt, 0).Add(leeway)) {
+		return errors.New("token is expired")
+	}
+	if c.NotBefore != 0 && now.Add(leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return errors.New("token is not valid yet")
+	}
+	if v.issuer != "" && c.Issuer != v.issuer {
+		return errors.Errorf("token issuer %q is not %q", c.Issuer, v.issuer)
+	}
+	if v.audience != "" && !c.Audience.contains(v.audience) {
+		return errors.Errorf("token audience does not contain %q", v.audience)
+	}
+	return nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, s := range a {
+		if s == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySignature checks sig over signed with key. The type of the key must
+// match alg, so that a public key is never used as an HMAC secret.
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+	switch alg {
+	case "HS256":
+		secret, ok := key.([]byte)
+		if !ok {
+			return errors.New("HS256 token for a non-HMAC key")
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		if subtle.ConstantTimeCompare(mac.Sum(nil), sig) != 1 {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RS256 token for a non-RSA key")
+		}
+		return errors.Wrap(rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig), "invalid token signature")
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return errors.New("ES256 token for a non-P-256 key")
+		}
+		if len(sig) != 64 {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	default:
+		return errors.Errorf("unsupported token algorithm %q", alg)
+	}
+}
+
+func decodeSegment(seg string, into interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
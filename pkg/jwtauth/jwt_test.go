@@ -0,0 +1,196 @@
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micromdm/micromdm/pkg/scope"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// sign creates a token with claims, signed with key using alg.
+func sign(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	h, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, serr := ecdsa.Sign(rand.Reader, k, digest[:])
+		err = serr
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func claims(scope string, expires time.Duration) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":   "admin@example.com",
+		"scope": scope,
+		"exp":   time.Now().Add(expires).Unix(),
+	}
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		alg  string
+		key  interface{}
+		pub  interface{}
+	}{
+		{"HS256", "HS256", testSecret, testSecret},
+		{"RS256", "RS256", rsaKey, &rsaKey.PublicKey},
+		{"ES256", "ES256", ecKey, &ecKey.PublicKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifier(StaticKey{key: tt.pub})
+			token := sign(t, tt.alg, "", tt.key, claims("read", time.Hour))
+			c, err := v.Verify(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Subject != "admin@example.com" || !reflect.DeepEqual(c.Scopes(), scope.Read) {
+				t.Errorf("have claims %+v with scopes %v, want read scopes for admin@example.com", c, c.Scopes())
+			}
+
+			parts := strings.Split(token, ".")
+			tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"scope":"full","exp":9999999999}`)) + "." + parts[2]
+			if _, err := v.Verify(tampered); err == nil {
+				t.Error("expected error for a tampered token")
+			}
+		})
+	}
+}
+
+func TestClaimsScopes(t *testing.T) {
+	c := Claims{Scope: "full devices:read"}
+	if have, want := c.Scopes(), []string{scope.Admin, scope.DevicesRead}; !reflect.DeepEqual(have, want) {
+		t.Errorf("have scopes %v, want %v", have, want)
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	v := NewVerifier(StaticKey{key: testSecret})
+	if _, err := v.Verify(sign(t, "HS256", "", testSecret, claims("full", -time.Hour))); err == nil {
+		t.Error("expected error for an expired token")
+	}
+	// a token which just expired is accepted within the clock skew leeway.
+	if _, err := v.Verify(sign(t, "HS256", "", testSecret, claims("full", -time.Second))); err != nil {
+		t.Errorf("token within the leeway: %s", err)
+	}
+	if _, err := v.Verify(sign(t, "HS256", "", testSecret, map[string]interface{}{"scope": "full"})); err == nil {
+		t.Error("expected error for a token without exp")
+	}
+	c := claims("full", time.Hour)
+	c["nbf"] = time.Now().Add(time.Hour).Unix()
+	if _, err := v.Verify(sign(t, "HS256", "", testSecret, c)); err == nil {
+		t.Error("expected error for a token which is not valid yet")
+	}
+}
+
+func TestVerifyIssuerAudience(t *testing.T) {
+	v := NewVerifier(StaticKey{key: testSecret}, WithIssuer("https://idp.example.com"), WithAudience("micromdm"))
+	c := claims("full", time.Hour)
+	c["iss"] = "https://idp.example.com"
+	c["aud"] = []string{"other", "micromdm"}
+	if _, err := v.Verify(sign(t, "HS256", "", testSecret, c)); err != nil {
+		t.Fatal(err)
+	}
+	c["aud"] = "other"
+	if _, err := v.Verify(sign(t, "HS256", "", testSecret, c)); err == nil {
+		t.Error("expected error for another audience")
+	}
+	c["aud"] = "micromdm"
+	c["iss"] = "https://evil.example.com"
+	if _, err := v.Verify(sign(t, "HS256", "", testSecret, c)); err == nil {
+		t.Error("expected error for another issuer")
+	}
+}
+
+func TestVerifyAlgorithmMismatch(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	key, err := ParseKey(pemKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewVerifier(key)
+
+	// the public key must not be usable as an HMAC secret.
+	if _, err := v.Verify(sign(t, "HS256", "", pemKey, claims("full", time.Hour))); err == nil {
+		t.Error("expected error for an HS256 token signed with the public key")
+	}
+	if _, err := v.Verify(sign(t, "none", "", testSecret, claims("full", time.Hour))); err == nil {
+		t.Error("expected error for an unsupported algorithm")
+	}
+	if _, err := v.Verify(sign(t, "RS256", "", rsaKey, claims("full", time.Hour))); err != nil {
+		t.Errorf("RS256 token: %s", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	if _, err := ParseKey([]byte("short")); err == nil {
+		t.Error("expected error for a short HMAC secret")
+	}
+	key, err := ParseKey(append(testSecret, '\n'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key.key.([]byte)) != string(testSecret) {
+		t.Error("HMAC secret was not trimmed")
+	}
+	if _, err := ParseKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")})); err == nil {
+		t.Error("expected error for a private key")
+	}
+}
@@ -0,0 +1,117 @@
+package jwtauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/micromdm/micromdm/pkg/ctxlog"
+	"github.com/micromdm/micromdm/pkg/scope"
+)
+
+// AuthError is returned for requests without a valid token.
+type AuthError struct {
+	err error
+}
+
+func (e AuthError) Error() string {
+	if e.err != nil {
+		return "invalid token: " + e.err.Error()
+	}
+	return http.StatusText(http.StatusUnauthorized)
+}
+
+// StatusCode is 401 Unauthorized.
+func (e AuthError) StatusCode() int { return http.StatusUnauthorized }
+
+// Headers returns the WWW-Authenticate challenge of RFC 6750.
+func (e AuthError) Headers() http.Header {
+	challenge := `Bearer realm="micromdm"`
+	if e.err != nil {
+		challenge += `, error="invalid_token"`
+	}
+	return http.Header{"WWW-Authenticate": []string{challenge}}
+}
+
+// bearerToken returns the token of a Bearer Authorization header.
+func bearerToken(authorization string) (string, bool) {
+	const prefix = "Bearer "
+	if len(authorization) < len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(authorization[len(prefix):]), true
+}
+
+// authenticate verifies token and returns ctx with the principal of the
+// token. The subject of the token is added to the request logs. Errors are of
+// type AuthError.
+func (v *Verifier) authenticate(ctx context.Context, token string) (context.Context, error) {
+	claims, err := v.Verify(token)
+	if err != nil {
+		return ctx, AuthError{err: err}
+	}
+	ctxlog.With(ctx, "token_subject", claims.Subject)
+	return scope.NewContext(ctx, &scope.Principal{Name: claims.Subject, Scopes: claims.Scopes()}), nil
+}
+
+// EndpointMiddleware authenticates requests with a Bearer token and adds the
+// principal of the token to the request context, for scope.Require to
+// authorize. Requests with another Authorization header are passed to the
+// fallback middleware, such as API key authentication, or rejected if fallback
+// is nil. It requires the request context to be populated with
+// httptransport.PopulateRequestContext.
+func EndpointMiddleware(v *Verifier, fallback endpoint.Middleware) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		var fallbackNext endpoint.Endpoint
+		if fallback != nil {
+			fallbackNext = fallback(next)
+		}
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			authorization, _ := ctx.Value(httptransport.ContextKeyRequestAuthorization).(string)
+			token, ok := bearerToken(authorization)
+			if !ok {
+				if fallbackNext == nil {
+					return nil, AuthError{}
+				}
+				return fallbackNext(ctx, request)
+			}
+			ctx, err := v.authenticate(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// RequireToken is like EndpointMiddleware for a handler which is not an
+// endpoint. Requests need a Bearer token, or else are handled by fallback.
+// A nil fallback rejects them.
+func RequireToken(v *Verifier, h, fallback http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r.Header.Get("Authorization"))
+		switch {
+		case !ok && fallback != nil:
+			fallback(w, r)
+		case !ok:
+			writeError(w, AuthError{})
+		default:
+			ctx, err := v.authenticate(r.Context(), token)
+			if err != nil {
+				writeError(w, err.(AuthError))
+				return
+			}
+			h(w, r.WithContext(ctx))
+		}
+	}
+}
+
+func writeError(w http.ResponseWriter, err AuthError) {
+	for k, values := range err.Headers() {
+		w.Header()[k] = values
+	}
+	http.Error(w, err.Error(), err.StatusCode())
+}
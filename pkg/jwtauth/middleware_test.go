@@ -0,0 +1,111 @@
+package jwtauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/micromdm/micromdm/pkg/apikey"
+	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
+)
+
+// testServer requires the devices:write scope for POST requests and devices:read otherwise.
+func testServer(fallback endpoint.Middleware) http.Handler {
+	v := NewVerifier(StaticKey{key: testSecret})
+	ok := func(ctx context.Context, request interface{}) (interface{}, error) {
+		s := scope.DevicesRead
+		if ctx.Value(httptransport.ContextKeyRequestMethod) == http.MethodPost {
+			s = scope.DevicesWrite
+		}
+		return scope.Require(s)(func(context.Context, interface{}) (interface{}, error) {
+			return struct{}{}, nil
+		})(ctx, request)
+	}
+	return httptransport.NewServer(
+		EndpointMiddleware(v, fallback)(ok),
+		func(context.Context, *http.Request) (interface{}, error) { return nil, nil },
+		httputil.EncodeJSONResponse,
+		httptransport.ServerErrorEncoder(httputil.ErrorEncoder),
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+}
+
+func TestEndpointMiddleware(t *testing.T) {
+	srv := testServer(apikey.EndpointMiddleware(apikey.Keys{{Name: "micromdm", Key: "secret", Scopes: []string{scope.Admin}}}))
+	tests := []struct {
+		name   string
+		method string
+		auth   string
+		code   int
+		header string
+	}{
+		{"valid token", "POST", "Bearer " + sign(t, "HS256", "", testSecret, claims("full", time.Hour)), http.StatusOK, ""},
+		{"read scope for read request", "GET", "Bearer " + sign(t, "HS256", "", testSecret, claims("read", time.Hour)), http.StatusOK, ""},
+		{"endpoint scope", "POST", "Bearer " + sign(t, "HS256", "", testSecret, claims("devices:write", time.Hour)), http.StatusOK, ""},
+		{"expired token", "GET", "Bearer " + sign(t, "HS256", "", testSecret, claims("full", -time.Hour)), http.StatusUnauthorized, `error="invalid_token"`},
+		{"insufficient scope", "POST", "Bearer " + sign(t, "HS256", "", testSecret, claims("read", time.Hour)), http.StatusForbidden, ""},
+		{"no scope", "GET", "Bearer " + sign(t, "HS256", "", testSecret, claims("", time.Hour)), http.StatusForbidden, ""},
+		{"wrong key", "GET", "Bearer " + sign(t, "HS256", "", []byte(strings.Repeat("x", 32)), claims("full", time.Hour)), http.StatusUnauthorized, `error="invalid_token"`},
+		{"api key", "POST", "Basic bWljcm9tZG06c2VjcmV0", http.StatusOK, ""},
+		{"wrong api key", "POST", "Basic bWljcm9tZG06d3Jvbmc=", http.StatusUnauthorized, "Basic"},
+		{"no credentials", "GET", "", http.StatusUnauthorized, "Basic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v1/devices", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			if rec.Code != tt.code {
+				t.Errorf("have status %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+			if have := rec.Header().Get("WWW-Authenticate"); !strings.Contains(have, tt.header) {
+				t.Errorf("have WWW-Authenticate %q, want %q", have, tt.header)
+			}
+		})
+	}
+}
+
+func TestEndpointMiddlewareWithoutFallback(t *testing.T) {
+	srv := testServer(nil)
+	req := httptest.NewRequest("GET", "/v1/devices", nil)
+	req.Header.Set("Authorization", "Basic bWljcm9tZG06")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("have status %d without a static API key, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	v := NewVerifier(StaticKey{key: testSecret})
+	h := RequireToken(v, scope.RequireHTTP(scope.ServerAdmin, func(w http.ResponseWriter, r *http.Request) {}), nil)
+	for _, tt := range []struct {
+		token string
+		code  int
+	}{
+		{sign(t, "HS256", "", testSecret, claims("full", time.Hour)), http.StatusOK},
+		{sign(t, "HS256", "", testSecret, claims("full", -time.Hour)), http.StatusUnauthorized},
+		{sign(t, "HS256", "", testSecret, claims("read", time.Hour)), http.StatusForbidden},
+		{"", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("have status %d, want %d: %s", rec.Code, tt.code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Package ratelimit implements token bucket rate limiting by key, such as a device UDID.
+package ratelimit
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter keeps a token bucket for each key. Every bucket holds up to burst
+// tokens and is refilled at rate tokens per second.
+//
+// To bound memory, a Limiter keeps at most size buckets and drops the least recently
+// used one to make room for a new key. A key whose bucket was dropped starts over
+// with a full bucket, so size must be larger than the number of keys expected to
+// be limited at the same time.
+type Limiter struct {
+	rate  float64
+	burst float64
+	size  int
+	now   func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List
+	buckets map[string]*list.Element
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// New creates a Limiter which allows rate events per second with bursts of up to burst
+// events for each of up to size keys.
+func New(rate float64, burst, size int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	if size < 1 {
+		size = 1
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		size:    size,
+		now:     time.Now,
+		lru:     list.New(),
+		buckets: make(map[string]*list.Element),
+	}
+}
+
+// Allow takes a token from the bucket of key and reports whether there was one.
+// When it returns false, retryAfter is the time until the bucket has a token again.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b := l.bucket(key, now)
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, 0
+	}
+	wait := (1 - b.tokens) / l.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// Len returns the number of keys a bucket is kept for.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lru.Len()
+}
+
+// bucket returns the bucket for key, creating a full one if there is none.
+func (l *Limiter) bucket(key string, now time.Time) *bucket {
+	if e, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(e)
+		return e.Value.(*bucket)
+	}
+	if l.lru.Len() >= l.size {
+		oldest := l.lru.Back()
+		l.lru.Remove(oldest)
+		delete(l.buckets, oldest.Value.(*bucket).key)
+	}
+	b := &bucket{key: key, tokens: l.burst, last: now}
+	l.buckets[key] = l.lru.PushFront(b)
+	return b
+}
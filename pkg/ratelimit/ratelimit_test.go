@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestLimiter(rate float64, burst, size int) (*Limiter, *clock) {
+	c := &clock{t: time.Unix(0, 0)}
+	l := New(rate, burst, size)
+	l.now = c.now
+	return l, c
+}
+
+func TestAllow(t *testing.T) {
+	l, c := newTestLimiter(2, 3, 10)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("burst event %d not allowed", i)
+		}
+	}
+	ok, retryAfter := l.Allow("a")
+	if ok {
+		t.Fatal("event allowed after the burst")
+	}
+	if have, want := retryAfter, 500*time.Millisecond; have != want {
+		t.Errorf("have retryAfter %s, want %s", have, want)
+	}
+
+	// other keys have their own bucket.
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("event for another key not allowed")
+	}
+
+	c.t = c.t.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("event not allowed after the bucket was refilled")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("event allowed before the bucket was refilled")
+	}
+
+	// the bucket never holds more than burst tokens.
+	c.t = c.t.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		l.Allow("a")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("event allowed after the burst")
+	}
+}
+
+func TestLRU(t *testing.T) {
+	l, _ := newTestLimiter(0, 1, 2)
+	l.Allow("a")
+	l.Allow("b")
+	// a is used more recently than b, so c replaces b.
+	l.Allow("a")
+	l.Allow("c")
+	if have, want := l.Len(), 2; have != want {
+		t.Fatalf("have %d buckets, want %d", have, want)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("dropped key b should start with a full bucket")
+	}
+	if ok, _ := l.Allow("c"); ok {
+		t.Error("key c should have an empty bucket")
+	}
+
+	for i := 0; i < 100; i++ {
+		l.Allow(fmt.Sprint(i))
+	}
+	if have, want := l.Len(), 2; have != want {
+		t.Errorf("have %d buckets, want %d", have, want)
+	}
+}
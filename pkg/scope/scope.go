@@ -0,0 +1,143 @@
+// Package scope authorizes API requests by the scopes of the authenticated principal.
+//
+// Authentication middleware, such as API key or token authentication, adds the
+// Principal to the request context, and Require rejects requests whose principal
+// does not have the scope an endpoint needs.
+package scope
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Scopes of the API. A write or admin scope includes the read scope of the
+// same resource, and Admin includes every scope.
+const (
+	DevicesRead   = "devices:read"
+	DevicesWrite  = "devices:write"
+	DevicesErase  = "devices:erase"
+	CommandsRead  = "commands:read"
+	CommandsWrite = "commands:write"
+	ProfilesRead  = "profiles:read"
+	ProfilesWrite = "profiles:write"
+	DEPRead       = "dep:read"
+	DEPAdmin      = "dep:admin"
+	ServerRead    = "server:read"
+	ServerAdmin   = "server:admin"
+	AuditRead     = "audit:read"
+	Admin         = "admin"
+)
+
+// Read are the read scopes of all resources.
+var Read = []string{DevicesRead, CommandsRead, ProfilesRead, DEPRead, ServerRead, AuditRead}
+
+// All are the scopes which can be granted, other than Admin.
+var All = []string{
+	DevicesRead, DevicesWrite, DevicesErase,
+	CommandsRead, CommandsWrite,
+	ProfilesRead, ProfilesWrite,
+	DEPRead, DEPAdmin,
+	ServerRead, ServerAdmin,
+	AuditRead,
+}
+
+// Valid reports whether s is a scope of the API.
+func Valid(s string) bool {
+	if s == Admin {
+		return true
+	}
+	for _, scope := range All {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Principal is the authenticated client of an API request.
+type Principal struct {
+	Name   string
+	Scopes []string
+}
+
+// Has reports whether the principal was granted scope.
+func (p *Principal) Has(scope string) bool {
+	resource, access := split(scope)
+	for _, s := range p.Scopes {
+		if s == Admin || s == scope {
+			return true
+		}
+		r, a := split(s)
+		if access == "read" && r == resource && (a == "write" || a == "admin") {
+			return true
+		}
+	}
+	return false
+}
+
+func split(scope string) (resource, access string) {
+	if i := strings.IndexByte(scope, ':'); i >= 0 {
+		return scope[:i], scope[i+1:]
+	}
+	return scope, ""
+}
+
+type principalKey struct{}
+
+// NewContext returns a context with the principal of the request.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of the request, if it was authenticated.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// ForbiddenError is returned for a request whose principal does not have the required scope.
+type ForbiddenError struct {
+	Scope string
+}
+
+func (e ForbiddenError) Error() string { return "request requires the " + e.Scope + " scope" }
+
+// StatusCode is 403 Forbidden.
+func (e ForbiddenError) StatusCode() int { return http.StatusForbidden }
+
+// Check returns a ForbiddenError unless the principal in ctx has scope.
+// A request without a principal is never allowed.
+func Check(ctx context.Context, scope string) error {
+	p, ok := FromContext(ctx)
+	if !ok || !p.Has(scope) {
+		return ForbiddenError{Scope: scope}
+	}
+	return nil
+}
+
+// Require returns a middleware which rejects requests whose principal does
+// not have scope. It must be chained after the authentication middleware.
+func Require(scope string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if err := Check(ctx, scope); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// RequireHTTP is Require for a handler which is not an endpoint.
+func RequireHTTP(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := Check(r.Context(), scope); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,69 @@
+package scope
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHas(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{[]string{DevicesRead}, DevicesRead, true},
+		{[]string{DevicesRead}, DevicesWrite, false},
+		{[]string{DevicesWrite}, DevicesRead, true},
+		{[]string{DevicesWrite}, DevicesErase, false},
+		{[]string{DevicesErase}, DevicesWrite, false},
+		{[]string{DEPAdmin}, DEPRead, true},
+		{[]string{CommandsWrite}, DevicesRead, false},
+		{[]string{Admin}, DevicesErase, true},
+		{nil, DevicesRead, false},
+	}
+	for _, tt := range tests {
+		p := &Principal{Scopes: tt.scopes}
+		if have := p.Has(tt.scope); have != tt.want {
+			t.Errorf("%v has %s: have %v, want %v", tt.scopes, tt.scope, have, tt.want)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	ok := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+	e := Require(DevicesErase)(ok)
+
+	ctx := NewContext(context.Background(), &Principal{Name: "helpdesk", Scopes: []string{DevicesRead, CommandsWrite}})
+	_, err := e(ctx, nil)
+	if fe, isForbidden := err.(ForbiddenError); !isForbidden || fe.StatusCode() != http.StatusForbidden {
+		t.Errorf("have error %v, want ForbiddenError", err)
+	}
+	if _, err := e(context.Background(), nil); err == nil {
+		t.Error("expected error for a request without a principal")
+	}
+	ctx = NewContext(context.Background(), &Principal{Name: "admin", Scopes: []string{DevicesErase}})
+	if _, err := e(ctx, nil); err != nil {
+		t.Errorf("have error %v for a principal with the scope", err)
+	}
+}
+
+func TestRequireHTTP(t *testing.T) {
+	h := RequireHTTP(ServerAdmin, func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range []struct {
+		scopes []string
+		code   int
+	}{
+		{[]string{ServerRead}, http.StatusForbidden},
+		{[]string{ServerAdmin}, http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", "/boltbackup", nil)
+		req = req.WithContext(NewContext(req.Context(), &Principal{Scopes: tt.scopes}))
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%v: have status %d, want %d", tt.scopes, rec.Code, tt.code)
+		}
+	}
+}
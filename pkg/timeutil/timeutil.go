@@ -0,0 +1,22 @@
+// Package timeutil converts times to and from the Unix nanoseconds they are
+// stored as in protocol buffers.
+package timeutil
+
+import "time"
+
+// ToNano returns t as Unix nanoseconds, or 0 if t is the zero time.
+func ToNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// FromNano returns the UTC time of the Unix nanoseconds nano, or the zero
+// time if nano is 0.
+func FromNano(nano int64) time.Time {
+	if nano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nano).UTC()
+}
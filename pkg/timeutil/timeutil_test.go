@@ -0,0 +1,24 @@
+package timeutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNano(t *testing.T) {
+	if have := ToNano(time.Time{}); have != 0 {
+		t.Errorf("have %d for the zero time, want 0", have)
+	}
+	if have := FromNano(0); !have.IsZero() {
+		t.Errorf("have %s for 0, want the zero time", have)
+	}
+
+	now := time.Now()
+	have := FromNano(ToNano(now))
+	if !have.Equal(now) {
+		t.Errorf("have %s, want %s", have, now)
+	}
+	if have.Location() != time.UTC {
+		t.Errorf("have location %s, want UTC", have.Location())
+	}
+}
@@ -3,6 +3,7 @@ package builtin
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/pkg/errors"
@@ -75,3 +76,47 @@ func (db *DB) Save(ctx context.Context, info *apns.PushInfo) error {
 	}
 	return tx.Commit()
 }
+
+func (db *DB) InvalidateToken(ctx context.Context, udid string, at time.Time) (bool, error) {
+	var invalidated bool
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(PushBucket))
+		v := b.Get([]byte(udid))
+		if v == nil {
+			return &notFound{"PushInfo", fmt.Sprintf("udid %s", udid)}
+		}
+		var info apns.PushInfo
+		if err := apns.UnmarshalPushInfo(v, &info); err != nil {
+			return err
+		}
+		if info.TokenInvalid() || !info.TokenUpdatedAt.Before(at) {
+			return nil
+		}
+		info.InvalidatedAt = at
+		pushproto, err := apns.MarshalPushInfo(&info)
+		if err != nil {
+			return errors.Wrap(err, "marshalling PushInfo")
+		}
+		invalidated = true
+		return b.Put([]byte(udid), pushproto)
+	})
+	return invalidated, err
+}
+
+func (db *DB) Delete(ctx context.Context, udid string, before time.Time) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(PushBucket))
+		v := b.Get([]byte(udid))
+		if v == nil {
+			return nil
+		}
+		var info apns.PushInfo
+		if err := apns.UnmarshalPushInfo(v, &info); err != nil {
+			return err
+		}
+		if !info.TokenUpdatedAt.Before(before) {
+			return nil
+		}
+		return b.Delete([]byte(udid))
+	})
+}
@@ -0,0 +1,117 @@
+package builtin
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/micromdm/micromdm/platform/apns"
+)
+
+func TestInvalidateToken(t *testing.T) {
+	db := setupDB(t)
+	ctx := context.Background()
+
+	updated := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	info := &apns.PushInfo{UDID: "UDID-FOO", Token: "tok", TokenUpdatedAt: updated}
+	if err := db.Save(ctx, info); err != nil {
+		t.Fatal(err)
+	}
+
+	// a timestamp before the token update leaves the new token alone.
+	invalidated, err := db.InvalidateToken(ctx, info.UDID, updated.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invalidated {
+		t.Error("token updated after the APNs timestamp was invalidated")
+	}
+
+	at := updated.Add(time.Hour)
+	for i, want := range []bool{true, false} {
+		invalidated, err := db.InvalidateToken(ctx, info.UDID, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if invalidated != want {
+			t.Errorf("call %d: have invalidated %t, want %t", i, invalidated, want)
+		}
+	}
+
+	found, err := db.PushInfo(ctx, info.UDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found.TokenInvalid() {
+		t.Error("expected token to be invalid")
+	}
+	if !found.InvalidatedAt.Equal(at) {
+		t.Errorf("have InvalidatedAt %s, want %s", found.InvalidatedAt, at)
+	}
+
+	// a new TokenUpdate makes the token valid again.
+	info.TokenUpdatedAt = at.Add(time.Hour)
+	if err := db.Save(ctx, info); err != nil {
+		t.Fatal(err)
+	}
+	found, err = db.PushInfo(ctx, info.UDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.TokenInvalid() {
+		t.Error("expected token to be valid after update")
+	}
+
+	if _, err := db.InvalidateToken(ctx, "UDID-MISSING", at); err == nil {
+		t.Error("expected error for unknown udid")
+	}
+}
+
+func setupDB(t *testing.T) *DB {
+	f, _ := ioutil.TempFile("", "bolt-")
+	f.Close()
+	os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatalf("couldn't open bolt, err %s\n", err)
+	}
+	pushDB, err := NewDB(db, nil)
+	if err != nil {
+		t.Fatalf("couldn't create push DB, err %s\n", err)
+	}
+	return pushDB
+}
+
+func TestDelete(t *testing.T) {
+	db := setupDB(t)
+	ctx := context.Background()
+
+	updated := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	info := &apns.PushInfo{UDID: "UDID-FOO", Token: "tok", TokenUpdatedAt: updated}
+	if err := db.Save(ctx, info); err != nil {
+		t.Fatal(err)
+	}
+
+	// the token was updated after the CheckOut, so the device enrolled again.
+	if err := db.Delete(ctx, info.UDID, updated); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PushInfo(ctx, info.UDID); err != nil {
+		t.Fatalf("push info of a re-enrolled device was deleted: %s", err)
+	}
+
+	if err := db.Delete(ctx, info.UDID, updated.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PushInfo(ctx, info.UDID); err == nil {
+		t.Error("expected push info to be deleted")
+	}
+	if err := db.Delete(ctx, "UDID-BAR", updated); err != nil {
+		t.Errorf("deleting unknown push info: %s", err)
+	}
+}
@@ -0,0 +1,162 @@
+package apns
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RobotsAndPencils/buford/push"
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/micromdm/micromdm/pkg/ctxlog"
+)
+
+// FeedbackEntry describes a device whose push token APNs rejected.
+// APNs reports invalid tokens in its responses to pushes, and the entries
+// replace the deprecated APNs feedback service.
+type FeedbackEntry struct {
+	UDID      string    `json:"udid"`
+	Token     string    `json:"token"`
+	Reason    string    `json:"reason"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// FeedbackOption filters the entries of the feedback report.
+type FeedbackOption struct {
+	FilterReason []string `json:"filter_reason"`
+}
+
+// feedbackReasons are the APNs errors which mean that the push token of a
+// device can not be used, rather than a problem with the push itself.
+var feedbackReasons = []error{
+	push.ErrBadDeviceToken,
+	push.ErrUnregistered,
+	push.ErrDeviceTokenNotForTopic,
+}
+
+// feedbackReason returns the reason of an APNs response rejecting a push token.
+func feedbackReason(err error) (string, bool) {
+	e, ok := err.(*push.Error)
+	if !ok {
+		return "", false
+	}
+	for _, reason := range feedbackReasons {
+		if e.Reason == reason {
+			return reason.Error(), true
+		}
+	}
+	return "", false
+}
+
+// feedbackReport keeps the latest rejection of each device's push token.
+// The zero value is an empty report.
+type feedbackReport struct {
+	mu      sync.Mutex
+	entries map[string]*FeedbackEntry
+}
+
+func (r *feedbackReport) record(udid, token, reason string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.entries == nil {
+		r.entries = make(map[string]*FeedbackEntry)
+	}
+	e, ok := r.entries[udid]
+	if !ok || e.Token != token || e.Reason != reason {
+		e = &FeedbackEntry{UDID: udid, Token: token, Reason: reason, FirstSeen: at}
+		r.entries[udid] = e
+	}
+	e.Count++
+	e.LastSeen = at
+}
+
+// clear removes udid from the report, once APNs accepts a push to it.
+func (r *feedbackReport) clear(udid string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, udid)
+}
+
+func (r *feedbackReport) list(opt FeedbackOption) []FeedbackEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := []FeedbackEntry{}
+	for _, e := range r.entries {
+		if len(opt.FilterReason) > 0 && !contains(opt.FilterReason, e.Reason) {
+			continue
+		}
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastSeen.After(entries[j].LastSeen)
+	})
+	return entries
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// recordFeedback updates the feedback report with the result of a push to udid.
+func (svc *PushService) recordFeedback(udid, token string, err error) {
+	if err == nil {
+		svc.feedback.clear(udid)
+		return
+	}
+	if reason, ok := feedbackReason(err); ok {
+		svc.feedback.record(udid, token, reason, time.Now().UTC())
+	}
+}
+
+// FeedbackReport returns the devices whose push tokens APNs rejected since the
+// server started, most recent first. A device is removed from the report when a
+// push to it succeeds.
+func (svc *PushService) FeedbackReport(ctx context.Context, opt FeedbackOption) ([]FeedbackEntry, error) {
+	return svc.feedback.list(opt), nil
+}
+
+type feedbackRequest struct {
+	Opts FeedbackOption
+}
+
+type feedbackResponse struct {
+	Entries []FeedbackEntry `json:"entries"`
+	Err     error           `json:"error,omitempty"`
+}
+
+func (r feedbackResponse) Failed() error { return r.Err }
+
+func decodeFeedbackRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return feedbackRequest{Opts: FeedbackOption{FilterReason: r.URL.Query()["reason"]}}, nil
+}
+
+func MakeFeedbackEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(feedbackRequest)
+		entries, err := svc.FeedbackReport(ctx, req.Opts)
+		return feedbackResponse{Entries: entries, Err: err}, nil
+	}
+}
+
+func (mw loggingMiddleware) FeedbackReport(ctx context.Context, opt FeedbackOption) (entries []FeedbackEntry, err error) {
+	defer func(begin time.Time) {
+		_ = ctxlog.Logger(ctx, mw.logger).Log(
+			"method", "FeedbackReport",
+			"entries", len(entries),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	entries, err = mw.next.FeedbackReport(ctx, opt)
+	return
+}
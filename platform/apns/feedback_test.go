@@ -0,0 +1,136 @@
+package apns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RobotsAndPencils/buford/push"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+
+	"github.com/micromdm/micromdm/pkg/scope"
+)
+
+// rejectingAPNs returns a server which responds to every push with status and reason.
+func rejectingAPNs(t *testing.T, status int, reason string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reason == "" {
+			w.Header().Set("apns-id", "push-id")
+			return
+		}
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"reason":%q,"timestamp":1577836800000}`, reason)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFeedbackReport(t *testing.T) {
+	svc := testPushService(rejectingAPNs(t, http.StatusOK, ""), 1)
+	tests := []struct {
+		status int
+		reason string
+	}{
+		{http.StatusBadRequest, "BadDeviceToken"},
+		{http.StatusBadRequest, "DeviceTokenNotForTopic"},
+		{http.StatusGone, "Unregistered"},
+		{http.StatusBadRequest, "BadTopic"},
+	}
+	for _, tt := range tests {
+		srv := rejectingAPNs(t, tt.status, tt.reason)
+		svc.pushsvc = push.NewService(srv.Client(), srv.URL)
+		// the token was updated before the Unregistered timestamp of the fake server.
+		svc.store = newMockStore(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+		for i := 0; i < 2; i++ {
+			if _, err := svc.Push(context.Background(), "UDID-"+tt.reason); err == nil {
+				t.Fatalf("%s: expected push error", tt.reason)
+			}
+		}
+	}
+
+	entries, err := svc.FeedbackReport(context.Background(), FeedbackOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasons := make(map[string]FeedbackEntry)
+	for _, e := range entries {
+		reasons[e.Reason] = e
+	}
+	if have, want := len(entries), 3; have != want {
+		t.Fatalf("have %d entries, want %d: %+v", have, want, entries)
+	}
+	for _, reason := range []string{"BadDeviceToken", "DeviceTokenNotForTopic", "Unregistered"} {
+		e, ok := reasons[reason]
+		if !ok {
+			t.Errorf("missing %s entry", reason)
+			continue
+		}
+		if e.UDID != "UDID-"+reason || e.Token != testToken {
+			t.Errorf("%s: unexpected entry %+v", reason, e)
+		}
+	}
+	// the Unregistered token is invalidated after the first push,
+	// so only the other reasons are reported twice.
+	if have, want := reasons["BadDeviceToken"].Count, 2; have != want {
+		t.Errorf("have BadDeviceToken count %d, want %d", have, want)
+	}
+	if have, want := reasons["Unregistered"].Count, 1; have != want {
+		t.Errorf("have Unregistered count %d, want %d", have, want)
+	}
+
+	filtered, err := svc.FeedbackReport(context.Background(), FeedbackOption{FilterReason: []string{"DeviceTokenNotForTopic"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) != 1 || filtered[0].Reason != "DeviceTokenNotForTopic" {
+		t.Errorf("have filtered entries %+v, want only DeviceTokenNotForTopic", filtered)
+	}
+
+	// a successful push removes the device from the report.
+	srv := rejectingAPNs(t, http.StatusOK, "")
+	svc.pushsvc = push.NewService(srv.Client(), srv.URL)
+	if _, err := svc.Push(context.Background(), "UDID-BadDeviceToken"); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ = svc.FeedbackReport(context.Background(), FeedbackOption{})
+	for _, e := range entries {
+		if e.UDID == "UDID-BadDeviceToken" {
+			t.Error("device is still reported after a successful push")
+		}
+	}
+}
+
+func TestFeedbackHTTP(t *testing.T) {
+	svc := testPushService(rejectingAPNs(t, http.StatusBadRequest, "BadDeviceToken"), 1)
+	if _, err := svc.Push(context.Background(), "UDID"); err == nil {
+		t.Fatal("expected push error")
+	}
+
+	r := mux.NewRouter()
+	RegisterHTTPHandlers(r, MakeServerEndpoints(svc, adminMiddleware))
+	req := httptest.NewRequest("GET", "/v1/push/feedback?reason=BadDeviceToken", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if have, want := resp.Code, http.StatusOK; have != want {
+		t.Fatalf("have status %d, want %d: %s", have, want, resp.Body)
+	}
+	var decoded feedbackResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Entries) != 1 || decoded.Entries[0].UDID != "UDID" || decoded.Entries[0].Reason != "BadDeviceToken" {
+		t.Errorf("unexpected entries %+v", decoded.Entries)
+	}
+}
+
+// adminMiddleware authenticates requests as a principal with every scope.
+func adminMiddleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return next(scope.NewContext(ctx, &scope.Principal{Name: "test", Scopes: []string{scope.Admin}}), request)
+	}
+}
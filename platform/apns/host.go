@@ -0,0 +1,60 @@
+package apns
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"strings"
+
+	"github.com/RobotsAndPencils/buford/push"
+	"github.com/pkg/errors"
+)
+
+// APNs hosts pushes are sent to.
+const (
+	ProductionHost = push.Production
+	SandboxHost    = "https://api.sandbox.push.apple.com"
+)
+
+// Extensions Apple adds to push certificates for the environments they can be
+// used with.
+var (
+	oidAPNSDevelopment = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 3, 1}
+	oidAPNSProduction  = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 3, 2}
+)
+
+// CertificateHost returns the APNs host for the environment of the push
+// certificate cert. It is SandboxHost only for a development certificate which
+// cannot be used in production, and ProductionHost otherwise.
+func CertificateHost(cert *x509.Certificate) string {
+	var development, production bool
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidAPNSDevelopment):
+			development = true
+		case ext.Id.Equal(oidAPNSProduction):
+			production = true
+		}
+	}
+	if development && !production {
+		return SandboxHost
+	}
+	return ProductionHost
+}
+
+// ParseHost parses the APNs host flag s, which is "production", "sandbox" or
+// an https URL. An empty s returns an empty host, which means the host is
+// chosen with CertificateHost.
+func ParseHost(s string) (string, error) {
+	switch s {
+	case "":
+		return "", nil
+	case "production":
+		return ProductionHost, nil
+	case "sandbox":
+		return SandboxHost, nil
+	}
+	if !strings.HasPrefix(s, "https://") {
+		return "", errors.Errorf("APNs host %q must be production, sandbox or an https URL", s)
+	}
+	return strings.TrimRight(s, "/"), nil
+}
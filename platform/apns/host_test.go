@@ -0,0 +1,101 @@
+package apns
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var (
+	asn1Null  = []byte{0x05, 0x00}
+	oidUserID = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}
+)
+
+type certProvider tls.Certificate
+
+func (p *certProvider) PushCertificate() (*tls.Certificate, error) {
+	return (*tls.Certificate)(p), nil
+}
+
+func pushCertificate(t *testing.T, environments ...asn1.ObjectIdentifier) *certProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "APSP:push",
+			ExtraNames: []pkix.AttributeTypeAndValue{{Type: oidUserID, Value: "com.apple.mgmt.External.test"}},
+		},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().Add(time.Hour),
+	}
+	for _, oid := range environments {
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: oid, Value: asn1Null})
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &certProvider{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCertificateHost(t *testing.T) {
+	tests := []struct {
+		name         string
+		environments []asn1.ObjectIdentifier
+		want         string
+	}{
+		{"sandbox", []asn1.ObjectIdentifier{oidAPNSDevelopment}, SandboxHost},
+		{"production", []asn1.ObjectIdentifier{oidAPNSProduction}, ProductionHost},
+		{"sandbox and production", []asn1.ObjectIdentifier{oidAPNSDevelopment, oidAPNSProduction}, ProductionHost},
+		{"no environment", nil, ProductionHost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := newPushService(pushCertificate(t, tt.environments...), "", TransportOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if svc.Host != tt.want {
+				t.Errorf("have host %s, want %s", svc.Host, tt.want)
+			}
+		})
+	}
+
+	svc, err := newPushService(pushCertificate(t, oidAPNSDevelopment), ProductionHost, TransportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.Host != ProductionHost {
+		t.Errorf("have host %s, want the configured host %s", svc.Host, ProductionHost)
+	}
+}
+
+func TestParseHost(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"production", ProductionHost, false},
+		{"sandbox", SandboxHost, false},
+		{"https://apns.example.com/", "https://apns.example.com", false},
+		{"api.push.apple.com", "", true},
+	}
+	for _, tt := range tests {
+		have, err := ParseHost(tt.in)
+		if (err != nil) != tt.wantErr || have != tt.want {
+			t.Errorf("ParseHost(%q) = %q, %v, want %q", tt.in, have, err, tt.want)
+		}
+	}
+}
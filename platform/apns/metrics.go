@@ -0,0 +1,26 @@
+package apns
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// WithMetrics counts push attempts by status, which is either "success" or
+// "failure", and observes how long each push took in seconds. Pushes sent for
+// queued commands are counted as well as pushes requested through the API.
+func WithMetrics(pushes metrics.Counter, duration metrics.Histogram) Option {
+	return func(p *PushService) {
+		p.pushes = pushes
+		p.pushDuration = duration
+	}
+}
+
+func (svc *PushService) observePush(begin time.Time, err error) {
+	status := "success"
+	if err != nil {
+		status = "failure"
+	}
+	svc.pushes.With("status", status).Add(1)
+	svc.pushDuration.With("status", status).Observe(time.Since(begin).Seconds())
+}
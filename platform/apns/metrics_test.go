@@ -0,0 +1,43 @@
+package apns
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestPushMetrics(t *testing.T) {
+	pushes := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "micromdm_push_total"}, []string{"status"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "micromdm_push_duration_seconds"}, []string{"status"})
+
+	srv, _ := fakeAPNs(t, nil, http.StatusBadRequest)
+	svc := testPushService(srv, 1)
+	WithMetrics(kitprometheus.NewCounter(pushes), kitprometheus.NewHistogram(duration))(svc)
+
+	if _, err := svc.Push(context.Background(), "UDID"); err == nil {
+		t.Fatal("expected push error")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Push(context.Background(), "UDID"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for status, want := range map[string]uint64{"success": 2, "failure": 1} {
+		if have := testutil.ToFloat64(pushes.WithLabelValues(status)); have != float64(want) {
+			t.Errorf("have %v %s pushes, want %d", have, status, want)
+		}
+		var m dto.Metric
+		if err := duration.WithLabelValues(status).(prometheus.Histogram).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		if have := m.GetHistogram().GetSampleCount(); have != want {
+			t.Errorf("have %d %s push durations, want %d", have, status, want)
+		}
+	}
+}
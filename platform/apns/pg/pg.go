@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -24,6 +25,8 @@ func columns() []string {
 		"push_magic",
 		"token",
 		"mdm_topic",
+		"token_updated_at",
+		"invalidated_at",
 	}
 }
 
@@ -37,6 +40,8 @@ func (d *Postgres) Save(ctx context.Context, i *apns.PushInfo) error {
 		Set("push_magic", i.PushMagic).
 		Set("token", i.Token).
 		Set("mdm_topic", i.MDMTopic).
+		Set("token_updated_at", i.TokenUpdatedAt).
+		Set("invalidated_at", i.InvalidatedAt).
 		ToSql()
 	if err != nil {
 		return errors.Wrap(err, "building update query for push_info save")
@@ -51,6 +56,8 @@ func (d *Postgres) Save(ctx context.Context, i *apns.PushInfo) error {
 			i.PushMagic,
 			i.Token,
 			i.MDMTopic,
+			i.TokenUpdatedAt,
+			i.InvalidatedAt,
 		).
 		Suffix(updateQuery).
 		ToSql()
@@ -80,6 +87,41 @@ func (d *Postgres) PushInfo(ctx context.Context, udid string) (*apns.PushInfo, e
 	return &i, errors.Wrap(err, "finding push_info by udid")
 }
 
+func (d *Postgres) InvalidateToken(ctx context.Context, udid string, at time.Time) (bool, error) {
+	// only invalidate tokens which are currently valid and were updated before at.
+	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Update(tableName).
+		Set("invalidated_at", at).
+		Where(sq.Eq{"udid": udid}).
+		Where(sq.Lt{"token_updated_at": at}).
+		Where("invalidated_at <= token_updated_at").
+		ToSql()
+	if err != nil {
+		return false, errors.Wrap(err, "building push_info invalidate query")
+	}
+
+	result, err := d.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, errors.Wrap(err, "exec push_info invalidate in pg")
+	}
+	n, err := result.RowsAffected()
+	return n > 0, errors.Wrap(err, "rows affected by push_info invalidate")
+}
+
+func (d *Postgres) Delete(ctx context.Context, udid string, before time.Time) error {
+	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Delete(tableName).
+		Where(sq.Eq{"udid": udid}).
+		Where(sq.Lt{"token_updated_at": before}).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "building push_info delete query")
+	}
+
+	_, err = d.db.ExecContext(ctx, query, args...)
+	return errors.Wrap(err, "exec push_info delete in pg")
+}
+
 type pushInfoNotFoundErr struct{}
 
 func (e pushInfoNotFoundErr) Error() string  { return "push_info not found" }
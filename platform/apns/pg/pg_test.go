@@ -6,6 +6,7 @@ package pg
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/kolide/kit/dbutil"
@@ -36,6 +37,31 @@ func TestPGCrud(t *testing.T) {
 	}
 }
 
+func TestPGDelete(t *testing.T) {
+	db := setup(t)
+	ctx := context.Background()
+
+	updated := time.Now().UTC()
+	info := apns.PushInfo{UDID: "UDID-delete", Token: "tok", TokenUpdatedAt: updated}
+	if err := db.Save(ctx, &info); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Delete(ctx, info.UDID, updated.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PushInfo(ctx, info.UDID); err != nil {
+		t.Fatalf("push info updated after the CheckOut was deleted: %s", err)
+	}
+
+	if err := db.Delete(ctx, info.UDID, updated.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PushInfo(ctx, info.UDID); err == nil {
+		t.Error("expected push info to be deleted")
+	}
+}
+
 func setup(t *testing.T) *Postgres {
 	db, err := dbutil.OpenDBX(
 		"postgres",
@@ -15,7 +15,9 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 
+	"github.com/micromdm/micromdm/pkg/ctxlog"
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/platform/audit"
 )
 
 type pushOpts struct {
@@ -33,7 +35,21 @@ func WithExpiration(t time.Time) PushOption {
 // PushOption adds optional parameters to the Push method.
 type PushOption func(*pushOpts)
 
-func (svc *PushService) Push(ctx context.Context, deviceUDID string, opts ...PushOption) (string, error) {
+func (svc *PushService) Push(ctx context.Context, deviceUDID string, opts ...PushOption) (id string, err error) {
+	if err := svc.work.Start(); err != nil {
+		return "", err
+	}
+	defer svc.work.Done()
+	return svc.push(ctx, deviceUDID, opts...)
+}
+
+// push sends the push for work which was already counted, such as a queued
+// command event, so that it is sent even while the service is draining.
+func (svc *PushService) push(ctx context.Context, deviceUDID string, opts ...PushOption) (id string, err error) {
+	if svc.pushes != nil {
+		defer func(begin time.Time) { svc.observePush(begin, err) }(time.Now())
+	}
+
 	// loop through defaults and apply user provided overrides
 	var opt pushOpts
 	for _, optFn := range opts {
@@ -50,6 +66,10 @@ func (svc *PushService) Push(ctx context.Context, deviceUDID string, opts ...Pus
 		return "", errors.Wrap(err, "retrieving PushInfo by UDID")
 	}
 
+	if info.TokenInvalid() {
+		return "", errTokenInvalid{udid: deviceUDID}
+	}
+
 	p := payload.MDM{Token: info.PushMagic}
 	valid := push.IsDeviceTokenValid(info.Token)
 	if !valid {
@@ -60,7 +80,21 @@ func (svc *PushService) Push(ctx context.Context, deviceUDID string, opts ...Pus
 		return "", errors.Wrap(err, "marshalling push notification payload")
 	}
 
-	result, err := svc.pushsvc.Push(info.Token, headers, jsonPayload)
+	svc.mu.RLock()
+	pushsvc := svc.pushsvc
+	svc.mu.RUnlock()
+	if pushsvc == nil {
+		return "", errors.New("push service not configured, missing push certificate")
+	}
+
+	result, err := svc.pushWithRetry(ctx, pushsvc, info.Token, headers, jsonPayload)
+	svc.recordFeedback(deviceUDID, info.Token, err)
+	if at, ok := isUnregistered(err); ok {
+		if ierr := svc.invalidateToken(ctx, deviceUDID, at); ierr != nil {
+			return result, errors.Wrap(ierr, "handle APNs Unregistered response")
+		}
+		return result, err
+	}
 	if err != nil && strings.HasSuffix(err.Error(), "remote error: tls: internal error") {
 		// TODO: yuck, error substring searching. see:
 		// https://github.com/micromdm/micromdm/issues/150
@@ -69,11 +103,41 @@ func (svc *PushService) Push(ctx context.Context, deviceUDID string, opts ...Pus
 	return result, err
 }
 
+// pushWithRetry sends the push, retrying transient APNs errors up to
+// svc.MaxAttempts times with exponential backoff.
+func (svc *PushService) pushWithRetry(ctx context.Context, pushsvc *push.Service, token string, headers *push.Headers, payload []byte) (string, error) {
+	for attempt := 1; ; attempt++ {
+		result, retryAfter, err := pushOnce(pushsvc, token, headers, payload)
+		if err == nil || !isTransientPushError(err) || attempt >= svc.MaxAttempts {
+			return result, err
+		}
+
+		delay := retryAfter
+		if delay == 0 {
+			delay = backoff(svc.BaseDelay, attempt)
+		}
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
+
 type pushRequest struct {
 	UDID     string
 	expireAt time.Time
 }
 
+func (r pushRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: "Push", UDIDs: []string{r.UDID}}
+}
+
 type pushResponse struct {
 	Status string `json:"status,omitempty"`
 	ID     string `json:"push_notification_id,omitempty"`
@@ -137,7 +201,7 @@ func MakePushEndpoint(svc Service) endpoint.Endpoint {
 
 func (mw loggingMiddleware) Push(ctx context.Context, udid string, opts ...PushOption) (id string, err error) {
 	defer func(begin time.Time) {
-		_ = mw.logger.Log(
+		_ = ctxlog.Logger(ctx, mw.logger).Log(
 			"method", "Push",
 			"udid", udid,
 			"err", err,
@@ -1,9 +1,12 @@
 package apns
 
 import (
+	"time"
+
 	"github.com/pkg/errors"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/micromdm/micromdm/pkg/timeutil"
 	"github.com/micromdm/micromdm/platform/apns/internal/pushproto"
 )
 
@@ -12,14 +15,27 @@ type PushInfo struct {
 	PushMagic string `db:"push_magic"`
 	Token     string `db:"token"`
 	MDMTopic  string `db:"mdm_topic"`
+
+	// TokenUpdatedAt is the time the device last sent a TokenUpdate.
+	TokenUpdatedAt time.Time `db:"token_updated_at"`
+	// InvalidatedAt is the time APNs reported the token as Unregistered.
+	InvalidatedAt time.Time `db:"invalidated_at"`
+}
+
+// TokenInvalid reports whether APNs has reported the token as Unregistered
+// since the device last updated it.
+func (p *PushInfo) TokenInvalid() bool {
+	return p.InvalidatedAt.After(p.TokenUpdatedAt)
 }
 
 func MarshalPushInfo(p *PushInfo) ([]byte, error) {
 	protopush := pushproto.PushInfo{
-		Udid:      p.UDID,
-		PushMagic: p.PushMagic,
-		Token:     p.Token,
-		MdmTopic:  p.MDMTopic,
+		Udid:           p.UDID,
+		PushMagic:      p.PushMagic,
+		Token:          p.Token,
+		MdmTopic:       p.MDMTopic,
+		TokenUpdatedAt: timeutil.ToNano(p.TokenUpdatedAt),
+		InvalidatedAt:  timeutil.ToNano(p.InvalidatedAt),
 	}
 	return proto.Marshal(&protopush)
 }
@@ -33,5 +49,7 @@ func UnmarshalPushInfo(data []byte, p *PushInfo) error {
 	p.Token = pb.GetToken()
 	p.PushMagic = pb.GetPushMagic()
 	p.MDMTopic = pb.GetMdmTopic()
+	p.TokenUpdatedAt = timeutil.FromNano(pb.GetTokenUpdatedAt())
+	p.InvalidatedAt = timeutil.FromNano(pb.GetInvalidatedAt())
 	return nil
 }
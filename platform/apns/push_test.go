@@ -0,0 +1,384 @@
+package apns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RobotsAndPencils/buford/push"
+
+	"github.com/micromdm/micromdm/pkg/drain"
+	"github.com/micromdm/micromdm/platform/pubsub"
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+	"github.com/micromdm/micromdm/platform/queue"
+)
+
+const testToken = "c2732227a1d8021cfaf781d71fb2f908c61f5861079a00954a5453f1d0281433"
+
+type mockStore struct {
+	mu            sync.Mutex
+	info          PushInfo
+	invalidations int
+}
+
+func newMockStore(tokenUpdatedAt time.Time) *mockStore {
+	return &mockStore{info: PushInfo{
+		UDID:           "UDID",
+		Token:          testToken,
+		PushMagic:      "magic",
+		TokenUpdatedAt: tokenUpdatedAt,
+	}}
+}
+
+func (s *mockStore) PushInfo(ctx context.Context, udid string) (*PushInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := s.info
+	return &info, nil
+}
+
+func (s *mockStore) InvalidateToken(ctx context.Context, udid string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.info.TokenInvalid() || !s.info.TokenUpdatedAt.Before(at) {
+		return false, nil
+	}
+	s.info.InvalidatedAt = at
+	s.invalidations++
+	return true, nil
+}
+
+type mockPublisher struct {
+	events []pubsub.Event
+}
+
+func (p *mockPublisher) Publish(ctx context.Context, topic string, msg []byte) error {
+	p.events = append(p.events, pubsub.Event{Topic: topic, Message: msg})
+	return nil
+}
+
+// fakeAPNs returns a server which responds with the given status codes in
+// order, and 200 OK once they are used up.
+func fakeAPNs(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *int32) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&requests, 1))
+		if !strings.HasSuffix(r.URL.Path, "/3/device/"+testToken) {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if n > len(statuses) {
+			w.Header().Set("apns-id", "push-id")
+			return
+		}
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(statuses[n-1])
+		switch statuses[n-1] {
+		case http.StatusGone:
+			w.Write([]byte(`{"reason":"Unregistered","timestamp":1577836800000}`))
+		case http.StatusTooManyRequests:
+			w.Write([]byte(`{"reason":"TooManyRequests"}`))
+		case http.StatusServiceUnavailable:
+			w.Write([]byte(`{"reason":"ServiceUnavailable"}`))
+		default:
+			w.Write([]byte(`{"reason":"BadDeviceToken"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func testPushService(srv *httptest.Server, maxAttempts int) *PushService {
+	svc := &PushService{
+		store:       newMockStore(time.Now()),
+		pub:         &mockPublisher{},
+		pushsvc:     push.NewService(srv.Client(), srv.URL),
+		MaxAttempts: maxAttempts,
+		BaseDelay:   time.Millisecond,
+		pushSlots:   make(chan struct{}, maxConcurrentPushes),
+	}
+	svc.ctx, svc.cancel = context.WithCancel(context.Background())
+	return svc
+}
+
+func TestRetryDoesNotDelayQueuedPushes(t *testing.T) {
+	// the first push waits a minute to be retried.
+	header := http.Header{"Retry-After": []string{"60"}}
+	srv, requests := fakeAPNs(t, header, http.StatusServiceUnavailable)
+	svc := testPushService(srv, 2)
+	ps := inmem.NewPubSub()
+	if err := svc.startQueuedSubscriber(ps); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, udid := range []string{"RETRIED", "OTHER"} {
+		if err := queue.PublishCommandQueued(ps, udid, "command"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(requests) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the push of another device waited for the retry")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := svc.Shutdown(ctx); err == nil {
+		t.Error("expected the shutdown to time out waiting for the retry")
+	}
+	// the retry gives up once the shutdown is done.
+	wait, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := svc.work.Wait(wait); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := atomic.LoadInt32(requests), int32(2); have != want {
+		t.Errorf("have %d requests, want %d", have, want)
+	}
+}
+
+func TestPushRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxAttempts  int
+		wantErr      bool
+		wantRequests int32
+	}{
+		{"success", nil, 3, false, 1},
+		{"unavailable then success", []int{http.StatusServiceUnavailable}, 3, false, 2},
+		{"too many requests then success", []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}, 3, false, 3},
+		{"attempts exhausted", []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}, 2, true, 2},
+		{"permanent error", []int{http.StatusBadRequest}, 3, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := fakeAPNs(t, nil, tt.statuses...)
+			svc := testPushService(srv, tt.maxAttempts)
+
+			id, err := svc.Push(context.Background(), "UDID")
+			if have, want := err != nil, tt.wantErr; have != want {
+				t.Fatalf("have error %v, want error %t", err, want)
+			}
+			if !tt.wantErr && id != "push-id" {
+				t.Errorf("have push id %q, want %q", id, "push-id")
+			}
+			if have, want := atomic.LoadInt32(requests), tt.wantRequests; have != want {
+				t.Errorf("have %d attempts, want %d", have, want)
+			}
+		})
+	}
+}
+
+func TestPushRetryAfter(t *testing.T) {
+	header := http.Header{"Retry-After": []string{"1"}}
+	srv, requests := fakeAPNs(t, header, http.StatusServiceUnavailable)
+	svc := testPushService(srv, 2)
+
+	start := time.Now()
+	if _, err := svc.Push(context.Background(), "UDID"); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took < time.Second {
+		t.Errorf("retried after %s, want at least the 1s Retry-After delay", took)
+	}
+	if have, want := atomic.LoadInt32(requests), int32(2); have != want {
+		t.Errorf("have %d attempts, want %d", have, want)
+	}
+}
+
+func TestPushRetryCanceled(t *testing.T) {
+	srv, requests := fakeAPNs(t, nil, http.StatusServiceUnavailable)
+	svc := testPushService(srv, 3)
+	svc.BaseDelay = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := svc.Push(ctx, "UDID"); err == nil {
+		t.Fatal("expected error when the context is canceled during backoff")
+	}
+	if have, want := atomic.LoadInt32(requests), int32(1); have != want {
+		t.Errorf("have %d attempts, want %d", have, want)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-30 * time.Second).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if have := parseRetryAfter(tt.in, now); have != tt.want {
+			t.Errorf("parseRetryAfter(%q): have %s, want %s", tt.in, have, tt.want)
+		}
+	}
+}
+
+func TestPushUnregistered(t *testing.T) {
+	// the fake server reports the token as unregistered on 2020-01-01.
+	unregisteredAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	srv, requests := fakeAPNs(t, nil, http.StatusGone, http.StatusGone)
+	store := newMockStore(unregisteredAt.Add(-time.Hour))
+	pub := &mockPublisher{}
+	svc := testPushService(srv, 3)
+	svc.store, svc.pub = store, pub
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Push(context.Background(), "UDID"); err == nil {
+			t.Fatalf("push %d: expected error for unregistered token", i)
+		}
+	}
+	if have, want := atomic.LoadInt32(requests), int32(1); have != want {
+		t.Errorf("have %d APNs requests, want %d", have, want)
+	}
+	if have, want := store.invalidations, 1; have != want {
+		t.Errorf("have %d invalidations, want %d", have, want)
+	}
+	if !store.info.InvalidatedAt.Equal(unregisteredAt) {
+		t.Errorf("have InvalidatedAt %s, want %s", store.info.InvalidatedAt, unregisteredAt)
+	}
+
+	if have, want := len(pub.events), 1; have != want {
+		t.Fatalf("have %d events, want %d", have, want)
+	}
+	if have, want := pub.events[0].Topic, TokenInvalidatedTopic; have != want {
+		t.Errorf("have topic %s, want %s", have, want)
+	}
+	var ev TokenInvalidatedEvent
+	if err := json.Unmarshal(pub.events[0].Message, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.UDID != "UDID" || !ev.InvalidatedAt.Equal(unregisteredAt) {
+		t.Errorf("unexpected event %+v", ev)
+	}
+}
+
+func TestPushUnregisteredStale(t *testing.T) {
+	// the token was updated after APNs reported the old token as unregistered.
+	unregisteredAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	srv, _ := fakeAPNs(t, nil, http.StatusGone)
+	store := newMockStore(unregisteredAt.Add(time.Hour))
+	pub := &mockPublisher{}
+	svc := testPushService(srv, 3)
+	svc.store, svc.pub = store, pub
+
+	if _, err := svc.Push(context.Background(), "UDID"); err == nil {
+		t.Fatal("expected error for unregistered response")
+	}
+	if store.invalidations != 0 || len(pub.events) != 0 {
+		t.Errorf("token updated after the APNs timestamp was invalidated")
+	}
+	if _, err := svc.Push(context.Background(), "UDID"); err != nil {
+		t.Errorf("push after stale Unregistered response: %s", err)
+	}
+}
+
+func TestQueuedPushIsSentWhileDraining(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			<-release
+		}
+		w.Header().Set("apns-id", "push-id")
+	}))
+	defer srv.Close()
+	var releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	defer unblock()
+	svc := testPushService(srv, 1)
+	ps := inmem.NewPubSub()
+	if err := svc.startQueuedSubscriber(ps); err != nil {
+		t.Fatal(err)
+	}
+
+	waitRequests := func(n int32) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for atomic.LoadInt32(&requests) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("have %d pushes, want %d", atomic.LoadInt32(&requests), n)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	if err := queue.PublishCommandQueued(ps, "UDID", "in-flight"); err != nil {
+		t.Fatal(err)
+	}
+	waitRequests(1)
+
+	drained := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		drained <- svc.Shutdown(ctx)
+	}()
+	for {
+		if err := svc.work.Start(); err != nil {
+			break
+		}
+		svc.work.Done()
+		time.Sleep(time.Millisecond)
+	}
+
+	// a command queued during the drain is still pushed.
+	if err := queue.PublishCommandQueued(ps, "UDID", "queued-while-draining"); err != nil {
+		t.Fatal(err)
+	}
+	waitRequests(2)
+	unblock()
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Push(context.Background(), "UDID"); err != drain.ErrDraining {
+		t.Errorf("have err %v for a push after the drain, want %v", err, drain.ErrDraining)
+	}
+}
+
+func TestPingIsCached(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	svc := testPushService(srv, 1)
+
+	for i := 0; i < 3; i++ {
+		if err := svc.Ping(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if have, want := atomic.LoadInt32(&requests), int32(1); have != want {
+		t.Errorf("have %d requests, want %d", have, want)
+	}
+
+	svc.pingAt = svc.pingAt.Add(-pingCacheTTL)
+	if err := svc.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := atomic.LoadInt32(&requests), int32(2); have != want {
+		t.Errorf("have %d requests after the cached result expired, want %d", have, want)
+	}
+}
@@ -0,0 +1,103 @@
+package apns
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RobotsAndPencils/buford/push"
+)
+
+const (
+	// DefaultMaxAttempts is the default number of times a push is sent
+	// before giving up on a transient APNs error.
+	DefaultMaxAttempts = 3
+
+	// DefaultBaseDelay is the default delay before the first retry of a push.
+	// The delay doubles with every following attempt.
+	DefaultBaseDelay = time.Second
+
+	// maxRetryDelay caps the delay between attempts, including delays
+	// requested by APNs with the Retry-After header.
+	maxRetryDelay = time.Minute
+)
+
+// isTransientPushError reports whether err is an APNs response which
+// indicates that the same push may succeed when it is retried later.
+func isTransientPushError(err error) bool {
+	e, ok := err.(*push.Error)
+	if !ok {
+		return false
+	}
+	switch e.Status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable:
+		return true
+	}
+	switch e.Reason {
+	case push.ErrTooManyRequests, push.ErrInternalServerError, push.ErrServiceUnavailable, push.ErrShutdown:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before the given retry attempt, starting at 1.
+// The delay grows exponentially from base, with up to half of it randomized
+// so that pushes failing at the same time do not retry in lockstep.
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	d := base << uint(attempt-1)
+	if d <= 0 || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either
+// a number of seconds or an HTTP date. It returns 0 if the header is invalid.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// retryAfterRecorder is an http.RoundTripper which records the Retry-After
+// header of the last response, which the push client does not return.
+type retryAfterRecorder struct {
+	next       http.RoundTripper
+	retryAfter string
+}
+
+func (r *retryAfterRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := r.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if resp != nil {
+		r.retryAfter = resp.Header.Get("Retry-After")
+	}
+	return resp, err
+}
+
+// pushOnce sends a single push with svc and returns the APNs response along
+// with the delay requested by APNs, if any.
+func pushOnce(svc *push.Service, token string, headers *push.Headers, payload []byte) (string, time.Duration, error) {
+	recorder := &retryAfterRecorder{next: svc.Client.Transport}
+	client := *svc.Client
+	client.Transport = recorder
+	attempt := push.Service{Host: svc.Host, Client: &client}
+
+	result, err := attempt.Push(token, headers, payload)
+	return result, parseRetryAfter(recorder.retryAfter, time.Now()), err
+}
@@ -6,21 +6,25 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 )
 
 type Endpoints struct {
-	PushEndpoint endpoint.Endpoint
+	PushEndpoint     endpoint.Endpoint
+	FeedbackEndpoint endpoint.Endpoint
 }
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		PushEndpoint: endpoint.Chain(outer, others...)(MakePushEndpoint(s)),
+		PushEndpoint:     endpoint.Chain(outer, others...)(scope.Require(scope.CommandsWrite)(MakePushEndpoint(s))),
+		FeedbackEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.DevicesRead)(MakeFeedbackEndpoint(s))),
 	}
 }
 
 func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.ServerOption) {
 	// GET    /push/:udid		create an APNS Push notification for a managed device or user(deprecated)
 	// POST   /v1/push/:udid	create an APNS Push notification for a managed device or user
+	// GET    /v1/push/feedback	list devices whose push tokens were rejected by APNs
 
 	r.Methods("GET").Path("/push/{udid}").Handler(httptransport.NewServer(
 		e.PushEndpoint,
@@ -29,6 +33,13 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 		options...,
 	))
 
+	r.Methods("GET").Path("/v1/push/feedback").Handler(httptransport.NewServer(
+		e.FeedbackEndpoint,
+		decodeFeedbackRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
 	r.Methods("POST").Path("/v1/push/{udid}").Handler(httptransport.NewServer(
 		e.PushEndpoint,
 		decodePushRequest,
@@ -2,7 +2,9 @@ package apns
 
 import (
 	"context"
+	stdcrypto "crypto"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,9 +12,11 @@ import (
 	"time"
 
 	"github.com/RobotsAndPencils/buford/push"
+	"github.com/go-kit/kit/metrics"
 	"github.com/pkg/errors"
-	"golang.org/x/net/http2"
 
+	"github.com/micromdm/micromdm/pkg/crypto"
+	"github.com/micromdm/micromdm/pkg/drain"
 	"github.com/micromdm/micromdm/platform/config"
 	"github.com/micromdm/micromdm/platform/pubsub"
 	"github.com/micromdm/micromdm/platform/queue"
@@ -20,19 +24,56 @@ import (
 
 type Service interface {
 	Push(ctx context.Context, udid string, opts ...PushOption) (string, error)
+	FeedbackReport(ctx context.Context, opt FeedbackOption) ([]FeedbackEntry, error)
 }
 
 type Store interface {
 	PushInfo(ctx context.Context, udid string) (*PushInfo, error)
+
+	// InvalidateToken marks the push token of udid as unregistered at the
+	// given time, unless the token was updated at or after it. It reports
+	// whether the token was valid before the call.
+	InvalidateToken(ctx context.Context, udid string, at time.Time) (bool, error)
 }
 
 type PushService struct {
 	store    Store
+	pub      pubsub.Publisher
 	start    chan struct{}
 	provider PushCertificateProvider
+	// host is the APNs host, or empty to choose it from the push certificate.
+	host      string
+	transport TransportOptions
+
+	// MaxAttempts is the number of times a push is sent when APNs responds
+	// with a transient error, such as 429 Too Many Requests or 503 Service Unavailable.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with every
+	// attempt, unless APNs requests a delay with the Retry-After header.
+	BaseDelay time.Duration
 
 	mu      sync.RWMutex
 	pushsvc *push.Service
+
+	feedback feedbackReport
+	work     drain.Group
+
+	// ctx is the context of the pushes of queued commands, which is cancelled
+	// by Shutdown to stop the pushes waiting to be retried.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// pushSlots bounds the pushes of queued commands which are sent at once,
+	// so that they are multiplexed on the connections to APNs.
+	pushSlots chan struct{}
+
+	pushes       metrics.Counter
+	pushDuration metrics.Histogram
+
+	// pingMu is held while APNs is pinged, so that concurrent callers of Ping
+	// share the result of pingErr at pingAt.
+	pingMu  sync.Mutex
+	pingAt  time.Time
+	pingErr error
 }
 
 type PushCertificateProvider interface {
@@ -47,17 +88,34 @@ func WithPushService(svc *push.Service) Option {
 	}
 }
 
-func New(db Store, provider PushCertificateProvider, sub pubsub.Subscriber, opts ...Option) (*PushService, error) {
+// WithHost sets the APNs host pushes are sent to. By default it is chosen
+// from the environment of the push certificate with CertificateHost.
+func WithHost(host string) Option {
+	return func(p *PushService) {
+		p.host = host
+	}
+}
+
+func New(db Store, provider PushCertificateProvider, sub pubsub.PublishSubscriber, opts ...Option) (*PushService, error) {
 	pushSvc := PushService{
-		store:    db,
-		provider: provider,
-		start:    make(chan struct{}),
+		store:       db,
+		pub:         sub,
+		provider:    provider,
+		start:       make(chan struct{}),
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultBaseDelay,
 	}
+	pushSvc.ctx, pushSvc.cancel = context.WithCancel(context.Background())
 	for _, opt := range opts {
 		opt(&pushSvc)
 	}
+	concurrentPushes := maxConcurrentPushes
+	if pushSvc.transport.MaxConcurrentStreams > 0 {
+		concurrentPushes = pushSvc.transport.MaxConcurrentStreams
+	}
+	pushSvc.pushSlots = make(chan struct{}, concurrentPushes)
 
-	pushsvc, _ := NewPushService(provider)
+	pushsvc, _ := newPushService(provider, pushSvc.host, pushSvc.transport)
 	if pushsvc != nil {
 		pushSvc.pushsvc = pushsvc
 	}
@@ -74,6 +132,28 @@ func New(db Store, provider PushCertificateProvider, sub pubsub.Subscriber, opts
 	return &pushSvc, nil
 }
 
+// Work tracks the pushes which are being sent.
+func (svc *PushService) Work() *drain.Group {
+	return &svc.work
+}
+
+// Shutdown rejects new pushes and waits for the pushes being sent. Once ctx is
+// done, the pushes of queued commands which are waiting to be retried give up.
+func (svc *PushService) Shutdown(ctx context.Context) error {
+	if svc.cancel != nil {
+		defer svc.cancel()
+	}
+	return svc.work.Drain(ctx)
+}
+
+// maxConcurrentPushes bounds the pushes of queued commands which are sent,
+// or wait to be retried, at once, unless TransportOptions.MaxConcurrentStreams
+// is set.
+const maxConcurrentPushes = 100
+
+// pushClientTimeout is the timeout of push requests.
+const pushClientTimeout = 20 * time.Second
+
 func (svc *PushService) startQueuedSubscriber(sub pubsub.Subscriber) error {
 	commandQueuedEvents, err := sub.Subscribe(context.TODO(), "push-info", queue.CommandQueuedTopic)
 	if err != nil {
@@ -89,16 +169,25 @@ func (svc *PushService) startQueuedSubscriber(sub pubsub.Subscriber) error {
 		for {
 			select {
 			case event := <-commandQueuedEvents:
+				svc.work.Add()
 				cq, err := queue.UnmarshalQueuedCommand(event.Message)
 				if err != nil {
+					svc.work.Done()
 					fmt.Println(err)
 					continue
 				}
-				_, err = svc.Push(context.TODO(), cq.DeviceUDID)
-				if err != nil {
-					fmt.Println(err)
-					continue
-				}
+				// each push is sent in its own goroutine, so that a push
+				// waiting to be retried does not delay the pushes of other devices.
+				svc.pushSlots <- struct{}{}
+				go func(udid string) {
+					defer func() {
+						<-svc.pushSlots
+						svc.work.Done()
+					}()
+					if _, err := svc.push(svc.ctx, udid); err != nil {
+						fmt.Println(err)
+					}
+				}(cq.DeviceUDID)
 			}
 		}
 	}()
@@ -115,14 +204,18 @@ func updateClient(svc *PushService, sub pubsub.Subscriber) error {
 		for {
 			select {
 			case <-configEvents:
-				pushsvc, err := NewPushService(svc.provider)
+				pushsvc, err := newPushService(svc.provider, svc.host, svc.transport)
 				if err != nil {
 					log.Printf("push: could not get push certificate %s\n", err)
 					continue
 				}
 				svc.mu.Lock()
+				old := svc.pushsvc
 				svc.pushsvc = pushsvc
 				svc.mu.Unlock()
+				if old != nil {
+					closeClient(old.Client)
+				}
 				go func() { svc.start <- struct{}{} }() // unblock queue
 			}
 		}
@@ -130,38 +223,112 @@ func updateClient(svc *PushService, sub pubsub.Subscriber) error {
 	return nil
 }
 
-func newClient(cert tls.Certificate) (*http.Client, error) {
-	config := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-	}
-	config.BuildNameToCertificate()
-	transport := &http.Transport{
-		Proxy:           http.ProxyFromEnvironment,
-		TLSClientConfig: config,
-		IdleConnTimeout: 90 * time.Second,
+func newClient(identity crypto.Identity, opts TransportOptions) (*http.Client, error) {
+	config, err := crypto.PushTLSConfig(identity)
+	if err != nil {
+		return nil, err
 	}
-
-	if err := http2.ConfigureTransport(transport); err != nil {
+	transport, err := newTransport(config, opts)
+	if err != nil {
 		return nil, err
 	}
 
 	return &http.Client{
 		Transport: transport,
-		Timeout:   20 * time.Second,
+		Timeout:   pushClientTimeout,
 	}, nil
 }
 
+// closeClient closes the connections of a push client which was replaced. The
+// connections of pushes still in flight are closed once those pushes time out.
+func closeClient(client *http.Client) {
+	client.CloseIdleConnections()
+	time.AfterFunc(pushClientTimeout, client.CloseIdleConnections)
+}
+
+func pushIdentity(cert tls.Certificate) (crypto.Identity, error) {
+	if len(cert.Certificate) == 0 {
+		return crypto.Identity{}, errors.New("push certificate is empty")
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return crypto.Identity{}, errors.Wrap(err, "parse push certificate")
+		}
+	}
+	key, ok := cert.PrivateKey.(stdcrypto.Signer)
+	if !ok {
+		return crypto.Identity{}, errors.Errorf("unsupported push certificate private key type %T", cert.PrivateKey)
+	}
+	return crypto.Identity{Certificate: leaf, PrivateKey: key}, nil
+}
+
+// NewPushService creates a push.Service with the push certificate of
+// provider, which sends to the APNs host of the certificate's environment.
 func NewPushService(provider PushCertificateProvider) (*push.Service, error) {
+	return newPushService(provider, "", TransportOptions{})
+}
+
+func newPushService(provider PushCertificateProvider, host string, opts TransportOptions) (*push.Service, error) {
 	cert, err := provider.PushCertificate()
 	if err != nil {
 		return nil, errors.Wrap(err, "get push certificate from store")
 	}
+	identity, err := pushIdentity(*cert)
+	if err != nil {
+		return nil, errors.Wrap(err, "create push service client")
+	}
 
-	client, err := newClient(*cert)
+	client, err := newClient(identity, opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "create push service client")
 	}
 
-	svc := push.NewService(client, push.Production)
+	if host == "" {
+		host = CertificateHost(identity.Certificate)
+	}
+	svc := push.NewService(client, host)
 	return svc, nil
 }
+
+// pingCacheTTL is how long the result of Ping is reused, so that frequent
+// readiness probes, which are not authenticated, do not each connect to APNs.
+const pingCacheTTL = 30 * time.Second
+
+// Ping checks that APNs can be reached with the push certificate. The request
+// is not a push, so any response from APNs, even an error status, means it can.
+// The result is reused for 30 seconds.
+func (svc *PushService) Ping(ctx context.Context) error {
+	svc.mu.RLock()
+	pushsvc := svc.pushsvc
+	svc.mu.RUnlock()
+	if pushsvc == nil {
+		return errors.New("push certificate is not loaded")
+	}
+
+	svc.pingMu.Lock()
+	defer svc.pingMu.Unlock()
+	if !svc.pingAt.IsZero() && time.Since(svc.pingAt) < pingCacheTTL {
+		return svc.pingErr
+	}
+	err := ping(ctx, pushsvc)
+	if ctx.Err() == nil {
+		// the failure of a canceled probe says nothing about APNs.
+		svc.pingAt, svc.pingErr = time.Now(), err
+	}
+	return err
+}
+
+func ping(ctx context.Context, pushsvc *push.Service) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pushsvc.Host+"/", nil)
+	if err != nil {
+		return errors.Wrap(err, "create APNs request")
+	}
+	resp, err := pushsvc.Client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "connect to APNs")
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,133 @@
+package apns
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+)
+
+// Defaults of TransportOptions.
+const (
+	DefaultIdleTimeout  = time.Hour
+	DefaultPingInterval = time.Minute
+)
+
+// transportPingTimeout is how long to wait for the response to a health check
+// ping before the connection is closed.
+const transportPingTimeout = 15 * time.Second
+
+// TransportOptions configures the long-lived HTTP/2 connections pushes are
+// multiplexed on.
+type TransportOptions struct {
+	// MaxConcurrentStreams limits the pushes in flight at once. When it is
+	// set, pushes wait for a stream on an open connection rather than
+	// opening a new connection once the APNs limit for a connection is reached.
+	MaxConcurrentStreams int
+
+	// IdleTimeout is how long a connection is kept open without pushes.
+	// Defaults to DefaultIdleTimeout.
+	IdleTimeout time.Duration
+
+	// PingInterval is how long a connection may receive nothing before it is
+	// checked with a ping, so that broken connections are replaced before a
+	// push is sent on them. Defaults to DefaultPingInterval.
+	PingInterval time.Duration
+}
+
+// WithTransportOptions configures the connections pushes are sent on.
+func WithTransportOptions(opts TransportOptions) Option {
+	return func(p *PushService) {
+		p.transport = opts
+	}
+}
+
+func newTransport(config *tls.Config, opts TransportOptions) (http.RoundTripper, error) {
+	if opts.IdleTimeout == 0 {
+		opts.IdleTimeout = DefaultIdleTimeout
+	}
+	if opts.PingInterval == 0 {
+		opts.PingInterval = DefaultPingInterval
+	}
+	t1 := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: config,
+		IdleConnTimeout: opts.IdleTimeout,
+	}
+	t2, err := http2.ConfigureTransports(t1)
+	if err != nil {
+		return nil, err
+	}
+	t2.ReadIdleTimeout = opts.PingInterval
+	t2.PingTimeout = transportPingTimeout
+
+	var transport http.RoundTripper = t1
+	if opts.MaxConcurrentStreams > 0 {
+		t2.StrictMaxConcurrentStreams = true
+		transport = &streamLimiter{next: transport, streams: make(chan struct{}, opts.MaxConcurrentStreams)}
+	}
+	return &goAwayRetrier{next: transport}, nil
+}
+
+// streamLimiter limits the requests in flight to the capacity of streams.
+type streamLimiter struct {
+	next    http.RoundTripper
+	streams chan struct{}
+}
+
+func (l *streamLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case l.streams <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	defer func() { <-l.streams }()
+	return l.next.RoundTrip(req)
+}
+
+func (l *streamLimiter) CloseIdleConnections() { closeIdleConnections(l.next) }
+
+// goAwayRetrier sends a request again when the connection it was sent on is
+// closed by a GOAWAY from APNs, such as when APNs restarts or the connection
+// has been idle for too long. The retry is sent on a new connection, because
+// the transport does not reuse a connection once it receives a GOAWAY.
+type goAwayRetrier struct {
+	next http.RoundTripper
+}
+
+func (r *goAwayRetrier) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err == nil || !isGoAway(err) {
+		return resp, err
+	}
+	retry := req.Clone(req.Context())
+	if req.Body != nil {
+		if req.GetBody == nil {
+			return resp, err
+		}
+		body, berr := req.GetBody()
+		if berr != nil {
+			return resp, err
+		}
+		retry.Body = body
+	}
+	return r.next.RoundTrip(retry)
+}
+
+func (r *goAwayRetrier) CloseIdleConnections() { closeIdleConnections(r.next) }
+
+func closeIdleConnections(transport http.RoundTripper) {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if t, ok := transport.(closeIdler); ok {
+		t.CloseIdleConnections()
+	}
+}
+
+func isGoAway(err error) bool {
+	var goAway http2.GoAwayError
+	return errors.As(err, &goAway)
+}
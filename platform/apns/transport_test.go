@@ -0,0 +1,213 @@
+package apns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RobotsAndPencils/buford/push"
+	"golang.org/x/net/http2"
+
+	"github.com/micromdm/micromdm/pkg/drain"
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+	"github.com/micromdm/micromdm/platform/queue"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestGoAwayRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"goaway", http2.GoAwayError{ErrCode: http2.ErrCodeNo, DebugData: `{"reason":"Shutdown"}`}, 2, false},
+		{"other error", errors.New("connection refused"), 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []string
+			retrier := &goAwayRetrier{next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				body, _ := ioutil.ReadAll(req.Body)
+				bodies = append(bodies, string(body))
+				if len(bodies) == 1 {
+					return nil, tt.err
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})}
+			req, _ := http.NewRequest("POST", "https://api.push.apple.com/3/device/token", strings.NewReader(`{"mdm":"magic"}`))
+			_, err := retrier.RoundTrip(req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("have error %v, want error %v", err, tt.wantErr)
+			}
+			if len(bodies) != tt.wantAttempts {
+				t.Fatalf("have %d attempts, want %d", len(bodies), tt.wantAttempts)
+			}
+			for _, body := range bodies {
+				if body != `{"mdm":"magic"}` {
+					t.Errorf("have body %q on attempt, want the push payload", body)
+				}
+			}
+		})
+	}
+}
+
+// http2Server returns an HTTP/2 server which counts the connections made to
+// it, and a TLS config which trusts it.
+func http2Server(tb testing.TB) (*httptest.Server, *tls.Config, *int32) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Header().Set("apns-id", "push-id")
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.StartTLS()
+	tb.Cleanup(srv.Close)
+	config := srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	config.NextProtos = []string{"h2"}
+	return srv, config, &conns
+}
+
+func sendPush(tb testing.TB, transport http.RoundTripper, url string) {
+	req, _ := http.NewRequest("POST", url+"/3/device/token", bytes.NewReader([]byte(`{"mdm":"magic"}`)))
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		tb.Error(err)
+		return
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		tb.Errorf("have protocol %s, want HTTP/2", resp.Proto)
+	}
+}
+
+func TestPushesAreMultiplexed(t *testing.T) {
+	srv, config, conns := http2Server(t)
+	transport, err := newTransport(config, TransportOptions{MaxConcurrentStreams: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendPush(t, transport, srv.URL)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sendPush(t, transport, srv.URL)
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(conns); n != 1 {
+		t.Errorf("have %d connections for 51 pushes, want 1", n)
+	}
+}
+
+func TestStreamLimiter(t *testing.T) {
+	var inFlight, maxInFlight int32
+	limiter := &streamLimiter{streams: make(chan struct{}, 3), next: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", "https://api.push.apple.com/3/device/token", nil)
+			limiter.RoundTrip(req)
+		}()
+	}
+	wg.Wait()
+	if maxInFlight > 3 {
+		t.Errorf("have %d requests in flight, want at most 3", maxInFlight)
+	}
+}
+
+func TestCloseIdleConnections(t *testing.T) {
+	srv, config, conns := http2Server(t)
+	transport, err := newTransport(config, TransportOptions{MaxConcurrentStreams: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendPush(t, transport, srv.URL)
+	closeClient(&http.Client{Transport: transport})
+	sendPush(t, transport, srv.URL)
+	if n := atomic.LoadInt32(conns); n != 2 {
+		t.Errorf("have %d connections, want a new connection after the client was closed", n)
+	}
+}
+
+// benchmarkQueuedPushes sends the pushes of queued commands with transport.
+func benchmarkQueuedPushes(b *testing.B, url string, transport http.RoundTripper) {
+	svc := &PushService{
+		store:       newMockStore(time.Now()),
+		pub:         &mockPublisher{},
+		pushsvc:     push.NewService(&http.Client{Transport: transport}, url),
+		MaxAttempts: 1,
+		ctx:         context.Background(),
+		pushSlots:   make(chan struct{}, maxConcurrentPushes),
+	}
+	ps := inmem.NewPubSub()
+	if err := svc.startQueuedSubscriber(ps); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := queue.PublishCommandQueued(ps, "UDID", "command"); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := drain.Settle(context.Background(), ps.Work(), svc.Work()); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkPushMultiplexed sends the pushes of queued commands on one
+// long-lived HTTP/2 connection.
+func BenchmarkPushMultiplexed(b *testing.B) {
+	srv, config, _ := http2Server(b)
+	transport, err := newTransport(config, TransportOptions{MaxConcurrentStreams: 100})
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkQueuedPushes(b, srv.URL, transport)
+}
+
+// BenchmarkPushNewConnection opens a new connection for the push of every
+// queued command.
+func BenchmarkPushNewConnection(b *testing.B) {
+	srv, config, _ := http2Server(b)
+	benchmarkQueuedPushes(b, srv.URL, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		transport := &http2.Transport{TLSClientConfig: config}
+		defer transport.CloseIdleConnections()
+		return transport.RoundTrip(req)
+	}))
+}
@@ -0,0 +1,62 @@
+package apns
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/RobotsAndPencils/buford/push"
+	"github.com/pkg/errors"
+)
+
+// TokenInvalidatedTopic is published when APNs reports that the push token of
+// a device is no longer valid. Subscribers may use it to re-trigger enrollment.
+const TokenInvalidatedTopic = "mdm.PushTokenInvalidated"
+
+// TokenInvalidatedEvent is the JSON message published to TokenInvalidatedTopic.
+type TokenInvalidatedEvent struct {
+	UDID          string    `json:"udid"`
+	InvalidatedAt time.Time `json:"invalidated_at"`
+}
+
+// errTokenInvalid is returned by Push for devices whose token APNs reported as
+// Unregistered. No push is sent until the device sends a new TokenUpdate.
+type errTokenInvalid struct {
+	udid string
+}
+
+func (e errTokenInvalid) Error() string {
+	return "push token for udid " + e.udid + " was unregistered by APNs"
+}
+
+// isUnregistered reports whether err is an APNs 410 response for a token
+// which is no longer active for the topic, and returns the time APNs last
+// confirmed that the token was invalid.
+func isUnregistered(err error) (time.Time, bool) {
+	e, ok := err.(*push.Error)
+	if !ok || e.Reason != push.ErrUnregistered {
+		return time.Time{}, false
+	}
+	return e.Timestamp, true
+}
+
+// invalidateToken marks the push token of udid invalid as of at and notifies
+// subscribers. Tokens updated by the device at or after at are left alone.
+func (svc *PushService) invalidateToken(ctx context.Context, udid string, at time.Time) error {
+	if at.IsZero() {
+		at = time.Now().UTC()
+	}
+	invalidated, err := svc.store.InvalidateToken(ctx, udid, at)
+	if err != nil {
+		return errors.Wrapf(err, "invalidate push token for udid=%s", udid)
+	}
+	if !invalidated {
+		return nil
+	}
+	msg, err := json.Marshal(TokenInvalidatedEvent{UDID: udid, InvalidatedAt: at})
+	if err != nil {
+		return errors.Wrap(err, "marshal token invalidated event")
+	}
+	err = svc.pub.Publish(ctx, TokenInvalidatedTopic, msg)
+	return errors.Wrapf(err, "publish %s event", TokenInvalidatedTopic)
+}
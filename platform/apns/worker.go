@@ -2,6 +2,7 @@ package apns
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -13,6 +14,10 @@ import (
 
 type WorkerStore interface {
 	Save(context.Context, *PushInfo) error
+
+	// Delete removes the push info of udid, unless its token was updated at
+	// or after before, which means the device enrolled again.
+	Delete(ctx context.Context, udid string, before time.Time) error
 }
 
 type Worker struct {
@@ -36,6 +41,11 @@ func (w *Worker) Run(ctx context.Context) error {
 		return errors.Wrapf(err,
 			"subscribing %s to %s topic", subscription, mdm.TokenUpdateTopic)
 	}
+	checkoutEvents, err := w.sub.Subscribe(ctx, subscription, mdm.CheckoutTopic)
+	if err != nil {
+		return errors.Wrapf(err,
+			"subscribing %s to %s topic", subscription, mdm.CheckoutTopic)
+	}
 
 	for {
 		var err error
@@ -44,6 +54,8 @@ func (w *Worker) Run(ctx context.Context) error {
 			return ctx.Err()
 		case event := <-tokenUpdateEvents:
 			err = w.updatePushInfoFromTokenUpdate(ctx, event.Message)
+		case event := <-checkoutEvents:
+			err = w.deletePushInfoFromCheckout(ctx, event.Message)
 		}
 		if err != nil {
 			level.Info(w.logger).Log(
@@ -65,6 +77,8 @@ func (w *Worker) updatePushInfoFromTokenUpdate(ctx context.Context, message []by
 		Token:     ev.Command.Token.String(),
 		PushMagic: ev.Command.PushMagic,
 		MDMTopic:  ev.Command.Topic,
+
+		TokenUpdatedAt: time.Now().UTC(),
 	}
 	// UDID is the primary key for storing the APNS values.
 	// For MDM managed users, use the UserID instead,
@@ -78,3 +92,21 @@ func (w *Worker) updatePushInfoFromTokenUpdate(ctx context.Context, message []by
 	err := w.db.Save(ctx, &info)
 	return errors.Wrapf(err, "saving pushinfo for udid=%s", info.UDID)
 }
+
+// deletePushInfoFromCheckout removes the push token of an unenrolled device, so
+// that no more pushes are sent to it.
+func (w *Worker) deletePushInfoFromCheckout(ctx context.Context, message []byte) error {
+	var ev mdm.CheckinEvent
+	if err := mdm.UnmarshalCheckinEvent(message, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal pushinfo event")
+	}
+	udid := ev.Command.UDID
+	if ev.Command.UserID != "" {
+		udid = ev.Command.UserID
+	}
+	if ev.Command.EnrollmentID != "" {
+		udid = ev.Command.EnrollmentID
+	}
+	err := w.db.Delete(ctx, udid, ev.Time)
+	return errors.Wrapf(err, "deleting pushinfo for udid=%s", udid)
+}
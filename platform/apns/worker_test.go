@@ -0,0 +1,100 @@
+package apns
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RobotsAndPencils/buford/push"
+
+	"github.com/micromdm/micromdm/mdm"
+)
+
+type workerStore struct {
+	mu    sync.Mutex
+	infos map[string]PushInfo
+}
+
+func (s *workerStore) Save(_ context.Context, info *PushInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.infos[info.UDID] = *info
+	return nil
+}
+
+func (s *workerStore) Delete(_ context.Context, udid string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, ok := s.infos[udid]; ok && info.TokenUpdatedAt.Before(before) {
+		delete(s.infos, udid)
+	}
+	return nil
+}
+
+func (s *workerStore) PushInfo(_ context.Context, udid string) (*PushInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.infos[udid]
+	if !ok {
+		return nil, errors.New("push info not found")
+	}
+	return &info, nil
+}
+
+func (s *workerStore) InvalidateToken(context.Context, string, time.Time) (bool, error) {
+	return false, nil
+}
+
+func checkoutMessage(t *testing.T, udid string, at time.Time) []byte {
+	t.Helper()
+	msg, err := mdm.MarshalCheckinEvent(&mdm.CheckinEvent{
+		ID:      "id",
+		Time:    at,
+		Command: mdm.CheckinCommand{MessageType: "CheckOut", UDID: udid},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestCheckoutSuppressesPushes(t *testing.T) {
+	srv, requests := fakeAPNs(t, nil)
+	store := &workerStore{infos: make(map[string]PushInfo)}
+	svc := &PushService{
+		store:       store,
+		pub:         &mockPublisher{},
+		pushsvc:     push.NewService(srv.Client(), srv.URL),
+		MaxAttempts: 1,
+	}
+	w := NewWorker(store, nil, nil)
+	ctx := context.Background()
+
+	updated := time.Now().UTC()
+	for _, udid := range []string{"UDID-1", "UDID-2"} {
+		info := &PushInfo{UDID: udid, Token: testToken, PushMagic: "magic", TokenUpdatedAt: updated}
+		if err := store.Save(ctx, info); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.deletePushInfoFromCheckout(ctx, checkoutMessage(t, "UDID-1", updated.Add(time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Push(ctx, "UDID-1"); err == nil {
+		t.Error("expected push to a checked out device to fail")
+	}
+	if have := *requests; have != 0 {
+		t.Errorf("have %d requests to APNs after CheckOut, want none", have)
+	}
+
+	// a CheckOut from before the last TokenUpdate is from an earlier enrollment.
+	if err := w.deletePushInfoFromCheckout(ctx, checkoutMessage(t, "UDID-2", updated.Add(-time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Push(ctx, "UDID-2"); err != nil {
+		t.Errorf("push to a re-enrolled device: %s", err)
+	}
+}
@@ -31,6 +31,19 @@ func (r *Repo) SaveFile(name string, f io.Reader) error {
 	return err
 }
 
+func (r *Repo) OpenFile(name string) (io.ReadCloser, int64, error) {
+	file, err := os.Open(filepath.Join(r.Path, filepath.Base(name)))
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "opening file %s", name)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, errors.Wrapf(err, "stat file %s", name)
+	}
+	return file, info.Size(), nil
+}
+
 func (r *Repo) Manifest(name string) (*appmanifest.Manifest, error) {
 	manifestName := name
 	if !strings.HasSuffix(name, ".plist") {
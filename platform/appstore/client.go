@@ -38,8 +38,20 @@ func NewHTTPClient(instance, token string, logger log.Logger, opts ...httptransp
 		).Endpoint()
 	}
 
+	var installEndpoint endpoint.Endpoint
+	{
+		installEndpoint = httptransport.NewClient(
+			"POST",
+			httputil.CopyURL(u, "/v1/apps/install"),
+			httputil.EncodeRequestWithToken(token, httptransport.EncodeJSONRequest),
+			decodeInstallApplicationCommandResponse,
+			opts...,
+		).Endpoint()
+	}
+
 	return Endpoints{
 		AppUploadEndpoint: appUploadEndpoint,
 		ListAppsEndpoint:  listAppsEndpoint,
+		InstallEndpoint:   installEndpoint,
 	}, nil
 }
@@ -0,0 +1,124 @@
+package appstore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/mdm/appmanifest"
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/pkg/httputil"
+)
+
+// InstallApplicationOptions describe the manifest and InstallApplication
+// command created for a package by InstallApplicationCommand.
+type InstallApplicationOptions struct {
+	// ManifestName is the name the manifest is served as. It defaults to the
+	// package name without its extension.
+	ManifestName string `json:"manifest_name,omitempty"`
+
+	// BundleIdentifier, BundleVersion and Title are the manifest metadata,
+	// which is added if BundleIdentifier is set.
+	BundleIdentifier string `json:"bundle_identifier,omitempty"`
+	BundleVersion    string `json:"bundle_version,omitempty"`
+	Title            string `json:"title,omitempty"`
+
+	// ManagementFlags are the InstallApplication ManagementFlags.
+	ManagementFlags int `json:"management_flags,omitempty"`
+}
+
+// InstallApplicationCommand creates a manifest for the package pkgName in the
+// store, serves it with ServeManifest and returns an InstallApplication command
+// for the served manifest.
+func (svc *AppService) InstallApplicationCommand(ctx context.Context, pkgName string, opt InstallApplicationOptions) (*mdm.Command, error) {
+	if svc.repoURL == "" {
+		return nil, errors.New("serving manifests requires a repo URL")
+	}
+	pkgName = path.Base(pkgName)
+	if pkgName == "" || pkgName == "." || pkgName == "/" {
+		return nil, errors.New("package name is required")
+	}
+	pkg, size, err := svc.store.OpenFile(pkgName)
+	if err != nil {
+		return nil, err
+	}
+	defer pkg.Close()
+
+	var manifestOpts []appmanifest.Option
+	if opt.BundleIdentifier != "" {
+		manifestOpts = append(manifestOpts, appmanifest.WithMetadata(opt.BundleIdentifier, opt.BundleVersion, opt.Title))
+	}
+	pkgURL := strings.TrimSuffix(svc.repoURL, "/") + "/" + url.PathEscape(pkgName)
+	manifest, err := appmanifest.Create(sizedReader{pkg, size}, pkgURL, manifestOpts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create manifest for %s", pkgName)
+	}
+
+	manifestName := opt.ManifestName
+	if manifestName == "" {
+		manifestName = strings.TrimSuffix(pkgName, path.Ext(pkgName))
+	}
+	manifestURL, err := svc.ServeManifest(ctx, manifestName, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return mdm.NewInstallApplicationCommand(manifestURL, opt.ManagementFlags)
+}
+
+type sizedReader struct {
+	io.Reader
+	size int64
+}
+
+func (r sizedReader) Size() int64 { return r.size }
+
+type installApplicationCommandRequest struct {
+	PkgName string `json:"pkg_name"`
+	InstallApplicationOptions
+}
+
+type installApplicationCommandResponse struct {
+	Command *mdm.Command `json:"command,omitempty"`
+	Err     error        `json:"err,omitempty"`
+}
+
+func (r installApplicationCommandResponse) Failed() error { return r.Err }
+
+func decodeInstallApplicationCommandRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req installApplicationCommandRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	return req, err
+}
+
+func decodeInstallApplicationCommandResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp installApplicationCommandResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func MakeInstallApplicationCommandEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(installApplicationCommandRequest)
+		cmd, err := svc.InstallApplicationCommand(ctx, req.PkgName, req.InstallApplicationOptions)
+		return installApplicationCommandResponse{
+			Command: cmd,
+			Err:     err,
+		}, nil
+	}
+}
+
+func (e Endpoints) InstallApplicationCommand(ctx context.Context, pkgName string, opt InstallApplicationOptions) (*mdm.Command, error) {
+	request := installApplicationCommandRequest{PkgName: pkgName, InstallApplicationOptions: opt}
+	response, err := e.InstallEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(installApplicationCommandResponse)
+	return resp.Command, resp.Err
+}
@@ -0,0 +1,126 @@
+package appstore_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/groob/plist"
+
+	"github.com/micromdm/micromdm/mdm/appmanifest"
+	"github.com/micromdm/micromdm/pkg/scope"
+	"github.com/micromdm/micromdm/platform/appstore"
+	"github.com/micromdm/micromdm/platform/appstore/builtin"
+)
+
+func adminMiddleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return next(scope.NewContext(ctx, &scope.Principal{Name: "test", Scopes: []string{scope.Admin}}), request)
+	}
+}
+
+func TestInstallApplicationCommand(t *testing.T) {
+	dir := t.TempDir()
+	pkg := []byte("package contents")
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.pkg"), pkg, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	srv := httptest.NewTLSServer(r)
+	defer srv.Close()
+
+	svc := appstore.New(&builtin.Repo{Path: dir}, appstore.WithRepoURL(srv.URL+"/repo/"))
+	appstore.RegisterHTTPHandlers(r, appstore.MakeServerEndpoints(svc, adminMiddleware))
+	r.PathPrefix("/repo/").Handler(http.StripPrefix("/repo/", http.FileServer(http.Dir(dir))))
+
+	client, err := appstore.NewHTTPClient(srv.URL, "secret", log.NewNopLogger(), httptransport.SetClient(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := client.InstallApplicationCommand(context.Background(), "app.pkg", appstore.InstallApplicationOptions{
+		BundleIdentifier: "com.example.app",
+		BundleVersion:    "1.0",
+		Title:            "App",
+		ManagementFlags:  1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cmd.RequestType, "InstallApplication"; have != want {
+		t.Fatalf("have request type %s, want %s", have, want)
+	}
+	manifestURL := *cmd.InstallApplication.ManifestURL
+	if have, want := manifestURL, srv.URL+"/repo/app.plist"; have != want {
+		t.Errorf("have manifest url %s, want %s", have, want)
+	}
+	if have, want := *cmd.InstallApplication.ManagementFlags, 1; have != want {
+		t.Errorf("have management flags %d, want %d", have, want)
+	}
+
+	resp, err := srv.Client().Get(manifestURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("have status %d fetching the manifest, want 200", resp.StatusCode)
+	}
+	var manifest appmanifest.Manifest
+	if err := plist.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifest.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	item := manifest.ManifestItems[0]
+	if have, want := item.Assets[0].URL, srv.URL+"/repo/app.pkg"; have != want {
+		t.Errorf("have asset url %s, want %s", have, want)
+	}
+	sum := md5.Sum(pkg)
+	if have, want := item.Assets[0].MD5s[0], hex.EncodeToString(sum[:]); have != want {
+		t.Errorf("have md5 %s, want %s", have, want)
+	}
+	if have, want := item.Metadata.BundleIdentifier, "com.example.app"; have != want {
+		t.Errorf("have bundle identifier %s, want %s", have, want)
+	}
+
+	if _, err := client.InstallApplicationCommand(context.Background(), "missing.pkg", appstore.InstallApplicationOptions{}); err == nil {
+		t.Error("expected error for a missing package")
+	}
+}
+
+func TestInstallApplicationCommandScope(t *testing.T) {
+	svc := appstore.New(&builtin.Repo{Path: t.TempDir()})
+	tests := []struct {
+		scope     string
+		forbidden bool
+	}{
+		{scope.CommandsWrite, false},
+		{scope.ProfilesWrite, true},
+	}
+	for _, tt := range tests {
+		principal := func(next endpoint.Endpoint) endpoint.Endpoint {
+			return func(ctx context.Context, request interface{}) (interface{}, error) {
+				return next(scope.NewContext(ctx, &scope.Principal{Name: "test", Scopes: []string{tt.scope}}), request)
+			}
+		}
+		r := mux.NewRouter()
+		appstore.RegisterHTTPHandlers(r, appstore.MakeServerEndpoints(svc, principal))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/apps/install", strings.NewReader(`{"pkg_name": "app.pkg"}`)))
+		if have, want := rec.Code == http.StatusForbidden, tt.forbidden; have != want {
+			t.Errorf("%s: have status %d, want forbidden %t", tt.scope, rec.Code, want)
+		}
+	}
+}
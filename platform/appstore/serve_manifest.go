@@ -0,0 +1,39 @@
+package appstore
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/groob/plist"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/mdm/appmanifest"
+)
+
+// ServeManifest saves the manifest to the store as name.plist and returns the URL
+// it is served from, for use as the ManifestURL of an InstallApplication command.
+func (svc *AppService) ServeManifest(ctx context.Context, name string, manifest *appmanifest.Manifest) (string, error) {
+	if svc.repoURL == "" {
+		return "", errors.New("serving manifests requires a repo URL")
+	}
+	name = strings.TrimSuffix(path.Base(name), ".plist")
+	if name == "" || name == "." || name == "/" {
+		return "", errors.New("manifest name is required")
+	}
+	if err := manifest.Validate(); err != nil {
+		return "", errors.Wrapf(err, "validate manifest %s", name)
+	}
+
+	data, err := plist.MarshalIndent(manifest, "  ")
+	if err != nil {
+		return "", errors.Wrapf(err, "marshal manifest %s", name)
+	}
+	filename := name + ".plist"
+	if err := svc.store.SaveFile(filename, bytes.NewReader(data)); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(svc.repoURL, "/") + "/" + url.PathEscape(filename), nil
+}
@@ -0,0 +1,69 @@
+package appstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/groob/plist"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/mdm/appmanifest"
+)
+
+type memStore map[string][]byte
+
+func (s memStore) SaveFile(name string, f io.Reader) error {
+	data, err := ioutil.ReadAll(f)
+	s[name] = data
+	return err
+}
+
+func (s memStore) Manifest(name string) (*appmanifest.Manifest, error) { return nil, nil }
+
+func (s memStore) Apps(name string) (map[string]appmanifest.Manifest, error) { return nil, nil }
+
+func (s memStore) OpenFile(name string) (io.ReadCloser, int64, error) {
+	data, ok := s[name]
+	if !ok {
+		return nil, 0, errors.Errorf("file %s not found", name)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+func TestServeManifest(t *testing.T) {
+	manifest := &appmanifest.Manifest{ManifestItems: []appmanifest.Item{{
+		Assets: []appmanifest.Asset{{
+			Kind:    "software-package",
+			MD5Size: 3,
+			MD5s:    []string{"acbd18db4cc2f85cedef654fccc4a4d8"},
+			URL:     "https://mdm.example.com/repo/app.pkg",
+		}},
+	}}}
+
+	store := memStore{}
+	svc := New(store, WithRepoURL("https://mdm.example.com/repo/"))
+	manifestURL, err := svc.ServeManifest(context.Background(), "app.plist", manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := manifestURL, "https://mdm.example.com/repo/app.plist"; have != want {
+		t.Errorf("have url %s, want %s", have, want)
+	}
+	var saved appmanifest.Manifest
+	if err := plist.Unmarshal(store["app.plist"], &saved); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := saved.ManifestItems[0].Assets[0].URL, "https://mdm.example.com/repo/app.pkg"; have != want {
+		t.Errorf("have asset url %s, want %s", have, want)
+	}
+
+	if _, err := svc.ServeManifest(context.Background(), "empty", &appmanifest.Manifest{}); err == nil {
+		t.Error("expected error for an invalid manifest")
+	}
+	if _, err := New(store).ServeManifest(context.Background(), "app", manifest); err == nil {
+		t.Error("expected error without a repo URL")
+	}
+}
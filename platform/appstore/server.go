@@ -6,23 +6,27 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 )
 
 type Endpoints struct {
 	AppUploadEndpoint endpoint.Endpoint
 	ListAppsEndpoint  endpoint.Endpoint
+	InstallEndpoint   endpoint.Endpoint
 }
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		AppUploadEndpoint: endpoint.Chain(outer, others...)(MakeUploadAppEndpiont(s)),
-		ListAppsEndpoint:  endpoint.Chain(outer, others...)(MakeListAppsEndpoint(s)),
+		AppUploadEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.ProfilesWrite)(MakeUploadAppEndpiont(s))),
+		ListAppsEndpoint:  endpoint.Chain(outer, others...)(scope.Require(scope.ProfilesRead)(MakeListAppsEndpoint(s))),
+		InstallEndpoint:   endpoint.Chain(outer, others...)(scope.Require(scope.CommandsWrite)(MakeInstallApplicationCommandEndpoint(s))),
 	}
 }
 
 func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.ServerOption) {
 	// PUT		/v1/apps			upload an app to the server
 	// POST   /v1/apps			list apps managed by the server
+	// POST   /v1/apps/install		serve a manifest for a package and create the InstallApplication command
 
 	r.Methods("PUT").Path("/v1/apps").Handler(httptransport.NewServer(
 		e.AppUploadEndpoint,
@@ -37,4 +41,11 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 		httputil.EncodeJSONResponse,
 		options...,
 	))
+
+	r.Methods("POST").Path("/v1/apps/install").Handler(httptransport.NewServer(
+		e.InstallEndpoint,
+		decodeInstallApplicationCommandRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
 }
@@ -5,23 +5,42 @@ import (
 	"io"
 
 	"github.com/micromdm/micromdm/mdm/appmanifest"
+	"github.com/micromdm/micromdm/mdm/mdm"
 )
 
 type Service interface {
 	UploadApp(ctx context.Context, manifestName string, manifest io.Reader, pkgName string, pkg io.Reader) error
 	ListApplications(ctx context.Context, opt ListAppsOption) ([]AppDTO, error)
+	InstallApplicationCommand(ctx context.Context, pkgName string, opt InstallApplicationOptions) (*mdm.Command, error)
 }
 
 type AppService struct {
-	store Store
+	store   Store
+	repoURL string
 }
 
 type Store interface {
 	SaveFile(name string, f io.Reader) error
 	Manifest(name string) (*appmanifest.Manifest, error)
 	Apps(name string) (map[string]appmanifest.Manifest, error)
+	// OpenFile opens the file name and returns its size.
+	OpenFile(name string) (io.ReadCloser, int64, error)
 }
 
-func New(store Store) *AppService {
-	return &AppService{store: store}
+type Option func(*AppService)
+
+// WithRepoURL sets the public URL which the files in the store are served from.
+// It is required to serve manifests with ServeManifest.
+func WithRepoURL(repoURL string) Option {
+	return func(svc *AppService) {
+		svc.repoURL = repoURL
+	}
+}
+
+func New(store Store, opts ...Option) *AppService {
+	svc := &AppService{store: store}
+	for _, optFn := range opts {
+		optFn(svc)
+	}
+	return svc
 }
@@ -0,0 +1,136 @@
+// Package audit records the admin API calls which change the server or act on
+// devices, in a log where each entry is chained to the previous one by its hash.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Outcomes of an audited call.
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+// Entry is a record of an admin API call.
+type Entry struct {
+	// Seq is the position of the entry in the log, starting at 1.
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"request_id,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	// Action is the command or operation of the call, if the request describes it.
+	Action  string   `json:"action,omitempty"`
+	UDIDs   []string `json:"udids,omitempty"`
+	Serials []string `json:"serials,omitempty"`
+	Outcome string   `json:"outcome"`
+	Error   string   `json:"error,omitempty"`
+	// PrevHash is the Hash of the previous entry, and empty for the first entry.
+	PrevHash string `json:"prev_hash"`
+	// Hash is the hex SHA-256 of the entry without its Hash.
+	Hash string `json:"hash"`
+}
+
+// Seal sets the PrevHash of the entry to prev and computes its Hash.
+func (e *Entry) Seal(prev string) error {
+	e.PrevHash = prev
+	hash, err := e.hash()
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+	return nil
+}
+
+func (e Entry) hash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal audit entry")
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify checks that the hash of every entry is valid and that each entry is
+// chained to the one before it. The entries must be consecutive, starting with
+// the first entry of the log.
+func Verify(entries []Entry) error {
+	prev := ""
+	for i, e := range entries {
+		if e.Seq != uint64(i+1) {
+			return errors.Errorf("audit entry %d is out of sequence, expected %d", e.Seq, i+1)
+		}
+		if e.PrevHash != prev {
+			return errors.Errorf("audit entry %d is not chained to the previous entry", e.Seq)
+		}
+		hash, err := e.hash()
+		if err != nil {
+			return err
+		}
+		if hash != e.Hash {
+			return errors.Errorf("audit entry %d was modified", e.Seq)
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+// Target is the action of a request and the devices it acts on.
+type Target struct {
+	Action  string
+	UDIDs   []string
+	Serials []string
+}
+
+// Targeter is implemented by requests which act on devices. Their calls are
+// always recorded, whatever their HTTP method.
+type Targeter interface {
+	AuditTarget() Target
+}
+
+// ListOptions filter the entries of the log.
+type ListOptions struct {
+	UDID  string
+	Actor string
+	Since time.Time
+	// After is the Seq of the last entry of the previous page.
+	After uint64
+	// Limit is the maximum number of entries, or 0 for all.
+	Limit int
+}
+
+// Match reports whether e passes the UDID, Actor and Since filters of opts.
+func (opts ListOptions) Match(e *Entry) bool {
+	if opts.Actor != "" && e.Actor != opts.Actor {
+		return false
+	}
+	if !opts.Since.IsZero() && e.Time.Before(opts.Since) {
+		return false
+	}
+	if opts.UDID == "" {
+		return true
+	}
+	for _, udid := range e.UDIDs {
+		if udid == opts.UDID {
+			return true
+		}
+	}
+	return false
+}
+
+// Store is an append only log of entries.
+type Store interface {
+	// Append assigns the entry the next Seq and seals it with the hash of the last entry.
+	Append(ctx context.Context, e *Entry) error
+	// Entries returns the entries matching opts, in order.
+	Entries(ctx context.Context, opts ListOptions) ([]Entry, error)
+}
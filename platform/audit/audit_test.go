@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"testing"
+	"time"
+)
+
+func sealedLog(t *testing.T, n int) []Entry {
+	t.Helper()
+	var entries []Entry
+	prev := ""
+	for i := 0; i < n; i++ {
+		e := Entry{
+			Seq:     uint64(i + 1),
+			Time:    time.Date(2026, 1, 1, i, 0, 0, 0, time.UTC),
+			Actor:   "admin",
+			Method:  "POST",
+			Path:    "/v1/commands",
+			Action:  "DeviceInformation",
+			UDIDs:   []string{"UDID-1"},
+			Outcome: Success,
+		}
+		if err := e.Seal(prev); err != nil {
+			t.Fatal(err)
+		}
+		prev = e.Hash
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestVerify(t *testing.T) {
+	if err := Verify(sealedLog(t, 3)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func([]Entry) []Entry
+	}{
+		{"modified", func(e []Entry) []Entry { e[1].Action = "EraseDevice"; return e }},
+		{"rehashed", func(e []Entry) []Entry {
+			e[1].Actor = "someone"
+			e[1].Seal(e[1].PrevHash)
+			return e
+		}},
+		{"removed", func(e []Entry) []Entry { return append(e[:1], e[2:]...) }},
+		{"reordered", func(e []Entry) []Entry { e[1], e[2] = e[2], e[1]; return e }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.tamper(sealedLog(t, 3))); err == nil {
+				t.Error("expected error for a tampered log")
+			}
+		})
+	}
+}
+
+func TestListOptionsMatch(t *testing.T) {
+	e := &Entry{Actor: "helpdesk", UDIDs: []string{"UDID-1", "UDID-2"}, Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if !(ListOptions{UDID: "UDID-2", Actor: "helpdesk"}).Match(e) {
+		t.Error("expected entry to match its UDID and actor")
+	}
+	if (ListOptions{UDID: "UDID-3"}).Match(e) || (ListOptions{Since: e.Time.Add(time.Second)}).Match(e) {
+		t.Error("expected entry not to match")
+	}
+}
@@ -0,0 +1,91 @@
+package builtin
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/platform/audit"
+)
+
+const AuditBucket = "mdm.AuditLog"
+
+// DB stores the audit log, keyed by the big endian Seq of each entry.
+type DB struct {
+	*bolt.DB
+}
+
+func NewDB(db *bolt.DB) (*DB, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(AuditBucket))
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating %s bucket", AuditBucket)
+	}
+	datastore := &DB{
+		DB: db,
+	}
+	return datastore, nil
+}
+
+func seqKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
+
+// Append seals e with the hash of the last entry and stores it, in one transaction.
+func (db *DB) Append(_ context.Context, e *audit.Entry) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(AuditBucket))
+		var prev string
+		if _, v := b.Cursor().Last(); v != nil {
+			var last audit.Entry
+			if err := json.Unmarshal(v, &last); err != nil {
+				return errors.Wrap(err, "unmarshal last audit entry")
+			}
+			prev = last.Hash
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		e.Seq = seq
+		if err := e.Seal(prev); err != nil {
+			return err
+		}
+		v, err := json.Marshal(e)
+		if err != nil {
+			return errors.Wrap(err, "marshal audit entry")
+		}
+		return b.Put(seqKey(seq), v)
+	})
+	return errors.Wrap(err, "append audit entry")
+}
+
+// Entries returns the entries after opts.After which match opts, in order.
+func (db *DB) Entries(_ context.Context, opts audit.ListOptions) ([]audit.Entry, error) {
+	var entries []audit.Entry
+	err := db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(AuditBucket)).Cursor()
+		for k, v := c.Seek(seqKey(opts.After + 1)); k != nil; k, v = c.Next() {
+			var e audit.Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return errors.Wrapf(err, "unmarshal audit entry %d", binary.BigEndian.Uint64(k))
+			}
+			if !opts.Match(&e) {
+				continue
+			}
+			entries = append(entries, e)
+			if opts.Limit > 0 && len(entries) == opts.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return entries, errors.Wrap(err, "list audit entries")
+}
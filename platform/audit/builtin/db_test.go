@@ -0,0 +1,95 @@
+package builtin
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/micromdm/micromdm/platform/audit"
+)
+
+func TestAppendEntries(t *testing.T) {
+	db := setupDB(t)
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, udid := range []string{"UDID-1", "UDID-2", "UDID-1"} {
+		e := &audit.Entry{
+			Time:    start.Add(time.Duration(i) * time.Hour),
+			Actor:   "helpdesk",
+			Method:  "POST",
+			Path:    "/v1/commands",
+			UDIDs:   []string{udid},
+			Outcome: audit.Success,
+		}
+		if err := db.Append(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Seq != uint64(i+1) || e.Hash == "" {
+			t.Fatalf("entry %d was not sealed: %+v", i, e)
+		}
+	}
+
+	entries, err := db.Entries(ctx, audit.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := audit.Verify(entries); err != nil {
+		t.Errorf("stored entries are not chained: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		opts audit.ListOptions
+		seqs []uint64
+	}{
+		{"udid", audit.ListOptions{UDID: "UDID-1"}, []uint64{1, 3}},
+		{"since", audit.ListOptions{Since: start.Add(time.Hour)}, []uint64{2, 3}},
+		{"page", audit.ListOptions{After: 1, Limit: 1}, []uint64{2}},
+		{"actor", audit.ListOptions{Actor: "admin"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := db.Entries(ctx, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var seqs []uint64
+			for _, e := range entries {
+				seqs = append(seqs, e.Seq)
+			}
+			if len(seqs) != len(tt.seqs) {
+				t.Fatalf("have entries %v, want %v", seqs, tt.seqs)
+			}
+			for i := range seqs {
+				if seqs[i] != tt.seqs[i] {
+					t.Errorf("have entries %v, want %v", seqs, tt.seqs)
+				}
+			}
+		})
+	}
+}
+
+func setupDB(t *testing.T) *DB {
+	f, _ := ioutil.TempFile("", "bolt-")
+	f.Close()
+	os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatalf("couldn't open bolt, err %s\n", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(f.Name())
+	})
+	auditDB, err := NewDB(db)
+	if err != nil {
+		t.Fatalf("couldn't create audit DB, err %s\n", err)
+	}
+	return auditDB
+}
@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+)
+
+// maxLimit is the largest page of entries returned by the list endpoint.
+const maxLimit = 1000
+
+var errInvalidQuery = errors.New("audit log query must have a RFC 3339 since, and a positive after and limit")
+
+type listEntriesRequest struct {
+	Opts ListOptions
+}
+
+type listEntriesResponse struct {
+	Entries []Entry `json:"entries"`
+	Err     error   `json:"err,omitempty"`
+}
+
+func (r listEntriesResponse) Failed() error { return r.Err }
+
+// decodeListEntriesRequest reads the udid, actor, since, after and limit query parameters.
+func decodeListEntriesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	opts := ListOptions{UDID: q.Get("udid"), Actor: q.Get("actor"), Limit: maxLimit}
+	var err error
+	if s := q.Get("since"); s != "" {
+		if opts.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			return nil, errInvalidQuery
+		}
+	}
+	if s := q.Get("after"); s != "" {
+		if opts.After, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return nil, errInvalidQuery
+		}
+	}
+	if s := q.Get("limit"); s != "" {
+		if opts.Limit, err = strconv.Atoi(s); err != nil || opts.Limit <= 0 {
+			return nil, errInvalidQuery
+		}
+		if opts.Limit > maxLimit {
+			opts.Limit = maxLimit
+		}
+	}
+	return listEntriesRequest{Opts: opts}, nil
+}
+
+// MakeListEntriesEndpoint creates an endpoint which returns a page of the audit log.
+func MakeListEntriesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listEntriesRequest)
+		entries, err := svc.ListEntries(ctx, req.Opts)
+		return listEntriesResponse{Entries: entries, Err: err}, nil
+	}
+}
+
+type verifyLogResponse struct {
+	Entries int   `json:"entries"`
+	Err     error `json:"err,omitempty"`
+}
+
+func (r verifyLogResponse) Failed() error { return r.Err }
+
+func decodeVerifyLogRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return struct{}{}, nil
+}
+
+// MakeVerifyLogEndpoint creates an endpoint which checks the hash chain of the audit log.
+func MakeVerifyLogEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		n, err := svc.VerifyLog(ctx)
+		return verifyLogResponse{Entries: n, Err: err}, nil
+	}
+}
@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/micromdm/micromdm/pkg/ctxlog"
+	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
+)
+
+// MutatingFunc reports whether a request with method to path changes the server.
+type MutatingFunc func(method, path string) bool
+
+// MutatingMethod treats every request as mutating, except GET and HEAD requests.
+func MutatingMethod(method, path string) bool {
+	return method != http.MethodGet && method != http.MethodHead
+}
+
+type failer interface {
+	Failed() error
+}
+
+// EndpointMiddleware records the calls of mutating requests and of requests
+// which implement Targeter with svc. The actor is the name of the principal
+// of the request, so it must be chained after the authentication middleware.
+// Errors recording an entry are logged and do not fail the request, which has
+// already been processed. It requires the request context to be populated
+// with httptransport.PopulateRequestContext.
+func EndpointMiddleware(svc Service, logger log.Logger, mutating MutatingFunc) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			method, _ := ctx.Value(httptransport.ContextKeyRequestMethod).(string)
+			path, _ := ctx.Value(httptransport.ContextKeyRequestPath).(string)
+			targeter, targeted := request.(Targeter)
+			if !targeted && !mutating(method, path) {
+				return next(ctx, request)
+			}
+
+			response, err := next(ctx, request)
+
+			e := &Entry{
+				RequestID: httputil.RequestIDFromContext(ctx),
+				Method:    method,
+				Path:      path,
+				Outcome:   Success,
+			}
+			if p, ok := scope.FromContext(ctx); ok {
+				e.Actor = p.Name
+			}
+			if targeted {
+				t := targeter.AuditTarget()
+				e.Action, e.UDIDs, e.Serials = t.Action, t.UDIDs, t.Serials
+			}
+			failed := err
+			if f, ok := response.(failer); ok && failed == nil {
+				failed = f.Failed()
+			}
+			if failed != nil {
+				e.Outcome, e.Error = Failure, failed.Error()
+			}
+			if rerr := svc.Record(ctx, e); rerr != nil {
+				level.Info(ctxlog.Logger(ctx, logger)).Log("msg", "recording audit entry", "path", path, "err", rerr)
+			}
+			return response, err
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+
+	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
+	"github.com/micromdm/micromdm/platform/audit"
+	auditbuiltin "github.com/micromdm/micromdm/platform/audit/builtin"
+	"github.com/micromdm/micromdm/platform/command"
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+	queueinmem "github.com/micromdm/micromdm/platform/queue/inmem"
+)
+
+func setupService(t *testing.T) *audit.AuditService {
+	f, _ := ioutil.TempFile("", "bolt-")
+	f.Close()
+	os.Remove(f.Name())
+	db, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatalf("couldn't open bolt, err %s\n", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(f.Name())
+	})
+	store, err := auditbuiltin.NewDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return audit.New(store)
+}
+
+// principalMiddleware authenticates requests as name with scopes.
+func principalMiddleware(name string, scopes ...string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			return next(scope.NewContext(ctx, &scope.Principal{Name: name, Scopes: scopes}), request)
+		}
+	}
+}
+
+func TestEraseDeviceIsAudited(t *testing.T) {
+	auditsvc := setupService(t)
+	pubsub := inmem.NewPubSub()
+	svc, err := command.New(pubsub, queueinmem.New(pubsub, log.NewNopLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditmw := audit.EndpointMiddleware(auditsvc, log.NewNopLogger(), audit.MutatingMethod)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(httputil.ErrorEncoder),
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	}
+
+	admin := mux.NewRouter()
+	command.RegisterHTTPHandlers(admin, command.MakeServerEndpoints(svc, principalMiddleware("security@example.com", scope.Admin), auditmw), options...)
+	helpdesk := mux.NewRouter()
+	command.RegisterHTTPHandlers(helpdesk, command.MakeServerEndpoints(svc, principalMiddleware("helpdesk", scope.CommandsWrite), auditmw), options...)
+
+	requests := []struct {
+		router *mux.Router
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{admin, "POST", "/v1/commands", `{"udid": "UDID-1", "request_type": "EraseDevice", "pin": "123456"}`, http.StatusCreated},
+		{helpdesk, "POST", "/v1/devices/UDID-2/erase", "", http.StatusForbidden},
+		{helpdesk, "GET", "/v1/commands/UDID-1", "", http.StatusOK},
+	}
+	for _, r := range requests {
+		rec := httptest.NewRecorder()
+		r.router.ServeHTTP(rec, httptest.NewRequest(r.method, r.path, strings.NewReader(r.body)))
+		if rec.Code != r.code {
+			t.Fatalf("%s %s: have status %d, want %d: %s", r.method, r.path, rec.Code, r.code, rec.Body)
+		}
+	}
+
+	entries, err := auditsvc.ListEntries(context.Background(), audit.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("have %d audit entries, want 2 for the erase requests: %+v", len(entries), entries)
+	}
+	erase := entries[0]
+	if erase.Actor != "security@example.com" || erase.Action != "EraseDevice" || erase.Method != "POST" ||
+		erase.Path != "/v1/commands" || len(erase.UDIDs) != 1 || erase.UDIDs[0] != "UDID-1" ||
+		erase.Outcome != audit.Success || erase.Time.IsZero() || erase.Hash == "" {
+		t.Errorf("unexpected erase entry %+v", erase)
+	}
+	denied := entries[1]
+	if denied.Actor != "helpdesk" || denied.Action != "EraseDevice" || denied.UDIDs[0] != "UDID-2" ||
+		denied.Outcome != audit.Failure || denied.Error == "" || denied.PrevHash != erase.Hash {
+		t.Errorf("unexpected denied entry %+v", denied)
+	}
+	if n, err := auditsvc.VerifyLog(context.Background()); err != nil || n != 2 {
+		t.Errorf("have verified %d entries with error %v, want 2", n, err)
+	}
+}
+
+func TestListEntriesHTTP(t *testing.T) {
+	auditsvc := setupService(t)
+	for _, actor := range []string{"admin", "helpdesk"} {
+		if err := auditsvc.Record(context.Background(), &audit.Entry{Actor: actor, Outcome: audit.Success}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(httputil.ErrorEncoder),
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	}
+
+	r := mux.NewRouter()
+	audit.RegisterHTTPHandlers(r, audit.MakeServerEndpoints(auditsvc, principalMiddleware("security", scope.AuditRead)), options...)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/audit?actor=helpdesk", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("have status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct{ Entries []audit.Entry }
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Entries) != 1 || resp.Entries[0].Actor != "helpdesk" {
+		t.Errorf("have entries %+v, want the helpdesk entry", resp.Entries)
+	}
+
+	r = mux.NewRouter()
+	audit.RegisterHTTPHandlers(r, audit.MakeServerEndpoints(auditsvc, principalMiddleware("helpdesk", scope.DevicesRead)), options...)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/audit/verify", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("have status %d without the audit:read scope, want %d", rec.Code, http.StatusForbidden)
+	}
+}
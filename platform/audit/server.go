@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+
+	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
+)
+
+type Endpoints struct {
+	ListEntriesEndpoint endpoint.Endpoint
+	VerifyLogEndpoint   endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
+	return Endpoints{
+		ListEntriesEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.AuditRead)(MakeListEntriesEndpoint(s))),
+		VerifyLogEndpoint:   endpoint.Chain(outer, others...)(scope.Require(scope.AuditRead)(MakeVerifyLogEndpoint(s))),
+	}
+}
+
+func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.ServerOption) {
+	// GET		/v1/audit			list the entries of the audit log
+	// GET		/v1/audit/verify	check the hash chain of the audit log
+
+	r.Methods("GET").Path("/v1/audit").Handler(httptransport.NewServer(
+		e.ListEntriesEndpoint,
+		decodeListEntriesRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("GET").Path("/v1/audit/verify").Handler(httptransport.NewServer(
+		e.VerifyLogEndpoint,
+		decodeVerifyLogRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+}
@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+type Service interface {
+	Record(ctx context.Context, e *Entry) error
+	ListEntries(ctx context.Context, opts ListOptions) ([]Entry, error)
+	// VerifyLog checks the hash chain of the whole log and returns the number of entries.
+	VerifyLog(ctx context.Context) (int, error)
+}
+
+type AuditService struct {
+	store Store
+	now   func() time.Time
+}
+
+func New(store Store) *AuditService {
+	return &AuditService{store: store, now: time.Now}
+}
+
+// Record appends e to the log. A zero Time is set to the current time.
+func (svc *AuditService) Record(ctx context.Context, e *Entry) error {
+	if e.Time.IsZero() {
+		e.Time = svc.now()
+	}
+	// the JSON of a UTC time is the same after it is read back, which keeps the hash stable.
+	e.Time = e.Time.UTC()
+	return svc.store.Append(ctx, e)
+}
+
+func (svc *AuditService) ListEntries(ctx context.Context, opts ListOptions) ([]Entry, error) {
+	return svc.store.Entries(ctx, opts)
+}
+
+func (svc *AuditService) VerifyLog(ctx context.Context) (int, error) {
+	entries, err := svc.store.Entries(ctx, ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), Verify(entries)
+}
@@ -5,6 +5,7 @@ import (
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 )
 
 type Endpoints struct {
@@ -15,9 +16,9 @@ type Endpoints struct {
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		GetBlueprintsEndpoint:    endpoint.Chain(outer, others...)(MakeGetBlueprintsEndpoint(s)),
-		ApplyBlueprintEndpoint:   endpoint.Chain(outer, others...)(MakeApplyBlueprintEndpoint(s)),
-		RemoveBlueprintsEndpoint: endpoint.Chain(outer, others...)(MakeRemoveBlueprintsEndpoint(s)),
+		GetBlueprintsEndpoint:    endpoint.Chain(outer, others...)(scope.Require(scope.ProfilesRead)(MakeGetBlueprintsEndpoint(s))),
+		ApplyBlueprintEndpoint:   endpoint.Chain(outer, others...)(scope.Require(scope.ProfilesWrite)(MakeApplyBlueprintEndpoint(s))),
+		RemoveBlueprintsEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.ProfilesWrite)(MakeRemoveBlueprintsEndpoint(s))),
 	}
 }
 
@@ -0,0 +1,203 @@
+package builtin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+const ChallengeBucket = "mdm.SCEPChallenges"
+
+// legacyChallengeBucket is the bucket of the challenge store of earlier versions,
+// which stored the challenges themselves.
+const legacyChallengeBucket = "scep_challenges"
+
+// expirySweepInterval is how often Run removes the expired challenges.
+const expirySweepInterval = 10 * time.Minute
+
+// DB stores single-use SCEP challenge passwords, which expire after a TTL.
+// Only the SHA-256 hash of a challenge is stored, which is also its key.
+type DB struct {
+	*bolt.DB
+	ttl time.Duration
+	now func() time.Time
+}
+
+type storedChallenge struct {
+	Hash      string    `json:"hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewDB creates a challenge store whose challenges are valid for ttl.
+// A ttl of zero or less means challenges are valid until they are used.
+// Unused challenges of the store of earlier versions are migrated, and are
+// valid for ttl from now.
+func NewDB(db *bolt.DB, ttl time.Duration) (*DB, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(ChallengeBucket))
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating %s bucket", ChallengeBucket)
+	}
+	datastore := &DB{
+		DB:  db,
+		ttl: ttl,
+		now: time.Now,
+	}
+	if err := datastore.migrateLegacyChallenges(); err != nil {
+		return nil, errors.Wrapf(err, "migrating %s bucket", legacyChallengeBucket)
+	}
+	return datastore, nil
+}
+
+func (db *DB) migrateLegacyChallenges() error {
+	return db.Update(func(tx *bolt.Tx) error {
+		legacy := tx.Bucket([]byte(legacyChallengeBucket))
+		if legacy == nil {
+			return nil
+		}
+		b := tx.Bucket([]byte(ChallengeBucket))
+		err := legacy.ForEach(func(k, _ []byte) error {
+			v, err := json.Marshal(db.newStoredChallenge(string(k)))
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte(hashChallenge(string(k))), v)
+		})
+		if err != nil {
+			return err
+		}
+		return tx.DeleteBucket([]byte(legacyChallengeBucket))
+	})
+}
+
+func (db *DB) newStoredChallenge(challenge string) storedChallenge {
+	stored := storedChallenge{Hash: hashChallenge(challenge)}
+	if db.ttl > 0 {
+		stored.ExpiresAt = db.now().Add(db.ttl)
+	}
+	return stored
+}
+
+func hashChallenge(challenge string) string {
+	sum := sha256.Sum256([]byte(challenge))
+	return hex.EncodeToString(sum[:])
+}
+
+// SCEPChallenge issues a new challenge.
+func (db *DB) SCEPChallenge() (string, error) {
+	challenge, _, err := db.IssueChallenge()
+	return challenge, err
+}
+
+// IssueChallenge issues a new challenge and returns the time it expires, which
+// is zero if challenges do not expire.
+func (db *DB) IssueChallenge() (string, time.Time, error) {
+	key := make([]byte, 24)
+	if _, err := rand.Read(key); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "generate SCEP challenge")
+	}
+	challenge := base64.StdEncoding.EncodeToString(key)
+
+	stored := db.newStoredChallenge(challenge)
+	v, err := json.Marshal(stored)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "marshal SCEP challenge")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(ChallengeBucket)).Put([]byte(stored.Hash), v)
+	})
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "save SCEP challenge")
+	}
+	return challenge, stored.ExpiresAt, nil
+}
+
+// Run removes the expired challenges every few minutes until ctx is done.
+// Challenges which were issued without a TTL never expire, so Run returns
+// right away if the store has none.
+func (db *DB) Run(ctx context.Context) error {
+	if db.ttl <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(expirySweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := db.DeleteExpired(); err != nil {
+				log.Printf("delete expired SCEP challenges: %s", err)
+			}
+		}
+	}
+}
+
+// DeleteExpired removes the challenges which have expired.
+func (db *DB) DeleteExpired() error {
+	now := db.now()
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ChallengeBucket))
+		var expired [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var c storedChallenge
+			if err := json.Unmarshal(v, &c); err != nil || c.expired(now) {
+				expired = append(expired, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "delete expired SCEP challenges")
+}
+
+func (c storedChallenge) expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt)
+}
+
+// HasChallenge reports whether pw is an issued challenge which has not expired,
+// and removes it so that it cannot be used again.
+//
+// The challenge is looked up by its SHA-256 hash, so the time the lookup takes
+// depends on the hash, not on how much of pw matches an issued challenge. The
+// stored hash is compared in constant time as well.
+func (db *DB) HasChallenge(pw string) (bool, error) {
+	hash := hashChallenge(pw)
+	var valid bool
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ChallengeBucket))
+		v := b.Get([]byte(hash))
+		if v == nil {
+			return nil
+		}
+		var c storedChallenge
+		if err := json.Unmarshal(v, &c); err != nil {
+			return errors.Wrap(err, "unmarshal SCEP challenge")
+		}
+		valid = subtle.ConstantTimeCompare([]byte(c.Hash), []byte(hash)) == 1 && !c.expired(db.now())
+		return b.Delete([]byte(hash))
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "check SCEP challenge")
+	}
+	return valid, nil
+}
@@ -0,0 +1,138 @@
+package builtin
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestHasChallenge(t *testing.T) {
+	db := setupDB(t, time.Hour)
+	now := time.Now()
+	db.now = func() time.Time { return now }
+
+	challenge, expiresAt, err := db.IssueChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("have expiry %s, want %s", expiresAt, now.Add(time.Hour))
+	}
+	if ok, err := db.HasChallenge("unknown"); err != nil || ok {
+		t.Errorf("have %v, %v for an unknown challenge, want false", ok, err)
+	}
+	if ok, err := db.HasChallenge(challenge); err != nil || !ok {
+		t.Fatalf("have %v, %v for an issued challenge, want true", ok, err)
+	}
+	if ok, err := db.HasChallenge(challenge); err != nil || ok {
+		t.Errorf("have %v, %v for a used challenge, want false", ok, err)
+	}
+}
+
+func TestChallengeExpires(t *testing.T) {
+	db := setupDB(t, time.Hour)
+	now := time.Now()
+	db.now = func() time.Time { return now }
+
+	expired, err := db.SCEPChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+	if ok, err := db.HasChallenge(expired); err != nil || ok {
+		t.Errorf("have %v, %v for an expired challenge, want false", ok, err)
+	}
+
+	if _, err := db.SCEPChallenge(); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+	if _, err := db.SCEPChallenge(); err != nil {
+		t.Fatal(err)
+	}
+	// the sweep removes the challenges which expired unused.
+	if err := db.DeleteExpired(); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket([]byte(ChallengeBucket)).Stats().KeyN
+		return nil
+	})
+	if n != 1 {
+		t.Errorf("have %d stored challenges, want 1", n)
+	}
+}
+
+func TestChallengeWithoutTTL(t *testing.T) {
+	db := setupDB(t, 0)
+	challenge, expiresAt, err := db.IssueChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiresAt.IsZero() {
+		t.Errorf("have expiry %s without a TTL", expiresAt)
+	}
+	db.now = func() time.Time { return time.Now().Add(24 * 365 * time.Hour) }
+	if ok, err := db.HasChallenge(challenge); err != nil || !ok {
+		t.Errorf("have %v, %v for a challenge without a TTL, want true", ok, err)
+	}
+}
+
+func TestMigrateLegacyChallenges(t *testing.T) {
+	boltDB := openBolt(t)
+	err := boltDB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(legacyChallengeBucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("legacy"), []byte("legacy"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := NewDB(boltDB, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boltDB.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(legacyChallengeBucket)) != nil {
+			t.Error("legacy challenge bucket was not removed")
+		}
+		return nil
+	})
+	if ok, err := db.HasChallenge("legacy"); err != nil || !ok {
+		t.Fatalf("have %v, %v for a migrated challenge, want true", ok, err)
+	}
+	if ok, err := db.HasChallenge("legacy"); err != nil || ok {
+		t.Errorf("have %v, %v for a used migrated challenge, want false", ok, err)
+	}
+}
+
+func setupDB(t *testing.T, ttl time.Duration) *DB {
+	challengeDB, err := NewDB(openBolt(t), ttl)
+	if err != nil {
+		t.Fatalf("couldn't create challenge DB, err %s\n", err)
+	}
+	return challengeDB
+}
+
+func openBolt(t *testing.T) *bolt.DB {
+	f, _ := ioutil.TempFile("", "bolt-")
+	f.Close()
+	os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatalf("couldn't open bolt, err %s\n", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(f.Name())
+	})
+	return db
+}
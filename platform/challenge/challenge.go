@@ -2,13 +2,15 @@ package challenge
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 )
 
 type challengeResponse struct {
-	Challenge string `json:"string"`
-	Err       error  `json:"err,omitempty"`
+	Challenge string     `json:"string"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Err       error      `json:"err,omitempty"`
 }
 
 func (r challengeResponse) Failed() error { return r.Err }
@@ -16,7 +18,11 @@ func (r challengeResponse) Failed() error { return r.Err }
 func MakeChallengeEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		r := challengeResponse{}
-		r.Challenge, r.Err = svc.SCEPChallenge(ctx)
+		var expiresAt time.Time
+		r.Challenge, expiresAt, r.Err = svc.SCEPChallenge(ctx)
+		if !expiresAt.IsZero() {
+			r.ExpiresAt = &expiresAt
+		}
 		return r, nil
 	}
 }
@@ -0,0 +1,81 @@
+package challenge_test
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	scepchallenge "github.com/micromdm/scep/v2/challenge"
+	"github.com/micromdm/scep/v2/scep"
+	scepserver "github.com/micromdm/scep/v2/server"
+
+	"github.com/micromdm/micromdm/pkg/scope"
+	"github.com/micromdm/micromdm/platform/challenge"
+	"github.com/micromdm/micromdm/platform/challenge/builtin"
+)
+
+func adminMiddleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return next(scope.NewContext(ctx, &scope.Principal{Name: "test", Scopes: []string{scope.Admin}}), request)
+	}
+}
+
+func TestIssueThenEnroll(t *testing.T) {
+	f, _ := ioutil.TempFile("", "bolt-")
+	f.Close()
+	defer os.Remove(f.Name())
+	db, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store, err := builtin.NewDB(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	challenge.RegisterHTTPHandlers(r, challenge.MakeServerEndpoints(challenge.NewService(store), adminMiddleware))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/challenge", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("have status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Challenge string     `json:"string"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Challenge == "" || resp.ExpiresAt == nil || time.Until(*resp.ExpiresAt) > time.Hour {
+		t.Fatalf("unexpected challenge response %+v", resp)
+	}
+
+	var signed int
+	signer := scepchallenge.Middleware(store, scepserver.CSRSignerFunc(func(*scep.CSRReqMessage) (*x509.Certificate, error) {
+		signed++
+		return &x509.Certificate{}, nil
+	}))
+	if _, err := signer.SignCSR(&scep.CSRReqMessage{ChallengePassword: resp.Challenge}); err != nil {
+		t.Fatalf("enroll with an issued challenge: %s", err)
+	}
+	if _, err := signer.SignCSR(&scep.CSRReqMessage{ChallengePassword: resp.Challenge}); err == nil {
+		t.Error("expected error when the challenge is reused")
+	}
+	if _, err := signer.SignCSR(&scep.CSRReqMessage{ChallengePassword: "guess"}); err == nil {
+		t.Error("expected error for a challenge which was not issued")
+	}
+	if signed != 1 {
+		t.Errorf("signed %d certificates, want 1", signed)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 )
 
 type Endpoints struct {
@@ -16,7 +17,7 @@ type Endpoints struct {
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		ChallengeEndpoint: endpoint.Chain(outer, others...)(MakeChallengeEndpoint(s)),
+		ChallengeEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.DevicesWrite)(MakeChallengeEndpoint(s))),
 	}
 }
 
@@ -3,23 +3,35 @@ package challenge
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/micromdm/scep/v2/challenge"
 )
 
 type Service interface {
-	SCEPChallenge(ctx context.Context) (string, error)
+	// SCEPChallenge issues a challenge and returns the time it expires,
+	// which is zero if it does not expire.
+	SCEPChallenge(ctx context.Context) (string, time.Time, error)
+}
+
+// expiringStore is implemented by stores whose challenges expire.
+type expiringStore interface {
+	IssueChallenge() (string, time.Time, error)
 }
 
 type ChallengeService struct {
 	challenge.Store
 }
 
-func (c *ChallengeService) SCEPChallenge(_ context.Context) (string, error) {
+func (c *ChallengeService) SCEPChallenge(_ context.Context) (string, time.Time, error) {
 	if c.Store == nil {
-		return "", errors.New("SCEP challenge store missing")
+		return "", time.Time{}, errors.New("SCEP challenge store missing")
+	}
+	if store, ok := c.Store.(expiringStore); ok {
+		return store.IssueChallenge()
 	}
-	return c.Store.SCEPChallenge()
+	challenge, err := c.Store.SCEPChallenge()
+	return challenge, time.Time{}, err
 }
 
 func NewService(challengeStore challenge.Store) *ChallengeService {
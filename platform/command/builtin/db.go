@@ -0,0 +1,128 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/platform/command"
+)
+
+const (
+	PINBucket         = "mdm.DevicePINs"
+	IdempotencyBucket = "mdm.IdempotencyKeys"
+)
+
+// DB stores the PINs of DeviceLock and EraseDevice commands, keyed by device UDID,
+// and the results of command submissions, keyed by idempotency key.
+type DB struct {
+	*bolt.DB
+}
+
+func NewDB(db *bolt.DB) (*DB, error) {
+	for _, bucket := range []string{PINBucket, IdempotencyBucket} {
+		err := db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating %s bucket", bucket)
+		}
+	}
+	datastore := &DB{
+		DB: db,
+	}
+	return datastore, nil
+}
+
+// SavePIN stores pin, replacing the previous PIN of the device.
+func (db *DB) SavePIN(_ context.Context, pin *command.DevicePIN) error {
+	v, err := json.Marshal(pin)
+	if err != nil {
+		return errors.Wrap(err, "marshal device PIN")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(PINBucket)).Put([]byte(pin.UDID), v)
+	})
+	return errors.Wrapf(err, "save PIN of device %s", pin.UDID)
+}
+
+// DevicePIN returns the PIN of the device with udid, or command.ErrPINNotFound.
+func (db *DB) DevicePIN(_ context.Context, udid string) (*command.DevicePIN, error) {
+	var pin command.DevicePIN
+	err := db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(PINBucket)).Get([]byte(udid))
+		if v == nil {
+			return command.ErrPINNotFound
+		}
+		return json.Unmarshal(v, &pin)
+	})
+	if err == command.ErrPINNotFound {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get PIN of device %s", udid)
+	}
+	return &pin, nil
+}
+
+// SaveIdempotentResult stores the result of the submission with key.
+func (db *DB) SaveIdempotentResult(_ context.Context, key string, result *command.IdempotentResult) error {
+	v, err := json.Marshal(result)
+	if err != nil {
+		return errors.Wrap(err, "marshal idempotent result")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(IdempotencyBucket)).Put([]byte(key), v)
+	})
+	return errors.Wrapf(err, "save result of idempotency key %s", key)
+}
+
+// DeleteExpiredIdempotentResults removes the results which expired before now.
+func (db *DB) DeleteExpiredIdempotentResults(_ context.Context, now time.Time) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(IdempotencyBucket))
+		var expired [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var stored command.IdempotentResult
+			if err := json.Unmarshal(v, &stored); err != nil || !now.Before(stored.Expires) {
+				expired = append(expired, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "delete expired idempotency keys")
+}
+
+// IdempotentResult returns the result of the submission with key, or nil if
+// there is none or it has expired.
+func (db *DB) IdempotentResult(_ context.Context, key string) (*command.IdempotentResult, error) {
+	var result *command.IdempotentResult
+	err := db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(IdempotencyBucket)).Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		result = new(command.IdempotentResult)
+		return json.Unmarshal(v, result)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "get result of idempotency key %s", key)
+	}
+	if result != nil && !time.Now().Before(result.Expires) {
+		return nil, nil
+	}
+	return result, nil
+}
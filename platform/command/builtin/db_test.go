@@ -0,0 +1,107 @@
+package builtin
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/platform/command"
+)
+
+func TestDevicePIN(t *testing.T) {
+	db := setupDB(t)
+	ctx := context.Background()
+
+	if _, err := db.DevicePIN(ctx, "UDID"); err != command.ErrPINNotFound {
+		t.Fatalf("have err %v, want %v", err, command.ErrPINNotFound)
+	}
+
+	for _, pin := range []string{"111111", "222222"} {
+		if err := db.SavePIN(ctx, &command.DevicePIN{UDID: "UDID", PIN: pin, RequestType: "DeviceLock"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pin, err := db.DevicePIN(ctx, "UDID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := pin.PIN, "222222"; have != want {
+		t.Errorf("have PIN %s, want the last saved PIN %s", have, want)
+	}
+}
+
+func TestIdempotentResult(t *testing.T) {
+	db := setupDB(t)
+	ctx := context.Background()
+
+	if result, err := db.IdempotentResult(ctx, "key"); err != nil || result != nil {
+		t.Fatalf("have result %+v, err %v for an unknown key", result, err)
+	}
+
+	expired := &command.IdempotentResult{RequestHash: "old", Expires: time.Now().Add(-time.Second)}
+	if err := db.SaveIdempotentResult(ctx, "expired", expired); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := db.IdempotentResult(ctx, "expired"); err != nil || result != nil {
+		t.Fatalf("have result %+v, err %v for an expired key", result, err)
+	}
+
+	saved := &command.IdempotentResult{
+		RequestHash: "hash",
+		Payload:     &mdm.CommandPayload{CommandUUID: "uuid", Command: &mdm.Command{RequestType: "DeviceInformation"}},
+		Results:     []command.QueueResult{{UDID: "UDID", CommandUUID: "uuid"}},
+		Expires:     time.Now().Add(time.Hour),
+	}
+	if err := db.SaveIdempotentResult(ctx, "key", saved); err != nil {
+		t.Fatal(err)
+	}
+	result, err := db.IdempotentResult(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequestHash != "hash" || result.Payload.CommandUUID != "uuid" || result.Payload.Command.RequestType != "DeviceInformation" || len(result.Results) != 1 {
+		t.Errorf("have result %+v, want %+v", result, saved)
+	}
+
+	if err := db.DeleteExpiredIdempotentResults(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(IdempotencyBucket))
+		if v := b.Get([]byte("expired")); v != nil {
+			t.Error("expired result was not removed")
+		}
+		if v := b.Get([]byte("key")); v == nil {
+			t.Error("unexpired result was removed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setupDB(t *testing.T) *DB {
+	f, _ := ioutil.TempFile("", "bolt-")
+	f.Close()
+	os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatalf("couldn't open bolt, err %s\n", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(f.Name())
+	})
+	pinDB, err := NewDB(db)
+	if err != nil {
+		t.Fatalf("couldn't create command DB, err %s\n", err)
+	}
+	return pinDB
+}
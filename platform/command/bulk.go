@@ -0,0 +1,224 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/platform/audit"
+)
+
+// MaxBulkDevices is the maximum number of devices a single
+// QueueCommandToDevices request may target, to avoid flooding the push pipeline.
+const MaxBulkDevices = 1000
+
+// QueueResult is the result of queuing a command for a single device.
+// The CommandUUID of a dry run is empty.
+type QueueResult struct {
+	UDID        string `json:"udid"`
+	CommandUUID string `json:"command_uuid,omitempty"`
+	Err         string `json:"error,omitempty"`
+}
+
+// QueueCommandToDevices queues the same command for each of the devices in udids.
+// The command payload is created once, so every device receives the same
+// CommandUUID. Duplicate and empty UDIDs are ignored.
+// An error for an individual device, such as an unknown UDID, is reported in its
+// QueueResult and does not stop the command from being queued for the others.
+// With WithDryRun, the devices are checked and returned without queuing the command.
+func (svc *CommandService) QueueCommandToDevices(ctx context.Context, request *mdm.CommandRequest, udids []string, opts ...CommandOption) ([]QueueResult, error) {
+	if err := svc.work.Start(); err != nil {
+		return nil, err
+	}
+	defer svc.work.Done()
+	o := newCommandOptions(opts)
+	if o.idempotencyKey == "" || o.dryRun {
+		return svc.queueCommandToDevices(ctx, request, udids, o)
+	}
+	if request == nil {
+		return nil, errors.New("empty CommandRequest")
+	}
+	hash, err := requestHash("bulk", request, udids, o)
+	if err != nil {
+		return nil, err
+	}
+	result, err := svc.idempotency.do(ctx, o.idempotencyKey, hash, func() (IdempotentResult, error) {
+		results, err := svc.queueCommandToDevices(ctx, request, udids, o)
+		return IdempotentResult{Results: results}, err
+	})
+	return result.Results, err
+}
+
+func (svc *CommandService) queueCommandToDevices(ctx context.Context, request *mdm.CommandRequest, udids []string, o commandOptions) ([]QueueResult, error) {
+	if request == nil {
+		return nil, errors.New("empty CommandRequest")
+	}
+	udids = dedupeUDIDs(udids)
+	if len(udids) == 0 {
+		return nil, errEmptyRequest
+	}
+	if len(udids) > MaxBulkDevices {
+		return nil, fmt.Errorf("request targets %d devices, maximum is %d", len(udids), MaxBulkDevices)
+	}
+	payload, err := mdm.NewCommandPayload(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating mdm payload")
+	}
+
+	results := make([]QueueResult, len(udids))
+	for i, udid := range udids {
+		results[i] = QueueResult{UDID: udid}
+		if err := svc.checkDevice(ctx, udid); err != nil {
+			results[i].Err = err.Error()
+			continue
+		}
+		if o.dryRun {
+			continue
+		}
+		if err := svc.queueCommand(ctx, payload, udid, o); err != nil {
+			results[i].Err = err.Error()
+			continue
+		}
+		results[i].CommandUUID = payload.CommandUUID
+	}
+	return results, nil
+}
+
+// checkDevice returns an error if a device store is set and has no device with udid.
+func (svc *CommandService) checkDevice(ctx context.Context, udid string) error {
+	if svc.devices == nil {
+		return nil
+	}
+	if _, err := svc.devices.DeviceByUDID(ctx, udid); isNotFound(err) {
+		return errors.Errorf("unknown device udid %s", udid)
+	} else if err != nil {
+		return errors.Wrapf(err, "find device udid %s", udid)
+	}
+	return nil
+}
+
+func (svc *CommandService) queueCommand(ctx context.Context, payload *mdm.CommandPayload, udid string, o commandOptions) error {
+	msg, err := MarshalEvent(o.newEvent(payload, udid))
+	if err != nil {
+		return errors.Wrap(err, "marshalling mdm command event")
+	}
+	err = svc.publisher.Publish(ctx, CommandTopic, msg)
+	return errors.Wrapf(err, "publish mdm command on topic: %s", CommandTopic)
+}
+
+// dedupeUDIDs returns the non-empty udids with duplicates removed, in order.
+func dedupeUDIDs(udids []string) []string {
+	seen := make(map[string]bool, len(udids))
+	var deduped []string
+	for _, udid := range udids {
+		udid = strings.TrimSpace(udid)
+		if udid == "" || seen[udid] {
+			continue
+		}
+		seen[udid] = true
+		deduped = append(deduped, udid)
+	}
+	return deduped
+}
+
+func isNotFound(err error) bool {
+	type notFoundErr interface {
+		error
+		NotFound() bool
+	}
+	e, ok := errors.Cause(err).(notFoundErr)
+	return ok && e.NotFound()
+}
+
+type bulkCommandRequest struct {
+	UDIDs          []string `json:"udids"`
+	TTL            int64    `json:"ttl,omitempty"`
+	IdempotencyKey string   `json:"idempotency_key,omitempty"`
+	// DryRun returns the devices which would receive the command without queuing it.
+	DryRun bool `json:"dry_run,omitempty"`
+	mdm.CommandRequest
+}
+
+// UnmarshalJSON decodes the UDIDs, TTL, IdempotencyKey and DryRun alongside the embedded
+// CommandRequest, whose UnmarshalJSON method would otherwise ignore them.
+func (r *bulkCommandRequest) UnmarshalJSON(data []byte) error {
+	var fields struct {
+		UDIDs          []string `json:"udids"`
+		TTL            int64    `json:"ttl"`
+		IdempotencyKey string   `json:"idempotency_key"`
+		DryRun         bool     `json:"dry_run"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return errors.Wrap(err, "unmarshal json bulk command request")
+	}
+	r.UDIDs = fields.UDIDs
+	r.TTL = fields.TTL
+	r.IdempotencyKey = fields.IdempotencyKey
+	r.DryRun = fields.DryRun
+	return r.CommandRequest.UnmarshalJSON(data)
+}
+
+type bulkCommandResponse struct {
+	DryRun  bool          `json:"dry_run,omitempty"`
+	Results []QueueResult `json:"results,omitempty"`
+	Err     error         `json:"error,omitempty"`
+}
+
+func (r bulkCommandResponse) Failed() error { return r.Err }
+
+// StatusCode is 200 OK for a dry run, which does not queue the command.
+func (r bulkCommandResponse) StatusCode() int {
+	if r.DryRun {
+		return http.StatusOK
+	}
+	return http.StatusCreated
+}
+
+func (r bulkCommandRequest) AuditTarget() audit.Target {
+	action := r.RequestType
+	if r.DryRun {
+		action += " (dry run)"
+	}
+	return audit.Target{Action: action, UDIDs: r.UDIDs}
+}
+
+func decodeBulkCommandRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req bulkCommandRequest
+	err := httputil.DecodeJSONRequest(r, &req)
+	req.IdempotencyKey = idempotencyKey(r, req.IdempotencyKey)
+	return req, err
+}
+
+// MakeBulkCommandEndpoint creates an endpoint which queues an MDM Command for many devices.
+func MakeBulkCommandEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(bulkCommandRequest)
+		if len(req.UDIDs) == 0 || req.Command == nil || req.RequestType == "" {
+			return bulkCommandResponse{Err: errEmptyBulkRequest}, nil
+		}
+		if req.TTL < 0 {
+			return bulkCommandResponse{Err: errNegativeTTL}, nil
+		}
+		if err := checkRequestType(ctx, req.RequestType); err != nil {
+			return bulkCommandResponse{Err: err}, nil
+		}
+		opts := requestOptions(req.TTL, req.IdempotencyKey)
+		if req.DryRun {
+			opts = append(opts, WithDryRun())
+		}
+		results, err := svc.QueueCommandToDevices(ctx, &req.CommandRequest, req.UDIDs, opts...)
+		if err != nil {
+			return bulkCommandResponse{Err: err}, nil
+		}
+		return bulkCommandResponse{DryRun: req.DryRun, Results: results}, nil
+	}
+}
+
+var errEmptyBulkRequest = errors.New("request must contain the UDIDs of the devices and a request type")
@@ -0,0 +1,219 @@
+package command_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/pkg/scope"
+	"github.com/micromdm/micromdm/platform/command"
+	"github.com/micromdm/micromdm/platform/device"
+)
+
+type mockPublisher struct {
+	mu     sync.Mutex
+	events []*command.Event
+}
+
+func (p *mockPublisher) Publish(ctx context.Context, topic string, msg []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if topic != command.CommandTopic {
+		return fmt.Errorf("unexpected topic %s", topic)
+	}
+	var ev command.Event
+	if err := command.UnmarshalEvent(msg, &ev); err != nil {
+		return err
+	}
+	p.events = append(p.events, &ev)
+	return nil
+}
+
+type notFoundErr struct{}
+
+func (notFoundErr) Error() string  { return "not found" }
+func (notFoundErr) NotFound() bool { return true }
+
+type mockDeviceStore map[string]bool
+
+func (s mockDeviceStore) DeviceByUDID(ctx context.Context, udid string) (*device.Device, error) {
+	if !s[udid] {
+		return nil, notFoundErr{}
+	}
+	return &device.Device{UDID: udid}, nil
+}
+
+func TestQueueCommandToDevices(t *testing.T) {
+	pub := &mockPublisher{}
+	devices := mockDeviceStore{"UDID-1": true, "UDID-2": true}
+	svc, err := command.New(pub, nil, command.WithDeviceStore(devices))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := &mdm.CommandRequest{Command: &mdm.Command{RequestType: "DeviceInformation"}}
+	udids := []string{"UDID-1", "UNKNOWN", "UDID-2", "UDID-1", ""}
+	results, err := svc.QueueCommandToDevices(context.Background(), request, udids)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have, want := len(results), 3; have != want {
+		t.Fatalf("have %d results, want %d: %+v", have, want, results)
+	}
+	commandUUID := results[0].CommandUUID
+	if commandUUID == "" {
+		t.Fatal("expected a CommandUUID for a known device")
+	}
+	for i, want := range []command.QueueResult{
+		{UDID: "UDID-1", CommandUUID: commandUUID},
+		{UDID: "UNKNOWN", Err: "unknown device udid UNKNOWN"},
+		{UDID: "UDID-2", CommandUUID: commandUUID},
+	} {
+		if have := results[i]; have != want {
+			t.Errorf("result %d: have %+v, want %+v", i, have, want)
+		}
+	}
+
+	if have, want := len(pub.events), 2; have != want {
+		t.Fatalf("have %d queued commands, want %d", have, want)
+	}
+	for i, udid := range []string{"UDID-1", "UDID-2"} {
+		ev := pub.events[i]
+		if ev.DeviceUDID != udid {
+			t.Errorf("event %d: have udid %s, want %s", i, ev.DeviceUDID, udid)
+		}
+		if ev.Payload.CommandUUID != commandUUID {
+			t.Errorf("event %d: have CommandUUID %s, want %s", i, ev.Payload.CommandUUID, commandUUID)
+		}
+		if ev.Payload.Command.RequestType != "DeviceInformation" {
+			t.Errorf("event %d: have RequestType %s", i, ev.Payload.Command.RequestType)
+		}
+	}
+}
+
+func TestQueueCommandToDevicesLimits(t *testing.T) {
+	pub := &mockPublisher{}
+	svc, err := command.New(pub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &mdm.CommandRequest{Command: &mdm.Command{RequestType: "DeviceInformation"}}
+
+	if _, err := svc.QueueCommandToDevices(context.Background(), request, []string{"", " "}); err == nil {
+		t.Error("expected error without UDIDs")
+	}
+
+	udids := make([]string, command.MaxBulkDevices+1)
+	for i := range udids {
+		udids[i] = fmt.Sprintf("UDID-%d", i)
+	}
+	if _, err := svc.QueueCommandToDevices(context.Background(), request, udids); err == nil {
+		t.Error("expected error above the batch size limit")
+	}
+	if len(pub.events) != 0 {
+		t.Errorf("have %d queued commands for rejected requests, want none", len(pub.events))
+	}
+}
+
+func TestBulkCommandHTTP(t *testing.T) {
+	pub := &mockPublisher{}
+	svc, err := command.New(pub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	command.RegisterHTTPHandlers(r, command.MakeServerEndpoints(svc, adminMiddleware))
+
+	body := `{"udids":["UDID-1","UDID-2"],"request_type":"DeviceInformation"}`
+	req := httptest.NewRequest("POST", "/v1/commands/bulk", strings.NewReader(body))
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if have, want := resp.Code, http.StatusCreated; have != want {
+		t.Fatalf("have status %d, want %d: %s", have, want, resp.Body)
+	}
+	var decoded struct {
+		Results []command.QueueResult `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(decoded.Results), 2; have != want {
+		t.Fatalf("have %d results, want %d", have, want)
+	}
+	if have, want := len(pub.events), 2; have != want {
+		t.Errorf("have %d queued commands, want %d", have, want)
+	}
+}
+
+func TestBulkCommandDryRun(t *testing.T) {
+	pub := &mockPublisher{}
+	devices := mockDeviceStore{"UDID-1": true, "UDID-2": true}
+	svc, err := command.New(pub, nil, command.WithDeviceStore(devices))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	command.RegisterHTTPHandlers(r, command.MakeServerEndpoints(svc, adminMiddleware))
+
+	body := `{"udids":["UDID-1","UNKNOWN","UDID-2"],"request_type":"EraseDevice","dry_run":true,"idempotency_key":"erase-1"}`
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest("POST", "/v1/commands/bulk", strings.NewReader(body)))
+	if have, want := resp.Code, http.StatusOK; have != want {
+		t.Fatalf("have status %d, want %d: %s", have, want, resp.Body)
+	}
+	var decoded struct {
+		DryRun  bool                  `json:"dry_run"`
+		Results []command.QueueResult `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.DryRun {
+		t.Error("expected dry_run in the response")
+	}
+	want := []command.QueueResult{
+		{UDID: "UDID-1"},
+		{UDID: "UNKNOWN", Err: "unknown device udid UNKNOWN"},
+		{UDID: "UDID-2"},
+	}
+	if len(decoded.Results) != len(want) {
+		t.Fatalf("have results %+v, want %+v", decoded.Results, want)
+	}
+	for i := range want {
+		if decoded.Results[i] != want[i] {
+			t.Errorf("result %d: have %+v, want %+v", i, decoded.Results[i], want[i])
+		}
+	}
+	if len(pub.events) != 0 {
+		t.Errorf("have %d queued commands for a dry run, want none", len(pub.events))
+	}
+
+	// the dry run does not use up the idempotency key of the real request.
+	body = `{"udids":["UDID-1","UDID-2"],"request_type":"EraseDevice","idempotency_key":"erase-1"}`
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest("POST", "/v1/commands/bulk", strings.NewReader(body)))
+	if have, want := resp.Code, http.StatusCreated; have != want {
+		t.Fatalf("have status %d, want %d: %s", have, want, resp.Body)
+	}
+	if have, want := len(pub.events), 2; have != want {
+		t.Errorf("have %d queued commands, want %d", have, want)
+	}
+}
+
+// adminMiddleware authenticates requests as a principal with every scope.
+func adminMiddleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return next(scope.NewContext(ctx, &scope.Principal{Name: "test", Scopes: []string{scope.Admin}}), request)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/go-kit/kit/endpoint"
 	"github.com/gorilla/mux"
 	"github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/platform/audit"
 	"github.com/pkg/errors"
 )
 
@@ -28,6 +29,10 @@ type clearResponse struct {
 func (r clearResponse) Failed() error   { return r.Err }
 func (r clearResponse) StatusCode() int { return http.StatusOK }
 
+func (r clearRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: "ClearQueue", UDIDs: []string{r.UDID}}
+}
+
 func decodeClearRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	return clearRequest{UDID: mux.Vars(r)["udid"]}, nil
 }
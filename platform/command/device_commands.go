@@ -0,0 +1,132 @@
+package command
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	"github.com/groob/plist"
+	"github.com/pkg/errors"
+
+	mdmsvc "github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/platform/audit"
+)
+
+// QueuedCommand is a command which is waiting in the queue of a device.
+type QueuedCommand struct {
+	UUID string `json:"uuid"`
+	// RequestType is empty for raw commands whose payload is not a valid command.
+	RequestType string `json:"request_type"`
+	// QueuedAt is zero for commands queued before the time was recorded.
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// DeviceCommands returns the commands queued for the device with udid, in the
+// order they are sent.
+func (svc *CommandService) DeviceCommands(ctx context.Context, udid string) ([]QueuedCommand, error) {
+	commands, err := svc.ViewQueue(ctx, udid)
+	if err != nil {
+		return nil, err
+	}
+	queued := make([]QueuedCommand, 0, len(commands))
+	for _, cmd := range commands {
+		queued = append(queued, QueuedCommand{
+			UUID:        cmd.UUID,
+			RequestType: requestType(cmd.Payload),
+			QueuedAt:    cmd.QueuedAt,
+		})
+	}
+	return queued, nil
+}
+
+// DeleteCommand removes the command with uuid from the queue of the device with udid.
+// It returns mdm.ErrCommandNotFound if the command is not queued for the device.
+func (svc *CommandService) DeleteCommand(ctx context.Context, udid, uuid string) error {
+	err := svc.queue.DeleteCommand(
+		ctx,
+		mdmsvc.CheckinEvent{Command: mdmsvc.CheckinCommand{UDID: udid}},
+		uuid,
+	)
+	if err == mdmsvc.ErrCommandNotFound {
+		return err
+	}
+	return errors.Wrap(err, "deleting queued command")
+}
+
+func requestType(payload []byte) string {
+	var cmd struct {
+		Command struct {
+			RequestType string
+		}
+	}
+	if err := plist.Unmarshal(payload, &cmd); err != nil {
+		return ""
+	}
+	return cmd.Command.RequestType
+}
+
+type deviceCommandsRequest struct {
+	UDID string
+}
+
+type deviceCommandsResponse struct {
+	Err      error           `json:"error,omitempty"`
+	Commands []QueuedCommand `json:"commands"`
+}
+
+func (r deviceCommandsResponse) Failed() error { return r.Err }
+
+func decodeDeviceCommandsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return deviceCommandsRequest{UDID: mux.Vars(r)["udid"]}, nil
+}
+
+// MakeDeviceCommandsEndpoint creates an endpoint which lists the commands queued for a device.
+func MakeDeviceCommandsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deviceCommandsRequest)
+		if req.UDID == "" {
+			return deviceCommandsResponse{Err: errEmptyRequest}, nil
+		}
+		commands, err := svc.DeviceCommands(ctx, req.UDID)
+		if err != nil {
+			return deviceCommandsResponse{Err: err}, nil
+		}
+		return deviceCommandsResponse{Commands: commands}, nil
+	}
+}
+
+type deleteCommandRequest struct {
+	UDID string
+	UUID string
+}
+
+func (r deleteCommandRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: "DeleteCommand", UDIDs: []string{r.UDID}}
+}
+
+type deleteCommandResponse struct {
+	Err error `json:"error,omitempty"`
+}
+
+func (r deleteCommandResponse) Failed() error { return r.Err }
+
+func decodeDeleteCommandRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	return deleteCommandRequest{UDID: vars["udid"], UUID: vars["uuid"]}, nil
+}
+
+// MakeDeleteCommandEndpoint creates an endpoint which removes a command from the queue of a device.
+func MakeDeleteCommandEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deleteCommandRequest)
+		if req.UDID == "" || req.UUID == "" {
+			return deleteCommandResponse{Err: errors.New("request must contain the UDID of the device and the UUID of the command")}, nil
+		}
+		if err := svc.DeleteCommand(ctx, req.UDID, req.UUID); err != nil {
+			return deleteCommandResponse{Err: err}, nil
+		}
+		return deleteCommandResponse{}, nil
+	}
+}
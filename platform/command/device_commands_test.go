@@ -0,0 +1,115 @@
+package command_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/platform/command"
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+	queueinmem "github.com/micromdm/micromdm/platform/queue/inmem"
+)
+
+func TestDeviceCommands(t *testing.T) {
+	pubsub := inmem.NewPubSub()
+	queue := queueinmem.New(pubsub, log.NewNopLogger())
+	svc, err := command.New(pubsub, queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	command.RegisterHTTPHandlers(r, command.MakeServerEndpoints(svc, adminMiddleware))
+
+	ctx := context.Background()
+	var uuids []string
+	requestTypes := make(map[string]string)
+	for _, requestType := range []string{"DeviceInformation", "ProfileList", "SecurityInfo"} {
+		payload, err := svc.NewCommand(ctx, &mdm.CommandRequest{
+			UDID:    "UDID-1",
+			Command: &mdm.Command{RequestType: requestType},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		uuids = append(uuids, payload.CommandUUID)
+		requestTypes[payload.CommandUUID] = requestType
+	}
+	if _, err := svc.NewCommand(ctx, &mdm.CommandRequest{
+		UDID:    "UDID-2",
+		Command: &mdm.Command{RequestType: "DeviceInformation"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(udid string) []command.QueuedCommand {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/devices/"+udid+"/commands", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("have status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+		var resp struct {
+			Commands []command.QueuedCommand
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Commands
+	}
+
+	// commands are queued asynchronously from pubsub.
+	deadline := time.Now().Add(time.Second)
+	for len(list("UDID-1")) < 3 || len(list("UDID-2")) < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("commands were not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the inmem pubsub does not keep the order of events, so the
+	// commands are checked by UUID and in the order they were queued.
+	queued := list("UDID-1")
+	for i, cmd := range queued {
+		if have, want := cmd.RequestType, requestTypes[cmd.UUID]; have != want {
+			t.Errorf("command %s: have request type %s, want %s", cmd.UUID, have, want)
+		}
+		if cmd.QueuedAt.IsZero() {
+			t.Errorf("command %s: missing queued_at", cmd.UUID)
+		}
+		if i > 0 && cmd.QueuedAt.Before(queued[i-1].QueuedAt) {
+			t.Errorf("command %s is listed after a command queued later", cmd.UUID)
+		}
+	}
+
+	del := func(udid, uuid string) int {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("DELETE", "/v1/devices/"+udid+"/commands/"+uuid, nil))
+		return rec.Code
+	}
+	if have, want := del("UDID-1", uuids[1]), http.StatusOK; have != want {
+		t.Fatalf("delete: have status %d, want %d", have, want)
+	}
+	if have, want := del("UDID-1", uuids[1]), http.StatusNotFound; have != want {
+		t.Errorf("delete twice: have status %d, want %d", have, want)
+	}
+
+	queued = list("UDID-1")
+	if len(queued) != 2 {
+		t.Fatalf("have queue %v, want only %s deleted", queued, uuids[1])
+	}
+	for _, cmd := range queued {
+		if cmd.UUID == uuids[1] {
+			t.Errorf("deleted command %s is still queued", cmd.UUID)
+		}
+	}
+	if have, want := len(list("UDID-2")), 1; have != want {
+		t.Errorf("other device: have %d queued commands, want %d", have, want)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"google.golang.org/protobuf/proto"
 
 	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/pkg/timeutil"
 	"github.com/micromdm/micromdm/platform/command/internal/commandproto"
 )
 
@@ -16,6 +17,10 @@ type Event struct {
 	Time       time.Time
 	Payload    *mdm.CommandPayload
 	DeviceUDID string
+
+	// Expires is the time after which the command is no longer sent to the
+	// device. A zero Expires means the command never expires.
+	Expires time.Time
 }
 
 // NewEvent returns an Event with a unique ID and the current time.
@@ -40,6 +45,7 @@ func MarshalEvent(e *Event) ([]byte, error) {
 		Time:         e.Time.UnixNano(),
 		PayloadBytes: payloadBytes,
 		DeviceUdid:   e.DeviceUDID,
+		Expires:      timeutil.ToNano(e.Expires),
 	})
 
 }
@@ -59,6 +65,7 @@ func UnmarshalEvent(data []byte, e *Event) error {
 	e.DeviceUDID = pb.DeviceUdid
 	e.Time = time.Unix(0, pb.Time).UTC()
 	e.Payload = &payload
+	e.Expires = timeutil.FromNano(pb.Expires)
 	return nil
 }
 
@@ -1,9 +1,12 @@
 package command_test
 
 import (
+	"context"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/micromdm/micromdm/mdm/mdm"
 	"github.com/micromdm/micromdm/platform/command"
 )
 
@@ -47,3 +50,29 @@ func TestRawEvent(t *testing.T) {
 		t.Error("expected events to be equal")
 	}
 }
+
+func TestNewCommandTTL(t *testing.T) {
+	pub := &mockPublisher{}
+	svc, err := command.New(pub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &mdm.CommandRequest{UDID: "1234", Command: &mdm.Command{RequestType: "DeviceInformation"}}
+
+	if _, err := svc.NewCommand(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.NewCommand(context.Background(), request, command.WithTTL(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(pub.events), 2; have != want {
+		t.Fatalf("have %d events, want %d", have, want)
+	}
+	if expires := pub.events[0].Expires; !expires.IsZero() {
+		t.Errorf("have Expires %s without a TTL, want zero", expires)
+	}
+	ev := pub.events[1]
+	if have, want := ev.Expires.Sub(ev.Time), time.Hour; have != want {
+		t.Errorf("have Expires %s after the event time, want %s", have, want)
+	}
+}
@@ -0,0 +1,266 @@
+package command
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/pkg/scope"
+)
+
+// idempotencySweepInterval is how often the expired results are removed from
+// the IdempotencyStore.
+const idempotencySweepInterval = time.Hour
+
+// DefaultIdempotencyWindow is how long an idempotency key is remembered after
+// the command it was submitted with has been queued.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// IdempotencyKeyHeader is the HTTP header which carries the idempotency key of
+// a command submission.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+var errIdempotencyKeyReused error = idempotencyKeyReusedError{}
+
+type idempotencyKeyReusedError struct{}
+
+func (idempotencyKeyReusedError) Error() string {
+	return "idempotency key was already used for a different request"
+}
+
+func (idempotencyKeyReusedError) StatusCode() int { return http.StatusUnprocessableEntity }
+
+// WithIdempotencyWindow sets how long idempotency keys are remembered.
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(svc *CommandService) {
+		svc.idempotency.window = window
+	}
+}
+
+// IdempotencyStore persists the results of submissions with an idempotency key,
+// so that they are remembered after a restart.
+type IdempotencyStore interface {
+	SaveIdempotentResult(ctx context.Context, key string, result *IdempotentResult) error
+	// IdempotentResult returns nil if no result is stored for key, or the
+	// stored result has expired.
+	IdempotentResult(ctx context.Context, key string) (*IdempotentResult, error)
+	// DeleteExpiredIdempotentResults removes the results which expired before
+	// now. It is called periodically, so that saving a result does not have to.
+	DeleteExpiredIdempotentResults(ctx context.Context, now time.Time) error
+}
+
+// WithIdempotencyStore persists idempotency keys and the results of the
+// submissions which used them in store.
+func WithIdempotencyStore(store IdempotencyStore) Option {
+	return func(svc *CommandService) {
+		svc.idempotency.store = store
+	}
+}
+
+// IdempotentResult is the result of a command submission, which is returned
+// again to later submissions of the same request with the same idempotency key.
+type IdempotentResult struct {
+	// RequestHash identifies the request the key was first used for.
+	RequestHash string              `json:"request_hash"`
+	Payload     *mdm.CommandPayload `json:"payload,omitempty"`
+	Results     []QueueResult       `json:"results,omitempty"`
+	Expires     time.Time           `json:"expires"`
+}
+
+// requestHash returns a hash of the parts of a command submission which must
+// be the same for a later submission with the same idempotency key.
+func requestHash(kind string, request *mdm.CommandRequest, udids []string, o commandOptions) (string, error) {
+	data, err := json.Marshal(struct {
+		Kind        string
+		UDIDs       []string
+		CommandUUID string
+		TTL         time.Duration
+		Command     *mdm.Command
+	}{kind, udids, request.CommandUUID, o.ttl, request.Command})
+	if err != nil {
+		return "", errors.Wrap(err, "hash idempotent request")
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type idempotencyEntry struct {
+	done   chan struct{}
+	hash   string
+	result IdempotentResult
+	err    error
+}
+
+// expired reports whether the entry is for a finished call which is older
+// than the window. Entries of calls which are still in flight have no expiry
+// yet.
+func (e *idempotencyEntry) expired(now time.Time) bool {
+	return !e.result.Expires.IsZero() && !now.Before(e.result.Expires)
+}
+
+// idempotencyExpiry is the time the entry of key expires at.
+type idempotencyExpiry struct {
+	key     string
+	expires time.Time
+}
+
+// idempotencyCache maps idempotency keys to the result of the submission
+// which first used them, for the duration of the window.
+type idempotencyCache struct {
+	window time.Duration
+	store  IdempotencyStore
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	// expiries is in the order the entries were finished in, which is the order
+	// they expire in, except for entries loaded from the store.
+	expiries []idempotencyExpiry
+}
+
+func newIdempotencyCache(window time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		window:  window,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// scopedKey returns key scoped to the authenticated principal of ctx, so that
+// API clients cannot see the results of each other's submissions.
+func scopedKey(ctx context.Context, key string) string {
+	if p, ok := scope.FromContext(ctx); ok {
+		return p.Name + "\x00" + key
+	}
+	return key
+}
+
+// do calls fn once per key within the window, and returns the result of that
+// call to every caller with the same key and request hash. Concurrent callers
+// wait for the first call to finish. A failed call is forgotten so that the
+// submission can be retried. A caller with the same key and a different
+// request hash gets errIdempotencyKeyReused. Keys are scoped to the
+// authenticated principal of ctx.
+func (c *idempotencyCache) do(ctx context.Context, key, hash string, fn func() (IdempotentResult, error)) (IdempotentResult, error) {
+	scoped := scopedKey(ctx, key)
+	c.mu.Lock()
+	c.removeExpired(time.Now())
+	e, ok := c.lookup(scoped)
+	c.mu.Unlock()
+
+	var stored *IdempotentResult
+	if !ok && c.store != nil {
+		var err error
+		stored, err = c.store.IdempotentResult(ctx, scoped)
+		if err != nil {
+			return IdempotentResult{}, errors.Wrapf(err, "get result of idempotency key %s", key)
+		}
+	}
+
+	if !ok {
+		c.mu.Lock()
+		// another caller may have added the key while the store was read.
+		e, ok = c.lookup(scoped)
+		switch {
+		case ok:
+		case stored != nil:
+			e = &idempotencyEntry{done: make(chan struct{}), hash: stored.RequestHash, result: *stored}
+			close(e.done)
+			c.add(scoped, e)
+			ok = true
+		default:
+			e = &idempotencyEntry{done: make(chan struct{}), hash: hash}
+			c.entries[scoped] = e
+		}
+		c.mu.Unlock()
+	}
+	if ok {
+		<-e.done
+		if e.hash != hash {
+			return IdempotentResult{}, errIdempotencyKeyReused
+		}
+		return e.result, e.err
+	}
+
+	result, err := fn()
+	var saveErr error
+	if err == nil {
+		result.RequestHash = hash
+		result.Expires = time.Now().Add(c.window)
+		if c.store != nil {
+			// the entry is kept in memory even if it is not saved, so that a retry
+			// of the failed request returns the queued command instead of queuing it again.
+			saveErr = errors.Wrapf(c.store.SaveIdempotentResult(ctx, scoped, &result), "save result of idempotency key %s", key)
+		}
+	}
+
+	c.mu.Lock()
+	e.result, e.err = result, err
+	if err != nil {
+		delete(c.entries, scoped)
+	} else {
+		c.add(scoped, e)
+	}
+	c.mu.Unlock()
+	close(e.done)
+	if saveErr != nil {
+		return IdempotentResult{}, saveErr
+	}
+	return result, err
+}
+
+// lookup returns the entry of key, unless it has expired. It must be called
+// with c.mu held.
+func (c *idempotencyCache) lookup(key string) (*idempotencyEntry, bool) {
+	e, ok := c.entries[key]
+	if ok && e.expired(time.Now()) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e, ok
+}
+
+// add records the finished entry of key. It must be called with c.mu held.
+func (c *idempotencyCache) add(key string, e *idempotencyEntry) {
+	c.entries[key] = e
+	c.expiries = append(c.expiries, idempotencyExpiry{key: key, expires: e.result.Expires})
+}
+
+// removeExpired removes the entries at the front of the expiries which have
+// expired. An entry loaded from the store which expires before the entries
+// added ahead of it is removed by lookup, or once they have expired. It must be
+// called with c.mu held.
+func (c *idempotencyCache) removeExpired(now time.Time) {
+	n := 0
+	for ; n < len(c.expiries) && !now.Before(c.expiries[n].expires); n++ {
+		exp := c.expiries[n]
+		// the key may have been used again since this entry expired.
+		if e, ok := c.entries[exp.key]; ok && e.result.Expires.Equal(exp.expires) {
+			delete(c.entries, exp.key)
+		}
+	}
+	c.expiries = c.expiries[n:]
+}
+
+// sweep removes the expired results from the store every interval, until ctx
+// is done.
+func (c *idempotencyCache) sweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := c.store.DeleteExpiredIdempotentResults(ctx, now); err != nil && ctx.Err() == nil {
+				log.Printf("delete expired idempotency keys: %s", err)
+			}
+		}
+	}
+}
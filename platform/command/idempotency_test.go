@@ -0,0 +1,239 @@
+package command_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/pkg/scope"
+	"github.com/micromdm/micromdm/platform/command"
+	"github.com/micromdm/micromdm/platform/command/builtin"
+)
+
+func newTestRequest() *mdm.CommandRequest {
+	return &mdm.CommandRequest{UDID: "UDID-1", Command: &mdm.Command{RequestType: "DeviceInformation"}}
+}
+
+func TestNewCommandIdempotencyKey(t *testing.T) {
+	pub := &mockPublisher{}
+	svc, err := command.New(pub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	first, err := svc.NewCommand(ctx, newTestRequest(), command.WithIdempotencyKey("key-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := svc.NewCommand(ctx, newTestRequest(), command.WithIdempotencyKey("key-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.CommandUUID != second.CommandUUID {
+		t.Errorf("have CommandUUID %s for the retry, want %s", second.CommandUUID, first.CommandUUID)
+	}
+	if have, want := len(pub.events), 1; have != want {
+		t.Fatalf("have %d queued commands, want %d", have, want)
+	}
+
+	other, err := svc.NewCommand(ctx, newTestRequest(), command.WithIdempotencyKey("key-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.CommandUUID == first.CommandUUID {
+		t.Error("expected a new CommandUUID for a different idempotency key")
+	}
+	if _, err := svc.NewCommand(ctx, newTestRequest()); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(pub.events), 3; have != want {
+		t.Errorf("have %d queued commands, want %d", have, want)
+	}
+
+	results, err := svc.QueueCommandToDevices(ctx, newTestRequest(), []string{"UDID-1"}, command.WithIdempotencyKey("key-1"))
+	if err == nil {
+		t.Errorf("expected error when reusing a key for a bulk request, got %+v", results)
+	}
+	restart := &mdm.CommandRequest{UDID: "UDID-1", Command: &mdm.Command{RequestType: "RestartDevice"}}
+	if _, err := svc.NewCommand(ctx, restart, command.WithIdempotencyKey("key-1")); err == nil {
+		t.Error("expected error when reusing a key for a different command")
+	}
+	if have, want := len(pub.events), 3; have != want {
+		t.Errorf("have %d queued commands after reusing a key, want %d", have, want)
+	}
+}
+
+func TestIdempotencyKeyPrincipals(t *testing.T) {
+	pub := &mockPublisher{}
+	svc, err := command.New(pub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var uuids []string
+	for _, name := range []string{"alice", "bob"} {
+		ctx := scope.NewContext(context.Background(), &scope.Principal{Name: name, Scopes: []string{scope.Admin}})
+		payload, err := svc.NewCommand(ctx, newTestRequest(), command.WithIdempotencyKey("key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uuids = append(uuids, payload.CommandUUID)
+	}
+	if uuids[0] == uuids[1] {
+		t.Error("expected the same key of different principals to queue different commands")
+	}
+	if have, want := len(pub.events), 2; have != want {
+		t.Errorf("have %d queued commands, want %d", have, want)
+	}
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	f, _ := ioutil.TempFile("", "bolt-")
+	f.Close()
+	defer os.Remove(f.Name())
+	boltDB, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer boltDB.Close()
+	store, err := builtin.NewDB(boltDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	pub := &mockPublisher{}
+	svc, err := command.New(pub, nil, command.WithIdempotencyStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := svc.NewCommand(ctx, newTestRequest(), command.WithIdempotencyKey("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new service with the same store, as after a restart.
+	restarted, err := command.New(pub, nil, command.WithIdempotencyStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := restarted.NewCommand(ctx, newTestRequest(), command.WithIdempotencyKey("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.CommandUUID != second.CommandUUID {
+		t.Errorf("have CommandUUID %s after a restart, want %s", second.CommandUUID, first.CommandUUID)
+	}
+	if have, want := second.Command.RequestType, "DeviceInformation"; have != want {
+		t.Errorf("have request type %s, want %s", have, want)
+	}
+	if have, want := len(pub.events), 1; have != want {
+		t.Errorf("have %d queued commands, want %d", have, want)
+	}
+	restart := &mdm.CommandRequest{UDID: "UDID-1", Command: &mdm.Command{RequestType: "RestartDevice"}}
+	if _, err := restarted.NewCommand(ctx, restart, command.WithIdempotencyKey("key")); err == nil {
+		t.Error("expected error when reusing a stored key for a different command")
+	}
+}
+
+func TestNewCommandIdempotencyKeyConcurrent(t *testing.T) {
+	pub := &mockPublisher{}
+	svc, err := command.New(pub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuids := make([]string, 10)
+	var wg sync.WaitGroup
+	for i := range uuids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			payload, err := svc.NewCommand(context.Background(), newTestRequest(), command.WithIdempotencyKey("key"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			uuids[i] = payload.CommandUUID
+		}(i)
+	}
+	wg.Wait()
+
+	if have, want := len(pub.events), 1; have != want {
+		t.Fatalf("have %d queued commands, want %d", have, want)
+	}
+	for i, uuid := range uuids {
+		if uuid != pub.events[0].Payload.CommandUUID {
+			t.Errorf("submission %d: have CommandUUID %s, want %s", i, uuid, pub.events[0].Payload.CommandUUID)
+		}
+	}
+}
+
+func TestIdempotencyWindow(t *testing.T) {
+	pub := &mockPublisher{}
+	svc, err := command.New(pub, nil, command.WithIdempotencyWindow(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	first, err := svc.NewCommand(ctx, newTestRequest(), command.WithIdempotencyKey("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	second, err := svc.NewCommand(ctx, newTestRequest(), command.WithIdempotencyKey("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.CommandUUID == second.CommandUUID {
+		t.Error("expected the key to be forgotten after the idempotency window")
+	}
+	if have, want := len(pub.events), 2; have != want {
+		t.Errorf("have %d queued commands, want %d", have, want)
+	}
+}
+
+func TestIdempotencyKeyHeader(t *testing.T) {
+	pub := &mockPublisher{}
+	svc, err := command.New(pub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	command.RegisterHTTPHandlers(r, command.MakeServerEndpoints(svc, adminMiddleware))
+
+	for i := 0; i < 2; i++ {
+		body := `{"udid":"UDID-1","request_type":"DeviceInformation"}`
+		req := httptest.NewRequest("POST", "/v1/commands", strings.NewReader(body))
+		req.Header.Set(command.IdempotencyKeyHeader, "key")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		if have, want := resp.Code, http.StatusCreated; have != want {
+			t.Fatalf("request %d: have status %d, want %d: %s", i, have, want, resp.Body)
+		}
+	}
+	if have, want := len(pub.events), 1; have != want {
+		t.Errorf("have %d queued commands, want %d", have, want)
+	}
+
+	body := `{"udid":"UDID-2","request_type":"DeviceInformation"}`
+	req := httptest.NewRequest("POST", "/v1/commands", strings.NewReader(body))
+	req.Header.Set(command.IdempotencyKeyHeader, "key")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if have, want := resp.Code, http.StatusUnprocessableEntity; have != want {
+		t.Errorf("have status %d for a reused key, want %d: %s", have, want, resp.Body)
+	}
+}
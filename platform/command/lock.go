@@ -0,0 +1,261 @@
+package command
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
+	"github.com/micromdm/micromdm/platform/audit"
+)
+
+// DevicePIN is the PIN of the last DeviceLock or EraseDevice command queued for a device.
+type DevicePIN struct {
+	UDID        string    `json:"udid"`
+	PIN         string    `json:"pin"`
+	RequestType string    `json:"request_type"`
+	CommandUUID string    `json:"command_uuid"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PINStore stores the PINs of DeviceLock and EraseDevice commands,
+// which are needed to unlock a Mac after the command is processed.
+type PINStore interface {
+	SavePIN(ctx context.Context, pin *DevicePIN) error
+	// DevicePIN returns ErrPINNotFound if no PIN is stored for udid.
+	DevicePIN(ctx context.Context, udid string) (*DevicePIN, error)
+}
+
+// ErrPINNotFound is returned by PINStore.DevicePIN if no PIN is stored for the device.
+var ErrPINNotFound error = pinNotFoundError{}
+
+type pinNotFoundError struct{}
+
+func (pinNotFoundError) Error() string   { return "PIN not found" }
+func (pinNotFoundError) StatusCode() int { return http.StatusNotFound }
+
+// lockRequestTypes are the commands which lock, erase or unlock a device.
+// They need the devices:erase scope, whichever endpoint queues them.
+var lockRequestTypes = map[string]bool{
+	"DeviceLock":    true,
+	"EraseDevice":   true,
+	"ClearPasscode": true,
+}
+
+// checkRequestType checks that the principal of ctx may queue a command of requestType.
+func checkRequestType(ctx context.Context, requestType string) error {
+	if lockRequestTypes[requestType] {
+		return scope.Check(ctx, scope.DevicesErase)
+	}
+	return nil
+}
+
+var errNoPINStore = errors.New("command service has no PIN store")
+
+// WithPINStore stores the PINs of commands queued with QueueDeviceLock and QueueEraseDevice.
+func WithPINStore(store PINStore) Option {
+	return func(svc *CommandService) {
+		svc.pins = store
+	}
+}
+
+// QueueDeviceLock queues a DeviceLock command with a generated PIN for the
+// device with udid, and returns the PIN. The message and phoneNumber are
+// shown on the lock screen and may be empty.
+func (svc *CommandService) QueueDeviceLock(ctx context.Context, udid, message, phoneNumber string) (string, error) {
+	pin, err := mdm.NewPIN()
+	if err != nil {
+		return "", err
+	}
+	cmd, err := mdm.NewDeviceLockCommand(pin, message, phoneNumber)
+	if err != nil {
+		return "", err
+	}
+	if err := svc.queuePINCommand(ctx, udid, pin, cmd); err != nil {
+		return "", err
+	}
+	return pin, nil
+}
+
+// QueueEraseDevice queues an EraseDevice command for the device with udid.
+// A Mac erased with a pin requires it to unlock the firmware, so a non-empty
+// pin is stored like the PIN of a DeviceLock command.
+func (svc *CommandService) QueueEraseDevice(ctx context.Context, udid, pin string) error {
+	if udid == "" {
+		return errEmptyRequest
+	}
+	cmd, err := mdm.NewEraseDeviceCommand(pin)
+	if err != nil {
+		return err
+	}
+	if pin == "" {
+		_, err := svc.NewCommand(ctx, &mdm.CommandRequest{UDID: udid, Command: cmd})
+		return err
+	}
+	return svc.queuePINCommand(ctx, udid, pin, cmd)
+}
+
+// DevicePIN returns the PIN of the last DeviceLock or EraseDevice command
+// queued for the device with udid.
+func (svc *CommandService) DevicePIN(ctx context.Context, udid string) (*DevicePIN, error) {
+	if svc.pins == nil {
+		return nil, errNoPINStore
+	}
+	return svc.pins.DevicePIN(ctx, udid)
+}
+
+// queuePINCommand saves the pin before queuing cmd, so that a device is
+// never locked with a PIN which was not stored.
+func (svc *CommandService) queuePINCommand(ctx context.Context, udid, pin string, cmd *mdm.Command) error {
+	if svc.pins == nil {
+		return errNoPINStore
+	}
+	if err := svc.work.Start(); err != nil {
+		return err
+	}
+	defer svc.work.Done()
+	if udid == "" {
+		return errEmptyRequest
+	}
+	request := &mdm.CommandRequest{UDID: udid, Command: cmd}
+	payload, err := mdm.NewCommandPayload(request)
+	if err != nil {
+		return errors.Wrap(err, "creating mdm payload")
+	}
+	err = svc.pins.SavePIN(ctx, &DevicePIN{
+		UDID:        udid,
+		PIN:         pin,
+		RequestType: cmd.RequestType,
+		CommandUUID: payload.CommandUUID,
+		CreatedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "saving %s PIN", cmd.RequestType)
+	}
+	return svc.publishCommand(payload, udid, commandOptions{})
+}
+
+type deviceLockRequest struct {
+	UDID        string `json:"-"`
+	Message     string `json:"message"`
+	PhoneNumber string `json:"phone_number"`
+}
+
+type deviceLockResponse struct {
+	PIN string `json:"pin,omitempty"`
+	Err error  `json:"error,omitempty"`
+}
+
+func (r deviceLockResponse) Failed() error   { return r.Err }
+func (r deviceLockResponse) StatusCode() int { return http.StatusCreated }
+
+func (r deviceLockRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: "DeviceLock", UDIDs: []string{r.UDID}}
+}
+
+func decodeDeviceLockRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req deviceLockRequest
+	if r.ContentLength != 0 {
+		if err := httputil.DecodeJSONRequest(r, &req); err != nil {
+			return nil, err
+		}
+	}
+	req.UDID = mux.Vars(r)["udid"]
+	return req, nil
+}
+
+// MakeDeviceLockEndpoint creates an endpoint which locks a device with a generated PIN.
+func MakeDeviceLockEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deviceLockRequest)
+		if req.UDID == "" {
+			return deviceLockResponse{Err: errEmptyRequest}, nil
+		}
+		pin, err := svc.QueueDeviceLock(ctx, req.UDID, req.Message, req.PhoneNumber)
+		if err != nil {
+			return deviceLockResponse{Err: err}, nil
+		}
+		return deviceLockResponse{PIN: pin}, nil
+	}
+}
+
+type eraseDeviceRequest struct {
+	UDID string `json:"-"`
+	PIN  string `json:"pin"`
+}
+
+type eraseDeviceResponse struct {
+	Err error `json:"error,omitempty"`
+}
+
+func (r eraseDeviceResponse) Failed() error   { return r.Err }
+func (r eraseDeviceResponse) StatusCode() int { return http.StatusCreated }
+
+func (r eraseDeviceRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: "EraseDevice", UDIDs: []string{r.UDID}}
+}
+
+func decodeEraseDeviceRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req eraseDeviceRequest
+	if r.ContentLength != 0 {
+		if err := httputil.DecodeJSONRequest(r, &req); err != nil {
+			return nil, err
+		}
+	}
+	req.UDID = mux.Vars(r)["udid"]
+	return req, nil
+}
+
+// MakeEraseDeviceEndpoint creates an endpoint which erases a device.
+func MakeEraseDeviceEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(eraseDeviceRequest)
+		if req.UDID == "" {
+			return eraseDeviceResponse{Err: errEmptyRequest}, nil
+		}
+		if err := svc.QueueEraseDevice(ctx, req.UDID, req.PIN); err != nil {
+			return eraseDeviceResponse{Err: err}, nil
+		}
+		return eraseDeviceResponse{}, nil
+	}
+}
+
+type devicePINRequest struct {
+	UDID string
+}
+
+func (r devicePINRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: "DevicePIN", UDIDs: []string{r.UDID}}
+}
+
+type devicePINResponse struct {
+	*DevicePIN
+	Err error `json:"error,omitempty"`
+}
+
+func (r devicePINResponse) Failed() error { return r.Err }
+
+func decodeDevicePINRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return devicePINRequest{UDID: mux.Vars(r)["udid"]}, nil
+}
+
+// MakeDevicePINEndpoint creates an endpoint which returns the stored PIN of a device.
+func MakeDevicePINEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(devicePINRequest)
+		if req.UDID == "" {
+			return devicePINResponse{Err: errEmptyRequest}, nil
+		}
+		pin, err := svc.DevicePIN(ctx, req.UDID)
+		if err != nil {
+			return devicePINResponse{Err: err}, nil
+		}
+		return devicePINResponse{DevicePIN: pin}, nil
+	}
+}
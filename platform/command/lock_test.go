@@ -0,0 +1,178 @@
+package command_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+	"github.com/groob/plist"
+
+	"github.com/micromdm/micromdm/platform/command"
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+	queueinmem "github.com/micromdm/micromdm/platform/queue/inmem"
+)
+
+type pinStore struct {
+	mu   sync.Mutex
+	pins map[string]command.DevicePIN
+}
+
+func (s *pinStore) SavePIN(_ context.Context, pin *command.DevicePIN) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pins[pin.UDID] = *pin
+	return nil
+}
+
+func (s *pinStore) DevicePIN(_ context.Context, udid string) (*command.DevicePIN, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pin, ok := s.pins[udid]
+	if !ok {
+		return nil, command.ErrPINNotFound
+	}
+	return &pin, nil
+}
+
+func TestQueueDeviceLock(t *testing.T) {
+	pubsub := inmem.NewPubSub()
+	queue := queueinmem.New(pubsub, log.NewNopLogger())
+	pins := &pinStore{pins: make(map[string]command.DevicePIN)}
+	svc, err := command.New(pubsub, queue, command.WithPINStore(pins))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	command.RegisterHTTPHandlers(r, command.MakeServerEndpoints(svc, adminMiddleware))
+
+	rec := httptest.NewRecorder()
+	body := strings.NewReader(`{"message": "Lost device", "phone_number": "555-0100"}`)
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/devices/UDID-1/lock", body))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("have status %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var resp struct{ PIN string }
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.PIN) != 6 {
+		t.Fatalf("have PIN %q, want six digits", resp.PIN)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/devices/UDID-1/pin", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("have status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var stored command.DevicePIN
+	if err := json.NewDecoder(rec.Body).Decode(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.PIN != resp.PIN || stored.RequestType != "DeviceLock" {
+		t.Errorf("have stored PIN %+v, want DeviceLock PIN %s", stored, resp.PIN)
+	}
+
+	payload := queuedPayload(t, svc, "UDID-1")
+	if payload.CommandUUID != stored.CommandUUID {
+		t.Errorf("have CommandUUID %s, want stored CommandUUID %s", payload.CommandUUID, stored.CommandUUID)
+	}
+	for key, want := range map[string]string{
+		"RequestType": "DeviceLock",
+		"PIN":         resp.PIN,
+		"Message":     "Lost device",
+		"PhoneNumber": "555-0100",
+	} {
+		if have := payload.Command[key]; have != want {
+			t.Errorf("have %s %v, want %s", key, have, want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/devices/UDID-2/pin", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("have status %d for a device without a PIN, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestQueueEraseDevice(t *testing.T) {
+	pubsub := inmem.NewPubSub()
+	queue := queueinmem.New(pubsub, log.NewNopLogger())
+	pins := &pinStore{pins: make(map[string]command.DevicePIN)}
+	svc, err := command.New(pubsub, queue, command.WithPINStore(pins))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := svc.QueueEraseDevice(ctx, "UDID-1", "12345"); err == nil {
+		t.Error("expected error for an invalid PIN")
+	}
+	if err := svc.QueueEraseDevice(ctx, "UDID-1", "123456"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := svc.DevicePIN(ctx, "UDID-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.PIN != "123456" || stored.RequestType != "EraseDevice" {
+		t.Errorf("have stored PIN %+v, want EraseDevice PIN 123456", stored)
+	}
+	payload := queuedPayload(t, svc, "UDID-1")
+	if have, want := payload.Command["RequestType"], "EraseDevice"; have != want {
+		t.Errorf("have RequestType %v, want %s", have, want)
+	}
+	if have, want := payload.Command["PIN"], "123456"; have != want {
+		t.Errorf("have PIN %v, want %s", have, want)
+	}
+
+	// an EraseDevice command without a PIN does not replace the stored PIN.
+	if err := svc.QueueEraseDevice(ctx, "UDID-1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := svc.DevicePIN(ctx, "UDID-1"); err != nil || stored.PIN != "123456" {
+		t.Errorf("have stored PIN %+v, err %v, want 123456", stored, err)
+	}
+
+	noStore, err := command.New(pubsub, queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := noStore.QueueDeviceLock(ctx, "UDID-1", "", ""); err == nil {
+		t.Error("expected error locking a device without a PIN store")
+	}
+}
+
+type queuedCommandPayload struct {
+	CommandUUID string
+	Command     map[string]interface{}
+}
+
+// queuedPayload waits for the first command to be queued for udid and decodes its payload.
+func queuedPayload(t *testing.T, svc command.Service, udid string) queuedCommandPayload {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		cmds, err := svc.ViewQueue(context.Background(), udid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cmds) > 0 {
+			var payload queuedCommandPayload
+			if err := plist.Unmarshal(cmds[0].Payload, &payload); err != nil {
+				t.Fatal(err)
+			}
+			return payload
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("command was not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -2,9 +2,11 @@ package command
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/gorilla/mux"
@@ -14,6 +16,7 @@ import (
 
 	"github.com/micromdm/micromdm/mdm/mdm"
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/platform/audit"
 )
 
 const (
@@ -24,7 +27,80 @@ const (
 	RawCommandTopic = "mdm.RawCommand"
 )
 
-func (svc *CommandService) NewCommand(ctx context.Context, request *mdm.CommandRequest) (*mdm.CommandPayload, error) {
+// CommandOption configures how a new command is queued.
+type CommandOption func(*commandOptions)
+
+type commandOptions struct {
+	ttl            time.Duration
+	idempotencyKey string
+	dryRun         bool
+}
+
+// WithTTL expires the command if it is not delivered to the device within ttl.
+// A ttl of zero or less means the command never expires.
+func WithTTL(ttl time.Duration) CommandOption {
+	return func(o *commandOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithIdempotencyKey returns the result of an earlier submission with the same
+// key instead of queuing the command again, if the earlier submission is
+// within the idempotency window.
+func WithIdempotencyKey(key string) CommandOption {
+	return func(o *commandOptions) {
+		o.idempotencyKey = key
+	}
+}
+
+// WithDryRun checks the devices QueueCommandToDevices targets without queuing
+// the command. The idempotency key of a dry run is ignored.
+func WithDryRun() CommandOption {
+	return func(o *commandOptions) {
+		o.dryRun = true
+	}
+}
+
+func newCommandOptions(opts []CommandOption) commandOptions {
+	var o commandOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o commandOptions) newEvent(payload *mdm.CommandPayload, udid string) *Event {
+	event := NewEvent(payload, udid)
+	if o.ttl > 0 {
+		event.Expires = event.Time.Add(o.ttl)
+	}
+	return event
+}
+
+func (svc *CommandService) NewCommand(ctx context.Context, request *mdm.CommandRequest, opts ...CommandOption) (*mdm.CommandPayload, error) {
+	if err := svc.work.Start(); err != nil {
+		return nil, err
+	}
+	defer svc.work.Done()
+	o := newCommandOptions(opts)
+	if o.idempotencyKey == "" {
+		return svc.newCommand(ctx, request, o)
+	}
+	if request == nil {
+		return nil, errors.New("empty CommandRequest")
+	}
+	hash, err := requestHash("command", request, []string{request.UDID}, o)
+	if err != nil {
+		return nil, err
+	}
+	result, err := svc.idempotency.do(ctx, o.idempotencyKey, hash, func() (IdempotentResult, error) {
+		payload, err := svc.newCommand(ctx, request, o)
+		return IdempotentResult{Payload: payload}, err
+	})
+	return result.Payload, err
+}
+
+func (svc *CommandService) newCommand(ctx context.Context, request *mdm.CommandRequest, o commandOptions) (*mdm.CommandPayload, error) {
 	if request == nil {
 		return nil, errors.New("empty CommandRequest")
 	}
@@ -32,18 +108,29 @@ func (svc *CommandService) NewCommand(ctx context.Context, request *mdm.CommandR
 	if err != nil {
 		return nil, errors.Wrap(err, "creating mdm payload")
 	}
-	event := NewEvent(payload, request.UDID)
+	if err := svc.publishCommand(payload, request.UDID, o); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (svc *CommandService) publishCommand(payload *mdm.CommandPayload, udid string, o commandOptions) error {
+	event := o.newEvent(payload, udid)
 	msg, err := MarshalEvent(event)
 	if err != nil {
-		return nil, errors.Wrap(err, "marshalling mdm command event")
+		return errors.Wrap(err, "marshalling mdm command event")
 	}
 	if err := svc.publisher.Publish(context.TODO(), CommandTopic, msg); err != nil {
-		return nil, errors.Wrapf(err, "publish mdm command on topic: %s", CommandTopic)
+		return errors.Wrapf(err, "publish mdm command on topic: %s", CommandTopic)
 	}
-	return payload, nil
+	return nil
 }
 
 func (svc *CommandService) NewRawCommand(ctx context.Context, cmd *RawCommand) error {
+	if err := svc.work.Start(); err != nil {
+		return err
+	}
+	defer svc.work.Done()
 	if cmd == nil {
 		return errors.New("empty RawCommand")
 	}
@@ -60,6 +147,49 @@ func (svc *CommandService) NewRawCommand(ctx context.Context, cmd *RawCommand) e
 
 type newCommandRequest struct {
 	mdm.CommandRequest
+
+	// TTL is the number of seconds after which the command expires
+	// if it has not been sent to the device.
+	TTL int64 `json:"ttl,omitempty"`
+
+	// IdempotencyKey is set from the Idempotency-Key header
+	// if it is not part of the request body.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// UnmarshalJSON decodes the TTL and IdempotencyKey alongside the embedded
+// CommandRequest, whose UnmarshalJSON method would otherwise ignore them.
+func (r *newCommandRequest) UnmarshalJSON(data []byte) error {
+	var fields struct {
+		TTL            int64  `json:"ttl"`
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return errors.Wrap(err, "unmarshal json command request")
+	}
+	r.TTL = fields.TTL
+	r.IdempotencyKey = fields.IdempotencyKey
+	return r.CommandRequest.UnmarshalJSON(data)
+}
+
+// requestOptions returns the CommandOptions for the optional fields of an API request.
+func requestOptions(ttl int64, idempotencyKey string) []CommandOption {
+	var opts []CommandOption
+	if ttl > 0 {
+		opts = append(opts, WithTTL(time.Duration(ttl)*time.Second))
+	}
+	if idempotencyKey != "" {
+		opts = append(opts, WithIdempotencyKey(idempotencyKey))
+	}
+	return opts
+}
+
+// idempotencyKey returns the key from the body of a request, or else from its header.
+func idempotencyKey(r *http.Request, fromBody string) string {
+	if fromBody != "" {
+		return fromBody
+	}
+	return r.Header.Get(IdempotencyKeyHeader)
 }
 
 type newCommandResponse struct {
@@ -70,13 +200,21 @@ type newCommandResponse struct {
 func (r newCommandResponse) Failed() error   { return r.Err }
 func (r newCommandResponse) StatusCode() int { return http.StatusCreated }
 
+func (r newCommandRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: r.RequestType, UDIDs: []string{r.UDID}}
+}
+
 func decodeNewCommandRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	var req newCommandRequest
 	err := httputil.DecodeJSONRequest(r, &req)
+	req.IdempotencyKey = idempotencyKey(r, req.IdempotencyKey)
 	return req, err
 }
 
-var errEmptyRequest = errors.New("request must contain UDID of the device")
+var (
+	errEmptyRequest = errors.New("request must contain UDID of the device")
+	errNegativeTTL  = errors.New("ttl must not be negative")
+)
 
 // MakeNewCommandEndpoint creates an endpoint which creates new MDM Commands.
 func MakeNewCommandEndpoint(svc Service) endpoint.Endpoint {
@@ -85,7 +223,13 @@ func MakeNewCommandEndpoint(svc Service) endpoint.Endpoint {
 		if req.UDID == "" || req.RequestType == "" {
 			return newCommandResponse{Err: errEmptyRequest}, nil
 		}
-		payload, err := svc.NewCommand(ctx, &req.CommandRequest)
+		if req.TTL < 0 {
+			return newCommandResponse{Err: errNegativeTTL}, nil
+		}
+		if err := checkRequestType(ctx, req.RequestType); err != nil {
+			return newCommandResponse{Err: err}, nil
+		}
+		payload, err := svc.NewCommand(ctx, &req.CommandRequest, requestOptions(req.TTL, req.IdempotencyKey)...)
 		if err != nil {
 			return newCommandResponse{Err: err}, nil
 		}
@@ -114,6 +258,10 @@ type newRawCommandResponse struct {
 func (r newRawCommandResponse) Failed() error   { return r.Err }
 func (r newRawCommandResponse) StatusCode() int { return http.StatusCreated }
 
+func (r newRawCommandRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: r.Command.RequestType, UDIDs: []string{r.UDID}}
+}
+
 func decodeNewRawCommandRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	udid, ok := mux.Vars(r)["udid"]
 	if !ok {
@@ -148,6 +296,9 @@ func MakeNewRawCommandEndpoint(svc Service) endpoint.Endpoint {
 		if req.CommandUUID == "" || req.Command.RequestType == "" {
 			return newRawCommandResponse{Err: errMalformedRequest}, nil
 		}
+		if err := checkRequestType(ctx, req.Command.RequestType); err != nil {
+			return newRawCommandResponse{Err: err}, nil
+		}
 		if err := svc.NewRawCommand(ctx, &req.RawCommand); err != nil {
 			return newRawCommandResponse{Err: err}, nil
 		}
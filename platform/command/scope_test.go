@@ -0,0 +1,69 @@
+package command_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	"github.com/micromdm/micromdm/pkg/scope"
+	"github.com/micromdm/micromdm/platform/command"
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+	queueinmem "github.com/micromdm/micromdm/platform/queue/inmem"
+)
+
+// principalMiddleware authenticates requests as a principal with scopes.
+func principalMiddleware(scopes ...string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			return next(scope.NewContext(ctx, &scope.Principal{Name: "test", Scopes: scopes}), request)
+		}
+	}
+}
+
+func TestEndpointScopes(t *testing.T) {
+	pubsub := inmem.NewPubSub()
+	queue := queueinmem.New(pubsub, log.NewNopLogger())
+	pins := &pinStore{pins: make(map[string]command.DevicePIN)}
+	svc, err := command.New(pubsub, queue, command.WithPINStore(pins))
+	if err != nil {
+		t.Fatal(err)
+	}
+	helpdesk := []string{scope.DevicesRead, scope.CommandsWrite}
+
+	tests := []struct {
+		name   string
+		scopes []string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"view queue", helpdesk, "GET", "/v1/commands/UDID-1", "", http.StatusOK},
+		{"new command", helpdesk, "POST", "/v1/commands", `{"udid": "UDID-1", "request_type": "DeviceInformation"}`, http.StatusCreated},
+		{"new command without scope", []string{scope.DevicesRead}, "POST", "/v1/commands", `{"udid": "UDID-1", "request_type": "DeviceInformation"}`, http.StatusForbidden},
+		{"erase endpoint", helpdesk, "POST", "/v1/devices/UDID-1/erase", "", http.StatusForbidden},
+		{"erase command", helpdesk, "POST", "/v1/commands", `{"udid": "UDID-1", "request_type": "EraseDevice"}`, http.StatusForbidden},
+		{"erase bulk command", helpdesk, "POST", "/v1/commands/bulk", `{"udids": ["UDID-1"], "request_type": "EraseDevice"}`, http.StatusForbidden},
+		{"device PIN", helpdesk, "GET", "/v1/devices/UDID-1/pin", "", http.StatusForbidden},
+		{"erase with scope", []string{scope.DevicesErase}, "POST", "/v1/devices/UDID-1/erase", "", http.StatusCreated},
+		{"erase command with scope", []string{scope.CommandsWrite, scope.DevicesErase}, "POST", "/v1/commands", `{"udid": "UDID-1", "request_type": "EraseDevice"}`, http.StatusCreated},
+		{"admin", []string{scope.Admin}, "POST", "/v1/devices/UDID-1/lock", "", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mux.NewRouter()
+			command.RegisterHTTPHandlers(r, command.MakeServerEndpoints(svc, principalMiddleware(tt.scopes...)))
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.code {
+				t.Errorf("have status %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+		})
+	}
+}
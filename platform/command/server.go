@@ -5,21 +5,34 @@ import (
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 )
 
 type Endpoints struct {
-	NewCommandEndpoint    endpoint.Endpoint
-	NewRawCommandEndpoint endpoint.Endpoint
-	ClearQueueEndpoint    endpoint.Endpoint
-	ViewQueueEndpoint     endpoint.Endpoint
+	NewCommandEndpoint     endpoint.Endpoint
+	NewRawCommandEndpoint  endpoint.Endpoint
+	BulkCommandEndpoint    endpoint.Endpoint
+	ClearQueueEndpoint     endpoint.Endpoint
+	ViewQueueEndpoint      endpoint.Endpoint
+	DeviceCommandsEndpoint endpoint.Endpoint
+	DeleteCommandEndpoint  endpoint.Endpoint
+	DeviceLockEndpoint     endpoint.Endpoint
+	EraseDeviceEndpoint    endpoint.Endpoint
+	DevicePINEndpoint      endpoint.Endpoint
 }
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		NewCommandEndpoint:    endpoint.Chain(outer, others...)(MakeNewCommandEndpoint(s)),
-		NewRawCommandEndpoint: endpoint.Chain(outer, others...)(MakeNewRawCommandEndpoint(s)),
-		ClearQueueEndpoint:    endpoint.Chain(outer, others...)(MakeClearQueueEndpoint(s)),
-		ViewQueueEndpoint:     endpoint.Chain(outer, others...)(MakeViewQueueEndpoint(s)),
+		NewCommandEndpoint:     endpoint.Chain(outer, others...)(scope.Require(scope.CommandsWrite)(MakeNewCommandEndpoint(s))),
+		NewRawCommandEndpoint:  endpoint.Chain(outer, others...)(scope.Require(scope.CommandsWrite)(MakeNewRawCommandEndpoint(s))),
+		BulkCommandEndpoint:    endpoint.Chain(outer, others...)(scope.Require(scope.CommandsWrite)(MakeBulkCommandEndpoint(s))),
+		ClearQueueEndpoint:     endpoint.Chain(outer, others...)(scope.Require(scope.CommandsWrite)(MakeClearQueueEndpoint(s))),
+		ViewQueueEndpoint:      endpoint.Chain(outer, others...)(scope.Require(scope.CommandsRead)(MakeViewQueueEndpoint(s))),
+		DeviceCommandsEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.CommandsRead)(MakeDeviceCommandsEndpoint(s))),
+		DeleteCommandEndpoint:  endpoint.Chain(outer, others...)(scope.Require(scope.CommandsWrite)(MakeDeleteCommandEndpoint(s))),
+		DeviceLockEndpoint:     endpoint.Chain(outer, others...)(scope.Require(scope.DevicesErase)(MakeDeviceLockEndpoint(s))),
+		EraseDeviceEndpoint:    endpoint.Chain(outer, others...)(scope.Require(scope.DevicesErase)(MakeEraseDeviceEndpoint(s))),
+		DevicePINEndpoint:      endpoint.Chain(outer, others...)(scope.Require(scope.DevicesErase)(MakeDevicePINEndpoint(s))),
 	}
 }
 
@@ -40,6 +53,15 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 		options...,
 	))
 
+	// POST     /v1/commands/bulk		Add new MDM Command to the queues of many devices.
+	// Registered before /v1/commands/udid, which would otherwise match it.
+	r.Methods("POST").Path("/v1/commands/bulk").Handler(httptransport.NewServer(
+		e.BulkCommandEndpoint,
+		decodeBulkCommandRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
 	// POST,PUT /v1/commands/udid		Add new MDM Command with raw plist to device queue.
 	r.Methods("POST", "PUT").Path("/v1/commands/{udid}").Handler(httptransport.NewServer(
 		e.NewRawCommandEndpoint,
@@ -55,4 +77,44 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 		httputil.EncodeJSONResponse,
 		options...,
 	))
+
+	// GET     /v1/devices/udid/commands		List the commands queued for a device.
+	r.Methods("GET").Path("/v1/devices/{udid}/commands").Handler(httptransport.NewServer(
+		e.DeviceCommandsEndpoint,
+		decodeDeviceCommandsRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	// DELETE     /v1/devices/udid/commands/uuid		Remove a command from a device queue.
+	r.Methods("DELETE").Path("/v1/devices/{udid}/commands/{uuid}").Handler(httptransport.NewServer(
+		e.DeleteCommandEndpoint,
+		decodeDeleteCommandRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	// POST     /v1/devices/udid/lock		Lock a device with a generated PIN.
+	r.Methods("POST").Path("/v1/devices/{udid}/lock").Handler(httptransport.NewServer(
+		e.DeviceLockEndpoint,
+		decodeDeviceLockRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	// POST     /v1/devices/udid/erase		Erase a device.
+	r.Methods("POST").Path("/v1/devices/{udid}/erase").Handler(httptransport.NewServer(
+		e.EraseDeviceEndpoint,
+		decodeEraseDeviceRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	// GET     /v1/devices/udid/pin		Get the PIN of the last lock or erase command of a device.
+	r.Methods("GET").Path("/v1/devices/{udid}/pin").Handler(httptransport.NewServer(
+		e.DevicePINEndpoint,
+		decodeDevicePINRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
 }
@@ -4,32 +4,80 @@ package command
 import (
 	mdmsvc "github.com/micromdm/micromdm/mdm"
 	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/pkg/drain"
+	"github.com/micromdm/micromdm/platform/device"
 	"github.com/micromdm/micromdm/platform/pubsub"
 	"golang.org/x/net/context"
 )
 
 type Service interface {
-	NewCommand(context.Context, *mdm.CommandRequest) (*mdm.CommandPayload, error)
+	NewCommand(context.Context, *mdm.CommandRequest, ...CommandOption) (*mdm.CommandPayload, error)
 	NewRawCommand(context.Context, *RawCommand) error
+	QueueCommandToDevices(ctx context.Context, request *mdm.CommandRequest, udids []string, opts ...CommandOption) ([]QueueResult, error)
 	ClearQueue(ctx context.Context, udid string) error
 	ViewQueue(ctx context.Context, udid string) ([]*mdmsvc.Command, error)
+	DeviceCommands(ctx context.Context, udid string) ([]QueuedCommand, error)
+	DeleteCommand(ctx context.Context, udid, uuid string) error
+	QueueDeviceLock(ctx context.Context, udid, message, phoneNumber string) (pin string, err error)
+	QueueEraseDevice(ctx context.Context, udid, pin string) error
+	DevicePIN(ctx context.Context, udid string) (*DevicePIN, error)
 }
 
 // Queue is an MDM Command Queue.
 type Queue interface {
 	Clear(context.Context, mdmsvc.CheckinEvent) error
 	ViewQueue(context.Context, mdmsvc.CheckinEvent) ([]*mdmsvc.Command, error)
+	DeleteCommand(ctx context.Context, event mdmsvc.CheckinEvent, uuid string) error
+}
+
+// DeviceStore looks up enrolled devices.
+type DeviceStore interface {
+	DeviceByUDID(ctx context.Context, udid string) (*device.Device, error)
 }
 
 type CommandService struct {
 	publisher pubsub.Publisher
 	queue     Queue
+	devices   DeviceStore
+	pins      PINStore
+
+	idempotency *idempotencyCache
+	work        drain.Group
+	cancel      context.CancelFunc
+}
+
+type Option func(*CommandService)
+
+// WithDeviceStore rejects commands queued with QueueCommandToDevices for
+// devices which are not in store.
+func WithDeviceStore(store DeviceStore) Option {
+	return func(svc *CommandService) {
+		svc.devices = store
+	}
 }
 
-func New(pub pubsub.Publisher, queue Queue) (*CommandService, error) {
+func New(pub pubsub.Publisher, queue Queue, opts ...Option) (*CommandService, error) {
 	svc := CommandService{
-		publisher: pub,
-		queue:     queue,
+		publisher:   pub,
+		queue:       queue,
+		idempotency: newIdempotencyCache(DefaultIdempotencyWindow),
+	}
+	for _, opt := range opts {
+		opt(&svc)
+	}
+	if svc.idempotency.store != nil {
+		var ctx context.Context
+		ctx, svc.cancel = context.WithCancel(context.Background())
+		go svc.idempotency.sweep(ctx, idempotencySweepInterval)
 	}
 	return &svc, nil
 }
+
+// Shutdown rejects new commands with drain.ErrDraining, and waits for the
+// commands being created to be published.
+func (svc *CommandService) Shutdown(ctx context.Context) error {
+	if svc.cancel != nil {
+		defer svc.cancel()
+	}
+	return svc.work.Drain(ctx)
+}
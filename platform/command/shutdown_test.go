@@ -0,0 +1,64 @@
+package command_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micromdm/micromdm/pkg/drain"
+	"github.com/micromdm/micromdm/platform/command"
+)
+
+// blockingPublisher blocks every Publish until release is closed.
+type blockingPublisher struct {
+	mockPublisher
+	published chan struct{}
+	release   chan struct{}
+}
+
+func (p *blockingPublisher) Publish(ctx context.Context, topic string, msg []byte) error {
+	p.published <- struct{}{}
+	<-p.release
+	return p.mockPublisher.Publish(ctx, topic, msg)
+}
+
+func TestShutdown(t *testing.T) {
+	pub := &blockingPublisher{published: make(chan struct{}), release: make(chan struct{})}
+	svc, err := command.New(pub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := make(chan error, 1)
+	go func() {
+		_, err := svc.NewCommand(context.Background(), newTestRequest())
+		created <- err
+	}()
+	<-pub.published
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- svc.Shutdown(context.Background()) }()
+
+	// wait for Shutdown to reject new commands. An empty request fails
+	// before it is published if the service is still accepting commands.
+	for {
+		if _, err := svc.NewCommand(context.Background(), nil); err == drain.ErrDraining {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned with a command in flight: %v", err)
+	default:
+	}
+
+	close(pub.release)
+	if err := <-created; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+}
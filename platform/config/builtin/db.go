@@ -116,6 +116,10 @@ func (db *DB) PushCertificate() (*tls.Certificate, error) {
 		return nil, errors.Wrap(err, "parse push certificate from server config")
 	}
 
+	if err := crypto.MatchKeyPair(pushCert, priv); err != nil {
+		return nil, errors.Wrap(err, "push certificate does not match private key")
+	}
+
 	cert := tls.Certificate{
 		Certificate: [][]byte{pushCert.Raw},
 		PrivateKey:  priv,
@@ -5,6 +5,7 @@ import (
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 )
 
 type Endpoints struct {
@@ -16,10 +17,10 @@ type Endpoints struct {
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		SavePushCertificateEndpoint: endpoint.Chain(outer, others...)(MakeSavePushCertificateEndpoint(s)),
-		GetPushCertificateEndpoint:  endpoint.Chain(outer, others...)(MakeGetPushCertificateEndpoint(s)),
-		ApplyDEPTokensEndpoint:      endpoint.Chain(outer, others...)(MakeApplyDEPTokensEndpoint(s)),
-		GetDEPTokensEndpoint:        endpoint.Chain(outer, others...)(MakeGetDEPTokensEndpoint(s)),
+		SavePushCertificateEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.ServerAdmin)(MakeSavePushCertificateEndpoint(s))),
+		GetPushCertificateEndpoint:  endpoint.Chain(outer, others...)(scope.Require(scope.ServerRead)(MakeGetPushCertificateEndpoint(s))),
+		ApplyDEPTokensEndpoint:      endpoint.Chain(outer, others...)(scope.Require(scope.ServerAdmin)(MakeApplyDEPTokensEndpoint(s))),
+		GetDEPTokensEndpoint:        endpoint.Chain(outer, others...)(scope.Require(scope.ServerAdmin)(MakeGetDEPTokensEndpoint(s))),
 	}
 }
 
@@ -0,0 +1,90 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/platform/declaration"
+)
+
+const DeclarationBucket = "mdm.Declarations"
+
+// DB stores declarations which apply to every enrollment.
+type DB struct {
+	*bolt.DB
+}
+
+func NewDB(db *bolt.DB) (*DB, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(DeclarationBucket))
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating %s bucket", DeclarationBucket)
+	}
+	datastore := &DB{
+		DB: db,
+	}
+	return datastore, nil
+}
+
+// storedDeclaration keeps the UpdatedAt time, which is not part of the
+// JSON representation sent to devices.
+type storedDeclaration struct {
+	declaration.Declaration
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Save stores the declaration, replacing any declaration with the same Identifier.
+func (db *DB) Save(d *declaration.Declaration) error {
+	if err := d.Verify(); err != nil {
+		return err
+	}
+	if d.UpdatedAt.IsZero() {
+		d.UpdatedAt = time.Now().UTC()
+	}
+	v, err := json.Marshal(storedDeclaration{Declaration: *d, UpdatedAt: d.UpdatedAt})
+	if err != nil {
+		return errors.Wrap(err, "marshal declaration")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(DeclarationBucket)).Put([]byte(d.Identifier), v)
+	})
+	return errors.Wrapf(err, "save declaration %s", d.Identifier)
+}
+
+// Delete removes the declaration with identifier.
+func (db *DB) Delete(identifier string) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(DeclarationBucket)).Delete([]byte(identifier))
+	})
+	return errors.Wrapf(err, "delete declaration %s", identifier)
+}
+
+// List returns all declarations, ordered by Identifier.
+func (db *DB) List() ([]declaration.Declaration, error) {
+	var declarations []declaration.Declaration
+	err := db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(DeclarationBucket)).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var sd storedDeclaration
+			if err := json.Unmarshal(v, &sd); err != nil {
+				return errors.Wrapf(err, "unmarshal declaration %s", k)
+			}
+			sd.Declaration.UpdatedAt = sd.UpdatedAt
+			declarations = append(declarations, sd.Declaration)
+		}
+		return nil
+	})
+	return declarations, errors.Wrap(err, "list declarations")
+}
+
+// Declarations returns every declaration, as the declarations in DB are not
+// assigned to individual enrollments.
+func (db *DB) Declarations(ctx context.Context, id string) ([]declaration.Declaration, error) {
+	return db.List()
+}
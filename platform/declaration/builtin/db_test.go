@@ -0,0 +1,79 @@
+package builtin
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/micromdm/micromdm/platform/declaration"
+)
+
+func TestSaveDeclaration(t *testing.T) {
+	db := setupDB(t)
+
+	if err := db.Save(&declaration.Declaration{Identifier: "com.example", ServerToken: "1", Type: "com.example.unknown"}); err == nil {
+		t.Error("expected error for a declaration with an unknown Type")
+	}
+
+	d := &declaration.Declaration{
+		Identifier:  "com.example.passcode",
+		Type:        "com.apple.configuration.passcode.settings",
+		ServerToken: "1",
+		Payload:     []byte(`{"MinimumLength":6}`),
+	}
+	if err := db.Save(d); err != nil {
+		t.Fatal(err)
+	}
+	if d.UpdatedAt.IsZero() {
+		t.Error("Save did not set UpdatedAt")
+	}
+
+	declarations, err := db.Declarations(context.Background(), "UDID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(declarations), 1; have != want {
+		t.Fatalf("have %d declarations, want %d", have, want)
+	}
+	have := declarations[0]
+	if have.Identifier != d.Identifier || have.ServerToken != d.ServerToken || string(have.Payload) != string(d.Payload) {
+		t.Errorf("have %+v, want %+v", have, d)
+	}
+	if !have.UpdatedAt.Equal(d.UpdatedAt) {
+		t.Errorf("have UpdatedAt %s, want %s", have.UpdatedAt, d.UpdatedAt)
+	}
+
+	if err := db.Delete(d.Identifier); err != nil {
+		t.Fatal(err)
+	}
+	declarations, err = db.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(declarations) != 0 {
+		t.Errorf("have %d declarations after delete, want none", len(declarations))
+	}
+}
+
+func setupDB(t *testing.T) *DB {
+	f, _ := ioutil.TempFile("", "bolt-")
+	f.Close()
+	os.Remove(f.Name())
+
+	db, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatalf("couldn't open bolt, err %s\n", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(f.Name())
+	})
+	declarationDB, err := NewDB(db)
+	if err != nil {
+		t.Fatalf("couldn't create declaration DB, err %s\n", err)
+	}
+	return declarationDB
+}
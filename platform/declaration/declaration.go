@@ -0,0 +1,51 @@
+// Package declaration serves the Declarative Device Management protocol,
+// which devices use to fetch their declarations with DeclarativeManagement check-in messages.
+package declaration
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Declaration is a Declarative Device Management declaration.
+type Declaration struct {
+	Identifier  string          `json:"Identifier"`
+	Type        string          `json:"Type"`
+	ServerToken string          `json:"ServerToken"`
+	Payload     json.RawMessage `json:"Payload,omitempty"`
+	UpdatedAt   time.Time       `json:"-"`
+}
+
+// Declaration classes, which group the declarations in a declaration-items response.
+const (
+	ClassActivation    = "activation"
+	ClassAsset         = "asset"
+	ClassConfiguration = "configuration"
+	ClassManagement    = "management"
+)
+
+// Class returns the class of the declaration, which is the component of its
+// Type following "com.apple.", for example "configuration" for the
+// "com.apple.configuration.passcode.settings" Type.
+func (d *Declaration) Class() string {
+	class := strings.TrimPrefix(d.Type, "com.apple.")
+	if i := strings.Index(class, "."); i >= 0 {
+		class = class[:i]
+	}
+	return class
+}
+
+func (d *Declaration) Verify() error {
+	if d.Identifier == "" || d.ServerToken == "" {
+		return errors.New("Declaration must have Identifier and ServerToken")
+	}
+	switch d.Class() {
+	case ClassActivation, ClassAsset, ClassConfiguration, ClassManagement:
+		return nil
+	default:
+		return errors.New("Declaration Type must be a com.apple activation, asset, configuration or management type")
+	}
+}
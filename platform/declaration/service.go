@@ -0,0 +1,152 @@
+package declaration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Store returns the declarations for an enrollment.
+type Store interface {
+	// Declarations returns the declarations for the enrollment id, which is the
+	// EnrollmentID, UserID or UDID of the DeclarativeManagement check-in message.
+	Declarations(ctx context.Context, id string) ([]Declaration, error)
+}
+
+// Service handles DeclarativeManagement check-in messages with the declarations
+// from a Store. It implements the tokens and declaration-items endpoints of the
+// protocol. Status reports are accepted, but not stored.
+type Service struct {
+	store Store
+}
+
+func New(store Store) *Service {
+	return &Service{store: store}
+}
+
+// The endpoints of DeclarativeManagement check-in messages.
+const (
+	tokensEndpoint           = "tokens"
+	declarationItemsEndpoint = "declaration-items"
+	statusEndpoint           = "status"
+)
+
+// DeclarativeManagement returns the JSON response to a DeclarativeManagement
+// check-in message from the enrollment id.
+func (svc *Service) DeclarativeManagement(ctx context.Context, id, endpoint string, data []byte) ([]byte, error) {
+	switch endpoint {
+	case tokensEndpoint:
+		declarations, err := svc.declarations(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(newTokensResponse(declarations))
+	case declarationItemsEndpoint:
+		declarations, err := svc.declarations(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(newDeclarationItemsResponse(declarations))
+	case statusEndpoint:
+		return nil, nil
+	default:
+		return nil, errors.Errorf("unsupported declarative management endpoint %q", endpoint)
+	}
+}
+
+// declarations returns the declarations for id ordered by Identifier,
+// so that the DeclarationsToken does not depend on the order of the Store.
+func (svc *Service) declarations(ctx context.Context, id string) ([]Declaration, error) {
+	declarations, err := svc.store.Declarations(ctx, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get declarations for %s", id)
+	}
+	sort.Slice(declarations, func(i, j int) bool {
+		return declarations[i].Identifier < declarations[j].Identifier
+	})
+	return declarations, nil
+}
+
+// DeclarationsToken returns a token which changes whenever a declaration is
+// added, removed or changes its ServerToken.
+func DeclarationsToken(declarations []Declaration) string {
+	h := sha256.New()
+	for _, d := range declarations {
+		fmt.Fprintf(h, "%s\x00%s\x00", d.Identifier, d.ServerToken)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+type syncTokens struct {
+	DeclarationsToken string `json:"DeclarationsToken"`
+	Timestamp         string `json:"Timestamp"`
+}
+
+type tokensResponse struct {
+	SyncTokens syncTokens `json:"SyncTokens"`
+}
+
+func newTokensResponse(declarations []Declaration) tokensResponse {
+	var updated time.Time
+	for _, d := range declarations {
+		if d.UpdatedAt.After(updated) {
+			updated = d.UpdatedAt
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+	return tokensResponse{SyncTokens: syncTokens{
+		DeclarationsToken: DeclarationsToken(declarations),
+		Timestamp:         updated.UTC().Format(time.RFC3339),
+	}}
+}
+
+type declarationItem struct {
+	Identifier  string `json:"Identifier"`
+	ServerToken string `json:"ServerToken"`
+}
+
+type declarationItems struct {
+	Activations    []declarationItem `json:"Activations"`
+	Assets         []declarationItem `json:"Assets"`
+	Configurations []declarationItem `json:"Configurations"`
+	Management     []declarationItem `json:"Management"`
+}
+
+type declarationItemsResponse struct {
+	Declarations      declarationItems `json:"Declarations"`
+	DeclarationsToken string           `json:"DeclarationsToken"`
+}
+
+func newDeclarationItemsResponse(declarations []Declaration) declarationItemsResponse {
+	// every class is sent, even if it is empty.
+	items := declarationItems{
+		Activations:    []declarationItem{},
+		Assets:         []declarationItem{},
+		Configurations: []declarationItem{},
+		Management:     []declarationItem{},
+	}
+	for _, d := range declarations {
+		item := declarationItem{Identifier: d.Identifier, ServerToken: d.ServerToken}
+		switch d.Class() {
+		case ClassActivation:
+			items.Activations = append(items.Activations, item)
+		case ClassAsset:
+			items.Assets = append(items.Assets, item)
+		case ClassConfiguration:
+			items.Configurations = append(items.Configurations, item)
+		case ClassManagement:
+			items.Management = append(items.Management, item)
+		}
+	}
+	return declarationItemsResponse{
+		Declarations:      items,
+		DeclarationsToken: DeclarationsToken(declarations),
+	}
+}
@@ -0,0 +1,136 @@
+package declaration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type mockStore struct {
+	declarations map[string][]Declaration
+}
+
+func (s *mockStore) Declarations(ctx context.Context, id string) ([]Declaration, error) {
+	return append([]Declaration{}, s.declarations[id]...), nil
+}
+
+func testDeclarations() []Declaration {
+	updated := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []Declaration{
+		{Identifier: "com.example.passcode", Type: "com.apple.configuration.passcode.settings", ServerToken: "1", UpdatedAt: updated},
+		{Identifier: "com.example.activation", Type: "com.apple.activation.simple", ServerToken: "2", UpdatedAt: updated.Add(-time.Hour)},
+		{Identifier: "com.example.org", Type: "com.apple.management.organization-info", ServerToken: "3"},
+	}
+}
+
+func TestTokens(t *testing.T) {
+	store := &mockStore{declarations: map[string][]Declaration{"UDID-1": testDeclarations()}}
+	svc := New(store)
+
+	resp, err := svc.DeclarativeManagement(context.Background(), "UDID-1", "tokens", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokens tokensResponse
+	if err := json.Unmarshal(resp, &tokens); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := tokens.SyncTokens.Timestamp, "2023-01-02T03:04:05Z"; have != want {
+		t.Errorf("have Timestamp %s, want %s", have, want)
+	}
+	token := tokens.SyncTokens.DeclarationsToken
+	if token == "" {
+		t.Fatal("missing DeclarationsToken")
+	}
+
+	// the token does not depend on the order of the declarations,
+	// but changes with their ServerTokens.
+	reversed := testDeclarations()
+	reversed[0], reversed[2] = reversed[2], reversed[0]
+	store.declarations["UDID-2"] = reversed
+	if have := tokenFor(t, svc, "UDID-2"); have != token {
+		t.Errorf("have DeclarationsToken %s for reordered declarations, want %s", have, token)
+	}
+	reversed[1].ServerToken = "changed"
+	if have := tokenFor(t, svc, "UDID-2"); have == token {
+		t.Error("DeclarationsToken did not change with a ServerToken")
+	}
+	if have := tokenFor(t, svc, "UNKNOWN"); have == token {
+		t.Error("have the same DeclarationsToken for an enrollment without declarations")
+	}
+}
+
+func tokenFor(t *testing.T, svc *Service, id string) string {
+	t.Helper()
+	resp, err := svc.DeclarativeManagement(context.Background(), id, "tokens", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokens tokensResponse
+	if err := json.Unmarshal(resp, &tokens); err != nil {
+		t.Fatal(err)
+	}
+	return tokens.SyncTokens.DeclarationsToken
+}
+
+func TestDeclarationItems(t *testing.T) {
+	store := &mockStore{declarations: map[string][]Declaration{"UDID-1": testDeclarations()}}
+	svc := New(store)
+
+	resp, err := svc.DeclarativeManagement(context.Background(), "UDID-1", "declaration-items", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items declarationItemsResponse
+	if err := json.Unmarshal(resp, &items); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := items.DeclarationsToken, tokenFor(t, svc, "UDID-1"); have != want {
+		t.Errorf("have DeclarationsToken %s, want the tokens endpoint token %s", have, want)
+	}
+	for class, test := range map[string]struct {
+		have []declarationItem
+		want []declarationItem
+	}{
+		"Activations":    {items.Declarations.Activations, []declarationItem{{"com.example.activation", "2"}}},
+		"Assets":         {items.Declarations.Assets, []declarationItem{}},
+		"Configurations": {items.Declarations.Configurations, []declarationItem{{"com.example.passcode", "1"}}},
+		"Management":     {items.Declarations.Management, []declarationItem{{"com.example.org", "3"}}},
+	} {
+		if len(test.have) != len(test.want) {
+			t.Errorf("%s: have %v, want %v", class, test.have, test.want)
+			continue
+		}
+		for i := range test.want {
+			if test.have[i] != test.want[i] {
+				t.Errorf("%s: have %v, want %v", class, test.have, test.want)
+			}
+		}
+	}
+
+	// empty classes are sent as empty arrays.
+	resp, err = svc.DeclarativeManagement(context.Background(), "UNKNOWN", "declaration-items", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Declarations map[string]json.RawMessage
+	}
+	if err := json.Unmarshal(resp, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if have := string(raw.Declarations["Assets"]); have != "[]" {
+		t.Errorf("have Assets %s, want []", have)
+	}
+}
+
+func TestUnsupportedEndpoint(t *testing.T) {
+	svc := New(&mockStore{})
+	if _, err := svc.DeclarativeManagement(context.Background(), "UDID-1", "declaration/configuration/com.example", nil); err == nil {
+		t.Error("expected error for unsupported endpoint")
+	}
+	if _, err := svc.DeclarativeManagement(context.Background(), "UDID-1", "status", []byte(`{}`)); err != nil {
+		t.Errorf("status report: %s", err)
+	}
+}
@@ -2,23 +2,35 @@ package dep
 
 import (
 	"context"
-	"errors"
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
 
 	"github.com/micromdm/micromdm/dep"
 	"github.com/micromdm/micromdm/pkg/httputil"
 )
 
-func (svc *DEPService) AssignProfile(ctx context.Context, id string, serials ...string) (*dep.ProfileResponse, error) {
-	if svc.client == nil {
-		return nil, errors.New("DEP not configured yet. add a DEP token to enable DEP")
+// AssignProfile assigns the DEP profile with id to the serials, using the DEP token
+// with the consumer key token, or the most recently added token if token is empty.
+// The result for each serial is one of the dep.ProfileResult values.
+func (svc *DEPService) AssignProfile(ctx context.Context, token, id string, serials []string) (*dep.ProfileResponse, error) {
+	client, err := svc.clientFor(token)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.AssignProfile(id, serials...)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.recordProfileStatus(ctx, id, resp.Devices); err != nil {
+		return resp, errors.Wrap(err, "recording DEP profile assignment")
 	}
-	return svc.client.AssignProfile(id, serials...)
+	return resp, nil
 }
 
 type assignProfileRequest struct {
+	Token   string   `json:"token,omitempty"`
 	ID      string   `json:"id"`
 	Serials []string `json:"serials"`
 }
@@ -45,7 +57,7 @@ func decodeAssignProfileResponse(_ context.Context, r *http.Response) (interface
 func MakeAssignProfileEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(assignProfileRequest)
-		resp, err := svc.AssignProfile(ctx, req.ID, req.Serials...)
+		resp, err := svc.AssignProfile(ctx, req.Token, req.ID, req.Serials)
 		return &assignProfileResponse{
 			ProfileResponse: resp,
 			Err:             err,
@@ -53,8 +65,8 @@ func MakeAssignProfileEndpoint(svc Service) endpoint.Endpoint {
 	}
 }
 
-func (e Endpoints) AssignProfile(ctx context.Context, id string, serials ...string) (*dep.ProfileResponse, error) {
-	request := assignProfileRequest{ID: id, Serials: serials}
+func (e Endpoints) AssignProfile(ctx context.Context, token, id string, serials []string) (*dep.ProfileResponse, error) {
+	request := assignProfileRequest{Token: token, ID: id, Serials: serials}
 	resp, err := e.AssignProfileEndpoint(ctx, request)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,84 @@
+package dep
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/dep"
+	"github.com/micromdm/micromdm/platform/device"
+)
+
+var errNotConfigured = errors.New("DEP not configured yet. add a DEP token to enable DEP")
+
+// clientFor returns the client of the DEP token with consumerKey, or the
+// client of the most recently added token if consumerKey is empty.
+func (svc *DEPService) clientFor(consumerKey string) (DEPClient, error) {
+	svc.mtx.RLock()
+	defer svc.mtx.RUnlock()
+	if consumerKey == "" {
+		if svc.client == nil {
+			return nil, errNotConfigured
+		}
+		return svc.client, nil
+	}
+	client, ok := svc.clients[consumerKey]
+	if !ok {
+		return nil, errors.Errorf("unknown DEP token %s", consumerKey)
+	}
+	return client, nil
+}
+
+// recordProfileStatus updates the DEP profile of every device which Apple
+// reports as successfully assigned to profileUUID, or removed from its
+// profile if profileUUID is empty. Devices with a NOT_ACCESSIBLE or FAILED
+// result are recorded with that result and keep their previous profile UUID.
+// Serials which have not been synced yet are skipped.
+func (svc *DEPService) recordProfileStatus(ctx context.Context, profileUUID string, results map[string]string) error {
+	if svc.devices == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	for serial, result := range results {
+		var failedStatus device.DEPProfileStatus
+		switch result {
+		case dep.ProfileResultSuccess:
+		case dep.ProfileResultNotAccessible:
+			failedStatus = device.NOT_ACCESSIBLE
+		case dep.ProfileResultFailed:
+			failedStatus = device.FAILED
+		default:
+			continue
+		}
+		dev, err := svc.devices.DeviceBySerial(ctx, serial)
+		if isNotFound(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "find device with serial %s", serial)
+		}
+		if failedStatus != "" {
+			dev.DEPProfileStatus = failedStatus
+		} else if profileUUID == "" {
+			dev.DEPProfileStatus = device.REMOVED
+			dev.DEPProfileUUID = ""
+		} else {
+			dev.DEPProfileStatus = device.ASSIGNED
+			dev.DEPProfileUUID = profileUUID
+			dev.DEPProfileAssignTime = now
+		}
+		if err := svc.devices.Save(ctx, dev); err != nil {
+			return errors.Wrapf(err, "save DEP profile status of device %s", serial)
+		}
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	type notFoundErr interface {
+		error
+		NotFound() bool
+	}
+	e, ok := errors.Cause(err).(notFoundErr)
+	return ok && e.NotFound()
+}
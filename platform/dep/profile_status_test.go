@@ -0,0 +1,141 @@
+package dep
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/micromdm/micromdm/dep"
+	"github.com/micromdm/micromdm/platform/device"
+)
+
+type notFoundErr struct{}
+
+func (notFoundErr) Error() string  { return "not found" }
+func (notFoundErr) NotFound() bool { return true }
+
+type mockDeviceStore map[string]*device.Device
+
+func (s mockDeviceStore) DeviceBySerial(ctx context.Context, serial string) (*device.Device, error) {
+	dev, ok := s[serial]
+	if !ok {
+		return nil, notFoundErr{}
+	}
+	d := *dev
+	return &d, nil
+}
+
+func (s mockDeviceStore) Save(ctx context.Context, dev *device.Device) error {
+	s[dev.SerialNumber] = dev
+	return nil
+}
+
+// fakeDEP returns the results for the serials of profile assignments and removals.
+func fakeDEP(t *testing.T, results map[string]string) *dep.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/session":
+			json.NewEncoder(w).Encode(map[string]string{"auth_session_token": "session"})
+		case "/profile/devices":
+			var req struct {
+				ProfileUUID string   `json:"profile_uuid"`
+				Devices     []string `json:"devices"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			resp := dep.ProfileResponse{ProfileUUID: req.ProfileUUID, Devices: make(map[string]string)}
+			for _, serial := range req.Devices {
+				resp.Devices[serial] = results[serial]
+			}
+			json.NewEncoder(w).Encode(resp)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return dep.NewClient(dep.OAuthParameters{}, dep.WithServerURL(u))
+}
+
+func TestAssignAndRemoveProfile(t *testing.T) {
+	results := map[string]string{
+		"SUCCESS1": dep.ProfileResultSuccess,
+		"NOACCESS": dep.ProfileResultNotAccessible,
+		"FAILED1":  dep.ProfileResultFailed,
+		"UNSYNCED": dep.ProfileResultSuccess,
+	}
+	devices := mockDeviceStore{
+		"SUCCESS1": {SerialNumber: "SUCCESS1", DEPProfileStatus: device.EMPTY},
+		"NOACCESS": {SerialNumber: "NOACCESS", DEPProfileStatus: device.EMPTY},
+		"FAILED1":  {SerialNumber: "FAILED1", DEPProfileStatus: device.ASSIGNED, DEPProfileUUID: "old"},
+	}
+	svc := New(nil, nil, WithTokenClient("CK_A", fakeDEP(t, results)), WithDeviceStore(devices))
+	serials := []string{"SUCCESS1", "NOACCESS", "FAILED1", "UNSYNCED"}
+
+	resp, err := svc.AssignProfile(context.Background(), "CK_A", "profile", serials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for serial, want := range results {
+		if have := resp.Devices[serial]; have != want {
+			t.Errorf("%s: have result %q, want %q", serial, have, want)
+		}
+	}
+	if dev := devices["SUCCESS1"]; dev.DEPProfileStatus != device.ASSIGNED || dev.DEPProfileUUID != "profile" || dev.DEPProfileAssignTime.IsZero() {
+		t.Errorf("assigned device not recorded: %+v", dev)
+	}
+	if dev := devices["NOACCESS"]; dev.DEPProfileStatus != device.NOT_ACCESSIBLE || dev.DEPProfileUUID != "" {
+		t.Errorf("NOT_ACCESSIBLE device not recorded: %+v", dev)
+	}
+	if dev := devices["FAILED1"]; dev.DEPProfileStatus != device.FAILED || dev.DEPProfileUUID != "old" {
+		t.Errorf("FAILED device not recorded: %+v", dev)
+	}
+	if _, ok := devices["UNSYNCED"]; ok {
+		t.Error("recorded a device which was not synced")
+	}
+
+	if _, err := svc.RemoveProfile(context.Background(), "CK_A", serials); err != nil {
+		t.Fatal(err)
+	}
+	if dev := devices["SUCCESS1"]; dev.DEPProfileStatus != device.REMOVED || dev.DEPProfileUUID != "" {
+		t.Errorf("removed device not recorded: %+v", dev)
+	}
+	if dev := devices["NOACCESS"]; dev.DEPProfileStatus != device.NOT_ACCESSIBLE {
+		t.Errorf("NOT_ACCESSIBLE device has status %s", dev.DEPProfileStatus)
+	}
+	if dev := devices["FAILED1"]; dev.DEPProfileStatus != device.FAILED || dev.DEPProfileUUID != "old" {
+		t.Errorf("FAILED device not recorded: %+v", dev)
+	}
+}
+
+func TestAssignProfileToken(t *testing.T) {
+	devices := mockDeviceStore{"SERIAL": {SerialNumber: "SERIAL"}}
+	defaultClient := fakeDEP(t, map[string]string{"SERIAL": dep.ProfileResultNotAccessible})
+	svc := New(defaultClient, nil,
+		WithTokenClient("CK_B", fakeDEP(t, map[string]string{"SERIAL": dep.ProfileResultSuccess})),
+		WithDeviceStore(devices),
+	)
+
+	resp, err := svc.AssignProfile(context.Background(), "", "profile", []string{"SERIAL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := resp.Devices["SERIAL"]; have != dep.ProfileResultNotAccessible {
+		t.Errorf("default token: have result %q", have)
+	}
+	resp, err = svc.AssignProfile(context.Background(), "CK_B", "profile", []string{"SERIAL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := resp.Devices["SERIAL"]; have != dep.ProfileResultSuccess {
+		t.Errorf("token CK_B: have result %q", have)
+	}
+	if _, err := svc.AssignProfile(context.Background(), "CK_UNKNOWN", "profile", []string{"SERIAL"}); err == nil {
+		t.Error("expected error for an unknown token")
+	}
+}
@@ -2,23 +2,35 @@ package dep
 
 import (
 	"context"
-	"errors"
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
 
 	// "github.com/micromdm/micromdm/dep"
 	"github.com/micromdm/micromdm/pkg/httputil"
 )
 
-func (svc *DEPService) RemoveProfile(ctx context.Context, serials ...string) (map[string]string, error) {
-	if svc.client == nil {
-		return nil, errors.New("DEP not configured yet. add a DEP token to enable DEP")
+// RemoveProfile clears the DEP profile of the serials, using the DEP token
+// with the consumer key token, or the most recently added token if token is empty.
+// The result for each serial is one of the dep.ProfileResult values.
+func (svc *DEPService) RemoveProfile(ctx context.Context, token string, serials []string) (map[string]string, error) {
+	client, err := svc.clientFor(token)
+	if err != nil {
+		return nil, err
+	}
+	results, err := client.RemoveProfile(serials...)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.recordProfileStatus(ctx, "", results); err != nil {
+		return results, errors.Wrap(err, "recording DEP profile removal")
 	}
-	return svc.client.RemoveProfile(serials...)
+	return results, nil
 }
 
 type removeProfileRequest struct {
+	Token   string   `json:"token,omitempty"`
 	Serials []string `json:"serials"`
 }
 
@@ -44,7 +56,7 @@ func decodeRemoveProfileResponse(_ context.Context, r *http.Response) (interface
 func MakeRemoveProfileEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(removeProfileRequest)
-		resp, err := svc.RemoveProfile(ctx, req.Serials...)
+		resp, err := svc.RemoveProfile(ctx, req.Token, req.Serials)
 		return &removeProfileResponse{
 			Serials: resp,
 			Err:     err,
@@ -52,8 +64,8 @@ func MakeRemoveProfileEndpoint(svc Service) endpoint.Endpoint {
 	}
 }
 
-func (e Endpoints) RemoveProfile(ctx context.Context, serials ...string) (map[string]string, error) {
-	request := removeProfileRequest{Serials: serials}
+func (e Endpoints) RemoveProfile(ctx context.Context, token string, serials []string) (map[string]string, error) {
+	request := removeProfileRequest{Token: token, Serials: serials}
 	resp, err := e.RemoveProfileEndpoint(ctx, request)
 	if err != nil {
 		return nil, err
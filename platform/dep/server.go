@@ -6,6 +6,7 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 )
 
 type Endpoints struct {
@@ -19,12 +20,12 @@ type Endpoints struct {
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		AssignProfileEndpoint:    endpoint.Chain(outer, others...)(MakeAssignProfileEndpoint(s)),
-		RemoveProfileEndpoint:    endpoint.Chain(outer, others...)(MakeRemoveProfileEndpoint(s)),
-		DefineProfileEndpoint:    endpoint.Chain(outer, others...)(MakeDefineProfileEndpoint(s)),
-		FetchProfileEndpoint:     endpoint.Chain(outer, others...)(MakeFetchProfileEndpoint(s)),
-		GetAccountInfoEndpoint:   endpoint.Chain(outer, others...)(MakeGetAccountInfoEndpoint(s)),
-		GetDeviceDetailsEndpoint: endpoint.Chain(outer, others...)(MakeGetDeviceDetailsEndpoint(s)),
+		AssignProfileEndpoint:    endpoint.Chain(outer, others...)(scope.Require(scope.DEPAdmin)(MakeAssignProfileEndpoint(s))),
+		RemoveProfileEndpoint:    endpoint.Chain(outer, others...)(scope.Require(scope.DEPAdmin)(MakeRemoveProfileEndpoint(s))),
+		DefineProfileEndpoint:    endpoint.Chain(outer, others...)(scope.Require(scope.DEPAdmin)(MakeDefineProfileEndpoint(s))),
+		FetchProfileEndpoint:     endpoint.Chain(outer, others...)(scope.Require(scope.DEPRead)(MakeFetchProfileEndpoint(s))),
+		GetAccountInfoEndpoint:   endpoint.Chain(outer, others...)(scope.Require(scope.DEPRead)(MakeGetAccountInfoEndpoint(s))),
+		GetDeviceDetailsEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.DEPRead)(MakeGetDeviceDetailsEndpoint(s))),
 	}
 }
 
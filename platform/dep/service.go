@@ -5,13 +5,14 @@ import (
 	"sync"
 
 	"github.com/micromdm/micromdm/dep"
+	"github.com/micromdm/micromdm/platform/device"
 	"github.com/micromdm/micromdm/platform/pubsub"
 )
 
 type Service interface {
 	DefineProfile(ctx context.Context, p *dep.Profile) (*dep.ProfileResponse, error)
-	AssignProfile(ctx context.Context, uuid string, serials ...string) (*dep.ProfileResponse, error)
-	RemoveProfile(ctx context.Context, serials ...string) (map[string]string, error)
+	AssignProfile(ctx context.Context, token, uuid string, serials []string) (*dep.ProfileResponse, error)
+	RemoveProfile(ctx context.Context, token string, serials []string) (map[string]string, error)
 	GetAccountInfo(ctx context.Context) (*dep.Account, error)
 	GetDeviceDetails(ctx context.Context, serials []string) (*dep.DeviceDetailsResponse, error)
 	FetchProfile(ctx context.Context, uuid string) (*dep.Profile, error)
@@ -26,16 +27,50 @@ type DEPClient interface {
 	DeviceDetails(...string) (*dep.DeviceDetailsResponse, error)
 }
 
+// DeviceStore records the DEP profile status of devices.
+type DeviceStore interface {
+	DeviceBySerial(ctx context.Context, serial string) (*device.Device, error)
+	Save(ctx context.Context, dev *device.Device) error
+}
+
 type DEPService struct {
 	mtx        sync.RWMutex
 	client     DEPClient
+	clients    map[string]DEPClient
 	subscriber pubsub.Subscriber
+	devices    DeviceStore
+}
+
+type Option func(*DEPService)
+
+// WithTokenClient adds the client for the DEP token with consumerKey, which
+// is used when a request names the token.
+func WithTokenClient(consumerKey string, client DEPClient) Option {
+	return func(svc *DEPService) {
+		svc.clients[consumerKey] = client
+	}
+}
+
+// WithDeviceStore records the result of profile assignments and removals
+// on the devices in store.
+func WithDeviceStore(store DeviceStore) Option {
+	return func(svc *DEPService) {
+		svc.devices = store
+	}
 }
 
 func (svc *DEPService) Run() error {
 	return svc.watchTokenUpdates(svc.subscriber)
 }
 
-func New(client DEPClient, subscriber pubsub.Subscriber) *DEPService {
-	return &DEPService{client: client, subscriber: subscriber}
+func New(client DEPClient, subscriber pubsub.Subscriber, opts ...Option) *DEPService {
+	svc := DEPService{
+		client:     client,
+		clients:    make(map[string]DEPClient),
+		subscriber: subscriber,
+	}
+	for _, opt := range opts {
+		opt(&svc)
+	}
+	return &svc
 }
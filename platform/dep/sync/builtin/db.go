@@ -12,6 +12,9 @@ import (
 const (
 	ConfigBucket     = "mdm.DEPConfig"
 	AutoAssignBucket = "mdm.DEPAutoAssign"
+
+	configKey         = "configuration"
+	tokenCursorPrefix = "cursor."
 )
 
 type DB struct {
@@ -35,12 +38,30 @@ func NewDB(db *bolt.DB) (*DB, error) {
 }
 
 func (db *DB) LoadCursor() (*sync.Cursor, error) {
+	return db.loadCursor(configKey)
+}
+
+func (db *DB) SaveCursor(c sync.Cursor) error {
+	return db.saveCursor(configKey, c)
+}
+
+// LoadTokenCursor loads the cursor of the DEP token with consumerKey.
+func (db *DB) LoadTokenCursor(consumerKey string) (*sync.Cursor, error) {
+	return db.loadCursor(tokenCursorPrefix + consumerKey)
+}
+
+// SaveTokenCursor saves the cursor of the DEP token with consumerKey.
+func (db *DB) SaveTokenCursor(consumerKey string, c sync.Cursor) error {
+	return db.saveCursor(tokenCursorPrefix+consumerKey, c)
+}
+
+func (db *DB) loadCursor(key string) (*sync.Cursor, error) {
 	var cursor = struct {
 		Cursor sync.Cursor `json:"cursor"`
 	}{}
 	err := db.View(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket([]byte(ConfigBucket))
-		v := bkt.Get([]byte("configuration"))
+		v := bkt.Get([]byte(key))
 		if v == nil {
 			return nil // TODO add notfound
 		}
@@ -53,7 +74,7 @@ func (db *DB) LoadCursor() (*sync.Cursor, error) {
 	return &cursor.Cursor, nil
 }
 
-func (db *DB) SaveCursor(c sync.Cursor) error {
+func (db *DB) saveCursor(key string, c sync.Cursor) error {
 	err := db.Update(func(tx *bolt.Tx) error {
 		bkt, err := tx.CreateBucketIfNotExists([]byte(ConfigBucket))
 		if err != nil {
@@ -67,7 +88,7 @@ func (db *DB) SaveCursor(c sync.Cursor) error {
 		if err != nil {
 			return err
 		}
-		return bkt.Put([]byte("configuration"), v)
+		return bkt.Put([]byte(key), v)
 	})
 	return errors.Wrap(err, "saving dep sync cursor")
 }
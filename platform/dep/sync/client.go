@@ -27,6 +27,17 @@ func NewHTTPClient(instance, token string, logger log.Logger, opts ...httptransp
 		).Endpoint()
 	}
 
+	var resetCursorEndpoint endpoint.Endpoint
+	{
+		resetCursorEndpoint = httptransport.NewClient(
+			"POST",
+			httputil.CopyURL(u, "/v1/dep/resetcursor"),
+			httputil.EncodeRequestWithToken(token, httputil.EncodeEmptyRequest),
+			decodeResetCursorResponse,
+			opts...,
+		).Endpoint()
+	}
+
 	var applyAutoAssignerEndpoint endpoint.Endpoint
 	{
 		applyAutoAssignerEndpoint = httptransport.NewClient(
@@ -62,6 +73,7 @@ func NewHTTPClient(instance, token string, logger log.Logger, opts ...httptransp
 
 	return Endpoints{
 		SyncNowEndpoint:            syncNowEndpoint,
+		ResetCursorEndpoint:        resetCursorEndpoint,
 		ApplyAutoAssignerEndpoint:  applyAutoAssignerEndpoint,
 		GetAutoAssignersEndpoint:   getAutoAssignersEndpoint,
 		RemoveAutoAssignerEndpoint: removeAutoAssignerEndpoint,
@@ -24,7 +24,10 @@ const (
 	cursorValidDuration = 7 * 24 * time.Hour
 )
 
-type Syncer interface{ SyncNow() }
+type Syncer interface {
+	SyncNow()
+	ResetCursor() error
+}
 
 type WatcherDB interface {
 	LoadCursor() (*Cursor, error)
@@ -36,22 +39,37 @@ type Watcher struct {
 	mtx    sync.RWMutex
 	logger log.Logger
 	client Client
+	token  string
 
-	publisher pubsub.Publisher
-	db        WatcherDB
-	startSync chan bool
-	syncNow   chan bool
+	publisher   pubsub.Publisher
+	db          WatcherDB
+	startSync   chan bool
+	syncNow     chan bool
+	resetCursor chan bool
 
 	cursor Cursor
 }
 
 func NewWatcher(db WatcherDB, pub pubsub.PublishSubscriber, opts ...Option) (*Watcher, error) {
+	w, err := newWatcher(db, pub, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.updateClient(pub); err != nil {
+		return nil, err
+	}
+	w.start()
+	return w, nil
+}
+
+func newWatcher(db WatcherDB, pub pubsub.Publisher, opts ...Option) (*Watcher, error) {
 	w := Watcher{
-		logger:    log.NewNopLogger(),
-		db:        db,
-		publisher: pub,
-		startSync: make(chan bool),
-		syncNow:   make(chan bool),
+		logger:      log.NewNopLogger(),
+		db:          db,
+		publisher:   pub,
+		startSync:   make(chan bool),
+		syncNow:     make(chan bool),
+		resetCursor: make(chan bool, 1),
 	}
 	for _, optFn := range opts {
 		optFn(&w)
@@ -65,13 +83,13 @@ func NewWatcher(db WatcherDB, pub pubsub.PublishSubscriber, opts ...Option) (*Wa
 		level.Debug(w.logger).Log("msg", "loaded DEP config", "cursor", cursor.Value)
 		w.cursor = *cursor
 	}
+	return &w, nil
+}
 
-	if err := w.updateClient(pub); err != nil {
-		return nil, err
-	}
-
+// start runs the sync loop in a goroutine, once the Watcher has a DEP client.
+func (w *Watcher) start() {
 	saveCursor := func() {
-		if err := db.SaveCursor(w.cursor); err != nil {
+		if err := w.db.SaveCursor(w.cursor); err != nil {
 			level.Info(w.logger).Log("err", err, "msg", "saving cursor")
 			return
 		}
@@ -90,8 +108,6 @@ func NewWatcher(db WatcherDB, pub pubsub.PublishSubscriber, opts ...Option) (*Wa
 		// unconditionally anyway so we never silently stop watching
 		level.Info(w.logger).Log("err", err, "msg", "DEP watcher stopped")
 	}()
-
-	return &w, nil
 }
 
 type Client interface {
@@ -222,9 +238,9 @@ func (w *Watcher) processAutoAssign(devices []dep.Device) error {
 		}
 		// count our results for logging
 		resultCounts := map[string]int{
-			"SUCCESS":        0,
-			"NOT_ACCESSIBLE": 0,
-			"FAILED":         0,
+			dep.ProfileResultSuccess:       0,
+			dep.ProfileResultNotAccessible: 0,
+			dep.ProfileResultFailed:        0,
 		}
 		for _, result := range resp.Devices {
 			if ct, ok := resultCounts[result]; ok {
@@ -237,9 +253,9 @@ func (w *Watcher) processAutoAssign(devices []dep.Device) error {
 		level.Info(w.logger).Log(
 			"msg", "DEP auto-assigned",
 			"profile", profileUUID,
-			"success", resultCounts["SUCCESS"],
-			"not_accessible", resultCounts["NOT_ACCESSIBLE"],
-			"failed", resultCounts["FAILED"],
+			"success", resultCounts[dep.ProfileResultSuccess],
+			"not_accessible", resultCounts[dep.ProfileResultNotAccessible],
+			"failed", resultCounts[dep.ProfileResultFailed],
 		)
 	}
 
@@ -248,6 +264,7 @@ func (w *Watcher) processAutoAssign(devices []dep.Device) error {
 
 func (w *Watcher) publishAndProcessDevices(devices []dep.Device) error {
 	e := NewEvent(devices)
+	e.Token = w.token
 	data, err := MarshalEvent(e)
 	if err != nil {
 		return err
@@ -306,7 +323,13 @@ func (w *Watcher) Run() error {
 				"cursor", w.cursor.Value,
 				"err", err,
 			)
-			w.cursor.Value = ""
+			reason := CursorResetInvalid
+			if isCursorExpired(err) {
+				reason = CursorResetExpired
+			}
+			if err := w.clearCursor(reason); err != nil {
+				return err
+			}
 			fetchNext = true
 			continue
 		} else if err != nil {
@@ -348,6 +371,12 @@ func (w *Watcher) Run() error {
 		case <-ticker:
 		case <-w.syncNow:
 			level.Info(w.logger).Log("msg", "explicit DEP sync requested")
+		case <-w.resetCursor:
+			level.Info(w.logger).Log("msg", "explicit DEP cursor reset requested")
+			if err := w.clearCursor(CursorResetRequested); err != nil {
+				return err
+			}
+			fetchNext = true
 		}
 	}
 }
@@ -0,0 +1,222 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/micromdm/micromdm/dep"
+	"github.com/micromdm/micromdm/platform/pubsub"
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+)
+
+type mockWatcherDB struct {
+	mu     gosync.Mutex
+	cursor Cursor
+}
+
+func (db *mockWatcherDB) LoadCursor() (*Cursor, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	c := db.cursor
+	return &c, nil
+}
+
+func (db *mockWatcherDB) SaveCursor(c Cursor) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.cursor = c
+	return nil
+}
+
+func (db *mockWatcherDB) LoadAutoAssigners() ([]AutoAssigner, error) { return nil, nil }
+
+// fakeDEP is a DEP API server which rejects the stale cursor as expired.
+type fakeDEP struct {
+	mu            gosync.Mutex
+	fetchCursors  []string
+	staleCursor   string
+	fetchedCursor string
+	devices       []dep.Device
+}
+
+func (f *fakeDEP) fetches() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.fetchCursors...)
+}
+
+func (f *fakeDEP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Cursor string `json:"cursor"`
+	}
+	if r.URL.Path != "/session" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	switch r.URL.Path {
+	case "/session":
+		json.NewEncoder(w).Encode(map[string]string{"auth_session_token": "session"})
+	case "/server/devices":
+		f.mu.Lock()
+		f.fetchCursors = append(f.fetchCursors, req.Cursor)
+		f.mu.Unlock()
+		if f.staleCursor != "" && req.Cursor == f.staleCursor {
+			http.Error(w, "EXPIRED_CURSOR", http.StatusBadRequest)
+			return
+		}
+		devices := f.devices
+		if devices == nil {
+			devices = []dep.Device{{SerialNumber: "SERIAL1", OpType: "added"}}
+		}
+		json.NewEncoder(w).Encode(dep.DeviceResponse{
+			Devices: devices,
+			Cursor:  f.fetchedCursor,
+		})
+	case "/devices/sync":
+		json.NewEncoder(w).Encode(dep.DeviceResponse{Cursor: req.Cursor})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeDEPClient(t *testing.T, fake *fakeDEP) *dep.Client {
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return dep.NewClient(dep.OAuthParameters{}, dep.WithServerURL(u))
+}
+
+func newTestWatcher(t *testing.T, fake *fakeDEP, db *mockWatcherDB) (*Watcher, <-chan pubsub.Event, <-chan pubsub.Event) {
+	client := newFakeDEPClient(t, fake)
+
+	ps := inmem.NewPubSub()
+	syncEvents, err := ps.Subscribe(context.Background(), "test", SyncTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resetEvents, err := ps.Subscribe(context.Background(), "test", CursorResetTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(db, ps, WithClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, syncEvents, resetEvents
+}
+
+func waitForReset(t *testing.T, events <-chan pubsub.Event) CursorResetEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		var reset CursorResetEvent
+		if err := json.Unmarshal(ev.Message, &reset); err != nil {
+			t.Fatal(err)
+		}
+		return reset
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for cursor reset event")
+	}
+	return CursorResetEvent{}
+}
+
+func waitForDevices(t *testing.T, events <-chan pubsub.Event) []dep.Device {
+	t.Helper()
+	for {
+		select {
+		case ev := <-events:
+			var e Event
+			if err := UnmarshalEvent(ev.Message, &e); err != nil {
+				t.Fatal(err)
+			}
+			if len(e.Devices) > 0 {
+				return e.Devices
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for fetched devices")
+		}
+	}
+}
+
+func TestWatcherExpiredCursor(t *testing.T) {
+	fake := &fakeDEP{staleCursor: "stale", fetchedCursor: "fresh"}
+	db := &mockWatcherDB{cursor: Cursor{Value: "stale", CreatedAt: time.Now()}}
+	_, syncEvents, resetEvents := newTestWatcher(t, fake, db)
+
+	reset := waitForReset(t, resetEvents)
+	if reset.Reason != CursorResetExpired || reset.PreviousCursor != "stale" {
+		t.Errorf("unexpected reset event %+v", reset)
+	}
+
+	devices := waitForDevices(t, syncEvents)
+	if len(devices) != 1 || devices[0].SerialNumber != "SERIAL1" {
+		t.Errorf("unexpected devices %+v", devices)
+	}
+	fetches := fake.fetches()
+	if len(fetches) != 2 || fetches[0] != "stale" || fetches[1] != "" {
+		t.Errorf("have fetch cursors %q, want a full fetch after the stale cursor", fetches)
+	}
+}
+
+func TestWatcherResetCursor(t *testing.T) {
+	fake := &fakeDEP{fetchedCursor: "fresh"}
+	db := &mockWatcherDB{}
+	w, syncEvents, resetEvents := newTestWatcher(t, fake, db)
+
+	waitForDevices(t, syncEvents)
+	if err := w.ResetCursor(); err != nil {
+		t.Fatal(err)
+	}
+
+	reset := waitForReset(t, resetEvents)
+	if reset.Reason != CursorResetRequested || reset.PreviousCursor != "fresh" {
+		t.Errorf("unexpected reset event %+v", reset)
+	}
+	waitForDevices(t, syncEvents)
+	fetches := fake.fetches()
+	if len(fetches) != 2 || fetches[1] != "" {
+		t.Errorf("have fetch cursors %q, want a full fetch after the reset", fetches)
+	}
+}
+
+func TestResetCursorDoesNotBlock(t *testing.T) {
+	w, err := newWatcher(&mockWatcherDB{}, inmem.NewPubSub(), WithClient(newFakeDEPClient(t, &fakeDEP{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the Run loop is not running, so the second reset is merged with the first.
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 2; i++ {
+			if err := w.ResetCursor(); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for ResetCursor")
+	}
+}
+
+func TestResetCursorWithoutClient(t *testing.T) {
+	w := &Watcher{}
+	if err := w.ResetCursor(); err != errNoDEPClient {
+		t.Errorf("have error %v, want %v", err, errNoDEPClient)
+	}
+}
@@ -14,6 +14,9 @@ type Event struct {
 	ID      string
 	Time    time.Time
 	Devices []dep.Device
+
+	// Token is the consumer key of the DEP token the devices were synced with.
+	Token string
 }
 
 func NewEvent(devices []dep.Device) *Event {
@@ -49,6 +52,7 @@ func MarshalEvent(e *Event) ([]byte, error) {
 		Id:      e.ID,
 		Time:    e.Time.UnixNano(),
 		Devices: devices,
+		Token:   e.Token,
 	})
 }
 
@@ -61,6 +65,7 @@ func UnmarshalEvent(data []byte, e *Event) error {
 	}
 	e.ID = pb.GetId()
 	e.Time = time.Unix(0, pb.GetTime()).UTC()
+	e.Token = pb.GetToken()
 	protodev := pb.GetDevices()
 	var devices []dep.Device
 	for _, d := range protodev {
@@ -0,0 +1,177 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	conf "github.com/micromdm/micromdm/platform/config"
+	"github.com/micromdm/micromdm/platform/pubsub"
+)
+
+// TokenCursorDB stores a separate DEP cursor for every DEP token,
+// identified by the consumer key of the token.
+type TokenCursorDB interface {
+	LoadTokenCursor(consumerKey string) (*Cursor, error)
+	SaveTokenCursor(consumerKey string, c Cursor) error
+	LoadAutoAssigners() ([]AutoAssigner, error)
+}
+
+// TokenClient is the DEP client for the DEP token with ConsumerKey.
+type TokenClient struct {
+	ConsumerKey string
+	Client      Client
+}
+
+// MultiWatcher syncs devices from several DEP tokens, such as one for each
+// MDM server in Apple Business Manager. Every token is synced by its own
+// Watcher, with its own cursor, and the devices it publishes are tagged with
+// the consumer key of the token.
+//
+// Auto-assigners are shared by all tokens, but each Watcher assigns profiles
+// with the client of the token the devices were synced from.
+type MultiWatcher struct {
+	mtx      sync.RWMutex
+	logger   log.Logger
+	db       TokenCursorDB
+	pub      pubsub.Publisher
+	opts     []Option
+	watchers map[string]*Watcher
+}
+
+// NewMultiWatcher starts a Watcher for each of the tokens. The opts are applied to
+// every Watcher. Tokens which are added later are synced as soon as they are published
+// to the DEPTokenTopic.
+func NewMultiWatcher(db TokenCursorDB, pub pubsub.PublishSubscriber, tokens []TokenClient, opts ...Option) (*MultiWatcher, error) {
+	cfg := Watcher{logger: log.NewNopLogger()}
+	for _, optFn := range opts {
+		optFn(&cfg)
+	}
+	m := MultiWatcher{
+		logger:   cfg.logger,
+		db:       db,
+		pub:      pub,
+		opts:     opts,
+		watchers: make(map[string]*Watcher),
+	}
+	for _, tok := range tokens {
+		if err := m.setClient(tok.ConsumerKey, tok.Client); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.watchTokens(pub); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// setClient starts a Watcher for the token, or replaces the client of the
+// running Watcher if the token was already being synced.
+func (m *MultiWatcher) setClient(consumerKey string, client Client) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if w, ok := m.watchers[consumerKey]; ok {
+		w.mtx.Lock()
+		w.client = client
+		w.mtx.Unlock()
+		return nil
+	}
+
+	db := tokenWatcherDB{TokenCursorDB: m.db, consumerKey: consumerKey}
+	opts := append(append([]Option{}, m.opts...), WithClient(client), withToken(consumerKey))
+	w, err := newWatcher(db, m.pub, opts...)
+	if err != nil {
+		return errors.Wrapf(err, "creating DEP watcher for token %s", consumerKey)
+	}
+	m.watchers[consumerKey] = w
+	w.start()
+	return nil
+}
+
+func (m *MultiWatcher) watchTokens(sub pubsub.Subscriber) error {
+	tokenAdded, err := sub.Subscribe(context.TODO(), "multi-token-events", conf.DEPTokenTopic)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for event := range tokenAdded {
+			var token conf.DEPToken
+			if err := json.Unmarshal(event.Message, &token); err != nil {
+				level.Info(m.logger).Log("err", err, "msg", "unmarshalling tokenAdd to token")
+				continue
+			}
+
+			client, err := token.Client()
+			if err != nil {
+				level.Info(m.logger).Log("err", err, "msg", "creating new DEP client")
+				continue
+			}
+			if err := m.setClient(token.ConsumerKey, client); err != nil {
+				level.Info(m.logger).Log("err", err, "msg", "syncing added DEP token")
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *MultiWatcher) list() []*Watcher {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	watchers := make([]*Watcher, 0, len(m.watchers))
+	for _, w := range m.watchers {
+		watchers = append(watchers, w)
+	}
+	return watchers
+}
+
+// SyncNow requests a sync for every token.
+func (m *MultiWatcher) SyncNow() {
+	watchers := m.list()
+	if len(watchers) == 0 {
+		level.Info(m.logger).Log("msg", "waiting for DEP token to be added before starting sync")
+		return
+	}
+	for _, w := range watchers {
+		w.SyncNow()
+	}
+}
+
+// ResetCursor clears the cursor of every token.
+func (m *MultiWatcher) ResetCursor() error {
+	watchers := m.list()
+	if len(watchers) == 0 {
+		return errNoDEPClient
+	}
+	for _, w := range watchers {
+		if err := w.ResetCursor(); err != nil {
+			return errors.Wrapf(err, "reset cursor for token %s", w.token)
+		}
+	}
+	return nil
+}
+
+func withToken(consumerKey string) Option {
+	return func(w *Watcher) {
+		w.token = consumerKey
+		w.logger = log.With(w.logger, "consumer_key", consumerKey)
+	}
+}
+
+// tokenWatcherDB is the WatcherDB of a single token.
+type tokenWatcherDB struct {
+	TokenCursorDB
+	consumerKey string
+}
+
+func (db tokenWatcherDB) LoadCursor() (*Cursor, error) {
+	return db.LoadTokenCursor(db.consumerKey)
+}
+
+func (db tokenWatcherDB) SaveCursor(c Cursor) error {
+	return db.SaveTokenCursor(db.consumerKey, c)
+}
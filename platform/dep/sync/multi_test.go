@@ -0,0 +1,112 @@
+package sync
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/micromdm/micromdm/dep"
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+)
+
+type mockTokenCursorDB struct {
+	mu      gosync.Mutex
+	cursors map[string]Cursor
+}
+
+func (db *mockTokenCursorDB) LoadTokenCursor(consumerKey string) (*Cursor, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	c := db.cursors[consumerKey]
+	return &c, nil
+}
+
+func (db *mockTokenCursorDB) SaveTokenCursor(consumerKey string, c Cursor) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.cursors[consumerKey] = c
+	return nil
+}
+
+func (db *mockTokenCursorDB) cursor(consumerKey string) string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.cursors[consumerKey].Value
+}
+
+func (db *mockTokenCursorDB) LoadAutoAssigners() ([]AutoAssigner, error) { return nil, nil }
+
+func TestMultiWatcherTokens(t *testing.T) {
+	fakeA := &fakeDEP{fetchedCursor: "cursor-a", devices: []dep.Device{
+		{SerialNumber: "A1", OpType: "added"},
+		{SerialNumber: "A2", OpType: "added"},
+	}}
+	fakeB := &fakeDEP{fetchedCursor: "cursor-b", devices: []dep.Device{
+		{SerialNumber: "B1", OpType: "added"},
+	}}
+	db := &mockTokenCursorDB{cursors: make(map[string]Cursor)}
+
+	ps := inmem.NewPubSub()
+	syncEvents, err := ps.Subscribe(context.Background(), "test", SyncTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := []TokenClient{
+		{ConsumerKey: "CK_A", Client: newFakeDEPClient(t, fakeA)},
+		{ConsumerKey: "CK_B", Client: newFakeDEPClient(t, fakeB)},
+	}
+	if _, err := NewMultiWatcher(db, ps, tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	serials := make(map[string][]string)
+	timeout := time.After(5 * time.Second)
+	for len(serials["CK_A"]) < 2 || len(serials["CK_B"]) < 1 {
+		select {
+		case ev := <-syncEvents:
+			var e Event
+			if err := UnmarshalEvent(ev.Message, &e); err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range e.Devices {
+				serials[e.Token] = append(serials[e.Token], d.SerialNumber)
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for devices, have %v", serials)
+		}
+	}
+
+	for token, want := range map[string][]string{"CK_A": {"A1", "A2"}, "CK_B": {"B1"}} {
+		have := serials[token]
+		sort.Strings(have)
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("token %s: have devices %v, want %v", token, have, want)
+		}
+	}
+	if len(serials) != 2 {
+		t.Errorf("have devices for tokens %v, want only CK_A and CK_B", serials)
+	}
+
+	// each token keeps its own cursor.
+	deadline := time.Now().Add(5 * time.Second)
+	for db.cursor("CK_A") != "cursor-a" || db.cursor("CK_B") != "cursor-b" {
+		if time.Now().After(deadline) {
+			t.Fatalf("have cursors %q and %q", db.cursor("CK_A"), db.cursor("CK_B"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMultiWatcherResetCursorWithoutTokens(t *testing.T) {
+	db := &mockTokenCursorDB{cursors: make(map[string]Cursor)}
+	m, err := NewMultiWatcher(db, inmem.NewPubSub(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ResetCursor(); err != errNoDEPClient {
+		t.Errorf("have error %v, want %v", err, errNoDEPClient)
+	}
+}
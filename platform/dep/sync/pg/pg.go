@@ -0,0 +1,123 @@
+// Package pg stores the DEP sync cursors and auto-assigners in PostgreSQL.
+package pg
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	sq "gopkg.in/Masterminds/squirrel.v1"
+
+	"github.com/micromdm/micromdm/platform/dep/sync"
+)
+
+const (
+	cursorTable       = "dep_cursors"
+	autoAssignerTable = "dep_auto_assigners"
+)
+
+type Postgres struct{ db *sqlx.DB }
+
+func New(db *sqlx.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+// LoadCursor loads the cursor of the single DEP token, which is
+// stored with an empty consumer key.
+func (d *Postgres) LoadCursor() (*sync.Cursor, error) {
+	return d.LoadTokenCursor("")
+}
+
+// SaveCursor saves the cursor of the single DEP token.
+func (d *Postgres) SaveCursor(c sync.Cursor) error {
+	return d.SaveTokenCursor("", c)
+}
+
+// LoadTokenCursor loads the cursor of the DEP token with consumerKey.
+// An empty cursor is returned if the token was not synced before.
+func (d *Postgres) LoadTokenCursor(consumerKey string) (*sync.Cursor, error) {
+	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("value", "created_at").
+		From(cursorTable).
+		Where(sq.Eq{"consumer_key": consumerKey}).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "building sql")
+	}
+	var cursor sync.Cursor
+	err = d.db.QueryRowContext(context.TODO(), query, args...).Scan(&cursor.Value, &cursor.CreatedAt)
+	if errors.Cause(err) == sql.ErrNoRows {
+		return &sync.Cursor{}, nil
+	}
+	return &cursor, errors.Wrap(err, "load cursor from pg")
+}
+
+// SaveTokenCursor saves the cursor of the DEP token with consumerKey.
+func (d *Postgres) SaveTokenCursor(consumerKey string, c sync.Cursor) error {
+	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Insert(cursorTable).
+		Columns("consumer_key", "value", "created_at").
+		Values(consumerKey, c.Value, c.CreatedAt.UTC()).
+		Suffix("ON CONFLICT (consumer_key) DO UPDATE SET value = EXCLUDED.value, created_at = EXCLUDED.created_at").
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "building sql")
+	}
+	_, err = d.db.ExecContext(context.TODO(), query, args...)
+	return errors.Wrap(err, "saving dep sync cursor")
+}
+
+func (d *Postgres) SaveAutoAssigner(a *sync.AutoAssigner) error {
+	if a.Filter != "*" {
+		return errors.New("only '*' filter auto-assigners supported")
+	}
+	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Insert(autoAssignerTable).
+		Columns("filter", "profile_uuid").
+		Values(a.Filter, a.ProfileUUID).
+		Suffix("ON CONFLICT (filter) DO UPDATE SET profile_uuid = EXCLUDED.profile_uuid").
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "building sql")
+	}
+	_, err = d.db.ExecContext(context.TODO(), query, args...)
+	return errors.Wrap(err, "saving auto-assigner")
+}
+
+func (d *Postgres) DeleteAutoAssigner(filter string) error {
+	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Delete(autoAssignerTable).
+		Where(sq.Eq{"filter": filter}).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "building sql")
+	}
+	_, err = d.db.ExecContext(context.TODO(), query, args...)
+	return errors.Wrap(err, "deleting auto-assigner")
+}
+
+func (d *Postgres) LoadAutoAssigners() ([]sync.AutoAssigner, error) {
+	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("filter", "profile_uuid").
+		From(autoAssignerTable).
+		OrderBy("filter").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "building sql")
+	}
+	var aa []sync.AutoAssigner
+	rows, err := d.db.QueryContext(context.TODO(), query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading auto-assigners")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a sync.AutoAssigner
+		if err := rows.Scan(&a.Filter, &a.ProfileUUID); err != nil {
+			return nil, errors.Wrap(err, "scan auto-assigner")
+		}
+		aa = append(aa, a)
+	}
+	return aa, errors.Wrap(rows.Err(), "loading auto-assigners")
+}
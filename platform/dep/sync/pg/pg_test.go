@@ -0,0 +1,107 @@
+package pg
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/kolide/kit/dbutil"
+	_ "github.com/lib/pq"
+
+	"github.com/micromdm/micromdm/platform/dep/sync"
+)
+
+var _ sync.Datastore = (*Postgres)(nil)
+
+func TestCursors(t *testing.T) {
+	db := setup(t)
+
+	cursor, err := db.LoadTokenCursor("CK_A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.Value != "" {
+		t.Errorf("have cursor %q before the first sync, want an empty cursor", cursor.Value)
+	}
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	for _, c := range []sync.Cursor{{Value: "first", CreatedAt: createdAt}, {Value: "second", CreatedAt: createdAt}} {
+		if err := db.SaveTokenCursor("CK_A", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SaveCursor(sync.Cursor{Value: "single"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err = db.LoadTokenCursor("CK_A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.Value != "second" || !cursor.CreatedAt.Equal(createdAt) {
+		t.Errorf("have cursor %+v, want the second cursor created at %s", cursor, createdAt)
+	}
+	cursor, err = db.LoadCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := cursor.Value, "single"; have != want {
+		t.Errorf("have cursor %q, want %q", have, want)
+	}
+}
+
+func TestAutoAssigners(t *testing.T) {
+	db := setup(t)
+
+	if err := db.SaveAutoAssigner(&sync.AutoAssigner{Filter: "serial", ProfileUUID: "profile"}); err == nil {
+		t.Error("expected error for an unsupported filter")
+	}
+	for _, uuid := range []string{"profile-1", "profile-2"} {
+		if err := db.SaveAutoAssigner(&sync.AutoAssigner{Filter: "*", ProfileUUID: uuid}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aa, err := db.LoadAutoAssigners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []sync.AutoAssigner{{Filter: "*", ProfileUUID: "profile-2"}}; !reflect.DeepEqual(aa, want) {
+		t.Errorf("have auto-assigners %v, want %v", aa, want)
+	}
+
+	if err := db.DeleteAutoAssigner("*"); err != nil {
+		t.Fatal(err)
+	}
+	aa, err = db.LoadAutoAssigners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aa) != 0 {
+		t.Errorf("have auto-assigners %v after delete, want none", aa)
+	}
+}
+
+// setup connects to the database at DATABASE_URL, which must be migrated
+// with the pg/migrations, or skips the test if DATABASE_URL is not set.
+func setup(t *testing.T) *Postgres {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	db, err := dbutil.OpenDBX(
+		"postgres",
+		dsn,
+		dbutil.WithLogger(log.NewNopLogger()),
+		dbutil.WithMaxAttempts(1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("TRUNCATE " + cursorTable + ", " + autoAssignerTable); err != nil {
+		t.Fatal(err)
+	}
+	return New(db)
+}
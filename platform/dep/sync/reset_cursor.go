@@ -0,0 +1,112 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/pkg/httputil"
+)
+
+// CursorResetTopic is a PubSub topic that an event is published to
+// whenever the DEP sync cursor is cleared.
+const CursorResetTopic = "mdm.DepCursorReset"
+
+// Reasons for a DEP sync cursor reset.
+const (
+	CursorResetRequested = "requested"
+	CursorResetExpired   = "expired"
+	CursorResetInvalid   = "invalid"
+)
+
+// CursorResetEvent is published to CursorResetTopic.
+type CursorResetEvent struct {
+	PreviousCursor string    `json:"previous_cursor"`
+	Reason         string    `json:"reason"`
+	ResetAt        time.Time `json:"reset_at"`
+}
+
+var errNoDEPClient = errors.New("no DEP token configured")
+
+// ResetCursor clears the stored DEP cursor, so that the next sync fetches all
+// devices again instead of only the changes since the last sync.
+// The full fetch starts once the Run loop is idle. A reset which is requested
+// while another one is pending is merged with it.
+func (w *Watcher) ResetCursor() error {
+	w.mtx.RLock()
+	client := w.client
+	w.mtx.RUnlock()
+	if client == nil {
+		return errNoDEPClient
+	}
+	select {
+	case w.resetCursor <- true:
+	default:
+		// a reset is already pending.
+	}
+	return nil
+}
+
+// clearCursor must only be called from the Run loop, which owns the cursor.
+func (w *Watcher) clearCursor(reason string) error {
+	event := CursorResetEvent{
+		PreviousCursor: w.cursor.Value,
+		Reason:         reason,
+		ResetAt:        time.Now().UTC(),
+	}
+	w.cursor = Cursor{}
+	if err := w.db.SaveCursor(w.cursor); err != nil {
+		return errors.Wrap(err, "saving reset cursor")
+	}
+	level.Info(w.logger).Log(
+		"msg", "DEP cursor reset",
+		"reason", reason,
+		"previous_cursor", event.PreviousCursor,
+	)
+
+	msg, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "marshal cursor reset event")
+	}
+	if err := w.publisher.Publish(context.TODO(), CursorResetTopic, msg); err != nil {
+		level.Info(w.logger).Log("err", err, "msg", "publish DEP cursor reset event")
+	}
+	return nil
+}
+
+func (s *DEPSyncService) ResetCursor(_ context.Context) error {
+	return s.syncer.ResetCursor()
+}
+
+type resetCursorResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r resetCursorResponse) Failed() error { return r.Err }
+
+func MakeResetCursorEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, _ interface{}) (interface{}, error) {
+		err := s.ResetCursor(ctx)
+		return resetCursorResponse{Err: err}, nil
+	}
+}
+
+func decodeResetCursorResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	var resp resetCursorResponse
+	err := httputil.DecodeJSONResponse(r, &resp)
+	return resp, err
+}
+
+func (e Endpoints) ResetCursor(ctx context.Context) error {
+	resp, err := e.ResetCursorEndpoint(ctx, nil)
+	if err != nil {
+		return err
+	}
+	response := resp.(resetCursorResponse)
+	return response.Err
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 )
 
 func NewService(syncer Syncer, db DB) *DEPSyncService {
@@ -14,6 +15,7 @@ func NewService(syncer Syncer, db DB) *DEPSyncService {
 
 type Endpoints struct {
 	SyncNowEndpoint            endpoint.Endpoint
+	ResetCursorEndpoint        endpoint.Endpoint
 	ApplyAutoAssignerEndpoint  endpoint.Endpoint
 	GetAutoAssignersEndpoint   endpoint.Endpoint
 	RemoveAutoAssignerEndpoint endpoint.Endpoint
@@ -21,15 +23,17 @@ type Endpoints struct {
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		SyncNowEndpoint:            endpoint.Chain(outer, others...)(MakeSyncNowEndpoint(s)),
-		ApplyAutoAssignerEndpoint:  endpoint.Chain(outer, others...)(MakeApplyAutoAssignerEndpoint(s)),
-		GetAutoAssignersEndpoint:   endpoint.Chain(outer, others...)(MakeGetAutoAssignersEndpoint(s)),
-		RemoveAutoAssignerEndpoint: endpoint.Chain(outer, others...)(MakeRemoveAutoAssignerEndpoint(s)),
+		SyncNowEndpoint:            endpoint.Chain(outer, others...)(scope.Require(scope.DEPAdmin)(MakeSyncNowEndpoint(s))),
+		ResetCursorEndpoint:        endpoint.Chain(outer, others...)(scope.Require(scope.DEPAdmin)(MakeResetCursorEndpoint(s))),
+		ApplyAutoAssignerEndpoint:  endpoint.Chain(outer, others...)(scope.Require(scope.DEPAdmin)(MakeApplyAutoAssignerEndpoint(s))),
+		GetAutoAssignersEndpoint:   endpoint.Chain(outer, others...)(scope.Require(scope.DEPRead)(MakeGetAutoAssignersEndpoint(s))),
+		RemoveAutoAssignerEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.DEPAdmin)(MakeRemoveAutoAssignerEndpoint(s))),
 	}
 }
 
 func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.ServerOption) {
 	// POST		/v1/dep/syncnow			request a DEP sync operation to happen now
+	// POST		/v1/dep/resetcursor		clear the DEP cursor and fetch all devices again
 	// POST		/v1/dep/autoassigners	set a DEP auto-assigner
 	// GET		/v1/dep/autoassigners	get list of DEP auto-assigners
 	// DELETE	/v1/dep/autoassigners	remove a DEP auto-assigner
@@ -41,6 +45,13 @@ func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.S
 		options...,
 	))
 
+	r.Methods("POST").Path("/v1/dep/resetcursor").Handler(httptransport.NewServer(
+		e.ResetCursorEndpoint,
+		decodeEmptyRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
 	r.Methods("POST").Path("/v1/dep/autoassigners").Handler(httptransport.NewServer(
 		e.ApplyAutoAssignerEndpoint,
 		decodeApplyAutoAssignerRequest,
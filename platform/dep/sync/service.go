@@ -7,6 +7,7 @@ import (
 
 type Service interface {
 	SyncNow(context.Context) error
+	ResetCursor(context.Context) error
 	ApplyAutoAssigner(context.Context, *AutoAssigner) error
 	GetAutoAssigners(context.Context) ([]AutoAssigner, error)
 	RemoveAutoAssigner(context.Context, string) error
@@ -18,6 +19,14 @@ type DB interface {
 	DeleteAutoAssigner(filter string) error
 }
 
+// Datastore stores the DEP cursors and auto-assigners of the Watchers and the
+// DEPSyncService. It is implemented by the builtin BoltDB store and the pg store.
+type Datastore interface {
+	DB
+	WatcherDB
+	TokenCursorDB
+}
+
 type DEPSyncService struct {
 	db     DB
 	syncer Syncer
@@ -33,6 +33,7 @@ func (svc *DEPService) watchTokenUpdates(pubsub pubsub.Subscriber) error {
 
 				svc.mtx.Lock()
 				svc.client = client
+				svc.clients[token.ConsumerKey] = client
 				svc.mtx.Unlock()
 			}
 		}
@@ -3,6 +3,7 @@ package builtin
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/boltdb/bolt"
 	"github.com/pkg/errors"
@@ -56,31 +57,81 @@ func (db *DB) GetBootstrapToken(ctx context.Context, udid string) ([]byte, error
 }
 
 func (db *DB) List(ctx context.Context, opt device.ListDevicesOption) ([]device.Device, error) {
+	after, err := device.DecodeListCursor(opt.Cursor)
+	if err != nil {
+		return nil, err
+	}
 	var devices []device.Device
-	err := db.View(func(tx *bolt.Tx) error {
+	err = db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(DeviceBucket))
-		// TODO optimize by implemting Seek() and bytes.HasPrefix() so we don't
-		// hit all keys in the database if we dont have to.
-		return b.ForEach(func(k, v []byte) error {
+		add := func(v []byte) (bool, error) {
 			var dev device.Device
 			if err := device.UnmarshalDevice(v, &dev); err != nil {
-				return err
+				return false, err
 			}
-			if len(opt.FilterSerial) == 0 {
+			if opt.Match(dev) {
 				devices = append(devices, dev)
-				return nil
 			}
-			for _, fs := range opt.FilterSerial {
-				if fs == dev.SerialNumber {
-					devices = append(devices, dev)
+			return opt.Limit > 0 && len(devices) >= opt.Limit, nil
+		}
+
+		// look up devices filtered by serial or UDID in the index
+		// instead of reading every device.
+		if len(opt.FilterSerial) > 0 || len(opt.FilterUDID) > 0 {
+			for _, uuid := range indexedUUIDs(tx.Bucket([]byte(deviceIndexBucket)), opt, after) {
+				v := b.Get([]byte(uuid))
+				if v == nil {
+					continue
+				}
+				if done, err := add(v); err != nil || done {
+					return err
 				}
 			}
 			return nil
-		})
+		}
+
+		c := b.Cursor()
+		k, v := c.First()
+		if after != "" {
+			k, v = c.Seek([]byte(after))
+			if k != nil && string(k) == after {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil; k, v = c.Next() {
+			if done, err := add(v); err != nil || done {
+				return err
+			}
+		}
+		return nil
 	})
 	return devices, err
 }
 
+// indexedUUIDs returns the sorted UUIDs after the cursor of the devices
+// with the serials or UDIDs in the filters of opt.
+func indexedUUIDs(idx *bolt.Bucket, opt device.ListDevicesOption, after string) []string {
+	keys := opt.FilterSerial
+	if len(keys) == 0 {
+		keys = opt.FilterUDID
+	}
+	seen := make(map[string]bool)
+	var uuids []string
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		uuid := string(idx.Get([]byte(key)))
+		if uuid == "" || uuid <= after || seen[uuid] {
+			continue
+		}
+		seen[uuid] = true
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+	return uuids
+}
+
 func (db *DB) Save(ctx context.Context, dev *device.Device) error {
 	tx, err := db.DB.Begin(true)
 	if err != nil {
@@ -6,11 +6,16 @@ import (
 	"github.com/pkg/errors"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/micromdm/micromdm/pkg/timeutil"
 	"github.com/micromdm/micromdm/platform/device/internal/deviceproto"
 )
 
 const DeviceEnrolledTopic = "mdm.DeviceEnrolled"
 
+// DeviceUnenrolledTopic is published with the CheckOut checkin event of an
+// enrolled device, after the device is marked as not enrolled.
+const DeviceUnenrolledTopic = "mdm.DeviceUnenrolled"
+
 type Device struct {
 	UUID                   string           `db:"uuid"`
 	UDID                   string           `db:"udid"`
@@ -39,10 +44,11 @@ type Device struct {
 	DEPProfileAssignedBy   string           `db:"dep_profile_assigned_by"`
 	LastSeen               time.Time        `db:"last_seen"`
 	BootstrapToken         []byte           `db:"bootstrap_token"`
+	DEPToken               string           `db:"dep_token"`
 }
 
 // DEPProfileStatus is the status of the DEP Profile
-// can be either "empty", "assigned", "pushed", or "removed"
+// can be either "empty", "assigned", "pushed", "removed", "failed" or "not_accessible"
 type DEPProfileStatus string
 
 // DEPProfileStatus values
@@ -51,6 +57,11 @@ const (
 	ASSIGNED                  = "assigned"
 	PUSHED                    = "pushed"
 	REMOVED                   = "removed"
+
+	// FAILED and NOT_ACCESSIBLE are the FAILED and NOT_ACCESSIBLE results
+	// Apple returned for the last profile assignment or removal.
+	FAILED         = "failed"
+	NOT_ACCESSIBLE = "not_accessible"
 )
 
 func MarshalDevice(dev *Device) ([]byte, error) {
@@ -76,12 +87,13 @@ func MarshalDevice(dev *Device) ([]byte, error) {
 		AssetTag:               dev.AssetTag,
 		DepProfileStatus:       string(dev.DEPProfileStatus),
 		DepProfileUuid:         dev.DEPProfileUUID,
-		DepProfileAssignTime:   timeToNano(dev.DEPProfileAssignTime),
-		DepProfilePushTime:     timeToNano(dev.DEPProfilePushTime),
-		DepProfileAssignedDate: timeToNano(dev.DEPProfileAssignedDate),
+		DepProfileAssignTime:   timeutil.ToNano(dev.DEPProfileAssignTime),
+		DepProfilePushTime:     timeutil.ToNano(dev.DEPProfilePushTime),
+		DepProfileAssignedDate: timeutil.ToNano(dev.DEPProfileAssignedDate),
 		DepProfileAssignedBy:   dev.DEPProfileAssignedBy,
-		LastSeen:               timeToNano(dev.LastSeen),
+		LastSeen:               timeutil.ToNano(dev.LastSeen),
 		BootstrapToken:         dev.BootstrapToken,
+		DepToken:               dev.DEPToken,
 	}
 	return proto.Marshal(&protodev)
 }
@@ -112,25 +124,12 @@ func UnmarshalDevice(data []byte, dev *Device) error {
 	dev.AssetTag = pb.GetAssetTag()
 	dev.DEPProfileStatus = DEPProfileStatus(pb.GetDepProfileStatus())
 	dev.DEPProfileUUID = pb.GetDepProfileUuid()
-	dev.DEPProfileAssignTime = timeFromNano(pb.GetDepProfileAssignTime())
-	dev.DEPProfilePushTime = timeFromNano(pb.GetDepProfilePushTime())
-	dev.DEPProfileAssignedDate = timeFromNano(pb.GetDepProfileAssignedDate())
+	dev.DEPProfileAssignTime = timeutil.FromNano(pb.GetDepProfileAssignTime())
+	dev.DEPProfilePushTime = timeutil.FromNano(pb.GetDepProfilePushTime())
+	dev.DEPProfileAssignedDate = timeutil.FromNano(pb.GetDepProfileAssignedDate())
 	dev.DEPProfileAssignedBy = pb.GetDepProfileAssignedBy()
-	dev.LastSeen = timeFromNano(pb.GetLastSeen())
+	dev.LastSeen = timeutil.FromNano(pb.GetLastSeen())
 	dev.BootstrapToken = pb.GetBootstrapToken()
+	dev.DEPToken = pb.GetDepToken()
 	return nil
 }
-
-func timeToNano(t time.Time) int64 {
-	if t.IsZero() {
-		return 0
-	}
-	return t.UnixNano()
-}
-
-func timeFromNano(nano int64) time.Time {
-	if nano == 0 {
-		return time.Time{}
-	}
-	return time.Unix(0, nano).UTC()
-}
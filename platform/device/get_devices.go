@@ -14,8 +14,18 @@ type ListDevicesOption struct {
 	Page    int `json:"page"`
 	PerPage int `json:"per_page"`
 
-	FilterSerial []string `json:"filter_serial"`
-	FilterUDID   []string `json:"filter_udid"`
+	// Limit is the maximum number of devices to return. All devices are returned if it is 0.
+	// Cursor is the NextCursor of the previous page.
+	Limit  int    `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+
+	FilterSerial         []string  `json:"filter_serial"`
+	FilterUDID           []string  `json:"filter_udid"`
+	FilterEnrolled       *bool     `json:"filter_enrolled,omitempty"`
+	FilterLastSeenAfter  time.Time `json:"filter_last_seen_after,omitempty"`
+	FilterLastSeenBefore time.Time `json:"filter_last_seen_before,omitempty"`
+	FilterOSVersion      []string  `json:"filter_os_version,omitempty"`
+	FilterModel          []string  `json:"filter_model,omitempty"`
 }
 
 type DeviceDTO struct {
@@ -24,10 +34,30 @@ type DeviceDTO struct {
 	EnrollmentStatus bool             `json:"enrollment_status"`
 	LastSeen         time.Time        `json:"last_seen"`
 	DEPProfileStatus DEPProfileStatus `json:"dep_profile_status"`
+	DEPToken         string           `json:"dep_token,omitempty"`
 }
 
-func (svc *DeviceService) ListDevices(ctx context.Context, opt ListDevicesOption) ([]DeviceDTO, error) {
-	devices, err := svc.store.List(ctx, opt)
+// ListDevices returns the devices matching the filters in opt, ordered by UUID.
+// If opt.Limit is set, it also returns the cursor for the next page, which is empty on the last page.
+func (svc *DeviceService) ListDevices(ctx context.Context, opt ListDevicesOption) ([]DeviceDTO, string, error) {
+	if opt.Limit < 0 {
+		return nil, "", errNegativeLimit
+	}
+	if _, err := DecodeListCursor(opt.Cursor); err != nil {
+		return nil, "", err
+	}
+
+	// fetch one more device than requested to find out if there is a next page.
+	storeOpt := opt
+	if opt.Limit > 0 {
+		storeOpt.Limit = opt.Limit + 1
+	}
+	devices, err := svc.store.List(ctx, storeOpt)
+	var next string
+	if opt.Limit > 0 && len(devices) > opt.Limit {
+		devices = devices[:opt.Limit]
+		next = EncodeListCursor(devices[len(devices)-1].UUID)
+	}
 	var dto []DeviceDTO
 	for _, d := range devices {
 		dto = append(dto, DeviceDTO{
@@ -36,15 +66,17 @@ func (svc *DeviceService) ListDevices(ctx context.Context, opt ListDevicesOption
 			EnrollmentStatus: d.Enrolled,
 			LastSeen:         d.LastSeen,
 			DEPProfileStatus: d.DEPProfileStatus,
+			DEPToken:         d.DEPToken,
 		})
 	}
-	return dto, err
+	return dto, next, err
 }
 
 type getDevicesRequest struct{ Opts ListDevicesOption }
 type getDevicesResponse struct {
-	Devices []DeviceDTO `json:"devices"`
-	Err     error       `json:"err,omitempty"`
+	Devices    []DeviceDTO `json:"devices"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Err        error       `json:"err,omitempty"`
 }
 
 func (r getDevicesResponse) Failed() error { return r.Err }
@@ -67,19 +99,21 @@ func decodeListDevicesResponse(_ context.Context, r *http.Response) (interface{}
 func MakeListDevicesEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(getDevicesRequest)
-		dto, err := svc.ListDevices(ctx, req.Opts)
+		dto, next, err := svc.ListDevices(ctx, req.Opts)
 		return getDevicesResponse{
-			Devices: dto,
-			Err:     err,
+			Devices:    dto,
+			NextCursor: next,
+			Err:        err,
 		}, nil
 	}
 }
 
-func (e Endpoints) ListDevices(ctx context.Context, opts ListDevicesOption) ([]DeviceDTO, error) {
+func (e Endpoints) ListDevices(ctx context.Context, opts ListDevicesOption) ([]DeviceDTO, string, error) {
 	request := getDevicesRequest{opts}
 	response, err := e.ListDevicesEndpoint(ctx, request.Opts)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	return response.(getDevicesResponse).Devices, response.(getDevicesResponse).Err
+	resp := response.(getDevicesResponse)
+	return resp.Devices, resp.NextCursor, resp.Err
 }
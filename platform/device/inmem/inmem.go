@@ -0,0 +1,171 @@
+// Package inmem implements an in-memory device.Datastore, for tests and
+// servers which do not need to keep their devices when they are restarted.
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/platform/device"
+)
+
+// DB stores devices in memory. Like the builtin store, devices are kept
+// marshaled and looked up by UDID or serial number through an index of their UUIDs.
+type DB struct {
+	mu         sync.RWMutex
+	devices    map[string][]byte
+	index      map[string]string
+	certHashes map[string][]byte
+}
+
+func NewDB() *DB {
+	return &DB{
+		devices:    make(map[string][]byte),
+		index:      make(map[string]string),
+		certHashes: make(map[string][]byte),
+	}
+}
+
+// GetBootstrapToken returns the Bootstrap Token for the device by udid
+func (db *DB) GetBootstrapToken(ctx context.Context, udid string) ([]byte, error) {
+	d, err := db.DeviceByUDID(ctx, udid)
+	if err != nil {
+		return nil, errors.Wrap(err, "lookup device by uuid")
+	}
+	return d.BootstrapToken, nil
+}
+
+func (db *DB) List(ctx context.Context, opt device.ListDevicesOption) ([]device.Device, error) {
+	after, err := device.DecodeListCursor(opt.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	uuids := make([]string, 0, len(db.devices))
+	for uuid := range db.devices {
+		if uuid > after {
+			uuids = append(uuids, uuid)
+		}
+	}
+	sort.Strings(uuids)
+
+	var devices []device.Device
+	for _, uuid := range uuids {
+		var dev device.Device
+		if err := device.UnmarshalDevice(db.devices[uuid], &dev); err != nil {
+			return nil, err
+		}
+		if !opt.Match(dev) {
+			continue
+		}
+		devices = append(devices, dev)
+		if opt.Limit > 0 && len(devices) >= opt.Limit {
+			break
+		}
+	}
+	return devices, nil
+}
+
+func (db *DB) Save(ctx context.Context, dev *device.Device) error {
+	devproto, err := device.MarshalDevice(dev)
+	if err != nil {
+		return errors.Wrap(err, "marshalling device")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, idx := range []string{dev.UDID, dev.SerialNumber} {
+		if idx == "" {
+			continue
+		}
+		db.index[idx] = dev.UUID
+	}
+	db.devices[dev.UUID] = devproto
+	return nil
+}
+
+func (db *DB) DeleteByUDID(ctx context.Context, udid string) error {
+	return db.deleteByIndex(udid)
+}
+
+func (db *DB) DeleteBySerial(ctx context.Context, serial string) error {
+	return db.deleteByIndex(serial)
+}
+
+func (db *DB) deleteByIndex(key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	dev, err := db.deviceByIndex(key)
+	if err != nil {
+		return err
+	}
+	delete(db.devices, dev.UUID)
+	delete(db.index, dev.UDID)
+	delete(db.index, dev.SerialNumber)
+	return nil
+}
+
+type notFound struct {
+	ResourceType string
+	Message      string
+}
+
+func (e *notFound) Error() string {
+	return fmt.Sprintf("not found: %s %s", e.ResourceType, e.Message)
+}
+
+func (e *notFound) NotFound() bool {
+	return true
+}
+
+func (db *DB) DeviceByUDID(ctx context.Context, udid string) (*device.Device, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.deviceByIndex(udid)
+}
+
+func (db *DB) DeviceBySerial(ctx context.Context, serial string) (*device.Device, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.deviceByIndex(serial)
+}
+
+// deviceByIndex must be called with db.mu held.
+func (db *DB) deviceByIndex(key string) (*device.Device, error) {
+	uuid, ok := db.index[key]
+	if !ok {
+		return nil, &notFound{"Device", fmt.Sprintf("key %s", key)}
+	}
+	v, ok := db.devices[uuid]
+	if !ok {
+		return nil, &notFound{"Device", fmt.Sprintf("uuid %s", uuid)}
+	}
+	var dev device.Device
+	if err := device.UnmarshalDevice(v, &dev); err != nil {
+		return nil, err
+	}
+	return &dev, nil
+}
+
+func (db *DB) SaveUDIDCertHash(udid, certHash []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.certHashes[string(udid)] = append([]byte(nil), certHash...)
+	return nil
+}
+
+func (db *DB) GetUDIDCertHash(udid []byte) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	certHash, ok := db.certHashes[string(udid)]
+	if !ok {
+		return nil, &notFound{"UDID", fmt.Sprintf("udid %s", string(udid))}
+	}
+	return append([]byte(nil), certHash...), nil
+}
@@ -0,0 +1,16 @@
+package inmem
+
+import (
+	"testing"
+
+	"github.com/micromdm/micromdm/platform/device"
+	"github.com/micromdm/micromdm/platform/device/internal/storetest"
+)
+
+var _ device.Datastore = (*DB)(nil)
+
+func TestDB(t *testing.T) {
+	storetest.Test(t, func(t *testing.T) device.Datastore {
+		return NewDB()
+	})
+}
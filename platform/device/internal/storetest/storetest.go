@@ -0,0 +1,346 @@
+// Package storetest is a test suite for implementations of device.Datastore.
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/micromdm/micromdm/platform/device"
+)
+
+// Test runs the suite with an empty store from newStore for each test.
+func Test(t *testing.T, newStore func(t *testing.T) device.Datastore) {
+	for _, tt := range []struct {
+		name string
+		test func(t *testing.T, db device.Datastore)
+	}{
+		{"Save", testSave},
+		{"Update", testUpdate},
+		{"NotFound", testNotFound},
+		{"GetBootstrapToken", testGetBootstrapToken},
+		{"DeleteByUDID", testDeleteByUDID},
+		{"DeleteBySerial", testDeleteBySerial},
+		{"UDIDCertHash", testUDIDCertHash},
+		{"ListFilters", testListFilters},
+		{"ListPagination", testListPagination},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func testSave(t *testing.T, db device.Datastore) {
+	dev := &device.Device{
+		UUID:         "a-b-c-d",
+		UDID:         "UDID-FOO-BAR-BAZ",
+		SerialNumber: "foobarbaz",
+		ProductName:  "MacBook",
+	}
+	ctx := context.Background()
+
+	if err := db.Save(ctx, dev); err != nil {
+		t.Fatalf("saving device in datastore: %s", err)
+	}
+
+	byUDID, err := db.DeviceByUDID(ctx, dev.UDID)
+	if err != nil {
+		t.Fatalf("getting device by UDID: %s", err)
+	}
+
+	bySerial, err := db.DeviceBySerial(ctx, dev.SerialNumber)
+	if err != nil {
+		t.Fatalf("getting device by UDID: %s", err)
+	}
+
+	// test helper that verifies that the retrieved device is the same
+	tf := func(haveDev *device.Device) func(t *testing.T) {
+		return func(t *testing.T) {
+			if have, want := haveDev.UDID, dev.UDID; have != want {
+				t.Errorf("have %s, want %s", have, want)
+			}
+
+			if have, want := haveDev.UUID, dev.UUID; have != want {
+				t.Errorf("have %s, want %s", have, want)
+			}
+
+			if have, want := haveDev.SerialNumber, dev.SerialNumber; have != want {
+				t.Errorf("have %s, want %s", have, want)
+			}
+
+			if have, want := haveDev.ProductName, dev.ProductName; have != want {
+				t.Errorf("have %s, want %s", have, want)
+			}
+
+			if have, want := haveDev.LastSeen, dev.LastSeen; !have.Equal(want) {
+				t.Errorf("have %s, want %s", have, want)
+			}
+
+		}
+	}
+
+	t.Run("byUDID", tf(byUDID))
+	t.Run("bySerial", tf(bySerial))
+
+}
+
+func testUpdate(t *testing.T, db device.Datastore) {
+	ctx := context.Background()
+	dev := &device.Device{UUID: "a-b-c-d", UDID: "UDID-FOO-BAR-BAZ"}
+	if err := db.Save(ctx, dev); err != nil {
+		t.Fatal(err)
+	}
+
+	// the serial number of DEP devices is often known before the UDID,
+	// so a saved device can gain an index.
+	dev.SerialNumber = "foobarbaz"
+	dev.Enrolled = true
+	if err := db.Save(ctx, dev); err != nil {
+		t.Fatal(err)
+	}
+
+	bySerial, err := db.DeviceBySerial(ctx, dev.SerialNumber)
+	if err != nil {
+		t.Fatalf("getting device by serial: %s", err)
+	}
+	if !bySerial.Enrolled || bySerial.UDID != dev.UDID {
+		t.Errorf("have device %+v, want the updated device", bySerial)
+	}
+
+	devices, err := db.List(ctx, device.ListDevicesOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(devices), 1; have != want {
+		t.Errorf("have %d devices, want %d", have, want)
+	}
+}
+
+func testNotFound(t *testing.T, db device.Datastore) {
+	ctx := context.Background()
+	for name, fn := range map[string]func() error{
+		"DeviceByUDID": func() error {
+			_, err := db.DeviceByUDID(ctx, "UNKNOWN")
+			return err
+		},
+		"DeviceBySerial": func() error {
+			_, err := db.DeviceBySerial(ctx, "UNKNOWN")
+			return err
+		},
+		"DeleteByUDID": func() error { return db.DeleteByUDID(ctx, "UNKNOWN") },
+		"GetUDIDCertHash": func() error {
+			_, err := db.GetUDIDCertHash([]byte("UNKNOWN"))
+			return err
+		},
+	} {
+		err := fn()
+		nf, ok := err.(interface{ NotFound() bool })
+		if !ok || !nf.NotFound() {
+			t.Errorf("%s: have error %v, want a not found error", name, err)
+		}
+	}
+}
+
+func testGetBootstrapToken(t *testing.T, db device.Datastore) {
+	dev := &device.Device{
+		UUID:           "a-b-c-d",
+		UDID:           "UDID-FOO-BAR-BAZ",
+		BootstrapToken: []byte("bootstrap"),
+	}
+	ctx := context.Background()
+
+	if err := db.Save(ctx, dev); err != nil {
+		t.Fatalf("saving device in datastore: %s", err)
+	}
+
+	haveDev, err := db.DeviceByUDID(ctx, dev.UDID)
+	if err != nil {
+		t.Fatalf("getting device by UDID: %s", err)
+	}
+
+	if have, want := haveDev.BootstrapToken, dev.BootstrapToken; bytes.Compare(have, want) != 0 {
+		t.Errorf("have %s, want %s", have, want)
+	}
+
+	token, err := db.GetBootstrapToken(ctx, dev.UDID)
+	if err != nil {
+		t.Fatalf("getting bootstrap token: %s", err)
+	}
+	if have, want := token, dev.BootstrapToken; !bytes.Equal(have, want) {
+		t.Errorf("have %s, want %s", have, want)
+	}
+}
+
+func testDeleteByUDID(t *testing.T, db device.Datastore) {
+	dev := &device.Device{
+		UUID:         "a-b-c-d",
+		UDID:         "UDID-FOO-BAR-BAZ",
+		SerialNumber: "foobarbaz",
+		ProductName:  "MacBook",
+	}
+	ctx := context.Background()
+
+	if err := db.Save(ctx, dev); err != nil {
+		t.Fatalf("saving device in datastore: %s", err)
+	}
+
+	if err := db.DeleteByUDID(ctx, dev.UDID); err != nil {
+		t.Fatalf("deleting device in datastore: %s", err)
+	}
+
+	byUDID, _ := db.DeviceByUDID(ctx, dev.UDID)
+	if byUDID != nil {
+		t.Fatalf("expected device to be deleted")
+	}
+}
+
+func testDeleteBySerial(t *testing.T, db device.Datastore) {
+	dev := &device.Device{
+		UUID:         "a-b-c-d",
+		UDID:         "UDID-FOO-BAR-BAZ",
+		SerialNumber: "foobarbaz",
+		ProductName:  "MacBook",
+	}
+
+	ctx := context.Background()
+
+	if err := db.Save(ctx, dev); err != nil {
+		t.Fatalf("saving device in datastore: %s", err)
+	}
+
+	if err := db.DeleteBySerial(ctx, dev.SerialNumber); err != nil {
+		t.Fatalf("deleting device in datastore: %s", err)
+	}
+
+	byUDID, _ := db.DeviceBySerial(ctx, dev.SerialNumber)
+	if byUDID != nil {
+		t.Fatalf("expected device to be deleted")
+	}
+}
+
+func testUDIDCertHash(t *testing.T, db device.Datastore) {
+	udid, certHash := []byte("UDID-FOO-BAR-BAZ"), []byte("hash")
+	if err := db.SaveUDIDCertHash(udid, certHash); err != nil {
+		t.Fatal(err)
+	}
+	have, err := db.GetUDIDCertHash(udid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, certHash) {
+		t.Errorf("have cert hash %s, want %s", have, certHash)
+	}
+}
+
+func testListFilters(t *testing.T, db device.Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for _, dev := range []*device.Device{
+		{UUID: "1", UDID: "UDID-1", SerialNumber: "SERIAL-1", Enrolled: true, LastSeen: now.Add(-time.Hour), OSVersion: "14.1", Model: "iPhone"},
+		{UUID: "2", UDID: "UDID-2", SerialNumber: "SERIAL-2", Enrolled: false, LastSeen: now.Add(-48 * time.Hour), OSVersion: "13.6", ModelName: "MacBook Pro"},
+		{UUID: "3", UDID: "UDID-3", SerialNumber: "SERIAL-3", Enrolled: true, LastSeen: now.Add(-30 * 24 * time.Hour), OSVersion: "14.1", Model: "iPad"},
+	} {
+		if err := db.Save(ctx, dev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	enrolled, unenrolled := true, false
+	tests := []struct {
+		name string
+		opt  device.ListDevicesOption
+		want []string
+	}{
+		{"none", device.ListDevicesOption{}, []string{"1", "2", "3"}},
+		{"serial", device.ListDevicesOption{FilterSerial: []string{"SERIAL-3", "SERIAL-1", "UNKNOWN"}}, []string{"1", "3"}},
+		{"udid", device.ListDevicesOption{FilterUDID: []string{"UDID-2"}}, []string{"2"}},
+		{"enrolled", device.ListDevicesOption{FilterEnrolled: &enrolled}, []string{"1", "3"}},
+		{"unenrolled", device.ListDevicesOption{FilterEnrolled: &unenrolled}, []string{"2"}},
+		{"last seen after", device.ListDevicesOption{FilterLastSeenAfter: now.Add(-72 * time.Hour)}, []string{"1", "2"}},
+		{"last seen before", device.ListDevicesOption{FilterLastSeenBefore: now.Add(-24 * time.Hour)}, []string{"2", "3"}},
+		{"last seen window", device.ListDevicesOption{
+			FilterLastSeenAfter:  now.Add(-72 * time.Hour),
+			FilterLastSeenBefore: now.Add(-24 * time.Hour),
+		}, []string{"2"}},
+		{"os version", device.ListDevicesOption{FilterOSVersion: []string{"14.1"}}, []string{"1", "3"}},
+		{"model", device.ListDevicesOption{FilterModel: []string{"iPad", "MacBook Pro"}}, []string{"2", "3"}},
+		{"combined", device.ListDevicesOption{FilterOSVersion: []string{"14.1"}, FilterModel: []string{"iPad"}}, []string{"3"}},
+		{"serial and enrolled", device.ListDevicesOption{FilterSerial: []string{"SERIAL-1", "SERIAL-2"}, FilterEnrolled: &enrolled}, []string{"1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices, err := db.List(ctx, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := uuids(devices); !reflect.DeepEqual(have, tt.want) {
+				t.Errorf("have devices %v, want %v", have, tt.want)
+			}
+		})
+	}
+}
+
+func testListPagination(t *testing.T, db device.Datastore) {
+	ctx := context.Background()
+	for _, uuid := range []string{"b", "d", "f", "h", "j"} {
+		if err := db.Save(ctx, &device.Device{UUID: uuid, UDID: "UDID-" + uuid}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := device.New(db)
+
+	var pages [][]string
+	opt := device.ListDevicesOption{Limit: 2}
+	for {
+		dto, next, err := svc.ListDevices(ctx, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page []string
+		for _, d := range dto {
+			page = append(page, d.UDID)
+		}
+		pages = append(pages, page)
+		if next == "" {
+			break
+		}
+		if len(pages) == 1 {
+			// devices inserted before and after the cursor must not
+			// shift the pages which follow it.
+			for _, uuid := range []string{"a", "e"} {
+				if err := db.Save(ctx, &device.Device{UUID: uuid, UDID: "UDID-" + uuid}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		opt.Cursor = next
+	}
+
+	want := [][]string{
+		{"UDID-b", "UDID-d"},
+		{"UDID-e", "UDID-f"},
+		{"UDID-h", "UDID-j"},
+	}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("have pages %v, want %v", pages, want)
+	}
+
+	if _, _, err := svc.ListDevices(ctx, device.ListDevicesOption{Cursor: "not base64!"}); err == nil {
+		t.Error("expected error for an invalid cursor")
+	}
+	if _, _, err := svc.ListDevices(ctx, device.ListDevicesOption{Limit: -1}); err == nil {
+		t.Error("expected error for a negative limit")
+	}
+}
+
+func uuids(devices []device.Device) []string {
+	var ids []string
+	for _, d := range devices {
+		ids = append(ids, d.UUID)
+	}
+	return ids
+}
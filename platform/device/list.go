@@ -0,0 +1,64 @@
+package device
+
+import (
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errNegativeLimit = errors.New("limit must not be negative")
+	errInvalidCursor = errors.New("invalid device list cursor")
+)
+
+// EncodeListCursor returns the cursor for the page of devices following the device with uuid.
+func EncodeListCursor(uuid string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(uuid))
+}
+
+// DecodeListCursor returns the UUID of the last device before the page
+// of devices at cursor, or an empty string for the first page.
+func DecodeListCursor(cursor string) (string, error) {
+	uuid, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errInvalidCursor
+	}
+	return string(uuid), nil
+}
+
+// Match reports whether dev matches all of the filters in opt.
+// Stores which cannot query a filter directly use Match to apply it.
+// A device matches FilterModel if either its Model or ModelName is listed.
+func (opt ListDevicesOption) Match(dev Device) bool {
+	if len(opt.FilterSerial) > 0 && !contains(opt.FilterSerial, dev.SerialNumber) {
+		return false
+	}
+	if len(opt.FilterUDID) > 0 && !contains(opt.FilterUDID, dev.UDID) {
+		return false
+	}
+	if opt.FilterEnrolled != nil && *opt.FilterEnrolled != dev.Enrolled {
+		return false
+	}
+	if !opt.FilterLastSeenAfter.IsZero() && !dev.LastSeen.After(opt.FilterLastSeenAfter) {
+		return false
+	}
+	if !opt.FilterLastSeenBefore.IsZero() && !dev.LastSeen.Before(opt.FilterLastSeenBefore) {
+		return false
+	}
+	if len(opt.FilterOSVersion) > 0 && !contains(opt.FilterOSVersion, dev.OSVersion) {
+		return false
+	}
+	if len(opt.FilterModel) > 0 && !contains(opt.FilterModel, dev.Model) && !contains(opt.FilterModel, dev.ModelName) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
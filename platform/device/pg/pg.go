@@ -46,6 +46,8 @@ func columns() []string {
 		"dep_profile_assigned_date",
 		"dep_profile_assigned_by",
 		"last_seen",
+		"dep_token",
+		"bootstrap_token",
 	}
 }
 
@@ -81,6 +83,8 @@ func (d *Postgres) Save(ctx context.Context, device *device.Device) error {
 		Set("dep_profile_assigned_date", device.DEPProfileAssignedDate).
 		Set("dep_profile_assigned_by", device.DEPProfileAssignedBy).
 		Set("last_seen", device.LastSeen).
+		Set("dep_token", device.DEPToken).
+		Set("bootstrap_token", device.BootstrapToken).
 		ToSql()
 	if err != nil {
 		return errors.Wrap(err, "building update query for device save")
@@ -117,6 +121,8 @@ func (d *Postgres) Save(ctx context.Context, device *device.Device) error {
 			device.DEPProfileAssignedDate,
 			device.DEPProfileAssignedBy,
 			device.LastSeen,
+			device.DEPToken,
+			device.BootstrapToken,
 		).
 		Suffix(updateQuery).
 		ToSql()
@@ -164,11 +170,57 @@ func (d *Postgres) DeviceBySerial(ctx context.Context, serial string) (*device.D
 	return &dev, errors.Wrap(err, "finding device by serial")
 }
 
-func (d *Postgres) ListDevices(ctx context.Context, opt device.ListDevicesOption) ([]device.Device, error) {
-	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+// GetBootstrapToken returns the Bootstrap Token for the device by udid
+func (d *Postgres) GetBootstrapToken(ctx context.Context, udid string) ([]byte, error) {
+	dev, err := d.DeviceByUDID(ctx, udid)
+	if err != nil {
+		return nil, errors.Wrap(err, "lookup device by uuid")
+	}
+	return dev.BootstrapToken, nil
+}
+
+func (d *Postgres) List(ctx context.Context, opt device.ListDevicesOption) ([]device.Device, error) {
+	after, err := device.DecodeListCursor(opt.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	where := sq.And{}
+	if after != "" {
+		where = append(where, sq.Gt{"uuid": after})
+	}
+	if len(opt.FilterSerial) > 0 {
+		where = append(where, sq.Eq{"serial_number": opt.FilterSerial})
+	}
+	if len(opt.FilterUDID) > 0 {
+		where = append(where, sq.Eq{"udid": opt.FilterUDID})
+	}
+	if opt.FilterEnrolled != nil {
+		where = append(where, sq.Eq{"enrolled": *opt.FilterEnrolled})
+	}
+	if !opt.FilterLastSeenAfter.IsZero() {
+		where = append(where, sq.Gt{"last_seen": opt.FilterLastSeenAfter})
+	}
+	if !opt.FilterLastSeenBefore.IsZero() {
+		where = append(where, sq.Lt{"last_seen": opt.FilterLastSeenBefore})
+	}
+	if len(opt.FilterOSVersion) > 0 {
+		where = append(where, sq.Eq{"os_version": opt.FilterOSVersion})
+	}
+	if len(opt.FilterModel) > 0 {
+		where = append(where, sq.Or{sq.Eq{"model": opt.FilterModel}, sq.Eq{"model_name": opt.FilterModel}})
+	}
+
+	builder := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
 		Select(columns()...).
 		From(tableName).
-		ToSql()
+		OrderBy("uuid")
+	if len(where) > 0 {
+		builder = builder.Where(where)
+	}
+	if opt.Limit > 0 {
+		builder = builder.Limit(uint64(opt.Limit))
+	}
+	query, args, err := builder.ToSql()
 	if err != nil {
 		return nil, errors.Wrap(err, "building sql")
 	}
@@ -185,8 +237,7 @@ func (d *Postgres) DeleteByUDID(ctx context.Context, udid string) error {
 	if err != nil {
 		return errors.Wrap(err, "building sql")
 	}
-	_, err = d.db.ExecContext(ctx, query, args...)
-	return errors.Wrap(err, "delete device by udid")
+	return d.delete(ctx, query, args, "delete device by udid")
 }
 
 func (d *Postgres) DeleteBySerial(ctx context.Context, serial string) error {
@@ -197,8 +248,55 @@ func (d *Postgres) DeleteBySerial(ctx context.Context, serial string) error {
 	if err != nil {
 		return errors.Wrap(err, "building sql")
 	}
-	_, err = d.db.ExecContext(ctx, query, args...)
-	return errors.Wrap(err, "delete device by serial_number")
+	return d.delete(ctx, query, args, "delete device by serial_number")
+}
+
+func (d *Postgres) delete(ctx context.Context, query string, args []interface{}, msg string) error {
+	result, err := d.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, msg)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, msg)
+	}
+	if n == 0 {
+		return deviceNotFoundErr{}
+	}
+	return nil
+}
+
+const udidCertAuthTable = "udid_cert_auth"
+
+func (d *Postgres) SaveUDIDCertHash(udid, certHash []byte) error {
+	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Insert(udidCertAuthTable).
+		Columns("udid", "cert_hash").
+		Values(string(udid), certHash).
+		Suffix("ON CONFLICT (udid) DO UPDATE SET cert_hash = EXCLUDED.cert_hash").
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "building sql")
+	}
+	_, err = d.db.Exec(query, args...)
+	return errors.Wrap(err, "save udid cert hash")
+}
+
+func (d *Postgres) GetUDIDCertHash(udid []byte) ([]byte, error) {
+	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("cert_hash").
+		From(udidCertAuthTable).
+		Where(sq.Eq{"udid": string(udid)}).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "building sql")
+	}
+	var certHash []byte
+	err = d.db.QueryRow(query, args...).Scan(&certHash)
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil, udidNotFoundErr{}
+	}
+	return certHash, errors.Wrap(err, "finding udid cert hash")
 }
 
 type deviceNotFoundErr struct{}
@@ -210,3 +308,13 @@ func (e deviceNotFoundErr) Error() string {
 func (e deviceNotFoundErr) NotFound() bool {
 	return true
 }
+
+type udidNotFoundErr struct{}
+
+func (e udidNotFoundErr) Error() string {
+	return "udid cert hash not found"
+}
+
+func (e udidNotFoundErr) NotFound() bool {
+	return true
+}
@@ -1,19 +1,31 @@
-//go:build pg
-// +build pg
-
 package pg
 
 import (
 	"context"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/kolide/kit/dbutil"
 	_ "github.com/lib/pq"
+
 	"github.com/micromdm/micromdm/platform/device"
+	"github.com/micromdm/micromdm/platform/device/internal/storetest"
 )
 
+var _ device.Datastore = (*Postgres)(nil)
+
+func TestPostgres(t *testing.T) {
+	storetest.Test(t, func(t *testing.T) device.Datastore {
+		db := setup(t)
+		if _, err := db.db.Exec("TRUNCATE devices, udid_cert_auth"); err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
 func TestPGCrud(t *testing.T) {
 	db := setup(t)
 	ctx := context.Background()
@@ -48,7 +60,7 @@ func TestPGCrud(t *testing.T) {
 	}
 
 	// list
-	devices, err := db.ListDevices(ctx, device.ListDevicesOption{})
+	devices, err := db.List(ctx, device.ListDevicesOption{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -61,10 +73,16 @@ func TestPGCrud(t *testing.T) {
 	}
 }
 
+// setup connects to the database at DATABASE_URL, which must be migrated
+// with the pg/migrations, or skips the test if DATABASE_URL is not set.
 func setup(t *testing.T) *Postgres {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
 	db, err := dbutil.OpenDBX(
 		"postgres",
-		"host=localhost port=5432 user=micromdm dbname=micromdm_test password=micromdm sslmode=disable",
+		dsn,
 		dbutil.WithLogger(log.NewNopLogger()),
 		dbutil.WithMaxAttempts(1),
 	)
@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/platform/audit"
 )
 
 func (svc *DeviceService) RemoveDevices(ctx context.Context, opt RemoveDevicesOptions) error {
@@ -28,6 +29,10 @@ func (svc *DeviceService) RemoveDevices(ctx context.Context, opt RemoveDevicesOp
 
 type removeDevicesRequest struct{ Opts RemoveDevicesOptions }
 
+func (r removeDevicesRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: "RemoveDevices", UDIDs: r.Opts.UDIDs, Serials: r.Opts.Serials}
+}
+
 type removeDevicesResponse struct {
 	Err error `json:"err,omitempty"`
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 )
 
 type Endpoints struct {
@@ -15,8 +16,8 @@ type Endpoints struct {
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		ListDevicesEndpoint:   endpoint.Chain(outer, others...)(MakeListDevicesEndpoint(s)),
-		RemoveDevicesEndpoint: endpoint.Chain(outer, others...)(MakeRemoveDevicesEndpoint(s)),
+		ListDevicesEndpoint:   endpoint.Chain(outer, others...)(scope.Require(scope.DevicesRead)(MakeListDevicesEndpoint(s))),
+		RemoveDevicesEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.DevicesWrite)(MakeRemoveDevicesEndpoint(s))),
 	}
 }
 
@@ -2,6 +2,8 @@ package device
 
 import (
 	"context"
+
+	"github.com/micromdm/micromdm/mdm"
 )
 
 type RemoveDevicesOptions struct {
@@ -10,16 +12,29 @@ type RemoveDevicesOptions struct {
 }
 
 type Service interface {
-	ListDevices(ctx context.Context, opt ListDevicesOption) ([]DeviceDTO, error)
+	ListDevices(ctx context.Context, opt ListDevicesOption) ([]DeviceDTO, string, error)
 	RemoveDevices(ctx context.Context, opt RemoveDevicesOptions) error
 }
 
 type Store interface {
+	// List returns up to opt.Limit devices matching opt, ordered by UUID,
+	// starting after the device in opt.Cursor.
 	List(ctx context.Context, opt ListDevicesOption) ([]Device, error)
 	DeleteByUDID(ctx context.Context, udid string) error
 	DeleteBySerial(ctx context.Context, serial string) error
 }
 
+// Datastore is all of the device storage used by the server: the Store of the
+// device API, the DeviceWorkerStore, the Bootstrap Tokens of the MDM service, and
+// the UDIDCertAuthStore. It is implemented by the builtin BoltDB store and the
+// inmem store, which keeps the devices in memory for tests and ephemeral servers.
+type Datastore interface {
+	Store
+	DeviceWorkerStore
+	UDIDCertAuthStore
+	mdm.BootstrapTokenRetriever
+}
+
 type DeviceService struct {
 	store Store
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/pkg/ctxlog"
 )
 
 type UDIDCertAuthStore interface {
@@ -42,7 +43,7 @@ func hashCertRaw(c []byte) []byte {
 	return retBytes
 }
 
-func (mw *udidCertAuthMiddleware) validateUDIDCertAuth(udid, certHash []byte) (bool, error) {
+func (mw *udidCertAuthMiddleware) validateUDIDCertAuth(ctx context.Context, udid, certHash []byte) (bool, error) {
 	dbCertHash, err := mw.store.GetUDIDCertHash(udid)
 	if err != nil && !isNotFound(err) {
 		return false, err
@@ -52,14 +53,14 @@ func (mw *udidCertAuthMiddleware) validateUDIDCertAuth(udid, certHash []byte) (b
 		// its UDID-cert association. at some later late, when most/all
 		// micromdm instances have stored udid-cert associations
 		// this can be an outright failure.
-		level.Info(mw.logger).Log("msg", "device cert hash not found, saving anyway", "udid", string(udid))
+		level.Info(ctxlog.Logger(ctx, mw.logger)).Log("msg", "device cert hash not found, saving anyway")
 		if err := mw.store.SaveUDIDCertHash(udid, certHash); err != nil {
 			return false, err
 		}
 		return true, nil
 	}
 	if 1 != subtle.ConstantTimeCompare(certHash, dbCertHash) {
-		level.Info(mw.logger).Log("msg", "device cert hash mismatch", "udid", string(udid))
+		level.Info(ctxlog.Logger(ctx, mw.logger)).Log("msg", "device cert hash mismatch")
 		return false, nil
 	}
 	return true, nil
@@ -75,7 +76,7 @@ func (mw *udidCertAuthMiddleware) Acknowledge(ctx context.Context, req mdm.Ackno
 	if err != nil {
 		return nil, errors.Wrap(err, "error retrieving device certificate")
 	}
-	matched, err := mw.validateUDIDCertAuth([]byte(req.Response.UDID), hashCertRaw(devcert.Raw))
+	matched, err := mw.validateUDIDCertAuth(ctx, []byte(req.Response.UDID), hashCertRaw(devcert.Raw))
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +102,7 @@ func (mw *udidCertAuthMiddleware) Checkin(ctx context.Context, req mdm.CheckinEv
 		}
 		return mw.next.Checkin(ctx, req)
 	}
-	matched, err := mw.validateUDIDCertAuth([]byte(req.Command.UDID), hashCertRaw(devcert.Raw))
+	matched, err := mw.validateUDIDCertAuth(ctx, []byte(req.Command.UDID), hashCertRaw(devcert.Raw))
 	if err != nil {
 		return nil, err
 	}
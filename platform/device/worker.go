@@ -138,6 +138,9 @@ func (w *Worker) updateFromDEPSync(ctx context.Context, message []byte) error {
 		dev.DEPProfileAssignTime = dd.ProfileAssignTime
 		dev.DEPProfileAssignedDate = dd.DeviceAssignedDate
 		dev.DEPProfileAssignedBy = dd.DeviceAssignedBy
+		if ev.Token != "" {
+			dev.DEPToken = ev.Token
+		}
 
 		if err := w.db.Save(ctx, dev); err != nil {
 			return errors.Wrap(err, "save device %s from DEP sync")
@@ -161,7 +164,7 @@ func (w *Worker) updateFromAcknowledge(ctx context.Context, message []byte) erro
 	if err != nil {
 		return errors.Wrapf(err, "retrieve device with udid %s", ev.Response.UDID)
 	}
-	dev.LastSeen = time.Now()
+	dev.seen(ev.Time)
 
 	err = w.db.Save(ctx, dev)
 	return errors.Wrapf(err, "saving updated device for acknowledge event")
@@ -183,11 +186,21 @@ func (w *Worker) updateFromCheckout(ctx context.Context, message []byte) error {
 		return errors.Wrapf(err, "retrieve device with udid %s", ev.Command.UDID)
 	}
 
+	wasEnrolled := dev.Enrolled
 	dev.Enrolled = false
-	dev.LastSeen = time.Now()
+	// CheckOut is the last contact with an unenrolled device.
+	dev.seen(ev.Time)
 
-	err = w.db.Save(ctx, dev)
-	return errors.Wrapf(err, "saving updated device for checkout event")
+	// the device record is kept as a record of the unenrollment.
+	if err := w.db.Save(ctx, dev); err != nil {
+		return errors.Wrapf(err, "saving updated device for checkout event")
+	}
+
+	if wasEnrolled {
+		err = w.ps.Publish(ctx, DeviceUnenrolledTopic, message)
+		return errors.Wrap(err, "publishing unenrollment message")
+	}
+	return nil
 
 }
 
@@ -203,7 +216,7 @@ func (w *Worker) updateFromGetBootstrapToken(ctx context.Context, message []byte
 	}
 
 	dev.AwaitingConfiguration = ev.Command.AwaitingConfiguration
-	dev.LastSeen = time.Now()
+	dev.seen(ev.Time)
 
 	err = w.db.Save(ctx, dev)
 	return errors.Wrapf(err, "saving updated device for GetBootstrapToken event")
@@ -223,7 +236,7 @@ func (w *Worker) updateFromSetBootstrapToken(ctx context.Context, message []byte
 
 	dev.BootstrapToken = ev.Command.BootstrapToken
 	dev.AwaitingConfiguration = ev.Command.AwaitingConfiguration
-	dev.LastSeen = time.Now()
+	dev.seen(ev.Time)
 
 	err = w.db.Save(ctx, dev)
 	return errors.Wrapf(err, "saving updated device for SetBootstrapToken event")
@@ -236,10 +249,14 @@ func (w *Worker) updateFromTokenUpdate(ctx context.Context, message []byte) erro
 		return errors.Wrap(err, "unmarshal checkin event")
 	}
 
-	// do not process managed user, or user enrollment checkin events while updating device records.
-	if ev.Command.UserID != "" || ev.Command.EnrollmentID != "" {
+	// do not process user enrollment checkin events while updating device records.
+	if ev.Command.EnrollmentID != "" {
 		return nil
 	}
+	// a managed user checkin only tells us that the device was seen.
+	if ev.Command.UserID != "" {
+		return w.updateLastSeen(ctx, ev.Command.UDID, ev.Time)
+	}
 
 	dev, err := w.db.DeviceByUDID(ctx, ev.Command.UDID)
 	if err != nil {
@@ -249,7 +266,7 @@ func (w *Worker) updateFromTokenUpdate(ctx context.Context, message []byte) erro
 	dev.PushMagic = ev.Command.PushMagic
 	dev.UnlockToken = ev.Command.UnlockToken.String()
 	dev.AwaitingConfiguration = ev.Command.AwaitingConfiguration
-	dev.LastSeen = time.Now()
+	dev.seen(ev.Time)
 	// first TokenUpdate event will have the enrollment status set to false.
 	newlyEnrolled := !dev.Enrolled
 	dev.Enrolled = true
@@ -306,11 +323,34 @@ func (w *Worker) updateFromAuthenticate(ctx context.Context, message []byte) err
 	device.DeviceName = ev.Command.DeviceName
 	device.Model = ev.Command.Model
 	device.ModelName = ev.Command.ModelName
-	device.LastSeen = time.Now()
+	device.seen(ev.Time)
 	err = w.db.Save(ctx, device)
 	return errors.Wrapf(err, "saving updated device for authenticate event")
 }
 
+func (w *Worker) updateLastSeen(ctx context.Context, udid string, at time.Time) error {
+	dev, err := w.db.DeviceByUDID(ctx, udid)
+	if err != nil {
+		return errors.Wrapf(err, "retrieve device with udid %s", udid)
+	}
+	dev.seen(at)
+	err = w.db.Save(ctx, dev)
+	return errors.Wrapf(err, "saving last seen time for device udid=%s", udid)
+}
+
+// seen records that the device contacted the server at the time of an event.
+// Events without a time are recorded as seen now. LastSeen never moves back
+// in time, in case events are processed out of order.
+func (dev *Device) seen(at time.Time) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	at = at.UTC()
+	if at.After(dev.LastSeen) {
+		dev.LastSeen = at
+	}
+}
+
 func getOrCreateDevice(ctx context.Context, db DeviceWorkerStore, serial, udid string) (dev *Device, reenrolling bool, err error) {
 	if udid != "" {
 		// first try to fetch a device by UDID.
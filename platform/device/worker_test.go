@@ -0,0 +1,191 @@
+package device
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+)
+
+type notFoundErr struct{}
+
+func (notFoundErr) Error() string  { return "not found" }
+func (notFoundErr) NotFound() bool { return true }
+
+type mockWorkerStore struct {
+	mu      sync.Mutex
+	devices map[string]Device
+}
+
+func (s *mockWorkerStore) Save(ctx context.Context, d *Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices[d.UUID] = *d
+	return nil
+}
+
+func (s *mockWorkerStore) find(match func(Device) bool) (*Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.devices {
+		if match(d) {
+			return &d, nil
+		}
+	}
+	return nil, notFoundErr{}
+}
+
+func (s *mockWorkerStore) DeviceByUDID(ctx context.Context, udid string) (*Device, error) {
+	return s.find(func(d Device) bool { return d.UDID == udid })
+}
+
+func (s *mockWorkerStore) DeviceBySerial(ctx context.Context, serial string) (*Device, error) {
+	return s.find(func(d Device) bool { return d.SerialNumber == serial })
+}
+
+func checkin(t *testing.T, messageType string, at time.Time, fn func(*mdm.CheckinCommand)) []byte {
+	t.Helper()
+	cmd := mdm.CheckinCommand{MessageType: messageType, UDID: "UDID"}
+	if fn != nil {
+		fn(&cmd)
+	}
+	msg, err := mdm.MarshalCheckinEvent(&mdm.CheckinEvent{ID: "id", Time: at, Command: cmd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestCheckinLastSeen(t *testing.T) {
+	store := &mockWorkerStore{devices: make(map[string]Device)}
+	w := NewWorker(store, inmem.NewPubSub(), log.NewNopLogger())
+	ctx := context.Background()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	lastSeen := func() time.Time {
+		t.Helper()
+		dev, err := store.DeviceByUDID(ctx, "UDID")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dev.LastSeen
+	}
+
+	authenticate := checkin(t, "Authenticate", start, func(c *mdm.CheckinCommand) { c.SerialNumber = "SERIAL" })
+	if err := w.updateFromAuthenticate(ctx, authenticate); err != nil {
+		t.Fatal(err)
+	}
+	if have := lastSeen(); !have.Equal(start) {
+		t.Errorf("after Authenticate: have LastSeen %s, want %s", have, start)
+	}
+
+	tokenUpdate := start.Add(time.Minute)
+	if err := w.updateFromTokenUpdate(ctx, checkin(t, "TokenUpdate", tokenUpdate, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if have := lastSeen(); !have.Equal(tokenUpdate) {
+		t.Errorf("after TokenUpdate: have LastSeen %s, want %s", have, tokenUpdate)
+	}
+
+	userTokenUpdate := tokenUpdate.Add(time.Minute)
+	msg := checkin(t, "TokenUpdate", userTokenUpdate, func(c *mdm.CheckinCommand) { c.UserID = "USER" })
+	if err := w.updateFromTokenUpdate(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if have := lastSeen(); !have.Equal(userTokenUpdate) {
+		t.Errorf("after user TokenUpdate: have LastSeen %s, want %s", have, userTokenUpdate)
+	}
+
+	// an event which is processed late does not move LastSeen back.
+	if err := w.updateFromTokenUpdate(ctx, checkin(t, "TokenUpdate", start, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if have := lastSeen(); !have.Equal(userTokenUpdate) {
+		t.Errorf("after late TokenUpdate: have LastSeen %s, want %s", have, userTokenUpdate)
+	}
+
+	checkout := userTokenUpdate.Add(time.Hour)
+	if err := w.updateFromCheckout(ctx, checkin(t, "CheckOut", checkout, nil)); err != nil {
+		t.Fatal(err)
+	}
+	dev, err := store.DeviceByUDID(ctx, "UDID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dev.LastSeen.Equal(checkout) || dev.Enrolled {
+		t.Errorf("after CheckOut: have LastSeen %s and enrolled %t, want %s and false", dev.LastSeen, dev.Enrolled, checkout)
+	}
+
+	devices, _, err := New(listStore{store}).ListDevices(ctx, ListDevicesOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || !devices[0].LastSeen.Equal(checkout) {
+		t.Errorf("device API does not report the CheckOut as last seen: %+v", devices)
+	}
+}
+
+type listStore struct{ *mockWorkerStore }
+
+func (s listStore) List(ctx context.Context, opt ListDevicesOption) ([]Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var devices []Device
+	for _, d := range s.devices {
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+func (s listStore) DeleteByUDID(ctx context.Context, udid string) error     { return nil }
+func (s listStore) DeleteBySerial(ctx context.Context, serial string) error { return nil }
+
+func TestCheckoutPublishesUnenrolled(t *testing.T) {
+	store := &mockWorkerStore{devices: make(map[string]Device)}
+	ps := inmem.NewPubSub()
+	w := NewWorker(store, ps, log.NewNopLogger())
+	ctx := context.Background()
+
+	unenrolled, err := ps.Subscribe(ctx, "test", DeviceUnenrolledTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, &Device{UUID: "uuid", UDID: "UDID", Enrolled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkout := checkin(t, "CheckOut", time.Now(), nil)
+	if err := w.updateFromCheckout(ctx, checkout); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-unenrolled:
+		var event mdm.CheckinEvent
+		if err := mdm.UnmarshalCheckinEvent(ev.Message, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Command.UDID != "UDID" {
+			t.Errorf("have unenrolled UDID %s, want UDID", event.Command.UDID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no unenrolled event was published")
+	}
+
+	// the device is kept, but a second CheckOut is not another unenrollment.
+	if err := w.updateFromCheckout(ctx, checkout); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-unenrolled:
+		t.Error("unenrolled event published for a device which was not enrolled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if dev, err := store.DeviceByUDID(ctx, "UDID"); err != nil || dev.Enrolled {
+		t.Errorf("have device %+v, err %v, want an unenrolled device", dev, err)
+	}
+}
@@ -0,0 +1,97 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/platform/identity"
+)
+
+const IdentityBucket = "mdm.DeviceIdentities"
+
+type DB struct {
+	*bolt.DB
+}
+
+func NewDB(db *bolt.DB) (*DB, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(IdentityBucket))
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating %s bucket", IdentityBucket)
+	}
+	datastore := &DB{
+		DB: db,
+	}
+	return datastore, nil
+}
+
+func (db *DB) Identity(ctx context.Context, udid string) (*identity.Identity, error) {
+	var id identity.Identity
+	err := db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(IdentityBucket)).Get([]byte(udid))
+		if v == nil {
+			return &notFound{"Identity", fmt.Sprintf("udid %s", udid)}
+		}
+		return json.Unmarshal(v, &id)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get device identity by udid")
+	}
+	return &id, nil
+}
+
+func (db *DB) Identities(ctx context.Context) ([]identity.Identity, error) {
+	var ids []identity.Identity
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(IdentityBucket)).ForEach(func(k, v []byte) error {
+			var id identity.Identity
+			if err := json.Unmarshal(v, &id); err != nil {
+				return errors.Wrapf(err, "unmarshal device identity of udid %s", k)
+			}
+			ids = append(ids, id)
+			return nil
+		})
+	})
+	return ids, errors.Wrap(err, "list device identities")
+}
+
+func (db *DB) Save(ctx context.Context, id *identity.Identity) error {
+	v, err := json.Marshal(id)
+	if err != nil {
+		return errors.Wrap(err, "marshal device identity")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(IdentityBucket)).Put([]byte(id.UDID), v)
+	})
+	return errors.Wrap(err, "save device identity")
+}
+
+func (db *DB) Delete(ctx context.Context, udid string) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(IdentityBucket))
+		if b.Get([]byte(udid)) == nil {
+			return &notFound{"Identity", fmt.Sprintf("udid %s", udid)}
+		}
+		return b.Delete([]byte(udid))
+	})
+	return errors.Wrapf(err, "delete device identity with udid %s", udid)
+}
+
+type notFound struct {
+	ResourceType string
+	Message      string
+}
+
+func (e *notFound) Error() string {
+	return fmt.Sprintf("not found: %s %s", e.ResourceType, e.Message)
+}
+
+func (e *notFound) NotFound() bool {
+	return true
+}
@@ -0,0 +1,55 @@
+// Package identity tracks the identity certificates devices use to connect to
+// the MDM server, and renews them before they expire.
+package identity
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Identity is the identity certificate a device last connected with.
+type Identity struct {
+	UDID string `json:"udid"`
+	// Certificate is the DER encoded identity certificate.
+	Certificate []byte    `json:"certificate"`
+	NotAfter    time.Time `json:"not_after"`
+
+	// RenewalCommandUUID is the InstallProfile command queued to renew
+	// Certificate. It is cleared when the device connects with a new
+	// certificate, or reports an error for the command, and is replaced
+	// when the renewal is queued again after RenewalTimeout.
+	RenewalCommandUUID string    `json:"renewal_command_uuid,omitempty"`
+	RenewalQueuedAt    time.Time `json:"renewal_queued_at,omitempty"`
+}
+
+// RenewalTimeout is how long a queued renewal is pending. A device which has
+// not renewed its identity by then gets a new renewal, and a certificate it
+// enrolls with the timed out renewal is no longer accepted.
+const RenewalTimeout = 7 * 24 * time.Hour
+
+// renewalPending reports whether a renewal was queued within RenewalTimeout
+// before now.
+func (id *Identity) renewalPending(now time.Time) bool {
+	return id.RenewalCommandUUID != "" && now.Before(id.RenewalQueuedAt.Add(RenewalTimeout))
+}
+
+// Store stores device identities by UDID.
+type Store interface {
+	Identity(ctx context.Context, udid string) (*Identity, error)
+	Identities(ctx context.Context) ([]Identity, error)
+	Save(ctx context.Context, id *Identity) error
+	Delete(ctx context.Context, udid string) error
+}
+
+func isNotFound(err error) bool {
+	err = errors.Cause(err)
+	type notFoundErr interface {
+		error
+		NotFound() bool
+	}
+
+	e, ok := err.(notFoundErr)
+	return ok && e.NotFound()
+}
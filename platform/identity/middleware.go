@@ -0,0 +1,183 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/pkg/ctxlog"
+)
+
+// UDIDCertHashStore saves the certificate hash which UDID cert auth checks
+// device requests against.
+type UDIDCertHashStore interface {
+	SaveUDIDCertHash(udid, certHash []byte) error
+}
+
+// RecordMiddleware records the identity certificate of each device request.
+//
+// When a device with a renewal pending connects with a certificate which was
+// issued after the renewal was queued, and which no other device has
+// connected with, the UDID cert auth hash is replaced before the request is
+// passed on, so the renewed device is not rejected. It must wrap the UDID cert
+// auth middleware and be wrapped by the certificate verification middleware,
+// which checks the new certificate was issued by the SCEP CA.
+func RecordMiddleware(store Store, certAuth UDIDCertHashStore, logger log.Logger, opts ...RecordOption) mdm.Middleware {
+	return func(next mdm.Service) mdm.Service {
+		mw := &recordMiddleware{
+			store:    store,
+			certAuth: certAuth,
+			next:     next,
+			logger:   logger,
+			now:      time.Now,
+		}
+		for _, opt := range opts {
+			opt(mw)
+		}
+		return mw
+	}
+}
+
+// RecordOption configures RecordMiddleware.
+type RecordOption func(*recordMiddleware)
+
+// WithRecordClock sets the function RecordMiddleware gets the current time
+// from, which decides whether a renewal is still pending.
+func WithRecordClock(now func() time.Time) RecordOption {
+	return func(mw *recordMiddleware) {
+		mw.now = now
+	}
+}
+
+type recordMiddleware struct {
+	store    Store
+	certAuth UDIDCertHashStore
+	next     mdm.Service
+	logger   log.Logger
+	now      func() time.Time
+}
+
+func (mw *recordMiddleware) Acknowledge(ctx context.Context, req mdm.AcknowledgeEvent) ([]byte, error) {
+	// only track device enrollments, like UDID cert auth.
+	if req.Response.EnrollmentID != nil {
+		return mw.next.Acknowledge(ctx, req)
+	}
+	udid := req.Response.UDID
+	cert, id, err := mw.prepare(ctx, udid)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := mw.next.Acknowledge(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	if id != nil && id.RenewalCommandUUID != "" && id.RenewalCommandUUID == req.Response.CommandUUID && req.Response.Status == "Error" {
+		level.Info(ctxlog.Logger(ctx, mw.logger)).Log("msg", "device identity renewal failed", "command_uuid", req.Response.CommandUUID)
+		id.RenewalCommandUUID = ""
+		id.RenewalQueuedAt = time.Time{}
+		mw.save(ctx, id)
+		return resp, nil
+	}
+	mw.record(ctx, udid, cert, id)
+	return resp, nil
+}
+
+func (mw *recordMiddleware) Checkin(ctx context.Context, req mdm.CheckinEvent) ([]byte, error) {
+	if req.Command.EnrollmentID != "" {
+		return mw.next.Checkin(ctx, req)
+	}
+	udid := req.Command.UDID
+	cert, id, err := mw.prepare(ctx, udid)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := mw.next.Checkin(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	if req.Command.MessageType == "CheckOut" {
+		if err := mw.store.Delete(ctx, udid); err != nil && !isNotFound(err) {
+			level.Info(ctxlog.Logger(ctx, mw.logger)).Log("msg", "delete device identity", "err", err)
+		}
+		return resp, nil
+	}
+	mw.record(ctx, udid, cert, id)
+	return resp, nil
+}
+
+// prepare returns the certificate of the request and the stored identity of
+// udid, which is nil if there is none. It replaces the UDID cert auth hash if
+// the request is from a device which renewed its identity.
+func (mw *recordMiddleware) prepare(ctx context.Context, udid string) (*x509.Certificate, *Identity, error) {
+	cert, err := mdm.DeviceCertificateFromContext(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error retrieving device certificate")
+	}
+	id, err := mw.store.Identity(ctx, udid)
+	if err != nil && !isNotFound(err) {
+		return nil, nil, err
+	} else if err != nil {
+		return cert, nil, nil
+	}
+	renewed, err := mw.isRenewal(ctx, id, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	if renewed {
+		sum := sha256.Sum256(cert.Raw)
+		if err := mw.certAuth.SaveUDIDCertHash([]byte(udid), sum[:]); err != nil {
+			return nil, nil, errors.Wrap(err, "save renewed device cert hash")
+		}
+		level.Info(ctxlog.Logger(ctx, mw.logger)).Log("msg", "device identity renewed", "not_after", cert.NotAfter)
+	}
+	return cert, id, nil
+}
+
+// isRenewal reports whether cert is the identity the device of id enrolled
+// for its pending renewal: a new certificate which was issued after the
+// renewal was queued, and is not the identity of another device. Every
+// certificate has the same validity, so any device which enrolled later has
+// a certificate expiring after id, and must not be able to take over its UDID.
+func (mw *recordMiddleware) isRenewal(ctx context.Context, id *Identity, cert *x509.Certificate) (bool, error) {
+	if !id.renewalPending(mw.now()) || bytes.Equal(id.Certificate, cert.Raw) {
+		return false, nil
+	}
+	// NotBefore has second precision.
+	if cert.NotBefore.Before(id.RenewalQueuedAt.Truncate(time.Second)) || !cert.NotAfter.After(id.NotAfter) {
+		return false, nil
+	}
+	ids, err := mw.store.Identities(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "list device identities")
+	}
+	for _, other := range ids {
+		if other.UDID != id.UDID && bytes.Equal(other.Certificate, cert.Raw) {
+			level.Info(ctxlog.Logger(ctx, mw.logger)).Log("msg", "rejected device identity renewal with the certificate of another device", "other_udid", other.UDID)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// record saves cert as the identity of udid if it is not the stored one.
+func (mw *recordMiddleware) record(ctx context.Context, udid string, cert *x509.Certificate, id *Identity) {
+	if id != nil && bytes.Equal(id.Certificate, cert.Raw) {
+		return
+	}
+	mw.save(ctx, &Identity{UDID: udid, Certificate: cert.Raw, NotAfter: cert.NotAfter})
+}
+
+// save logs rather than returns errors, so that a device request which was
+// handled does not fail.
+func (mw *recordMiddleware) save(ctx context.Context, id *Identity) {
+	if err := mw.store.Save(ctx, id); err != nil {
+		level.Info(ctxlog.Logger(ctx, mw.logger)).Log("msg", "save device identity", "err", err)
+	}
+}
@@ -0,0 +1,160 @@
+package identity
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/pkg/crypto"
+	"github.com/micromdm/micromdm/platform/command"
+	"github.com/micromdm/micromdm/platform/profile"
+)
+
+// DefaultRenewalInterval is how often a Renewer checks for expiring identities.
+const DefaultRenewalInterval = time.Hour
+
+// ProfileSource provides the enrollment profile which is installed on a device
+// to renew its identity. A new profile is requested for each device, so that
+// each gets its own dynamic SCEP challenge.
+type ProfileSource interface {
+	Enroll(ctx context.Context) (profile.Mobileconfig, error)
+}
+
+// CommandService queues commands for devices.
+type CommandService interface {
+	NewCommand(ctx context.Context, request *mdm.CommandRequest, opts ...command.CommandOption) (*mdm.CommandPayload, error)
+}
+
+// Renewer queues an InstallProfile command of the enrollment profile for
+// devices whose identity certificate expires within the lead time. Installing
+// the profile replaces the MDM payload and enrolls a new identity with SCEP.
+type Renewer struct {
+	store    Store
+	cmdsvc   CommandService
+	profiles ProfileSource
+	leadTime time.Duration
+	interval time.Duration
+	logger   log.Logger
+	now      func() time.Time
+}
+
+// RenewerOption configures a Renewer.
+type RenewerOption func(*Renewer)
+
+// WithInterval sets how often the Renewer checks for expiring identities.
+func WithInterval(d time.Duration) RenewerOption {
+	return func(r *Renewer) {
+		r.interval = d
+	}
+}
+
+// WithClock sets the function the Renewer gets the current time from.
+func WithClock(now func() time.Time) RenewerOption {
+	return func(r *Renewer) {
+		r.now = now
+	}
+}
+
+// NewRenewer creates a Renewer which renews identities expiring within leadTime.
+func NewRenewer(store Store, cmdsvc CommandService, profiles ProfileSource, leadTime time.Duration, logger log.Logger, opts ...RenewerOption) *Renewer {
+	r := &Renewer{
+		store:    store,
+		cmdsvc:   cmdsvc,
+		profiles: profiles,
+		leadTime: leadTime,
+		interval: DefaultRenewalInterval,
+		logger:   logger,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run renews expiring identities every interval until ctx is done.
+func (r *Renewer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RenewExpiring(ctx); err != nil {
+			level.Info(r.logger).Log("msg", "renew expiring device identities", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RenewExpiring queues a renewal for each identity which expires within the
+// lead time and does not have one pending. It returns the number queued.
+func (r *Renewer) RenewExpiring(ctx context.Context) (int, error) {
+	ids, err := r.store.Identities(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "list device identities")
+	}
+	now := r.now()
+	expiry := crypto.ExpiryChecker{Now: r.now}
+	var queued int
+	for i := range ids {
+		id := &ids[i]
+		if id.renewalPending(now) {
+			continue
+		}
+		if id.RenewalCommandUUID != "" {
+			level.Info(r.logger).Log(
+				"msg", "device identity renewal timed out",
+				"udid", id.UDID,
+				"command_uuid", id.RenewalCommandUUID,
+				"queued_at", id.RenewalQueuedAt,
+			)
+		}
+		cert, err := x509.ParseCertificate(id.Certificate)
+		if err != nil {
+			level.Info(r.logger).Log("msg", "parse device identity", "udid", id.UDID, "err", err)
+			continue
+		}
+		if !expiry.ExpiresWithin(cert, r.leadTime) {
+			continue
+		}
+		if err := r.renew(ctx, id); err != nil {
+			level.Info(r.logger).Log("msg", "renew device identity", "udid", id.UDID, "err", err)
+			continue
+		}
+		level.Info(r.logger).Log(
+			"msg", "queued device identity renewal",
+			"udid", id.UDID,
+			"not_after", id.NotAfter,
+			"command_uuid", id.RenewalCommandUUID,
+		)
+		queued++
+	}
+	return queued, nil
+}
+
+func (r *Renewer) renew(ctx context.Context, id *Identity) error {
+	enrollProfile, err := r.profiles.Enroll(ctx)
+	if err != nil {
+		return errors.Wrap(err, "get enrollment profile")
+	}
+	payload, err := r.cmdsvc.NewCommand(ctx, &mdm.CommandRequest{
+		UDID: id.UDID,
+		Command: &mdm.Command{
+			RequestType:    "InstallProfile",
+			InstallProfile: &mdm.InstallProfile{Payload: enrollProfile},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "queue InstallProfile")
+	}
+	id.RenewalCommandUUID = payload.CommandUUID
+	id.RenewalQueuedAt = r.now()
+	return errors.Wrap(r.store.Save(ctx, id), "save device identity")
+}
@@ -0,0 +1,227 @@
+package identity_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-kit/kit/log"
+
+	mdmsvc "github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/pkg/crypto"
+	"github.com/micromdm/micromdm/platform/command"
+	"github.com/micromdm/micromdm/platform/identity"
+	"github.com/micromdm/micromdm/platform/identity/builtin"
+	"github.com/micromdm/micromdm/platform/profile"
+)
+
+func setupDB(t *testing.T) *builtin.DB {
+	f, _ := ioutil.TempFile("", "bolt-")
+	f.Close()
+	os.Remove(f.Name())
+	db, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatalf("couldn't open bolt, err %s\n", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(f.Name())
+	})
+	store, err := builtin.NewDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func newCert(t *testing.T, days int) *x509.Certificate {
+	t.Helper()
+	_, cert, err := crypto.SimpleSelfSignedECDSAKeypair("MicroMDM Identity", elliptic.P256(), days)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+type enrollProfile []byte
+
+func (p enrollProfile) Enroll(context.Context) (profile.Mobileconfig, error) {
+	return profile.Mobileconfig(p), nil
+}
+
+type commandRecorder []*mdm.CommandRequest
+
+func (r *commandRecorder) NewCommand(ctx context.Context, req *mdm.CommandRequest, opts ...command.CommandOption) (*mdm.CommandPayload, error) {
+	*r = append(*r, req)
+	return mdm.NewCommandPayload(req)
+}
+
+func TestRenewExpiring(t *testing.T) {
+	store := setupDB(t)
+	ctx := context.Background()
+	for udid, days := range map[string]int{"EXPIRING": 10, "VALID": 90} {
+		cert := newCert(t, days)
+		if err := store.Save(ctx, &identity.Identity{UDID: udid, Certificate: cert.Raw, NotAfter: cert.NotAfter}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var commands commandRecorder
+	renewer := identity.NewRenewer(store, &commands, enrollProfile("enroll"), 30*24*time.Hour, log.NewNopLogger())
+	n, err := renewer.RenewExpiring(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(commands) != 1 {
+		t.Fatalf("queued %d renewals, want 1 for the certificate within the lead time", len(commands))
+	}
+	req := commands[0]
+	if req.UDID != "EXPIRING" || req.Command.RequestType != "InstallProfile" || string(req.Command.InstallProfile.Payload) != "enroll" {
+		t.Errorf("unexpected renewal command for %s: %+v", req.UDID, req.Command)
+	}
+	id, err := store.Identity(ctx, "EXPIRING")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.RenewalCommandUUID == "" || id.RenewalQueuedAt.IsZero() {
+		t.Errorf("expected the renewal to be saved, have %+v", id)
+	}
+	if id, _ := store.Identity(ctx, "VALID"); id.RenewalCommandUUID != "" {
+		t.Errorf("expected no renewal for the certificate outside the lead time, have %+v", id)
+	}
+
+	if n, err := renewer.RenewExpiring(ctx); err != nil || n != 0 {
+		t.Errorf("queued %d renewals with error %v, want none while a renewal is queued", n, err)
+	}
+
+	timedOut := identity.NewRenewer(store, &commands, enrollProfile("enroll"), 30*24*time.Hour, log.NewNopLogger(),
+		identity.WithClock(func() time.Time { return time.Now().Add(identity.RenewalTimeout + time.Hour) }))
+	if n, err := timedOut.RenewExpiring(ctx); err != nil || n != 1 || commands[len(commands)-1].UDID != "EXPIRING" {
+		t.Errorf("queued %d renewals with error %v, want 1 once the renewal timed out", n, err)
+	}
+	retried, err := store.Identity(ctx, "EXPIRING")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.RenewalCommandUUID == id.RenewalCommandUUID || !retried.RenewalQueuedAt.After(id.RenewalQueuedAt) {
+		t.Errorf("expected a new renewal to be saved, have %+v", retried)
+	}
+
+	later := identity.NewRenewer(store, &commands, enrollProfile("enroll"), 30*24*time.Hour, log.NewNopLogger(),
+		identity.WithClock(func() time.Time { return time.Now().AddDate(0, 0, 75) }))
+	// the renewal of EXPIRING has timed out again by then.
+	if n, err := later.RenewExpiring(ctx); err != nil || n != 2 {
+		t.Errorf("queued %d renewals with error %v, want 2 once the certificate is within the lead time", n, err)
+	}
+	if id, _ := store.Identity(ctx, "VALID"); id.RenewalCommandUUID == "" {
+		t.Errorf("expected a renewal for the certificate within the lead time, have %+v", id)
+	}
+}
+
+type certHashRecorder map[string][]byte
+
+func (r certHashRecorder) SaveUDIDCertHash(udid, certHash []byte) error {
+	r[string(udid)] = certHash
+	return nil
+}
+
+type nopService struct{ mdmsvc.Service }
+
+func (nopService) Checkin(context.Context, mdmsvc.CheckinEvent) ([]byte, error) { return nil, nil }
+
+func (nopService) Acknowledge(context.Context, mdmsvc.AcknowledgeEvent) ([]byte, error) {
+	return nil, nil
+}
+
+func TestRecordMiddleware(t *testing.T) {
+	store := setupDB(t)
+	hashes := certHashRecorder{}
+	now := time.Now()
+	svc := identity.RecordMiddleware(store, hashes, log.NewNopLogger(),
+		identity.WithRecordClock(func() time.Time { return now }))(nopService{})
+
+	checkin := func(udid string, cert *x509.Certificate, messageType string) {
+		t.Helper()
+		ctx := context.WithValue(context.Background(), mdmsvc.ContextKeyDeviceCertificate, cert)
+		ev := mdmsvc.CheckinEvent{Command: mdmsvc.CheckinCommand{UDID: udid, MessageType: messageType}}
+		if _, err := svc.Checkin(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := newCert(t, 10)
+	// queueRenewal resets the identity of UDID-1, which nopService does not
+	// protect with UDID cert auth, and queues its renewal at queuedAt.
+	queueRenewal := func(queuedAt time.Time) {
+		t.Helper()
+		id := &identity.Identity{
+			UDID:               "UDID-1",
+			Certificate:        old.Raw,
+			NotAfter:           old.NotAfter,
+			RenewalCommandUUID: "renewal",
+			RenewalQueuedAt:    queuedAt,
+		}
+		if err := store.Save(context.Background(), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkin("UDID-1", old, "Authenticate")
+	id, err := store.Identity(context.Background(), "UDID-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(id.Certificate, old.Raw) || !id.NotAfter.Equal(old.NotAfter) {
+		t.Fatalf("expected the identity to be recorded, have %+v", id)
+	}
+
+	// a certificate newer than the identity is not accepted once its renewal timed out.
+	renewed := newCert(t, 365)
+	queueRenewal(now.Add(-identity.RenewalTimeout - time.Hour))
+	checkin("UDID-1", renewed, "TokenUpdate")
+	if _, ok := hashes["UDID-1"]; ok {
+		t.Error("expected the UDID cert hash to be kept for a renewal which timed out")
+	}
+
+	// nor is one which was issued before the renewal was queued.
+	queueRenewal(renewed.NotBefore.Add(time.Minute))
+	checkin("UDID-1", renewed, "TokenUpdate")
+	if _, ok := hashes["UDID-1"]; ok {
+		t.Error("expected the UDID cert hash to be kept for a certificate issued before the renewal")
+	}
+
+	// nor the newer certificate of another device.
+	queueRenewal(renewed.NotBefore.Add(-time.Minute))
+	other := newCert(t, 365)
+	checkin("UDID-2", other, "Authenticate")
+	checkin("UDID-1", other, "TokenUpdate")
+	if _, ok := hashes["UDID-1"]; ok {
+		t.Error("expected the UDID cert hash to be kept for the certificate of another device")
+	}
+
+	queueRenewal(renewed.NotBefore.Add(-time.Minute))
+
+	checkin("UDID-1", renewed, "TokenUpdate")
+	if sum := sha256.Sum256(renewed.Raw); !bytes.Equal(hashes["UDID-1"], sum[:]) {
+		t.Error("expected the UDID cert hash to be replaced with the renewed certificate")
+	}
+	id, err = store.Identity(context.Background(), "UDID-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(id.Certificate, renewed.Raw) || id.RenewalCommandUUID != "" {
+		t.Errorf("expected the renewed identity without a queued renewal, have %+v", id)
+	}
+
+	checkin("UDID-1", renewed, "CheckOut")
+	if _, err := store.Identity(context.Background(), "UDID-1"); err == nil {
+		t.Error("expected the identity to be deleted on CheckOut")
+	}
+}
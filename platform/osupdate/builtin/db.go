@@ -0,0 +1,131 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/platform/osupdate"
+)
+
+const (
+	OSUpdateBucket = "mdm.AvailableOSUpdates"
+	ScheduleBucket = "mdm.OSUpdateSchedules"
+)
+
+// DB stores the updates available to each device as a JSON list, and the
+// schedule of each device, keyed by UDID.
+type DB struct {
+	*bolt.DB
+}
+
+func NewDB(db *bolt.DB) (*DB, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range []string{OSUpdateBucket, ScheduleBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return errors.Wrapf(err, "creating %s bucket", bucket)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	datastore := &DB{
+		DB: db,
+	}
+	return datastore, nil
+}
+
+func (db *DB) SaveUpdates(ctx context.Context, udid string, updates []osupdate.Update) error {
+	v, err := json.Marshal(updates)
+	if err != nil {
+		return errors.Wrap(err, "marshal available os updates")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(OSUpdateBucket)).Put([]byte(udid), v)
+	})
+	return errors.Wrap(err, "save available os updates")
+}
+
+func (db *DB) DeviceUpdates(ctx context.Context, udid string) ([]osupdate.Update, error) {
+	var updates []osupdate.Update
+	err := db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(OSUpdateBucket)).Get([]byte(udid))
+		if v == nil {
+			return nil
+		}
+		return json.Unmarshal(v, &updates)
+	})
+	return updates, errors.Wrapf(err, "get available os updates of udid %s", udid)
+}
+
+func (db *DB) Updates(ctx context.Context) ([]osupdate.Update, error) {
+	var updates []osupdate.Update
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(OSUpdateBucket)).ForEach(func(k, v []byte) error {
+			var device []osupdate.Update
+			if err := json.Unmarshal(v, &device); err != nil {
+				return errors.Wrapf(err, "unmarshal available os updates of udid %s", k)
+			}
+			updates = append(updates, device...)
+			return nil
+		})
+	})
+	return updates, errors.Wrap(err, "list available os updates")
+}
+
+func (db *DB) DeleteUpdates(ctx context.Context, udid string) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(OSUpdateBucket)).Delete([]byte(udid))
+	})
+	return errors.Wrapf(err, "delete available os updates of udid %s", udid)
+}
+
+func (db *DB) SaveSchedule(ctx context.Context, s *osupdate.Schedule) error {
+	v, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "marshal os update schedule")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(ScheduleBucket)).Put([]byte(s.UDID), v)
+	})
+	return errors.Wrap(err, "save os update schedule")
+}
+
+func (db *DB) DeviceSchedule(ctx context.Context, udid string) (*osupdate.Schedule, error) {
+	var s *osupdate.Schedule
+	err := db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(ScheduleBucket)).Get([]byte(udid))
+		if v == nil {
+			return nil
+		}
+		s = new(osupdate.Schedule)
+		return json.Unmarshal(v, s)
+	})
+	return s, errors.Wrapf(err, "get os update schedule of udid %s", udid)
+}
+
+func (db *DB) Schedules(ctx context.Context) ([]osupdate.Schedule, error) {
+	var schedules []osupdate.Schedule
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(ScheduleBucket)).ForEach(func(k, v []byte) error {
+			var s osupdate.Schedule
+			if err := json.Unmarshal(v, &s); err != nil {
+				return errors.Wrapf(err, "unmarshal os update schedule of udid %s", k)
+			}
+			schedules = append(schedules, s)
+			return nil
+		})
+	})
+	return schedules, errors.Wrap(err, "list os update schedules")
+}
+
+func (db *DB) DeleteSchedule(ctx context.Context, udid string) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(ScheduleBucket)).Delete([]byte(udid))
+	})
+	return errors.Wrapf(err, "delete os update schedule of udid %s", udid)
+}
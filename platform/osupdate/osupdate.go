@@ -0,0 +1,147 @@
+// Package osupdate stores the OS updates available to each device, from the
+// responses of devices to the AvailableOSUpdates command, and schedules
+// updates with the ScheduleOSUpdate command.
+package osupdate
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/groob/plist"
+	"github.com/pkg/errors"
+)
+
+// Update is an OS update available to a device.
+type Update struct {
+	UDID               string    `json:"udid"`
+	ProductKey         string    `json:"product_key"`
+	HumanReadableName  string    `json:"human_readable_name"`
+	Version            string    `json:"version"`
+	Build              string    `json:"build,omitempty"`
+	DownloadSize       int64     `json:"download_size,omitempty"`
+	InstallSize        int64     `json:"install_size,omitempty"`
+	IsCritical         bool      `json:"is_critical"`
+	IsConfigDataUpdate bool      `json:"is_config_data_update"`
+	IsFirmwareUpdate   bool      `json:"is_firmware_update"`
+	IsMajorOSUpdate    bool      `json:"is_major_os_update"`
+	RestartRequired    bool      `json:"restart_required"`
+	AllowsInstallLater bool      `json:"allows_install_later"`
+	ReportedAt         time.Time `json:"reported_at"`
+}
+
+// Store stores the updates available to each device, and the updates
+// scheduled on them.
+type Store interface {
+	ScheduleStore
+
+	// SaveUpdates replaces the updates available to udid.
+	SaveUpdates(ctx context.Context, udid string, updates []Update) error
+	DeviceUpdates(ctx context.Context, udid string) ([]Update, error)
+	Updates(ctx context.Context) ([]Update, error)
+	DeleteUpdates(ctx context.Context, udid string) error
+}
+
+type availableOSUpdatesResponse struct {
+	AvailableOSUpdates *[]availableOSUpdate
+}
+
+type availableOSUpdate struct {
+	ProductKey         string
+	HumanReadableName  string
+	Version            string
+	Build              string
+	DownloadSize       int64
+	InstallSize        int64
+	IsCritical         bool
+	IsConfigDataUpdate bool
+	IsFirmwareUpdate   bool
+	IsMajorOSUpdate    bool
+	RestartRequired    bool
+	AllowsInstallLater bool
+}
+
+// ParseResponse parses the updates available to udid from the raw plist of
+// its response to an AvailableOSUpdates command, which was reported at the
+// given time. It reports false if raw is not an AvailableOSUpdates response.
+func ParseResponse(udid string, raw []byte, at time.Time) ([]Update, bool, error) {
+	var resp availableOSUpdatesResponse
+	if err := plist.Unmarshal(raw, &resp); err != nil {
+		return nil, false, errors.Wrap(err, "unmarshal AvailableOSUpdates response")
+	}
+	if resp.AvailableOSUpdates == nil {
+		return nil, false, nil
+	}
+	updates := make([]Update, 0, len(*resp.AvailableOSUpdates))
+	for _, u := range *resp.AvailableOSUpdates {
+		updates = append(updates, Update{
+			UDID:               udid,
+			ProductKey:         u.ProductKey,
+			HumanReadableName:  u.HumanReadableName,
+			Version:            u.Version,
+			Build:              u.Build,
+			DownloadSize:       u.DownloadSize,
+			InstallSize:        u.InstallSize,
+			IsCritical:         u.IsCritical,
+			IsConfigDataUpdate: u.IsConfigDataUpdate,
+			IsFirmwareUpdate:   u.IsFirmwareUpdate,
+			IsMajorOSUpdate:    u.IsMajorOSUpdate,
+			RestartRequired:    u.RestartRequired,
+			AllowsInstallLater: u.AllowsInstallLater,
+			ReportedAt:         at,
+		})
+	}
+	return updates, true, nil
+}
+
+// ReportEntry is an update and the devices it is available to.
+type ReportEntry struct {
+	ProductKey        string   `json:"product_key"`
+	HumanReadableName string   `json:"human_readable_name"`
+	Version           string   `json:"version"`
+	Build             string   `json:"build,omitempty"`
+	IsCritical        bool     `json:"is_critical"`
+	IsMajorOSUpdate   bool     `json:"is_major_os_update"`
+	UDIDs             []string `json:"udids"`
+}
+
+// NewReport groups updates by product key, version and build, and lists the
+// devices each is available to. Entries are sorted by product key and version.
+func NewReport(updates []Update) []ReportEntry {
+	type key struct{ productKey, version, build string }
+	entries := make(map[key]*ReportEntry)
+	var keys []key
+	for _, u := range updates {
+		k := key{u.ProductKey, u.Version, u.Build}
+		e, ok := entries[k]
+		if !ok {
+			e = &ReportEntry{
+				ProductKey:        u.ProductKey,
+				HumanReadableName: u.HumanReadableName,
+				Version:           u.Version,
+				Build:             u.Build,
+				IsCritical:        u.IsCritical,
+				IsMajorOSUpdate:   u.IsMajorOSUpdate,
+			}
+			entries[k] = e
+			keys = append(keys, k)
+		}
+		e.UDIDs = append(e.UDIDs, u.UDID)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].productKey != keys[j].productKey {
+			return keys[i].productKey < keys[j].productKey
+		}
+		if keys[i].version != keys[j].version {
+			return keys[i].version < keys[j].version
+		}
+		return keys[i].build < keys[j].build
+	})
+	report := make([]ReportEntry, 0, len(keys))
+	for _, k := range keys {
+		e := entries[k]
+		sort.Strings(e.UDIDs)
+		report = append(report, *e)
+	}
+	return report
+}
@@ -0,0 +1,85 @@
+package osupdate
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseResponse(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/available_os_updates.plist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2022, 7, 21, 10, 0, 0, 0, time.UTC)
+	updates, ok, err := ParseResponse("UDID-1", raw, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("have ok false for an AvailableOSUpdates response")
+	}
+	want := []Update{
+		{
+			UDID:               "UDID-1",
+			ProductKey:         "012-40839",
+			HumanReadableName:  "macOS Monterey 12.5",
+			Version:            "12.5",
+			Build:              "21G72",
+			DownloadSize:       1386216522,
+			InstallSize:        1386216522,
+			IsCritical:         true,
+			RestartRequired:    true,
+			AllowsInstallLater: true,
+			ReportedAt:         at,
+		},
+		{
+			UDID:               "UDID-1",
+			ProductKey:         "012-44262",
+			HumanReadableName:  "XProtectPlistConfigData",
+			Version:            "2160",
+			IsConfigDataUpdate: true,
+			ReportedAt:         at,
+		},
+	}
+	if !reflect.DeepEqual(updates, want) {
+		t.Errorf("have updates\n%+v\nwant\n%+v", updates, want)
+	}
+}
+
+func TestParseResponseWithoutUpdates(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		raw  string
+		ok   bool
+	}{
+		{"other command", `<plist version="1.0"><dict><key>Status</key><string>Acknowledged</string></dict></plist>`, false},
+		{"no updates", `<plist version="1.0"><dict><key>AvailableOSUpdates</key><array/></dict></plist>`, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			updates, ok, err := ParseResponse("UDID-1", []byte(tt.raw), time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok || len(updates) != 0 {
+				t.Errorf("have %d updates and ok %v, want none and ok %v", len(updates), ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	updates := []Update{
+		{UDID: "UDID-2", ProductKey: "012-40839", Version: "12.5", Build: "21G72"},
+		{UDID: "UDID-1", ProductKey: "012-44262", Version: "2160"},
+		{UDID: "UDID-1", ProductKey: "012-40839", Version: "12.5", Build: "21G72"},
+	}
+	want := []ReportEntry{
+		{ProductKey: "012-40839", Version: "12.5", Build: "21G72", UDIDs: []string{"UDID-1", "UDID-2"}},
+		{ProductKey: "012-44262", Version: "2160", UDIDs: []string{"UDID-1"}},
+	}
+	if report := NewReport(updates); !reflect.DeepEqual(report, want) {
+		t.Errorf("have report\n%+v\nwant\n%+v", report, want)
+	}
+}
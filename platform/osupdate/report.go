@@ -0,0 +1,101 @@
+package osupdate
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/platform/audit"
+)
+
+var errEmptyRequest = errors.New("request must contain a UDID")
+
+type queueRequest struct {
+	UDID string
+}
+
+func (r queueRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: "AvailableOSUpdates", UDIDs: []string{r.UDID}}
+}
+
+type queueResponse struct {
+	CommandUUID string `json:"command_uuid,omitempty"`
+	Err         error  `json:"error,omitempty"`
+}
+
+func (r queueResponse) Failed() error   { return r.Err }
+func (r queueResponse) StatusCode() int { return http.StatusCreated }
+
+func decodeQueueRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return queueRequest{UDID: mux.Vars(r)["udid"]}, nil
+}
+
+// MakeQueueEndpoint creates an endpoint which asks a device for its available OS updates.
+func MakeQueueEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(queueRequest)
+		if req.UDID == "" {
+			return queueResponse{Err: errEmptyRequest}, nil
+		}
+		payload, err := svc.QueueAvailableOSUpdates(ctx, req.UDID)
+		if err != nil {
+			return queueResponse{Err: err}, nil
+		}
+		return queueResponse{CommandUUID: payload.CommandUUID}, nil
+	}
+}
+
+type deviceUpdatesRequest struct {
+	UDID string
+}
+
+type deviceUpdatesResponse struct {
+	Updates []Update `json:"updates"`
+	Err     error    `json:"error,omitempty"`
+}
+
+func (r deviceUpdatesResponse) Failed() error { return r.Err }
+
+func decodeDeviceUpdatesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return deviceUpdatesRequest{UDID: mux.Vars(r)["udid"]}, nil
+}
+
+// MakeDeviceUpdatesEndpoint creates an endpoint which lists the updates available to a device.
+func MakeDeviceUpdatesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deviceUpdatesRequest)
+		if req.UDID == "" {
+			return deviceUpdatesResponse{Err: errEmptyRequest}, nil
+		}
+		updates, err := svc.DeviceUpdates(ctx, req.UDID)
+		return deviceUpdatesResponse{Updates: updates, Err: err}, nil
+	}
+}
+
+type reportRequest struct {
+	ProductKey string
+}
+
+type reportResponse struct {
+	Updates []ReportEntry `json:"updates"`
+	Err     error         `json:"error,omitempty"`
+}
+
+func (r reportResponse) Failed() error { return r.Err }
+
+// decodeReportRequest reads the optional product_key query parameter.
+func decodeReportRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return reportRequest{ProductKey: r.URL.Query().Get("product_key")}, nil
+}
+
+// MakeReportEndpoint creates an endpoint which lists devices by available update.
+func MakeReportEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(reportRequest)
+		report, err := svc.Report(ctx, req.ProductKey)
+		return reportResponse{Updates: report, Err: err}, nil
+	}
+}
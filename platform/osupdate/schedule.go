@@ -0,0 +1,159 @@
+package osupdate
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/platform/audit"
+)
+
+// OSUpdateRequest is an update to schedule on a device, and how to install it.
+type OSUpdateRequest struct {
+	ProductKey     string `json:"product_key,omitempty"`
+	ProductVersion string `json:"product_version,omitempty"`
+	// InstallAction is one of the mdm.InstallAction constants, such as
+	// mdm.InstallActionDownloadOnly. It defaults to mdm.InstallActionDefault.
+	InstallAction string `json:"install_action,omitempty"`
+}
+
+// The status of a Schedule is the status of the last response of the device
+// to its ScheduleOSUpdate command, or Queued if it has not responded.
+const (
+	ScheduleQueued       = "Queued"
+	ScheduleAcknowledged = "Acknowledged"
+	ScheduleError        = "Error"
+	ScheduleNotNow       = "NotNow"
+)
+
+// Schedule records the last ScheduleOSUpdate command queued for a device.
+// A command the device responds to with NotNow is queued again at
+// NextAttemptAt, until it has been queued MaxAttempts times.
+type Schedule struct {
+	UDID          string            `json:"udid"`
+	CommandUUID   string            `json:"command_uuid"`
+	Updates       []OSUpdateRequest `json:"updates"`
+	Status        string            `json:"status"`
+	Attempts      int               `json:"attempts"`
+	ScheduledAt   time.Time         `json:"scheduled_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	NextAttemptAt time.Time         `json:"next_attempt_at"`
+}
+
+// ScheduleStore stores the last Schedule of each device.
+type ScheduleStore interface {
+	// SaveSchedule replaces the schedule of s.UDID.
+	SaveSchedule(ctx context.Context, s *Schedule) error
+	// DeviceSchedule returns nil if no schedule is stored for udid.
+	DeviceSchedule(ctx context.Context, udid string) (*Schedule, error)
+	Schedules(ctx context.Context) ([]Schedule, error)
+	DeleteSchedule(ctx context.Context, udid string) error
+}
+
+func newScheduleOSUpdateCommand(updates []OSUpdateRequest) (*mdm.Command, error) {
+	osUpdates := make([]mdm.OSUpdate, 0, len(updates))
+	for _, u := range updates {
+		osUpdates = append(osUpdates, mdm.OSUpdate{
+			ProductKey:     u.ProductKey,
+			ProductVersion: u.ProductVersion,
+			InstallAction:  u.InstallAction,
+		})
+	}
+	return mdm.NewScheduleOSUpdateCommand(osUpdates)
+}
+
+// queueSchedule queues the ScheduleOSUpdate command of s and saves s as Queued.
+func queueSchedule(ctx context.Context, store ScheduleStore, cmdsvc CommandService, s *Schedule, now time.Time) error {
+	cmd, err := newScheduleOSUpdateCommand(s.Updates)
+	if err != nil {
+		return err
+	}
+	payload, err := cmdsvc.NewCommand(ctx, &mdm.CommandRequest{UDID: s.UDID, Command: cmd})
+	if err != nil {
+		return errors.Wrap(err, "queue ScheduleOSUpdate command")
+	}
+	s.CommandUUID = payload.CommandUUID
+	s.Status = ScheduleQueued
+	s.Attempts++
+	s.UpdatedAt = now
+	s.NextAttemptAt = time.Time{}
+	return errors.Wrap(store.SaveSchedule(ctx, s), "save ScheduleOSUpdate schedule")
+}
+
+type scheduleRequest struct {
+	UDID    string            `json:"-"`
+	Updates []OSUpdateRequest `json:"updates"`
+}
+
+func (r scheduleRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: "ScheduleOSUpdate", UDIDs: []string{r.UDID}}
+}
+
+type scheduleResponse struct {
+	*Schedule
+	Err error `json:"error,omitempty"`
+}
+
+func (r scheduleResponse) Failed() error   { return r.Err }
+func (r scheduleResponse) StatusCode() int { return http.StatusCreated }
+
+func decodeScheduleRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req scheduleRequest
+	if err := httputil.DecodeJSONRequest(r, &req); err != nil {
+		return nil, err
+	}
+	req.UDID = mux.Vars(r)["udid"]
+	return req, nil
+}
+
+// MakeScheduleEndpoint creates an endpoint which schedules OS updates on a device.
+func MakeScheduleEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(scheduleRequest)
+		s, err := svc.QueueScheduleOSUpdate(ctx, req.UDID, req.Updates)
+		return scheduleResponse{Schedule: s, Err: err}, nil
+	}
+}
+
+type deviceScheduleRequest struct {
+	UDID string
+}
+
+type deviceScheduleResponse struct {
+	*Schedule
+	Err error `json:"error,omitempty"`
+}
+
+func (r deviceScheduleResponse) Failed() error { return r.Err }
+
+func decodeDeviceScheduleRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return deviceScheduleRequest{UDID: mux.Vars(r)["udid"]}, nil
+}
+
+// MakeDeviceScheduleEndpoint creates an endpoint which returns the last schedule of a device.
+func MakeDeviceScheduleEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deviceScheduleRequest)
+		if req.UDID == "" {
+			return deviceScheduleResponse{Err: errEmptyRequest}, nil
+		}
+		s, err := svc.DeviceSchedule(ctx, req.UDID)
+		if err == nil && s == nil {
+			err = errScheduleNotFound
+		}
+		return deviceScheduleResponse{Schedule: s, Err: err}, nil
+	}
+}
+
+var errScheduleNotFound error = scheduleNotFoundError{}
+
+type scheduleNotFoundError struct{}
+
+func (scheduleNotFoundError) Error() string   { return "os update schedule not found" }
+func (scheduleNotFoundError) StatusCode() int { return http.StatusNotFound }
@@ -0,0 +1,71 @@
+package osupdate
+
+import (
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+
+	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
+)
+
+type Endpoints struct {
+	QueueEndpoint          endpoint.Endpoint
+	ScheduleEndpoint       endpoint.Endpoint
+	DeviceScheduleEndpoint endpoint.Endpoint
+	ReportEndpoint         endpoint.Endpoint
+	DeviceUpdatesEndpoint  endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
+	return Endpoints{
+		QueueEndpoint:          endpoint.Chain(outer, others...)(scope.Require(scope.CommandsWrite)(MakeQueueEndpoint(s))),
+		ScheduleEndpoint:       endpoint.Chain(outer, others...)(scope.Require(scope.CommandsWrite)(MakeScheduleEndpoint(s))),
+		DeviceScheduleEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.DevicesRead)(MakeDeviceScheduleEndpoint(s))),
+		ReportEndpoint:         endpoint.Chain(outer, others...)(scope.Require(scope.DevicesRead)(MakeReportEndpoint(s))),
+		DeviceUpdatesEndpoint:  endpoint.Chain(outer, others...)(scope.Require(scope.DevicesRead)(MakeDeviceUpdatesEndpoint(s))),
+	}
+}
+
+func RegisterHTTPHandlers(r *mux.Router, e Endpoints, options ...httptransport.ServerOption) {
+	// GET		/v1/os_updates					list devices by available OS update
+	// GET		/v1/devices/:udid/os_updates	list the OS updates available to a device
+	// POST		/v1/devices/:udid/os_updates	ask a device for its available OS updates
+	// POST		/v1/devices/:udid/os_updates/schedule	schedule OS updates on a device
+	// GET		/v1/devices/:udid/os_updates/schedule	get the last OS update schedule of a device
+
+	r.Methods("GET").Path("/v1/os_updates").Handler(httptransport.NewServer(
+		e.ReportEndpoint,
+		decodeReportRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("GET").Path("/v1/devices/{udid}/os_updates").Handler(httptransport.NewServer(
+		e.DeviceUpdatesEndpoint,
+		decodeDeviceUpdatesRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("POST").Path("/v1/devices/{udid}/os_updates").Handler(httptransport.NewServer(
+		e.QueueEndpoint,
+		decodeQueueRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("POST").Path("/v1/devices/{udid}/os_updates/schedule").Handler(httptransport.NewServer(
+		e.ScheduleEndpoint,
+		decodeScheduleRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+
+	r.Methods("GET").Path("/v1/devices/{udid}/os_updates/schedule").Handler(httptransport.NewServer(
+		e.DeviceScheduleEndpoint,
+		decodeDeviceScheduleRequest,
+		httputil.EncodeJSONResponse,
+		options...,
+	))
+}
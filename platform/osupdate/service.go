@@ -0,0 +1,88 @@
+package osupdate
+
+import (
+	"context"
+	"time"
+
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/platform/command"
+)
+
+type Service interface {
+	// QueueAvailableOSUpdates queues an AvailableOSUpdates command for the
+	// device with udid. The updates it reports are saved by the Worker.
+	QueueAvailableOSUpdates(ctx context.Context, udid string) (*mdm.CommandPayload, error)
+	// QueueScheduleOSUpdate queues a ScheduleOSUpdate command of updates for
+	// the device with udid, and records it as the schedule of the device.
+	QueueScheduleOSUpdate(ctx context.Context, udid string, updates []OSUpdateRequest) (*Schedule, error)
+	// DeviceSchedule returns the last schedule of the device with udid, or
+	// nil if none was queued.
+	DeviceSchedule(ctx context.Context, udid string) (*Schedule, error)
+	DeviceUpdates(ctx context.Context, udid string) ([]Update, error)
+	// Report lists the devices by the updates available to them. If
+	// productKey is not empty, only updates with that product key are listed.
+	Report(ctx context.Context, productKey string) ([]ReportEntry, error)
+}
+
+// CommandService queues commands for devices.
+type CommandService interface {
+	NewCommand(ctx context.Context, request *mdm.CommandRequest, opts ...command.CommandOption) (*mdm.CommandPayload, error)
+	DeleteCommand(ctx context.Context, udid, uuid string) error
+}
+
+type OSUpdateService struct {
+	store  Store
+	cmdsvc CommandService
+}
+
+func New(store Store, cmdsvc CommandService) *OSUpdateService {
+	return &OSUpdateService{store: store, cmdsvc: cmdsvc}
+}
+
+func (svc *OSUpdateService) QueueAvailableOSUpdates(ctx context.Context, udid string) (*mdm.CommandPayload, error) {
+	return svc.cmdsvc.NewCommand(ctx, &mdm.CommandRequest{
+		UDID:    udid,
+		Command: mdm.NewAvailableOSUpdatesCommand(),
+	})
+}
+
+func (svc *OSUpdateService) QueueScheduleOSUpdate(ctx context.Context, udid string, updates []OSUpdateRequest) (*Schedule, error) {
+	if udid == "" {
+		return nil, errEmptyRequest
+	}
+	now := time.Now().UTC()
+	s := &Schedule{
+		UDID:        udid,
+		Updates:     updates,
+		ScheduledAt: now,
+	}
+	if err := queueSchedule(ctx, svc.store, svc.cmdsvc, s, now); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (svc *OSUpdateService) DeviceSchedule(ctx context.Context, udid string) (*Schedule, error) {
+	return svc.store.DeviceSchedule(ctx, udid)
+}
+
+func (svc *OSUpdateService) DeviceUpdates(ctx context.Context, udid string) ([]Update, error) {
+	return svc.store.DeviceUpdates(ctx, udid)
+}
+
+func (svc *OSUpdateService) Report(ctx context.Context, productKey string) ([]ReportEntry, error) {
+	updates, err := svc.store.Updates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if productKey != "" {
+		var filtered []Update
+		for _, u := range updates {
+			if u.ProductKey == productKey {
+				filtered = append(filtered, u)
+			}
+		}
+		updates = filtered
+	}
+	return NewReport(updates), nil
+}
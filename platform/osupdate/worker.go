@@ -0,0 +1,210 @@
+package osupdate
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/platform/pubsub"
+)
+
+const (
+	// DefaultRetryDelay is how long after a NotNow response a
+	// ScheduleOSUpdate command is queued again.
+	DefaultRetryDelay = 15 * time.Minute
+	// DefaultMaxAttempts is how many times a ScheduleOSUpdate command is
+	// queued for a device which keeps responding with NotNow.
+	DefaultMaxAttempts = 5
+)
+
+// Worker saves the updates devices report in response to AvailableOSUpdates
+// commands, and the status of their ScheduleOSUpdate commands. It queues a
+// ScheduleOSUpdate command again after the device responds with NotNow, and
+// removes the records of devices which unenroll.
+type Worker struct {
+	store       Store
+	cmdsvc      CommandService
+	sub         pubsub.Subscriber
+	retryDelay  time.Duration
+	maxAttempts int
+	logger      log.Logger
+	now         func() time.Time
+}
+
+// WorkerOption configures a Worker.
+type WorkerOption func(*Worker)
+
+// WithRetryDelay sets how long after a NotNow response a ScheduleOSUpdate
+// command is queued again. The worker checks for due retries at this interval.
+func WithRetryDelay(d time.Duration) WorkerOption {
+	return func(w *Worker) {
+		w.retryDelay = d
+	}
+}
+
+// WithMaxAttempts sets how many times a ScheduleOSUpdate command is queued
+// for a device which keeps responding with NotNow.
+func WithMaxAttempts(n int) WorkerOption {
+	return func(w *Worker) {
+		w.maxAttempts = n
+	}
+}
+
+// WithClock sets the function the Worker gets the current time from.
+func WithClock(now func() time.Time) WorkerOption {
+	return func(w *Worker) {
+		w.now = now
+	}
+}
+
+func NewWorker(store Store, cmdsvc CommandService, sub pubsub.Subscriber, logger log.Logger, opts ...WorkerOption) *Worker {
+	w := &Worker{
+		store:       store,
+		cmdsvc:      cmdsvc,
+		sub:         sub,
+		retryDelay:  DefaultRetryDelay,
+		maxAttempts: DefaultMaxAttempts,
+		logger:      logger,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+func (w *Worker) Run(ctx context.Context) error {
+	const subscription = "osupdate_worker"
+	connectEvents, err := w.sub.Subscribe(ctx, subscription, mdm.ConnectTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s", subscription, mdm.ConnectTopic)
+	}
+	checkoutEvents, err := w.sub.Subscribe(ctx, subscription, mdm.CheckoutTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s", subscription, mdm.CheckoutTopic)
+	}
+
+	ticker := time.NewTicker(w.retryDelay)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-connectEvents:
+			err = w.updateFromAcknowledge(ctx, ev.Message)
+		case ev := <-checkoutEvents:
+			err = w.deleteFromCheckout(ctx, ev.Message)
+		case <-ticker.C:
+			_, err = w.RetryNotNow(ctx)
+		}
+		if err != nil {
+			level.Info(w.logger).Log("msg", "handle os update event", "err", err)
+		}
+	}
+}
+
+func (w *Worker) updateFromAcknowledge(ctx context.Context, message []byte) error {
+	var ev mdm.AcknowledgeEvent
+	if err := mdm.UnmarshalAcknowledgeEvent(message, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal acknowledge event")
+	}
+	if ev.Response.EnrollmentID != nil || ev.Response.UserID != nil {
+		return nil
+	}
+	if err := w.updateSchedule(ctx, ev.Response); err != nil {
+		return err
+	}
+	if ev.Response.Status != "Acknowledged" {
+		return nil
+	}
+	updates, ok, err := ParseResponse(ev.Response.UDID, ev.Raw, ev.Time)
+	if err != nil || !ok {
+		return err
+	}
+	err = w.store.SaveUpdates(ctx, ev.Response.UDID, updates)
+	return errors.Wrapf(err, "save available os updates of udid %s", ev.Response.UDID)
+}
+
+// updateSchedule records the status of resp if it responds to the
+// ScheduleOSUpdate command of the device, and schedules a retry for NotNow.
+func (w *Worker) updateSchedule(ctx context.Context, resp mdm.Response) error {
+	if resp.Status == "Idle" || resp.CommandUUID == "" {
+		return nil
+	}
+	s, err := w.store.DeviceSchedule(ctx, resp.UDID)
+	if err != nil {
+		return errors.Wrapf(err, "get ScheduleOSUpdate schedule of udid %s", resp.UDID)
+	}
+	if s == nil || s.CommandUUID != resp.CommandUUID {
+		return nil
+	}
+	now := w.now().UTC()
+	switch resp.Status {
+	case "Acknowledged":
+		s.Status = ScheduleAcknowledged
+	case "NotNow":
+		s.Status = ScheduleNotNow
+		if s.Attempts < w.maxAttempts {
+			s.NextAttemptAt = now.Add(w.retryDelay)
+		}
+	default:
+		s.Status = ScheduleError
+	}
+	s.UpdatedAt = now
+	return errors.Wrap(w.store.SaveSchedule(ctx, s), "save ScheduleOSUpdate schedule")
+}
+
+// RetryNotNow queues the ScheduleOSUpdate command again for each schedule
+// whose device responded with NotNow and whose retry is due. It returns the
+// number of commands queued.
+//
+// The command queue keeps a command refused with NotNow, but only sends it
+// when the device next checks in, which nothing prompts. That command is
+// removed when the new one is queued and the device is pushed, so that the
+// device does not receive the update twice.
+func (w *Worker) RetryNotNow(ctx context.Context) (int, error) {
+	schedules, err := w.store.Schedules(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "list ScheduleOSUpdate schedules")
+	}
+	now := w.now().UTC()
+	var queued int
+	for i := range schedules {
+		s := &schedules[i]
+		if s.Status != ScheduleNotNow || s.NextAttemptAt.IsZero() || now.Before(s.NextAttemptAt) {
+			continue
+		}
+		err := w.cmdsvc.DeleteCommand(ctx, s.UDID, s.CommandUUID)
+		if err != nil && err != mdm.ErrCommandNotFound {
+			level.Info(w.logger).Log("msg", "delete NotNow ScheduleOSUpdate command", "udid", s.UDID, "command_uuid", s.CommandUUID, "err", err)
+			continue
+		}
+		if err := queueSchedule(ctx, w.store, w.cmdsvc, s, now); err != nil {
+			level.Info(w.logger).Log("msg", "retry ScheduleOSUpdate", "udid", s.UDID, "err", err)
+			continue
+		}
+		level.Debug(w.logger).Log("msg", "retry ScheduleOSUpdate", "udid", s.UDID, "command_uuid", s.CommandUUID, "attempt", s.Attempts)
+		queued++
+	}
+	return queued, nil
+}
+
+func (w *Worker) deleteFromCheckout(ctx context.Context, message []byte) error {
+	var ev mdm.CheckinEvent
+	if err := mdm.UnmarshalCheckinEvent(message, &ev); err != nil {
+		return errors.Wrap(err, "unmarshal checkout event")
+	}
+	if ev.Command.EnrollmentID != "" || ev.Command.UserID != "" {
+		return nil
+	}
+	if err := w.store.DeleteUpdates(ctx, ev.Command.UDID); err != nil {
+		return errors.Wrapf(err, "delete available os updates of udid %s", ev.Command.UDID)
+	}
+	err := w.store.DeleteSchedule(ctx, ev.Command.UDID)
+	return errors.Wrapf(err, "delete ScheduleOSUpdate schedule of udid %s", ev.Command.UDID)
+}
@@ -0,0 +1,163 @@
+package osupdate
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	mdmsvc "github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/platform/command"
+)
+
+func TestNotNowIsRetried(t *testing.T) {
+	store := newMemStore()
+	cmdsvc := &recordingCommandService{}
+	svc := New(store, cmdsvc)
+	now := time.Now()
+	w := NewWorker(store, cmdsvc, nil, log.NewNopLogger(),
+		WithRetryDelay(time.Hour),
+		WithMaxAttempts(2),
+		WithClock(func() time.Time { return now }),
+	)
+	ctx := context.Background()
+
+	updates := []OSUpdateRequest{{ProductKey: "012-40839", InstallAction: mdm.InstallActionInstallASAP}}
+	s, err := svc.QueueScheduleOSUpdate(ctx, "UDID-1", updates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Status != ScheduleQueued || s.Attempts != 1 || s.CommandUUID != "CMD-1" {
+		t.Fatalf("unexpected schedule %+v", s)
+	}
+	if have := cmdsvc.queued[0].Command.ScheduleOSUpdate.Updates[0].InstallAction; have != mdm.InstallActionInstallASAP {
+		t.Errorf("have install action %s, want %s", have, mdm.InstallActionInstallASAP)
+	}
+
+	acknowledge(t, w, "UDID-1", "CMD-1", "NotNow")
+	s, _ = store.DeviceSchedule(ctx, "UDID-1")
+	if s.Status != ScheduleNotNow || !s.NextAttemptAt.Equal(now.Add(time.Hour).UTC()) {
+		t.Fatalf("unexpected schedule after NotNow %+v", s)
+	}
+	if n, err := w.RetryNotNow(ctx); err != nil || n != 0 {
+		t.Fatalf("have %d retries with error %v before the retry delay, want 0", n, err)
+	}
+
+	now = now.Add(time.Hour)
+	if n, err := w.RetryNotNow(ctx); err != nil || n != 1 {
+		t.Fatalf("have %d retries with error %v, want 1", n, err)
+	}
+	if len(cmdsvc.deleted) != 1 || cmdsvc.deleted[0] != "CMD-1" {
+		t.Errorf("have deleted commands %v, want the NotNow command", cmdsvc.deleted)
+	}
+	s, _ = store.DeviceSchedule(ctx, "UDID-1")
+	if s.Status != ScheduleQueued || s.Attempts != 2 || s.CommandUUID != "CMD-2" || !s.NextAttemptAt.IsZero() {
+		t.Fatalf("unexpected schedule after retry %+v", s)
+	}
+	if have := cmdsvc.queued[1].Command.ScheduleOSUpdate.Updates[0].ProductKey; have != "012-40839" {
+		t.Errorf("have retried product key %s, want 012-40839", have)
+	}
+
+	// a response to the replaced command is ignored.
+	acknowledge(t, w, "UDID-1", "CMD-1", "Acknowledged")
+	// the last attempt is not retried.
+	acknowledge(t, w, "UDID-1", "CMD-2", "NotNow")
+	now = now.Add(time.Hour)
+	if n, err := w.RetryNotNow(ctx); err != nil || n != 0 {
+		t.Fatalf("have %d retries with error %v after the last attempt, want 0", n, err)
+	}
+	s, _ = store.DeviceSchedule(ctx, "UDID-1")
+	if s.Status != ScheduleNotNow || s.CommandUUID != "CMD-2" {
+		t.Errorf("unexpected schedule after the last attempt %+v", s)
+	}
+}
+
+func acknowledge(t *testing.T, w *Worker, udid, uuid, status string) {
+	t.Helper()
+	raw := fmt.Sprintf(`<plist version="1.0"><dict><key>CommandUUID</key><string>%s</string><key>Status</key><string>%s</string><key>UDID</key><string>%s</string></dict></plist>`, uuid, status, udid)
+	msg, err := mdmsvc.MarshalAcknowledgeEvent(&mdmsvc.AcknowledgeEvent{
+		Response: mdmsvc.Response{UDID: udid, CommandUUID: uuid, Status: status},
+		Raw:      []byte(raw),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.updateFromAcknowledge(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type recordingCommandService struct {
+	queued  []*mdm.CommandRequest
+	deleted []string
+}
+
+func (svc *recordingCommandService) NewCommand(ctx context.Context, req *mdm.CommandRequest, opts ...command.CommandOption) (*mdm.CommandPayload, error) {
+	svc.queued = append(svc.queued, req)
+	return &mdm.CommandPayload{CommandUUID: fmt.Sprintf("CMD-%d", len(svc.queued)), Command: req.Command}, nil
+}
+
+func (svc *recordingCommandService) DeleteCommand(ctx context.Context, udid, uuid string) error {
+	svc.deleted = append(svc.deleted, uuid)
+	return nil
+}
+
+type memStore struct {
+	updates   map[string][]Update
+	schedules map[string]Schedule
+}
+
+func newMemStore() *memStore {
+	return &memStore{updates: make(map[string][]Update), schedules: make(map[string]Schedule)}
+}
+
+func (m *memStore) SaveUpdates(ctx context.Context, udid string, updates []Update) error {
+	m.updates[udid] = updates
+	return nil
+}
+
+func (m *memStore) DeviceUpdates(ctx context.Context, udid string) ([]Update, error) {
+	return m.updates[udid], nil
+}
+
+func (m *memStore) Updates(ctx context.Context) ([]Update, error) {
+	var all []Update
+	for _, updates := range m.updates {
+		all = append(all, updates...)
+	}
+	return all, nil
+}
+
+func (m *memStore) DeleteUpdates(ctx context.Context, udid string) error {
+	delete(m.updates, udid)
+	return nil
+}
+
+func (m *memStore) SaveSchedule(ctx context.Context, s *Schedule) error {
+	m.schedules[s.UDID] = *s
+	return nil
+}
+
+func (m *memStore) DeviceSchedule(ctx context.Context, udid string) (*Schedule, error) {
+	s, ok := m.schedules[udid]
+	if !ok {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func (m *memStore) Schedules(ctx context.Context) ([]Schedule, error) {
+	var all []Schedule
+	for _, s := range m.schedules {
+		all = append(all, s)
+	}
+	return all, nil
+}
+
+func (m *memStore) DeleteSchedule(ctx context.Context, udid string) error {
+	delete(m.schedules, udid)
+	return nil
+}
@@ -9,6 +9,9 @@ import (
 )
 
 func (svc *ProfileService) ApplyProfile(ctx context.Context, p *Profile) error {
+	if err := ValidateProfile(p.Mobileconfig); err != nil {
+		return err
+	}
 	return svc.store.Save(p)
 }
 
@@ -5,6 +5,7 @@ import (
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 )
 
 type Endpoints struct {
@@ -15,9 +16,9 @@ type Endpoints struct {
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		ApplyProfileEndpoint:   endpoint.Chain(outer, others...)(MakeApplyProfileEndpoint(s)),
-		GetProfilesEndpoint:    endpoint.Chain(outer, others...)(MakeGetProfilesEndpoint(s)),
-		RemoveProfilesEndpoint: endpoint.Chain(outer, others...)(MakeRemoveProfilesEndpoint(s)),
+		ApplyProfileEndpoint:   endpoint.Chain(outer, others...)(scope.Require(scope.ProfilesWrite)(MakeApplyProfileEndpoint(s))),
+		GetProfilesEndpoint:    endpoint.Chain(outer, others...)(scope.Require(scope.ProfilesRead)(MakeGetProfilesEndpoint(s))),
+		RemoveProfilesEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.ProfilesWrite)(MakeRemoveProfilesEndpoint(s))),
 	}
 }
 
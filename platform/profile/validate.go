@@ -0,0 +1,83 @@
+package profile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/groob/plist"
+	"github.com/pkg/errors"
+	"go.mozilla.org/pkcs7"
+)
+
+// ValidationError lists all of the problems ValidateProfile found in a profile.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid profile: " + strings.Join(e.Problems, "; ")
+}
+
+type profilePayload struct {
+	PayloadIdentifier string
+	PayloadUUID       string
+	PayloadType       string
+}
+
+type configurationProfile struct {
+	profilePayload
+	PayloadContent []profilePayload
+}
+
+// ValidateProfile checks that mobileconfig is a Configuration profile with a
+// PayloadIdentifier and PayloadUUID, and that each of its payloads has a unique
+// PayloadUUID. Signed profiles are validated by their content.
+// If the profile is invalid, the returned error is a *ValidationError listing every problem.
+func ValidateProfile(mobileconfig []byte) error {
+	content := mobileconfig
+	if len(content) > 5 && string(content[0:5]) != "<?xml" {
+		p7, err := pkcs7.Parse(content)
+		if err != nil {
+			return &ValidationError{Problems: []string{"profile is not XML nor PKCS7 parseable"}}
+		}
+		content = p7.Content
+	}
+
+	var p configurationProfile
+	if err := plist.Unmarshal(content, &p); err != nil {
+		return &ValidationError{Problems: []string{errors.Wrap(err, "parse profile plist").Error()}}
+	}
+
+	var problems []string
+	if p.PayloadIdentifier == "" {
+		problems = append(problems, "missing PayloadIdentifier")
+	}
+	if p.PayloadUUID == "" {
+		problems = append(problems, "missing PayloadUUID")
+	}
+	if p.PayloadType != "Configuration" {
+		problems = append(problems, fmt.Sprintf("PayloadType is %q, must be \"Configuration\"", p.PayloadType))
+	}
+
+	uuids := map[string]string{p.PayloadUUID: "the profile"}
+	for i, payload := range p.PayloadContent {
+		name := fmt.Sprintf("payload %d", i)
+		if payload.PayloadIdentifier != "" {
+			name = fmt.Sprintf("payload %d (%s)", i, payload.PayloadIdentifier)
+		}
+		if payload.PayloadUUID == "" {
+			problems = append(problems, name+" is missing PayloadUUID")
+			continue
+		}
+		if other, ok := uuids[payload.PayloadUUID]; ok {
+			problems = append(problems, fmt.Sprintf("%s has the same PayloadUUID as %s", name, other))
+			continue
+		}
+		uuids[payload.PayloadUUID] = name
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
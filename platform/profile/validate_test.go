@@ -0,0 +1,104 @@
+package profile
+
+import (
+	"strings"
+	"testing"
+)
+
+const testProfile = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadContent</key>
+	<array>
+		<dict>
+			<key>PayloadIdentifier</key>
+			<string>com.example.profile.dock</string>
+			<key>PayloadType</key>
+			<string>com.apple.dock</string>
+			<key>PayloadUUID</key>
+			<string>%s</string>
+		</dict>
+		<dict>
+			<key>PayloadIdentifier</key>
+			<string>com.example.profile.screensaver</string>
+			<key>PayloadType</key>
+			<string>com.apple.screensaver</string>
+			%s
+		</dict>
+	</array>
+	<key>PayloadIdentifier</key>
+	<string>%s</string>
+	<key>PayloadType</key>
+	<string>%s</string>
+	<key>PayloadUUID</key>
+	<string>6E1A0D59-4D6E-4C6A-9C94-2B1F6B1D6E10</string>
+</dict>
+</plist>`
+
+func makeProfile(dockUUID, screensaverUUID, identifier, payloadType string) []byte {
+	p := testProfile
+	for _, v := range []string{dockUUID, screensaverUUID, identifier, payloadType} {
+		p = strings.Replace(p, "%s", v, 1)
+	}
+	return []byte(p)
+}
+
+func TestValidateProfile(t *testing.T) {
+	const (
+		dockUUID        = "0C8A6C1B-5B43-4A36-8C3E-1B7D7F3F2E01"
+		screensaverUUID = "<key>PayloadUUID</key><string>9F2E3D4C-1A2B-4C3D-8E9F-0A1B2C3D4E5F</string>"
+	)
+	if err := ValidateProfile(makeProfile(dockUUID, screensaverUUID, "com.example.profile", "Configuration")); err != nil {
+		t.Fatalf("valid profile: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		profile []byte
+		want    []string
+	}{
+		{
+			name:    "not a plist",
+			profile: []byte("<?xml version=\"1.0\"?><notaplist"),
+			want:    []string{"parse profile plist"},
+		},
+		{
+			name:    "missing identifier and wrong type",
+			profile: makeProfile(dockUUID, screensaverUUID, "", "com.apple.dock"),
+			want:    []string{"missing PayloadIdentifier", `PayloadType is "com.apple.dock"`},
+		},
+		{
+			name:    "nested payload without uuid",
+			profile: makeProfile(dockUUID, "", "com.example.profile", "Configuration"),
+			want:    []string{"payload 1 (com.example.profile.screensaver) is missing PayloadUUID"},
+		},
+		{
+			name:    "copied payload uuid",
+			profile: makeProfile("9F2E3D4C-1A2B-4C3D-8E9F-0A1B2C3D4E5F", screensaverUUID, "com.example.profile", "Configuration"),
+			want:    []string{"payload 1 (com.example.profile.screensaver) has the same PayloadUUID as payload 0 (com.example.profile.dock)"},
+		},
+		{
+			name:    "every problem",
+			profile: makeProfile("", "", "", ""),
+			want:    []string{"missing PayloadIdentifier", "PayloadType", "payload 0", "payload 1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateProfile(tt.profile)
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("have error %v, want a *ValidationError", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(verr.Error(), want) {
+					t.Errorf("have error %q, want it to contain %q", verr, want)
+				}
+			}
+			if have, want := len(verr.Problems), len(tt.want); have != want {
+				t.Errorf("have %d problems, want %d: %v", have, want, verr.Problems)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package inmem
 
 import (
 	"context"
+	"sync"
 
 	"github.com/micromdm/micromdm/platform/pubsub"
 )
@@ -25,10 +26,19 @@ func (p *Inmem) dispatch() {
 		select {
 		case ev := <-p.publish:
 			p.mtx.Lock()
+			var delivered sync.WaitGroup
 			for _, sub := range p.subscriptions[ev.Topic] {
-				go func(s subscription) { s.eventChan <- ev }(sub)
+				delivered.Add(1)
+				go func(s subscription) {
+					defer delivered.Done()
+					s.eventChan <- ev
+				}(sub)
 			}
 			p.mtx.Unlock()
+			go func() {
+				delivered.Wait()
+				p.work.Done()
+			}()
 		}
 	}
 }
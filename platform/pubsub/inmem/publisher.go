@@ -4,6 +4,7 @@ import (
 	"context"
 	"sync"
 
+	"github.com/micromdm/micromdm/pkg/drain"
 	"github.com/micromdm/micromdm/platform/pubsub"
 )
 
@@ -23,6 +24,9 @@ type Inmem struct {
 	subscriptions map[string][]subscription
 
 	publish chan pubsub.Event
+
+	// work counts the published events which are not yet delivered to every subscriber.
+	work drain.Group
 }
 
 type subscription struct {
@@ -32,7 +36,20 @@ type subscription struct {
 }
 
 func (p *Inmem) Publish(_ context.Context, topic string, msg []byte) error {
+	if err := p.work.Start(); err != nil {
+		return err
+	}
 	event := pubsub.Event{Topic: topic, Message: msg}
 	go func() { p.publish <- event }()
 	return nil
 }
+
+// Work tracks the events which were published but not yet delivered to every subscriber.
+func (p *Inmem) Work() *drain.Group {
+	return &p.work
+}
+
+// Shutdown rejects new events and waits for the published events to be delivered.
+func (p *Inmem) Shutdown(ctx context.Context) error {
+	return p.work.Drain(ctx)
+}
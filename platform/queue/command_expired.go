@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/micromdm/micromdm/platform/pubsub"
+)
+
+// CommandExpiredTopic is a PubSub topic that an event is published to when a
+// queued command expires before it is sent to the device.
+const CommandExpiredTopic = "mdm.CommandExpired"
+
+// CommandExpiredEvent is published to CommandExpiredTopic.
+type CommandExpiredEvent struct {
+	DeviceUDID  string    `json:"udid"`
+	CommandUUID string    `json:"command_uuid"`
+	ExpiredAt   time.Time `json:"expired_at"`
+}
+
+func PublishCommandExpired(pub pubsub.Publisher, udid, uuid string, expiredAt time.Time) error {
+	msg, err := json.Marshal(CommandExpiredEvent{
+		DeviceUDID:  udid,
+		CommandUUID: uuid,
+		ExpiredAt:   expiredAt,
+	})
+	if err != nil {
+		return err
+	}
+	return pub.Publish(context.TODO(), CommandExpiredTopic, msg)
+}
+
+// cutExpired removes the commands which have expired at the time now from all,
+// and returns them along with the remaining commands.
+func cutExpired(all []Command, now time.Time) ([]Command, []Command) {
+	var expired []Command
+	remaining := all[:0]
+	for _, cmd := range all {
+		if cmd.Expired(now) {
+			expired = append(expired, cmd)
+			continue
+		}
+		remaining = append(remaining, cmd)
+	}
+	return expired, remaining
+}
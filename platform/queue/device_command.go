@@ -6,6 +6,7 @@ import (
 	"github.com/pkg/errors"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/micromdm/micromdm/pkg/timeutil"
 	"github.com/micromdm/micromdm/platform/queue/internal/devicecommandproto"
 )
 
@@ -21,6 +22,24 @@ type Command struct {
 
 	LastStatus     string
 	FailureMessage []byte
+
+	// ExpiresAt is the time after which the command is no longer sent.
+	// A zero ExpiresAt means the command never expires.
+	ExpiresAt time.Time
+}
+
+// queuedAt returns the time the command was queued. Commands which were queued
+// before the time was recorded return the zero time.
+func (c Command) queuedAt() time.Time {
+	if c.CreatedAt.Before(time.Unix(0, 0)) {
+		return time.Time{}
+	}
+	return c.CreatedAt
+}
+
+// Expired reports whether the command has expired at the time now.
+func (c Command) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt)
 }
 
 type DeviceCommand struct {
@@ -51,6 +70,8 @@ func MarshalDeviceCommand(c *DeviceCommand) ([]byte, error) {
 
 			LastStatus:     command.LastStatus,
 			FailureMessage: command.FailureMessage,
+
+			ExpiresAt: timeutil.ToNano(command.ExpiresAt),
 		})
 	}
 
@@ -66,6 +87,8 @@ func MarshalDeviceCommand(c *DeviceCommand) ([]byte, error) {
 
 			LastStatus:     command.LastStatus,
 			FailureMessage: command.FailureMessage,
+
+			ExpiresAt: timeutil.ToNano(command.ExpiresAt),
 		})
 	}
 
@@ -81,6 +104,8 @@ func MarshalDeviceCommand(c *DeviceCommand) ([]byte, error) {
 
 			LastStatus:     command.LastStatus,
 			FailureMessage: command.FailureMessage,
+
+			ExpiresAt: timeutil.ToNano(command.ExpiresAt),
 		})
 	}
 
@@ -96,6 +121,8 @@ func MarshalDeviceCommand(c *DeviceCommand) ([]byte, error) {
 
 			LastStatus:     command.LastStatus,
 			FailureMessage: command.FailureMessage,
+
+			ExpiresAt: timeutil.ToNano(command.ExpiresAt),
 		})
 	}
 	return proto.Marshal(&protoc)
@@ -123,6 +150,8 @@ func UnmarshalDeviceCommand(data []byte, c *DeviceCommand) error {
 
 			LastStatus:     command.LastStatus,
 			FailureMessage: command.FailureMessage,
+
+			ExpiresAt: timeutil.FromNano(command.ExpiresAt),
 		})
 	}
 
@@ -138,6 +167,8 @@ func UnmarshalDeviceCommand(data []byte, c *DeviceCommand) error {
 
 			LastStatus:     command.LastStatus,
 			FailureMessage: command.FailureMessage,
+
+			ExpiresAt: timeutil.FromNano(command.ExpiresAt),
 		})
 	}
 
@@ -153,6 +184,8 @@ func UnmarshalDeviceCommand(data []byte, c *DeviceCommand) error {
 
 			LastStatus:     command.LastStatus,
 			FailureMessage: command.FailureMessage,
+
+			ExpiresAt: timeutil.FromNano(command.ExpiresAt),
 		})
 	}
 
@@ -168,6 +201,8 @@ func UnmarshalDeviceCommand(data []byte, c *DeviceCommand) error {
 
 			LastStatus:     command.LastStatus,
 			FailureMessage: command.FailureMessage,
+
+			ExpiresAt: timeutil.FromNano(command.ExpiresAt),
 		})
 	}
 	return nil
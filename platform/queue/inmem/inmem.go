@@ -3,8 +3,13 @@ package inmem
 import (
 	"container/list"
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/pkg/ctxlog"
+	"github.com/micromdm/micromdm/pkg/drain"
 	"github.com/micromdm/micromdm/platform/command"
 	"github.com/micromdm/micromdm/platform/pubsub"
 	boltqueue "github.com/micromdm/micromdm/platform/queue"
@@ -17,26 +22,37 @@ import (
 // QueueInMem represents an in-memory command queue
 type QueueInMem struct {
 	logger log.Logger
-	queue  map[string]*list.List
+	pub    pubsub.Publisher
+
+	mu    sync.Mutex
+	queue map[string]*list.List
+	work  drain.Group
 }
 
 type queuedCommand struct {
-	uuid    string
-	payload []byte
-	notNow  bool
+	uuid     string
+	payload  []byte
+	notNow   bool
+	expires  time.Time
+	queuedAt time.Time
 }
 
 // New creates a new in-memory command queue
 func New(pubsub pubsub.PublishSubscriber, logger log.Logger) *QueueInMem {
 	q := &QueueInMem{
 		logger: logger,
+		pub:    pubsub,
 		queue:  make(map[string]*list.List),
 	}
 	q.startPolling(pubsub)
-	q.startRawPolling(pubsub)
 	return q
 }
 
+// Work tracks the command events which are being saved to the queue.
+func (q *QueueInMem) Work() *drain.Group {
+	return &q.work
+}
+
 func (q *QueueInMem) clearList(udid string) {
 	delete(q.queue, udid)
 	return
@@ -49,13 +65,39 @@ func (q *QueueInMem) getList(udid string) *list.List {
 	return q.queue[udid]
 }
 
-func (q *QueueInMem) enqueue(l *list.List, uuid string, payload []byte) {
+func (q *QueueInMem) enqueue(l *list.List, uuid string, payload []byte, expires time.Time) {
 	l.PushBack(&queuedCommand{
-		uuid:    uuid,
-		payload: payload,
+		uuid:     uuid,
+		payload:  payload,
+		expires:  expires,
+		queuedAt: time.Now().UTC(),
 	})
 }
 
+// removeExpired removes the commands which have expired at the time now from l.
+func (q *QueueInMem) removeExpired(ctx context.Context, l *list.List, udid string, now time.Time) {
+	var next *list.Element
+	for e := l.Front(); e != nil; e = next {
+		next = e.Next()
+		qCmd := e.Value.(*queuedCommand)
+		if qCmd.expires.IsZero() || now.Before(qCmd.expires) {
+			continue
+		}
+		l.Remove(e)
+		level.Info(ctxlog.Logger(ctx, q.logger)).Log(
+			"msg", "dropped expired command",
+			"command_uuid", qCmd.uuid,
+			"expired_at", qCmd.expires,
+		)
+		if err := boltqueue.PublishCommandExpired(q.pub, udid, qCmd.uuid, qCmd.expires); err != nil {
+			level.Info(ctxlog.Logger(ctx, q.logger)).Log(
+				"msg", "publish command to expired topic",
+				"err", err,
+			)
+		}
+	}
+}
+
 func (q *QueueInMem) findCommandByUUID(l *list.List, uuid string) (*queuedCommand, *list.Element) {
 	for e := l.Front(); e != nil; e = e.Next() {
 		qCmd := e.Value.(*queuedCommand)
@@ -77,7 +119,7 @@ func (q *QueueInMem) nextCommandPayload(l *list.List, skipNotNow bool) []byte {
 }
 
 // Next delivers the next command from the command queue for the enrollment in resp
-func (q *QueueInMem) Next(_ context.Context, resp mdm.Response) ([]byte, error) {
+func (q *QueueInMem) Next(ctx context.Context, resp mdm.Response) ([]byte, error) {
 	udid := resp.UDID
 	if resp.UserID != nil {
 		udid = *resp.UserID
@@ -86,20 +128,31 @@ func (q *QueueInMem) Next(_ context.Context, resp mdm.Response) ([]byte, error)
 		udid = *resp.EnrollmentID
 	}
 
+	q.mu.Lock()
+	defer q.mu.Unlock()
 	l := q.getList(udid)
 
 	switch resp.Status {
 	case "NotNow":
-		qCmd, _ := q.findCommandByUUID(l, resp.CommandUUID)
-		qCmd.notNow = true
+		if qCmd, _ := q.findCommandByUUID(l, resp.CommandUUID); qCmd != nil {
+			qCmd.notNow = true
+		}
 	case "Acknowledged", "Error", "CommandFormatError":
 		_, e := q.findCommandByUUID(l, resp.CommandUUID)
 		if e != nil {
 			l.Remove(e)
-			if l.Len() == 0 {
-				q.clearList(udid)
-			}
 		}
+	case "Idle":
+	default:
+		if l.Len() == 0 {
+			q.clearList(udid)
+		}
+		return nil, fmt.Errorf("unknown response status: %s", resp.Status)
+	}
+
+	q.removeExpired(ctx, l, udid, time.Now())
+	if l.Len() == 0 {
+		q.clearList(udid)
 	}
 
 	cmdBytes := q.nextCommandPayload(l, resp.Status == "NotNow")
@@ -117,7 +170,9 @@ func (q *QueueInMem) Clear(_ context.Context, event mdm.CheckinEvent) error {
 		udid = event.Command.EnrollmentID
 	}
 
+	q.mu.Lock()
 	q.clearList(udid)
+	q.mu.Unlock()
 	return nil
 }
 
@@ -131,107 +186,146 @@ func (q *QueueInMem) ViewQueue(_ context.Context, event mdm.CheckinEvent) ([]*md
 		udid = event.Command.EnrollmentID
 	}
 
+	q.mu.Lock()
+	defer q.mu.Unlock()
 	l := q.getList(udid)
 
 	cmds := make([]*mdm.Command, 0, l.Len())
 	for item := l.Front(); item != nil; item = item.Next() {
 		cmd := item.Value.(*queuedCommand)
 		cmds = append(cmds, &mdm.Command{
-			UUID:    cmd.uuid,
-			Payload: cmd.payload,
+			UUID:     cmd.uuid,
+			Payload:  cmd.payload,
+			QueuedAt: cmd.queuedAt,
 		})
 	}
 
 	return cmds, nil
 }
 
+// DeleteCommand removes the command with uuid from the command queue
+// for the enrollment in event.
+func (q *QueueInMem) DeleteCommand(_ context.Context, event mdm.CheckinEvent, uuid string) error {
+	udid := event.Command.UDID
+	if event.Command.UserID != "" {
+		udid = event.Command.UserID
+	}
+	if event.Command.EnrollmentID != "" {
+		udid = event.Command.EnrollmentID
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	l, ok := q.queue[udid]
+	if !ok {
+		return mdm.ErrCommandNotFound
+	}
+	_, e := q.findCommandByUUID(l, uuid)
+	if e == nil {
+		return mdm.ErrCommandNotFound
+	}
+	l.Remove(e)
+	if l.Len() == 0 {
+		q.clearList(udid)
+	}
+	return nil
+}
+
 func (q *QueueInMem) startPolling(pubsub pubsub.PublishSubscriber) error {
 	events, err := pubsub.Subscribe(context.TODO(), "command-queue", command.CommandTopic)
 	if err != nil {
 		return err
 	}
+	rawEvents, err := pubsub.Subscribe(context.TODO(), "command-queue", command.RawCommandTopic)
+	if err != nil {
+		return err
+	}
 	go func() {
 		for {
 			select {
 			case event := <-events:
-				var cmdEvent command.Event
-				if err := command.UnmarshalEvent(event.Message, &cmdEvent); err != nil {
-					level.Info(q.logger).Log(
-						"msg", "unmarshal command event from pubsub",
-						"err", err,
-					)
-					continue
-				}
-				rawCmdPlist, err := plist.Marshal(cmdEvent.Payload)
-				if err != nil {
-					level.Info(q.logger).Log(
-						"msg", "marshal command plist",
-						"err", err,
-					)
-					continue
-				}
-				q.enqueue(
-					q.getList(cmdEvent.DeviceUDID),
-					cmdEvent.Payload.CommandUUID,
-					rawCmdPlist,
-				)
-				level.Info(q.logger).Log(
-					"msg", "queued command for device",
-					"device_udid", cmdEvent.DeviceUDID,
-					"command_uuid", cmdEvent.Payload.CommandUUID,
-					"request_type", cmdEvent.Payload.Command.RequestType,
-				)
-
-				err = boltqueue.PublishCommandQueued(pubsub, cmdEvent.DeviceUDID, cmdEvent.Payload.CommandUUID)
-				if err != nil {
-					level.Info(q.logger).Log(
-						"msg", "publish command to queued topic",
-						"err", err,
-					)
-				}
+				q.work.Add()
+				q.queueCommand(event.Message)
+				q.work.Done()
+			case event := <-rawEvents:
+				q.work.Add()
+				q.queueRawCommand(event.Message)
+				q.work.Done()
 			}
 		}
 	}()
 	return nil
 }
 
-func (q *QueueInMem) startRawPolling(pubsub pubsub.PublishSubscriber) error {
-	events, err := pubsub.Subscribe(context.TODO(), "command-queue", command.RawCommandTopic)
+func (q *QueueInMem) queueCommand(message []byte) {
+	var cmdEvent command.Event
+	if err := command.UnmarshalEvent(message, &cmdEvent); err != nil {
+		level.Info(q.logger).Log(
+			"msg", "unmarshal command event from pubsub",
+			"err", err,
+		)
+		return
+	}
+	rawCmdPlist, err := plist.Marshal(cmdEvent.Payload)
 	if err != nil {
-		return err
+		level.Info(q.logger).Log(
+			"msg", "marshal command plist",
+			"err", err,
+		)
+		return
+	}
+	q.mu.Lock()
+	q.enqueue(
+		q.getList(cmdEvent.DeviceUDID),
+		cmdEvent.Payload.CommandUUID,
+		rawCmdPlist,
+		cmdEvent.Expires,
+	)
+	q.mu.Unlock()
+	level.Info(q.logger).Log(
+		"msg", "queued command for device",
+		"device_udid", cmdEvent.DeviceUDID,
+		"command_uuid", cmdEvent.Payload.CommandUUID,
+		"request_type", cmdEvent.Payload.Command.RequestType,
+	)
+
+	err = boltqueue.PublishCommandQueued(q.pub, cmdEvent.DeviceUDID, cmdEvent.Payload.CommandUUID)
+	if err != nil {
+		level.Info(q.logger).Log(
+			"msg", "publish command to queued topic",
+			"err", err,
+		)
+	}
+}
+
+func (q *QueueInMem) queueRawCommand(message []byte) {
+	var cmdEvent command.RawEvent
+	if err := command.UnmarshalRawEvent(message, &cmdEvent); err != nil {
+		level.Info(q.logger).Log(
+			"msg", "unmarshal command event from pubsub",
+			"err", err,
+		)
+		return
+	}
+	q.mu.Lock()
+	q.enqueue(
+		q.getList(cmdEvent.DeviceUDID),
+		cmdEvent.CommandUUID,
+		cmdEvent.Payload,
+		time.Time{},
+	)
+	q.mu.Unlock()
+	level.Info(q.logger).Log(
+		"msg", "queued raw command for device",
+		"device_udid", cmdEvent.DeviceUDID,
+		"command_uuid", cmdEvent.CommandUUID,
+	)
+
+	err := boltqueue.PublishCommandQueued(q.pub, cmdEvent.DeviceUDID, cmdEvent.CommandUUID)
+	if err != nil {
+		level.Info(q.logger).Log(
+			"msg", "publish command to queued topic",
+			"err", err,
+		)
 	}
-	go func() {
-		for {
-			select {
-			case event := <-events:
-				var cmdEvent command.RawEvent
-				if err := command.UnmarshalRawEvent(event.Message, &cmdEvent); err != nil {
-					level.Info(q.logger).Log(
-						"msg", "unmarshal command event from pubsub",
-						"err", err,
-					)
-					continue
-				}
-				q.enqueue(
-					q.getList(cmdEvent.DeviceUDID),
-					cmdEvent.CommandUUID,
-					cmdEvent.Payload,
-				)
-				level.Info(q.logger).Log(
-					"msg", "queued raw command for device",
-					"device_udid", cmdEvent.DeviceUDID,
-					"command_uuid", cmdEvent.CommandUUID,
-				)
-
-				err = boltqueue.PublishCommandQueued(pubsub, cmdEvent.DeviceUDID, cmdEvent.CommandUUID)
-				if err != nil {
-					level.Info(q.logger).Log(
-						"msg", "publish command to queued topic",
-						"err", err,
-					)
-				}
-			}
-		}
-	}()
-	return nil
 }
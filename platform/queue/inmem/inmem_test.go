@@ -1,22 +1,36 @@
 package inmem
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/platform/pubsub"
 	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+	boltqueue "github.com/micromdm/micromdm/platform/queue"
+	"github.com/micromdm/micromdm/platform/queue/internal/storetest"
 )
 
+var _ boltqueue.CommandStore = (*QueueInMem)(nil)
+
+func TestQueueInMem(t *testing.T) {
+	storetest.Test(t, func(t *testing.T, pubsub pubsub.PublishSubscriber) boltqueue.CommandStore {
+		return New(pubsub, log.NewNopLogger())
+	})
+}
+
 func TestQueue(t *testing.T) {
 	q := New(inmem.NewPubSub(), log.NewNopLogger())
 	udid := "ABCD-EFGH"
 	l := q.getList(udid)
 
-	q.enqueue(l, "CMD-001", []byte("CMD-001"))
-	q.enqueue(l, "CMD-002", []byte("CMD-002"))
-	q.enqueue(l, "CMD-003", []byte("CMD-003"))
+	q.enqueue(l, "CMD-001", []byte("CMD-001"), time.Time{})
+	q.enqueue(l, "CMD-002", []byte("CMD-002"), time.Time{})
+	q.enqueue(l, "CMD-003", []byte("CMD-003"), time.Time{})
 
 	for i, test := range []struct {
 		nextUUID        string
@@ -51,3 +65,41 @@ func TestQueue(t *testing.T) {
 		})
 	}
 }
+
+func TestQueueExpired(t *testing.T) {
+	pubsub := inmem.NewPubSub()
+	expiredEvents, err := pubsub.Subscribe(context.Background(), "test", boltqueue.CommandExpiredTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := New(pubsub, log.NewNopLogger())
+	udid := "ABCD-EFGH"
+	l := q.getList(udid)
+
+	q.enqueue(l, "CMD-001", []byte("CMD-001"), time.Now().Add(-time.Minute))
+	q.enqueue(l, "CMD-002", []byte("CMD-002"), time.Now().Add(time.Hour))
+
+	resp, err := q.Next(context.Background(), mdm.Response{UDID: udid, Status: "Idle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := string(resp), "CMD-002"; have != want {
+		t.Errorf("have next command %q, want %q", have, want)
+	}
+	if have, want := l.Len(), 1; have != want {
+		t.Errorf("have queue length %d, want %d", have, want)
+	}
+
+	select {
+	case ev := <-expiredEvents:
+		var expired boltqueue.CommandExpiredEvent
+		if err := json.Unmarshal(ev.Message, &expired); err != nil {
+			t.Fatal(err)
+		}
+		if expired.DeviceUDID != udid || expired.CommandUUID != "CMD-001" {
+			t.Errorf("unexpected expired event %+v", expired)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the expired event")
+	}
+}
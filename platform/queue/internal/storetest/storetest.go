@@ -0,0 +1,279 @@
+// Package storetest is a test suite for implementations of queue.CommandStore.
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/groob/plist"
+
+	"github.com/micromdm/micromdm/mdm"
+	mdmcmd "github.com/micromdm/micromdm/mdm/mdm"
+	"github.com/micromdm/micromdm/platform/command"
+	"github.com/micromdm/micromdm/platform/pubsub"
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+	"github.com/micromdm/micromdm/platform/queue"
+)
+
+const udid = "TestDevice"
+
+// Test runs the suite with an empty store from newStore for each test. The
+// store must save the commands published to pubsub.
+func Test(t *testing.T, newStore func(t *testing.T, pubsub pubsub.PublishSubscriber) queue.CommandStore) {
+	for _, tt := range []struct {
+		name string
+		test func(t *testing.T, q *testQueue)
+	}{
+		{"Next", testNext},
+		{"NextUnknownStatus", testNextUnknownStatus},
+		{"NextExpired", testNextExpired},
+		{"RawCommand", testRawCommand},
+		{"ViewQueue", testViewQueue},
+		{"DeleteCommand", testDeleteCommand},
+		{"Clear", testClear},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ps := inmem.NewPubSub()
+			queued, err := ps.Subscribe(context.Background(), "storetest", queue.CommandQueuedTopic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expired, err := ps.Subscribe(context.Background(), "storetest", queue.CommandExpiredTopic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.test(t, &testQueue{
+				CommandStore: newStore(t, ps),
+				pub:          ps,
+				queued:       queued,
+				expired:      expired,
+			})
+		})
+	}
+}
+
+// testQueue is a store under test, with the pubsub it saves commands from.
+type testQueue struct {
+	queue.CommandStore
+	pub     pubsub.Publisher
+	queued  <-chan pubsub.Event
+	expired <-chan pubsub.Event
+}
+
+// enqueue publishes a command event with uuid, and waits until the store
+// queued it.
+func (q *testQueue) enqueue(t *testing.T, uuid string, expires time.Time) {
+	t.Helper()
+	payload := &mdmcmd.CommandPayload{
+		CommandUUID: uuid,
+		Command:     &mdmcmd.Command{RequestType: "DeviceInformation"},
+	}
+	event := command.NewEvent(payload, udid)
+	event.Expires = expires
+	msg, err := command.MarshalEvent(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.pub.Publish(context.Background(), command.CommandTopic, msg); err != nil {
+		t.Fatal(err)
+	}
+	q.waitQueued(t, uuid)
+}
+
+func (q *testQueue) waitQueued(t *testing.T, uuid string) {
+	t.Helper()
+	for {
+		select {
+		case ev := <-q.queued:
+			cq, err := queue.UnmarshalQueuedCommand(ev.Message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cq.CommandUUID == uuid {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for command %s to be queued", uuid)
+		}
+	}
+}
+
+// next responds status to the command uuid, and returns the UUID of the next
+// command, or an empty string if the queue is empty.
+func (q *testQueue) next(t *testing.T, status, uuid string) string {
+	t.Helper()
+	payload, err := q.Next(context.Background(), mdm.Response{UDID: udid, Status: status, CommandUUID: uuid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) == 0 {
+		return ""
+	}
+	var cmd mdmcmd.CommandPayload
+	if err := plist.Unmarshal(payload, &cmd); err != nil {
+		t.Fatalf("unmarshal next command: %s", err)
+	}
+	return cmd.CommandUUID
+}
+
+func (q *testQueue) view(t *testing.T) []string {
+	t.Helper()
+	cmds, err := q.ViewQueue(context.Background(), checkinEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uuids []string
+	for _, cmd := range cmds {
+		uuids = append(uuids, cmd.UUID)
+	}
+	return uuids
+}
+
+func checkinEvent() mdm.CheckinEvent {
+	return mdm.CheckinEvent{Command: mdm.CheckinCommand{UDID: udid}}
+}
+
+func testNext(t *testing.T, q *testQueue) {
+	for _, uuid := range []string{"xCmd", "yCmd", "zCmd"} {
+		q.enqueue(t, uuid, time.Time{})
+	}
+
+	if have, want := q.next(t, "Idle", ""), "xCmd"; have != want {
+		t.Errorf("Idle: have %q, want %q", have, want)
+	}
+	if have, want := q.next(t, "Acknowledged", "xCmd"), "yCmd"; have != want {
+		t.Errorf("Acknowledged: have %q, want %q", have, want)
+	}
+	// a NotNow command is only sent again once the other commands were.
+	if have, want := q.next(t, "NotNow", "yCmd"), "zCmd"; have != want {
+		t.Errorf("NotNow: have %q, want %q", have, want)
+	}
+	if have, want := q.next(t, "Error", "zCmd"), "yCmd"; have != want {
+		t.Errorf("Error: have %q, want %q", have, want)
+	}
+	if have, want := q.next(t, "Acknowledged", "yCmd"), ""; have != want {
+		t.Errorf("empty queue: have %q, want %q", have, want)
+	}
+	if have, want := q.next(t, "Idle", ""), ""; have != want {
+		t.Errorf("Idle on empty queue: have %q, want %q", have, want)
+	}
+}
+
+func testNextUnknownStatus(t *testing.T, q *testQueue) {
+	q.enqueue(t, "xCmd", time.Time{})
+	if _, err := q.Next(context.Background(), mdm.Response{UDID: udid, Status: "Unknown"}); err == nil {
+		t.Error("expected error for an unknown status")
+	}
+}
+
+func testNextExpired(t *testing.T, q *testQueue) {
+	q.enqueue(t, "expired", time.Now().Add(-time.Minute))
+	q.enqueue(t, "valid", time.Now().Add(time.Hour))
+
+	if have, want := q.next(t, "Idle", ""), "valid"; have != want {
+		t.Errorf("have next command %q, want %q", have, want)
+	}
+	if have := q.view(t); len(have) != 1 || have[0] != "valid" {
+		t.Errorf("have queue %v, want valid", have)
+	}
+
+	select {
+	case ev := <-q.expired:
+		var expired queue.CommandExpiredEvent
+		if err := json.Unmarshal(ev.Message, &expired); err != nil {
+			t.Fatal(err)
+		}
+		if expired.DeviceUDID != udid || expired.CommandUUID != "expired" {
+			t.Errorf("unexpected expired event %+v", expired)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the expired event")
+	}
+}
+
+func testRawCommand(t *testing.T, q *testQueue) {
+	raw := []byte("raw command")
+	msg, err := command.MarshalRawEvent(command.NewRawEvent(&command.RawCommand{
+		UDID:        udid,
+		CommandUUID: "rawCmd",
+		Raw:         raw,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.pub.Publish(context.Background(), command.RawCommandTopic, msg); err != nil {
+		t.Fatal(err)
+	}
+	q.waitQueued(t, "rawCmd")
+
+	payload, err := q.Next(context.Background(), mdm.Response{UDID: udid, Status: "Idle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := string(payload), string(raw); have != want {
+		t.Errorf("have payload %q, want %q", have, want)
+	}
+}
+
+func testViewQueue(t *testing.T, q *testQueue) {
+	if have := q.view(t); len(have) != 0 {
+		t.Errorf("have queue %v for an unknown device, want an empty queue", have)
+	}
+
+	q.enqueue(t, "xCmd", time.Time{})
+	q.enqueue(t, "yCmd", time.Time{})
+
+	cmds, err := q.ViewQueue(context.Background(), checkinEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 2 || cmds[0].UUID != "xCmd" || cmds[1].UUID != "yCmd" {
+		t.Fatalf("have queue %v, want xCmd and yCmd", cmds)
+	}
+	for _, cmd := range cmds {
+		if cmd.QueuedAt.IsZero() {
+			t.Errorf("missing queued at time of %s", cmd.UUID)
+		}
+		if len(cmd.Payload) == 0 {
+			t.Errorf("missing payload of %s", cmd.UUID)
+		}
+	}
+}
+
+func testDeleteCommand(t *testing.T, q *testQueue) {
+	ctx := context.Background()
+	if err := q.DeleteCommand(ctx, checkinEvent(), "xCmd"); err != mdm.ErrCommandNotFound {
+		t.Errorf("have err %v for an unknown device, want %v", err, mdm.ErrCommandNotFound)
+	}
+
+	for _, uuid := range []string{"xCmd", "yCmd", "zCmd"} {
+		q.enqueue(t, uuid, time.Time{})
+	}
+	if err := q.DeleteCommand(ctx, checkinEvent(), "yCmd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.DeleteCommand(ctx, checkinEvent(), "yCmd"); err != mdm.ErrCommandNotFound {
+		t.Errorf("have err %v, want %v", err, mdm.ErrCommandNotFound)
+	}
+	if have := q.view(t); len(have) != 2 || have[0] != "xCmd" || have[1] != "zCmd" {
+		t.Errorf("have queue %v, want xCmd and zCmd", have)
+	}
+}
+
+func testClear(t *testing.T, q *testQueue) {
+	q.enqueue(t, "xCmd", time.Time{})
+	q.enqueue(t, "yCmd", time.Time{})
+
+	if err := q.Clear(context.Background(), checkinEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if have := q.view(t); len(have) != 0 {
+		t.Errorf("have queue %v after clear, want an empty queue", have)
+	}
+	if have, want := q.next(t, "Idle", ""), ""; have != want {
+		t.Errorf("have next command %q after clear, want %q", have, want)
+	}
+}
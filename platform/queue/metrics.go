@@ -0,0 +1,32 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/platform/pubsub"
+)
+
+// CountQueuedCommands adds every command queued by any of the queues to commands,
+// with the status "Queued", until ctx is done.
+func CountQueuedCommands(ctx context.Context, sub pubsub.Subscriber, commands metrics.Counter) error {
+	const subscription = "queue_metrics"
+	queued, err := sub.Subscribe(ctx, subscription, CommandQueuedTopic)
+	if err != nil {
+		return errors.Wrapf(err, "subscribing %s to %s topic", subscription, CommandQueuedTopic)
+	}
+	counter := commands.With("status", "Queued")
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-queued:
+				counter.Add(1)
+			}
+		}
+	}()
+	return nil
+}
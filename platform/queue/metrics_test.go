@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+)
+
+func TestCountQueuedCommands(t *testing.T) {
+	commands := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "micromdm_commands_total"}, []string{"status"})
+	pubsub := inmem.NewPubSub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := CountQueuedCommands(ctx, pubsub, kitprometheus.NewCounter(commands)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, uuid := range []string{"xCmd", "yCmd"} {
+		if err := PublishCommandQueued(pubsub, "UDID", uuid); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		have := testutil.ToFloat64(commands.WithLabelValues("Queued"))
+		if have == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("have %v queued commands, want 2", have)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,437 @@
+// Package pg implements a PostgreSQL backed queue for MDM Commands.
+//
+// The commands of every device are rows of the command_queue table, so that
+// several MicroMDM instances can share the queue. Changes to the queue of a device
+// are made in a transaction which holds an advisory lock on the device UDID.
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/groob/plist"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	sq "gopkg.in/Masterminds/squirrel.v1"
+
+	"github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/pkg/ctxlog"
+	"github.com/micromdm/micromdm/pkg/drain"
+	"github.com/micromdm/micromdm/platform/command"
+	"github.com/micromdm/micromdm/platform/pubsub"
+	"github.com/micromdm/micromdm/platform/queue"
+)
+
+const tableName = "command_queue"
+
+// The status of a command in the queue. Commands which are completed or failed
+// are kept as history, unless the queue was created WithoutHistory.
+const (
+	statusQueued    = "queued"
+	statusNotNow    = "not_now"
+	statusCompleted = "completed"
+	statusFailed    = "failed"
+)
+
+const nextPosition = "nextval('command_queue_position_seq')"
+
+type Postgres struct {
+	db             *sqlx.DB
+	logger         log.Logger
+	pub            pubsub.Publisher
+	withoutHistory bool
+	work           drain.Group
+}
+
+type Option func(*Postgres)
+
+func WithLogger(logger log.Logger) Option {
+	return func(d *Postgres) {
+		d.logger = logger
+	}
+}
+
+func WithoutHistory() Option {
+	return func(d *Postgres) {
+		d.withoutHistory = true
+	}
+}
+
+// New creates the queue and starts saving the commands published to the command topics.
+func New(db *sqlx.DB, pubsub pubsub.PublishSubscriber, opts ...Option) (*Postgres, error) {
+	d := &Postgres{db: db, logger: log.NewNopLogger(), pub: pubsub}
+	for _, fn := range opts {
+		fn(d)
+	}
+
+	commandEvents, err := pubsub.Subscribe(context.TODO(), "command-queue", command.CommandTopic)
+	if err != nil {
+		return nil, errors.Wrapf(err, "subscribing push to %s topic", command.CommandTopic)
+	}
+	rawCommandEvents, err := pubsub.Subscribe(context.TODO(), "command-queue", command.RawCommandTopic)
+	if err != nil {
+		return nil, errors.Wrapf(err, "subscribing push to %s topic", command.RawCommandTopic)
+	}
+	go func() {
+		for {
+			select {
+			case event := <-commandEvents:
+				d.work.Add()
+				d.queueCommand(event.Message)
+				d.work.Done()
+			case event := <-rawCommandEvents:
+				d.work.Add()
+				d.queueRawCommand(event.Message)
+				d.work.Done()
+			}
+		}
+	}()
+	return d, nil
+}
+
+// Work tracks the command events which are being saved to the queue.
+func (d *Postgres) Work() *drain.Group {
+	return &d.work
+}
+
+func (d *Postgres) queueCommand(message []byte) {
+	var ev command.Event
+	if err := command.UnmarshalEvent(message, &ev); err != nil {
+		level.Info(d.logger).Log("msg", "unmarshal command event in queue", "err", err)
+		return
+	}
+	payload, err := plist.Marshal(ev.Payload)
+	if err != nil {
+		level.Info(d.logger).Log("msg", "marshal event payload", "err", err)
+		return
+	}
+	if err := d.enqueue(context.TODO(), ev.DeviceUDID, ev.Payload.CommandUUID, payload, ev.Expires); err != nil {
+		level.Info(d.logger).Log("msg", "save command in db", "err", err)
+		return
+	}
+	level.Info(d.logger).Log(
+		"msg", "queued event for device",
+		"device_udid", ev.DeviceUDID,
+		"command_uuid", ev.Payload.CommandUUID,
+		"request_type", ev.Payload.Command.RequestType,
+	)
+
+	if err := queue.PublishCommandQueued(d.pub, ev.DeviceUDID, ev.Payload.CommandUUID); err != nil {
+		level.Info(d.logger).Log("msg", "publish command to queued topic", "err", err)
+	}
+}
+
+func (d *Postgres) queueRawCommand(message []byte) {
+	var ev command.RawEvent
+	if err := command.UnmarshalRawEvent(message, &ev); err != nil {
+		level.Info(d.logger).Log("msg", "unmarshal raw command event in queue", "err", err)
+		return
+	}
+	if err := d.enqueue(context.TODO(), ev.DeviceUDID, ev.CommandUUID, ev.Payload, time.Time{}); err != nil {
+		level.Info(d.logger).Log("msg", "save command in db", "err", err)
+		return
+	}
+	level.Info(d.logger).Log(
+		"msg", "queued raw event for device",
+		"device_udid", ev.DeviceUDID,
+		"command_uuid", ev.CommandUUID,
+	)
+
+	if err := queue.PublishCommandQueued(d.pub, ev.DeviceUDID, ev.CommandUUID); err != nil {
+		level.Info(d.logger).Log("msg", "publish command to queued topic", "err", err)
+	}
+}
+
+// enqueue adds the command to the end of the queue of the device. A command
+// which is already in the queue, such as an event delivered twice, is ignored.
+func (d *Postgres) enqueue(ctx context.Context, udid, uuid string, payload []byte, expires time.Time) error {
+	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Insert(tableName).
+		Columns("udid", "command_uuid", "payload", "status", "expires_at").
+		Values(udid, uuid, payload, statusQueued, nullTime(expires)).
+		Suffix("ON CONFLICT (udid, command_uuid) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "building sql")
+	}
+	_, err = d.db.ExecContext(ctx, query, args...)
+	return errors.Wrap(err, "insert command in pg")
+}
+
+// Next updates the queue with the response to the previous command,
+// and returns the next command for the device.
+func (d *Postgres) Next(ctx context.Context, resp mdm.Response) ([]byte, error) {
+	// The UDID is the primary key for the queue.
+	// Depending on the enrollment type, replace the UDID with a different ID type.
+	// UserID for managed user channel
+	// EnrollmentID for BYOD User Enrollment.
+	udid := resp.UDID
+	if resp.UserID != nil {
+		udid = *resp.UserID
+	}
+	if resp.EnrollmentID != nil {
+		udid = *resp.EnrollmentID
+	}
+
+	var (
+		payload []byte
+		expired []expiredCommand
+	)
+	err := d.withDeviceLock(ctx, udid, func(tx *sqlx.Tx) error {
+		if err := d.updateStatus(ctx, tx, udid, resp); err != nil {
+			return err
+		}
+
+		var err error
+		expired, err = d.expire(ctx, tx, udid, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		// send the first command from the queue and move it to the end.
+		// If the regular queue is empty, send a command that got
+		// refused with NotNow before.
+		payload, err = d.pop(ctx, tx, udid, statusQueued)
+		if err != nil || payload != nil || resp.Status == "NotNow" {
+			return err
+		}
+		payload, err = d.pop(ctx, tx, udid, statusNotNow)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "get next command from queue, udid: %s", udid)
+	}
+
+	for _, x := range expired {
+		level.Info(ctxlog.Logger(ctx, d.logger)).Log(
+			"msg", "dropped expired command",
+			"command_uuid", x.UUID,
+			"expired_at", x.ExpiresAt,
+		)
+		if err := queue.PublishCommandExpired(d.pub, udid, x.UUID, x.ExpiresAt); err != nil {
+			level.Info(ctxlog.Logger(ctx, d.logger)).Log("msg", "publish command to expired topic", "err", err)
+		}
+	}
+	return payload, nil
+}
+
+// updateStatus records the response of the device to a queued command.
+func (d *Postgres) updateStatus(ctx context.Context, tx *sqlx.Tx, udid string, resp mdm.Response) error {
+	where := sq.Eq{"udid": udid, "command_uuid": resp.CommandUUID, "status": statusQueued}
+	var update sq.Sqlizer
+	switch resp.Status {
+	case "NotNow":
+		// We will try this command later when the device is not
+		// responding with NotNow
+		update = sq.StatementBuilder.PlaceholderFormat(sq.Dollar).Update(tableName).
+			Set("status", statusNotNow).
+			Set("position", sq.Expr(nextPosition)).
+			Where(where)
+	case "Acknowledged", "Error", "CommandFormatError":
+		if d.withoutHistory {
+			update = sq.StatementBuilder.PlaceholderFormat(sq.Dollar).Delete(tableName).Where(where)
+			break
+		}
+		status := statusFailed
+		if resp.Status == "Acknowledged" {
+			status = statusCompleted
+		}
+		update = sq.StatementBuilder.PlaceholderFormat(sq.Dollar).Update(tableName).
+			Set("status", status).
+			Set("last_status", resp.Status).
+			Set("completed_at", time.Now().UTC()).
+			Where(where)
+	case "Idle":
+		// will send next command
+		return nil
+	default:
+		return fmt.Errorf("unknown response status: %s", resp.Status)
+	}
+
+	query, args, err := update.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "building sql")
+	}
+	_, err = tx.ExecContext(ctx, query, args...)
+	return errors.Wrapf(err, "update command status for %s response", resp.Status)
+}
+
+type expiredCommand struct {
+	UUID      string    `db:"command_uuid"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// expire drops the commands which expired before they could be sent.
+func (d *Postgres) expire(ctx context.Context, tx *sqlx.Tx, udid string, now time.Time) ([]expiredCommand, error) {
+	where := sq.And{
+		sq.Eq{"udid": udid, "status": []string{statusQueued, statusNotNow}},
+		sq.NotEq{"expires_at": nil},
+		sq.LtOrEq{"expires_at": now},
+	}
+	var expire sq.Sqlizer
+	if d.withoutHistory {
+		expire = sq.StatementBuilder.PlaceholderFormat(sq.Dollar).Delete(tableName).
+			Where(where).
+			Suffix("RETURNING command_uuid, expires_at")
+	} else {
+		expire = sq.StatementBuilder.PlaceholderFormat(sq.Dollar).Update(tableName).
+			Set("status", statusFailed).
+			Set("last_status", "Expired").
+			Where(where).
+			Suffix("RETURNING command_uuid, expires_at")
+	}
+	query, args, err := expire.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "building sql")
+	}
+	var expired []expiredCommand
+	err = tx.SelectContext(ctx, &expired, query, args...)
+	return expired, errors.Wrap(err, "drop expired commands")
+}
+
+// pop returns the payload of the first command of the device with status,
+// and moves the command to the end of the queue.
+func (d *Postgres) pop(ctx context.Context, tx *sqlx.Tx, udid, status string) ([]byte, error) {
+	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("command_uuid", "payload").
+		From(tableName).
+		Where(sq.Eq{"udid": udid, "status": status}).
+		OrderBy("position").
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "building sql")
+	}
+	var cmd struct {
+		UUID    string `db:"command_uuid"`
+		Payload []byte `db:"payload"`
+	}
+	err = tx.QueryRowxContext(ctx, query, args...).StructScan(&cmd)
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "select next command")
+	}
+
+	query, args, err = sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Update(tableName).
+		Set("status", statusQueued).
+		Set("position", sq.Expr(nextPosition)).
+		Where(sq.Eq{"udid": udid, "command_uuid": cmd.UUID}).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "building sql")
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, errors.Wrap(err, "move command to the end of the queue")
+	}
+	return cmd.Payload, nil
+}
+
+func (d *Postgres) Clear(ctx context.Context, event mdm.CheckinEvent) error {
+	udid := event.Command.UDID
+	if event.Command.UserID != "" {
+		udid = event.Command.UserID
+	}
+	if event.Command.EnrollmentID != "" {
+		udid = event.Command.EnrollmentID
+	}
+
+	return d.withDeviceLock(ctx, udid, func(tx *sqlx.Tx) error {
+		query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+			Delete(tableName).
+			Where(sq.Eq{"udid": udid, "status": []string{statusQueued, statusNotNow}}).
+			ToSql()
+		if err != nil {
+			return errors.Wrap(err, "building sql")
+		}
+		_, err = tx.ExecContext(ctx, query, args...)
+		return errors.Wrapf(err, "clear queue, udid: %s", udid)
+	})
+}
+
+func (d *Postgres) ViewQueue(ctx context.Context, event mdm.CheckinEvent) ([]*mdm.Command, error) {
+	udid := event.Command.UDID
+	if event.Command.UserID != "" {
+		udid = event.Command.UserID
+	}
+	if event.Command.EnrollmentID != "" {
+		udid = event.Command.EnrollmentID
+	}
+
+	query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("command_uuid AS uuid", "payload", "created_at AS queued_at").
+		From(tableName).
+		Where(sq.Eq{"udid": udid, "status": statusQueued}).
+		OrderBy("position").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "building sql")
+	}
+	var cmds []*mdm.Command
+	err = d.db.SelectContext(ctx, &cmds, query, args...)
+	return cmds, errors.Wrapf(err, "get device commands, udid: %s", udid)
+}
+
+// DeleteCommand removes the command with uuid from the queue for the enrollment in event.
+func (d *Postgres) DeleteCommand(ctx context.Context, event mdm.CheckinEvent, uuid string) error {
+	udid := event.Command.UDID
+	if event.Command.UserID != "" {
+		udid = event.Command.UserID
+	}
+	if event.Command.EnrollmentID != "" {
+		udid = event.Command.EnrollmentID
+	}
+
+	return d.withDeviceLock(ctx, udid, func(tx *sqlx.Tx) error {
+		query, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+			Delete(tableName).
+			Where(sq.Eq{"udid": udid, "command_uuid": uuid, "status": []string{statusQueued, statusNotNow}}).
+			ToSql()
+		if err != nil {
+			return errors.Wrap(err, "building sql")
+		}
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return errors.Wrapf(err, "delete command, udid: %s", udid)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "rows affected by delete command")
+		}
+		if rows == 0 {
+			return mdm.ErrCommandNotFound
+		}
+		return nil
+	})
+}
+
+// withDeviceLock runs fn in a transaction which holds the advisory lock of udid,
+// so that the queue of a device is changed by one instance at a time.
+func (d *Postgres) withDeviceLock(ctx context.Context, udid string, fn func(tx *sqlx.Tx) error) error {
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", udid); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "lock device queue")
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "commit transaction")
+}
+
+// nullTime stores a zero time, such as a command which never expires, as NULL.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
@@ -0,0 +1,192 @@
+package pg
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/kolide/kit/dbutil"
+	_ "github.com/lib/pq"
+
+	"github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/platform/pubsub"
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+	"github.com/micromdm/micromdm/platform/queue"
+	"github.com/micromdm/micromdm/platform/queue/internal/storetest"
+)
+
+var _ queue.CommandStore = (*Postgres)(nil)
+
+func TestPostgres(t *testing.T) {
+	storetest.Test(t, func(t *testing.T, pubsub pubsub.PublishSubscriber) queue.CommandStore {
+		q, err := New(setup(t).db, pubsub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	})
+}
+
+func TestNext(t *testing.T) {
+	db := setup(t)
+	ctx := context.Background()
+	udid := "TestDevice"
+	for _, uuid := range []string{"xCmd", "yCmd", "zCmd"} {
+		if err := db.enqueue(ctx, udid, uuid, []byte(uuid), time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	next := func(status, uuid string) string {
+		t.Helper()
+		payload, err := db.Next(ctx, mdm.Response{UDID: udid, Status: status, CommandUUID: uuid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(payload)
+	}
+
+	if have, want := next("Idle", ""), "xCmd"; have != want {
+		t.Errorf("Idle: have %q, want %q", have, want)
+	}
+	if have, want := next("Acknowledged", "xCmd"), "yCmd"; have != want {
+		t.Errorf("Acknowledged: have %q, want %q", have, want)
+	}
+	// a NotNow command is only sent once the other commands were.
+	if have, want := next("NotNow", "yCmd"), "zCmd"; have != want {
+		t.Errorf("NotNow: have %q, want %q", have, want)
+	}
+	if have, want := next("Error", "zCmd"), "yCmd"; have != want {
+		t.Errorf("Error: have %q, want %q", have, want)
+	}
+	if have, want := next("Acknowledged", "yCmd"), ""; have != want {
+		t.Errorf("empty queue: have %q, want %q", have, want)
+	}
+
+	if _, err := db.Next(ctx, mdm.Response{UDID: udid, Status: "Unknown"}); err == nil {
+		t.Error("expected error for an unknown status")
+	}
+}
+
+func TestNextExpired(t *testing.T) {
+	db := setup(t)
+	ctx := context.Background()
+	udid := "TestDevice"
+	if err := db.enqueue(ctx, udid, "expired", []byte("expired"), time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.enqueue(ctx, udid, "valid", []byte("valid"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := db.Next(ctx, mdm.Response{UDID: udid, Status: "Idle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := string(payload), "valid"; have != want {
+		t.Errorf("have %q, want %q", have, want)
+	}
+
+	cmds, err := db.ViewQueue(ctx, checkinEvent(udid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 1 || cmds[0].UUID != "valid" {
+		t.Errorf("have queue %v, want only the valid command", cmds)
+	}
+}
+
+func TestViewAndClear(t *testing.T) {
+	db := setup(t)
+	ctx := context.Background()
+	udid := "TestDevice"
+	for _, uuid := range []string{"xCmd", "yCmd", "xCmd"} {
+		if err := db.enqueue(ctx, udid, uuid, []byte(uuid), time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmds, err := db.ViewQueue(ctx, checkinEvent(udid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(cmds), 2; have != want {
+		t.Fatalf("have %d queued commands, want %d", have, want)
+	}
+	if cmds[0].UUID != "xCmd" || string(cmds[1].Payload) != "yCmd" {
+		t.Errorf("have queue %v, want xCmd and yCmd in order", cmds)
+	}
+
+	if err := db.Clear(ctx, checkinEvent(udid)); err != nil {
+		t.Fatal(err)
+	}
+	cmds, err = db.ViewQueue(ctx, checkinEvent(udid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 0 {
+		t.Errorf("have %d queued commands after Clear, want none", len(cmds))
+	}
+}
+
+func TestDeleteCommand(t *testing.T) {
+	db := setup(t)
+	ctx := context.Background()
+	udid := "TestDevice"
+	for _, uuid := range []string{"xCmd", "yCmd", "zCmd"} {
+		if err := db.enqueue(ctx, udid, uuid, []byte(uuid), time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.DeleteCommand(ctx, checkinEvent(udid), "yCmd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteCommand(ctx, checkinEvent(udid), "yCmd"); err != mdm.ErrCommandNotFound {
+		t.Errorf("have err %v, want %v", err, mdm.ErrCommandNotFound)
+	}
+
+	cmds, err := db.ViewQueue(ctx, checkinEvent(udid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 2 || cmds[0].UUID != "xCmd" || cmds[1].UUID != "zCmd" {
+		t.Errorf("have queue %v, want xCmd and zCmd", cmds)
+	}
+	if cmds[0].QueuedAt.IsZero() {
+		t.Error("missing queued at time")
+	}
+}
+
+func checkinEvent(udid string) mdm.CheckinEvent {
+	return mdm.CheckinEvent{Command: mdm.CheckinCommand{UDID: udid}}
+}
+
+// setup connects to the database at DATABASE_URL, which must be migrated
+// with the pg/migrations, or skips the test if DATABASE_URL is not set.
+func setup(t *testing.T) *Postgres {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	db, err := dbutil.OpenDBX(
+		"postgres",
+		dsn,
+		dbutil.WithLogger(log.NewNopLogger()),
+		dbutil.WithMaxAttempts(1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("TRUNCATE " + tableName); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, err := New(db, inmem.NewPubSub())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return queue
+}
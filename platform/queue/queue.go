@@ -13,6 +13,8 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/pkg/ctxlog"
+	"github.com/micromdm/micromdm/pkg/drain"
 	"github.com/micromdm/micromdm/platform/command"
 	"github.com/micromdm/micromdm/platform/pubsub"
 )
@@ -23,10 +25,23 @@ const (
 	CommandQueuedTopic = "mdm.CommandQueued"
 )
 
+// CommandStore is a command queue. Commands are saved to it from the command
+// events it subscribes to, and are sent to the enrollments which check in with
+// Next. It is implemented by Store, and by the inmem and pg packages.
+type CommandStore interface {
+	mdm.Queue
+
+	// Work tracks the command events which are being saved to the queue.
+	Work() *drain.Group
+}
+
+// Store is a CommandStore backed by BoltDB.
 type Store struct {
 	*bolt.DB
 	logger         log.Logger
+	pub            pubsub.Publisher
 	withoutHistory bool
+	work           drain.Group
 }
 
 type Option func(*Store)
@@ -73,14 +88,51 @@ func (db *Store) ViewQueue(ctx context.Context, event mdm.CheckinEvent) ([]*mdm.
 	cmds := make([]*mdm.Command, len(dc.Commands))
 	for idx, cmd := range dc.Commands {
 		cmds[idx] = &mdm.Command{
-			UUID:    cmd.UUID,
-			Payload: cmd.Payload,
+			UUID:     cmd.UUID,
+			Payload:  cmd.Payload,
+			QueuedAt: cmd.queuedAt(),
 		}
 	}
 
 	return cmds, nil
 }
 
+// DeleteCommand removes the command with uuid from the queue for the enrollment in event.
+func (db *Store) DeleteCommand(ctx context.Context, event mdm.CheckinEvent, uuid string) error {
+	udid := event.Command.UDID
+	if event.Command.UserID != "" {
+		udid = event.Command.UserID
+	}
+	if event.Command.EnrollmentID != "" {
+		udid = event.Command.EnrollmentID
+	}
+
+	dc, err := db.DeviceCommand(udid)
+	if isNotFound(err) {
+		return mdm.ErrCommandNotFound
+	} else if err != nil {
+		return errors.Wrapf(err, "get device to delete command, udid: %s", udid)
+	}
+
+	var deleted bool
+	if dc.Commands, deleted = removeCommand(dc.Commands, uuid); !deleted {
+		if dc.NotNow, deleted = removeCommand(dc.NotNow, uuid); !deleted {
+			return mdm.ErrCommandNotFound
+		}
+	}
+	return db.Save(dc)
+}
+
+// removeCommand removes the first command with uuid from all.
+func removeCommand(all []Command, uuid string) ([]Command, bool) {
+	for i, cmd := range all {
+		if cmd.UUID == uuid {
+			return append(all[:i], all[i+1:]...), true
+		}
+	}
+	return all, false
+}
+
 func (db *Store) Clear(ctx context.Context, event mdm.CheckinEvent) error {
 	udid := event.Command.UDID
 	if event.Command.UserID != "" {
@@ -178,6 +230,19 @@ func (db *Store) nextCommand(ctx context.Context, resp mdm.Response) (*Command,
 		return nil, fmt.Errorf("unknown response status: %s", resp.Status)
 	}
 
+	// drop commands which expired before they could be sent.
+	now := time.Now().UTC()
+	expired, commands := cutExpired(dc.Commands, now)
+	expiredNotNow, notNow := cutExpired(dc.NotNow, now)
+	dc.Commands, dc.NotNow = commands, notNow
+	expired = append(expired, expiredNotNow...)
+	if !db.withoutHistory {
+		for _, x := range expired {
+			x.LastStatus = "Expired"
+			dc.Failed = append(dc.Failed, x)
+		}
+	}
+
 	// pop the first command from the queue and add it to the end.
 	// If the regular queue is empty, send a command that got
 	// refused with NotNow before.
@@ -192,13 +257,27 @@ func (db *Store) nextCommand(ctx context.Context, resp mdm.Response) (*Command,
 	}
 
 	// we only need to Save if there are command queue changes such as
-	// NowNow and Acknowledged responses or a new popped command.
-	if resp.Status != "Idle" || cmd != nil {
+	// NowNow and Acknowledged responses, expired commands or a new popped command.
+	if resp.Status != "Idle" || cmd != nil || len(expired) > 0 {
 		if err := db.Save(dc); err != nil {
 			return nil, err
 		}
 	}
 
+	for _, x := range expired {
+		level.Info(ctxlog.Logger(ctx, db.logger)).Log(
+			"msg", "dropped expired command",
+			"command_uuid", x.UUID,
+			"expired_at", x.ExpiresAt,
+		)
+		if err := PublishCommandExpired(db.pub, dc.DeviceUDID, x.UUID, x.ExpiresAt); err != nil {
+			level.Info(ctxlog.Logger(ctx, db.logger)).Log(
+				"msg", "publish command to expired topic",
+				"err", err,
+			)
+		}
+	}
+
 	return cmd, nil
 }
 
@@ -230,7 +309,7 @@ func NewQueue(db *bolt.DB, pubsub pubsub.PublishSubscriber, opts ...Option) (*St
 		return nil, errors.Wrapf(err, "creating %s bucket", DeviceCommandBucket)
 	}
 
-	datastore := &Store{DB: db, logger: log.NewNopLogger()}
+	datastore := &Store{DB: db, logger: log.NewNopLogger(), pub: pubsub}
 	for _, fn := range opts {
 		fn(datastore)
 	}
@@ -301,47 +380,9 @@ func (db *Store) pollCommands(pubsub pubsub.PublishSubscriber) error {
 		for {
 			select {
 			case event := <-commandEvents:
-				var ev command.Event
-				if err := command.UnmarshalEvent(event.Message, &ev); err != nil {
-					level.Info(db.logger).Log("msg", "unmarshal command event in queue", "err", err)
-					continue
-				}
-
-				cmd := new(DeviceCommand)
-				cmd.DeviceUDID = ev.DeviceUDID
-				byUDID, err := db.DeviceCommand(ev.DeviceUDID)
-				if err == nil && byUDID != nil {
-					cmd = byUDID
-				}
-				newPayload, err := plist.Marshal(ev.Payload)
-				if err != nil {
-					level.Info(db.logger).Log("msg", "marshal event payload", "err", err)
-					continue
-				}
-				newCmd := Command{
-					UUID:    ev.Payload.CommandUUID,
-					Payload: newPayload,
-				}
-				cmd.Commands = append(cmd.Commands, newCmd)
-				if err := db.Save(cmd); err != nil {
-					level.Info(db.logger).Log("msg", "save command in db", "err", err)
-					continue
-				}
-				level.Info(db.logger).Log(
-					"msg", "queued event for device",
-					"device_udid", ev.DeviceUDID,
-					"command_uuid", ev.Payload.CommandUUID,
-					"request_type", ev.Payload.Command.RequestType,
-				)
-
-				err = PublishCommandQueued(pubsub, ev.DeviceUDID, ev.Payload.CommandUUID)
-				if err != nil {
-					level.Info(db.logger).Log(
-						"msg", "publish command to queued topic",
-						"err", err,
-					)
-					continue
-				}
+				db.work.Add()
+				db.queueCommand(event.Message)
+				db.work.Done()
 			}
 		}
 	}()
@@ -349,6 +390,51 @@ func (db *Store) pollCommands(pubsub pubsub.PublishSubscriber) error {
 	return nil
 }
 
+func (db *Store) queueCommand(message []byte) {
+	var ev command.Event
+	if err := command.UnmarshalEvent(message, &ev); err != nil {
+		level.Info(db.logger).Log("msg", "unmarshal command event in queue", "err", err)
+		return
+	}
+
+	cmd := new(DeviceCommand)
+	cmd.DeviceUDID = ev.DeviceUDID
+	byUDID, err := db.DeviceCommand(ev.DeviceUDID)
+	if err == nil && byUDID != nil {
+		cmd = byUDID
+	}
+	newPayload, err := plist.Marshal(ev.Payload)
+	if err != nil {
+		level.Info(db.logger).Log("msg", "marshal event payload", "err", err)
+		return
+	}
+	newCmd := Command{
+		UUID:      ev.Payload.CommandUUID,
+		Payload:   newPayload,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: ev.Expires,
+	}
+	cmd.Commands = append(cmd.Commands, newCmd)
+	if err := db.Save(cmd); err != nil {
+		level.Info(db.logger).Log("msg", "save command in db", "err", err)
+		return
+	}
+	level.Info(db.logger).Log(
+		"msg", "queued event for device",
+		"device_udid", ev.DeviceUDID,
+		"command_uuid", ev.Payload.CommandUUID,
+		"request_type", ev.Payload.Command.RequestType,
+	)
+
+	err = PublishCommandQueued(db.pub, ev.DeviceUDID, ev.Payload.CommandUUID)
+	if err != nil {
+		level.Info(db.logger).Log(
+			"msg", "publish command to queued topic",
+			"err", err,
+		)
+	}
+}
+
 func (db *Store) pollRawCommands(pubsub pubsub.PublishSubscriber) error {
 	commandEvents, err := pubsub.Subscribe(context.TODO(), "command-queue", command.RawCommandTopic)
 	if err != nil {
@@ -359,41 +445,9 @@ func (db *Store) pollRawCommands(pubsub pubsub.PublishSubscriber) error {
 		for {
 			select {
 			case event := <-commandEvents:
-				var ev command.RawEvent
-				if err := command.UnmarshalRawEvent(event.Message, &ev); err != nil {
-					level.Info(db.logger).Log("msg", "unmarshal raw command event in queue", "err", err)
-					continue
-				}
-
-				cmd := new(DeviceCommand)
-				cmd.DeviceUDID = ev.DeviceUDID
-				byUDID, err := db.DeviceCommand(ev.DeviceUDID)
-				if err == nil && byUDID != nil {
-					cmd = byUDID
-				}
-				newCmd := Command{
-					UUID:    ev.CommandUUID,
-					Payload: ev.Payload,
-				}
-				cmd.Commands = append(cmd.Commands, newCmd)
-				if err := db.Save(cmd); err != nil {
-					level.Info(db.logger).Log("msg", "save command in db", "err", err)
-					continue
-				}
-				level.Info(db.logger).Log(
-					"msg", "queued raw event for device",
-					"device_udid", ev.DeviceUDID,
-					"command_uuid", ev.CommandUUID,
-				)
-
-				err = PublishCommandQueued(pubsub, ev.DeviceUDID, ev.CommandUUID)
-				if err != nil {
-					level.Info(db.logger).Log(
-						"msg", "publish command to queued topic",
-						"err", err,
-					)
-					continue
-				}
+				db.work.Add()
+				db.queueRawCommand(event.Message)
+				db.work.Done()
 			}
 		}
 	}()
@@ -401,6 +455,49 @@ func (db *Store) pollRawCommands(pubsub pubsub.PublishSubscriber) error {
 	return nil
 }
 
+func (db *Store) queueRawCommand(message []byte) {
+	var ev command.RawEvent
+	if err := command.UnmarshalRawEvent(message, &ev); err != nil {
+		level.Info(db.logger).Log("msg", "unmarshal raw command event in queue", "err", err)
+		return
+	}
+
+	cmd := new(DeviceCommand)
+	cmd.DeviceUDID = ev.DeviceUDID
+	byUDID, err := db.DeviceCommand(ev.DeviceUDID)
+	if err == nil && byUDID != nil {
+		cmd = byUDID
+	}
+	newCmd := Command{
+		UUID:      ev.CommandUUID,
+		Payload:   ev.Payload,
+		CreatedAt: time.Now().UTC(),
+	}
+	cmd.Commands = append(cmd.Commands, newCmd)
+	if err := db.Save(cmd); err != nil {
+		level.Info(db.logger).Log("msg", "save command in db", "err", err)
+		return
+	}
+	level.Info(db.logger).Log(
+		"msg", "queued raw event for device",
+		"device_udid", ev.DeviceUDID,
+		"command_uuid", ev.CommandUUID,
+	)
+
+	err = PublishCommandQueued(db.pub, ev.DeviceUDID, ev.CommandUUID)
+	if err != nil {
+		level.Info(db.logger).Log(
+			"msg", "publish command to queued topic",
+			"err", err,
+		)
+	}
+}
+
+// Work tracks the command events which are being saved to the queue.
+func (db *Store) Work() *drain.Group {
+	return &db.work
+}
+
 func isNotFound(err error) bool {
 	if _, ok := err.(*notFound); ok {
 		return true
@@ -2,9 +2,12 @@ package queue
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/go-kit/kit/log"
@@ -155,6 +158,80 @@ func TestNext_zeroCommands(t *testing.T) {
 
 }
 
+func TestNext_Expired(t *testing.T) {
+	store, teardown := setupDB(t)
+	defer teardown()
+
+	expiresAt := time.Now().Add(-time.Minute).UTC()
+	dc := &DeviceCommand{DeviceUDID: "TestDevice"}
+	dc.Commands = append(dc.Commands, Command{UUID: "xCmd", ExpiresAt: expiresAt})
+	dc.Commands = append(dc.Commands, Command{UUID: "yCmd", ExpiresAt: time.Now().Add(time.Hour)})
+	dc.NotNow = append(dc.NotNow, Command{UUID: "zCmd", ExpiresAt: expiresAt})
+	if err := store.Save(dc); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	resp := mdm.Response{UDID: dc.DeviceUDID, Status: "Idle"}
+	cmd, err := store.nextCommand(ctx, resp)
+	if err != nil {
+		t.Fatalf("expected nil, but got err: %s", err)
+	}
+	if cmd == nil || cmd.UUID != "yCmd" {
+		t.Fatalf("have %+v, want yCmd", cmd)
+	}
+
+	saved, err := store.DeviceCommand(dc.DeviceUDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(saved.Commands)+len(saved.NotNow), 1; have != want {
+		t.Errorf("have %d queued commands, want %d", have, want)
+	}
+	if have, want := len(saved.Failed), 2; have != want {
+		t.Fatalf("have %d failed commands, want %d", have, want)
+	}
+	for _, x := range saved.Failed {
+		if x.LastStatus != "Expired" || !x.ExpiresAt.Equal(expiresAt) {
+			t.Errorf("unexpected failed command %+v", x)
+		}
+	}
+
+	pub := store.pub.(*mockPublisher)
+	if have, want := len(pub.events), 2; have != want {
+		t.Fatalf("have %d expired events, want %d", have, want)
+	}
+	for i, uuid := range []string{"xCmd", "zCmd"} {
+		var ev CommandExpiredEvent
+		if err := json.Unmarshal(pub.events[i], &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.DeviceUDID != dc.DeviceUDID || ev.CommandUUID != uuid || !ev.ExpiredAt.Equal(expiresAt) {
+			t.Errorf("event %d: unexpected %+v", i, ev)
+		}
+	}
+
+	// a second check-in has nothing more to expire.
+	if _, err := store.nextCommand(ctx, resp); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(pub.events), 2; have != want {
+		t.Errorf("have %d expired events after another check-in, want %d", have, want)
+	}
+}
+
+type mockPublisher struct {
+	events [][]byte
+}
+
+func (p *mockPublisher) Publish(ctx context.Context, topic string, msg []byte) error {
+	if topic != CommandExpiredTopic {
+		return fmt.Errorf("unexpected topic %s", topic)
+	}
+	p.events = append(p.events, msg)
+	return nil
+}
+
 func setupDB(t *testing.T) (*Store, func()) {
 	f, _ := ioutil.TempFile("", "bolt-")
 	teardown := func() {
@@ -173,6 +250,44 @@ func setupDB(t *testing.T) (*Store, func()) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	store := &Store{DB: db, logger: log.NewNopLogger()}
+	store := &Store{DB: db, logger: log.NewNopLogger(), pub: &mockPublisher{}}
 	return store, teardown
 }
+
+func TestDeleteCommand(t *testing.T) {
+	store, teardown := setupDB(t)
+	defer teardown()
+
+	dc := &DeviceCommand{DeviceUDID: "TestDevice"}
+	dc.Commands = []Command{{UUID: "xCmd"}, {UUID: "yCmd"}, {UUID: "zCmd"}}
+	dc.NotNow = []Command{{UUID: "notNowCmd"}}
+	if err := store.Save(dc); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	event := mdm.CheckinEvent{Command: mdm.CheckinCommand{UDID: dc.DeviceUDID}}
+	for _, uuid := range []string{"yCmd", "notNowCmd"} {
+		if err := store.DeleteCommand(ctx, event, uuid); err != nil {
+			t.Fatalf("delete %s: %s", uuid, err)
+		}
+	}
+	if err := store.DeleteCommand(ctx, event, "yCmd"); err != mdm.ErrCommandNotFound {
+		t.Errorf("have err %v, want %v", err, mdm.ErrCommandNotFound)
+	}
+	unknown := mdm.CheckinEvent{Command: mdm.CheckinCommand{UDID: "UnknownDevice"}}
+	if err := store.DeleteCommand(ctx, unknown, "xCmd"); err != mdm.ErrCommandNotFound {
+		t.Errorf("unknown device: have err %v, want %v", err, mdm.ErrCommandNotFound)
+	}
+
+	dc, err := store.DeviceCommand(dc.DeviceUDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dc.Commands) != 2 || dc.Commands[0].UUID != "xCmd" || dc.Commands[1].UUID != "zCmd" {
+		t.Errorf("have commands %v, want xCmd and zCmd", dc.Commands)
+	}
+	if len(dc.NotNow) != 0 {
+		t.Errorf("have NotNow commands %v, want none", dc.NotNow)
+	}
+}
@@ -0,0 +1,29 @@
+package queue_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/micromdm/micromdm/platform/pubsub"
+	"github.com/micromdm/micromdm/platform/queue"
+	"github.com/micromdm/micromdm/platform/queue/internal/storetest"
+)
+
+var _ queue.CommandStore = (*queue.Store)(nil)
+
+func TestStore(t *testing.T) {
+	storetest.Test(t, func(t *testing.T, pubsub pubsub.PublishSubscriber) queue.CommandStore {
+		db, err := bolt.Open(filepath.Join(t.TempDir(), "queue.db"), 0777, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		store, err := queue.NewQueue(db, pubsub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
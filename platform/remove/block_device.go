@@ -8,7 +8,9 @@ import (
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/gorilla/mux"
+	"github.com/micromdm/micromdm/pkg/ctxlog"
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/platform/audit"
 	"github.com/pkg/errors"
 )
 
@@ -20,6 +22,10 @@ type blockDeviceRequest struct {
 	UDID string
 }
 
+func (r blockDeviceRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: "BlockDevice", UDIDs: []string{r.UDID}}
+}
+
 type blockDeviceResponse struct {
 	Err error `json:"err,omitempty"`
 }
@@ -74,7 +80,7 @@ func (e Endpoints) BlockDevice(ctx context.Context, udid string) error {
 
 func (mw logmw) BlockDevice(ctx context.Context, udid string) (err error) {
 	defer func(begin time.Time) {
-		_ = mw.logger.Log(
+		_ = ctxlog.Logger(ctx, mw.logger).Log(
 			"method", "BlockDevice",
 			"udid", udid,
 			"err", err,
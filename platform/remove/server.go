@@ -5,6 +5,7 @@ import (
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 )
 
 type Endpoints struct {
@@ -14,8 +15,8 @@ type Endpoints struct {
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		BlockDeviceEndpoint:   endpoint.Chain(outer, others...)(MakeBlockDeviceEndpoint(s)),
-		UnblockDeviceEndpoint: endpoint.Chain(outer, others...)(MakeUnblockDeviceEndpoint(s)),
+		BlockDeviceEndpoint:   endpoint.Chain(outer, others...)(scope.Require(scope.DevicesWrite)(MakeBlockDeviceEndpoint(s))),
+		UnblockDeviceEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.DevicesWrite)(MakeUnblockDeviceEndpoint(s))),
 	}
 }
 
@@ -9,7 +9,9 @@ import (
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/gorilla/mux"
+	"github.com/micromdm/micromdm/pkg/ctxlog"
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/platform/audit"
 )
 
 func (svc *RemoveService) UnblockDevice(ctx context.Context, udid string) error {
@@ -20,6 +22,10 @@ type unblockDeviceRequest struct {
 	UDID string
 }
 
+func (r unblockDeviceRequest) AuditTarget() audit.Target {
+	return audit.Target{Action: "UnblockDevice", UDIDs: []string{r.UDID}}
+}
+
 type unblockDeviceResponse struct {
 	Err error `json:"err,omitempty"`
 }
@@ -72,7 +78,7 @@ func (e Endpoints) UnblockDevice(ctx context.Context, udid string) error {
 
 func (mw logmw) UnblockDevice(ctx context.Context, udid string) (err error) {
 	defer func(begin time.Time) {
-		_ = mw.logger.Log(
+		_ = ctxlog.Logger(ctx, mw.logger).Log(
 			"method", "BlockDevice",
 			"udid", udid,
 			"err", err,
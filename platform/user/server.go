@@ -6,6 +6,7 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/micromdm/micromdm/pkg/httputil"
+	"github.com/micromdm/micromdm/pkg/scope"
 )
 
 type Endpoints struct {
@@ -15,8 +16,8 @@ type Endpoints struct {
 
 func MakeServerEndpoints(s Service, outer endpoint.Middleware, others ...endpoint.Middleware) Endpoints {
 	return Endpoints{
-		ApplyUserEndpoint: endpoint.Chain(outer, others...)(MakeApplyUserEndpoint(s)),
-		ListUsersEndpoint: endpoint.Chain(outer, others...)(MakeListUsersEndpoint(s)),
+		ApplyUserEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.ProfilesWrite)(MakeApplyUserEndpoint(s))),
+		ListUsersEndpoint: endpoint.Chain(outer, others...)(scope.Require(scope.ProfilesRead)(MakeListUsersEndpoint(s))),
 	}
 }
 
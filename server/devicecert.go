@@ -11,6 +11,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/pkg/ctxlog"
 )
 
 type ScepVerifyDepot interface {
@@ -81,14 +82,14 @@ func (mw *verifyCertificateMiddleware) Acknowledge(ctx context.Context, req mdm.
 
 	unauth_err := errors.New("unauthorized client")
 	if !hasCN && !mw.validateSCEPIssuer {
-		_ = level.Info(mw.logger).Log("err", unauth_err, "issuer", devcert.Issuer.String(), "expiration", devcert.NotAfter)
+		_ = level.Info(ctxlog.Logger(ctx, mw.logger)).Log("err", unauth_err, "issuer", devcert.Issuer.String(), "expiration", devcert.NotAfter)
 		return nil, unauth_err
 	}
 
 	if !hasCN && mw.validateSCEPIssuer {
 		err := mw.verifyIssuer(devcert)
 		if err != nil {
-			_ = level.Info(mw.logger).Log("err", err, "issuer", devcert.Issuer.String(), "expiration", devcert.NotAfter)
+			_ = level.Info(ctxlog.Logger(ctx, mw.logger)).Log("err", err, "issuer", devcert.Issuer.String(), "expiration", devcert.NotAfter)
 			return nil, unauth_err
 		}
 	}
@@ -107,13 +108,13 @@ func (mw *verifyCertificateMiddleware) Checkin(ctx context.Context, req mdm.Chec
 	}
 	unauth_err := errors.New("unauthorized client")
 	if !hasCN && !mw.validateSCEPIssuer {
-		_ = level.Info(mw.logger).Log("err", unauth_err, "issuer", devcert.Issuer.String(), "expiration", devcert.NotAfter)
+		_ = level.Info(ctxlog.Logger(ctx, mw.logger)).Log("err", unauth_err, "issuer", devcert.Issuer.String(), "expiration", devcert.NotAfter)
 		return nil, unauth_err
 	}
 	if !hasCN && mw.validateSCEPIssuer {
 		err := mw.verifyIssuer(devcert)
 		if err != nil {
-			_ = level.Info(mw.logger).Log("err", err, "issuer", devcert.Issuer.String(), "expiration", devcert.NotAfter)
+			_ = level.Info(ctxlog.Logger(ctx, mw.logger)).Log("err", err, "issuer", devcert.Issuer.String(), "expiration", devcert.NotAfter)
 			return nil, unauth_err
 		}
 	}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/pkg/crypto"
+	"github.com/micromdm/micromdm/pkg/health"
+)
+
+// HealthChecks are the checks served on /healthz. They check that the
+// datastores are reachable and that the push certificate is loaded and unexpired.
+func (c *Server) HealthChecks() []health.Check {
+	return []health.Check{
+		{Name: "datastore", Check: c.checkDatastore},
+		{Name: "push_certificate", Check: c.checkPushCertificate},
+	}
+}
+
+// ReadinessChecks are the checks served on /readyz. They are the HealthChecks
+// and a check that APNs can be reached with the push certificate.
+func (c *Server) ReadinessChecks() []health.Check {
+	return append(c.HealthChecks(), health.Check{Name: "apns", Check: c.checkAPNs})
+}
+
+func (c *Server) checkDatastore(ctx context.Context) error {
+	if err := c.DB.View(func(*bolt.Tx) error { return nil }); err != nil {
+		return errors.Wrap(err, "bolt")
+	}
+	if c.Postgres != nil {
+		if err := c.Postgres.PingContext(ctx); err != nil {
+			return errors.Wrap(err, "postgres")
+		}
+	}
+	return nil
+}
+
+func (c *Server) checkPushCertificate(ctx context.Context) error {
+	cert, err := c.ConfigDB.PushCertificate()
+	if err != nil {
+		return errors.Wrap(err, "push certificate is not loaded")
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		if len(cert.Certificate) == 0 {
+			return errors.New("push certificate is empty")
+		}
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return errors.Wrap(err, "parse push certificate")
+		}
+	}
+	if crypto.ExpiresWithin(leaf, 0) {
+		return fmt.Errorf("push certificate expired at %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (c *Server) checkAPNs(ctx context.Context) error {
+	if c.pushService == nil {
+		return errors.New("push service is not running")
+	}
+	return c.pushService.Ping(ctx)
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RobotsAndPencils/buford/push"
+	"github.com/boltdb/bolt"
+
+	"github.com/micromdm/micromdm/pkg/health"
+	"github.com/micromdm/micromdm/platform/apns"
+	configbuiltin "github.com/micromdm/micromdm/platform/config/builtin"
+	"github.com/micromdm/micromdm/platform/pubsub/inmem"
+)
+
+type noPushCertificate struct{}
+
+func (noPushCertificate) PushCertificate() (*tls.Certificate, error) {
+	return nil, errors.New("no push certificate")
+}
+
+func savePushCertificate(t *testing.T, store *configbuiltin.DB, notAfter time.Time) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "APSP:push"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.SavePushCertificate(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// healthServer returns a Server whose push service sends to apnsURL.
+func healthServer(t *testing.T, apnsURL string) *Server {
+	f, _ := ioutil.TempFile("", "bolt-")
+	f.Close()
+	os.Remove(f.Name())
+	db, err := bolt.Open(f.Name(), 0777, nil)
+	if err != nil {
+		t.Fatalf("couldn't open bolt, err %s\n", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(f.Name())
+	})
+	pubsub := inmem.NewPubSub()
+	configDB, err := configbuiltin.NewDB(db, pubsub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushsvc, err := apns.New(nil, noPushCertificate{}, pubsub, apns.WithPushService(push.NewService(http.DefaultClient, apnsURL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{DB: db, ConfigDB: configDB, pushService: pushsvc}
+}
+
+func TestHealthChecks(t *testing.T) {
+	apnsSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer apnsSrv.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name      string
+		apnsURL   string
+		setup     func(t *testing.T, c *Server)
+		healthz   int
+		readyz    int
+		failCheck string
+		reason    string
+	}{
+		{"healthy", apnsSrv.URL, nil, http.StatusOK, http.StatusOK, "", ""},
+		{"datastore closed", apnsSrv.URL, func(t *testing.T, c *Server) { c.DB.Close() },
+			http.StatusServiceUnavailable, http.StatusServiceUnavailable, "datastore", "database not open"},
+		{"no push certificate", apnsSrv.URL, func(t *testing.T, c *Server) { c.DB.Update(deleteConfig) },
+			http.StatusServiceUnavailable, http.StatusServiceUnavailable, "push_certificate", "push certificate is not loaded"},
+		{"expired push certificate", apnsSrv.URL, func(t *testing.T, c *Server) {
+			savePushCertificate(t, c.ConfigDB.(*configbuiltin.DB), time.Now().Add(-time.Hour))
+		}, http.StatusServiceUnavailable, http.StatusServiceUnavailable, "push_certificate", "push certificate expired at"},
+		{"apns unreachable", unreachable.URL, nil, http.StatusOK, http.StatusServiceUnavailable, "apns", "connect to APNs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := healthServer(t, tt.apnsURL)
+			savePushCertificate(t, c.ConfigDB.(*configbuiltin.DB), time.Now().Add(24*time.Hour))
+			if tt.setup != nil {
+				tt.setup(t, c)
+			}
+
+			for _, h := range []struct {
+				path   string
+				checks []health.Check
+				code   int
+			}{
+				{"/healthz", c.HealthChecks(), tt.healthz},
+				{"/readyz", c.ReadinessChecks(), tt.readyz},
+			} {
+				rec := httptest.NewRecorder()
+				health.Handler(h.checks...).ServeHTTP(rec, httptest.NewRequest("GET", h.path, nil))
+				if rec.Code != h.code {
+					t.Errorf("%s: have status %d, want %d: %s", h.path, rec.Code, h.code, rec.Body)
+				}
+				var resp health.Response
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatal(err)
+				}
+				if h.code == http.StatusOK {
+					if resp.Status != health.StatusOK {
+						t.Errorf("%s: have %+v, want all checks ok", h.path, resp)
+					}
+					continue
+				}
+				if resp.Status != health.StatusUnavailable || !strings.Contains(resp.Checks[tt.failCheck], tt.reason) {
+					t.Errorf("%s: have %+v, want check %s to fail with %q", h.path, resp, tt.failCheck, tt.reason)
+				}
+			}
+		})
+	}
+}
+
+func deleteConfig(tx *bolt.Tx) error {
+	return tx.Bucket([]byte(configbuiltin.ConfigBucket)).Delete([]byte("config"))
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/micromdm/micromdm/platform/queue"
+)
+
+// instruments are the metrics recorded by the server when Metrics is set.
+type instruments struct {
+	pushes       *kitprometheus.Counter
+	pushDuration *kitprometheus.Histogram
+	enrollments  *kitprometheus.Counter
+	commands     *kitprometheus.Counter
+}
+
+func (c *Server) setupMetrics() error {
+	if c.Metrics == nil {
+		return nil
+	}
+	pushes := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "micromdm_push_total",
+		Help: "Number of APNs push notifications sent, by status.",
+	}, []string{"status"})
+	pushDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "micromdm_push_duration_seconds",
+		Help:    "Time taken to send APNs push notifications, by status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"status"})
+	enrollments := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "micromdm_enrollments_total",
+		Help: "Number of device enrollments, by result.",
+	}, []string{"result"})
+	commands := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "micromdm_commands_total",
+		Help: "Number of MDM commands queued and of results reported by devices, by status.",
+	}, []string{"status"})
+	for _, collector := range []prometheus.Collector{pushes, pushDuration, enrollments, commands} {
+		if err := c.Metrics.Register(collector); err != nil {
+			return errors.Wrap(err, "registering metrics")
+		}
+	}
+
+	c.instruments = &instruments{
+		pushes:       kitprometheus.NewCounter(pushes),
+		pushDuration: kitprometheus.NewHistogram(pushDuration),
+		enrollments:  kitprometheus.NewCounter(enrollments),
+		commands:     kitprometheus.NewCounter(commands),
+	}
+	return queue.CountQueuedCommands(context.Background(), c.PubClient, c.instruments.commands)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"strings"
+
+	scep "github.com/micromdm/scep/v2/server"
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/pkg/crypto"
+)
+
+// scepCACaps are the capabilities returned by GetCACaps. Renewal is supported
+// because the signer accepts RenewalReq messages from enrolled devices.
+// SHA-1 and DES3 remain for older clients which do not support SHA-256 and AES.
+var scepCACaps = []string{
+	"POSTPKIOperation",
+	"Renewal",
+	"SHA-256",
+	"AES",
+	"SCEPStandard",
+	"SHA-1",
+	"DES3",
+}
+
+// caCapsService advertises scepCACaps instead of the capabilities built into
+// the SCEP library, so that they do not change with library upgrades.
+type caCapsService struct {
+	scep.Service
+}
+
+func (svc caCapsService) GetCACaps(ctx context.Context) ([]byte, error) {
+	return []byte(strings.Join(scepCACaps, "\n")), nil
+}
+
+// newSCEPService creates a SCEP service for the CA crt and key. GetCACert
+// returns the CA followed by the intermediate certificates in the PEM file at
+// chainPath as a degenerate PKCS#7 chain, or just the CA if chainPath is empty.
+func newSCEPService(crt *x509.Certificate, key *rsa.PrivateKey, signer scep.CSRSigner, chainPath string) (scep.Service, error) {
+	var opts []scep.ServiceOption
+	if chainPath != "" {
+		chain, err := crypto.ReadPEMCertificatesFile(chainPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading SCEP CA chain")
+		}
+		for _, cert := range chain {
+			opts = append(opts, scep.WithAddlCA(cert))
+		}
+	}
+	svc, err := scep.NewService(crt, key, signer, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return caCapsService{svc}, nil
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/micromdm/scep/v2/scep"
+	scepserver "github.com/micromdm/scep/v2/server"
+
+	"github.com/micromdm/micromdm/pkg/crypto"
+)
+
+func TestSCEPGetCACaps(t *testing.T) {
+	key, crt, err := crypto.SimpleSelfSignedRSAKeypair("MicroMDM", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := newSCEPService(crt, key, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(filepath.Join("testdata", "scep_cacaps.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := log.NewNopLogger()
+	handler := scepserver.MakeHTTPHandler(scepserver.MakeServerEndpoints(svc), svc, logger)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/scep?operation=GetCACaps", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("have status %d: %s", rec.Code, rec.Body)
+	}
+	if have := rec.Body.Bytes(); !bytes.Equal(have, want) {
+		t.Errorf("have caps %q, want %q", have, want)
+	}
+}
+
+func TestSCEPGetCACertChain(t *testing.T) {
+	key, crt, err := crypto.SimpleSelfSignedRSAKeypair("MicroMDM", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc, err := newSCEPService(crt, key, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, n, err := svc.GetCACert(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || !bytes.Equal(data, crt.Raw) {
+		t.Errorf("have %d certificates without intermediates, want the CA certificate", n)
+	}
+
+	var chainPEM []byte
+	var intermediates [][]byte
+	for _, cn := range []string{"Intermediate 1", "Intermediate 2"} {
+		_, cert, err := crypto.SimpleSelfSignedRSAKeypair(cn, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		intermediates = append(intermediates, cert.Raw)
+		chainPEM = append(chainPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	chainPath := filepath.Join(t.TempDir(), "chain.pem")
+	if err := ioutil.WriteFile(chainPath, chainPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	svc, err = newSCEPService(crt, key, nil, chainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, n, err = svc.GetCACert(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := scep.CACerts(data)
+	if err != nil {
+		t.Fatalf("parse degenerate chain: %s", err)
+	}
+	if n != 3 || len(certs) != 3 {
+		t.Fatalf("have %d (%d parsed) certificates, want 3", n, len(certs))
+	}
+	if !bytes.Equal(certs[0].Raw, crt.Raw) {
+		t.Error("expected the CA certificate first in the chain")
+	}
+	for i, raw := range intermediates {
+		if !bytes.Equal(certs[i+1].Raw, raw) {
+			t.Errorf("certificate %d is not intermediate %d", i+1, i+1)
+		}
+	}
+
+	if _, err := newSCEPService(crt, key, nil, filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("expected error for a missing chain file")
+	}
+}
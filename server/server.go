@@ -12,21 +12,35 @@ import (
 	"github.com/micromdm/micromdm/dep"
 	"github.com/micromdm/micromdm/mdm"
 	"github.com/micromdm/micromdm/mdm/enroll"
+	"github.com/micromdm/micromdm/pkg/crypto"
+	"github.com/micromdm/micromdm/pkg/ratelimit"
 	"github.com/micromdm/micromdm/platform/apns"
 	apnsbuiltin "github.com/micromdm/micromdm/platform/apns/builtin"
+	"github.com/micromdm/micromdm/platform/audit"
+	auditbuiltin "github.com/micromdm/micromdm/platform/audit/builtin"
+	challengebuiltin "github.com/micromdm/micromdm/platform/challenge/builtin"
 	"github.com/micromdm/micromdm/platform/command"
+	commandbuiltin "github.com/micromdm/micromdm/platform/command/builtin"
 	"github.com/micromdm/micromdm/platform/config"
 	configbuiltin "github.com/micromdm/micromdm/platform/config/builtin"
+	"github.com/micromdm/micromdm/platform/declaration"
+	declarationbuiltin "github.com/micromdm/micromdm/platform/declaration/builtin"
 	"github.com/micromdm/micromdm/platform/dep/sync"
 	syncbuiltin "github.com/micromdm/micromdm/platform/dep/sync/builtin"
+	syncpg "github.com/micromdm/micromdm/platform/dep/sync/pg"
 	"github.com/micromdm/micromdm/platform/device"
 	devicebuiltin "github.com/micromdm/micromdm/platform/device/builtin"
+	deviceinmem "github.com/micromdm/micromdm/platform/device/inmem"
+	devicepg "github.com/micromdm/micromdm/platform/device/pg"
+	"github.com/micromdm/micromdm/platform/identity"
+	identitybuiltin "github.com/micromdm/micromdm/platform/identity/builtin"
 	"github.com/micromdm/micromdm/platform/profile"
 	profilebuiltin "github.com/micromdm/micromdm/platform/profile/builtin"
 	"github.com/micromdm/micromdm/platform/pubsub"
 	"github.com/micromdm/micromdm/platform/pubsub/inmem"
 	"github.com/micromdm/micromdm/platform/queue"
 	queueinmem "github.com/micromdm/micromdm/platform/queue/inmem"
+	queuepg "github.com/micromdm/micromdm/platform/queue/pg"
 	block "github.com/micromdm/micromdm/platform/remove"
 	blockbuiltin "github.com/micromdm/micromdm/platform/remove/builtin"
 	"github.com/micromdm/micromdm/workflow/webhook"
@@ -34,14 +48,21 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/jmoiron/sqlx"
+	"github.com/kolide/kit/dbutil"
+	_ "github.com/lib/pq"
 	"github.com/micromdm/scep/v2/challenge"
-	boltchallenge "github.com/micromdm/scep/v2/challenge/bolt"
 	"github.com/micromdm/scep/v2/depot"
 	boltdepot "github.com/micromdm/scep/v2/depot/bolt"
 	scep "github.com/micromdm/scep/v2/server"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// checkinRateLimitDevices is the number of devices the checkin rate limiter
+// keeps track of. Each takes around a hundred bytes.
+const checkinRateLimitDevices = 100000
+
 type Server struct {
 	ConfigPath             string
 	Depsim                 string
@@ -58,15 +79,27 @@ type Server struct {
 	ProfileDB              profile.Store
 	ConfigDB               config.Store
 	RemoveDB               block.Store
+	DeviceDB               device.Datastore
+	IdentityDB             identity.Store
 	CommandWebhookURL      string
+	CommandWebhookSecret   string
 	DEPClient              *dep.Client
-	SyncDB                 *syncbuiltin.DB
+	SyncDB                 sync.Datastore
 	NoCmdHistory           bool
 	ValidateSCEPIssuer     bool
 	ValidateSCEPExpiration bool
 	UDIDCertAuthWarnOnly   bool
 	Queue                  string
+	DeviceStore            string
+	DEPStore               string
 	DMURL                  string
+	// DeclarationStore serves Declarative Management requests when DMURL is not set.
+	// Defaults to the builtin declaration store.
+	DeclarationStore declaration.Store
+
+	// PostgresURL is the PostgreSQL database used by the stores of type "pg".
+	PostgresURL string
+	Postgres    *sqlx.DB
 
 	APNSPushService apns.Service
 	CommandService  command.Service
@@ -74,10 +107,51 @@ type Server struct {
 	EnrollService   enroll.Service
 	SCEPService     scep.Service
 	ConfigService   config.Service
+	AuditService    audit.Service
 
 	CommandQueue mdm.Queue
 
 	WebhooksHTTPClient *http.Client
+	// WebhookMaxRetries is the number of times a failed webhook
+	// request is retried before it is written to WebhookDeadLetter.
+	WebhookMaxRetries int
+	WebhookDeadLetter string
+
+	// CheckinRateLimit is the number of checkins per minute allowed for each device,
+	// with bursts of up to CheckinRateBurst checkins. Zero disables the limit.
+	CheckinRateLimit int
+	CheckinRateBurst int
+
+	// SCEPChallengeTTL is how long dynamic SCEP challenges are valid.
+	// Zero means they are valid until they are used.
+	SCEPChallengeTTL time.Duration
+
+	// APNSHost is the APNs host pushes are sent to. If empty, it is chosen
+	// from the environment of the push certificate.
+	APNSHost string
+	// APNSTransport configures the connections pushes are sent on.
+	APNSTransport apns.TransportOptions
+
+	// SCEPCAChainPath is the path to a PEM file of intermediate certificates
+	// which GetCACert returns with the SCEP CA.
+	SCEPCAChainPath string
+
+	// EnrollProfileSigner signs the enrollment profile after its template
+	// variables are substituted. The profile is not signed if it is nil.
+	EnrollProfileSigner *crypto.Identity
+	// EnrollProfileSignerChain are the intermediates of the EnrollProfileSigner
+	// certificate, which are embedded in the signed enrollment profile.
+	EnrollProfileSignerChain []*x509.Certificate
+	// EnrollProfileVariablesPath is the path to a JSON file of enrollment
+	// profile template variables.
+	EnrollProfileVariablesPath string
+
+	// Metrics registers the push, command and enrollment metrics when set.
+	Metrics prometheus.Registerer
+
+	// pushService is the APNSPushService without middleware, which is drained by Shutdown.
+	pushService *apns.PushService
+	instruments *instruments
 }
 
 func (c *Server) Setup(logger log.Logger) error {
@@ -85,14 +159,30 @@ func (c *Server) Setup(logger log.Logger) error {
 		return err
 	}
 
+	if err := c.setupMetrics(); err != nil {
+		return err
+	}
+
 	if err := c.setupBolt(); err != nil {
 		return err
 	}
 
+	if err := c.setupPostgres(logger); err != nil {
+		return err
+	}
+
+	if err := c.setupDeviceDB(); err != nil {
+		return err
+	}
+
 	if err := c.setupRemoveService(); err != nil {
 		return err
 	}
 
+	if err := c.setupIdentityDB(); err != nil {
+		return err
+	}
+
 	if err := c.setupConfigStore(); err != nil {
 		return err
 	}
@@ -117,6 +207,10 @@ func (c *Server) Setup(logger log.Logger) error {
 		return err
 	}
 
+	if err := c.setupAuditService(); err != nil {
+		return err
+	}
+
 	if err := c.setupDepClient(); err != nil {
 		return err
 	}
@@ -130,6 +224,15 @@ func (c *Server) Setup(logger log.Logger) error {
 	return err
 }
 
+func (c *Server) setupIdentityDB() error {
+	identityDB, err := identitybuiltin.NewDB(c.DB)
+	if err != nil {
+		return err
+	}
+	c.IdentityDB = identityDB
+	return nil
+}
+
 func (c *Server) setupProfileDB() error {
 	profileDB, err := profilebuiltin.NewDB(c.DB)
 	if err != nil {
@@ -150,7 +253,17 @@ func (c *Server) setupWebhooks(logger log.Logger) error {
 	}
 
 	ctx := context.Background()
-	ww := webhook.New(c.CommandWebhookURL, c.PubClient, webhook.WithLogger(logger), webhook.WithHTTPClient(c.WebhooksHTTPClient))
+	opts := []webhook.Option{webhook.WithLogger(logger), webhook.WithHTTPClient(c.WebhooksHTTPClient)}
+	if c.CommandWebhookSecret != "" {
+		opts = append(opts, webhook.WithSigningSecret([]byte(c.CommandWebhookSecret)))
+	}
+	if c.WebhookMaxRetries > 0 {
+		opts = append(opts, webhook.WithRetries(c.WebhookMaxRetries, webhook.DefaultRetryDelay))
+	}
+	if c.WebhookDeadLetter != "" {
+		opts = append(opts, webhook.WithDeadLetter(webhook.NewFileDeadLetter(c.WebhookDeadLetter)))
+	}
+	ww := webhook.New(c.CommandWebhookURL, c.PubClient, opts...)
 	go ww.Run(ctx)
 	return nil
 }
@@ -164,8 +277,42 @@ func (c *Server) setupRemoveService() error {
 	return nil
 }
 
+func (c *Server) setupDeviceDB() error {
+	switch c.DeviceStore {
+	case "inmem":
+		c.DeviceDB = deviceinmem.NewDB()
+	case "builtin":
+		devDB, err := devicebuiltin.NewDB(c.DB)
+		if err != nil {
+			return errors.Wrap(err, "new device db")
+		}
+		c.DeviceDB = devDB
+	case "pg":
+		db, err := c.postgres("device")
+		if err != nil {
+			return err
+		}
+		c.DeviceDB = devicepg.New(db)
+	case "":
+		return errors.New("empty device store type")
+	default:
+		return fmt.Errorf("invalid device store type: %s", c.DeviceStore)
+	}
+	return nil
+}
+
 func (c *Server) setupCommandService() error {
-	commandService, err := command.New(c.PubClient, c.CommandQueue)
+	commandDB, err := commandbuiltin.NewDB(c.DB)
+	if err != nil {
+		return errors.Wrap(err, "new device PIN and idempotency key db")
+	}
+	commandService, err := command.New(
+		c.PubClient,
+		c.CommandQueue,
+		command.WithDeviceStore(c.DeviceDB),
+		command.WithPINStore(commandDB),
+		command.WithIdempotencyStore(commandDB),
+	)
 	if err != nil {
 		return err
 	}
@@ -173,8 +320,17 @@ func (c *Server) setupCommandService() error {
 	return nil
 }
 
+func (c *Server) setupAuditService() error {
+	auditDB, err := auditbuiltin.NewDB(c.DB)
+	if err != nil {
+		return errors.Wrap(err, "new audit log db")
+	}
+	c.AuditService = audit.New(auditDB)
+	return nil
+}
+
 func (c *Server) setupCommandQueue(logger log.Logger) error {
-	var q mdm.Queue
+	var q queue.CommandStore
 	switch c.Queue {
 	case "inmem":
 		q = queueinmem.New(c.PubClient, logger)
@@ -188,6 +344,19 @@ func (c *Server) setupCommandQueue(logger log.Logger) error {
 		if err != nil {
 			return err
 		}
+	case "pg":
+		db, err := c.postgres("command queue")
+		if err != nil {
+			return err
+		}
+		opts := []queuepg.Option{queuepg.WithLogger(logger)}
+		if c.NoCmdHistory {
+			opts = append(opts, queuepg.WithoutHistory())
+		}
+		q, err = queuepg.New(db, c.PubClient, opts...)
+		if err != nil {
+			return err
+		}
 	case "":
 		return errors.New("empty command queue type")
 	default:
@@ -196,30 +365,48 @@ func (c *Server) setupCommandQueue(logger log.Logger) error {
 
 	c.CommandQueue = q
 
-	devDB, err := devicebuiltin.NewDB(c.DB)
-	if err != nil {
-		return errors.Wrap(err, "new device db")
-	}
-
 	var mdmService mdm.Service
 	{
-		var dm mdm.DeclarativeManagement
+		var (
+			dm  mdm.DeclarativeManagement
+			err error
+		)
 		if c.DMURL != "" {
 			dm, err = NewDeclarativeManagementHTTPCaller(c.DMURL, http.DefaultClient)
 			if err != nil {
 				return fmt.Errorf("setting up declarative management: %w", err)
 			}
+		} else {
+			if c.DeclarationStore == nil {
+				c.DeclarationStore, err = declarationbuiltin.NewDB(c.DB)
+				if err != nil {
+					return errors.Wrap(err, "new declaration db")
+				}
+			}
+			dm = declaration.New(c.DeclarationStore)
 		}
 
-		svc := mdm.NewService(c.PubClient, q, devDB, dm)
+		svc := mdm.NewService(c.PubClient, q, c.DeviceDB, dm)
 		mdmService = svc
 		mdmService = block.RemoveMiddleware(c.RemoveDB)(mdmService)
 
 		udidauthLogger := log.With(logger, "component", "udidcertauth")
-		mdmService = device.UDIDCertAuthMiddleware(devDB, udidauthLogger, c.UDIDCertAuthWarnOnly)(mdmService)
+		mdmService = device.UDIDCertAuthMiddleware(c.DeviceDB, udidauthLogger, c.UDIDCertAuthWarnOnly)(mdmService)
+
+		identityLogger := log.With(logger, "component", "identity")
+		mdmService = identity.RecordMiddleware(c.IdentityDB, c.DeviceDB, identityLogger)(mdmService)
 
 		verifycertLogger := log.With(logger, "component", "verifycert")
 		mdmService = VerifyCertificateMiddleware(c.ValidateSCEPIssuer, c.ValidateSCEPExpiration, c.SCEPDepot, verifycertLogger)(mdmService)
+
+		if c.instruments != nil {
+			mdmService = mdm.InstrumentingMiddleware(c.instruments.enrollments, c.instruments.commands)(mdmService)
+		}
+
+		if c.CheckinRateLimit > 0 {
+			limiter := ratelimit.New(float64(c.CheckinRateLimit)/60, c.CheckinRateBurst, checkinRateLimitDevices)
+			mdmService = mdm.RateLimitMiddleware(limiter)(mdmService)
+		}
 	}
 	c.MDMService = mdmService
 
@@ -237,6 +424,26 @@ func (c *Server) setupBolt() error {
 	return nil
 }
 
+func (c *Server) setupPostgres(logger log.Logger) error {
+	if c.PostgresURL == "" {
+		return nil
+	}
+	db, err := dbutil.OpenDBX("postgres", c.PostgresURL, dbutil.WithLogger(logger))
+	if err != nil {
+		return errors.Wrap(err, "opening postgres")
+	}
+	c.Postgres = db
+	return nil
+}
+
+// postgres returns the database for a store of type "pg".
+func (c *Server) postgres(store string) (*sqlx.DB, error) {
+	if c.Postgres == nil {
+		return nil, errors.Errorf("pg %s store requires a postgres url", store)
+	}
+	return c.Postgres, nil
+}
+
 type pushServiceCert struct {
 	*x509.Certificate
 	PrivateKey interface{}
@@ -259,10 +466,19 @@ func (c *Server) setupPushService(logger log.Logger) error {
 		return err
 	}
 
-	service, err := apns.New(db, c.ConfigDB, c.PubClient)
+	var opts []apns.Option
+	if c.APNSHost != "" {
+		opts = append(opts, apns.WithHost(c.APNSHost))
+	}
+	opts = append(opts, apns.WithTransportOptions(c.APNSTransport))
+	if c.instruments != nil {
+		opts = append(opts, apns.WithMetrics(c.instruments.pushes, c.instruments.pushDuration))
+	}
+	service, err := apns.New(db, c.ConfigDB, c.PubClient, opts...)
 	if err != nil {
 		return errors.Wrap(err, "starting micromdm push service")
 	}
+	c.pushService = service
 	c.APNSPushService = apns.LoggingMiddleware(
 		log.With(level.Info(logger), "component", "apns"),
 	)(service)
@@ -284,6 +500,18 @@ func (c *Server) setupEnrollmentService() error {
 		chalStore = nil
 	}
 
+	var opts []enroll.Option
+	if c.EnrollProfileSigner != nil {
+		opts = append(opts, enroll.WithProfileSigner(c.EnrollProfileSigner, c.EnrollProfileSignerChain...))
+	}
+	if c.EnrollProfileVariablesPath != "" {
+		vars, err := enroll.ReadVariablesFile(c.EnrollProfileVariablesPath)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, enroll.WithVariableSource(vars))
+	}
+
 	// TODO: clean up order of inputs. Maybe pass *SCEPConfig as an arg?
 	// but if you do, the packages are coupled, better not.
 	c.EnrollService, err = enroll.NewService(
@@ -296,6 +524,7 @@ func (c *Server) setupEnrollmentService() error {
 		SCEPCertificateSubject,
 		c.ProfileDB,
 		chalStore,
+		opts...,
 	)
 	return errors.Wrap(err, "setting up enrollment service")
 }
@@ -347,26 +576,49 @@ func (c *Server) setupDepClient() error {
 }
 
 func (c *Server) CreateDEPSyncer(logger log.Logger) (sync.Syncer, error) {
-	client := c.DEPClient
 	opts := []sync.Option{
 		sync.WithLogger(log.With(logger, "component", "depsync")),
 	}
-	if client != nil {
-		opts = append(opts, sync.WithClient(client))
+
+	switch c.DEPStore {
+	case "builtin":
+		syncdb, err := syncbuiltin.NewDB(c.DB)
+		if err != nil {
+			return nil, err
+		}
+		c.SyncDB = syncdb
+	case "pg":
+		db, err := c.postgres("DEP")
+		if err != nil {
+			return nil, err
+		}
+		c.SyncDB = syncpg.New(db)
+	case "":
+		return nil, errors.New("empty DEP store type")
+	default:
+		return nil, fmt.Errorf("invalid DEP store type: %s", c.DEPStore)
 	}
 
-	syncdb, err := syncbuiltin.NewDB(c.DB)
-	if err != nil {
-		return nil, err
+	// depsim only simulates a single DEP token.
+	if c.Depsim != "" {
+		opts = append(opts, sync.WithClient(c.DEPClient))
+		return sync.NewWatcher(c.SyncDB, c.PubClient, opts...)
 	}
-	c.SyncDB = syncdb
 
-	var syncer sync.Syncer
-	syncer, err = sync.NewWatcher(c.SyncDB, c.PubClient, opts...)
+	// sync every DEP token separately.
+	tokens, err := c.ConfigDB.DEPTokens()
 	if err != nil {
 		return nil, err
 	}
-	return syncer, nil
+	var clients []sync.TokenClient
+	for _, token := range tokens {
+		client, err := token.Client()
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating DEP client for token %s", token.ConsumerKey)
+		}
+		clients = append(clients, sync.TokenClient{ConsumerKey: token.ConsumerKey, Client: client})
+	}
+	return sync.NewMultiWatcher(c.SyncDB, c.PubClient, clients, opts...)
 }
 
 func (c *Server) setupSCEP(logger log.Logger) error {
@@ -392,16 +644,18 @@ func (c *Server) setupSCEP(logger log.Logger) error {
 		depot.WithValidityDays(c.SCEPClientValidity),
 	)
 	if c.UseDynSCEPChallenge {
-		c.SCEPChallengeDepot, err = boltchallenge.NewBoltDepot(c.DB)
+		challengeDB, err := challengebuiltin.NewDB(c.DB, c.SCEPChallengeTTL)
 		if err != nil {
 			return err
 		}
+		go challengeDB.Run(context.Background())
+		c.SCEPChallengeDepot = challengeDB
 		signer = challenge.Middleware(c.SCEPChallengeDepot, signer)
 	} else {
 		signer = scep.ChallengeMiddleware(c.SCEPChallenge, signer)
 	}
 
-	c.SCEPService, err = scep.NewService(crt, key, signer)
+	c.SCEPService, err = newSCEPService(crt, key, signer, c.SCEPCAChainPath)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/micromdm/micromdm/pkg/drain"
+)
+
+// workTracker is implemented by the pubsub, queue and push services, which
+// report the events and pushes in flight with a drain.Group.
+type workTracker interface {
+	Work() *drain.Group
+}
+
+// Shutdown drains the in-flight command and push work, and closes the database.
+// It is called after the HTTP server stops accepting requests.
+//
+// New commands are rejected, the commands which were already created are saved to the
+// command queue and their devices are pushed, until ctx is done. Commands in the builtin
+// queue are persisted in the database and are delivered when the server is restarted.
+func (c *Server) Shutdown(ctx context.Context) error {
+	var shutdownErr error
+
+	type shutdowner interface {
+		Shutdown(ctx context.Context) error
+	}
+	if svc, ok := c.CommandService.(shutdowner); ok {
+		if err := svc.Shutdown(ctx); err != nil {
+			shutdownErr = errors.Wrap(err, "drain command service")
+		}
+	}
+
+	var groups []*drain.Group
+	for _, svc := range []interface{}{c.PubClient, c.CommandQueue, c.pushService} {
+		if t, ok := svc.(workTracker); ok {
+			groups = append(groups, t.Work())
+		}
+	}
+	if err := drain.Settle(ctx, groups...); err != nil && shutdownErr == nil {
+		shutdownErr = errors.Wrap(err, "drain queued commands and pushes")
+	}
+	for _, g := range groups {
+		g.Close()
+	}
+	if c.pushService != nil {
+		// stops the pushes waiting to be retried if ctx is done.
+		if err := c.pushService.Shutdown(ctx); err != nil && shutdownErr == nil {
+			shutdownErr = errors.Wrap(err, "drain pushes")
+		}
+	}
+
+	if c.DB != nil {
+		if err := c.DB.Close(); err != nil && shutdownErr == nil {
+			shutdownErr = errors.Wrap(err, "close database")
+		}
+	}
+	if c.Postgres != nil {
+		if err := c.Postgres.Close(); err != nil && shutdownErr == nil {
+			shutdownErr = errors.Wrap(err, "close postgres")
+		}
+	}
+	return shutdownErr
+}
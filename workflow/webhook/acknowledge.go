@@ -13,6 +13,10 @@ type AcknowledgeEvent struct {
 	CommandUUID  string            `json:"command_uuid,omitempty"`
 	Params       map[string]string `json:"url_params,omitempty"`
 	RawPayload   []byte            `json:"raw_payload"`
+
+	// RequestType is not part of the acknowledge_event payload, but is
+	// passed on to the command result event.
+	RequestType string `json:"-"`
 }
 
 func acknowledgeEvent(topic string, data []byte) (*Event, error) {
@@ -29,6 +33,7 @@ func acknowledgeEvent(topic string, data []byte) (*Event, error) {
 			UDID:        ev.Response.UDID,
 			Status:      ev.Response.Status,
 			CommandUUID: ev.Response.CommandUUID,
+			RequestType: ev.Response.RequestType,
 			Params:      ev.Params,
 			RawPayload:  ev.Raw,
 		},
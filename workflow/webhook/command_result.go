@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	"github.com/google/uuid"
+)
+
+// CommandResultTopic is the topic of webhook events which report the result
+// of a command sent to a device.
+const CommandResultTopic = "command.result"
+
+type CommandResultEvent struct {
+	UDID         string `json:"udid,omitempty"`
+	EnrollmentID string `json:"enrollment_id,omitempty"`
+	CommandUUID  string `json:"command_uuid"`
+	Status       string `json:"status"`
+	RequestType  string `json:"request_type,omitempty"`
+	RawPayload   []byte `json:"raw_payload"`
+}
+
+// commandResultEvent returns a command.result event for an mdm.Connect
+// webhook event, or nil if the device did not respond to a command.
+func commandResultEvent(ack *Event) *Event {
+	ev := ack.AcknowledgeEvent
+	if ev == nil || ev.CommandUUID == "" || ev.Status == "Idle" {
+		return nil
+	}
+	return &Event{
+		Topic:     CommandResultTopic,
+		EventID:   uuid.New().String(),
+		CreatedAt: ack.CreatedAt,
+
+		CommandResultEvent: &CommandResultEvent{
+			UDID:         ev.UDID,
+			EnrollmentID: ev.EnrollmentID,
+			CommandUUID:  ev.CommandUUID,
+			Status:       ev.Status,
+			RequestType:  ev.RequestType,
+			RawPayload:   ev.RawPayload,
+		},
+	}
+}
@@ -17,6 +17,7 @@ func postWebhookEvent(
 	ctx context.Context,
 	client httpClient,
 	url string,
+	secret []byte,
 	event interface{},
 ) error {
 	raw, err := json.MarshalIndent(event, "", "  ")
@@ -29,6 +30,9 @@ func postWebhookEvent(
 		return errors.Wrap(err, "create webhook http request")
 	}
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if len(secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(secret, raw))
+	}
 
 	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
@@ -37,7 +41,7 @@ func postWebhookEvent(
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return errors.Errorf("received unexpected HTTP status %d %s", resp.StatusCode, resp.Status)
+		return &statusError{code: resp.StatusCode, status: resp.Status}
 	}
 	return nil
 }
@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultRetryDelay is the default delay before the first retry of a
+	// webhook request. The delay doubles with every following retry.
+	DefaultRetryDelay = time.Second
+
+	// maxRetryDelay caps the delay between retries of a webhook request.
+	maxRetryDelay = 30 * time.Second
+
+	// maxPendingRetries caps the number of events which are retried at the
+	// same time. Events which fail while it is reached are not retried.
+	maxPendingRetries = 1000
+)
+
+// WithRetries retries a failed webhook request up to maxRetries times,
+// waiting delay before the first retry and twice as long before each next one.
+func WithRetries(maxRetries int, delay time.Duration) Option {
+	return func(w *Worker) {
+		w.maxRetries = maxRetries
+		w.retryDelay = delay
+	}
+}
+
+// WithDeadLetter stores events which could not be delivered in dl,
+// so that they can be replayed later.
+func WithDeadLetter(dl DeadLetter) Option {
+	return func(w *Worker) {
+		w.deadLetter = dl
+	}
+}
+
+// DeadLetter stores webhook events which could not be delivered.
+type DeadLetter interface {
+	Store(ctx context.Context, entry DeadLetterEntry) error
+}
+
+// DeadLetterEntry is an undelivered webhook event.
+type DeadLetterEntry struct {
+	Event    *Event    `json:"event"`
+	URL      string    `json:"url"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// FileDeadLetter appends undelivered events to a file, one JSON encoded
+// DeadLetterEntry per line.
+type FileDeadLetter struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileDeadLetter returns a FileDeadLetter which appends to the file at path.
+// The file is created if it does not exist.
+func NewFileDeadLetter(path string) *FileDeadLetter {
+	return &FileDeadLetter{path: path}
+}
+
+func (dl *FileDeadLetter) Store(ctx context.Context, entry DeadLetterEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "marshal dead letter entry")
+	}
+	line = append(line, '\n')
+
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	f, err := os.OpenFile(dl.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "open dead letter file")
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return errors.Wrap(err, "write dead letter file")
+	}
+	return errors.Wrap(f.Close(), "close dead letter file")
+}
+
+// statusError is returned for webhook requests which the receiver
+// responded to with an HTTP error status.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "received unexpected HTTP status " + e.status
+}
+
+// isPermanent reports whether a failed webhook request should not be retried.
+// Client errors other than timeouts and rate limiting are not retried,
+// since the receiver would reject the same request again.
+func isPermanent(err error) bool {
+	e, ok := errors.Cause(err).(*statusError)
+	if !ok {
+		return false
+	}
+	switch e.code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return e.code >= 400 && e.code < 500
+}
+
+// retryDelay returns the delay before the given retry, starting at 1.
+func retryDelay(base time.Duration, retry int) time.Duration {
+	d := base << uint(retry-1)
+	if d <= 0 || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
+
+// dispatch posts event to the webhook URL once, and retries a transient
+// failure in the background, so that a failing event does not delay the
+// events after it. An event which cannot be delivered is stored in the dead
+// letter store, if any.
+func (w *Worker) dispatch(ctx context.Context, event *Event) error {
+	err := postWebhookEvent(ctx, w.client, w.url, w.secret, event)
+	if err == nil {
+		return nil
+	}
+	if isPermanent(err) || w.maxRetries < 1 {
+		return w.storeDeadLetter(ctx, event, err, 1)
+	}
+	select {
+	case w.retrySlots <- struct{}{}:
+	default:
+		return w.storeDeadLetter(ctx, event, errors.Wrap(err, "too many pending webhook retries"), 1)
+	}
+	level.Debug(w.logger).Log(
+		"msg", "retry webhook event",
+		"topic", event.Topic,
+		"attempt", 1,
+		"err", err,
+	)
+	w.retries.Add(1)
+	go func() {
+		defer func() {
+			<-w.retrySlots
+			w.retries.Done()
+		}()
+		if err := w.retry(ctx, event, 1, err); err != nil {
+			level.Info(w.logger).Log(
+				"msg", "post webhook event",
+				"topic", event.Topic,
+				"err", err,
+			)
+		}
+	}()
+	return nil
+}
+
+// retry delivers event after attempts failed attempts, the last of which
+// failed with err.
+func (w *Worker) retry(ctx context.Context, event *Event, attempts int, err error) error {
+	for attempts < w.maxRetries+1 {
+		if attempts > 0 {
+			select {
+			case <-ctx.Done():
+				err = errors.Wrap(ctx.Err(), err.Error())
+				return w.storeDeadLetter(ctx, event, err, attempts)
+			case <-time.After(retryDelay(w.retryDelay, attempts)):
+			}
+		}
+		attempts++
+		err = postWebhookEvent(ctx, w.client, w.url, w.secret, event)
+		if err == nil {
+			return nil
+		}
+		if isPermanent(err) {
+			break
+		}
+		level.Debug(w.logger).Log(
+			"msg", "retry webhook event",
+			"topic", event.Topic,
+			"attempt", attempts,
+			"err", err,
+		)
+	}
+	return w.storeDeadLetter(ctx, event, err, attempts)
+}
+
+func (w *Worker) storeDeadLetter(ctx context.Context, event *Event, err error, attempts int) error {
+	if w.deadLetter == nil {
+		return err
+	}
+	entry := DeadLetterEntry{
+		Event:    event,
+		URL:      w.url,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+	}
+	if dlErr := w.deadLetter.Store(ctx, entry); dlErr != nil {
+		return errors.Wrapf(err, "store undelivered event in dead letter: %s", dlErr)
+	}
+	return errors.Wrap(err, "stored undelivered event in dead letter")
+}
@@ -0,0 +1,196 @@
+package webhook
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingServer responds with status to the first failures requests, and
+// with 200 OK afterwards.
+func failingServer(t *testing.T, failures int32, status int) (*httptest.Server, *int32) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func readDeadLetters(t *testing.T, path string) []DeadLetterEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []DeadLetterEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry DeadLetterEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestDispatchRetry(t *testing.T) {
+	tests := []struct {
+		name           string
+		failures       int32
+		status         int
+		wantErr        bool
+		wantDeadLetter bool
+		wantRequests   int32
+	}{
+		{"success", 0, http.StatusOK, false, false, 1},
+		{"fails then succeeds", 2, http.StatusServiceUnavailable, false, false, 3},
+		{"retries exhausted", 10, http.StatusBadGateway, false, true, 4},
+		{"rate limited then succeeds", 1, http.StatusTooManyRequests, false, false, 2},
+		// a permanent error is not retried in the background.
+		{"permanent error", 10, http.StatusBadRequest, true, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := failingServer(t, tt.failures, tt.status)
+			path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+			w := New(srv.URL, nil,
+				WithHTTPClient(srv.Client()),
+				WithRetries(3, time.Millisecond),
+				WithDeadLetter(NewFileDeadLetter(path)),
+			)
+
+			event := &Event{Topic: "mdm.Connect", EventID: "event-1"}
+			err := w.dispatch(context.Background(), event)
+			if have, want := err != nil, tt.wantErr; have != want {
+				t.Fatalf("have error %v, want error %t", err, want)
+			}
+			w.retries.Wait()
+			if have, want := atomic.LoadInt32(requests), tt.wantRequests; have != want {
+				t.Errorf("have %d requests, want %d", have, want)
+			}
+
+			entries := readDeadLetters(t, path)
+			if !tt.wantDeadLetter {
+				if len(entries) != 0 {
+					t.Errorf("have %d dead letters for a delivered event, want none", len(entries))
+				}
+				return
+			}
+			if have, want := len(entries), 1; have != want {
+				t.Fatalf("have %d dead letters, want %d", have, want)
+			}
+			entry := entries[0]
+			if entry.Event == nil || entry.Event.EventID != event.EventID {
+				t.Errorf("have dead letter event %+v, want %+v", entry.Event, event)
+			}
+			if entry.Attempts != int(tt.wantRequests) || entry.URL != srv.URL || entry.Error == "" {
+				t.Errorf("unexpected dead letter %+v", entry)
+			}
+		})
+	}
+}
+
+func TestDispatchCanceled(t *testing.T) {
+	srv, requests := failingServer(t, 10, http.StatusServiceUnavailable)
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	w := New(srv.URL, nil,
+		WithHTTPClient(srv.Client()),
+		WithRetries(3, time.Hour),
+		WithDeadLetter(NewFileDeadLetter(path)),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := w.dispatch(ctx, &Event{EventID: "event-1"}); err != nil {
+		t.Fatal(err)
+	}
+	// the retry gives up when the context is canceled during backoff.
+	w.retries.Wait()
+	if have, want := atomic.LoadInt32(requests), int32(1); have != want {
+		t.Errorf("have %d requests, want %d", have, want)
+	}
+	if have, want := len(readDeadLetters(t, path)), 1; have != want {
+		t.Errorf("have %d dead letters, want %d", have, want)
+	}
+}
+
+func TestFailingEventDoesNotDelayNextEvent(t *testing.T) {
+	delivered := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Error(err)
+		}
+		if ev.AcknowledgeEvent != nil && ev.AcknowledgeEvent.Status == "Error" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		delivered <- ev.AcknowledgeEvent.Status
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	sub := &mockSubscriber{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	w := New(srv.URL, sub,
+		WithHTTPClient(srv.Client()),
+		WithRetries(3, time.Hour),
+		WithDeadLetter(NewFileDeadLetter(path)),
+	)
+	go func() { done <- w.Run(ctx) }()
+
+	publishConnect(t, sub, "Error", "")
+	publishConnect(t, sub, "NotNow", "")
+	select {
+	case status := <-delivered:
+		if status != "NotNow" {
+			t.Errorf("have delivered event with status %s, want NotNow", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event after a failing event was not delivered while the failing event was retried")
+	}
+
+	// stopping the worker stores the event being retried as a dead letter.
+	cancel()
+	<-done
+	var failed bool
+	for _, entry := range readDeadLetters(t, path) {
+		failed = failed || entry.Event.AcknowledgeEvent.Status == "Error"
+	}
+	if !failed {
+		t.Error("the event being retried was not stored as a dead letter when the worker stopped")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for retry, want := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		10: maxRetryDelay,
+		70: maxRetryDelay,
+	} {
+		if have := retryDelay(time.Second, retry); have != want {
+			t.Errorf("retryDelay(%d): have %s, want %s", retry, have, want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/micromdm/micromdm/pkg/crypto"
+)
+
+// SignatureHeader is the HTTP header which carries the signature of a webhook
+// request body, if the worker is configured with a signing secret.
+const SignatureHeader = "X-MicroMDM-Signature"
+
+const signaturePrefix = "sha256="
+
+// Sign returns the signature of body for the SignatureHeader, which is the
+// hex encoded HMAC-SHA256 of body with secret, prefixed with "sha256=".
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature is the signature of body with secret.
+// The signatures are compared in constant time.
+func VerifySignature(secret, body []byte, signature string) bool {
+	return crypto.SecureCompare([]byte(Sign(secret, body)), []byte(signature))
+}
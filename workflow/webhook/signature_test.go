@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"topic":"mdm.Connect"}`)
+	const want = "sha256=0cab6da83399f250c02605c7e3eb8987831e294b5023f68d0ceabe2e48084bac"
+
+	if have := Sign(secret, body); have != want {
+		t.Errorf("have signature %s, want %s", have, want)
+	}
+	if !VerifySignature(secret, body, want) {
+		t.Error("expected fixture signature to verify")
+	}
+
+	tampered := []byte(`{"topic":"mdm.CheckOut"}`)
+	if Sign(secret, tampered) == want || VerifySignature(secret, tampered, want) {
+		t.Error("expected tampered body to change the signature")
+	}
+	if VerifySignature([]byte("other"), body, want) {
+		t.Error("expected signature with a different secret not to verify")
+	}
+}
+
+func TestPostWebhookEventSignature(t *testing.T) {
+	secret := []byte("secret")
+	var signature string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(SignatureHeader)
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	event := &Event{Topic: "mdm.Connect", EventID: "event"}
+	if err := postWebhookEvent(context.Background(), srv.Client(), srv.URL, secret, event); err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySignature(secret, body, signature) {
+		t.Errorf("signature %q does not match the request body", signature)
+	}
+
+	if err := postWebhookEvent(context.Background(), srv.Client(), srv.URL, nil, event); err != nil {
+		t.Fatal(err)
+	}
+	if signature != "" {
+		t.Errorf("have signature %q without a secret, want none", signature)
+	}
+}
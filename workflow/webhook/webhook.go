@@ -3,6 +3,7 @@ package webhook
 import (
 	"context"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -18,8 +19,9 @@ type Event struct {
 	EventID   string    `json:"event_id"`
 	CreatedAt time.Time `json:"created_at"`
 
-	AcknowledgeEvent *AcknowledgeEvent `json:"acknowledge_event,omitempty"`
-	CheckinEvent     *CheckinEvent     `json:"checkin_event,omitempty"`
+	AcknowledgeEvent   *AcknowledgeEvent   `json:"acknowledge_event,omitempty"`
+	CheckinEvent       *CheckinEvent       `json:"checkin_event,omitempty"`
+	CommandResultEvent *CommandResultEvent `json:"command_result_event,omitempty"`
 }
 
 type Worker struct {
@@ -27,6 +29,13 @@ type Worker struct {
 	url    string
 	client *http.Client
 	sub    pubsub.Subscriber
+	secret []byte
+
+	maxRetries int
+	retryDelay time.Duration
+	deadLetter DeadLetter
+	retrySlots chan struct{}
+	retries    sync.WaitGroup
 }
 
 type Option func(*Worker)
@@ -43,12 +52,23 @@ func WithHTTPClient(client *http.Client) Option {
 	}
 }
 
+// WithSigningSecret signs the body of every webhook request with secret,
+// in the SignatureHeader.
+func WithSigningSecret(secret []byte) Option {
+	return func(w *Worker) {
+		w.secret = secret
+	}
+}
+
 func New(url string, sub pubsub.Subscriber, opts ...Option) *Worker {
 	worker := &Worker{
 		url:    url,
 		sub:    sub,
 		logger: log.NewNopLogger(),
 		client: http.DefaultClient,
+
+		retryDelay: DefaultRetryDelay,
+		retrySlots: make(chan struct{}, maxPendingRetries),
 	}
 
 	for _, optFn := range opts {
@@ -58,8 +78,11 @@ func New(url string, sub pubsub.Subscriber, opts ...Option) *Worker {
 	return worker
 }
 
+// Run posts events to the webhook URL until ctx is done. It returns once
+// the events which are being retried are delivered or stored as dead letters.
 func (w *Worker) Run(ctx context.Context) error {
 	const subscription = "webhook_worker"
+	defer w.retries.Wait()
 
 	ackEvents, err := w.sub.Subscribe(ctx, subscription, mdm.ConnectTopic)
 	if err != nil {
@@ -93,14 +116,18 @@ func (w *Worker) Run(ctx context.Context) error {
 
 	for {
 		var (
-			event *Event
-			err   error
+			event  *Event
+			result *Event
+			err    error
 		)
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case ev := <-ackEvents:
 			event, err = acknowledgeEvent(ev.Topic, ev.Message)
+			if err == nil {
+				result = commandResultEvent(event)
+			}
 		case ev := <-authenticateEvents:
 			event, err = checkinEvent(ev.Topic, ev.Message)
 		case ev := <-tokenUpdateEvents:
@@ -121,13 +148,17 @@ func (w *Worker) Run(ctx context.Context) error {
 			continue
 		}
 
-		if err := postWebhookEvent(ctx, w.client, w.url, event); err != nil {
-			level.Info(w.logger).Log(
-				"msg", "post webhook event",
-				"err", err,
-			)
-			continue
+		for _, event := range []*Event{event, result} {
+			if event == nil {
+				continue
+			}
+			if err := w.dispatch(ctx, event); err != nil {
+				level.Info(w.logger).Log(
+					"msg", "post webhook event",
+					"topic", event.Topic,
+					"err", err,
+				)
+			}
 		}
-
 	}
 }
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micromdm/micromdm/mdm"
+	"github.com/micromdm/micromdm/platform/pubsub"
+)
+
+// mockSubscriber returns a channel per topic, which the test publishes to directly.
+type mockSubscriber struct {
+	mu     sync.Mutex
+	topics map[string]chan pubsub.Event
+}
+
+func (s *mockSubscriber) channel(topic string) chan pubsub.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.topics == nil {
+		s.topics = make(map[string]chan pubsub.Event)
+	}
+	if _, ok := s.topics[topic]; !ok {
+		s.topics[topic] = make(chan pubsub.Event)
+	}
+	return s.topics[topic]
+}
+
+func (s *mockSubscriber) Subscribe(ctx context.Context, name, topic string) (<-chan pubsub.Event, error) {
+	return s.channel(topic), nil
+}
+
+func publishConnect(t *testing.T, sub *mockSubscriber, status, commandUUID string) {
+	t.Helper()
+	msg, err := mdm.MarshalAcknowledgeEvent(&mdm.AcknowledgeEvent{
+		ID:   "event-" + status,
+		Time: time.Now().UTC(),
+		Response: mdm.Response{
+			UDID:        "UDID",
+			Status:      status,
+			CommandUUID: commandUUID,
+		},
+		Raw: []byte("raw-" + status),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.channel(mdm.ConnectTopic) <- pubsub.Event{Topic: mdm.ConnectTopic, Message: msg}
+}
+
+func TestCommandResultWebhook(t *testing.T) {
+	received := make(chan Event, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Error(err)
+		}
+		received <- ev
+	}))
+	defer srv.Close()
+
+	sub := &mockSubscriber{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- New(srv.URL, sub).Run(ctx) }()
+
+	publishConnect(t, sub, "Acknowledged", "command-1")
+	publishConnect(t, sub, "Idle", "")
+
+	var events []Event
+	timeout := time.After(5 * time.Second)
+	for len(events) < 3 {
+		select {
+		case ev := <-received:
+			events = append(events, ev)
+		case <-timeout:
+			t.Fatalf("timed out with %d webhook events", len(events))
+		}
+	}
+	cancel()
+	<-done
+	close(received)
+	for ev := range received {
+		events = append(events, ev)
+	}
+
+	var results []Event
+	for _, ev := range events {
+		if ev.Topic == CommandResultTopic {
+			results = append(results, ev)
+		}
+	}
+	if have, want := len(results), 1; have != want {
+		t.Fatalf("have %d command result webhooks, want %d", have, want)
+	}
+	result := results[0].CommandResultEvent
+	if result == nil {
+		t.Fatal("command result webhook without command_result_event")
+	}
+	if result.CommandUUID != "command-1" || result.Status != "Acknowledged" || result.UDID != "UDID" {
+		t.Errorf("unexpected command result %+v", result)
+	}
+	if have, want := string(result.RawPayload), "raw-Acknowledged"; have != want {
+		t.Errorf("have raw payload %q, want %q", have, want)
+	}
+}